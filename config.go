@@ -0,0 +1,138 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// configFileNames are the configuration files looked for in the working
+// directory, in order, before falling back to ~/.lqlrc.
+var configFileNames = []string{".lqlrc", "lql.yaml"}
+
+// cliConfig holds flag defaults read from a configuration file:
+//
+//	defaults:
+//	  theme: vivid
+//	test:
+//	  test-file: tests/*.yml
+//	  fail-fast: true
+//	exec:
+//	  public: keys/public.pem
+//
+// Sections other than defaults are named after subcommands and map flag
+// names to values. Entries in defaults apply to every subcommand that has
+// the flag; a subcommand's own section takes precedence.
+type cliConfig struct {
+	path     string
+	sections map[string]map[string]interface{}
+}
+
+// findConfigFile returns the configuration file to use: $LQL_CONFIG when
+// set, otherwise the first of configFileNames in the working directory,
+// otherwise ~/.lqlrc. It returns "" when there is none.
+func findConfigFile() string {
+	if path, ok := os.LookupEnv("LQL_CONFIG"); ok {
+		return path
+	}
+	candidates := append([]string(nil), configFileNames...)
+	if home, err := os.UserHomeDir(); err == nil {
+		candidates = append(candidates, filepath.Join(home, ".lqlrc"))
+	}
+	for _, path := range candidates {
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+	}
+	return ""
+}
+
+// loadConfig reads the configuration file at path.
+func loadConfig(path string) (*cliConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config := &cliConfig{path: path}
+	if err := yaml.Unmarshal(data, &config.sections); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return config, nil
+}
+
+// apply sets the flags of fs, the flag set of a subcommand, to the values
+// configured for it. Flags set afterwards on the command line override
+// them.
+func (c *cliConfig) apply(fs *flag.FlagSet) error {
+	for name, value := range c.sections["defaults"] {
+		if fs.Lookup(name) == nil {
+			continue
+		}
+		if _, overridden := c.sections[fs.Name()][name]; overridden {
+			continue
+		}
+		if err := setFlag(fs, name, value); err != nil {
+			return fmt.Errorf("%s: defaults: %v", c.path, err)
+		}
+	}
+	for name, value := range c.sections[fs.Name()] {
+		if fs.Lookup(name) == nil {
+			return fmt.Errorf("%s: %s: unknown flag %q", c.path, fs.Name(), name)
+		}
+		if err := setFlag(fs, name, value); err != nil {
+			return fmt.Errorf("%s: %s: %v", c.path, fs.Name(), err)
+		}
+	}
+	return nil
+}
+
+// setFlag sets a flag from a configured value. A list is joined with
+// commas, as flags taking several values expect; a map sets the flag once
+// per entry as key=value, for repeatable flags such as compile -label.
+func setFlag(fs *flag.FlagSet, name string, value interface{}) error {
+	switch v := value.(type) {
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = fmt.Sprint(item)
+		}
+		value = strings.Join(items, ",")
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if err := fs.Set(name, fmt.Sprintf("%s=%v", key, v[key])); err != nil {
+				return fmt.Errorf("invalid value for flag %q: %v", name, err)
+			}
+		}
+		return nil
+	case nil:
+		return nil
+	}
+	if err := fs.Set(name, fmt.Sprint(value)); err != nil {
+		return fmt.Errorf("invalid value for flag %q: %v", name, err)
+	}
+	return nil
+}
+
+// parseArgs parses the command line of a subcommand on top of the defaults
+// from the configuration file, if there is one.
+func parseArgs(fs *flag.FlagSet) error {
+	if path := findConfigFile(); path != "" {
+		config, err := loadConfig(path)
+		if err != nil {
+			return err
+		}
+		if err := config.apply(fs); err != nil {
+			return err
+		}
+	}
+	return fs.Parse(os.Args[2:])
+}
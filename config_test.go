@@ -0,0 +1,136 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeConfig writes a configuration file and points LQL_CONFIG at it.
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), ".lqlrc")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("LQL_CONFIG", path)
+	return path
+}
+
+// labels is a repeatable key=value flag, like compile -label.
+type labels []string
+
+func (l *labels) String() string     { return strings.Join(*l, ",") }
+func (l *labels) Set(v string) error { *l = append(*l, v); return nil }
+
+// parseWith parses args for a subcommand named name, as parseArgs does.
+func parseWith(t *testing.T, fs *flag.FlagSet, args ...string) error {
+	t.Helper()
+	saved := os.Args
+	os.Args = append([]string{"lql", fs.Name()}, args...)
+	defer func() { os.Args = saved }()
+	return parseArgs(fs)
+}
+
+func TestConfigMerging(t *testing.T) {
+	writeConfig(t, `
+defaults:
+  theme: vivid
+  fail-fast: true
+  verbose: true
+test:
+  theme: mono
+  test-file: tests/*.yml
+  label:
+    team: core
+    env: prod
+exec:
+  public: keys/public.pem
+`)
+	newTest := func() (*flag.FlagSet, *string, *string, *bool, *labels) {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		theme := fs.String("theme", "default", "")
+		testFile := fs.String("test-file", "", "")
+		failFast := fs.Bool("fail-fast", false, "")
+		var l labels
+		fs.Var(&l, "label", "")
+		return fs, theme, testFile, failFast, &l
+	}
+
+	// The subcommand's section overrides defaults, which apply to every
+	// subcommand with the flag; defaults for flags it lacks are ignored.
+	fs, theme, testFile, failFast, l := newTest()
+	if err := parseWith(t, fs); err != nil {
+		t.Fatal(err)
+	}
+	if *theme != "mono" || *testFile != "tests/*.yml" || !*failFast {
+		t.Errorf("got theme %s, test-file %s, fail-fast %t", *theme, *testFile, *failFast)
+	}
+	if l.String() != "env=prod,team=core" {
+		t.Errorf("labels %s", l)
+	}
+
+	// Explicit flags override both.
+	fs, theme, testFile, failFast, _ = newTest()
+	if err := parseWith(t, fs, "-theme=plain", "-test-file", "other.yml", "-fail-fast=false"); err != nil {
+		t.Fatal(err)
+	}
+	if *theme != "plain" || *testFile != "other.yml" || *failFast {
+		t.Errorf("got theme %s, test-file %s, fail-fast %t", *theme, *testFile, *failFast)
+	}
+
+	// A subcommand with no section of its own takes the defaults.
+	fs = flag.NewFlagSet("repl", flag.ContinueOnError)
+	replTheme := fs.String("theme", "default", "")
+	if err := parseWith(t, fs); err != nil || *replTheme != "vivid" {
+		t.Errorf("got theme %s, %v", *replTheme, err)
+	}
+}
+
+func TestConfigErrors(t *testing.T) {
+	tests := []struct {
+		config, want string
+	}{
+		{"test:\n  nosuch: 1\n", `test: unknown flag "nosuch"`},
+		{"test:\n  count: many\n", `test: invalid value for flag "count"`},
+		{"defaults:\n  count: many\n", `defaults: invalid value for flag "count"`},
+		{"test: [\n", ".lqlrc"},
+	}
+	for _, tt := range tests {
+		writeConfig(t, tt.config)
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.Int("count", 0, "")
+		if err := parseWith(t, fs); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%q: got %v, want an error containing %q", tt.config, err, tt.want)
+		}
+	}
+}
+
+func TestFindConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("LQL_CONFIG", "")
+	os.Unsetenv("LQL_CONFIG")
+	if got := findConfigFile(); got != "" {
+		t.Errorf("found %s with no configuration", got)
+	}
+	if err := os.WriteFile("lql.yaml", nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got := findConfigFile(); got != "lql.yaml" {
+		t.Errorf("got %q, want lql.yaml", got)
+	}
+	if err := os.WriteFile(".lqlrc", nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got := findConfigFile(); got != ".lqlrc" {
+		t.Errorf("got %q, want .lqlrc", got)
+	}
+	t.Setenv("LQL_CONFIG", "elsewhere.yaml")
+	if got := findConfigFile(); got != "elsewhere.yaml" {
+		t.Errorf("got %q, want $LQL_CONFIG", got)
+	}
+}
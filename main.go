@@ -5,19 +5,29 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"github.com/SpecDrivenDesign/lql/pkg/analyze"
+	"github.com/SpecDrivenDesign/lql/pkg/ast"
 	"github.com/SpecDrivenDesign/lql/pkg/ast/expressions"
 	"github.com/SpecDrivenDesign/lql/pkg/bytecode"
+	"github.com/SpecDrivenDesign/lql/pkg/capabilities"
+	"github.com/SpecDrivenDesign/lql/pkg/debug"
 	"github.com/SpecDrivenDesign/lql/pkg/env"
 	"github.com/SpecDrivenDesign/lql/pkg/errors"
 	"github.com/SpecDrivenDesign/lql/pkg/lexer"
+	"github.com/SpecDrivenDesign/lql/pkg/lint"
+	"github.com/SpecDrivenDesign/lql/pkg/lql"
 	"github.com/SpecDrivenDesign/lql/pkg/parser"
 	"github.com/SpecDrivenDesign/lql/pkg/signing"
 	"github.com/SpecDrivenDesign/lql/pkg/testing"
+	"github.com/SpecDrivenDesign/lql/pkg/vm"
 	"gopkg.in/yaml.v3"
 	"io"
 	"log"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // Color constants
@@ -30,40 +40,65 @@ const (
 	colorYellow  = "\033[33m"
 )
 
+// defaultMaxDepth is the default of exec's -max-depth: deep enough for any
+// rule written by hand, and shallow enough that evaluation cannot overflow
+// the stack.
+const defaultMaxDepth = 10000
+
+// subcommand is an lql subcommand, its usage line and its entry point.
+type subcommand struct {
+	name  string
+	usage string
+	run   func()
+}
+
+// subcommands lists the subcommands in the order the usage message shows
+// them.
+var subcommands = []subcommand{
+	{"test", "[--test-file=testcases.yml] [--fail-fast] [--verbose] [--output text|yaml]", runTestCmd},
+	{"compile", "-expr \"<expression>\" -out <outfile> [-signed -private <private.pem> [-expires <time|duration>] [-label k=v]] [-embed-source]", runCompileCmd},
+	{"exec", "-in <infile> [-signed -public <public.pem>] [-seed <n>] [-max-nodes <n>]", runExecCmd},
+	{"repl", "-expr \"<expression>\" [-format json|yaml] [-debug]", runReplCmd},
+	{"validate", "-expr \"<expression>\" | -in <file> [-schema <schema.json>]", runValidateCmd},
+	{"highlight", "-expr \"<expression>\" [-theme mild|vivid|dracula|solarized]", runHighlightCmd},
+	{"fmt", "-expr \"<expression>\" | -in <file> [-indent <string>] [-width <n>] [-w] [-keep-comments] [-minify]", runFmtCmd},
+	{"diff", "-old \"<expression>\" | -old-in <file> -new \"<expression>\" | -new-in <file>", runDiffCmd},
+	{"translate", "-expr \"<expression>\" | -in <file> [-target cel|js|mongo] [-context <name>]", runTranslateCmd},
+	{"lint", "-expr \"<expression>\" | -in <file> [-disable <rule,...>] [-severity <rule=level,...>] [-format text|json]", runLintCmd},
+	{"export-contexts", "-expr \"<expression>\" | -in <file> [-types | -json-schema]", runExportContextsCmd},
+	{"strip", "-in <infile> -out <outfile> [-signed -public <public.pem> -private <private.pem>]", runStripCmd},
+	{"capabilities", "[-output text|json]", runCapabilitiesCmd},
+	{"functions", "[-library <name>] [-complete <prefix>] [-output text|json]", runFunctionsCmd},
+}
+
+// printUsage prints the subcommands and their usage lines.
+func printUsage() {
+	names := make([]string, len(subcommands))
+	for i, cmd := range subcommands {
+		names[i] = cmd.name
+	}
+	fmt.Printf("Subcommand required: %s, or %s\n", strings.Join(names[:len(names)-1], ", "), names[len(names)-1])
+	fmt.Println("Usage:")
+	for _, cmd := range subcommands {
+		fmt.Printf("  lql %s %s\n", cmd.name, cmd.usage)
+	}
+}
+
 func main() {
 	if len(os.Args) < 2 {
-		fmt.Println("Subcommand required: test, compile, exec, repl, validate, or highlight")
-		fmt.Println("Usage:")
-		fmt.Println("  lql test [--test-file=testcases.yml] [--fail-fast] [--verbose] [--output text|yaml]")
-		fmt.Println("  lql compile -expr \"<expression>\" -out <outfile> [-signed -private <private.pem>]")
-		fmt.Println("  lql exec -in <infile> [-signed -public <public.pem>]")
-		fmt.Println("  lql repl -expr \"<expression>\" [-format json|yaml]")
-		fmt.Println("  lql validate -expr \"<expression>\" | -in <file>")
-		fmt.Println("  lql highlight -expr \"<expression>\" [-theme mild|vivid|dracula|solarized]")
-		fmt.Println("  lql export-contexts -expr \"<expression>\" | -in <file>")
-		os.Exit(1)
-	}
-
-	subcommand := os.Args[1]
-	switch subcommand {
-	case "test":
-		runTestCmd()
-	case "compile":
-		runCompileCmd()
-	case "exec":
-		runExecCmd()
-	case "repl":
-		runReplCmd()
-	case "validate":
-		runValidateCmd()
-	case "highlight":
-		runHighlightCmd()
-	case "export-contexts":
-		runExportContextsCmd()
-	default:
-		fmt.Printf("Unknown subcommand: %s\n", subcommand)
+		printUsage()
 		os.Exit(1)
 	}
+
+	name := os.Args[1]
+	for _, cmd := range subcommands {
+		if cmd.name == name {
+			cmd.run()
+			return
+		}
+	}
+	fmt.Printf("Unknown subcommand: %s\n", name)
+	os.Exit(1)
 }
 
 func runTestCmd() {
@@ -72,9 +107,13 @@ func runTestCmd() {
 	failFastPtr := testCmd.Bool("fail-fast", false, "Stop on first failure")
 	verbosePtr := testCmd.Bool("verbose", false, "Verbose output")
 	outputFormatPtr := testCmd.String("output", "text", "Output format: text or yaml")
-	testFile := testCmd.String("test-file", "testcases.yml", "YAML file containing test cases")
+	testFile := testCmd.String("test-file", "testcases.yml", "YAML file containing test cases, or a comma-separated list of files and glob patterns")
 	benchmarkPtr := testCmd.Bool("benchmark", false, "Run each expression 1000 times and print benchmark info (only for function calls)")
-	if err := testCmd.Parse(os.Args[2:]); err != nil {
+	compiledPtr := testCmd.Bool("compiled", false, "Evaluate expressions as programs compiled to closures")
+	memoizePtr := testCmd.Bool("memoize", false, "Evaluate expressions as compiled programs that memoize repeated subexpressions")
+	vmPtr := testCmd.Bool("vm", false, "Run expressions as programs compiled to instructions")
+	concurrencyPtr := testCmd.Int("concurrency", 1, "Repeat each evaluation from this many goroutines at once and check they agree")
+	if err := parseArgs(testCmd); err != nil {
 		fmt.Printf("Error reading command line args: %v\n", err)
 		os.Exit(1)
 	}
@@ -83,19 +122,36 @@ func runTestCmd() {
 		os.Exit(0)
 	}
 
-	data, err := os.ReadFile(*testFile)
+	files, err := testFiles(*testFile)
 	if err != nil {
 		log.Fatalf("Error reading file: %s", err)
 	}
-
 	var testCases []testing.TestCase
-	err = yaml.Unmarshal(data, &testCases)
-	if err != nil {
-		log.Fatalf("Error parsing YAML: %s", err)
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			log.Fatalf("Error reading file: %s", err)
+		}
+		var fileCases []testing.TestCase
+		err = yaml.Unmarshal(data, &fileCases)
+		if err != nil {
+			log.Fatalf("Error parsing YAML in %s: %s", file, err)
+		}
+		testCases = append(testCases, fileCases...)
 	}
 
+	evaluator := testing.TreeEvaluator
+	if *compiledPtr {
+		evaluator = testing.CompiledEvaluator
+	}
+	if *memoizePtr {
+		evaluator = testing.MemoizedEvaluator
+	}
+	if *vmPtr {
+		evaluator = testing.VMEvaluator
+	}
 	env := env.NewEnvironment()
-	suiteResult := testing.RunTests(testCases, env, *failFastPtr, *benchmarkPtr)
+	suiteResult := testing.RunTests(testCases, env, *failFastPtr, *benchmarkPtr, evaluator, *concurrencyPtr)
 
 	// Output printing remains here.
 	if strings.ToLower(*outputFormatPtr) == "yaml" {
@@ -110,6 +166,32 @@ func runTestCmd() {
 	os.Exit(0)
 }
 
+// testFiles expands the -test-file value into file names. Each
+// comma-separated entry is a file or a glob pattern; a pattern must match
+// at least one file.
+func testFiles(value string) ([]string, error) {
+	var files []string
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.ContainsAny(entry, "*?[") {
+			files = append(files, entry)
+			continue
+		}
+		matches, err := filepath.Glob(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %v", entry, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no test files match %q", entry)
+		}
+		files = append(files, matches...)
+	}
+	return files, nil
+}
+
 func runCompileCmd() {
 	compileCmd := flag.NewFlagSet("compile", flag.ExitOnError)
 	expr := compileCmd.String("expr", "", "DSL expression to compile")
@@ -117,8 +199,21 @@ func runCompileCmd() {
 	outFile := compileCmd.String("out", "", "Output filename for compiled byteCode")
 	signed := compileCmd.Bool("signed", false, "Whether to sign the compiled byteCode")
 	privateKeyFile := compileCmd.String("private", "private.pem", "Path to RSA private key for signing (required if -signed is true)")
+	embedSource := compileCmd.Bool("embed-source", false, "Embed the original source text so exec-time errors can show snippets")
+	languageVersion := compileCmd.String("language-version", parser.LatestLanguageVersion, "Language version to compile for; newer syntax is rejected")
+	expires := compileCmd.String("expires", "", "Expiry for signed byteCode, as an RFC3339 timestamp or a duration such as 720h")
+	format := compileCmd.String("format", "vm", "Artifact format: vm (compiled instructions) or tokens")
+	labels := map[string]string{}
+	compileCmd.Func("label", "Signed metadata label as key=value (repeatable)", func(v string) error {
+		key, value, ok := strings.Cut(v, "=")
+		if !ok || key == "" {
+			return fmt.Errorf("label must be key=value")
+		}
+		labels[key] = value
+		return nil
+	})
 
-	if err := compileCmd.Parse(os.Args[2:]); err != nil {
+	if err := parseArgs(compileCmd); err != nil {
 		fmt.Printf("Error reading command line args: %v\n", err)
 		os.Exit(1)
 	}
@@ -143,9 +238,68 @@ func runCompileCmd() {
 		os.Exit(1)
 	}
 
+	if (*expires != "" || len(labels) > 0) && !*signed {
+		fmt.Println("The -expires and -label flags require -signed.")
+		compileCmd.Usage()
+		os.Exit(1)
+	}
+
+	if *format != "vm" && *format != "tokens" {
+		fmt.Println("The -format flag must be vm or tokens.")
+		compileCmd.Usage()
+		os.Exit(1)
+	}
+
+	// Parse at the requested language version so newer syntax is rejected
+	// here rather than by an older executor. The parser replays the tokens
+	// that are exported below, so the input is lexed only once.
 	lex := lexer.NewLexer(expression)
+	lex.SetEmbedSource(*embedSource)
+	toks, err := lex.Tokens()
+	if err != nil {
+		log.Fatalf("Error parsing expression: %v", err)
+	}
+	p, err := parser.NewParser(lexer.NewTokenSliceStream(toks))
+	if err != nil {
+		log.Fatalf("Error creating parser: %v", err)
+	}
+	if err := p.SetLanguageVersion(*languageVersion); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	parsed, err := p.ParseExpression()
+	if err != nil {
+		log.Fatalf("Error parsing expression: %v", err)
+	}
+
+	// A vm artifact holds the compiled instructions in place of the tokens,
+	// so executors run it without parsing.
+	var payload []byte
+	if *format == "vm" {
+		program, err := vm.Compile(parsed)
+		if err != nil {
+			log.Fatalf("Error compiling expression: %v", err)
+		}
+		code, err := program.Encode()
+		if err != nil {
+			log.Fatalf("Error encoding instructions: %v", err)
+		}
+		source := ""
+		if *embedSource {
+			source = expression
+		}
+		payload, err = bytecode.WithCode(code, source)
+		if err != nil {
+			log.Fatalf("Error exporting instructions: %v", err)
+		}
+	} else {
+		payload, err = lex.ExportTokens()
+		if err != nil {
+			log.Fatalf("Error exporting tokens: %v", err)
+		}
+	}
+
+	meta := bytecode.Metadata{LanguageVersion: *languageVersion}
 	var byteCode []byte
-	var err error
 	if *signed {
 		if *privateKeyFile == "" {
 			fmt.Println("Private key file must be provided when -signed is true.")
@@ -156,14 +310,32 @@ func runCompileCmd() {
 		if err != nil {
 			log.Fatalf("Error loading private key: %v", err)
 		}
-		byteCode, err = lex.ExportTokensSigned(privateKey)
+		if *expires != "" || len(labels) > 0 {
+			now := time.Now()
+			meta.IssuedAt = now.UnixMilli()
+			if len(labels) > 0 {
+				meta.Labels = labels
+			}
+			if *expires != "" {
+				expiresAt, err := parseExpiry(*expires, now)
+				if err != nil {
+					log.Fatalf("Error parsing -expires: %v", err)
+				}
+				meta.ExpiresAt = expiresAt.UnixMilli()
+			}
+		}
+		signedData, err := bytecode.WithMetadata(meta, payload)
+		if err != nil {
+			log.Fatalf("Error encoding metadata: %v", err)
+		}
+		byteCode, err = signing.SignTokenData(signedData, privateKey)
 		if err != nil {
 			log.Fatalf("Error exporting signed tokens: %v", err)
 		}
 	} else {
-		byteCode, err = lex.ExportTokens()
+		byteCode, err = bytecode.WithMetadata(meta, payload)
 		if err != nil {
-			log.Fatalf("Error exporting tokens: %v", err)
+			log.Fatalf("Error encoding metadata: %v", err)
 		}
 	}
 
@@ -174,6 +346,18 @@ func runCompileCmd() {
 	fmt.Printf("Compilation successful. Bytecode written to %s\n", *outFile)
 }
 
+// parseExpiry accepts either an RFC3339 timestamp or a duration relative to now.
+func parseExpiry(value string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("expected an RFC3339 timestamp or a duration, got %q", value)
+	}
+	return now.Add(d), nil
+}
+
 func runExecCmd() {
 	execCmd := flag.NewFlagSet("exec", flag.ExitOnError)
 	inFile := execCmd.String("in", "", "Input filename of compiled bytecode")
@@ -181,7 +365,18 @@ func runExecCmd() {
 	signed := execCmd.Bool("signed", false, "Indicate if the bytecode is signed (only used with -in)")
 	publicKeyFile := execCmd.String("public", "", "Path to RSA public key for signature verification (required if -signed is true)")
 	contextFormat := execCmd.String("format", "yaml", "Format of context input from stdin: json or yaml")
-	if err := execCmd.Parse(os.Args[2:]); err != nil {
+	capabilities := execCmd.String("capabilities", "", "Comma-separated capabilities granted to the expression (default: all)")
+	seed := execCmd.String("seed", "", "Integer seed that makes random functions deterministic")
+	explain := execCmd.Bool("explain", false, "Print the expression tree with the value of every node before the result")
+	var limits env.Limits
+	execCmd.Int64Var(&limits.MaxNodeEvaluations, "max-nodes", 0, "Maximum number of expression nodes evaluated (0: unlimited)")
+	execCmd.IntVar(&limits.MaxArrayLength, "max-array-length", 0, "Maximum length of arrays produced during evaluation (0: unlimited)")
+	execCmd.IntVar(&limits.MaxStringLength, "max-string-length", 0, "Maximum length of strings returned by functions (0: unlimited)")
+	execCmd.Int64Var(&limits.MaxAllocatedBytes, "max-bytes", 0, "Maximum estimated bytes allocated during evaluation (0: unlimited)")
+	execCmd.IntVar(&limits.MaxDepth, "max-depth", defaultMaxDepth, "Maximum nesting depth of the expressions evaluated (0: unlimited)")
+	profile := execCmd.String("profile", "full", "Functions the expression may call: pure, no-time or full")
+	parallelism := execCmd.Int("parallelism", 1, "Number of goroutines that may evaluate independent function calls of -expr at once")
+	if err := parseArgs(execCmd); err != nil {
 		fmt.Printf("Error reading command line args: %v\n", err)
 		os.Exit(1)
 	}
@@ -219,8 +414,9 @@ func runExecCmd() {
 		if err != nil {
 			log.Fatalf("Error parsing expression: %v", err)
 		}
-		env := env.NewEnvironment()
-		result, err := ast.Eval(ctx, env)
+		env := newExecEnvironment(*capabilities, *seed, *profile, limits)
+		env.SetParallelism(*parallelism)
+		result, err := evalForExec(ast, ctx, env, *explain)
 		if err != nil {
 			log.Fatalf("Error executing expression: %v", err)
 		}
@@ -233,7 +429,7 @@ func runExecCmd() {
 		log.Fatalf("Error reading input file: %v", err)
 	}
 
-	var tokenStream parser.TokenStream
+	var reader *bytecode.ByteCodeReader
 	if *signed {
 		if *publicKeyFile == "" {
 			fmt.Println("Public key file must be provided when -signed is true.")
@@ -244,34 +440,124 @@ func runExecCmd() {
 		if err != nil {
 			log.Fatalf("Error loading public key: %v", err)
 		}
-		tokenStream, err = bytecode.NewByteCodeReaderFromSignedData(data, pubKey)
+		reader, err = bytecode.NewByteCodeReaderFromSignedData(data, pubKey)
 		if err != nil {
 			log.Fatalf("Error verifying signed bytecode: %v", err)
 		}
 	} else {
-		tokenStream = bytecode.NewByteCodeReader(data)
+		reader = bytecode.NewByteCodeReader(data)
+	}
+
+	if code := reader.Code(); code != nil {
+		runCodeForExec(reader, code, ctx, newExecEnvironment(*capabilities, *seed, *profile, limits), *explain)
+		return
 	}
 
-	p, err := parser.NewParser(tokenStream)
+	p, err := parser.NewParser(reader)
 	if err != nil {
 		log.Fatalf("Error creating p: %v", err)
 	}
+	if meta := reader.Metadata(); meta != nil && meta.LanguageVersion != "" {
+		if err := p.SetLanguageVersion(meta.LanguageVersion); err != nil {
+			log.Fatalf("Error: bytecode was compiled for a language version this executor does not support: %v", err)
+		}
+	}
 	ast, err := p.ParseExpression()
 	if err != nil {
+		printSourceContext(reader.Source(), err)
 		log.Fatalf("Error parsing expression from bytecode: %v", err)
 	}
-	env := env.NewEnvironment()
-	result, err := ast.Eval(ctx, env)
+	env := newExecEnvironment(*capabilities, *seed, *profile, limits)
+	result, err := evalForExec(ast, ctx, env, *explain)
+	if err != nil {
+		printSourceContext(reader.Source(), err)
+		log.Fatalf("Error executing bytecode: %v", err)
+	}
+	fmt.Printf("Execution result: %v\n", result)
+}
+
+// runCodeForExec runs the compiled instructions of a vm artifact.
+func runCodeForExec(reader *bytecode.ByteCodeReader, code []byte, ctx map[string]interface{}, e *env.Environment, explain bool) {
+	if meta := reader.Metadata(); meta != nil && meta.LanguageVersion != "" {
+		if err := parser.CheckLanguageVersion(meta.LanguageVersion); err != nil {
+			log.Fatalf("Error: bytecode was compiled for a language version this executor does not support: %v", err)
+		}
+	}
+	if explain {
+		log.Fatalf("Error: -explain needs the expression tree; compile the rule with -format tokens")
+	}
+	program, err := vm.Decode(code)
+	if err != nil {
+		log.Fatalf("Error decoding bytecode: %v", err)
+	}
+	result, err := program.Run(ctx, e)
 	if err != nil {
+		printSourceContext(reader.Source(), err)
 		log.Fatalf("Error executing bytecode: %v", err)
 	}
 	fmt.Printf("Execution result: %v\n", result)
 }
 
+// evalForExec evaluates expr, first printing the value of every node when
+// explain is set.
+func evalForExec(expr ast.Expression, ctx map[string]interface{}, e *env.Environment, explain bool) (interface{}, error) {
+	if !explain {
+		return expr.Eval(ctx, e)
+	}
+	explanation, result, err := debug.ExplainEval(expr, ctx, e)
+	fmt.Println(explanation)
+	return result, err
+}
+
+// newExecEnvironment builds an environment restricted to the given
+// comma-separated capabilities; an empty list keeps the defaults. A
+// non-empty seed makes the random library deterministic, profile names the
+// functions the expression may call, and limits bound the resources the
+// evaluation may use.
+func newExecEnvironment(capabilities, seed, profile string, limits env.Limits) *env.Environment {
+	e := env.NewEnvironment()
+	e.Limits = limits
+	p, ok := env.LookupProfile(profile)
+	if !ok {
+		log.Fatalf("Invalid -profile %q: must be pure, no-time or full", profile)
+	}
+	e.Profile = p
+	if seed != "" {
+		n, err := strconv.ParseInt(seed, 10, 64)
+		if err != nil {
+			log.Fatalf("Invalid -seed %q: must be an integer", seed)
+		}
+		e.SetRandomSeed(n)
+	}
+	if strings.TrimSpace(capabilities) == "" {
+		return e
+	}
+	e.RevokeAll()
+	for _, c := range strings.Split(capabilities, ",") {
+		if c = strings.TrimSpace(c); c != "" && c != "none" {
+			e.Grant(c)
+		}
+	}
+	return e
+}
+
+// printSourceContext prints a caret snippet for err when the bytecode
+// carried its original source.
+func printSourceContext(source string, err error) {
+	if source == "" {
+		return
+	}
+	errLine, errColumn := errors.GetErrorPosition(err)
+	if errLine > 0 && errColumn > 0 {
+		_, _ = fmt.Fprintln(os.Stderr, errors.GetErrorContext(source, errLine, errColumn, true))
+	}
+}
+
 func runReplCmd() {
 	replCmd := flag.NewFlagSet("repl", flag.ExitOnError)
 	expr := replCmd.String("expr", "", "DSL expression to evaluate in REPL mode")
-	if err := replCmd.Parse(os.Args[2:]); err != nil {
+	debugMode := replCmd.Bool("debug", false, "Evaluate under the step debugger, reading debugger commands from stdin")
+	if err := parseArgs(replCmd); err != nil {
 		fmt.Printf("Error reading command line args: %v\n", err)
 		os.Exit(1)
 	}
@@ -290,6 +576,10 @@ func runReplCmd() {
 	if err != nil {
 		log.Fatalf("Error parsing expression: %v", err)
 	}
+	if *debugMode {
+		runDebugRepl(*expr, ast)
+		return
+	}
 	env := env.NewEnvironment()
 
 	fi, err := os.Stdin.Stat()
@@ -348,11 +638,154 @@ func runReplCmd() {
 	}
 }
 
+const debugHelp = `Commands:
+  step, s              stop at the next node entered or left
+  next, n              step over the current node
+  out, o               run until the parent node is left
+  continue, c          run to the next breakpoint
+  break, b LINE[:COL]  set a breakpoint (without COL: the outermost node on the line)
+  clear LINE[:COL]     remove a breakpoint
+  print, p [EXPR]      show the current node and its sub-values, or evaluate EXPR against the context
+  where, w             show the nodes under evaluation
+  quit, q              abort the evaluation`
+
+// runDebugRepl evaluates expr under the step debugger for each context read
+// from stdin. Debugger commands are read from stdin as well.
+func runDebugRepl(source string, expr ast.Expression) {
+	in := bufio.NewReader(os.Stdin)
+	readLine := func(prompt string) (string, bool) {
+		fmt.Print(prompt)
+		line, err := in.ReadString('\n')
+		if err != nil && line == "" {
+			fmt.Println()
+			return "", false
+		}
+		return strings.TrimSpace(line), true
+	}
+
+	d := debug.New(nil)
+	d.StopOnEntry = true
+	d.Handler = func(s *debug.Stop) debug.Action {
+		fmt.Println(s)
+		if s.Line > 0 && s.Column > 0 {
+			fmt.Println(errors.GetErrorContext(source, s.Line, s.Column, false))
+		}
+		for {
+			input, ok := readLine("(debug) ")
+			if !ok {
+				return debug.Abort
+			}
+			command, arg, _ := strings.Cut(input, " ")
+			arg = strings.TrimSpace(arg)
+			switch command {
+			case "step", "s":
+				return debug.StepInto
+			case "next", "n":
+				return debug.StepOver
+			case "out", "o":
+				return debug.StepOut
+			case "continue", "c":
+				return debug.Continue
+			case "quit", "q":
+				return debug.Abort
+			case "break", "b", "clear":
+				line, column, err := parseBreakpoint(arg)
+				if err != nil {
+					fmt.Println(err)
+					continue
+				}
+				if command == "clear" {
+					d.ClearBreakpoint(line, column)
+				} else {
+					d.SetBreakpoint(line, column)
+				}
+				fmt.Printf("Breakpoints: %v\n", d.Breakpoints())
+			case "print", "p":
+				if arg == "" {
+					fmt.Println(s.Node)
+					for _, child := range s.Children() {
+						if child.Err != nil {
+							fmt.Printf("  %s: error: %v\n", child.Node, child.Err)
+						} else {
+							fmt.Printf("  %s = %v\n", child.Node, child.Value)
+						}
+					}
+					continue
+				}
+				p, err := parser.NewParser(lexer.NewLexer(arg))
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
+					continue
+				}
+				printExpr, err := p.ParseExpression()
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
+					continue
+				}
+				value, err := printExpr.Eval(s.Context, env.NewEnvironment())
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
+					continue
+				}
+				fmt.Println(value)
+			case "where", "w":
+				for i, frame := range s.Stack {
+					line, column := frame.Node.Pos()
+					fmt.Printf("#%d %s at line %d, column %d\n", i, frame.Node, line, column)
+				}
+			case "help", "h", "":
+				fmt.Println(debugHelp)
+			default:
+				fmt.Printf("Unknown command %q; type help for a list of commands.\n", command)
+			}
+		}
+	}
+
+	for {
+		input, ok := readLine("Enter context (empty line to exit): ")
+		if !ok || input == "" {
+			fmt.Println("Exiting REPL.")
+			return
+		}
+		var ctx map[string]interface{}
+		if err := json.Unmarshal([]byte(input), &ctx); err != nil {
+			fmt.Printf("Error parsing context: %v\n", err)
+			continue
+		}
+		result, err := d.Run(expr, ctx, env.NewEnvironment())
+		if err == debug.ErrAborted {
+			fmt.Println("Evaluation aborted.")
+		} else if err != nil {
+			fmt.Printf("Error executing expression: %v\n", err)
+		} else {
+			fmt.Printf("Result: %v\n", result)
+		}
+	}
+}
+
+// parseBreakpoint parses a LINE or LINE:COL breakpoint position.
+func parseBreakpoint(arg string) (int, int, error) {
+	lineText, columnText, hasColumn := strings.Cut(arg, ":")
+	line, err := strconv.Atoi(lineText)
+	if err != nil || line < 1 {
+		return 0, 0, fmt.Errorf("expected a breakpoint as LINE or LINE:COL, got %q", arg)
+	}
+	column := 0
+	if hasColumn {
+		column, err = strconv.Atoi(columnText)
+		if err != nil || column < 1 {
+			return 0, 0, fmt.Errorf("expected a breakpoint as LINE or LINE:COL, got %q", arg)
+		}
+	}
+	return line, column, nil
+}
+
 func runValidateCmd() {
 	validateCmd := flag.NewFlagSet("validate", flag.ExitOnError)
 	expr := validateCmd.String("expr", "", "DSL expression to validate")
 	inFile := validateCmd.String("in", "", "File containing a DSL expression to validate")
-	if err := validateCmd.Parse(os.Args[2:]); err != nil {
+	schemaFile := validateCmd.String("schema", "", "JSON file describing the context (JSON Schema or lightweight schema) to type-check against")
+	if err := parseArgs(validateCmd); err != nil {
 		fmt.Printf("Error reading command line args: %v\n", err)
 		os.Exit(1)
 	}
@@ -380,14 +813,52 @@ func runValidateCmd() {
 		os.Exit(1)
 	}
 
-	_, err = p.ParseExpression()
+	ast, err := p.ParseExpression()
 	if err != nil {
 		fmt.Printf("%v\n", err)
 		os.Exit(1)
 	}
+	if problems := analyze.CheckCalls(ast, env.NewEnvironment()); len(problems) > 0 {
+		for _, problem := range problems {
+			fmt.Printf("%v\n", problem)
+		}
+		os.Exit(1)
+	}
+	if *schemaFile != "" {
+		schema, err := loadSchemaFile(*schemaFile)
+		if err != nil {
+			fmt.Printf("Error reading schema file: %v\n", err)
+			os.Exit(1)
+		}
+		problems := analyze.Check(ast, schema)
+		for _, problem := range problems {
+			fmt.Printf("%v\n", problem)
+		}
+		if len(problems) > 0 {
+			os.Exit(1)
+		}
+	}
 	os.Exit(0)
 }
 
+// loadSchemaFile reads a context schema. Documents whose root declares
+// "type": "object" with "properties" are read as JSON Schema; anything else
+// is taken as a lightweight schema.
+func loadSchemaFile(path string) (analyze.Schema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if _, ok := doc["properties"].(map[string]interface{}); ok && doc["type"] == "object" {
+		return analyze.SchemaFromJSONSchema(doc)
+	}
+	return analyze.Schema(doc), nil
+}
+
 func renderTextOutput(suite testing.TestSuiteResult, verbose bool) {
 	for _, res := range suite.TestResults {
 		if !verbose && res.Status == "PASSED" && res.BenchmarkTime == "" {
@@ -454,7 +925,7 @@ func runHighlightCmd() {
 	exprPtr := highlightCmd.String("expr", "", "Expression to highlight")
 	themePtr := highlightCmd.String("theme", "mild", "Color theme: mild|vivid|dracula|solarized")
 
-	if err := highlightCmd.Parse(os.Args[2:]); err != nil {
+	if err := parseArgs(highlightCmd); err != nil {
 		fmt.Printf("Error reading command line args: %v\n", err)
 		os.Exit(1)
 	}
@@ -499,11 +970,269 @@ func runHighlightCmd() {
 	fmt.Println(highlighted)
 }
 
+func runFmtCmd() {
+	fmtCmd := flag.NewFlagSet("fmt", flag.ExitOnError)
+	expr := fmtCmd.String("expr", "", "DSL expression to format")
+	inFile := fmtCmd.String("in", "", "File containing a DSL expression to format")
+	indent := fmtCmd.String("indent", "", "Indentation for multi-line output (single line when empty)")
+	width := fmtCmd.Int("width", 80, "Maximum line width for multi-line output")
+	write := fmtCmd.Bool("w", false, "Write the result back to the -in file")
+	keep := fmtCmd.Bool("keep-comments", false, "Keep comments and the written spelling of tokens instead of printing the canonical form")
+	minify := fmtCmd.Bool("minify", false, "Print the shortest equivalent expression instead of the canonical form")
+	if err := parseArgs(fmtCmd); err != nil {
+		fmt.Printf("Error reading command line args: %v\n", err)
+		os.Exit(1)
+	}
+
+	var expression string
+	if *inFile != "" {
+		data, err := os.ReadFile(*inFile)
+		if err != nil {
+			fmt.Printf("Error reading expression file: %v\n", err)
+			os.Exit(1)
+		}
+		expression = strings.TrimSpace(string(data))
+	} else if *expr != "" {
+		expression = *expr
+	} else {
+		fmt.Println("Either -expr or -in flag must be provided.")
+		fmtCmd.Usage()
+		os.Exit(1)
+	}
+
+	var formatted string
+	var err error
+	switch {
+	case *minify:
+		formatted, err = lql.MinifySource(expression)
+	case *keep:
+		formatted, err = lql.PrettySource(expression, lql.PrettyOptions{Indent: *indent, MaxWidth: *width})
+	default:
+		formatted, err = lql.FormatSource(expression, lql.FormatOptions{Indent: *indent, MaxWidth: *width})
+	}
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	if *write {
+		if *inFile == "" {
+			fmt.Println("The -w flag requires -in.")
+			os.Exit(1)
+		}
+		if err := os.WriteFile(*inFile, []byte(formatted+"\n"), 0644); err != nil {
+			fmt.Printf("Error writing expression file: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	fmt.Println(formatted)
+}
+
+func runDiffCmd() {
+	diffCmd := flag.NewFlagSet("diff", flag.ExitOnError)
+	oldExpr := diffCmd.String("old", "", "Original DSL expression")
+	oldFile := diffCmd.String("old-in", "", "File containing the original DSL expression")
+	newExpr := diffCmd.String("new", "", "Changed DSL expression")
+	newFile := diffCmd.String("new-in", "", "File containing the changed DSL expression")
+	if err := parseArgs(diffCmd); err != nil {
+		fmt.Printf("Error reading command line args: %v\n", err)
+		os.Exit(1)
+	}
+	parse := func(expr, file, which string) ast.Expression {
+		if file != "" {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				fmt.Printf("Error reading %s expression file: %v\n", which, err)
+				os.Exit(1)
+			}
+			expr = string(data)
+		} else if expr == "" {
+			fmt.Printf("Either -%s or -%s-in flag must be provided.\n", which, which)
+			diffCmd.Usage()
+			os.Exit(1)
+		}
+		p, err := parser.NewParser(lexer.NewLexer(expr))
+		if err != nil {
+			fmt.Printf("%s: %v\n", which, err)
+			os.Exit(1)
+		}
+		parsed, err := p.ParseExpression()
+		if err != nil {
+			fmt.Printf("%s: %v\n", which, err)
+			os.Exit(1)
+		}
+		return parsed
+	}
+	changes := ast.Diff(parse(*oldExpr, *oldFile, "old"), parse(*newExpr, *newFile, "new"))
+	for _, change := range changes {
+		fmt.Println(change)
+	}
+	if len(changes) > 0 {
+		os.Exit(1)
+	}
+}
+
+func runTranslateCmd() {
+	translateCmd := flag.NewFlagSet("translate", flag.ExitOnError)
+	expr := translateCmd.String("expr", "", "DSL expression to translate")
+	inFile := translateCmd.String("in", "", "File containing a DSL expression to translate")
+	targetName := translateCmd.String("target", "cel", "Target language: cel, js or mongo")
+	contextName := translateCmd.String("context", "", "Variable holding the context (default: none for cel, ctx for js)")
+	if err := parseArgs(translateCmd); err != nil {
+		fmt.Printf("Error reading command line args: %v\n", err)
+		os.Exit(1)
+	}
+
+	var expression string
+	if *inFile != "" {
+		data, err := os.ReadFile(*inFile)
+		if err != nil {
+			fmt.Printf("Error reading expression file: %v\n", err)
+			os.Exit(1)
+		}
+		expression = strings.TrimSpace(string(data))
+	} else if *expr != "" {
+		expression = *expr
+	} else {
+		fmt.Println("Either -expr or -in flag must be provided.")
+		translateCmd.Usage()
+		os.Exit(1)
+	}
+
+	var target lql.Target
+	switch strings.ToLower(*targetName) {
+	case "mongo":
+		p, err := parser.NewParser(lexer.NewLexer(expression))
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			os.Exit(1)
+		}
+		parsed, err := p.ParseExpression()
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			os.Exit(1)
+		}
+		filter, err := lql.ToMongoFilter(parsed)
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			os.Exit(1)
+		}
+		out, err := json.MarshalIndent(filter, "", "  ")
+		if err != nil {
+			fmt.Printf("Error encoding filter: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(out))
+		return
+	case "cel":
+		target = lql.TargetCEL
+	case "js", "javascript":
+		target = lql.TargetJavaScript
+	default:
+		fmt.Printf("Unknown target: %s\n", *targetName)
+		os.Exit(1)
+	}
+	translated, err := lql.TranslateSource(expression, target, lql.TranslateOptions{Context: *contextName})
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println(translated)
+}
+
+func runLintCmd() {
+	lintCmd := flag.NewFlagSet("lint", flag.ExitOnError)
+	expr := lintCmd.String("expr", "", "DSL expression to lint")
+	inFile := lintCmd.String("in", "", "File containing a DSL expression to lint")
+	disable := lintCmd.String("disable", "", "Comma-separated rules to skip")
+	severities := lintCmd.String("severity", "", "Comma-separated rule=level overrides (info, warning or error)")
+	format := lintCmd.String("format", "text", "Output format: text or json")
+	listRules := lintCmd.Bool("rules", false, "List the available rules and exit")
+	if err := parseArgs(lintCmd); err != nil {
+		fmt.Printf("Error reading command line args: %v\n", err)
+		os.Exit(1)
+	}
+	if *listRules {
+		for _, rule := range lint.DefaultRules() {
+			fmt.Printf("%-28s %-8s %s\n", rule.Name, rule.Severity, rule.Description)
+		}
+		return
+	}
+
+	var expression string
+	if *inFile != "" {
+		data, err := os.ReadFile(*inFile)
+		if err != nil {
+			fmt.Printf("Error reading expression file: %v\n", err)
+			os.Exit(1)
+		}
+		expression = string(data)
+	} else if *expr != "" {
+		expression = *expr
+	} else {
+		fmt.Println("Either -expr or -in flag must be provided.")
+		lintCmd.Usage()
+		os.Exit(1)
+	}
+
+	cfg := lint.Config{Severities: map[string]lint.Severity{}}
+	if *disable != "" {
+		cfg.Disabled = strings.Split(*disable, ",")
+	}
+	if *severities != "" {
+		for _, pair := range strings.Split(*severities, ",") {
+			name, level, ok := strings.Cut(pair, "=")
+			if !ok {
+				fmt.Printf("Invalid -severity value %q (expected rule=level)\n", pair)
+				os.Exit(1)
+			}
+			severity, err := lint.ParseSeverity(level)
+			if err != nil {
+				fmt.Printf("%v\n", err)
+				os.Exit(1)
+			}
+			cfg.Severities[strings.TrimSpace(name)] = severity
+		}
+	}
+
+	p, err := parser.NewParser(lexer.NewLexer(expression))
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	parsed, err := p.ParseExpression()
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	diagnostics := lint.Lint(parsed, cfg)
+	if *format == "json" {
+		if diagnostics == nil {
+			diagnostics = []lint.Diagnostic{}
+		}
+		out, err := json.MarshalIndent(diagnostics, "", "  ")
+		if err != nil {
+			fmt.Printf("Error encoding diagnostics: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(out))
+	} else {
+		for _, d := range diagnostics {
+			fmt.Println(d)
+		}
+	}
+	if lint.HasErrors(diagnostics) {
+		os.Exit(1)
+	}
+}
+
 func runExportContextsCmd() {
 	exportCmd := flag.NewFlagSet("export-contexts", flag.ExitOnError)
 	expr := exportCmd.String("expr", "", "DSL expression to extract context identifiers from")
 	inFile := exportCmd.String("in", "", "File containing a DSL expression")
-	if err := exportCmd.Parse(os.Args[2:]); err != nil {
+	withTypes := exportCmd.Bool("types", false, "Print the type each context path is used as")
+	jsonSchema := exportCmd.Bool("json-schema", false, "Print a JSON Schema of the context the expression requires")
+	if err := parseArgs(exportCmd); err != nil {
 		fmt.Printf("Error reading command line args: %v\n", err)
 		os.Exit(1)
 	}
@@ -522,6 +1251,31 @@ func runExportContextsCmd() {
 		exportCmd.Usage()
 		os.Exit(1)
 	}
+	if *withTypes || *jsonSchema {
+		p, err := parser.NewParser(lexer.NewLexer(expression))
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			os.Exit(1)
+		}
+		ast, err := p.ParseExpression()
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			os.Exit(1)
+		}
+		if *jsonSchema {
+			out, err := json.MarshalIndent(analyze.ContextSchema(ast), "", "  ")
+			if err != nil {
+				fmt.Printf("Error encoding schema: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Println(string(out))
+			return
+		}
+		for _, dep := range analyze.Dependencies(ast) {
+			fmt.Printf("%s: %s\n", dep.Path, dep.Type)
+		}
+		return
+	}
 	lex := lexer.NewLexer(expression)
 	identifiers, err := lex.ExtractContextIdentifiers()
 	if err != nil {
@@ -532,3 +1286,151 @@ func runExportContextsCmd() {
 		fmt.Println(id)
 	}
 }
+
+func runStripCmd() {
+	stripCmd := flag.NewFlagSet("strip", flag.ExitOnError)
+	inFile := stripCmd.String("in", "", "Input filename of compiled bytecode")
+	outFile := stripCmd.String("out", "", "Output filename for the stripped bytecode")
+	signed := stripCmd.Bool("signed", false, "Indicate if the bytecode is signed")
+	publicKeyFile := stripCmd.String("public", "", "Path to RSA public key for signature verification (required if -signed is true)")
+	privateKeyFile := stripCmd.String("private", "", "Path to RSA private key for re-signing (required if -signed is true)")
+	if err := parseArgs(stripCmd); err != nil {
+		fmt.Printf("Error reading command line args: %v\n", err)
+		os.Exit(1)
+	}
+	if *inFile == "" || *outFile == "" {
+		fmt.Println("Both -in and -out flags must be provided.")
+		stripCmd.Usage()
+		os.Exit(1)
+	}
+
+	data, err := os.ReadFile(*inFile)
+	if err != nil {
+		log.Fatalf("Error reading input file: %v", err)
+	}
+
+	var stripped []byte
+	if *signed {
+		if *publicKeyFile == "" || *privateKeyFile == "" {
+			fmt.Println("Public and private key files must be provided when -signed is true.")
+			stripCmd.Usage()
+			os.Exit(1)
+		}
+		pubKey, err := signing.LoadPublicKey(*publicKeyFile)
+		if err != nil {
+			log.Fatalf("Error loading public key: %v", err)
+		}
+		tokenData, err := bytecode.VerifySignedData(data, pubKey)
+		if err != nil {
+			log.Fatalf("Error verifying signed bytecode: %v", err)
+		}
+		privateKey, err := signing.LoadPrivateKey(*privateKeyFile)
+		if err != nil {
+			log.Fatalf("Error loading private key: %v", err)
+		}
+		stripped, err = signing.SignTokenData(bytecode.StripSource(tokenData), privateKey)
+		if err != nil {
+			log.Fatalf("Error re-signing bytecode: %v", err)
+		}
+	} else {
+		stripped = bytecode.StripSource(data)
+	}
+
+	err = os.WriteFile(*outFile, stripped, 0600)
+	if err != nil {
+		log.Fatalf("Error writing output file: %v", err)
+	}
+	fmt.Printf("Source stripped. Bytecode written to %s\n", *outFile)
+}
+
+func runCapabilitiesCmd() {
+	capabilitiesCmd := flag.NewFlagSet("capabilities", flag.ExitOnError)
+	output := capabilitiesCmd.String("output", "text", "Output format: text or json")
+	if err := parseArgs(capabilitiesCmd); err != nil {
+		fmt.Printf("Error reading command line args: %v\n", err)
+		os.Exit(1)
+	}
+
+	report := capabilities.New(env.NewEnvironment())
+	if *output == "json" {
+		out, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			fmt.Printf("Error encoding capabilities: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(out))
+		return
+	}
+
+	fmt.Printf("Language versions: %s (latest %s)\n", strings.Join(report.LanguageVersions, ", "), report.LatestLanguageVersion)
+	fmt.Printf("Bytecode: signed header %s, sections %s, instruction set %d\n", report.Bytecode.SignedHeader, strings.Join(report.Bytecode.Sections, ", "), report.Bytecode.InstructionSet)
+	fmt.Printf("Signing algorithms: %s\n", strings.Join(report.Signing.Algorithms, ", "))
+	fmt.Printf("Tokens: %d\n", len(report.Tokens))
+	fmt.Println("Libraries:")
+	for _, library := range report.Libraries {
+		fmt.Printf("  %s\n", library.Name)
+		for _, function := range library.Functions {
+			line := fmt.Sprintf("    %s(%s) -> %s", function.Name, strings.Join(function.Args, ", "), function.Result)
+			if function.Capability != "" {
+				line += fmt.Sprintf(" [requires %s]", function.Capability)
+			}
+			fmt.Println(line)
+		}
+	}
+}
+
+func runFunctionsCmd() {
+	functionsCmd := flag.NewFlagSet("functions", flag.ExitOnError)
+	library := functionsCmd.String("library", "", "Only list the functions of this library")
+	complete := functionsCmd.String("complete", "", "Print the names of the functions starting with this prefix, one per line, for shell and editor completion")
+	output := functionsCmd.String("output", "text", "Output format: text or json")
+	if err := parseArgs(functionsCmd); err != nil {
+		fmt.Printf("Error reading command line args: %v\n", err)
+		os.Exit(1)
+	}
+
+	e := env.NewEnvironment()
+	if *complete != "" {
+		for _, name := range e.CompleteFunction(*complete) {
+			fmt.Println(name)
+		}
+		return
+	}
+	libraries := e.Describe()
+	if *library != "" {
+		described, ok := e.DescribeLibrary(*library)
+		if !ok {
+			names := make([]string, len(libraries))
+			for i, l := range libraries {
+				names[i] = l.Name
+			}
+			msg := fmt.Sprintf("Unknown library '%s'", *library)
+			if suggestion, ok := env.SuggestName(*library, names); ok {
+				msg += fmt.Sprintf("; did you mean '%s'?", suggestion)
+			}
+			fmt.Println(msg)
+			os.Exit(1)
+		}
+		libraries = []env.LibraryDescription{described}
+	}
+	if *output == "json" {
+		out, err := json.MarshalIndent(libraries, "", "  ")
+		if err != nil {
+			fmt.Printf("Error encoding functions: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(out))
+		return
+	}
+
+	for _, l := range libraries {
+		for _, function := range l.Functions {
+			line := fmt.Sprintf("%s -> %s", function.Usage(), function.Result)
+			if function.Capability != "" {
+				line += fmt.Sprintf(" [requires %s]", function.Capability)
+			}
+			fmt.Println(line)
+			fmt.Printf("    %s\n", function.Doc)
+		}
+	}
+}
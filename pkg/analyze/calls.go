@@ -0,0 +1,96 @@
+package analyze
+
+import (
+	"fmt"
+	"github.com/SpecDrivenDesign/lql/pkg/ast"
+	"github.com/SpecDrivenDesign/lql/pkg/ast/expressions"
+	"github.com/SpecDrivenDesign/lql/pkg/env"
+	"github.com/SpecDrivenDesign/lql/pkg/errors"
+)
+
+// CheckCalls compares the function calls in expr against the functions
+// the libraries of e declare (see env.Describe), without evaluating it. It
+// reports, in source order, calls to libraries that are not registered,
+// calls to functions a library does not declare, and calls passing too few
+// or too many arguments, suggesting the likely name for a misspelled
+// library or function. Calls to libraries that do not declare their
+// functions are not checked.
+//
+// The returned errors use the same error types as evaluation.
+func CheckCalls(expr ast.Expression, e *env.Environment) []error {
+	var errs []error
+	libraries := e.Describe()
+	ast.Inspect(expr, func(node ast.Expression) bool {
+		call, ok := node.(*expressions.FunctionCallExpr)
+		if !ok || len(call.Namespace) != 2 {
+			return true
+		}
+		if err := checkCall(call, libraries); err != nil {
+			errs = append(errs, err)
+		}
+		return true
+	})
+	return errs
+}
+
+// checkCall checks one call against the descriptions of the libraries.
+func checkCall(call *expressions.FunctionCallExpr, libraries []env.LibraryDescription) error {
+	libName, funcName := call.Namespace[0], call.Namespace[1]
+	var library *env.LibraryDescription
+	names := make([]string, len(libraries))
+	for i := range libraries {
+		names[i] = libraries[i].Name
+		if libraries[i].Name == libName {
+			library = &libraries[i]
+		}
+	}
+	if library == nil {
+		msg := fmt.Sprintf("library '%s' not found", libName)
+		if suggestion, ok := env.SuggestName(libName, names); ok {
+			msg += fmt.Sprintf("; did you mean '%s'?", suggestion)
+		}
+		return errors.NewReferenceError(msg, call.Line, call.Column)
+	}
+	if !library.Described {
+		return nil
+	}
+	functions := make([]string, len(library.Functions))
+	for i, fn := range library.Functions {
+		functions[i] = fn.Name
+		if fn.Name != funcName {
+			continue
+		}
+		least, most := fn.MinArgs(), fn.MaxArgs()
+		if n := len(call.Args); n >= least && (most < 0 || n <= most) {
+			return nil
+		}
+		msg := fmt.Sprintf("%s requires %s, got %d; usage: %s", fn.QualifiedName(), argumentCount(least, most), len(call.Args), fn.Usage())
+		return errors.NewParameterError(msg, call.ParenLine, call.ParenColumn)
+	}
+	msg := fmt.Sprintf("unknown %s function '%s'", libName, funcName)
+	if suggestion, ok := env.SuggestName(funcName, functions); ok {
+		msg += fmt.Sprintf("; did you mean '%s.%s'?", libName, suggestion)
+	}
+	return errors.NewFunctionCallError(msg, call.Line, call.Column)
+}
+
+// argumentCount describes how many arguments a function takes, as runtime
+// errors do.
+func argumentCount(least, most int) string {
+	switch {
+	case most < 0:
+		return fmt.Sprintf("at least %d %s", least, plural(least))
+	case least == most:
+		return fmt.Sprintf("%d %s", least, plural(least))
+	case most == least+1:
+		return fmt.Sprintf("%d or %d arguments", least, most)
+	}
+	return fmt.Sprintf("%d to %d arguments", least, most)
+}
+
+func plural(n int) string {
+	if n == 1 {
+		return "argument"
+	}
+	return "arguments"
+}
@@ -0,0 +1,42 @@
+package analyze
+
+import (
+	"github.com/SpecDrivenDesign/lql/pkg/env"
+	"github.com/SpecDrivenDesign/lql/pkg/errors"
+	"strings"
+	"testing"
+)
+
+func TestCheckCalls(t *testing.T) {
+	tests := []struct {
+		src          string
+		want         string
+		line, column int
+	}{
+		{`math.pow(2, 3) > 1 AND string.concat("a", "b", "c") == "abc"`, "", 0, 0},
+		{`math.sum([1]) + math.sum([1], "x") + math.sum([1], "x", 0) > 0`, "", 0, 0},
+		{`cache.memo("k", $a, 10)`, "", 0, 0},
+		{`mth.pow(2, 3)`, "ReferenceError: library 'mth' not found; did you mean 'math'?", 1, 1},
+		{`math.poww(2, 3)`, "FunctionCallError: unknown math function 'poww'; did you mean 'math.pow'?", 1, 1},
+		{`math.pow(2)`, "ParameterError: math.pow requires 2 arguments, got 1; usage: math.pow(x, y)", 1, 9},
+		{`$a AND math.sum([1], "x", 0, 1)`, "ParameterError: math.sum requires 1 to 3 arguments, got 4; usage: math.sum(arr[, subfield][, defaultVal])", 1, 16},
+		{`string.concat()`, "ParameterError: string.concat requires at least 1 argument, got 0; usage: string.concat(values, ...)", 1, 14},
+	}
+	for _, tt := range tests {
+		errs := CheckCalls(parse(t, tt.src), env.NewEnvironment())
+		if tt.want == "" {
+			if len(errs) != 0 {
+				t.Errorf("%s: got %v", tt.src, errs)
+			}
+			continue
+		}
+		if len(errs) != 1 {
+			t.Errorf("%s: got %v, want one error", tt.src, errs)
+			continue
+		}
+		posErr := errs[0].(errors.PositionalError)
+		if !strings.HasPrefix(errs[0].Error(), tt.want) || posErr.GetLine() != tt.line || posErr.GetColumn() != tt.column {
+			t.Errorf("%s: got %v, want %q at %d:%d", tt.src, errs[0], tt.want, tt.line, tt.column)
+		}
+	}
+}
@@ -0,0 +1,626 @@
+package analyze
+
+import (
+	"fmt"
+	"github.com/SpecDrivenDesign/lql/pkg/ast"
+	"github.com/SpecDrivenDesign/lql/pkg/ast/expressions"
+	"github.com/SpecDrivenDesign/lql/pkg/env"
+	"github.com/SpecDrivenDesign/lql/pkg/errors"
+	"github.com/SpecDrivenDesign/lql/pkg/tokens"
+	"sort"
+	"strings"
+)
+
+// Schema describes the context an expression is evaluated against, using
+// the same lightweight language as type.matchesSchema: each field maps to a
+// type name ("string", "int", "float", "number", "bool", "null", "array",
+// "object" or "any", optionally suffixed with "?" to allow null or absence),
+// a nested object schema, or a one-element array giving the schema of every
+// element.
+type Schema map[string]interface{}
+
+// Type kinds tracked by Check. kindTime is produced only by time library
+// functions.
+const (
+	kindAny    = "any"
+	kindString = "string"
+	kindInt    = "int"
+	kindFloat  = "float"
+	kindNumber = "number"
+	kindBool   = "bool"
+	kindNull   = "null"
+	kindArray  = "array"
+	kindObject = "object"
+	kindTime   = "Time"
+)
+
+// valueType is the static type of a subexpression.
+type valueType struct {
+	kind string
+	// optional is set when the value may also be null or absent.
+	optional bool
+	// fields holds the schemas of a known object's fields; nil when the
+	// object's shape is unknown.
+	fields map[string]interface{}
+	// elem is the schema of an array's elements; nil when unknown.
+	elem interface{}
+}
+
+var anyType = valueType{kind: kindAny}
+
+func (t valueType) numeric() bool {
+	return t.kind == kindInt || t.kind == kindFloat || t.kind == kindNumber
+}
+
+// known reports whether t is a definite non-null type.
+func (t valueType) known() bool {
+	return t.kind != kindAny && t.kind != kindNull
+}
+
+// typeFromSchema converts a schema node to a valueType. Unknown type names
+// are treated as "any".
+func typeFromSchema(schema interface{}) valueType {
+	switch s := schema.(type) {
+	case string:
+		t := valueType{kind: strings.TrimSuffix(s, "?"), optional: strings.HasSuffix(s, "?")}
+		switch t.kind {
+		case "boolean":
+			t.kind = kindBool
+		case kindString, kindInt, kindFloat, kindNumber, kindBool, kindArray, kindObject:
+		case kindNull:
+			t.optional = true
+		default:
+			t.kind = kindAny
+		}
+		return t
+	case Schema:
+		return valueType{kind: kindObject, fields: s}
+	case map[string]interface{}:
+		return valueType{kind: kindObject, fields: s}
+	case []interface{}:
+		t := valueType{kind: kindArray}
+		if len(s) == 1 {
+			t.elem = s[0]
+		}
+		return t
+	}
+	return anyType
+}
+
+// functionResults lists the result types of library functions that always
+// return the same kind of value.
+var functionResults = map[string]string{
+	"string.concat":         kindString,
+	"string.toLower":        kindString,
+	"string.toUpper":        kindString,
+	"string.trim":           kindString,
+	"string.substring":      kindString,
+	"string.replace":        kindString,
+	"string.join":           kindString,
+	"string.mask":           kindString,
+	"string.redactEmail":    kindString,
+	"string.last4":          kindString,
+	"string.escapeHtml":     kindString,
+	"string.unescapeHtml":   kindString,
+	"string.stripTags":      kindString,
+	"string.parseCsvLine":   kindArray,
+	"string.graphemeLength": kindNumber,
+	"string.containsEmoji":  kindBool,
+	"string.stripEmoji":     kindString,
+	"string.startsWith":     kindBool,
+	"string.endsWith":       kindBool,
+	"string.contains":       kindBool,
+	"string.secureEquals":   kindBool,
+	"string.indexOf":        kindNumber,
+	"string.split":          kindArray,
+	"regex.match":           kindBool,
+	"regex.replace":         kindString,
+	"math.abs":              kindNumber,
+	"math.sqrt":             kindNumber,
+	"math.floor":            kindNumber,
+	"math.round":            kindNumber,
+	"math.ceil":             kindNumber,
+	"math.pow":              kindNumber,
+	"math.sum":              kindNumber,
+	"math.avg":              kindNumber,
+	"math.formatNumber":     kindString,
+	"math.toPercent":        kindString,
+	"time.format":           kindString,
+	"time.diff":             kindNumber,
+	"time.toEpochMillis":    kindNumber,
+	"time.getYear":          kindNumber,
+	"time.getMonth":         kindNumber,
+	"time.getDay":           kindNumber,
+	"time.isBefore":         kindBool,
+	"time.isAfter":          kindBool,
+	"time.isEqual":          kindBool,
+	"time.bucket":           kindArray,
+	"array.contains":        kindBool,
+	"array.sort":            kindArray,
+	"array.flatten":         kindArray,
+	"array.filter":          kindArray,
+	"array.filterExpr":      kindArray,
+	"array.mapExpr":         kindArray,
+	"array.anyExpr":         kindBool,
+	"array.allExpr":         kindBool,
+	"array.extract":         kindArray,
+	"array.frequencies":     kindObject,
+	"array.mostCommon":      kindArray,
+	"array.windows":         kindArray,
+	"array.pairwise":        kindArray,
+	"cond.isFieldPresent":   kindBool,
+	"type.string":           kindString,
+	"type.int":              kindInt,
+	"type.float":            kindFloat,
+	"type.decimal":          kindNumber,
+	"type.intArray":         kindArray,
+	"type.floatArray":       kindArray,
+	"type.stringArray":      kindArray,
+	"type.isNumber":         kindBool,
+	"type.isString":         kindBool,
+	"type.isBoolean":        kindBool,
+	"type.isArray":          kindBool,
+	"type.isObject":         kindBool,
+	"type.isNull":           kindBool,
+	"stat.zscore":           kindNumber,
+	"stat.isOutlier":        kindBool,
+	"stat.movingAvg":        kindArray,
+	"object.flatten":        kindObject,
+	"object.unflatten":      kindObject,
+	"object.changedFields":  kindArray,
+	"object.diff":           kindObject,
+	"valid.isEmail":         kindBool,
+	"valid.isURL":           kindBool,
+	"valid.isUUID":          kindBool,
+	"valid.isPhone":         kindBool,
+	"valid.isCreditCard":    kindBool,
+	"valid.isLuhn":          kindBool,
+	"valid.isIBAN":          kindBool,
+	"valid.isEAN":           kindBool,
+	"phone.parse":           kindObject,
+	"ua.parse":              kindObject,
+	"iso.isEU":              kindBool,
+	"iso.isCountry":         kindBool,
+	"convert.units":         kindNumber,
+	"convert.temperature":   kindNumber,
+	"convert.bytesHuman":    kindString,
+	"convert.hexToRgb":      kindObject,
+	"convert.rgbToHex":      kindString,
+	"jwt.decode":            kindObject,
+	"jwt.verifyHmac":        kindBool,
+	"url.parseQuery":        kindObject,
+	"range.overlaps":        kindBool,
+	"range.contains":        kindBool,
+	"range.merge":           kindArray,
+	"tree.isDescendant":     kindBool,
+	"random.token":          kindString,
+	"hash.jump":             kindInt,
+	"hash.consistentBucket": kindInt,
+}
+
+// Check compares expr against the context described by schema without
+// evaluating it. It reports, in source order, every use that is certain to
+// fail or to be meaningless for any context matching the schema: references
+// to fields the schema does not declare, member access on scalars, operators
+// applied to operands of the wrong type, comparisons between unrelated
+// types, and library arguments of the wrong type. Values whose type is not
+// known statically are never reported, and a nullable field is checked as
+// if present.
+//
+// The returned errors carry the position of the offending node and use the
+// same error types as evaluation.
+func Check(expr ast.Expression, schema Schema) []error {
+	c := &typeChecker{root: schema}
+	c.typeOf(expr, false)
+	// Operators are reported after their operands; restore source order.
+	sort.SliceStable(c.errs, func(i, j int) bool {
+		a := c.errs[i].(errors.PositionalError)
+		b := c.errs[j].(errors.PositionalError)
+		if a.GetLine() != b.GetLine() {
+			return a.GetLine() < b.GetLine()
+		}
+		return a.GetColumn() < b.GetColumn()
+	})
+	return c.errs
+}
+
+type typeChecker struct {
+	root Schema
+	errs []error
+	// variables holds the LET variables in scope, innermost last.
+	variables []variableType
+}
+
+// variableType is the static type of a LET variable.
+type variableType struct {
+	name string
+	t    valueType
+}
+
+func (c *typeChecker) report(err error) {
+	c.errs = append(c.errs, err)
+}
+
+// typeOf infers the type of expr, reporting problems along the way. Under
+// lenient, missing fields are not reported because the expression is the
+// left operand of "?:".
+func (c *typeChecker) typeOf(expr ast.Expression, lenient bool) valueType {
+	switch e := expr.(type) {
+	case *expressions.LiteralExpr:
+		switch e.Value.(type) {
+		case string:
+			return valueType{kind: kindString}
+		case bool:
+			return valueType{kind: kindBool}
+		case int64:
+			return valueType{kind: kindInt}
+		case float64:
+			return valueType{kind: kindFloat}
+		case nil:
+			return valueType{kind: kindNull, optional: true}
+		}
+		return anyType
+
+	case *expressions.ContextExpr:
+		if e.Ident == nil {
+			if e.Subscript != nil {
+				c.typeOf(e.Subscript, false)
+				return anyType
+			}
+			return valueType{kind: kindObject, fields: c.root}
+		}
+		if c.root == nil {
+			return anyType
+		}
+		fieldSchema, ok := c.root[e.Ident.Name]
+		if !ok {
+			if !lenient {
+				c.report(errors.NewReferenceError(fmt.Sprintf("field '%s' not found", e.Ident.Name), e.Ident.Line, e.Ident.Column))
+			}
+			return anyType
+		}
+		return typeFromSchema(fieldSchema)
+
+	case *expressions.MemberAccessExpr:
+		return c.memberAccessType(e, lenient)
+
+	case *expressions.BinaryExpr:
+		return c.binaryType(e)
+
+	case *expressions.BetweenExpr:
+		subject := c.typeOf(e.Subject, false)
+		low := c.typeOf(e.Low, false)
+		high := c.typeOf(e.High, false)
+		for _, bound := range []valueType{low, high} {
+			if !orderable(subject) || !orderable(bound) || (subject.known() && bound.known() && !comparable(subject, bound)) {
+				c.report(errors.NewSemanticError("BETWEEN operator not allowed on given types", e.Line, e.Column))
+				break
+			}
+		}
+		return valueType{kind: kindBool}
+
+	case *expressions.LikeExpr:
+		subject := c.typeOf(e.Subject, false)
+		pattern := c.typeOf(e.Pattern, false)
+		if isNot(subject, kindString) || isNot(pattern, kindString) {
+			c.report(errors.NewSemanticError("LIKE operator requires string operands", e.Line, e.Column))
+		}
+		return valueType{kind: kindBool}
+
+	case *expressions.UnaryExpr:
+		operand := c.typeOf(e.Expr, false)
+		if e.Operator == tokens.TokenNot {
+			if isNot(operand, kindBool) {
+				c.report(errors.NewSemanticError("NOT operator requires a boolean operand", e.Line, e.Column))
+			}
+			return valueType{kind: kindBool}
+		}
+		if operand.known() && !operand.numeric() {
+			c.report(errors.NewSemanticError("unary '-' operator requires a numeric operand", e.Line, e.Column))
+			return valueType{kind: kindNumber}
+		}
+		if operand.numeric() {
+			return valueType{kind: operand.kind}
+		}
+		return valueType{kind: kindNumber}
+
+	case *expressions.DefaultExpr:
+		value := c.typeOf(e.Expr, true)
+		fallback := c.typeOf(e.Fallback, false)
+		if value.kind == kindAny || value.kind == kindNull {
+			return fallback
+		}
+		value.optional = fallback.optional
+		return value
+
+	case *expressions.LetExpr:
+		value := c.typeOf(e.Value, false)
+		c.variables = append(c.variables, variableType{name: e.Name, t: value})
+		body := c.typeOf(e.Body, lenient)
+		c.variables = c.variables[:len(c.variables)-1]
+		return body
+
+	case *expressions.IdentifierExpr:
+		for i := len(c.variables) - 1; i >= 0; i-- {
+			if c.variables[i].name == e.Name {
+				return c.variables[i].t
+			}
+		}
+		return anyType
+
+	case *expressions.FunctionCallExpr:
+		return c.functionType(e)
+
+	case *expressions.ArrayLiteralExpr:
+		elem := ""
+		for _, element := range e.Elements {
+			t := c.typeOf(element, false)
+			switch {
+			case elem == "":
+				elem = t.kind
+			case elem != t.kind:
+				elem = kindAny
+			}
+		}
+		t := valueType{kind: kindArray}
+		if elem != "" && elem != kindAny && elem != kindObject && elem != kindArray && elem != kindTime {
+			t.elem = elem
+		}
+		return t
+
+	case *expressions.ObjectLiteralExpr:
+		fields := make(map[string]interface{}, len(e.Fields))
+		for _, field := range e.Fields {
+			if field.KeyExpr != nil {
+				c.typeOf(field.KeyExpr, false)
+				fields = nil
+			}
+			t := c.typeOf(field.Value, false)
+			if fields != nil && t.known() && t.fields == nil && t.elem == nil && t.kind != kindTime {
+				fields[field.Key] = t.kind
+			} else if fields != nil {
+				fields[field.Key] = kindAny
+			}
+		}
+		return valueType{kind: kindObject, fields: fields}
+	}
+
+	for _, child := range ast.Children(expr) {
+		c.typeOf(child, false)
+	}
+	return anyType
+}
+
+// isNot reports whether t is known to be a type other than kind.
+func isNot(t valueType, kind string) bool {
+	return t.known() && t.kind != kind
+}
+
+func (c *typeChecker) memberAccessType(e *expressions.MemberAccessExpr, lenient bool) valueType {
+	t := c.typeOf(e.Target, lenient)
+	projections := 0
+	for _, part := range e.AccessParts {
+		optional := part.Optional || lenient
+		switch {
+		case part.Wildcard:
+			if t.known() && t.kind != kindArray {
+				c.report(errors.NewTypeError("wildcard projection on non‑array", part.Line, part.Column))
+				return anyType
+			}
+			projections++
+			if t.kind == kindArray {
+				t = typeFromSchema(t.elem)
+			}
+			lenient = lenient || part.Optional
+
+		case part.Recursive:
+			t = valueType{kind: kindArray}
+
+		case part.IsIndex:
+			index := c.typeOf(part.Expr, false)
+			switch {
+			case t.kind == kindObject:
+				lit, ok := part.Expr.(*expressions.LiteralExpr)
+				key, isKey := "", false
+				if ok {
+					key, isKey = lit.Value.(string)
+				}
+				if !isKey || t.fields == nil {
+					t = anyType
+					continue
+				}
+				t = c.fieldType(t, key, optional, part.Line, part.Column)
+			case t.kind == kindArray:
+				if index.known() && !index.numeric() {
+					c.report(errors.NewTypeError("array index must be numeric", part.Line, part.Column))
+				}
+				t = typeFromSchema(t.elem)
+			case t.known():
+				c.report(errors.NewTypeError("target is not an object or array", part.Line, part.Column))
+				return anyType
+			default:
+				t = anyType
+			}
+
+		default:
+			switch {
+			case t.kind == kindObject:
+				if t.fields == nil {
+					t = anyType
+					continue
+				}
+				t = c.fieldType(t, part.Key, optional, part.Line, part.Column)
+			case t.known():
+				c.report(errors.NewTypeError("dot access on non‑object", part.Line, part.Column))
+				return anyType
+			default:
+				t = anyType
+			}
+		}
+	}
+	for ; projections > 0; projections-- {
+		t = valueType{kind: kindArray}
+	}
+	return t
+}
+
+// fieldType looks up key in the known object type t, reporting it when the
+// schema does not declare it and the access is not optional.
+func (c *typeChecker) fieldType(t valueType, key string, optional bool, line, column int) valueType {
+	fieldSchema, ok := t.fields[key]
+	if !ok {
+		if !optional {
+			c.report(errors.NewReferenceError(fmt.Sprintf("field '%s' not found", key), line, column))
+		}
+		return anyType
+	}
+	return typeFromSchema(fieldSchema)
+}
+
+func (c *typeChecker) binaryType(e *expressions.BinaryExpr) valueType {
+	switch e.Operator {
+	case tokens.TokenAnd, tokens.TokenOr:
+		left := c.typeOf(e.Left, false)
+		right := c.typeOf(e.Right, false)
+		name := "AND"
+		if e.Operator == tokens.TokenOr {
+			name = "OR"
+		}
+		if isNot(left, kindBool) || isNot(right, kindBool) {
+			c.report(errors.NewSemanticError(fmt.Sprintf("%s operator requires boolean operand", name), e.Line, e.Column))
+		}
+		return valueType{kind: kindBool}
+
+	case tokens.TokenPlus, tokens.TokenMinus, tokens.TokenMultiply, tokens.TokenDivide:
+		left := c.typeOf(e.Left, false)
+		right := c.typeOf(e.Right, false)
+		op := tokens.FixedTokenLiterals[e.Operator]
+		if (left.known() && !left.numeric()) || (right.known() && !right.numeric()) {
+			c.report(errors.NewSemanticError(fmt.Sprintf("'%s' operator used on non‑numeric type", op), e.Line, e.Column))
+			return valueType{kind: kindNumber}
+		}
+		if (left.kind == kindInt && right.kind == kindFloat) || (left.kind == kindFloat && right.kind == kindInt) {
+			c.report(errors.NewSemanticError("Mixed numeric types require explicit conversion", e.Line, e.Column))
+			return valueType{kind: kindNumber}
+		}
+		if left.kind == right.kind && left.numeric() {
+			return valueType{kind: left.kind}
+		}
+		return valueType{kind: kindNumber}
+
+	case tokens.TokenLt, tokens.TokenGt, tokens.TokenLte, tokens.TokenGte:
+		left := c.typeOf(e.Left, false)
+		right := c.typeOf(e.Right, false)
+		op := tokens.FixedTokenLiterals[e.Operator]
+		if !orderable(left) || !orderable(right) || (left.known() && right.known() && !comparable(left, right)) {
+			c.report(errors.NewSemanticError(fmt.Sprintf("'%s' operator not allowed on given types", op), e.Line, e.Column))
+		}
+		return valueType{kind: kindBool}
+
+	case tokens.TokenEq, tokens.TokenNeq:
+		left := c.typeOf(e.Left, false)
+		right := c.typeOf(e.Right, false)
+		if left.known() && right.known() && !comparable(left, right) {
+			op := tokens.FixedTokenLiterals[e.Operator]
+			c.report(errors.NewTypeError(fmt.Sprintf("'%s' compares %s with %s", op, left.kind, right.kind), e.Line, e.Column))
+		}
+		return valueType{kind: kindBool}
+
+	case tokens.TokenMatch, tokens.TokenNotMatch:
+		left := c.typeOf(e.Left, false)
+		right := c.typeOf(e.Right, false)
+		if isNot(left, kindString) || isNot(right, kindString) {
+			op := tokens.FixedTokenLiterals[e.Operator]
+			c.report(errors.NewSemanticError(fmt.Sprintf("'%s' operator requires string operands", op), e.Line, e.Column))
+		}
+		return valueType{kind: kindBool}
+	}
+	c.typeOf(e.Left, false)
+	c.typeOf(e.Right, false)
+	return anyType
+}
+
+// orderable reports whether t may be an operand of <, >, <= or >=.
+func orderable(t valueType) bool {
+	return !t.known() || t.numeric() || t.kind == kindString || t.kind == kindTime
+}
+
+// comparable reports whether two known types can ever be equal. A time
+// compares with an int of epoch milliseconds.
+func comparable(left, right valueType) bool {
+	if left.numeric() && right.numeric() {
+		return true
+	}
+	if left.kind == kindTime && right.numeric() {
+		return right.kind != kindFloat
+	}
+	if right.kind == kindTime && left.numeric() {
+		return left.kind != kindFloat
+	}
+	return left.kind == right.kind
+}
+
+// elementExpressions lists the functions whose second argument is an
+// expression applied to each element of their first.
+var elementExpressions = map[string]bool{
+	"array.filterExpr": true,
+	"array.mapExpr":    true,
+	"array.anyExpr":    true,
+	"array.allExpr":    true,
+}
+
+func (c *typeChecker) functionType(e *expressions.FunctionCallExpr) valueType {
+	name := strings.Join(e.Namespace, ".")
+	sig := functionSignatures[name]
+	switch name {
+	case "math.sum", "math.min", "math.max", "math.avg":
+		if len(e.Args) > 1 {
+			sig = []string{ArrayOf(TypeObject), TypeString, TypeNumeric}
+		}
+	}
+	var elem valueType
+	for i, arg := range e.Args {
+		if i == 1 && elementExpressions[name] {
+			// The expression reads each element as item.
+			c.variables = append(c.variables, variableType{name: env.ItemVariable, t: elem})
+		}
+		t := c.typeOf(arg, false)
+		if i == 1 && elementExpressions[name] {
+			c.variables = c.variables[:len(c.variables)-1]
+		}
+		if i == 0 {
+			elem = typeFromSchema(t.elem)
+		}
+		want := argumentType(sig, i)
+		if !t.known() || accepts(want, t) {
+			continue
+		}
+		line, column := arg.Pos()
+		c.report(errors.NewTypeError(fmt.Sprintf("%s: argument %d must be %s, got %s", name, i+1, want, t.kind), line, column))
+	}
+	if timeResults[name] {
+		return valueType{kind: kindTime}
+	}
+	if kind, ok := functionResults[name]; ok {
+		return valueType{kind: kind}
+	}
+	return anyType
+}
+
+// accepts reports whether a value of type t satisfies the signature type
+// want. Array element types are not compared.
+func accepts(want string, t valueType) bool {
+	switch {
+	case want == TypeAny:
+		return true
+	case want == TypeNumeric:
+		return t.numeric()
+	case want == TypeBoolean:
+		return t.kind == kindBool
+	case want == TypeTime:
+		return t.kind == kindTime
+	case strings.HasPrefix(want, TypeArray):
+		return t.kind == kindArray
+	}
+	return t.kind == want
+}
@@ -0,0 +1,85 @@
+package analyze
+
+import (
+	"github.com/SpecDrivenDesign/lql/pkg/errors"
+	"strings"
+	"testing"
+)
+
+var checkSchema = Schema{
+	"user": map[string]interface{}{
+		"name":  "string",
+		"age":   "int",
+		"email": "string?",
+		"tags":  []interface{}{"string"},
+		"address": map[string]interface{}{
+			"city": "string",
+		},
+	},
+	"score": "float",
+	"extra": "any",
+}
+
+func TestCheckAccepts(t *testing.T) {
+	for _, src := range []string{
+		`$user.age >= 18 AND $user.address.city == "Oslo"`,
+		`string.toUpper($user.name) LIKE "A%"`,
+		`$user.email ?: "none"`,
+		`$user.missing ?: "none"`,
+		`array.contains($user.tags, "vip")`,
+		`$user.tags[0] == "x"`,
+		`$score * 2.0 > 1.5`,
+		// Values of unknown type are not checked.
+		`$extra.anything + 1 > $extra.other`,
+		`LET n = $user.age IN n > 1`,
+	} {
+		if errs := Check(parse(t, src), checkSchema); len(errs) != 0 {
+			t.Errorf("%s: got %v", src, errs)
+		}
+	}
+}
+
+func TestCheckRejects(t *testing.T) {
+	tests := []struct {
+		src          string
+		line, column int
+		message      string
+	}{
+		{`$user.nmae == "a"`, 1, 7, "field 'nmae' not found"},
+		{`$usr.age > 1`, 1, 2, "field 'usr' not found"},
+		{`$user.age.years > 1`, 1, 11, "dot access on non"},
+		{`$user.name == 5`, 1, 12, "'==' compares string with int"},
+		{`$user.name > 5`, 1, 12, "'>' operator not allowed on given types"},
+		{`$user.age + $score > 1`, 1, 11, "Mixed numeric types"},
+		{`$user.name AND true`, 1, 12, "AND operator requires boolean operand"},
+		{`NOT $user.age`, 1, 1, "NOT operator requires a boolean operand"},
+		{`string.toUpper($user.age) == "A"`, 1, 16, "string.toUpper: argument 1 must be string, got int"},
+		{`$user.name[*] == []`, 1, 12, "wildcard projection on non"},
+	}
+	for _, tt := range tests {
+		errs := Check(parse(t, tt.src), checkSchema)
+		if len(errs) != 1 {
+			t.Errorf("%s: got %v, want one error", tt.src, errs)
+			continue
+		}
+		posErr, ok := errs[0].(errors.PositionalError)
+		if !ok {
+			t.Errorf("%s: %T carries no position", tt.src, errs[0])
+			continue
+		}
+		if posErr.GetLine() != tt.line || posErr.GetColumn() != tt.column || !strings.Contains(errs[0].Error(), tt.message) {
+			t.Errorf("%s: got %v at %d:%d, want %q at %d:%d", tt.src, errs[0], posErr.GetLine(), posErr.GetColumn(), tt.message, tt.line, tt.column)
+		}
+	}
+}
+
+func TestCheckReportsInSourceOrder(t *testing.T) {
+	errs := Check(parse(t, `$user.name > 1 OR $user.nope == 1`), checkSchema)
+	if len(errs) != 2 {
+		t.Fatalf("got %v", errs)
+	}
+	first, second := errs[0].(errors.PositionalError), errs[1].(errors.PositionalError)
+	if first.GetColumn() >= second.GetColumn() {
+		t.Errorf("errors out of order: %v", errs)
+	}
+}
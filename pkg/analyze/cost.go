@@ -0,0 +1,181 @@
+// Package analyze inspects parsed expressions without evaluating them.
+package analyze
+
+import (
+	"fmt"
+	"github.com/SpecDrivenDesign/lql/pkg/ast"
+	"github.com/SpecDrivenDesign/lql/pkg/ast/expressions"
+	"github.com/SpecDrivenDesign/lql/pkg/errors"
+	"github.com/SpecDrivenDesign/lql/pkg/tokens"
+	"strings"
+)
+
+// Default cost model parameters.
+const (
+	DefaultArraySize = 100
+	DefaultRegexCost = 50
+)
+
+// costClass describes how a library function's cost grows with its input.
+type costClass int
+
+const (
+	costConstant   costClass = iota
+	costLinear               // one pass over an array argument
+	costSort                 // n log n over an array argument
+	costRegex                // compiles and runs a regular expression
+	costPerElement           // one pass evaluating its last argument on each element
+)
+
+var functionCostClasses = map[string]costClass{
+	"array.contains":   costLinear,
+	"array.find":       costLinear,
+	"array.extract":    costLinear,
+	"array.filter":     costLinear,
+	"array.filterExpr": costPerElement,
+	"array.mapExpr":    costPerElement,
+	"array.anyExpr":    costPerElement,
+	"array.allExpr":    costPerElement,
+	"array.flatten":    costLinear,
+	"array.sort":       costSort,
+	"time.bucket":      costSort,
+	"range.merge":      costSort,
+	"math.sum":         costLinear,
+	"math.min":         costLinear,
+	"math.max":         costLinear,
+	"math.avg":         costLinear,
+	"math.weightedSum": costLinear,
+	"math.weightedAvg": costLinear,
+	"stat.zscore":      costLinear,
+	"stat.isOutlier":   costLinear,
+	"stat.movingAvg":   costLinear,
+	"string.join":      costLinear,
+	"object.flatten":   costLinear,
+	"object.unflatten": costLinear,
+	"regex.match":      costRegex,
+	"regex.replace":    costRegex,
+	"regex.find":       costRegex,
+}
+
+// CostOptions tunes the cost model. Zero values select the defaults.
+type CostOptions struct {
+	// ArraySize is the element count assumed for arrays whose size is not
+	// known statically.
+	ArraySize int
+	// RegexCost is the cost charged for each regular expression match,
+	// including =~, !~ and LIKE.
+	RegexCost int
+	// FunctionCosts overrides the cost of individual calls, keyed by
+	// "library.function". Use it to price host-provided libraries.
+	FunctionCosts map[string]int
+}
+
+// Cost is the static estimate for an expression.
+type Cost struct {
+	// Nodes is the number of AST nodes.
+	Nodes int
+	// Depth is the height of the tree; a single literal has depth 1.
+	Depth int
+	// Score estimates evaluation work in abstract units: one per node plus
+	// the per-element cost of array functions and projections and the cost
+	// of regular expressions.
+	Score int
+}
+
+// Limits bounds the cost of an expression. Zero fields are not checked.
+type Limits struct {
+	MaxNodes int
+	MaxDepth int
+	MaxScore int
+}
+
+// EstimateCost computes the static cost of expr.
+func EstimateCost(expr ast.Expression, opts CostOptions) Cost {
+	if opts.ArraySize <= 0 {
+		opts.ArraySize = DefaultArraySize
+	}
+	if opts.RegexCost <= 0 {
+		opts.RegexCost = DefaultRegexCost
+	}
+	return estimate(expr, opts)
+}
+
+// CheckLimits estimates the cost of expr and returns a ComplexityError if it
+// exceeds any of the limits.
+func CheckLimits(expr ast.Expression, limits Limits, opts CostOptions) (Cost, error) {
+	cost := EstimateCost(expr, opts)
+	line, column := expr.Pos()
+	switch {
+	case limits.MaxNodes > 0 && cost.Nodes > limits.MaxNodes:
+		return cost, errors.NewComplexityError(fmt.Sprintf("expression has %d nodes, limit is %d", cost.Nodes, limits.MaxNodes), line, column)
+	case limits.MaxDepth > 0 && cost.Depth > limits.MaxDepth:
+		return cost, errors.NewComplexityError(fmt.Sprintf("expression depth %d exceeds limit of %d", cost.Depth, limits.MaxDepth), line, column)
+	case limits.MaxScore > 0 && cost.Score > limits.MaxScore:
+		return cost, errors.NewComplexityError(fmt.Sprintf("expression cost %d exceeds limit of %d", cost.Score, limits.MaxScore), line, column)
+	}
+	return cost, nil
+}
+
+func estimate(expr ast.Expression, opts CostOptions) Cost {
+	cost := Cost{Nodes: 1, Score: 1 + nodeCost(expr, opts)}
+	for _, child := range ast.Children(expr) {
+		c := estimate(child, opts)
+		cost.Nodes += c.Nodes
+		cost.Score += c.Score
+		if c.Depth > cost.Depth {
+			cost.Depth = c.Depth
+		}
+	}
+	cost.Depth++
+	return cost
+}
+
+// nodeCost is the cost of a node beyond its unit cost and its children.
+func nodeCost(expr ast.Expression, opts CostOptions) int {
+	switch e := expr.(type) {
+	case *expressions.FunctionCallExpr:
+		name := strings.Join(e.Namespace, ".")
+		if c, ok := opts.FunctionCosts[name]; ok {
+			return c
+		}
+		switch functionCostClasses[name] {
+		case costLinear:
+			return opts.ArraySize
+		case costSort:
+			return opts.ArraySize * log2(opts.ArraySize)
+		case costRegex:
+			return opts.RegexCost
+		case costPerElement:
+			// The expression is counted once as a child.
+			extra := opts.ArraySize
+			if len(e.Args) > 0 {
+				extra += (opts.ArraySize - 1) * estimate(e.Args[len(e.Args)-1], opts).Score
+			}
+			return extra
+		}
+	case *expressions.BinaryExpr:
+		if e.Operator == tokens.TokenMatch || e.Operator == tokens.TokenNotMatch {
+			return opts.RegexCost
+		}
+	case *expressions.LikeExpr:
+		return opts.RegexCost
+	case *expressions.MemberAccessExpr:
+		extra := 0
+		for _, part := range e.AccessParts {
+			if part.Wildcard || part.Recursive {
+				extra += opts.ArraySize
+			}
+		}
+		return extra
+	}
+	return 0
+}
+
+func log2(n int) int {
+	l := 1
+	for n > 2 {
+		n /= 2
+		l++
+	}
+	return l
+}
@@ -0,0 +1,78 @@
+package analyze
+
+import (
+	"github.com/SpecDrivenDesign/lql/pkg/errors"
+	"strings"
+	"testing"
+)
+
+func TestEstimateCost(t *testing.T) {
+	small := CostOptions{ArraySize: 10, RegexCost: 5}
+	tests := []struct {
+		src  string
+		opts CostOptions
+		want Cost
+	}{
+		{`1`, CostOptions{}, Cost{Nodes: 1, Depth: 1, Score: 1}},
+		{`$a > 1`, CostOptions{}, Cost{Nodes: 3, Depth: 2, Score: 3}},
+		{`$a > 1 AND ($b < 2 OR $c)`, CostOptions{}, Cost{Nodes: 9, Depth: 4, Score: 9}},
+		{`foo.bar(1)`, CostOptions{}, Cost{Nodes: 2, Depth: 2, Score: 2}},
+		// Array functions and projections cost one unit per element.
+		{`array.contains($x, 1)`, CostOptions{}, Cost{Nodes: 3, Depth: 2, Score: 103}},
+		{`array.contains($x, 1)`, small, Cost{Nodes: 3, Depth: 2, Score: 13}},
+		{`$x[*].p`, CostOptions{}, Cost{Nodes: 2, Depth: 2, Score: 102}},
+		// Sorting costs n log n.
+		{`array.sort($x)`, CostOptions{}, Cost{Nodes: 2, Depth: 2, Score: 702}},
+		{`array.sort($x)`, small, Cost{Nodes: 2, Depth: 2, Score: 32}},
+		// Per-element expressions are charged for every element.
+		{`array.filterExpr($x, item > 1)`, CostOptions{}, Cost{Nodes: 5, Depth: 3, Score: 402}},
+		{`array.filterExpr($x, item > 1)`, small, Cost{Nodes: 5, Depth: 3, Score: 42}},
+		// Regular expressions, in operators and functions.
+		{`$s =~ "a"`, CostOptions{}, Cost{Nodes: 3, Depth: 2, Score: 53}},
+		{`$s LIKE "a%"`, small, Cost{Nodes: 3, Depth: 2, Score: 8}},
+		{`regex.match("a", $s)`, CostOptions{}, Cost{Nodes: 3, Depth: 2, Score: 53}},
+		// Host functions are priced explicitly, and built-ins can be repriced.
+		{`geo.lookup($ip)`, CostOptions{FunctionCosts: map[string]int{"geo.lookup": 500}}, Cost{Nodes: 2, Depth: 2, Score: 502}},
+		{`array.sort($x)`, CostOptions{FunctionCosts: map[string]int{"array.sort": 0}}, Cost{Nodes: 2, Depth: 2, Score: 2}},
+	}
+	for _, tt := range tests {
+		if got := EstimateCost(parse(t, tt.src), tt.opts); got != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestCheckLimits(t *testing.T) {
+	expr := parse(t, `$a > 1 AND array.sort($x) != []`)
+	cost := EstimateCost(expr, CostOptions{})
+	tests := []struct {
+		limits Limits
+		want   string
+	}{
+		{Limits{}, ""},
+		{Limits{MaxNodes: cost.Nodes, MaxDepth: cost.Depth, MaxScore: cost.Score}, ""},
+		{Limits{MaxNodes: cost.Nodes - 1}, "nodes, limit is"},
+		{Limits{MaxDepth: cost.Depth - 1}, "exceeds limit of"},
+		{Limits{MaxScore: 100}, "expression cost 708 exceeds limit of 100"},
+	}
+	for _, tt := range tests {
+		got, err := CheckLimits(expr, tt.limits, CostOptions{})
+		if got != cost {
+			t.Errorf("%+v: cost %+v, want %+v", tt.limits, got, cost)
+		}
+		if tt.want == "" {
+			if err != nil {
+				t.Errorf("%+v: %v", tt.limits, err)
+			}
+			continue
+		}
+		posErr, ok := err.(errors.PositionalError)
+		if !ok || posErr.Kind() != "ComplexityError" || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%+v: got %v, want a ComplexityError containing %q", tt.limits, err, tt.want)
+			continue
+		}
+		if posErr.GetLine() != 1 || posErr.GetColumn() != 8 {
+			t.Errorf("%+v: error at %d:%d, want the root at 1:8", tt.limits, posErr.GetLine(), posErr.GetColumn())
+		}
+	}
+}
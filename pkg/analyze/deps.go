@@ -0,0 +1,514 @@
+package analyze
+
+import (
+	"github.com/SpecDrivenDesign/lql/pkg/ast"
+	"github.com/SpecDrivenDesign/lql/pkg/ast/expressions"
+	"github.com/SpecDrivenDesign/lql/pkg/tokens"
+	"sort"
+	"strings"
+)
+
+// Inferred types reported by Dependencies. Arrays with a known element type
+// are reported as "array<elem>", e.g. "array<numeric>".
+const (
+	TypeAny     = "any"
+	TypeNumeric = "numeric"
+	TypeString  = "string"
+	TypeBoolean = "boolean"
+	TypeArray   = "array"
+	TypeObject  = "object"
+	TypeTime    = "Time"
+)
+
+// ArrayOf returns the type of an array whose elements have type elem.
+func ArrayOf(elem string) string {
+	if elem == TypeAny {
+		return TypeArray
+	}
+	return "array<" + elem + ">"
+}
+
+// elementType returns the element type of an array type, or TypeAny.
+func elementType(t string) string {
+	if strings.HasPrefix(t, "array<") && strings.HasSuffix(t, ">") {
+		return t[len("array<") : len(t)-1]
+	}
+	return TypeAny
+}
+
+// functionSignatures lists the argument types each library function expects.
+// A trailing "..." marks a type that repeats for the remaining arguments.
+var functionSignatures = map[string][]string{
+	"time.now":           {},
+	"time.parse":         {TypeString, TypeString},
+	"time.add":           {TypeTime, TypeNumeric},
+	"time.subtract":      {TypeTime, TypeNumeric},
+	"time.diff":          {TypeTime, TypeTime},
+	"time.isBefore":      {TypeTime, TypeTime},
+	"time.isAfter":       {TypeTime, TypeTime},
+	"time.isEqual":       {TypeTime, TypeTime},
+	"time.toEpochMillis": {TypeTime},
+	"time.format":        {TypeTime, TypeString},
+	"time.getYear":       {TypeTime},
+	"time.getMonth":      {TypeTime},
+	"time.getDay":        {TypeTime},
+	"time.startOfDay":    {TypeTime},
+	"time.endOfDay":      {TypeTime},
+	"time.withZone":      {TypeTime, TypeString},
+	"time.bucket":        {ArrayOf(TypeObject), TypeString, TypeString},
+
+	"math.abs":           {TypeNumeric},
+	"math.sqrt":          {TypeNumeric},
+	"math.floor":         {TypeNumeric},
+	"math.round":         {TypeNumeric},
+	"math.ceil":          {TypeNumeric},
+	"math.pow":           {TypeNumeric, TypeNumeric},
+	"math.sum":           {ArrayOf(TypeNumeric)},
+	"math.min":           {ArrayOf(TypeNumeric)},
+	"math.max":           {ArrayOf(TypeNumeric)},
+	"math.avg":           {ArrayOf(TypeNumeric)},
+	"math.weightedSum":   {ArrayOf(TypeObject), TypeString, TypeString},
+	"math.weightedAvg":   {ArrayOf(TypeObject), TypeString, TypeString},
+	"math.formatNumber":  {TypeNumeric, TypeNumeric, TypeString, TypeString},
+	"math.toFixed":       {TypeNumeric, TypeNumeric},
+	"math.toPercent":     {TypeNumeric, TypeNumeric},
+	"math.ratio":         {TypeNumeric, TypeNumeric, TypeAny},
+	"math.percentChange": {TypeNumeric, TypeNumeric, TypeAny},
+
+	"string.concat":         {TypeString + "..."},
+	"string.toLower":        {TypeString},
+	"string.toUpper":        {TypeString},
+	"string.trim":           {TypeString},
+	"string.startsWith":     {TypeString, TypeString},
+	"string.endsWith":       {TypeString, TypeString},
+	"string.contains":       {TypeString, TypeString},
+	"string.secureEquals":   {TypeString, TypeString},
+	"string.split":          {TypeString, TypeString},
+	"string.join":           {ArrayOf(TypeString), TypeString},
+	"string.substring":      {TypeString, TypeNumeric, TypeNumeric},
+	"string.replace":        {TypeString, TypeString, TypeString, TypeNumeric},
+	"string.indexOf":        {TypeString, TypeString, TypeNumeric},
+	"string.mask":           {TypeString, TypeNumeric, TypeString},
+	"string.redactEmail":    {TypeString},
+	"string.last4":          {TypeString},
+	"string.escapeHtml":     {TypeString},
+	"string.unescapeHtml":   {TypeString},
+	"string.stripTags":      {TypeString},
+	"string.parseCsvLine":   {TypeString, TypeString},
+	"string.graphemeLength": {TypeString},
+	"string.containsEmoji":  {TypeString},
+	"string.stripEmoji":     {TypeString},
+
+	"regex.match":   {TypeString, TypeString},
+	"regex.replace": {TypeString, TypeString, TypeString},
+	"regex.find":    {TypeString, TypeString},
+
+	"array.contains":    {TypeArray},
+	"array.find":        {ArrayOf(TypeObject), TypeString, TypeAny, TypeObject},
+	"array.first":       {TypeArray},
+	"array.last":        {TypeArray},
+	"array.extract":     {ArrayOf(TypeObject), TypeString},
+	"array.sort":        {TypeArray, TypeBoolean},
+	"array.flatten":     {TypeArray},
+	"array.filter":      {TypeArray, TypeString},
+	"array.filterExpr":  {TypeArray, TypeBoolean},
+	"array.mapExpr":     {TypeArray, TypeAny},
+	"array.anyExpr":     {TypeArray, TypeBoolean},
+	"array.allExpr":     {TypeArray, TypeBoolean},
+	"array.getPath":     {TypeAny, TypeString},
+	"array.deepGet":     {TypeAny, TypeString},
+	"array.frequencies": {TypeArray},
+	"array.mostCommon":  {TypeArray, TypeNumeric},
+	"array.windows":     {TypeArray, TypeNumeric},
+	"array.pairwise":    {TypeArray},
+
+	"cond.ifExpr":         {TypeBoolean, TypeAny, TypeAny},
+	"cond.coalesce":       {TypeAny + "..."},
+	"cond.isFieldPresent": {TypeObject, TypeString},
+
+	"type.string":        {TypeAny},
+	"type.int":           {TypeAny},
+	"type.float":         {TypeAny},
+	"type.decimal":       {TypeAny},
+	"type.intArray":      {TypeArray},
+	"type.floatArray":    {TypeArray},
+	"type.stringArray":   {TypeArray},
+	"type.isNumber":      {TypeAny},
+	"type.isString":      {TypeAny},
+	"type.isBoolean":     {TypeAny},
+	"type.isArray":       {TypeAny},
+	"type.isObject":      {TypeAny},
+	"type.isNull":        {TypeAny},
+	"type.matchesSchema": {TypeAny, TypeAny, TypeString},
+
+	"stat.zscore":    {TypeNumeric, ArrayOf(TypeNumeric)},
+	"stat.isOutlier": {TypeNumeric, ArrayOf(TypeNumeric), TypeNumeric},
+	"stat.movingAvg": {ArrayOf(TypeNumeric), TypeNumeric},
+
+	"object.flatten":       {TypeObject, TypeString},
+	"object.unflatten":     {TypeObject, TypeString},
+	"object.changedFields": {TypeObject, TypeObject},
+	"object.diff":          {TypeObject, TypeObject},
+
+	"valid.isEmail":      {TypeString},
+	"valid.isURL":        {TypeString},
+	"valid.isUUID":       {TypeString},
+	"valid.isPhone":      {TypeString},
+	"valid.isCreditCard": {TypeString},
+	"valid.isLuhn":       {TypeString},
+	"valid.isIBAN":       {TypeString},
+	"valid.isEAN":        {TypeString},
+
+	"phone.parse": {TypeString, TypeString},
+	"ua.parse":    {TypeString},
+
+	"iso.countryName":        {TypeString},
+	"iso.currencyForCountry": {TypeString},
+	"iso.isEU":               {TypeString},
+	"iso.isCountry":          {TypeString},
+
+	"convert.units":       {TypeNumeric, TypeString, TypeString},
+	"convert.temperature": {TypeNumeric, TypeString, TypeString},
+	"convert.bytesHuman":  {TypeNumeric, TypeNumeric},
+	"convert.hexToRgb":    {TypeString},
+	"convert.rgbToHex":    {TypeNumeric, TypeNumeric, TypeNumeric},
+
+	"jwt.decode":     {TypeString},
+	"jwt.verifyHmac": {TypeString, TypeString},
+
+	"url.parseQuery": {TypeString},
+
+	"range.overlaps":        {TypeArray, TypeArray},
+	"range.contains":        {TypeArray, TypeAny},
+	"range.merge":           {ArrayOf(TypeArray)},
+	"tree.isDescendant":     {TypeAny, TypeAny, TypeAny},
+	"tree.pathTo":           {TypeAny, TypeAny},
+	"random.token":          {TypeNumeric, TypeString},
+	"random.weightedChoice": {ArrayOf(TypeObject), TypeAny},
+
+	"hash.jump":             {TypeNumeric, TypeNumeric},
+	"hash.consistentBucket": {TypeAny, TypeNumeric},
+	"cache.memo":            {TypeString, TypeAny, TypeNumeric},
+}
+
+// timeResults lists functions that return a Time.
+var timeResults = map[string]bool{
+	"time.now":        true,
+	"time.parse":      true,
+	"time.add":        true,
+	"time.subtract":   true,
+	"time.startOfDay": true,
+	"time.endOfDay":   true,
+	"time.withZone":   true,
+}
+
+// Dependency is a context path read by an expression and the type its
+// usage implies.
+type Dependency struct {
+	// Path is the dotted context path without the leading '$'. Array indexes,
+	// dynamic keys and [*] projections appear as "*" and recursive descent
+	// as "**", matching `lql export-contexts`.
+	Path string
+	// Type is the inferred type, TypeAny when the usage does not constrain
+	// it, or several types joined by "|" when usages disagree.
+	Type string
+}
+
+// Dependencies returns every context path expr reads, in order of first
+// appearance, with the type implied by how each value is used: operands of
+// arithmetic are numeric, arguments are typed by the called function's
+// signature, and so on.
+func Dependencies(expr ast.Expression) []Dependency {
+	d := newDepCollector()
+	d.visit(expr, TypeAny)
+	deps := make([]Dependency, len(d.order))
+	for i, path := range d.order {
+		deps[i] = Dependency{Path: path, Type: mergeTypes(d.types[path])}
+	}
+	return deps
+}
+
+// ContextRoots returns the names of the top-level context fields expr
+// reads, in order of first appearance. Reads through "$" alone or a
+// computed key such as $[name] are not included.
+func ContextRoots(expr ast.Expression) []string {
+	var roots []string
+	seen := make(map[string]bool)
+	ast.Inspect(expr, func(node ast.Expression) bool {
+		if c, ok := node.(*expressions.ContextExpr); ok && c.Ident != nil && !seen[c.Ident.Name] {
+			seen[c.Ident.Name] = true
+			roots = append(roots, c.Ident.Name)
+		}
+		return true
+	})
+	return roots
+}
+
+type depCollector struct {
+	order []string
+	types map[string][]string
+	// shape records the nesting of every path read, for ContextSchema.
+	shape *contextNode
+	// lenient is set while visiting the left operand of "?:", where
+	// missing fields are tolerated.
+	lenient bool
+}
+
+func newDepCollector() *depCollector {
+	return &depCollector{types: make(map[string][]string), shape: newContextNode()}
+}
+
+func (d *depCollector) record(path, typ string) {
+	if _, seen := d.types[path]; !seen {
+		d.order = append(d.order, path)
+		d.types[path] = nil
+	}
+	d.types[path] = append(d.types[path], typ)
+}
+
+// visit walks expr, which is used where a value of type expected is needed.
+func (d *depCollector) visit(expr ast.Expression, expected string) {
+	switch e := expr.(type) {
+	case *expressions.ContextExpr:
+		if e.Ident != nil {
+			d.record(e.Ident.Name, expected)
+			d.shape.insert([]pathStep{{kind: stepProperty, key: e.Ident.Name, path: e.Ident.Name}}, !d.lenient)
+		} else if e.Subscript != nil {
+			d.visit(e.Subscript, TypeString)
+		}
+		return
+
+	case *expressions.MemberAccessExpr:
+		d.visitMemberAccess(e, expected)
+		return
+
+	case *expressions.BinaryExpr:
+		switch e.Operator {
+		case tokens.TokenAnd, tokens.TokenOr:
+			d.visit(e.Left, TypeBoolean)
+			d.visit(e.Right, TypeBoolean)
+		case tokens.TokenPlus, tokens.TokenMinus, tokens.TokenMultiply, tokens.TokenDivide:
+			d.visit(e.Left, TypeNumeric)
+			d.visit(e.Right, TypeNumeric)
+		case tokens.TokenMatch, tokens.TokenNotMatch:
+			d.visit(e.Left, TypeString)
+			d.visit(e.Right, TypeString)
+		case tokens.TokenLt, tokens.TokenGt, tokens.TokenLte, tokens.TokenGte, tokens.TokenEq, tokens.TokenNeq:
+			// Each side is expected to have the other side's static type.
+			d.visit(e.Left, staticType(e.Right))
+			d.visit(e.Right, staticType(e.Left))
+		default:
+			d.visitChildren(expr)
+		}
+		return
+
+	case *expressions.BetweenExpr:
+		// The subject is expected to have the bounds' static type, and
+		// the bounds the subject's.
+		bound := staticType(e.Low)
+		if bound == TypeAny {
+			bound = staticType(e.High)
+		}
+		d.visit(e.Subject, bound)
+		d.visit(e.Low, staticType(e.Subject))
+		d.visit(e.High, staticType(e.Subject))
+		return
+
+	case *expressions.LikeExpr:
+		d.visit(e.Subject, TypeString)
+		d.visit(e.Pattern, TypeString)
+		return
+
+	case *expressions.UnaryExpr:
+		if e.Operator == tokens.TokenNot {
+			d.visit(e.Expr, TypeBoolean)
+		} else {
+			d.visit(e.Expr, TypeNumeric)
+		}
+		return
+
+	case *expressions.DefaultExpr:
+		if expected == TypeAny {
+			expected = staticType(e.Fallback)
+		}
+		lenient := d.lenient
+		d.lenient = true
+		d.visit(e.Expr, expected)
+		d.lenient = lenient
+		d.visit(e.Fallback, expected)
+		return
+
+	case *expressions.LetExpr:
+		d.visit(e.Value, TypeAny)
+		d.visit(e.Body, expected)
+		return
+
+	case *expressions.FunctionCallExpr:
+		name := strings.Join(e.Namespace, ".")
+		sig := functionSignatures[name]
+		switch name {
+		case "math.sum", "math.min", "math.max", "math.avg":
+			// With a subfield the array holds objects.
+			if len(e.Args) > 1 {
+				sig = []string{ArrayOf(TypeObject), TypeString, TypeNumeric}
+			}
+		}
+		for i, arg := range e.Args {
+			d.visit(arg, argumentType(sig, i))
+		}
+		return
+
+	case *expressions.ArrayLiteralExpr:
+		for _, elem := range e.Elements {
+			d.visit(elem, elementType(expected))
+		}
+		return
+	}
+	d.visitChildren(expr)
+}
+
+func (d *depCollector) visitChildren(expr ast.Expression) {
+	for _, child := range ast.Children(expr) {
+		d.visit(child, TypeAny)
+	}
+}
+
+// visitMemberAccess records the path of a context member access. Each [*]
+// or ".." step turns the result into an array, so the leaf's type is the
+// expected type with one array layer removed per step.
+func (d *depCollector) visitMemberAccess(e *expressions.MemberAccessExpr, expected string) {
+	ctx, ok := e.Target.(*expressions.ContextExpr)
+	if !ok || ctx.Ident == nil {
+		d.visit(e.Target, TypeAny)
+		for _, part := range e.AccessParts {
+			if part.Expr != nil {
+				d.visit(part.Expr, TypeAny)
+			}
+		}
+		return
+	}
+	segments := []string{ctx.Ident.Name}
+	steps := []pathStep{{kind: stepProperty, key: ctx.Ident.Name, path: ctx.Ident.Name}}
+	leaf := expected
+	for _, part := range e.AccessParts {
+		step := pathStep{kind: stepProperty, optional: part.Optional}
+		switch {
+		case part.Wildcard:
+			segments = append(segments, "*")
+			leaf = elementType(leaf)
+			step.kind = stepItems
+		case part.Recursive:
+			segments = append(segments, "**", part.Key)
+			leaf = elementType(leaf)
+			step.kind = stepUnknown
+		case part.IsIndex:
+			if lit, ok := part.Expr.(*expressions.LiteralExpr); ok {
+				if key, ok := lit.Value.(string); ok {
+					segments = append(segments, key)
+					step.key = key
+					break
+				}
+				step.kind = stepItems
+			} else {
+				d.visit(part.Expr, TypeAny)
+				step.kind = stepUnknown
+			}
+			segments = append(segments, "*")
+		default:
+			segments = append(segments, part.Key)
+			step.key = part.Key
+		}
+		step.path = strings.Join(segments, ".")
+		steps = append(steps, step)
+	}
+	d.record(strings.Join(segments, "."), leaf)
+	d.shape.insert(steps, !d.lenient)
+}
+
+// argumentType returns the expected type of argument i under sig.
+func argumentType(sig []string, i int) string {
+	if len(sig) == 0 {
+		return TypeAny
+	}
+	if i >= len(sig) {
+		last := sig[len(sig)-1]
+		if strings.HasSuffix(last, "...") {
+			return strings.TrimSuffix(last, "...")
+		}
+		return TypeAny
+	}
+	return strings.TrimSuffix(sig[i], "...")
+}
+
+// staticType returns the type of expr when it is evident without context.
+func staticType(expr ast.Expression) string {
+	switch e := expr.(type) {
+	case *expressions.LiteralExpr:
+		switch e.Value.(type) {
+		case string:
+			return TypeString
+		case bool:
+			return TypeBoolean
+		case nil:
+			return TypeAny
+		default:
+			return TypeNumeric
+		}
+	case *expressions.UnaryExpr:
+		if e.Operator == tokens.TokenNot {
+			return TypeBoolean
+		}
+		return TypeNumeric
+	case *expressions.BinaryExpr:
+		switch e.Operator {
+		case tokens.TokenPlus, tokens.TokenMinus, tokens.TokenMultiply, tokens.TokenDivide:
+			return TypeNumeric
+		default:
+			return TypeBoolean
+		}
+	case *expressions.LikeExpr, *expressions.BetweenExpr:
+		return TypeBoolean
+	case *expressions.ArrayLiteralExpr:
+		return TypeArray
+	case *expressions.ObjectLiteralExpr:
+		return TypeObject
+	case *expressions.FunctionCallExpr:
+		if timeResults[strings.Join(e.Namespace, ".")] {
+			return TypeTime
+		}
+	}
+	return TypeAny
+}
+
+// mergeTypes combines the types inferred from each usage of a path. "any"
+// yields to any other type and a bare "array" yields to an array with a
+// known element type; remaining disagreements are joined with "|".
+func mergeTypes(usages []string) string {
+	var distinct []string
+	seen := make(map[string]bool)
+	for _, t := range usages {
+		if t != TypeAny && !seen[t] {
+			seen[t] = true
+			distinct = append(distinct, t)
+		}
+	}
+	if seen[TypeArray] {
+		for t := range seen {
+			if strings.HasPrefix(t, "array<") {
+				delete(seen, TypeArray)
+				break
+			}
+		}
+	}
+	var result []string
+	for _, t := range distinct {
+		if seen[t] {
+			result = append(result, t)
+		}
+	}
+	if len(result) == 0 {
+		return TypeAny
+	}
+	sort.Strings(result)
+	return strings.Join(result, "|")
+}
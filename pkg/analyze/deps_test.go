@@ -0,0 +1,85 @@
+package analyze
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// formatDeps renders dependencies as "path:type" pairs.
+func formatDeps(deps []Dependency) string {
+	parts := make([]string, len(deps))
+	for i, d := range deps {
+		parts[i] = d.Path + ":" + d.Type
+	}
+	return strings.Join(parts, ", ")
+}
+
+func TestDependencies(t *testing.T) {
+	tests := []struct {
+		src, want string
+	}{
+		{`$a`, "a:any"},
+		{`$a + 1 > $b`, "a:numeric, b:numeric"},
+		{`$a AND NOT $b`, "a:boolean, b:boolean"},
+		{`$user.name == "x" AND $user.age >= 18`, "user.name:string, user.age:numeric"},
+		{`$s =~ $pattern`, "s:string, pattern:string"},
+		{`$s LIKE "a%"`, "s:string"},
+		{`-$n`, "n:numeric"},
+		{`$d BETWEEN 1 AND $hi`, "d:numeric, hi:any"},
+		{`$created < time.now()`, "created:Time"},
+		// Arguments are typed by the function's signature.
+		{`string.toLower($name) == "x"`, "name:string"},
+		{`string.concat($a, $b, $c)`, "a:string, b:string, c:string"},
+		{`math.sum($prices) > 10`, "prices:array<numeric>"},
+		{`math.sum($items, "price") > 10`, "items:array<object>"},
+		{`array.contains($tags, "x")`, "tags:array"},
+		{`[$a, $b] == [1, 2]`, "a:any, b:any"},
+		{`math.max([$a, $b])`, "a:numeric, b:numeric"},
+		{`unknown.fn($a)`, "a:any"},
+		// Indexes, projections and recursive descent.
+		{`$items[0].sku == "x"`, "items.*.sku:string"},
+		{`$m["k"] > 1`, "m.k:numeric"},
+		{`$m[$key] > 1`, "key:any, m.*:numeric"},
+		{`math.sum($items[*].price)`, "items.*.price:numeric"},
+		{`math.sum($doc..price)`, "doc.**.price:numeric"},
+		// Defaults take the fallback's type.
+		{`$a?.b ?: 0`, "a.b:numeric"},
+		{`LET x = $a IN x + $b`, "a:any, b:numeric"},
+		// Usages merge: any yields to a concrete type, array to a typed array,
+		// and remaining conflicts are listed.
+		{`$a > 1 AND $a != null`, "a:numeric"},
+		{`array.contains($a, 1) AND math.sum($a) > 1`, "a:array<numeric>"},
+		{`$a == "x" OR $a > 1`, "a:numeric|string"},
+	}
+	for _, tt := range tests {
+		if got := formatDeps(Dependencies(parse(t, tt.src))); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestContextRoots(t *testing.T) {
+	tests := []struct {
+		src  string
+		want []string
+	}{
+		{`$b.c > 1 AND $a AND $b.d`, []string{"b", "a"}},
+		{`$[$name] == 1`, []string{"name"}},
+		{`1 + 2`, nil},
+	}
+	for _, tt := range tests {
+		if got := ContextRoots(parse(t, tt.src)); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestArrayOf(t *testing.T) {
+	if got := ArrayOf(TypeString); got != "array<string>" {
+		t.Errorf("got %s", got)
+	}
+	if got := ArrayOf(TypeAny); got != TypeArray {
+		t.Errorf("got %s", got)
+	}
+}
@@ -0,0 +1,184 @@
+package analyze
+
+import (
+	"github.com/SpecDrivenDesign/lql/pkg/ast"
+	"sort"
+	"strings"
+)
+
+// JSONSchemaDialect is the "$schema" URI of documents built by ContextSchema.
+const JSONSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+type stepKind int
+
+const (
+	stepProperty stepKind = iota // a named field
+	stepItems                    // every element of an array, or one by index
+	stepUnknown                  // a dynamic key or recursive descent
+)
+
+// pathStep is one level of a context path.
+type pathStep struct {
+	kind     stepKind
+	key      string
+	optional bool
+	// path is the dependency path up to and including this step.
+	path string
+}
+
+// contextNode is one value in the context shape an expression reads.
+type contextNode struct {
+	// path keys the node's inferred type in depCollector.types; empty for
+	// the root and for nodes only traversed through.
+	path       string
+	properties map[string]*contextNode
+	required   map[string]bool
+	items      *contextNode
+	// dynamic is set when the value is indexed by a computed key, so it may
+	// be an array or an object.
+	dynamic bool
+	// nullable is set when the value is accessed with "?.", which tolerates
+	// null.
+	nullable bool
+}
+
+func newContextNode() *contextNode {
+	return &contextNode{}
+}
+
+// insert adds a path to the shape. Steps are required until the first
+// optional one, and none are when required is false.
+func (n *contextNode) insert(steps []pathStep, required bool) {
+	for _, step := range steps {
+		if step.optional {
+			required = false
+			n.nullable = true
+		}
+		switch step.kind {
+		case stepProperty:
+			if n.properties == nil {
+				n.properties = make(map[string]*contextNode)
+				n.required = make(map[string]bool)
+			}
+			child, ok := n.properties[step.key]
+			if !ok {
+				child = newContextNode()
+				n.properties[step.key] = child
+			}
+			if required {
+				n.required[step.key] = true
+			}
+			n = child
+		case stepItems:
+			if n.items == nil {
+				n.items = newContextNode()
+			}
+			n = n.items
+		default:
+			n.dynamic = true
+			return
+		}
+		n.path = step.path
+	}
+}
+
+// ContextSchema returns a JSON Schema describing the smallest context expr
+// can be evaluated against: every field it reads, nested as it is accessed,
+// typed by how it is used (see Dependencies). Fields read only behind "?."
+// or on the left of "?:" are optional; all others are listed as required.
+// Additional fields are allowed everywhere.
+func ContextSchema(expr ast.Expression) map[string]interface{} {
+	d := newDepCollector()
+	d.visit(expr, TypeAny)
+	doc := d.jsonSchema(d.shape)
+	doc["$schema"] = JSONSchemaDialect
+	doc["type"] = "object"
+	return doc
+}
+
+// jsonSchema renders the schema of n. Structure implied by member access
+// takes precedence over the type inferred for the value itself.
+func (d *depCollector) jsonSchema(n *contextNode) map[string]interface{} {
+	schema := map[string]interface{}{}
+	switch {
+	case n.properties != nil:
+		schema["type"] = "object"
+		props := make(map[string]interface{}, len(n.properties))
+		for key, child := range n.properties {
+			props[key] = d.jsonSchema(child)
+		}
+		schema["properties"] = props
+		var required []string
+		for key := range n.required {
+			required = append(required, key)
+		}
+		if len(required) > 0 {
+			sort.Strings(required)
+			schema["required"] = required
+		}
+	case n.items != nil:
+		schema["type"] = "array"
+		schema["items"] = d.jsonSchema(n.items)
+	case n.dynamic:
+		schema["type"] = []string{"array", "object"}
+	case n.path != "":
+		for key, value := range jsonSchemaType(mergeTypes(d.types[n.path])) {
+			schema[key] = value
+		}
+	}
+	if t, ok := schema["type"].(string); ok && n.nullable {
+		schema["type"] = []string{t, "null"}
+	}
+	return schema
+}
+
+// jsonSchemaType translates an inferred type to JSON Schema keywords.
+func jsonSchemaType(t string) map[string]interface{} {
+	var alternatives []map[string]interface{}
+	for _, part := range splitUnion(t) {
+		switch {
+		case part == TypeNumeric:
+			alternatives = append(alternatives, map[string]interface{}{"type": "number"})
+		case part == TypeString, part == TypeBoolean, part == TypeArray, part == TypeObject:
+			alternatives = append(alternatives, map[string]interface{}{"type": part})
+		case strings.HasPrefix(part, "array<"):
+			alternatives = append(alternatives, map[string]interface{}{
+				"type":  "array",
+				"items": jsonSchemaType(elementType(part)),
+			})
+		default:
+			// "any" and Time, which a JSON context cannot hold, are
+			// left unconstrained.
+			return map[string]interface{}{}
+		}
+	}
+	if len(alternatives) == 1 {
+		return alternatives[0]
+	}
+	anyOf := make([]interface{}, len(alternatives))
+	for i, alt := range alternatives {
+		anyOf[i] = alt
+	}
+	return map[string]interface{}{"anyOf": anyOf}
+}
+
+// splitUnion splits a type joined by mergeTypes into its alternatives,
+// keeping array element types such as "array<numeric|string>" intact.
+func splitUnion(t string) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i, r := range t {
+		switch r {
+		case '<':
+			depth++
+		case '>':
+			depth--
+		case '|':
+			if depth == 0 {
+				parts = append(parts, t[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, t[start:])
+}
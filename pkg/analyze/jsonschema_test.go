@@ -0,0 +1,81 @@
+package analyze
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestContextSchema(t *testing.T) {
+	tests := []struct {
+		src, want string
+	}{
+		{`$a`, `{
+			"$schema": "https://json-schema.org/draft/2020-12/schema",
+			"type": "object",
+			"properties": {"a": {}},
+			"required": ["a"]
+		}`},
+		{`$user.age >= 18 AND string.startsWith($user.name, "a") AND $user?.address.city == "Oslo"
+			AND array.contains($order.items[*].sku, "x") AND ($promo ?: "none") != "" AND $flags[$key] == true`, `{
+			"$schema": "https://json-schema.org/draft/2020-12/schema",
+			"type": "object",
+			"properties": {
+				"flags": {"type": ["array", "object"]},
+				"key": {},
+				"order": {
+					"type": "object",
+					"properties": {
+						"items": {
+							"type": "array",
+							"items": {
+								"type": "object",
+								"properties": {"sku": {}},
+								"required": ["sku"]
+							}
+						}
+					},
+					"required": ["items"]
+				},
+				"promo": {"type": "string"},
+				"user": {
+					"type": ["object", "null"],
+					"properties": {
+						"address": {
+							"type": "object",
+							"properties": {"city": {"type": "string"}}
+						},
+						"age": {"type": "number"},
+						"name": {"type": "string"}
+					},
+					"required": ["age", "name"]
+				}
+			},
+			"required": ["flags", "key", "order", "user"]
+		}`},
+		{`$n + 1 > 2 OR $tags[0] == "x" OR $v == 1 OR $v == "1"`, `{
+			"$schema": "https://json-schema.org/draft/2020-12/schema",
+			"type": "object",
+			"properties": {
+				"n": {"type": "number"},
+				"tags": {"type": "array", "items": {"type": "string"}},
+				"v": {"anyOf": [{"type": "number"}, {"type": "string"}]}
+			},
+			"required": ["n", "tags", "v"]
+		}`},
+	}
+	for _, tt := range tests {
+		got, err := json.Marshal(ContextSchema(parse(t, tt.src)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Reorder the expected document's keys as Marshal writes them.
+		var doc interface{}
+		if err := json.Unmarshal([]byte(tt.want), &doc); err != nil {
+			t.Fatal(err)
+		}
+		wantJSON, _ := json.Marshal(doc)
+		if string(got) != string(wantJSON) {
+			t.Errorf("%s:\ngot  %s\nwant %s", tt.src, got, wantJSON)
+		}
+	}
+}
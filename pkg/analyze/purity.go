@@ -0,0 +1,105 @@
+package analyze
+
+import (
+	"github.com/SpecDrivenDesign/lql/pkg/ast"
+	"github.com/SpecDrivenDesign/lql/pkg/ast/expressions"
+	"strings"
+)
+
+// Volatility describes whether an expression evaluated twice against the
+// same context is guaranteed to produce the same result.
+type Volatility int
+
+const (
+	// Deterministic results depend only on the context and may be cached
+	// for as long as the context is unchanged.
+	Deterministic Volatility = iota
+	// TimeDependent results also depend on the clock, through time.now.
+	// They may be cached for as long as the host tolerates a stale clock.
+	TimeDependent
+	// NonDeterministic results may differ on every evaluation, such as
+	// those of random functions, and must not be cached.
+	NonDeterministic
+)
+
+func (v Volatility) String() string {
+	switch v {
+	case TimeDependent:
+		return "time-dependent"
+	case NonDeterministic:
+		return "non-deterministic"
+	}
+	return "deterministic"
+}
+
+// functionVolatility lists the built-in functions that are not
+// deterministic. All other built-in functions are. cache.memo may return a
+// value cached by an earlier evaluation against another context.
+var functionVolatility = map[string]Volatility{
+	"time.now":     TimeDependent,
+	"random.token": NonDeterministic,
+	"cache.memo":   NonDeterministic,
+}
+
+// PurityOptions describes host-provided functions to AnalyzePurity.
+type PurityOptions struct {
+	// Functions sets the volatility of individual calls, keyed by
+	// "library.function", overriding the built-in table.
+	Functions map[string]Volatility
+	// Libraries sets the volatility of every function of a library, for
+	// example one that reads an external service.
+	Libraries map[string]Volatility
+}
+
+// ImpureCall is a call that makes an expression less than deterministic.
+type ImpureCall struct {
+	Function   string
+	Volatility Volatility
+	Line       int
+	Column     int
+}
+
+// Purity is the result of AnalyzePurity.
+type Purity struct {
+	// Volatility is the highest volatility of any call in the expression.
+	Volatility Volatility
+	// Calls lists the calls that are not deterministic, in source order.
+	Calls []ImpureCall
+}
+
+// Deterministic reports whether the expression always yields the same
+// result for the same context.
+func (p Purity) Deterministic() bool {
+	return p.Volatility == Deterministic
+}
+
+// AnalyzePurity reports whether expr is deterministic, so hosts can decide
+// whether and for how long its results may be cached. Operators, including
+// custom ones, are assumed to be deterministic; a call is only as volatile
+// as the function it invokes, whatever its arguments.
+func AnalyzePurity(expr ast.Expression, opts PurityOptions) Purity {
+	var p Purity
+	ast.Inspect(expr, func(node ast.Expression) bool {
+		call, ok := node.(*expressions.FunctionCallExpr)
+		if !ok {
+			return true
+		}
+		name := strings.Join(call.Namespace, ".")
+		v, ok := opts.Functions[name]
+		if !ok && len(call.Namespace) > 0 {
+			v, ok = opts.Libraries[call.Namespace[0]]
+		}
+		if !ok {
+			v = functionVolatility[name]
+		}
+		if v == Deterministic {
+			return true
+		}
+		p.Calls = append(p.Calls, ImpureCall{Function: name, Volatility: v, Line: call.Line, Column: call.Column})
+		if v > p.Volatility {
+			p.Volatility = v
+		}
+		return true
+	})
+	return p
+}
@@ -0,0 +1,105 @@
+package analyze
+
+import (
+	"github.com/SpecDrivenDesign/lql/pkg/ast"
+	"github.com/SpecDrivenDesign/lql/pkg/lexer"
+	"github.com/SpecDrivenDesign/lql/pkg/parser"
+	"slices"
+	"testing"
+)
+
+func parse(t *testing.T, src string) ast.Expression {
+	t.Helper()
+	p, err := parser.NewParser(lexer.NewLexer(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expr, err := p.ParseExpression()
+	if err != nil {
+		t.Fatalf("%s: %v", src, err)
+	}
+	return expr
+}
+
+func TestAnalyzePurity(t *testing.T) {
+	opts := PurityOptions{}
+	tests := []struct {
+		src   string
+		want  Volatility
+		calls []string
+	}{
+		{`$a + math.abs($b) > 1`, Deterministic, nil},
+		{`time.now() > $deadline`, TimeDependent, []string{"time.now"}},
+		{`time.isBefore($start, time.add(time.now(), 60))`, TimeDependent, []string{"time.now"}},
+		{`random.token(8, "hex") != ""`, NonDeterministic, []string{"random.token"}},
+		// The highest volatility wins, and every impure call is listed.
+		{`time.now() == $t OR random.token(4, "hex") == $s`, NonDeterministic, []string{"time.now", "random.token"}},
+		// cache.memo may return what an earlier evaluation cached.
+		{`cache.memo("k", $a, 0) == 1`, NonDeterministic, []string{"cache.memo"}},
+		{`time.now() == cache.memo("k", 1, 0)`, NonDeterministic, []string{"time.now", "cache.memo"}},
+	}
+	for _, tt := range tests {
+		p := AnalyzePurity(parse(t, tt.src), opts)
+		if p.Volatility != tt.want {
+			t.Errorf("%s: %v, want %v", tt.src, p.Volatility, tt.want)
+		}
+		var calls []string
+		for _, call := range p.Calls {
+			calls = append(calls, call.Function)
+		}
+		if !slices.Equal(calls, tt.calls) {
+			t.Errorf("%s: calls %v, want %v", tt.src, calls, tt.calls)
+		}
+	}
+}
+
+func TestPurityOptions(t *testing.T) {
+	opts := PurityOptions{
+		Functions: map[string]Volatility{
+			"geo.now":  TimeDependent,
+			"time.now": Deterministic,
+		},
+		Libraries: map[string]Volatility{
+			"geo":  NonDeterministic,
+			"feed": TimeDependent,
+		},
+	}
+	tests := []struct {
+		src   string
+		want  Volatility
+		calls []string
+	}{
+		// Functions override the built-in table.
+		{`time.now() > $t`, Deterministic, nil},
+		// Libraries cover every function of a library, and Functions take
+		// precedence over them.
+		{`geo.lookup($ip) == "NL"`, NonDeterministic, []string{"geo.lookup"}},
+		{`geo.now() > $t`, TimeDependent, []string{"geo.now"}},
+		{`feed.price("X") > 1 AND random.token(1, "hex") != ""`, NonDeterministic, []string{"feed.price", "random.token"}},
+		{`other.fn($a)`, Deterministic, nil},
+	}
+	for _, tt := range tests {
+		p := AnalyzePurity(parse(t, tt.src), opts)
+		if p.Volatility != tt.want || p.Deterministic() != (tt.want == Deterministic) {
+			t.Errorf("%s: %v, want %v", tt.src, p.Volatility, tt.want)
+		}
+		var calls []string
+		for _, call := range p.Calls {
+			calls = append(calls, call.Function)
+		}
+		if !slices.Equal(calls, tt.calls) {
+			t.Errorf("%s: calls %v, want %v", tt.src, calls, tt.calls)
+		}
+	}
+
+	p := AnalyzePurity(parse(t, "$a AND\n  geo.lookup($ip)"), opts)
+	if call := p.Calls[0]; call.Line != 2 || call.Column != 3 || call.Volatility != NonDeterministic {
+		t.Errorf("got %+v", call)
+	}
+	if got := p.Volatility.String(); got != "non-deterministic" {
+		t.Errorf("got %s", got)
+	}
+	if got := TimeDependent.String() + ", " + Deterministic.String(); got != "time-dependent, deterministic" {
+		t.Errorf("got %s", got)
+	}
+}
@@ -0,0 +1,195 @@
+package analyze
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// SchemaFromStruct derives a Schema from the Go type of v, which must be a
+// struct or a pointer to one. Fields are named by their json tags, as
+// encoding/json would name them; fields tagged "-" and unexported fields are
+// skipped. Pointer fields and fields tagged omitempty are optional.
+func SchemaFromStruct(v interface{}) (Schema, error) {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("schema source must be a struct, got %T", v)
+	}
+	return structSchema(t, map[reflect.Type]bool{}), nil
+}
+
+func structSchema(t reflect.Type, visiting map[reflect.Type]bool) Schema {
+	visiting[t] = true
+	defer delete(visiting, t)
+	schema := Schema{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := field.Name
+		optional := false
+		if tag, ok := field.Tag.Lookup("json"); ok {
+			parts := strings.Split(tag, ",")
+			if parts[0] == "-" && len(parts) == 1 {
+				continue
+			}
+			if parts[0] != "" {
+				name = parts[0]
+			}
+			for _, opt := range parts[1:] {
+				if opt == "omitempty" || opt == "omitzero" {
+					optional = true
+				}
+			}
+		}
+		schema[name] = typeSchema(field.Type, optional, visiting)
+	}
+	return schema
+}
+
+// typeSchema returns the schema node for a Go type.
+func typeSchema(t reflect.Type, optional bool, visiting map[reflect.Type]bool) interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+		optional = true
+	}
+	name := kindAny
+	switch t.Kind() {
+	case reflect.String:
+		name = kindString
+	case reflect.Bool:
+		name = kindBool
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		name = kindInt
+	case reflect.Float32, reflect.Float64:
+		name = kindFloat
+	case reflect.Slice, reflect.Array:
+		if !optional {
+			return []interface{}{typeSchema(t.Elem(), false, visiting)}
+		}
+		name = kindArray
+	case reflect.Map:
+		name = kindObject
+	case reflect.Struct:
+		// Recursive types and optional structs are described only as
+		// objects; a nested schema cannot be marked optional.
+		if !optional && !visiting[t] {
+			return structSchema(t, visiting)
+		}
+		name = kindObject
+	}
+	if optional && name != kindAny {
+		name += "?"
+	}
+	return name
+}
+
+// SchemaFromJSONSchema converts a JSON Schema document to a Schema. The
+// document must describe an object. Properties missing from "required" are
+// optional; "type" may be a single name or a list including "null".
+// Constructs without an equivalent, such as "$ref" and "oneOf", become
+// "any".
+func SchemaFromJSONSchema(doc map[string]interface{}) (Schema, error) {
+	node, err := jsonSchemaNode(doc, false, "#")
+	if err != nil {
+		return nil, err
+	}
+	schema, ok := node.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("JSON Schema root must describe an object with properties")
+	}
+	return Schema(schema), nil
+}
+
+func jsonSchemaNode(doc map[string]interface{}, optional bool, path string) (interface{}, error) {
+	var names []string
+	switch t := doc["type"].(type) {
+	case nil:
+		if _, ok := doc["properties"]; ok {
+			names = []string{"object"}
+		}
+	case string:
+		names = []string{t}
+	case []interface{}:
+		for _, n := range t {
+			s, ok := n.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid type at %s", path)
+			}
+			names = append(names, s)
+		}
+	default:
+		return nil, fmt.Errorf("invalid type at %s", path)
+	}
+	var kinds []string
+	for _, n := range names {
+		if n == "null" {
+			optional = true
+		} else {
+			kinds = append(kinds, n)
+		}
+	}
+	if len(kinds) != 1 {
+		return kindAny, nil
+	}
+
+	name := kindAny
+	switch kinds[0] {
+	case "string":
+		name = kindString
+	case "integer":
+		name = kindInt
+	case "number":
+		name = kindNumber
+	case "boolean":
+		name = kindBool
+	case "array":
+		items, ok := doc["items"].(map[string]interface{})
+		if !optional {
+			if !ok {
+				return []interface{}{}, nil
+			}
+			elem, err := jsonSchemaNode(items, false, path+"/items")
+			if err != nil {
+				return nil, err
+			}
+			return []interface{}{elem}, nil
+		}
+		name = kindArray
+	case "object":
+		props, ok := doc["properties"].(map[string]interface{})
+		if !optional && ok {
+			required := map[string]bool{}
+			if list, ok := doc["required"].([]interface{}); ok {
+				for _, r := range list {
+					if s, ok := r.(string); ok {
+						required[s] = true
+					}
+				}
+			}
+			fields := make(map[string]interface{}, len(props))
+			for key, prop := range props {
+				propDoc, ok := prop.(map[string]interface{})
+				if !ok {
+					return nil, fmt.Errorf("invalid schema at %s/properties/%s", path, key)
+				}
+				field, err := jsonSchemaNode(propDoc, !required[key], path+"/properties/"+key)
+				if err != nil {
+					return nil, err
+				}
+				fields[key] = field
+			}
+			return fields, nil
+		}
+		name = kindObject
+	}
+	if optional && name != kindAny {
+		name += "?"
+	}
+	return name, nil
+}
@@ -0,0 +1,63 @@
+package analyze
+
+import (
+	"sort"
+	"strings"
+)
+
+// Signature describes a standard library function as the analyzer types it.
+type Signature struct {
+	// Name is the qualified name, "library.function".
+	Name string `json:"name"`
+	// Args lists the types of the leading arguments that are checked; a
+	// trailing "..." marks a type that repeats for the remaining arguments.
+	// Arguments past the list are not checked.
+	Args []string `json:"args"`
+	// Result is the type of the result, or TypeAny when it depends on the
+	// arguments.
+	Result string `json:"result"`
+}
+
+// Signatures returns the signatures of the standard library functions,
+// sorted by name.
+func Signatures() []Signature {
+	sigs := make([]Signature, 0, len(functionSignatures))
+	for name, args := range functionSignatures {
+		sigs = append(sigs, Signature{Name: name, Args: append([]string{}, args...), Result: resultType(name)})
+	}
+	sort.Slice(sigs, func(i, j int) bool { return sigs[i].Name < sigs[j].Name })
+	return sigs
+}
+
+// LibrarySignatures returns the signatures of the functions of one
+// library, sorted by name.
+func LibrarySignatures(library string) []Signature {
+	var sigs []Signature
+	for _, sig := range Signatures() {
+		if strings.HasPrefix(sig.Name, library+".") {
+			sigs = append(sigs, sig)
+		}
+	}
+	return sigs
+}
+
+// resultType converts the result kind Check tracks for a function to the
+// type names used in signatures.
+func resultType(name string) string {
+	if timeResults[name] {
+		return TypeTime
+	}
+	switch functionResults[name] {
+	case kindString:
+		return TypeString
+	case kindInt, kindFloat, kindNumber:
+		return TypeNumeric
+	case kindBool:
+		return TypeBoolean
+	case kindArray:
+		return TypeArray
+	case kindObject:
+		return TypeObject
+	}
+	return TypeAny
+}
@@ -0,0 +1,22 @@
+package ast
+
+// Cloner is implemented by expressions that hold state other than their
+// child expressions. CloneNode returns a copy of the node that shares its
+// children; Clone uses it to copy leaves and fields that Rewriter does not
+// reach.
+type Cloner interface {
+	CloneNode() Expression
+}
+
+// Clone returns a deep copy of the tree rooted at expr. The copy shares no
+// nodes or slices with the original, so it can be mutated or rewritten in
+// place while the original, for example a cached compiled expression, stays
+// intact. Literal values are immutable and are shared.
+func Clone(expr Expression) Expression {
+	return Rewrite(expr, func(node Expression) Expression {
+		if c, ok := node.(Cloner); ok {
+			return c.CloneNode()
+		}
+		return node
+	})
+}
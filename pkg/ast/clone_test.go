@@ -0,0 +1,78 @@
+package ast_test
+
+import (
+	"github.com/SpecDrivenDesign/lql/pkg/ast"
+	"github.com/SpecDrivenDesign/lql/pkg/ast/expressions"
+	"testing"
+)
+
+func TestCloneSharesNoNodes(t *testing.T) {
+	for _, src := range append(rewriteSources, `$a > :min`) {
+		expr := parse(t, src)
+		clone := ast.Clone(expr)
+		if !ast.Equal(clone, expr) {
+			t.Errorf("%s: cloned as %s", src, clone)
+		}
+		original := make(map[ast.Expression]bool)
+		ast.Inspect(expr, func(node ast.Expression) bool {
+			original[node] = true
+			return true
+		})
+		ast.Inspect(clone, func(node ast.Expression) bool {
+			if original[node] {
+				t.Errorf("%s: %s is shared", src, node)
+			}
+			if c, ok := node.(*expressions.ContextExpr); ok && c.Ident != nil {
+				ast.Inspect(expr, func(o ast.Expression) bool {
+					if oc, ok := o.(*expressions.ContextExpr); ok && oc.Ident == c.Ident {
+						t.Errorf("%s: the identifier of %s is shared", src, c)
+					}
+					return true
+				})
+			}
+			return true
+		})
+	}
+	if ast.Clone(nil) != nil {
+		t.Error("a nil tree was cloned")
+	}
+}
+
+func TestCloneCanBeMutated(t *testing.T) {
+	expr := parse(t, `$user.name == "x" AND string.concat($a, "b") != ""`)
+	clone := ast.Clone(expr)
+	ast.Inspect(clone, func(node ast.Expression) bool {
+		switch n := node.(type) {
+		case *expressions.ContextExpr:
+			n.Ident.Name = "other"
+		case *expressions.MemberAccessExpr:
+			n.AccessParts[0].Key = "email"
+		case *expressions.FunctionCallExpr:
+			n.Namespace[1] = "trim"
+		case *expressions.LiteralExpr:
+			n.Value = "changed"
+		}
+		return true
+	})
+	if want := `$user.name == "x" AND string.concat($a, "b") != ""`; expr.String() != want {
+		t.Errorf("mutating the clone changed the original to %s", expr)
+	}
+	if want := `$other.email == "changed" AND string.trim($other, "changed") != "changed"`; clone.String() != want {
+		t.Errorf("got %s, want %s", clone, want)
+	}
+}
+
+func TestCloneKeepsMetadata(t *testing.T) {
+	expr := parse(t, `$a > 1`)
+	ast.Annotate(expr, "rule", "r1")
+	ast.Annotate(ast.Children(expr)[0], "source", "a.lql")
+	clone := ast.Clone(expr)
+	if ast.MetadataOf(clone)["rule"] != "r1" || ast.MetadataOf(ast.Children(clone)[0])["source"] != "a.lql" {
+		t.Errorf("metadata lost: %v, %v", ast.MetadataOf(clone), ast.MetadataOf(ast.Children(clone)[0]))
+	}
+	ast.Annotate(clone, "rule", "r2")
+	ast.Annotate(ast.Children(clone)[1], "note", "x")
+	if ast.MetadataOf(expr)["rule"] != "r1" || ast.MetadataOf(ast.Children(expr)[1]) != nil {
+		t.Error("annotating the clone changed the original")
+	}
+}
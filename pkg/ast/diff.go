@@ -0,0 +1,154 @@
+package ast
+
+import (
+	"fmt"
+	"github.com/SpecDrivenDesign/lql/pkg/env"
+	"strings"
+)
+
+// ChangeKind classifies a Change.
+type ChangeKind string
+
+const (
+	// ChangeModified replaces the subtree Old with New.
+	ChangeModified ChangeKind = "modified"
+	// ChangeAdded inserts New, an element, argument or field with no
+	// counterpart in the old tree.
+	ChangeAdded ChangeKind = "added"
+	// ChangeRemoved deletes Old, which has no counterpart in the new tree.
+	ChangeRemoved ChangeKind = "removed"
+)
+
+// Change is one difference reported by Diff.
+type Change struct {
+	Kind ChangeKind
+	// Old is the subtree in the old expression; nil for ChangeAdded.
+	Old Expression
+	// New is the subtree in the new expression; nil for ChangeRemoved.
+	New Expression
+}
+
+func (c Change) String() string {
+	switch c.Kind {
+	case ChangeAdded:
+		line, column := c.New.Pos()
+		return fmt.Sprintf("+ line %d, column %d: %s", line, column, c.New)
+	case ChangeRemoved:
+		line, column := c.Old.Pos()
+		return fmt.Sprintf("- line %d, column %d: %s", line, column, c.Old)
+	default:
+		line, column := c.Old.Pos()
+		return fmt.Sprintf("~ line %d, column %d: %s -> %s", line, column, c.Old, c.New)
+	}
+}
+
+// Diff reports the smallest subtrees that differ between oldExpr and
+// newExpr, in order of appearance. Nodes of the same kind that differ only
+// in their children are descended into; children are aligned so that an
+// inserted or deleted argument, element or field is reported on its own
+// rather than as a change to everything after it. Equal trees (see Equal)
+// have no changes.
+func Diff(oldExpr, newExpr Expression) []Change {
+	var changes []Change
+	diffNodes(oldExpr, newExpr, &changes)
+	return changes
+}
+
+func diffNodes(a, b Expression, changes *[]Change) {
+	if Equal(a, b) {
+		return
+	}
+	if a == nil || b == nil || !sameShell(a, b) {
+		*changes = append(*changes, Change{Kind: ChangeModified, Old: a, New: b})
+		return
+	}
+	as, bs := Children(a), Children(b)
+	if len(as) == len(bs) {
+		for i := range as {
+			diffNodes(as[i], bs[i], changes)
+		}
+		return
+	}
+	diffChildren(as, bs, changes)
+}
+
+// diffChildren aligns two child lists of different lengths on their longest common subsequence
+// of equal subtrees. Between matches, children are paired in order and
+// compared; leftovers are additions or removals.
+func diffChildren(as, bs []Expression, changes *[]Change) {
+	// lcs[i][j] is the LCS length of as[i:] and bs[j:].
+	lcs := make([][]int, len(as)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(bs)+1)
+	}
+	for i := len(as) - 1; i >= 0; i-- {
+		for j := len(bs) - 1; j >= 0; j-- {
+			if Equal(as[i], bs[j]) {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	var pendingA, pendingB []Expression
+	flush := func() {
+		n := min(len(pendingA), len(pendingB))
+		for k := 0; k < n; k++ {
+			diffNodes(pendingA[k], pendingB[k], changes)
+		}
+		for _, old := range pendingA[n:] {
+			*changes = append(*changes, Change{Kind: ChangeRemoved, Old: old})
+		}
+		for _, added := range pendingB[n:] {
+			*changes = append(*changes, Change{Kind: ChangeAdded, New: added})
+		}
+		pendingA, pendingB = nil, nil
+	}
+	i, j := 0, 0
+	for i < len(as) && j < len(bs) {
+		switch {
+		case Equal(as[i], bs[j]) && lcs[i][j] == lcs[i+1][j+1]+1:
+			flush()
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			pendingA = append(pendingA, as[i])
+			i++
+		default:
+			pendingB = append(pendingB, bs[j])
+			j++
+		}
+	}
+	pendingA = append(pendingA, as[i:]...)
+	pendingB = append(pendingB, bs[j:]...)
+	flush()
+}
+
+// hole stands in for a child when comparing two nodes without their
+// children.
+type hole struct{}
+
+func (hole) Eval(map[string]interface{}, *env.Environment) (interface{}, error) { return nil, nil }
+func (hole) Pos() (int, int)                                                    { return 0, 0 }
+func (hole) String() string                                                     { return "_" }
+
+// sameShell reports whether a and b are the same kind of node with the same
+// operator, name or keys, differing at most in their children. The number
+// of children may differ, as with calls taking different argument counts.
+func sameShell(a, b Expression) bool {
+	ra, ok := a.(Rewriter)
+	if !ok {
+		return false
+	}
+	rb, ok := b.(Rewriter)
+	if !ok {
+		return false
+	}
+	blank := func(Expression) Expression { return hole{} }
+	return stripHoles(structure(ra.RewriteChildren(blank))) == stripHoles(structure(rb.RewriteChildren(blank)))
+}
+
+// stripHoles removes blanked children from lists in a structure encoding.
+func stripHoles(s string) string {
+	return strings.ReplaceAll(s, structure(hole{})+",", "")
+}
@@ -0,0 +1,43 @@
+package ast_test
+
+import (
+	"github.com/SpecDrivenDesign/lql/pkg/ast"
+	"slices"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		old, new string
+		want     []string
+	}{
+		{`$a > 1 AND $b`, ` ($a > 1) and $b`, nil},
+		// Only the changed subtree is reported.
+		{`$a > 1 AND $b == "x"`, `$a > 1 AND $b == "y"`, []string{`~ line 1, column 18: "x" -> "y"`}},
+		{`$a > 1 AND $b`, `$a >= 1 AND $b`, []string{`~ line 1, column 4: $a > 1 -> $a >= 1`}},
+		{`math.max($a, $b)`, `math.min($a, $b)`, []string{`~ line 1, column 1: math.max($a, $b) -> math.min($a, $b)`}},
+		{`$a + 1 > 2 OR $c`, `$a + 2 > 3 OR $c`, []string{
+			`~ line 1, column 6: 1 -> 2`,
+			`~ line 1, column 10: 2 -> 3`,
+		}},
+		// Inserted and deleted children are reported on their own.
+		{`array.contains([1, 2, 3], $a)`, `array.contains([1, 3], $a)`, []string{`- line 1, column 20: 2`}},
+		{`array.contains([1, 3], $a)`, `array.contains([1, 2, 3, 4], $a)`, []string{
+			`+ line 1, column 20: 2`,
+			`+ line 1, column 26: 4`,
+		}},
+		{`[1, 2, 3]`, `[1, 5, 3, 4]`, []string{
+			`~ line 1, column 5: 2 -> 5`,
+			`+ line 1, column 11: 4`,
+		}},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, change := range ast.Diff(parse(t, tt.old), parse(t, tt.new)) {
+			got = append(got, change.String())
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s -> %s: got %q, want %q", tt.old, tt.new, got, tt.want)
+		}
+	}
+}
@@ -12,16 +12,24 @@ type ArrayLiteralExpr struct {
 	Elements []ast.Expression
 	Line     int
 	Column   int
+	ast.Annotations
 }
 
 func (a *ArrayLiteralExpr) Eval(ctx map[string]interface{}, env *env.Environment) (interface{}, error) {
+	return EvalIn(a, ctx, nil, env)
+}
+
+func (a *ArrayLiteralExpr) eval(ctx map[string]interface{}, scope *env.Scope, env *env.Environment) (interface{}, error) {
 	var result []interface{}
-	for _, expr := range a.Elements {
-		val, err := expr.Eval(ctx, env)
+	if len(a.Elements) > 0 {
+		values, err := evalAll(a.Elements, ctx, scope, env)
 		if err != nil {
 			return nil, err
 		}
-		result = append(result, val)
+		result = values
+	}
+	if err := env.Produced(scope, result, a.Line, a.Column); err != nil {
+		return nil, err
 	}
 	return result, nil
 }
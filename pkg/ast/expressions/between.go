@@ -0,0 +1,84 @@
+package expressions
+
+import (
+	"fmt"
+	"github.com/SpecDrivenDesign/lql/pkg/ast"
+	"github.com/SpecDrivenDesign/lql/pkg/env"
+	"github.com/SpecDrivenDesign/lql/pkg/errors"
+	"github.com/SpecDrivenDesign/lql/pkg/tokens"
+)
+
+// BetweenExpr represents "x BETWEEN low AND high", which is true when
+// x >= low and x <= high. The subject is evaluated once, and high is not
+// evaluated when x is below low.
+type BetweenExpr struct {
+	Subject ast.Expression
+	Low     ast.Expression
+	High    ast.Expression
+	Line    int
+	Column  int
+	ast.Annotations
+}
+
+func (b *BetweenExpr) Eval(ctx map[string]interface{}, env *env.Environment) (interface{}, error) {
+	return EvalIn(b, ctx, nil, env)
+}
+
+func (b *BetweenExpr) eval(ctx map[string]interface{}, scope *env.Scope, env *env.Environment) (interface{}, error) {
+	subject, err := EvalIn(b.Subject, ctx, scope, env)
+	if err != nil {
+		return nil, err
+	}
+	low, err := EvalIn(b.Low, ctx, scope, env)
+	if err != nil {
+		return nil, err
+	}
+	above, err := CompareBetween(tokens.TokenGte, subject, low, b.Line, b.Column, scope, env)
+	if err != nil || !above {
+		return above, err
+	}
+	high, err := EvalIn(b.High, ctx, scope, env)
+	if err != nil {
+		return nil, err
+	}
+	return CompareBetween(tokens.TokenLte, subject, high, b.Line, b.Column, scope, env)
+}
+
+// CompareBetween applies the comparison op, >= or <=, of a BETWEEN
+// expression at line and column to its subject and a bound.
+func CompareBetween(op tokens.TokenType, subject, bound interface{}, line, column int, scope *env.Scope, e *env.Environment) (bool, error) {
+	val, err := ApplyBinary(op, binaryOperators[op], subject, bound, line, column, scope, e)
+	if err != nil {
+		return false, err
+	}
+	result, ok := val.(bool)
+	if !ok {
+		return false, errors.NewSemanticError("BETWEEN operator requires boolean comparisons", line, column)
+	}
+	return result, nil
+}
+
+// Lowered returns the equivalent "x >= low AND x <= high", which refers
+// to the subject twice, for translations into languages without BETWEEN.
+func (b *BetweenExpr) Lowered() ast.Expression {
+	return &BinaryExpr{
+		Left:     &BinaryExpr{Left: b.Subject, Operator: tokens.TokenGte, Right: b.Low, Line: b.Line, Column: b.Column},
+		Operator: tokens.TokenAnd,
+		Right:    &BinaryExpr{Left: b.Subject, Operator: tokens.TokenLte, Right: b.High, Line: b.Line, Column: b.Column},
+		Line:     b.Line,
+		Column:   b.Column,
+	}
+}
+
+func (b *BetweenExpr) Pos() (int, int) {
+	return b.Line, b.Column
+}
+
+func (b *BetweenExpr) String() string {
+	betweenStr, andStr := "between", "and"
+	if ColorEnabled {
+		betweenStr = OperatorColor + betweenStr + ColorReset
+		andStr = OperatorColor + andStr + ColorReset
+	}
+	return fmt.Sprintf("%s %s %s %s %s", b.Subject.String(), betweenStr, b.Low.String(), andStr, b.High.String())
+}
@@ -0,0 +1,94 @@
+package expressions_test
+
+import (
+	"github.com/SpecDrivenDesign/lql/pkg/ast"
+	"github.com/SpecDrivenDesign/lql/pkg/compile"
+	"github.com/SpecDrivenDesign/lql/pkg/env"
+	"github.com/SpecDrivenDesign/lql/pkg/lexer"
+	"github.com/SpecDrivenDesign/lql/pkg/param"
+	"github.com/SpecDrivenDesign/lql/pkg/parser"
+	"github.com/SpecDrivenDesign/lql/pkg/vm"
+	"testing"
+)
+
+// counter is a library whose next function returns how often it has been
+// called.
+type counter struct{ calls int }
+
+func (c *counter) Call(functionName string, args []param.Arg, line, column, parenLine, parenColumn int) (interface{}, error) {
+	c.calls++
+	return int64(c.calls), nil
+}
+
+func parse(t *testing.T, src string) ast.Expression {
+	t.Helper()
+	p, err := parser.NewParser(lexer.NewLexer(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expr, err := p.ParseExpression()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return expr
+}
+
+// evaluators evaluate an expression with each of the evaluators.
+var evaluators = map[string]func(ast.Expression, map[string]interface{}, *env.Environment) (interface{}, error){
+	"tree": func(expr ast.Expression, ctx map[string]interface{}, e *env.Environment) (interface{}, error) {
+		return expr.Eval(ctx, e)
+	},
+	"compiled": func(expr ast.Expression, ctx map[string]interface{}, e *env.Environment) (interface{}, error) {
+		return compile.Compile(expr, e).Eval(ctx)
+	},
+	"vm": func(expr ast.Expression, ctx map[string]interface{}, e *env.Environment) (interface{}, error) {
+		prog, err := vm.Compile(expr)
+		if err != nil {
+			return nil, err
+		}
+		return prog.Run(ctx, e)
+	},
+}
+
+func TestBetweenEvaluatesSubjectOnce(t *testing.T) {
+	tests := []struct {
+		src  string
+		want bool
+	}{
+		// A subject evaluated once per bound would be 1 against the low
+		// bound and 2 against the high one.
+		{"counter.next() BETWEEN 1 AND 1", true},
+		{"counter.next() BETWEEN 2 AND 2", false},
+		{"counter.next() BETWEEN 0 AND 5", true},
+	}
+	for name, eval := range evaluators {
+		for _, tt := range tests {
+			c := &counter{}
+			e := env.NewEnvironment()
+			e.MustRegister("counter", c)
+			got, err := eval(parse(t, tt.src), map[string]interface{}{}, e)
+			if err != nil {
+				t.Fatalf("%s: %s: %v", name, tt.src, err)
+			}
+			if got != tt.want {
+				t.Errorf("%s: %s = %v, want %v", name, tt.src, got, tt.want)
+			}
+			if c.calls != 1 {
+				t.Errorf("%s: %s evaluated the subject %d times, want 1", name, tt.src, c.calls)
+			}
+		}
+	}
+}
+
+func TestBetweenSkipsHighBelowLow(t *testing.T) {
+	c := &counter{}
+	e := env.NewEnvironment()
+	e.MustRegister("counter", c)
+	got, err := parse(t, "0 BETWEEN 1 AND counter.next()").Eval(map[string]interface{}{}, e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != false || c.calls != 0 {
+		t.Errorf("got %v with %d calls of the high bound, want false with none", got, c.calls)
+	}
+}
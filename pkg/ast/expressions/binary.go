@@ -16,13 +16,18 @@ type BinaryExpr struct {
 	Right    ast.Expression
 	Line     int
 	Column   int
+	ast.Annotations
 }
 
 func (b *BinaryExpr) Eval(ctx map[string]interface{}, env *env.Environment) (interface{}, error) {
+	return EvalIn(b, ctx, nil, env)
+}
+
+func (b *BinaryExpr) eval(ctx map[string]interface{}, scope *env.Scope, env *env.Environment) (interface{}, error) {
 	switch b.Operator {
 	case tokens.TokenAnd:
 		// Short-circuit: evaluate left operand first.
-		leftVal, err := b.Left.Eval(ctx, env)
+		leftVal, err := EvalIn(b.Left, ctx, scope, env)
 		if err != nil {
 			return nil, err
 		}
@@ -33,7 +38,7 @@ func (b *BinaryExpr) Eval(ctx map[string]interface{}, env *env.Environment) (int
 		if !lb {
 			return false, nil
 		}
-		rightVal, err := b.Right.Eval(ctx, env)
+		rightVal, err := EvalIn(b.Right, ctx, scope, env)
 		if err != nil {
 			return nil, err
 		}
@@ -45,7 +50,7 @@ func (b *BinaryExpr) Eval(ctx map[string]interface{}, env *env.Environment) (int
 
 	case tokens.TokenOr:
 		// Short-circuit: evaluate left operand first.
-		leftVal, err := b.Left.Eval(ctx, env)
+		leftVal, err := EvalIn(b.Left, ctx, scope, env)
 		if err != nil {
 			return nil, err
 		}
@@ -56,7 +61,7 @@ func (b *BinaryExpr) Eval(ctx map[string]interface{}, env *env.Environment) (int
 		if lb {
 			return true, nil
 		}
-		rightVal, err := b.Right.Eval(ctx, env)
+		rightVal, err := EvalIn(b.Right, ctx, scope, env)
 		if err != nil {
 			return nil, err
 		}
@@ -68,89 +73,221 @@ func (b *BinaryExpr) Eval(ctx map[string]interface{}, env *env.Environment) (int
 
 	default:
 		// Evaluate both operands for other operators.
-		leftVal, err := b.Left.Eval(ctx, env)
+		leftVal, err := EvalIn(b.Left, ctx, scope, env)
 		if err != nil {
 			return nil, err
 		}
-		rightVal, err := b.Right.Eval(ctx, env)
+		rightVal, err := EvalIn(b.Right, ctx, scope, env)
 		if err != nil {
 			return nil, err
 		}
-		switch b.Operator {
-		case tokens.TokenPlus:
-			ln, lok := types.ToFloat(leftVal)
-			rn, rok := types.ToFloat(rightVal)
-			if !lok || !rok {
-				return nil, errors.NewSemanticError("'+' operator used on non‑numeric type", b.Line, b.Column)
-			}
-			if types.IsInt(leftVal) != types.IsInt(rightVal) {
-				return nil, errors.NewSemanticError("Mixed numeric types require explicit conversion", b.Line, b.Column)
-			}
-			if types.IsInt(leftVal) {
-				return int64(ln + rn), nil
-			}
-			return ln + rn, nil
+		if apply, ok := binaryOperators[b.Operator]; ok {
+			return ApplyBinary(b.Operator, apply, leftVal, rightVal, b.Line, b.Column, scope, env)
+		}
+	}
+	return nil, errors.NewUnknownOperatorError("unknown binary operator", b.Line, b.Column)
+}
 
-		case tokens.TokenMinus:
-			ln, lok := types.ToFloat(leftVal)
-			rn, rok := types.ToFloat(rightVal)
-			if !lok || !rok {
-				return nil, errors.NewSemanticError("'-' operator used on non‑numeric type", b.Line, b.Column)
-			}
-			if types.IsInt(leftVal) != types.IsInt(rightVal) {
-				return nil, errors.NewSemanticError("Mixed numeric types require explicit conversion", b.Line, b.Column)
-			}
-			if types.IsInt(leftVal) {
-				return int64(ln - rn), nil
-			}
-			return ln - rn, nil
+// BinaryOperatorFunc applies a binary operator to its evaluated operands.
+// Line and column locate the operator for errors, and e is the environment
+// evaluating it in scope.
+type BinaryOperatorFunc func(left, right interface{}, line, column int, scope *env.Scope, e *env.Environment) (interface{}, error)
 
-		case tokens.TokenMultiply:
-			ln, lok := types.ToFloat(leftVal)
-			rn, rok := types.ToFloat(rightVal)
-			if !lok || !rok {
-				return nil, errors.NewSemanticError("'*' operator used on non‑numeric type", b.Line, b.Column)
-			}
-			if types.IsInt(leftVal) != types.IsInt(rightVal) {
-				return nil, errors.NewSemanticError("Mixed numeric types require explicit conversion", b.Line, b.Column)
-			}
-			if types.IsInt(leftVal) {
-				return int64(ln * rn), nil
-			}
-			return ln * rn, nil
+// BinaryOperator returns the function applying op. AND and OR, which
+// decide whether to evaluate their right operand, have none.
+func BinaryOperator(op tokens.TokenType) (BinaryOperatorFunc, bool) {
+	apply, ok := binaryOperators[op]
+	return apply, ok
+}
 
-		case tokens.TokenDivide:
-			ln, lok := types.ToFloat(leftVal)
-			rn, rok := types.ToFloat(rightVal)
-			if !lok || !rok {
-				return nil, errors.NewSemanticError("'/' operator used on non‑numeric type", b.Line, b.Column)
-			}
-			if rn == 0 {
-				return nil, errors.NewDivideByZeroError("division by zero", b.Line, b.Column)
-			}
-			if types.IsInt(leftVal) != types.IsInt(rightVal) {
-				return nil, errors.NewSemanticError("Mixed numeric types require explicit conversion", b.Line, b.Column)
-			}
-			if types.IsInt(leftVal) {
-				return int64(ln / rn), nil
+// ApplyBinary applies op, whose function apply BinaryOperator returned, to
+// its evaluated operands as e configures it: operands of custom types use
+// the operators registered for them, strings are compared with e's
+// collator, if it has one, and the operands of arithmetic are promoted by
+// promoteOperands.
+func ApplyBinary(op tokens.TokenType, apply BinaryOperatorFunc, left, right interface{}, line, column int, scope *env.Scope, e *env.Environment) (interface{}, error) {
+	if symbol, ok := overloadableSymbol(op); ok {
+		if fn, ok := e.OverloadedOperator(symbol, left, right); ok {
+			return fn(left, right, line, column)
+		}
+	}
+	if collator := e.Collator(); collator != nil {
+		if result, ok := collate(op, left, right, collator); ok {
+			return result, nil
+		}
+	}
+	left, right = promoteOperands(op, left, right, e)
+	return apply(left, right, line, column, scope, e)
+}
+
+// collate compares two strings with collator for a comparison operator. It
+// reports false for other operators and operands.
+func collate(op tokens.TokenType, left, right interface{}, collator types.Collator) (bool, bool) {
+	switch op {
+	case tokens.TokenEq, tokens.TokenNeq, tokens.TokenLt, tokens.TokenGt, tokens.TokenLte, tokens.TokenGte:
+	default:
+		return false, false
+	}
+	ls, lok := left.(string)
+	rs, rok := right.(string)
+	if !lok || !rok {
+		return false, false
+	}
+	c := collator.Compare(ls, rs)
+	switch op {
+	case tokens.TokenEq:
+		return c == 0, true
+	case tokens.TokenNeq:
+		return c != 0, true
+	case tokens.TokenLt:
+		return c < 0, true
+	case tokens.TokenGt:
+		return c > 0, true
+	case tokens.TokenLte:
+		return c <= 0, true
+	}
+	return c >= 0, true
+}
+
+// promoteOperands converts the operands of an arithmetic operator as e
+// requires: with decimal arithmetic, numbers that are not both ints become
+// decimals; with numeric promotion, an int becomes a float when the other
+// operand is a float. Other operands are returned unchanged.
+func promoteOperands(op tokens.TokenType, left, right interface{}, e *env.Environment) (interface{}, interface{}) {
+	if !e.NumericPromotion() && !e.DecimalArithmetic() {
+		return left, right
+	}
+	switch op {
+	case tokens.TokenPlus, tokens.TokenMinus, tokens.TokenMultiply, tokens.TokenDivide:
+		if e.DecimalArithmetic() && !(types.IsInt(left) && types.IsInt(right)) {
+			ld, lok := types.DecimalOf(left)
+			rd, rok := types.DecimalOf(right)
+			if lok && rok {
+				return ld, rd
 			}
-			return ln / rn, nil
-
-		case tokens.TokenLt:
-			return types.Compare(leftVal, rightVal, "<", b.Line, b.Column)
-		case tokens.TokenGt:
-			return types.Compare(leftVal, rightVal, ">", b.Line, b.Column)
-		case tokens.TokenLte:
-			return types.Compare(leftVal, rightVal, "<=", b.Line, b.Column)
-		case tokens.TokenGte:
-			return types.Compare(leftVal, rightVal, ">=", b.Line, b.Column)
-		case tokens.TokenEq:
-			return types.Equals(leftVal, rightVal), nil
-		case tokens.TokenNeq:
-			return !types.Equals(leftVal, rightVal), nil
+		}
+		if e.NumericPromotion() {
+			return types.PromoteNumbers(left, right)
 		}
 	}
-	return nil, errors.NewUnknownOperatorError("unknown binary operator", b.Line, b.Column)
+	return left, right
+}
+
+// overloadableSymbol spells op if custom types can implement it with
+// env.RegisterOperator.
+func overloadableSymbol(op tokens.TokenType) (string, bool) {
+	switch op {
+	case tokens.TokenEq:
+		return "==", true
+	case tokens.TokenNeq:
+		return "!=", true
+	case tokens.TokenLt:
+		return "<", true
+	case tokens.TokenLte:
+		return "<=", true
+	case tokens.TokenGt:
+		return ">", true
+	case tokens.TokenGte:
+		return ">=", true
+	case tokens.TokenPlus:
+		return "+", true
+	case tokens.TokenMinus:
+		return "-", true
+	case tokens.TokenMultiply:
+		return "*", true
+	case tokens.TokenDivide:
+		return "/", true
+	}
+	return "", false
+}
+
+var binaryOperators = map[tokens.TokenType]BinaryOperatorFunc{
+	tokens.TokenPlus:     arithmetic("+", func(l, r float64) float64 { return l + r }),
+	tokens.TokenMinus:    arithmetic("-", func(l, r float64) float64 { return l - r }),
+	tokens.TokenMultiply: arithmetic("*", func(l, r float64) float64 { return l * r }),
+	tokens.TokenDivide:   arithmetic("/", func(l, r float64) float64 { return l / r }),
+	tokens.TokenLt:       comparison("<"),
+	tokens.TokenGt:       comparison(">"),
+	tokens.TokenLte:      comparison("<="),
+	tokens.TokenGte:      comparison(">="),
+	tokens.TokenEq: func(left, right interface{}, line, column int, scope *env.Scope, e *env.Environment) (interface{}, error) {
+		return types.Equals(left, right), nil
+	},
+	tokens.TokenNeq: func(left, right interface{}, line, column int, scope *env.Scope, e *env.Environment) (interface{}, error) {
+		return !types.Equals(left, right), nil
+	},
+	tokens.TokenMatch:    match(tokens.TokenMatch),
+	tokens.TokenNotMatch: match(tokens.TokenNotMatch),
+}
+
+// arithmetic returns the operator applying apply to numeric operands of the
+// same kind; integer results are truncated back to integers.
+func arithmetic(symbol string, apply func(l, r float64) float64) BinaryOperatorFunc {
+	return func(left, right interface{}, line, column int, scope *env.Scope, e *env.Environment) (interface{}, error) {
+		ln, lok := types.ToFloat(left)
+		rn, rok := types.ToFloat(right)
+		if !lok || !rok {
+			return nil, errors.NewSemanticError(fmt.Sprintf("'%s' operator used on non‑numeric type", symbol), line, column)
+		}
+		if types.IsDecimal(left) || types.IsDecimal(right) {
+			return decimalArithmetic(symbol, left, right, line, column)
+		}
+		if symbol == "/" && rn == 0 {
+			return nil, errors.NewDivideByZeroError("division by zero", line, column)
+		}
+		if types.IsInt(left) != types.IsInt(right) {
+			return nil, errors.NewSemanticError("Mixed numeric types require explicit conversion", line, column)
+		}
+		if types.IsInt(left) {
+			return int64(apply(ln, rn)), nil
+		}
+		return apply(ln, rn), nil
+	}
+}
+
+// decimalArithmetic applies an arithmetic operator exactly to two numbers
+// of which at least one is a Decimal. Ints and floats combine with
+// decimals without explicit conversion, since no precision is lost.
+func decimalArithmetic(symbol string, left, right interface{}, line, column int) (interface{}, error) {
+	ld, lok := types.DecimalOf(left)
+	rd, rok := types.DecimalOf(right)
+	if !lok || !rok {
+		return nil, errors.NewSemanticError(fmt.Sprintf("'%s' operator used on a number that is not finite", symbol), line, column)
+	}
+	switch symbol {
+	case "+":
+		return ld.Add(rd), nil
+	case "-":
+		return ld.Sub(rd), nil
+	case "*":
+		return ld.Mul(rd), nil
+	}
+	if rd.Sign() == 0 {
+		return nil, errors.NewDivideByZeroError("division by zero", line, column)
+	}
+	return ld.Quo(rd), nil
+}
+
+func comparison(op string) BinaryOperatorFunc {
+	return func(left, right interface{}, line, column int, scope *env.Scope, e *env.Environment) (interface{}, error) {
+		return types.Compare(left, right, op, line, column)
+	}
+}
+
+func match(op tokens.TokenType) BinaryOperatorFunc {
+	opStr := tokens.FixedTokenLiterals[op]
+	return func(left, right interface{}, line, column int, scope *env.Scope, e *env.Environment) (interface{}, error) {
+		s, lok := left.(string)
+		pattern, rok := right.(string)
+		if !lok || !rok {
+			return nil, errors.NewSemanticError(fmt.Sprintf("'%s' operator requires string operands", opStr), line, column)
+		}
+		re, err := compileRegex(pattern, scope, e)
+		if err != nil {
+			return nil, errors.NewTypeError(fmt.Sprintf("'%s' operator: invalid pattern", opStr), line, column)
+		}
+		return re.MatchString(s) == (op == tokens.TokenMatch), nil
+	}
 }
 
 func (b *BinaryExpr) Pos() (int, int) {
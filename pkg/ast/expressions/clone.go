@@ -0,0 +1,29 @@
+package expressions
+
+import (
+	"github.com/SpecDrivenDesign/lql/pkg/ast"
+)
+
+func (l *LiteralExpr) CloneNode() ast.Expression {
+	c := *l
+	return &c
+}
+
+func (i *IdentifierExpr) CloneNode() ast.Expression {
+	c := *i
+	return &c
+}
+
+func (c *ContextExpr) CloneNode() ast.Expression {
+	cp := *c
+	if c.Ident != nil {
+		ident := *c.Ident
+		cp.Ident = &ident
+	}
+	return &cp
+}
+
+func (p *PlaceholderExpr) CloneNode() ast.Expression {
+	c := *p
+	return &c
+}
@@ -13,11 +13,50 @@ type ContextExpr struct {
 	Subscript ast.Expression
 	Line      int
 	Column    int
+	ast.Annotations
 }
 
 func (c *ContextExpr) Eval(ctx map[string]interface{}, env *env.Environment) (interface{}, error) {
+	return EvalIn(c, ctx, nil, env)
+}
+
+// evalIn is Eval in scope. Unlike other node types, c resolves the
+// ContextProvider it refers to.
+func (c *ContextExpr) evalIn(ctx map[string]interface{}, scope *env.Scope, env *env.Environment) (interface{}, error) {
+	scope, started := env.StartEvaluation(scope)
+	if started {
+		defer env.FinishEvaluation(scope)
+	}
+	scope, err := env.Descend(scope, c)
+	if err != nil {
+		return nil, annotate(c, err)
+	}
+	if err := env.Enter(scope, c); err != nil {
+		env.Ascend(scope)
+		return nil, annotate(c, err)
+	}
+	value, err := c.eval(ctx, scope, env)
+	if err == nil {
+		value, err = ResolveValue(value, c.Line, c.Column)
+	}
+	env.Ascend(scope)
+	value, err = env.Leave(scope, c, value, err)
+	if err != nil {
+		return nil, annotate(c, err)
+	}
+	return value, nil
+}
+
+// Lookup evaluates c in scope as the target of a member access. A
+// ContextProvider it refers to is returned unresolved, so that the access
+// resolves only the fields it reads.
+func (c *ContextExpr) Lookup(ctx map[string]interface{}, scope *env.Scope, env *env.Environment) (interface{}, error) {
+	return evalNode(c, ctx, scope, env)
+}
+
+func (c *ContextExpr) eval(ctx map[string]interface{}, scope *env.Scope, env *env.Environment) (interface{}, error) {
 	if c.Ident != nil {
-		if val, ok := ctx[c.Ident.Name]; ok {
+		if val, ok := scope.Lookup(ctx, c.Ident.Name); ok || env.Lenient {
 			return val, nil
 		}
 		return nil, errors.NewReferenceError(fmt.Sprintf("field '%s' not found", c.Ident.Name), c.Ident.Line, c.Ident.Column)
@@ -0,0 +1,87 @@
+package expressions
+
+import (
+	"fmt"
+	"github.com/SpecDrivenDesign/lql/pkg/ast"
+	"github.com/SpecDrivenDesign/lql/pkg/env"
+)
+
+// InfixOperatorFunc evaluates a custom infix operator on its evaluated operands.
+type InfixOperatorFunc func(left, right interface{}, line, column int) (interface{}, error)
+
+// PrefixOperatorFunc evaluates a custom prefix operator on its evaluated operand.
+type PrefixOperatorFunc func(operand interface{}, line, column int) (interface{}, error)
+
+// CustomInfixExpr represents an embedder-registered infix operator.
+type CustomInfixExpr struct {
+	Keyword    string
+	Precedence int
+	Left       ast.Expression
+	Right      ast.Expression
+	Fn         InfixOperatorFunc
+	Line       int
+	Column     int
+	ast.Annotations
+}
+
+func (c *CustomInfixExpr) Eval(ctx map[string]interface{}, env *env.Environment) (interface{}, error) {
+	return EvalIn(c, ctx, nil, env)
+}
+
+func (c *CustomInfixExpr) eval(ctx map[string]interface{}, scope *env.Scope, env *env.Environment) (interface{}, error) {
+	leftVal, err := EvalIn(c.Left, ctx, scope, env)
+	if err != nil {
+		return nil, err
+	}
+	rightVal, err := EvalIn(c.Right, ctx, scope, env)
+	if err != nil {
+		return nil, err
+	}
+	return c.Fn(leftVal, rightVal, c.Line, c.Column)
+}
+
+func (c *CustomInfixExpr) Pos() (int, int) {
+	return c.Line, c.Column
+}
+
+func (c *CustomInfixExpr) String() string {
+	opStr := c.Keyword
+	if ColorEnabled {
+		opStr = OperatorColor + opStr + ColorReset
+	}
+	return fmt.Sprintf("%s %s %s", c.Left.String(), opStr, c.Right.String())
+}
+
+// CustomPrefixExpr represents an embedder-registered prefix operator.
+type CustomPrefixExpr struct {
+	Keyword string
+	Expr    ast.Expression
+	Fn      PrefixOperatorFunc
+	Line    int
+	Column  int
+	ast.Annotations
+}
+
+func (c *CustomPrefixExpr) Eval(ctx map[string]interface{}, env *env.Environment) (interface{}, error) {
+	return EvalIn(c, ctx, nil, env)
+}
+
+func (c *CustomPrefixExpr) eval(ctx map[string]interface{}, scope *env.Scope, env *env.Environment) (interface{}, error) {
+	val, err := EvalIn(c.Expr, ctx, scope, env)
+	if err != nil {
+		return nil, err
+	}
+	return c.Fn(val, c.Line, c.Column)
+}
+
+func (c *CustomPrefixExpr) Pos() (int, int) {
+	return c.Line, c.Column
+}
+
+func (c *CustomPrefixExpr) String() string {
+	opStr := c.Keyword
+	if ColorEnabled {
+		opStr = OperatorColor + opStr + ColorReset
+	}
+	return fmt.Sprintf("%s %s", opStr, c.Expr.String())
+}
@@ -0,0 +1,57 @@
+package expressions
+
+import (
+	stdErrors "errors"
+	"fmt"
+	"github.com/SpecDrivenDesign/lql/pkg/ast"
+	"github.com/SpecDrivenDesign/lql/pkg/env"
+	"github.com/SpecDrivenDesign/lql/pkg/errors"
+)
+
+// DefaultExpr represents "x ?: fallback": the fallback is used when x refers
+// to a missing field or index, or evaluates to null.
+type DefaultExpr struct {
+	Expr     ast.Expression
+	Fallback ast.Expression
+	Line     int
+	Column   int
+	ast.Annotations
+}
+
+func (d *DefaultExpr) Eval(ctx map[string]interface{}, env *env.Environment) (interface{}, error) {
+	return EvalIn(d, ctx, nil, env)
+}
+
+func (d *DefaultExpr) eval(ctx map[string]interface{}, scope *env.Scope, env *env.Environment) (interface{}, error) {
+	val, err := EvalIn(d.Expr, ctx, scope, env)
+	if err != nil {
+		if !DefaultRecovers(err) {
+			return nil, err
+		}
+		val = nil
+	}
+	if val != nil {
+		return val, nil
+	}
+	return EvalIn(d.Fallback, ctx, scope, env)
+}
+
+// DefaultRecovers reports whether "?:" uses the fallback when its left
+// operand fails with err: a missing field or an index out of bounds.
+func DefaultRecovers(err error) bool {
+	var refErr *errors.ReferenceError
+	var boundsErr *errors.ArrayOutOfBoundsError
+	return stdErrors.As(err, &refErr) || stdErrors.As(err, &boundsErr)
+}
+
+func (d *DefaultExpr) Pos() (int, int) {
+	return d.Line, d.Column
+}
+
+func (d *DefaultExpr) String() string {
+	opStr := "?:"
+	if ColorEnabled {
+		opStr = OperatorColor + opStr + ColorReset
+	}
+	return fmt.Sprintf("%s %s %s", d.Expr.String(), opStr, d.Fallback.String())
+}
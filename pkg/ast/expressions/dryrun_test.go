@@ -0,0 +1,61 @@
+package expressions_test
+
+import (
+	"github.com/SpecDrivenDesign/lql/pkg/env"
+	"reflect"
+	"testing"
+)
+
+func TestDryRunRecordsSideEffects(t *testing.T) {
+	for name, eval := range evaluators {
+		c := &counter{}
+		e := env.NewEnvironment()
+		if err := e.RegisterLibrary("audit", c); err != nil {
+			t.Fatal(err)
+		}
+		e.MarkSideEffecting("audit")
+		dryRun := e.EnableDryRun(map[string]interface{}{"audit.next": int64(5)})
+
+		ctx := map[string]interface{}{"user": "ann"}
+		got, err := eval(parse(t, `audit.next($user) == 5 AND math.abs(-2) == 2 AND audit.log("x", 1) == null`), ctx, e)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if got != true {
+			t.Errorf("%s: got %v, want the stubbed results", name, got)
+		}
+		if c.calls != 0 {
+			t.Errorf("%s: the side-effecting library was called %d times", name, c.calls)
+		}
+		want := []env.CallDescriptor{
+			{Library: "audit", Function: "next", Args: []interface{}{"ann"}, Line: 1, Column: 1},
+			{Library: "audit", Function: "log", Args: []interface{}{"x", int64(1)}, Line: 1, Column: 50},
+		}
+		if calls := dryRun.Calls(); !reflect.DeepEqual(calls, want) {
+			t.Errorf("%s: recorded %+v, want %+v", name, calls, want)
+		}
+
+		e.DisableDryRun()
+		if got, err := eval(parse(t, `audit.next()`), ctx, e); err != nil || got != int64(1) || c.calls != 1 {
+			t.Errorf("%s: after the dry run: got %v, %v with %d calls", name, got, err, c.calls)
+		}
+	}
+}
+
+func TestDryRunOnlyInterceptsMarkedLibraries(t *testing.T) {
+	c := &counter{}
+	e := env.NewEnvironment()
+	if err := e.RegisterLibrary("audit", c); err != nil {
+		t.Fatal(err)
+	}
+	dryRun := e.EnableDryRun(nil)
+	for name, eval := range evaluators {
+		if _, err := eval(parse(t, `audit.next()`), nil, e); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+	if c.calls != len(evaluators) || len(dryRun.Calls()) != 0 {
+		t.Errorf("called %d times and recorded %v; want every call executed", c.calls, dryRun.Calls())
+	}
+}
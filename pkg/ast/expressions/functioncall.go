@@ -6,7 +6,9 @@ import (
 	"github.com/SpecDrivenDesign/lql/pkg/env"
 	"github.com/SpecDrivenDesign/lql/pkg/errors"
 	"github.com/SpecDrivenDesign/lql/pkg/param"
+	"github.com/SpecDrivenDesign/lql/pkg/types"
 	"strings"
+	"time"
 )
 
 // FunctionCallExpr represents a function call.
@@ -17,28 +19,158 @@ type FunctionCallExpr struct {
 	Column      int
 	ParenLine   int
 	ParenColumn int
+	ast.Annotations
 }
 
 func (f *FunctionCallExpr) Eval(ctx map[string]interface{}, env *env.Environment) (interface{}, error) {
+	return EvalIn(f, ctx, nil, env)
+}
+
+func (f *FunctionCallExpr) eval(ctx map[string]interface{}, scope *env.Scope, env *env.Environment) (interface{}, error) {
 	if len(f.Namespace) < 2 {
 		return nil, errors.NewParameterError("function call missing namespace", f.Line, f.Column)
 	}
 	libName := f.Namespace[0]
 	funcName := f.Namespace[1]
-	lib, ok := env.GetLibrary(libName)
-	if !ok {
-		return nil, errors.NewReferenceError(fmt.Sprintf("library '%s' not found", libName), f.Line, f.Column)
+	env.CountCall(scope, libName, funcName)
+	if err := env.CheckProfile(libName, funcName, f.Line, f.Column); err != nil {
+		return nil, err
+	}
+	if libName == "cache" && funcName == "memo" {
+		return Memo(env, f.lazyArgs(ctx, scope, env), f.Line, f.Column)
+	}
+	lib, err := LookupFunction(env, libName, funcName, f.Line, f.Column)
+	if err != nil {
+		return nil, err
+	}
+	if lazy, ok := LazyFunction(env, lib, libName, funcName); ok {
+		return CallLazy(env, scope, lazy, libName, funcName, f.lazyArgs(ctx, scope, env), f.Line, f.Column, f.ParenLine, f.ParenColumn)
+	}
+	values, err := evalAll(f.Args, ctx, scope, env)
+	if err != nil {
+		return nil, err
 	}
 	var args []param.Arg
-	for _, argExpr := range f.Args {
-		val, err := argExpr.Eval(ctx, env)
-		if err != nil {
-			return nil, err
-		}
+	for i, argExpr := range f.Args {
 		l, c := argExpr.Pos()
-		args = append(args, param.Arg{Value: val, Line: l, Column: c})
+		args = append(args, param.Arg{Value: values[i], Line: l, Column: c})
+	}
+	return Call(env, scope, lib, libName, funcName, args, f.Line, f.Column, f.ParenLine, f.ParenColumn)
+}
+
+// lazyArgs returns the arguments of the call, each evaluated only when the
+// function asks for it.
+func (f *FunctionCallExpr) lazyArgs(ctx map[string]interface{}, scope *env.Scope, env *env.Environment) []param.LazyArg {
+	args := make([]param.LazyArg, len(f.Args))
+	for i, argExpr := range f.Args {
+		argExpr := argExpr
+		l, c := argExpr.Pos()
+		args[i] = param.LazyArg{Line: l, Column: c, Eval: func() (interface{}, error) {
+			return EvalIn(argExpr, ctx, scope, env)
+		}, EvalWith: func(value interface{}) (interface{}, error) {
+			return EvalIn(argExpr, ctx, scope.WithVariable(itemVariable, value), env)
+		}}
+	}
+	return args
+}
+
+// LookupFunction returns the library providing libName.funcName in e. It
+// fails as a call at line and column does when the library does not exist
+// or the function requires a capability that is not granted.
+func LookupFunction(e *env.Environment, libName, funcName string, line, column int) (env.ILibrary, error) {
+	lib, ok := e.GetLibrary(libName)
+	if !ok {
+		return nil, errors.NewReferenceError(fmt.Sprintf("library '%s' not found", libName), line, column)
+	}
+	if capability, missing := e.MissingCapability(libName, funcName); missing {
+		return nil, errors.NewCapabilityError(fmt.Sprintf("%s.%s requires capability '%s'", libName, funcName, capability), line, column)
+	}
+	return lib, nil
+}
+
+// LazyFunction returns lib as a LazyLibrary if funcName takes lazy
+// arguments. A dry run that intercepts calls to the library evaluates them
+// eagerly, to record them.
+func LazyFunction(e *env.Environment, lib env.ILibrary, libName, funcName string) (env.LazyLibrary, bool) {
+	lazy, ok := lib.(env.LazyLibrary)
+	return lazy, ok && lazy.Lazy(funcName) && !e.InterceptsCall(libName)
+}
+
+// Call calls libName.funcName, provided by lib, with evaluated arguments in
+// scope. The call is recorded instead if a dry run intercepts it, and the
+// result is checked against the environment's limits.
+func Call(e *env.Environment, scope *env.Scope, lib env.ILibrary, libName, funcName string, args []param.Arg, line, column, parenLine, parenColumn int) (interface{}, error) {
+	result, err := e.HookCall(libName, funcName, args, line, column, func() (interface{}, error) {
+		if e.InterceptsCall(libName) {
+			return e.RecordCall(libName, funcName, args, line, column), nil
+		}
+		return e.MeteredLibrary(scope, lib).Call(funcName, args, line, column, parenLine, parenColumn)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := e.Produced(scope, result, line, column); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// CallLazy calls a function of a lazy library in scope, which evaluates
+// each argument only when it needs it, and checks the result against the
+// environment's limits.
+func CallLazy(e *env.Environment, scope *env.Scope, lib env.LazyLibrary, libName, funcName string, args []param.LazyArg, line, column, parenLine, parenColumn int) (interface{}, error) {
+	result, err := e.HookLazyCall(libName, funcName, line, column, func() (interface{}, error) {
+		return lib.CallLazy(funcName, args, line, column, parenLine, parenColumn)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := e.Produced(scope, result, line, column); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Memo implements cache.memo(key, expr, ttlMillis). Unlike a library
+// call, expr is only evaluated when the environment's cache has no live
+// result for key.
+func Memo(env *env.Environment, args []param.LazyArg, line, column int) (interface{}, error) {
+	if len(args) != 3 {
+		return nil, errors.NewParameterError("cache.memo requires 3 arguments", line, column)
+	}
+	keyVal, err := args[0].Eval()
+	if err != nil {
+		return nil, err
+	}
+	key, ok := keyVal.(string)
+	if !ok {
+		return nil, errors.NewTypeError("cache.memo: key must be a string", args[0].Line, args[0].Column)
+	}
+	ttlVal, err := args[2].Eval()
+	if err != nil {
+		return nil, err
+	}
+	l, c := args[2].Line, args[2].Column
+	if !types.IsInt(ttlVal) {
+		return nil, errors.NewTypeError("cache.memo: ttlMillis must be an integer", l, c)
+	}
+	ttl, _ := types.ToInt(ttlVal)
+	if ttl < 0 {
+		return nil, errors.NewFunctionCallError("cache.memo: ttlMillis must be non-negative", l, c)
+	}
+	if env.Cache != nil {
+		if val, ok := env.Cache.Get(key); ok {
+			return val, nil
+		}
+	}
+	val, err := args[1].Eval()
+	if err != nil {
+		return nil, err
+	}
+	if env.Cache != nil {
+		env.Cache.Set(key, val, time.Duration(ttl)*time.Millisecond)
 	}
-	return lib.Call(funcName, args, f.Line, f.Column, f.ParenLine, f.ParenColumn)
+	return val, nil
 }
 
 func (f *FunctionCallExpr) Pos() (int, int) {
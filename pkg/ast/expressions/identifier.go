@@ -2,18 +2,28 @@ package expressions
 
 import (
 	"fmt"
+	"github.com/SpecDrivenDesign/lql/pkg/ast"
 	"github.com/SpecDrivenDesign/lql/pkg/env"
 	"github.com/SpecDrivenDesign/lql/pkg/errors"
 )
 
-// IdentifierExpr represents an identifier.
+// IdentifierExpr represents an identifier: a variable bound by LET, or a
+// field name or object key.
 type IdentifierExpr struct {
 	Name   string
 	Line   int
 	Column int
+	ast.Annotations
 }
 
 func (i *IdentifierExpr) Eval(ctx map[string]interface{}, env *env.Environment) (interface{}, error) {
+	return EvalIn(i, ctx, nil, env)
+}
+
+func (i *IdentifierExpr) eval(ctx map[string]interface{}, scope *env.Scope, env *env.Environment) (interface{}, error) {
+	if val, ok := scope.Variable(i.Name); ok {
+		return val, nil
+	}
 	return nil, errors.NewUnknownIdentifierError(fmt.Sprintf("Bare identifier '%s' is not allowed", i.Name), i.Line, i.Column)
 }
 
@@ -0,0 +1,49 @@
+package expressions
+
+import (
+	"fmt"
+	"github.com/SpecDrivenDesign/lql/pkg/ast"
+	"github.com/SpecDrivenDesign/lql/pkg/env"
+)
+
+// LetExpr represents "LET name = value IN body": value is evaluated once
+// and body is evaluated with name bound to it. Inside body, name refers to
+// the value, shadowing any outer variable of the same name; the binding
+// ends with body.
+type LetExpr struct {
+	Name   string
+	Value  ast.Expression
+	Body   ast.Expression
+	Line   int
+	Column int
+	ast.Annotations
+}
+
+func (l *LetExpr) Eval(ctx map[string]interface{}, env *env.Environment) (interface{}, error) {
+	return EvalIn(l, ctx, nil, env)
+}
+
+func (l *LetExpr) eval(ctx map[string]interface{}, scope *env.Scope, env *env.Environment) (interface{}, error) {
+	val, err := EvalIn(l.Value, ctx, scope, env)
+	if err != nil {
+		return nil, err
+	}
+	return EvalIn(l.Body, ctx, scope.WithVariable(l.Name, val), env)
+}
+
+// itemVariable is env.ItemVariable, for methods whose environment parameter
+// shadows package env.
+const itemVariable = env.ItemVariable
+
+func (l *LetExpr) Pos() (int, int) {
+	return l.Line, l.Column
+}
+
+func (l *LetExpr) String() string {
+	letStr, inStr := "let", "in"
+	if ColorEnabled {
+		letStr = OperatorColor + letStr + ColorReset
+		inStr = OperatorColor + inStr + ColorReset
+	}
+	return fmt.Sprintf("%s %s = %s %s %s", letStr, l.Name, l.Value.String(), inStr, l.Body.String())
+}
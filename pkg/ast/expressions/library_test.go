@@ -0,0 +1,21 @@
+package expressions_test
+
+import (
+	"github.com/SpecDrivenDesign/lql/pkg/env"
+	"github.com/SpecDrivenDesign/lql/pkg/errors"
+	"strings"
+	"testing"
+)
+
+func TestCallToUnregisteredBuiltin(t *testing.T) {
+	for name, eval := range evaluators {
+		e, err := env.NewEnvironmentWith(env.WithoutLibraries("math"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = eval(parse(t, "math.abs(-1)"), map[string]interface{}{}, e)
+		if _, ok := err.(*errors.ReferenceError); !ok || !strings.Contains(err.Error(), "library 'math' not found") {
+			t.Errorf("%s: got %v, want a ReferenceError for the missing library", name, err)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package expressions
+
+import (
+	"fmt"
+	"github.com/SpecDrivenDesign/lql/pkg/ast"
+	"github.com/SpecDrivenDesign/lql/pkg/env"
+	"github.com/SpecDrivenDesign/lql/pkg/env/libraries"
+	"github.com/SpecDrivenDesign/lql/pkg/errors"
+	"regexp"
+	"strings"
+)
+
+// LikeExpr represents a SQL-style "x LIKE pattern" match, where '%' matches
+// any run of characters and '_' matches exactly one. A backslash makes the
+// character after it match literally, so "100\\%" matches "100%".
+type LikeExpr struct {
+	Subject ast.Expression
+	Pattern ast.Expression
+	Line    int
+	Column  int
+	ast.Annotations
+}
+
+func (l *LikeExpr) Eval(ctx map[string]interface{}, env *env.Environment) (interface{}, error) {
+	return EvalIn(l, ctx, nil, env)
+}
+
+func (l *LikeExpr) eval(ctx map[string]interface{}, scope *env.Scope, env *env.Environment) (interface{}, error) {
+	subjectVal, err := EvalIn(l.Subject, ctx, scope, env)
+	if err != nil {
+		return nil, err
+	}
+	patternVal, err := EvalIn(l.Pattern, ctx, scope, env)
+	if err != nil {
+		return nil, err
+	}
+	return MatchLike(subjectVal, patternVal, l.Line, l.Column, scope, env)
+}
+
+// MatchLike reports whether subject matches pattern, the evaluated operands
+// of a LIKE expression at line and column, evaluated in scope with e.
+func MatchLike(subject, pattern interface{}, line, column int, scope *env.Scope, e *env.Environment) (interface{}, error) {
+	s, sok := subject.(string)
+	p, pok := pattern.(string)
+	if !sok || !pok {
+		return nil, errors.NewSemanticError("LIKE operator requires string operands", line, column)
+	}
+	regex, err := LikePatternToRegex(p)
+	if err != nil {
+		return nil, errors.NewTypeError("LIKE operator: "+err.Error(), line, column)
+	}
+	re, err := compileRegex(regex, scope, e)
+	if err != nil {
+		return nil, errors.NewTypeError("LIKE operator: invalid pattern", line, column)
+	}
+	return re.MatchString(s), nil
+}
+
+func (l *LikeExpr) Pos() (int, int) {
+	return l.Line, l.Column
+}
+
+func (l *LikeExpr) String() string {
+	opStr := "like"
+	if ColorEnabled {
+		opStr = OperatorColor + opStr + ColorReset
+	}
+	return fmt.Sprintf("%s %s %s", l.Subject.String(), opStr, l.Pattern.String())
+}
+
+// LikePatternToRegex translates a LIKE pattern into an anchored regular
+// expression. All characters other than '%' and '_' match literally, as do
+// '%', '_' and '\\' escaped with a backslash. It fails if the pattern ends
+// with an unescaped backslash.
+func LikePatternToRegex(pattern string) (string, error) {
+	var sb strings.Builder
+	sb.WriteString("(?s)^")
+	escaped := false
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			sb.WriteString(regexp.QuoteMeta(string(r)))
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '%':
+			sb.WriteString(".*")
+		case r == '_':
+			sb.WriteString(".")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	if escaped {
+		return "", fmt.Errorf("pattern ends with an escape character")
+	}
+	sb.WriteString("$")
+	return sb.String(), nil
+}
+
+// compileRegex compiles pattern through the regex cache, counting the
+// compilation in the metrics of the evaluation of scope if it was not
+// cached.
+func compileRegex(pattern string, scope *env.Scope, e *env.Environment) (*regexp.Regexp, error) {
+	re, compiled, err := libraries.CompileCachedRegex(pattern)
+	if compiled {
+		e.CountRegexCompile(scope)
+	}
+	return re, err
+}
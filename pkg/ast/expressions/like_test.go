@@ -0,0 +1,41 @@
+package expressions_test
+
+import (
+	"github.com/SpecDrivenDesign/lql/pkg/env"
+	"github.com/SpecDrivenDesign/lql/pkg/errors"
+	"testing"
+)
+
+func TestLikeEscapes(t *testing.T) {
+	tests := []struct {
+		src  string
+		want bool
+	}{
+		{`"100%" LIKE "100\\%"`, true},
+		{`"1000" LIKE "100\\%"`, false},
+		{`"1000" LIKE "100%"`, true},
+		{`"a_c" LIKE "a\\_c"`, true},
+		{`"abc" LIKE "a\\_c"`, false},
+		{`"a\\b" LIKE "a\\\\b"`, true},
+		{`"a\\b" LIKE "a\\\\_"`, true},
+		{`"ab" LIKE "a\\b"`, true},
+		{`"50% off" LIKE "%\\%%"`, true},
+		{`"50 off" LIKE "%\\%%"`, false},
+	}
+	for _, tt := range tests {
+		got, err := parse(t, tt.src).Eval(map[string]interface{}{}, env.NewEnvironment())
+		if err != nil {
+			t.Fatalf("%s: %v", tt.src, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestLikeTrailingEscape(t *testing.T) {
+	_, err := parse(t, `"a\\" LIKE "a\\"`).Eval(map[string]interface{}{}, env.NewEnvironment())
+	if _, ok := err.(*errors.TypeError); !ok {
+		t.Fatalf("got %v, want a TypeError", err)
+	}
+}
@@ -2,6 +2,7 @@ package expressions
 
 import (
 	"fmt"
+	"github.com/SpecDrivenDesign/lql/pkg/ast"
 	"github.com/SpecDrivenDesign/lql/pkg/env"
 )
 
@@ -10,9 +11,14 @@ type LiteralExpr struct {
 	Value  interface{}
 	Line   int
 	Column int
+	ast.Annotations
 }
 
 func (l *LiteralExpr) Eval(ctx map[string]interface{}, env *env.Environment) (interface{}, error) {
+	return EvalIn(l, ctx, nil, env)
+}
+
+func (l *LiteralExpr) eval(ctx map[string]interface{}, scope *env.Scope, env *env.Environment) (interface{}, error) {
 	return l.Value, nil
 }
 
@@ -6,86 +6,244 @@ import (
 	"github.com/SpecDrivenDesign/lql/pkg/env"
 	"github.com/SpecDrivenDesign/lql/pkg/errors"
 	"github.com/SpecDrivenDesign/lql/pkg/types"
+	"sort"
 	"strings"
 )
 
 // MemberPart represents a part of a member access (either dot or bracket).
+// A wildcard part ("[*]") projects the remaining parts over every element
+// of an array; a recursive part ("..key") collects every value stored under
+// Key at any depth.
 type MemberPart struct {
-	Optional bool
-	IsIndex  bool
-	Key      string
-	Expr     ast.Expression
-	Line     int
-	Column   int
+	Optional  bool
+	IsIndex   bool
+	Wildcard  bool
+	Recursive bool
+	Key       string
+	Expr      ast.Expression
+	Line      int
+	Column    int
 }
 
 // MemberAccessExpr represents member access (dot or bracket notation).
 type MemberAccessExpr struct {
 	Target      ast.Expression
 	AccessParts []MemberPart
+	ast.Annotations
 }
 
 func (m *MemberAccessExpr) Eval(ctx map[string]interface{}, env *env.Environment) (interface{}, error) {
-	val, err := m.Target.Eval(ctx, env)
+	return EvalIn(m, ctx, nil, env)
+}
+
+func (m *MemberAccessExpr) eval(ctx map[string]interface{}, scope *env.Scope, env *env.Environment) (interface{}, error) {
+	var val interface{}
+	var err error
+	if target, ok := m.Target.(*ContextExpr); ok {
+		val, err = target.Lookup(ctx, scope, env)
+	} else {
+		val, err = EvalIn(m.Target, ctx, scope, env)
+	}
 	if err != nil {
 		return nil, err
 	}
-	for _, part := range m.AccessParts {
-		if val == nil && part.Optional {
+	return m.Access(val, ctx, scope, env)
+}
+
+// Access applies the access parts to val, an evaluated target, as Eval
+// does after evaluating Target in scope.
+func (m *MemberAccessExpr) Access(val interface{}, ctx map[string]interface{}, scope *env.Scope, env *env.Environment) (interface{}, error) {
+	return m.evalParts(val, m.AccessParts, ctx, scope, env, env.Lenient)
+}
+
+// evalParts applies access parts to val. When lenient is set (inside an
+// optional wildcard projection, or in a lenient environment) every part
+// behaves as if optional.
+func (m *MemberAccessExpr) evalParts(val interface{}, parts []MemberPart, ctx map[string]interface{}, scope *env.Scope, env *env.Environment, lenient bool) (interface{}, error) {
+	for i := 0; i < len(parts); i++ {
+		part := parts[i]
+		optional := part.Optional || lenient
+		if val == nil && optional {
 			return nil, nil
 		}
-		if part.IsIndex {
-			indexVal, err := part.Expr.Eval(ctx, env)
-			if err != nil {
+		if part.Wildcard || part.Recursive {
+			var err error
+			if val, err = ResolveValue(val, part.Line, part.Column); err != nil {
 				return nil, err
 			}
-			if obj, ok := types.ConvertToStringMap(val); ok {
-				var key string
-				switch v := indexVal.(type) {
-				case string:
-					key = v
-				default:
-					key = fmt.Sprintf("%v", v)
-				}
-				if v, exists := obj[key]; exists {
-					val = v
+		}
+		if part.Wildcard {
+			arr, ok := types.ConvertToInterfaceSlice(val)
+			if !ok {
+				return nil, errors.NewTypeError("wildcard projection on non‑array", part.Line, part.Column)
+			}
+			results := make([]interface{}, 0, len(arr))
+			for _, elem := range arr {
+				var v interface{}
+				var err error
+				if i+1 < len(parts) {
+					v, err = m.evalParts(elem, parts[i+1:], ctx, scope, env, optional)
 				} else {
-					if part.Optional {
-						return nil, nil
-					}
-					return nil, errors.NewReferenceError(fmt.Sprintf("field '%s' not found", key), part.Line, part.Column)
-				}
-			} else if arr, ok := types.ConvertToInterfaceSlice(val); ok {
-				idx, ok := types.ToInt(indexVal)
-				if !ok {
-					return nil, errors.NewTypeError("array index must be numeric", part.Line, part.Column)
+					v, err = ResolveValue(elem, part.Line, part.Column)
 				}
-				if idx < 0 || idx >= int64(len(arr)) {
-					if part.Optional {
-						return nil, nil
-					}
-					return nil, errors.NewArrayOutOfBoundsError("array index out of bounds", part.Line, part.Column)
+				if err != nil {
+					return nil, err
 				}
-				val = arr[idx]
-			} else {
-				return nil, errors.NewTypeError("target is not an object or array", part.Line, part.Column)
+				results = append(results, v)
+			}
+			if err := env.Produced(scope, results, part.Line, part.Column); err != nil {
+				return nil, err
+			}
+			return results, nil
+		}
+		if part.Recursive {
+			results := RecursiveDescent(val, part.Key)
+			if err := env.Produced(scope, results, part.Line, part.Column); err != nil {
+				return nil, err
+			}
+			val = results
+			continue
+		}
+		var found bool
+		if part.IsIndex {
+			indexVal, err := EvalIn(part.Expr, ctx, scope, env)
+			if err != nil {
+				return nil, err
+			}
+			if val, found, err = AccessIndex(val, indexVal, optional, part.Line, part.Column); err != nil {
+				return nil, err
+			}
+		} else if p, ok := provider(val); ok && !part.Optional {
+			// Consecutive field names are resolved together.
+			path := []string{part.Key}
+			for i+1 < len(parts) && plainField(parts[i+1]) {
+				i++
+				path = append(path, parts[i].Key)
+			}
+			var err error
+			if val, found, err = ResolvePath(p, path, optional, part.Line, part.Column); err != nil {
+				return nil, err
 			}
 		} else {
-			obj, ok := types.ConvertToStringMap(val)
-			if !ok {
-				return nil, errors.NewTypeError("dot access on non‑object", part.Line, part.Column)
+			var err error
+			if val, found, err = AccessField(val, part.Key, optional, part.Line, part.Column); err != nil {
+				return nil, err
 			}
-			if v, exists := obj[part.Key]; exists {
-				val = v
-			} else {
-				if part.Optional {
-					return nil, nil
-				}
-				return nil, errors.NewReferenceError(fmt.Sprintf("field '%s' not found", part.Key), part.Line, part.Column)
+		}
+		if !found {
+			return nil, nil
+		}
+	}
+	if len(parts) == 0 {
+		return val, nil
+	}
+	last := parts[len(parts)-1]
+	return ResolveValue(val, last.Line, last.Column)
+}
+
+// plainField reports whether part is a non-optional dot access.
+func plainField(part MemberPart) bool {
+	return !part.Optional && !part.IsIndex && !part.Wildcard && !part.Recursive
+}
+
+// AccessField applies a dot access part for key to val. found is false,
+// with a nil error, when the field is missing and the part is optional.
+func AccessField(val interface{}, key string, optional bool, line, column int) (value interface{}, found bool, err error) {
+	obj, ok := val.(map[string]interface{})
+	if !ok {
+		if p, isProvider := val.(env.ContextProvider); isProvider {
+			return ResolvePath(p, []string{key}, optional, line, column)
+		}
+		// Struct fields are read alone rather than converting the struct.
+		if v, exists, isStruct := types.LookupField(val, key); isStruct {
+			if exists {
+				return v, true, nil
 			}
+		} else if obj, ok = types.ConvertToStringMap(val); !ok {
+			return nil, false, errors.NewTypeError("dot access on non‑object", line, column)
+		}
+	}
+	if v, exists := obj[key]; exists {
+		return v, true, nil
+	}
+	if optional {
+		return nil, false, nil
+	}
+	return nil, false, errors.NewReferenceError(fmt.Sprintf("field '%s' not found", key), line, column)
+}
+
+// AccessIndex applies a bracket access part with the evaluated index to val.
+// found is false, with a nil error, when the field or element is missing and
+// the part is optional.
+func AccessIndex(val, index interface{}, optional bool, line, column int) (value interface{}, found bool, err error) {
+	if p, ok := val.(env.ContextProvider); ok {
+		if key, isKey := index.(string); isKey {
+			return ResolvePath(p, []string{key}, optional, line, column)
+		}
+		if val, err = ResolveValue(val, line, column); err != nil {
+			return nil, false, err
+		}
+	}
+	if obj, ok := types.ConvertToStringMap(val); ok {
+		var key string
+		switch v := index.(type) {
+		case string:
+			key = v
+		default:
+			key = fmt.Sprintf("%v", v)
+		}
+		if v, exists := obj[key]; exists {
+			return v, true, nil
+		}
+		if optional {
+			return nil, false, nil
+		}
+		return nil, false, errors.NewReferenceError(fmt.Sprintf("field '%s' not found", key), line, column)
+	}
+	if arr, ok := types.ConvertToInterfaceSlice(val); ok {
+		idx, ok := types.ToInt(index)
+		if !ok {
+			return nil, false, errors.NewTypeError("array index must be numeric", line, column)
+		}
+		if idx < 0 || idx >= int64(len(arr)) {
+			if optional {
+				return nil, false, nil
+			}
+			return nil, false, errors.NewArrayOutOfBoundsError("array index out of bounds", line, column)
+		}
+		return arr[idx], true, nil
+	}
+	return nil, false, errors.NewTypeError("target is not an object or array", line, column)
+}
+
+// RecursiveDescent returns every value stored under key within val, as a
+// recursive part ("..key") does.
+func RecursiveDescent(val interface{}, key string) []interface{} {
+	results := []interface{}{}
+	collectRecursive(val, key, &results)
+	return results
+}
+
+// collectRecursive appends every value stored under key within val,
+// visiting nested objects (in key order) and arrays depth-first.
+func collectRecursive(val interface{}, key string, results *[]interface{}) {
+	if obj, ok := types.ConvertToStringMap(val); ok {
+		if v, exists := obj[key]; exists {
+			*results = append(*results, v)
+		}
+		keys := make([]string, 0, len(obj))
+		for k := range obj {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			collectRecursive(obj[k], key, results)
+		}
+	} else if arr, ok := types.ConvertToInterfaceSlice(val); ok {
+		for _, elem := range arr {
+			collectRecursive(elem, key, results)
 		}
 	}
-	return val, nil
 }
 
 func (m *MemberAccessExpr) Pos() (int, int) {
@@ -109,7 +267,19 @@ func (m *MemberAccessExpr) String() string {
 		}
 
 		// Bracket vs. dot notation
-		if part.IsIndex {
+		if part.Recursive {
+			dots := ".."
+			if ColorEnabled {
+				dots = PunctuationColor + ".." + ColorReset
+			}
+			sb.WriteString(dots)
+
+			keyStr := part.Key
+			if ColorEnabled {
+				keyStr = ContextColor + keyStr + ColorReset
+			}
+			sb.WriteString(keyStr)
+		} else if part.IsIndex {
 			// Build something like "[expr]" or "[0]" (colored if enabled)
 			openBracket := "["
 			closeBracket := "]"
@@ -120,7 +290,9 @@ func (m *MemberAccessExpr) String() string {
 			}
 			sb.WriteString(openBracket)
 
-			if part.Expr != nil {
+			if part.Wildcard {
+				sb.WriteString("*")
+			} else if part.Expr != nil {
 				sb.WriteString(part.Expr.String())
 			}
 			sb.WriteString(closeBracket)
@@ -0,0 +1,89 @@
+package expressions_test
+
+import (
+	stdErrors "errors"
+	"github.com/SpecDrivenDesign/lql/pkg/ast"
+	"github.com/SpecDrivenDesign/lql/pkg/ast/expressions"
+	"github.com/SpecDrivenDesign/lql/pkg/build"
+	"github.com/SpecDrivenDesign/lql/pkg/env"
+	"github.com/SpecDrivenDesign/lql/pkg/errors"
+	"reflect"
+	"testing"
+)
+
+func TestEvaluationErrorsCarryMetadata(t *testing.T) {
+	all := map[string]func(ast.Expression, map[string]interface{}, *env.Environment) (interface{}, error){
+		"scoped": func(expr ast.Expression, ctx map[string]interface{}, e *env.Environment) (interface{}, error) {
+			return expressions.EvalIn(expr, ctx, env.NewScope(nil), e)
+		},
+	}
+	for name, eval := range evaluators {
+		all[name] = eval
+	}
+	tests := []struct {
+		ctx  map[string]interface{}
+		want ast.Metadata
+	}{
+		// The failing node is inside the annotated operand.
+		{map[string]interface{}{"a": int64(2)}, ast.Metadata{"rule": "r1", "owner": "ops"}},
+		// Only the root's metadata applies outside it.
+		{map[string]interface{}{}, ast.Metadata{"rule": "r1"}},
+	}
+	for name, eval := range all {
+		for _, tt := range tests {
+			expr := parse(t, `$a > 1 AND $missing.x == 2`)
+			ast.Annotate(expr, "rule", "r1")
+			ast.Annotate(expr.(*expressions.BinaryExpr).Right, "owner", "ops")
+			_, err := eval(expr, tt.ctx, env.NewEnvironment())
+			var annotated *errors.AnnotatedError
+			if !stdErrors.As(err, &annotated) {
+				t.Fatalf("%s: error %v is not annotated", name, err)
+			}
+			if !reflect.DeepEqual(map[string]interface{}(annotated.Metadata), map[string]interface{}(tt.want)) {
+				t.Errorf("%s: metadata %v, want %v", name, annotated.Metadata, tt.want)
+			}
+			var refErr *errors.ReferenceError
+			if !stdErrors.As(err, &refErr) {
+				t.Errorf("%s: %v does not wrap a ReferenceError", name, err)
+			}
+		}
+	}
+}
+
+func TestCombinedRulesKeepTheirMetadata(t *testing.T) {
+	tests := []struct {
+		ctx  map[string]interface{}
+		want string
+	}{
+		{map[string]interface{}{"b": int64(5)}, "tenant-1"},
+		{map[string]interface{}{"a": int64(0)}, "tenant-2"},
+	}
+	for name, eval := range evaluators {
+		for _, tt := range tests {
+			// Both rules are parsed on their own, so their nodes share
+			// positions.
+			r1, r2 := parse(t, `$a > 1`), parse(t, `$b > 1`)
+			ast.Annotate(r1, "rule", "tenant-1")
+			ast.Annotate(r2, "rule", "tenant-2")
+			expr, err := build.Or(r1, r2).Build()
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = eval(expr, tt.ctx, env.NewEnvironment())
+			var annotated *errors.AnnotatedError
+			if !stdErrors.As(err, &annotated) {
+				t.Fatalf("%s: error %v is not annotated", name, err)
+			}
+			if got := annotated.Metadata["rule"]; got != tt.want {
+				t.Errorf("%s: %v: rule %v, want %s", name, err, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestErrorsWithoutMetadataAreUnchanged(t *testing.T) {
+	_, err := parse(t, `$missing`).Eval(map[string]interface{}{}, env.NewEnvironment())
+	if _, ok := err.(*errors.ReferenceError); !ok {
+		t.Errorf("got %T, want *errors.ReferenceError", err)
+	}
+}
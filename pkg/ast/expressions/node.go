@@ -0,0 +1,61 @@
+package expressions
+
+import (
+	"github.com/SpecDrivenDesign/lql/pkg/ast"
+	"github.com/SpecDrivenDesign/lql/pkg/env"
+)
+
+// evaluator is a node type whose Eval method is evalNode around its eval
+// method.
+type evaluator interface {
+	env.Node
+	eval(ctx map[string]interface{}, scope *env.Scope, env *env.Environment) (interface{}, error)
+}
+
+// evalNode evaluates n against ctx in scope as the Eval methods of node
+// types do: it counts n against the environment's limits and in its
+// metrics, and notifies the observer, around n.eval. An error unwinding out
+// of n is annotated with n's metadata. An evaluation starts at n unless
+// scope is already part of one.
+func evalNode(n evaluator, ctx map[string]interface{}, scope *env.Scope, e *env.Environment) (interface{}, error) {
+	scope, started := e.StartEvaluation(scope)
+	if started {
+		defer e.FinishEvaluation(scope)
+	}
+	scope, err := e.Descend(scope, n)
+	if err != nil {
+		return nil, annotate(n, err)
+	}
+	if err := e.Enter(scope, n); err != nil {
+		e.Ascend(scope)
+		return nil, annotate(n, err)
+	}
+	value, err := n.eval(ctx, scope, e)
+	e.Ascend(scope)
+	value, err = e.Leave(scope, n, value, err)
+	if err != nil {
+		return nil, annotate(n, err)
+	}
+	return value, nil
+}
+
+// EvalIn evaluates expr against ctx in scope, which holds the roots the
+// evaluation reads and the variables bound around expr. Eval is EvalIn with
+// a nil scope.
+func EvalIn(expr ast.Expression, ctx map[string]interface{}, scope *env.Scope, e *env.Environment) (interface{}, error) {
+	switch n := expr.(type) {
+	case *ContextExpr:
+		return n.evalIn(ctx, scope, e)
+	case evaluator:
+		return evalNode(n, ctx, scope, e)
+	}
+	return expr.Eval(ctx, e)
+}
+
+// annotate attaches the metadata of n to err, an error unwinding out of it.
+func annotate(n env.Node, err error) error {
+	if a, ok := n.(ast.Annotated); ok {
+		return ast.WithMetadata(err, a.Metadata())
+	}
+	return err
+}
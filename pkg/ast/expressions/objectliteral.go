@@ -1,27 +1,63 @@
 package expressions
 
 import (
+	"fmt"
 	"github.com/SpecDrivenDesign/lql/pkg/ast"
 	"github.com/SpecDrivenDesign/lql/pkg/env"
+	"github.com/SpecDrivenDesign/lql/pkg/errors"
 	"strings"
 )
 
-// ObjectLiteralExpr represents an object literal.
+// ObjectField is one field of an object literal. Static fields have a
+// literal Key; computed fields ({ [$name]: $value }) have a KeyExpr that is
+// evaluated at runtime instead.
+type ObjectField struct {
+	Key     string
+	KeyExpr ast.Expression
+	Value   ast.Expression
+	Line    int
+	Column  int
+}
+
+// ObjectLiteralExpr represents an object literal. Fields are kept in the
+// order they were written.
 type ObjectLiteralExpr struct {
-	Fields map[string]ast.Expression
+	Fields []ObjectField
 	Line   int
 	Column int
+	ast.Annotations
 }
 
 func (o *ObjectLiteralExpr) Eval(ctx map[string]interface{}, env *env.Environment) (interface{}, error) {
-	result := make(map[string]interface{})
-	for key, expr := range o.Fields {
-		val, err := expr.Eval(ctx, env)
+	return EvalIn(o, ctx, nil, env)
+}
+
+func (o *ObjectLiteralExpr) eval(ctx map[string]interface{}, scope *env.Scope, env *env.Environment) (interface{}, error) {
+	result := make(map[string]interface{}, len(o.Fields))
+	for _, field := range o.Fields {
+		key := field.Key
+		if field.KeyExpr != nil {
+			keyVal, err := EvalIn(field.KeyExpr, ctx, scope, env)
+			if err != nil {
+				return nil, err
+			}
+			var ok bool
+			if key, ok = keyVal.(string); !ok {
+				return nil, errors.NewTypeError("computed object key must be a string", field.Line, field.Column)
+			}
+		}
+		if _, exists := result[key]; exists {
+			return nil, errors.NewSemanticError(fmt.Sprintf("Duplicate key '%s' detected", key), field.Line, field.Column)
+		}
+		val, err := EvalIn(field.Value, ctx, scope, env)
 		if err != nil {
 			return nil, err
 		}
 		result[key] = val
 	}
+	if err := env.Produced(scope, result, o.Line, o.Column); err != nil {
+		return nil, err
+	}
 	return result, nil
 }
 
@@ -47,29 +83,36 @@ func (o *ObjectLiteralExpr) String() string {
 
 	sb.WriteString(openBrace)
 
-	i := 0
-	for key, expr := range o.Fields {
+	openBracket := "["
+	closeBracket := "]"
+	if ColorEnabled {
+		openBracket = PunctuationColor + "[" + ColorReset
+		closeBracket = PunctuationColor + "]" + ColorReset
+	}
+
+	for i, field := range o.Fields {
 		// Insert commas between fields
 		if i > 0 {
 			sb.WriteString(comma)
 		}
 
-		// Decide how to print the key: If it's a valid identifier or not.
-		// For simplicity, always quote the key here. You could do a check if you want.
-		quotedKey := `"` + key + `"`
-		if ColorEnabled {
-			// Color the key as an identifier or as a string—your choice.
-			// We'll treat it like a string literal for consistency.
-			quotedKey = StringColor + quotedKey + ColorReset
+		if field.KeyExpr != nil {
+			sb.WriteString(openBracket)
+			sb.WriteString(field.KeyExpr.String())
+			sb.WriteString(closeBracket)
+		} else {
+			// Always quote static keys.
+			quotedKey := `"` + field.Key + `"`
+			if ColorEnabled {
+				// We'll treat it like a string literal for consistency.
+				quotedKey = StringColor + quotedKey + ColorReset
+			}
+			sb.WriteString(quotedKey)
 		}
-
-		sb.WriteString(quotedKey)
 		sb.WriteString(colon)
 
 		// The expression value
-		sb.WriteString(expr.String())
-
-		i++
+		sb.WriteString(field.Value.String())
 	}
 
 	sb.WriteString(closeBrace)
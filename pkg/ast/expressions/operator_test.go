@@ -0,0 +1,126 @@
+package expressions_test
+
+import (
+	"fmt"
+	"github.com/SpecDrivenDesign/lql/pkg/env"
+	"github.com/SpecDrivenDesign/lql/pkg/errors"
+	"strings"
+	"testing"
+)
+
+// money is a host type placed in contexts, with operators registered for
+// it.
+type money struct {
+	cents    int64
+	currency string
+}
+
+// moneyOperands returns the operands of an operator registered for money,
+// failing if either is of another type or currency.
+func moneyOperands(op string, left, right interface{}, line, column int) (money, money, error) {
+	l, lok := left.(money)
+	r, rok := right.(money)
+	if !lok || !rok {
+		return money{}, money{}, errors.NewTypeError(fmt.Sprintf("'%s' needs two amounts, got %T and %T", op, left, right), line, column)
+	}
+	if l.currency != r.currency {
+		return money{}, money{}, errors.NewTypeError(fmt.Sprintf("'%s' on %s and %s", op, l.currency, r.currency), line, column)
+	}
+	return l, r, nil
+}
+
+func moneyEnvironment(t *testing.T) *env.Environment {
+	t.Helper()
+	e := env.NewEnvironment()
+	ops := map[string]env.OperatorFunc{
+		"+": func(left, right interface{}, line, column int) (interface{}, error) {
+			l, r, err := moneyOperands("+", left, right, line, column)
+			if err != nil {
+				return nil, err
+			}
+			return money{l.cents + r.cents, l.currency}, nil
+		},
+		"<": func(left, right interface{}, line, column int) (interface{}, error) {
+			l, r, err := moneyOperands("<", left, right, line, column)
+			if err != nil {
+				return nil, err
+			}
+			return l.cents < r.cents, nil
+		},
+		"==": func(left, right interface{}, line, column int) (interface{}, error) {
+			l, r, err := moneyOperands("==", left, right, line, column)
+			if err != nil {
+				return nil, err
+			}
+			return l == r, nil
+		},
+	}
+	for op, fn := range ops {
+		if err := e.RegisterOperator(money{}, op, fn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return e
+}
+
+func TestOperatorsOnHostTypes(t *testing.T) {
+	ctx := map[string]interface{}{
+		"price": money{1500, "EUR"},
+		"fee":   money{250, "EUR"},
+		"total": money{1750, "EUR"},
+	}
+	tests := []struct {
+		src  string
+		want interface{}
+	}{
+		{"$price + $fee", money{1750, "EUR"}},
+		{"$price + $fee == $total", true},
+		{"$price != $fee", true},
+		{"$fee < $price", true},
+		{"$fee > $price", false},
+		{"$price <= $price", true},
+		{"$price >= $total", false},
+		{"$fee BETWEEN $fee AND $total", true},
+	}
+	for name, eval := range evaluators {
+		for _, tt := range tests {
+			got, err := eval(parse(t, tt.src), ctx, moneyEnvironment(t))
+			if err != nil {
+				t.Errorf("%s: %s: %v", name, tt.src, err)
+				continue
+			}
+			if got != tt.want {
+				t.Errorf("%s: %s = %v, want %v", name, tt.src, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestOperatorsOnHostTypesFail(t *testing.T) {
+	ctx := map[string]interface{}{
+		"price": money{1500, "EUR"},
+		"usd":   money{1500, "USD"},
+	}
+	tests := []struct {
+		src  string
+		want string
+	}{
+		// The registered operator rejects operands it cannot combine.
+		{"$price + 1", "'+' needs two amounts, got expressions_test.money and int64"},
+		{`"a" < $price`, "'<' needs two amounts, got string and expressions_test.money"},
+		{"$price < $usd", "'<' on EUR and USD"},
+		{"$price == $usd", "'==' on EUR and USD"},
+		// Operators that are neither registered nor derived fall back to
+		// the built-in ones, which reject the type.
+		{"$price * 2", "SemanticError"},
+		{"$price - $price", "SemanticError"},
+	}
+	for name, eval := range evaluators {
+		for _, tt := range tests {
+			_, err := eval(parse(t, tt.src), ctx, moneyEnvironment(t))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("%s: %s: got error %v, want %q", name, tt.src, err, tt.want)
+			}
+		}
+	}
+}
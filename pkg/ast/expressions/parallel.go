@@ -0,0 +1,67 @@
+package expressions
+
+import (
+	"github.com/SpecDrivenDesign/lql/pkg/ast"
+	"github.com/SpecDrivenDesign/lql/pkg/env"
+)
+
+// evalAll evaluates exprs against ctx in scope and returns their values in
+// order.
+// When the environment allows it, the expressions that call functions are
+// evaluated concurrently; the others are cheap enough to evaluate on the
+// calling goroutine. Either way the error returned is that of the first
+// expression to fail, in order.
+func evalAll(exprs []ast.Expression, ctx map[string]interface{}, scope *env.Scope, e *env.Environment) ([]interface{}, error) {
+	values := make([]interface{}, len(exprs))
+	errs := make([]error, len(exprs))
+	concurrent := make([]bool, len(exprs))
+	var tasks []func()
+	if e.Parallel() {
+		for i, expr := range exprs {
+			if callsFunction(expr) {
+				concurrent[i] = true
+				branch := scope.Branch()
+				tasks = append(tasks, func() {
+					values[i], errs[i] = EvalIn(expr, ctx, branch, e)
+				})
+			}
+		}
+	}
+	if len(tasks) < 2 {
+		for i, expr := range exprs {
+			val, err := EvalIn(expr, ctx, scope, e)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = val
+		}
+		return values, nil
+	}
+	e.RunParallel(tasks)
+	for i, expr := range exprs {
+		if concurrent[i] {
+			if errs[i] != nil {
+				return nil, errs[i]
+			}
+			continue
+		}
+		val, err := EvalIn(expr, ctx, scope, e)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = val
+	}
+	return values, nil
+}
+
+// callsFunction reports whether expr contains a function call.
+func callsFunction(expr ast.Expression) bool {
+	found := false
+	ast.Inspect(expr, func(node ast.Expression) bool {
+		if _, ok := node.(*FunctionCallExpr); ok {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
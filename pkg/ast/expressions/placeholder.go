@@ -0,0 +1,36 @@
+package expressions
+
+import (
+	"fmt"
+	"github.com/SpecDrivenDesign/lql/pkg/ast"
+	"github.com/SpecDrivenDesign/lql/pkg/env"
+	"github.com/SpecDrivenDesign/lql/pkg/errors"
+)
+
+// PlaceholderExpr represents a named placeholder such as :minAge, which is
+// replaced by a literal before evaluation.
+type PlaceholderExpr struct {
+	Name   string
+	Line   int
+	Column int
+	ast.Annotations
+}
+
+func (p *PlaceholderExpr) Eval(ctx map[string]interface{}, env *env.Environment) (interface{}, error) {
+	return EvalIn(p, ctx, nil, env)
+}
+
+func (p *PlaceholderExpr) eval(ctx map[string]interface{}, scope *env.Scope, env *env.Environment) (interface{}, error) {
+	return nil, errors.NewReferenceError(fmt.Sprintf("Placeholder ':%s' is not bound", p.Name), p.Line, p.Column)
+}
+
+func (p *PlaceholderExpr) Pos() (int, int) {
+	return p.Line, p.Column
+}
+
+func (p *PlaceholderExpr) String() string {
+	if ColorEnabled {
+		return IdentifierColor + ":" + p.Name + ColorReset
+	}
+	return ":" + p.Name
+}
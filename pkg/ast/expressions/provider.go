@@ -0,0 +1,51 @@
+package expressions
+
+import (
+	"fmt"
+	"github.com/SpecDrivenDesign/lql/pkg/env"
+	"github.com/SpecDrivenDesign/lql/pkg/errors"
+	"strings"
+)
+
+// provider returns val as a ContextProvider if it is one.
+func provider(val interface{}) (env.ContextProvider, bool) {
+	p, ok := val.(env.ContextProvider)
+	return p, ok
+}
+
+// ResolveValue returns val, or the whole value of val if it is a
+// ContextProvider. Providers are resolved this way when an expression uses
+// one as a value rather than reading its fields.
+func ResolveValue(val interface{}, line, column int) (interface{}, error) {
+	for {
+		p, ok := val.(env.ContextProvider)
+		if !ok {
+			return val, nil
+		}
+		v, found, err := p.Resolve(nil)
+		if err != nil {
+			return nil, errors.NewContextError(fmt.Sprintf("resolving value: %v", err), err, line, column)
+		}
+		if !found {
+			return nil, nil
+		}
+		val = v
+	}
+}
+
+// ResolvePath resolves path below p, as consecutive dot access parts do.
+// found is false, with a nil error, when the path does not exist and the
+// access is optional.
+func ResolvePath(p env.ContextProvider, path []string, optional bool, line, column int) (value interface{}, found bool, err error) {
+	v, found, err := p.Resolve(path)
+	if err != nil {
+		return nil, false, errors.NewContextError(fmt.Sprintf("resolving '%s': %v", strings.Join(path, "."), err), err, line, column)
+	}
+	if found {
+		return v, true, nil
+	}
+	if optional {
+		return nil, false, nil
+	}
+	return nil, false, errors.NewReferenceError(fmt.Sprintf("field '%s' not found", strings.Join(path, ".")), line, column)
+}
@@ -0,0 +1,132 @@
+package expressions_test
+
+import (
+	stdErrors "errors"
+	"github.com/SpecDrivenDesign/lql/pkg/env"
+	"github.com/SpecDrivenDesign/lql/pkg/errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// profiles is a provider over a fixed tree that records every path it is
+// asked to resolve, and fails for paths below "broken".
+type profiles struct {
+	data     map[string]interface{}
+	resolved []string
+}
+
+var errUnavailable = stdErrors.New("profile service unavailable")
+
+func (p *profiles) Resolve(path []string) (interface{}, bool, error) {
+	p.resolved = append(p.resolved, strings.Join(path, "."))
+	if len(path) > 0 && path[0] == "broken" {
+		return nil, false, errUnavailable
+	}
+	var v interface{} = p.data
+	for _, key := range path {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, false, nil
+		}
+		if v, ok = m[key]; !ok {
+			return nil, false, nil
+		}
+	}
+	return v, true, nil
+}
+
+func newProfiles() *profiles {
+	return &profiles{data: map[string]interface{}{
+		"user": map[string]interface{}{
+			"tier":    "gold",
+			"address": map[string]interface{}{"city": "Oslo"},
+			"tags":    []interface{}{"a", "b"},
+		},
+		"broken": map[string]interface{}{},
+	}}
+}
+
+func TestProvidersResolveLazily(t *testing.T) {
+	tests := []struct {
+		src      string
+		want     interface{}
+		resolved []string
+	}{
+		// Consecutive fields are resolved in one call.
+		{`$user.address.city`, "Oslo", []string{"user.address.city"}},
+		// Short-circuiting skips the right side, which is never fetched.
+		{`$user.tier == "gold" OR $broken.x`, true, []string{"user.tier"}},
+		{`false AND $broken.x`, false, nil},
+		{`$user?.missing`, nil, []string{"user.missing"}},
+		// A provider used as a value is resolved whole.
+		{`$user == null`, false, []string{"user"}},
+		{`$user.tags[*]`, []interface{}{"a", "b"}, []string{"user.tags"}},
+	}
+	for name, eval := range evaluators {
+		for _, tt := range tests {
+			p := newProfiles()
+			ctx := env.ProviderContext(p, []string{"user", "broken"})
+			got, err := eval(parse(t, tt.src), ctx, env.NewEnvironment())
+			if err != nil {
+				t.Errorf("%s: %s: %v", name, tt.src, err)
+				continue
+			}
+			if !resultsEqual(got, tt.want) {
+				t.Errorf("%s: %s: got %v, want %v", name, tt.src, got, tt.want)
+			}
+			if !slices.Equal(p.resolved, tt.resolved) {
+				t.Errorf("%s: %s: resolved %q, want %q", name, tt.src, p.resolved, tt.resolved)
+			}
+		}
+	}
+}
+
+func TestProviderErrorsPropagate(t *testing.T) {
+	tests := []struct {
+		src          string
+		line, column int
+	}{
+		{`$broken.x == 1`, 1, 9},
+		{`$user.tier == "gold" AND $broken == null`, 1, 26},
+		{`string.toUpper($broken.name) == "X"`, 1, 24},
+	}
+	for name, eval := range evaluators {
+		for _, tt := range tests {
+			ctx := env.ProviderContext(newProfiles(), []string{"user", "broken"})
+			_, err := eval(parse(t, tt.src), ctx, env.NewEnvironment())
+			var ctxErr *errors.ContextError
+			if !stdErrors.As(err, &ctxErr) {
+				t.Errorf("%s: %s: got %v, want a ContextError", name, tt.src, err)
+				continue
+			}
+			if !stdErrors.Is(err, errUnavailable) {
+				t.Errorf("%s: %s: %v does not wrap the provider's error", name, tt.src, err)
+			}
+			if ctxErr.Line != tt.line || ctxErr.Column != tt.column {
+				t.Errorf("%s: %s: error at %d:%d, want %d:%d", name, tt.src, ctxErr.Line, ctxErr.Column, tt.line, tt.column)
+			}
+		}
+	}
+}
+
+func TestMissingProviderFields(t *testing.T) {
+	for name, eval := range evaluators {
+		ctx := env.ProviderContext(newProfiles(), []string{"user"})
+		_, err := eval(parse(t, `$user.address.zip == "1"`), ctx, env.NewEnvironment())
+		var refErr *errors.ReferenceError
+		if !stdErrors.As(err, &refErr) {
+			t.Errorf("%s: got %v, want a ReferenceError", name, err)
+		}
+	}
+}
+
+// resultsEqual compares evaluation results, which may hold slices.
+func resultsEqual(a, b interface{}) bool {
+	as, ok := a.([]interface{})
+	if !ok {
+		return a == b
+	}
+	bs, ok := b.([]interface{})
+	return ok && slices.Equal(as, bs)
+}
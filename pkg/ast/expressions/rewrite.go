@@ -0,0 +1,113 @@
+package expressions
+
+import (
+	"github.com/SpecDrivenDesign/lql/pkg/ast"
+)
+
+func (b *BinaryExpr) RewriteChildren(fn func(ast.Expression) ast.Expression) ast.Expression {
+	c := *b
+	c.Left = fn(b.Left)
+	c.Right = fn(b.Right)
+	return &c
+}
+
+func (u *UnaryExpr) RewriteChildren(fn func(ast.Expression) ast.Expression) ast.Expression {
+	c := *u
+	c.Expr = fn(u.Expr)
+	return &c
+}
+
+func (c *ContextExpr) RewriteChildren(fn func(ast.Expression) ast.Expression) ast.Expression {
+	cp := *c
+	if c.Subscript != nil {
+		cp.Subscript = fn(c.Subscript)
+	}
+	return &cp
+}
+
+func (m *MemberAccessExpr) RewriteChildren(fn func(ast.Expression) ast.Expression) ast.Expression {
+	c := *m
+	c.Target = fn(m.Target)
+	c.AccessParts = make([]MemberPart, len(m.AccessParts))
+	for i, part := range m.AccessParts {
+		if part.Expr != nil {
+			part.Expr = fn(part.Expr)
+		}
+		c.AccessParts[i] = part
+	}
+	return &c
+}
+
+func (f *FunctionCallExpr) RewriteChildren(fn func(ast.Expression) ast.Expression) ast.Expression {
+	c := *f
+	c.Namespace = append([]string(nil), f.Namespace...)
+	c.Args = make([]ast.Expression, len(f.Args))
+	for i, arg := range f.Args {
+		c.Args[i] = fn(arg)
+	}
+	return &c
+}
+
+func (a *ArrayLiteralExpr) RewriteChildren(fn func(ast.Expression) ast.Expression) ast.Expression {
+	c := *a
+	c.Elements = make([]ast.Expression, len(a.Elements))
+	for i, elem := range a.Elements {
+		c.Elements[i] = fn(elem)
+	}
+	return &c
+}
+
+func (o *ObjectLiteralExpr) RewriteChildren(fn func(ast.Expression) ast.Expression) ast.Expression {
+	c := *o
+	c.Fields = make([]ObjectField, len(o.Fields))
+	for i, field := range o.Fields {
+		if field.KeyExpr != nil {
+			field.KeyExpr = fn(field.KeyExpr)
+		}
+		field.Value = fn(field.Value)
+		c.Fields[i] = field
+	}
+	return &c
+}
+
+func (l *LikeExpr) RewriteChildren(fn func(ast.Expression) ast.Expression) ast.Expression {
+	c := *l
+	c.Subject = fn(l.Subject)
+	c.Pattern = fn(l.Pattern)
+	return &c
+}
+
+func (b *BetweenExpr) RewriteChildren(fn func(ast.Expression) ast.Expression) ast.Expression {
+	c := *b
+	c.Subject = fn(b.Subject)
+	c.Low = fn(b.Low)
+	c.High = fn(b.High)
+	return &c
+}
+
+func (d *DefaultExpr) RewriteChildren(fn func(ast.Expression) ast.Expression) ast.Expression {
+	c := *d
+	c.Expr = fn(d.Expr)
+	c.Fallback = fn(d.Fallback)
+	return &c
+}
+
+func (l *LetExpr) RewriteChildren(fn func(ast.Expression) ast.Expression) ast.Expression {
+	c := *l
+	c.Value = fn(l.Value)
+	c.Body = fn(l.Body)
+	return &c
+}
+
+func (c *CustomInfixExpr) RewriteChildren(fn func(ast.Expression) ast.Expression) ast.Expression {
+	cp := *c
+	cp.Left = fn(c.Left)
+	cp.Right = fn(c.Right)
+	return &cp
+}
+
+func (c *CustomPrefixExpr) RewriteChildren(fn func(ast.Expression) ast.Expression) ast.Expression {
+	cp := *c
+	cp.Expr = fn(c.Expr)
+	return &cp
+}
@@ -14,32 +14,55 @@ type UnaryExpr struct {
 	Expr     ast.Expression
 	Line     int
 	Column   int
+	ast.Annotations
 }
 
 func (u *UnaryExpr) Eval(ctx map[string]interface{}, env *env.Environment) (interface{}, error) {
-	val, err := u.Expr.Eval(ctx, env)
+	return EvalIn(u, ctx, nil, env)
+}
+
+func (u *UnaryExpr) eval(ctx map[string]interface{}, scope *env.Scope, env *env.Environment) (interface{}, error) {
+	val, err := EvalIn(u.Expr, ctx, scope, env)
 	if err != nil {
 		return nil, err
 	}
-	switch u.Operator {
-	case tokens.TokenMinus:
-		num, ok := types.ToFloat(val)
+	if apply, ok := unaryOperators[u.Operator]; ok {
+		return apply(val, u.Line, u.Column)
+	}
+	return nil, errors.NewUnknownOperatorError("unknown unary operator", u.Line, u.Column)
+}
+
+// UnaryOperatorFunc applies a unary operator to its evaluated operand.
+// Line and column locate the operator for errors.
+type UnaryOperatorFunc func(operand interface{}, line, column int) (interface{}, error)
+
+// UnaryOperator returns the function applying op.
+func UnaryOperator(op tokens.TokenType) (UnaryOperatorFunc, bool) {
+	apply, ok := unaryOperators[op]
+	return apply, ok
+}
+
+var unaryOperators = map[tokens.TokenType]UnaryOperatorFunc{
+	tokens.TokenMinus: func(operand interface{}, line, column int) (interface{}, error) {
+		if d, ok := operand.(types.Decimal); ok {
+			return d.Neg(), nil
+		}
+		num, ok := types.ToFloat(operand)
 		if !ok {
-			return nil, errors.NewSemanticError("unary '-' operator requires a numeric operand", u.Line, u.Column)
+			return nil, errors.NewSemanticError("unary '-' operator requires a numeric operand", line, column)
 		}
-		if types.IsInt(val) {
+		if types.IsInt(operand) {
 			return int64(-num), nil
 		}
 		return -num, nil
-	case tokens.TokenNot:
-		b, ok := val.(bool)
+	},
+	tokens.TokenNot: func(operand interface{}, line, column int) (interface{}, error) {
+		b, ok := operand.(bool)
 		if !ok {
-			return nil, errors.NewSemanticError("NOT operator requires a boolean operand", u.Line, u.Column)
+			return nil, errors.NewSemanticError("NOT operator requires a boolean operand", line, column)
 		}
 		return !b, nil
-	default:
-		return nil, errors.NewUnknownOperatorError("unknown unary operator", u.Line, u.Column)
-	}
+	},
 }
 
 func (u *UnaryExpr) Pos() (int, int) {
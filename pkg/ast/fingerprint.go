@@ -0,0 +1,99 @@
+package ast
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ignoredFields are node fields that record where a node appeared in the
+// source, or its metadata, and so are excluded from fingerprints.
+var ignoredFields = map[string]bool{
+	"Line":        true,
+	"Column":      true,
+	"ParenLine":   true,
+	"ParenColumn": true,
+	"Annotations": true,
+}
+
+// Fingerprint returns a stable hex-encoded SHA-256 hash of the structure of
+// expr. Source positions, whitespace, comments, redundant parentheses and
+// keyword casing do not affect the result, so two sources that parse to the
+// same tree share a fingerprint. Operand order, including the written order
+// of object literal fields, is significant.
+func Fingerprint(expr Expression) string {
+	sum := sha256.Sum256([]byte(structure(expr)))
+	return hex.EncodeToString(sum[:])
+}
+
+// Equal reports whether a and b have the same structure, under the same
+// rules as Fingerprint: formatting, positions, redundant parentheses and
+// keyword casing are ignored.
+func Equal(a, b Expression) bool {
+	return structure(a) == structure(b)
+}
+
+// structure returns the encoding of expr hashed by Fingerprint.
+func structure(expr Expression) string {
+	var sb strings.Builder
+	writeFingerprint(&sb, reflect.ValueOf(expr))
+	return sb.String()
+}
+
+// writeFingerprint appends an unambiguous encoding of v to sb, walking
+// exported struct fields, slices and maps.
+func writeFingerprint(sb *strings.Builder, v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Invalid:
+		sb.WriteString("nil")
+	case reflect.Interface, reflect.Pointer:
+		if v.IsNil() {
+			sb.WriteString("nil")
+			return
+		}
+		writeFingerprint(sb, v.Elem())
+	case reflect.Struct:
+		t := v.Type()
+		sb.WriteString(t.String())
+		sb.WriteByte('{')
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() || ignoredFields[field.Name] || field.Type.Kind() == reflect.Func {
+				continue
+			}
+			sb.WriteString(field.Name)
+			sb.WriteByte(':')
+			writeFingerprint(sb, v.Field(i))
+			sb.WriteByte(';')
+		}
+		sb.WriteByte('}')
+	case reflect.Slice, reflect.Array:
+		sb.WriteByte('[')
+		for i := 0; i < v.Len(); i++ {
+			writeFingerprint(sb, v.Index(i))
+			sb.WriteByte(',')
+		}
+		sb.WriteByte(']')
+	case reflect.Map:
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+		})
+		sb.WriteByte('{')
+		for _, key := range keys {
+			writeFingerprint(sb, key)
+			sb.WriteByte(':')
+			writeFingerprint(sb, v.MapIndex(key))
+			sb.WriteByte(',')
+		}
+		sb.WriteByte('}')
+	case reflect.String:
+		sb.WriteString(strconv.Quote(v.String()))
+	default:
+		fmt.Fprintf(sb, "%s(%v)", v.Type(), v.Interface())
+	}
+}
@@ -0,0 +1,69 @@
+package ast_test
+
+import (
+	"github.com/SpecDrivenDesign/lql/pkg/ast"
+	"github.com/SpecDrivenDesign/lql/pkg/lexer"
+	"github.com/SpecDrivenDesign/lql/pkg/parser"
+	"testing"
+)
+
+func parse(t *testing.T, src string) ast.Expression {
+	t.Helper()
+	p, err := parser.NewParser(lexer.NewLexer(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expr, err := p.ParseExpression()
+	if err != nil {
+		t.Fatalf("%s: %v", src, err)
+	}
+	return expr
+}
+
+func TestFingerprint(t *testing.T) {
+	tests := []struct {
+		a, b  string
+		equal bool
+	}{
+		// Positions, whitespace, comments, parentheses and keyword casing
+		// are ignored.
+		{`$a > 1 AND $b`, "\n  $a   >  1\n and $b # trailing", true},
+		{`$a > 1 AND $b`, `(($a > 1)) AND ($b)`, true},
+		{`$a LIKE "x%"`, `$a like "x%"`, true},
+		{`math.abs(-1)`, `math.abs( - 1 )`, true},
+		// Literals and operators are significant.
+		{`$a > 1`, `$a > 2`, false},
+		{`$a > 1`, `$a > 1.0`, false},
+		{`$a == "1"`, `$a == 1`, false},
+		{`$a > 1`, `$a >= 1`, false},
+		{`$a AND $b`, `$a OR $b`, false},
+		{`$a.b`, `$a?.b`, false},
+		{`$a.b`, `$a.c`, false},
+		// So is operand order.
+		{`$a == $b`, `$b == $a`, false},
+		{`{"a": 1, "b": 2}`, `{"b": 2, "a": 1}`, false},
+		{`($a + $b) * $c`, `$a + $b * $c`, false},
+	}
+	for _, tt := range tests {
+		a, b := parse(t, tt.a), parse(t, tt.b)
+		if got := ast.Fingerprint(a) == ast.Fingerprint(b); got != tt.equal {
+			t.Errorf("%q and %q: equal fingerprints %t, want %t", tt.a, tt.b, got, tt.equal)
+		}
+		if got := ast.Equal(a, b); got != tt.equal {
+			t.Errorf("%q and %q: Equal %t, want %t", tt.a, tt.b, got, tt.equal)
+		}
+	}
+}
+
+func TestFingerprintIgnoresMetadata(t *testing.T) {
+	plain, annotated := parse(t, `$a > 1`), parse(t, `$a > 1`)
+	if !ast.Annotate(annotated, "rule", "r-1") {
+		t.Fatal("the expression cannot carry metadata")
+	}
+	if ast.Fingerprint(plain) != ast.Fingerprint(annotated) {
+		t.Error("metadata changed the fingerprint")
+	}
+	if len(ast.Fingerprint(plain)) != 64 {
+		t.Errorf("fingerprint %s is not a hex SHA-256", ast.Fingerprint(plain))
+	}
+}
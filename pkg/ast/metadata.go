@@ -0,0 +1,147 @@
+package ast
+
+import (
+	"github.com/SpecDrivenDesign/lql/pkg/errors"
+)
+
+// Metadata holds annotations attached to a node, such as the source file,
+// rule ID or author of the rule it belongs to. Metadata does not affect
+// evaluation, String, Fingerprint or Equal.
+type Metadata map[string]interface{}
+
+// Annotated is implemented by nodes that carry Metadata. The built-in node
+// types implement it by embedding Annotations.
+type Annotated interface {
+	Metadata() Metadata
+	SetMetadata(key string, value interface{})
+}
+
+// Annotations is embedded in node types to hold their Metadata. The map is
+// never modified in place: SetMetadata replaces it with an updated copy, so
+// the copies made by Rewrite and Clone can share it safely and annotating
+// one tree never changes another.
+type Annotations struct {
+	Meta Metadata
+}
+
+// Metadata returns the node's metadata. The map must not be modified; use
+// SetMetadata.
+func (a *Annotations) Metadata() Metadata {
+	return a.Meta
+}
+
+// SetMetadata sets key to value in the node's metadata.
+func (a *Annotations) SetMetadata(key string, value interface{}) {
+	meta := make(Metadata, len(a.Meta)+1)
+	for k, v := range a.Meta {
+		meta[k] = v
+	}
+	meta[key] = value
+	a.Meta = meta
+}
+
+// Annotate sets key to value in the metadata of expr and reports whether
+// expr can carry metadata.
+func Annotate(expr Expression, key string, value interface{}) bool {
+	a, ok := expr.(Annotated)
+	if ok {
+		a.SetMetadata(key, value)
+	}
+	return ok
+}
+
+// MetadataOf returns the metadata of expr, or nil.
+func MetadataOf(expr Expression) Metadata {
+	if a, ok := expr.(Annotated); ok {
+		return a.Metadata()
+	}
+	return nil
+}
+
+// MetadataAt returns the metadata in effect at a source position: that of
+// every node from the root down to the node at line and column, with inner
+// nodes overriding keys set by outer ones. The node at a position is the
+// last node, in source order, that starts at or before it, which is the
+// node that raised an error reported there even when the error points into
+// it, as at the name of a missing field. Only the root's metadata applies
+// when no node starts at or before the position.
+func MetadataAt(root Expression, line, column int) Metadata {
+	if root == nil {
+		return nil
+	}
+	var path, found []Expression
+	foundLine, foundColumn := 0, 0
+	var visit func(node Expression)
+	visit = func(node Expression) {
+		path = append(path, node)
+		l, c := node.Pos()
+		before := l < line || l == line && c <= column
+		// Of nodes at the same position, the deepest is visited last.
+		if before && (found == nil || l > foundLine || l == foundLine && c >= foundColumn) {
+			found = append(found[:0], path...)
+			foundLine, foundColumn = l, c
+		}
+		for _, child := range Children(node) {
+			visit(child)
+		}
+		path = path[:len(path)-1]
+	}
+	visit(root)
+	if found == nil {
+		found = []Expression{root}
+	}
+	var meta Metadata
+	for _, node := range found {
+		for k, v := range MetadataOf(node) {
+			if meta == nil {
+				meta = make(Metadata)
+			}
+			meta[k] = v
+		}
+	}
+	return meta
+}
+
+// WithMetadata attaches meta, the metadata of a node err is unwinding out
+// of, to err. Keys err already carries, from nodes inside that one, are
+// kept. It returns err unchanged when meta is empty.
+func WithMetadata(err error, meta Metadata) error {
+	if err == nil || len(meta) == 0 {
+		return err
+	}
+	annotated, ok := err.(*errors.AnnotatedError)
+	if !ok {
+		return &errors.AnnotatedError{Err: err, Metadata: meta}
+	}
+	merged := make(map[string]interface{}, len(meta)+len(annotated.Metadata))
+	for k, v := range meta {
+		merged[k] = v
+	}
+	for k, v := range annotated.Metadata {
+		merged[k] = v
+	}
+	return &errors.AnnotatedError{Err: annotated.Err, Metadata: merged}
+}
+
+// AnnotateError attaches the metadata in effect where err was raised while
+// evaluating root, as found by MetadataAt, to err. It returns err unchanged
+// when no metadata applies. An error already annotated is annotated again
+// with the metadata found from root. Evaluations annotate their errors from
+// the nodes they unwind through, so hosts only need it for errors raised
+// otherwise; as it goes by position, it cannot tell apart rules parsed
+// from different sources and combined into root.
+func AnnotateError(root Expression, err error) error {
+	if err == nil {
+		return nil
+	}
+	inner := err
+	if annotated, ok := err.(*errors.AnnotatedError); ok {
+		inner = annotated.Err
+	}
+	line, column := errors.GetErrorPosition(inner)
+	meta := MetadataAt(root, line, column)
+	if len(meta) == 0 {
+		return err
+	}
+	return &errors.AnnotatedError{Err: inner, Metadata: meta}
+}
@@ -0,0 +1,24 @@
+package ast
+
+// Rewriter is implemented by expressions that have child expressions.
+// RewriteChildren returns a copy of the node whose children are replaced by
+// fn(child); the receiver is left unchanged.
+type Rewriter interface {
+	RewriteChildren(fn func(Expression) Expression) Expression
+}
+
+// Rewrite rebuilds the tree rooted at node bottom-up: children are rewritten
+// first, then fn is applied to the rebuilt node. fn returns its argument to
+// keep a node, or a replacement expression. The original tree is not
+// modified.
+func Rewrite(node Expression, fn func(Expression) Expression) Expression {
+	if node == nil {
+		return nil
+	}
+	if r, ok := node.(Rewriter); ok {
+		node = r.RewriteChildren(func(child Expression) Expression {
+			return Rewrite(child, fn)
+		})
+	}
+	return fn(node)
+}
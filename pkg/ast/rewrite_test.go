@@ -0,0 +1,107 @@
+package ast_test
+
+import (
+	"github.com/SpecDrivenDesign/lql/pkg/ast"
+	"github.com/SpecDrivenDesign/lql/pkg/ast/expressions"
+	"github.com/SpecDrivenDesign/lql/pkg/tokens"
+	"strings"
+	"testing"
+)
+
+// rewriteSources cover every node kind with children.
+var rewriteSources = []string{
+	`$a + 1 > 2 AND NOT $b`,
+	`$a[$i].b?.c[0] == -1`,
+	`math.max([$a, 2], 3) BETWEEN 1 AND 4`,
+	`{"k": $a, "n": [1, {"m": 2}]}.k LIKE "x%"`,
+	`$a ?: 1`,
+	`LET x = $a + 1 IN x * 2`,
+	`$items[*].price`,
+}
+
+func TestRewriteIdentity(t *testing.T) {
+	for _, src := range rewriteSources {
+		expr := parse(t, src)
+		got := ast.Rewrite(expr, func(node ast.Expression) ast.Expression { return node })
+		if !ast.Equal(got, expr) {
+			t.Errorf("%s: rewritten as %s", src, got)
+		}
+		if got == expr {
+			t.Errorf("%s: the root was not rebuilt", src)
+		}
+	}
+	if ast.Rewrite(nil, func(node ast.Expression) ast.Expression { return node }) != nil {
+		t.Error("a nil tree was rewritten")
+	}
+}
+
+func TestRewriteReplacesLeaves(t *testing.T) {
+	// Every integer literal is incremented, wherever it appears.
+	increment := func(node ast.Expression) ast.Expression {
+		if lit, ok := node.(*expressions.LiteralExpr); ok {
+			if n, ok := lit.Value.(int64); ok {
+				return &expressions.LiteralExpr{Value: n + 1, Line: lit.Line, Column: lit.Column}
+			}
+		}
+		return node
+	}
+	tests := []struct {
+		src, want string
+	}{
+		{`$a + 1 > 2 AND NOT $b`, `$a + 2 > 3 AND NOT $b`},
+		// -1 negates the literal 1.
+		{`$a[$i].b?.c[0] == -1`, `$a[$i].b?.c[1] == -2`},
+		{`math.max([$a, 2], 3) BETWEEN 1 AND 4`, `math.max([$a, 3], 4) BETWEEN 2 AND 5`},
+		{`{"k": $a, "n": [1, {"m": 2}]}.k LIKE "x%"`, `{"k": $a, "n": [2, {"m": 3}]}.k LIKE "x%"`},
+		{`$a ?: 1`, `$a ?: 2`},
+		{`LET x = $a + 1 IN x * 2`, `LET x = $a + 2 IN x * 3`},
+	}
+	for _, tt := range tests {
+		expr := parse(t, tt.src)
+		before := expr.String()
+		got := ast.Rewrite(expr, increment)
+		if !ast.Equal(got, parse(t, tt.want)) {
+			t.Errorf("%s: got %s, want %s", tt.src, got, tt.want)
+		}
+		if expr.String() != before {
+			t.Errorf("%s: the original tree was modified to %s", tt.src, expr)
+		}
+	}
+}
+
+func TestRewriteIsBottomUp(t *testing.T) {
+	expr := parse(t, `($a + 1) * ($b - 2)`)
+	var visited []string
+	ast.Rewrite(expr, func(node ast.Expression) ast.Expression {
+		visited = append(visited, node.String())
+		return node
+	})
+	want := []string{"$a", "1", "$a + 1", "$b", "2", "$b - 2"}
+	if len(visited) != len(want)+1 || strings.Join(visited[:len(want)], "|") != strings.Join(want, "|") {
+		t.Errorf("visited %q", visited)
+	}
+
+	// fn sees rebuilt children, so folding cascades up the tree.
+	fold := func(node ast.Expression) ast.Expression {
+		bin, ok := node.(*expressions.BinaryExpr)
+		if !ok {
+			return node
+		}
+		left, lok := bin.Left.(*expressions.LiteralExpr)
+		right, rok := bin.Right.(*expressions.LiteralExpr)
+		if !lok || !rok {
+			return node
+		}
+		a, b := left.Value.(int64), right.Value.(int64)
+		switch bin.Operator {
+		case tokens.TokenPlus:
+			return &expressions.LiteralExpr{Value: a + b, Line: bin.Line, Column: bin.Column}
+		case tokens.TokenMultiply:
+			return &expressions.LiteralExpr{Value: a * b, Line: bin.Line, Column: bin.Column}
+		}
+		return node
+	}
+	if got := ast.Rewrite(parse(t, `(1 + 2) * (3 + 4) > $a`), fold); got.String() != "21 > $a" {
+		t.Errorf("folded to %s", got)
+	}
+}
@@ -0,0 +1,26 @@
+package ast
+
+// Children returns the direct child expressions of node in evaluation order.
+func Children(node Expression) []Expression {
+	r, ok := node.(Rewriter)
+	if !ok {
+		return nil
+	}
+	var children []Expression
+	r.RewriteChildren(func(child Expression) Expression {
+		children = append(children, child)
+		return child
+	})
+	return children
+}
+
+// Inspect traverses the tree rooted at node depth-first, calling fn for each
+// node before its children. Children are skipped when fn returns false.
+func Inspect(node Expression, fn func(Expression) bool) {
+	if node == nil || !fn(node) {
+		return
+	}
+	for _, child := range Children(node) {
+		Inspect(child, fn)
+	}
+}
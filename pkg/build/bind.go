@@ -0,0 +1,94 @@
+package build
+
+import (
+	"fmt"
+	"github.com/SpecDrivenDesign/lql/pkg/ast"
+	"github.com/SpecDrivenDesign/lql/pkg/ast/expressions"
+	"sort"
+)
+
+// Param is a named placeholder, written :name, to be replaced by Bind.
+func Param(name string) Expr {
+	if !isIdentifier(name) {
+		return failed(fmt.Errorf("build: placeholder name %q is not an identifier", name))
+	}
+	return Expr{node: &expressions.PlaceholderExpr{Name: name}}
+}
+
+// Placeholders returns the distinct placeholder names in expr, sorted.
+func Placeholders(expr ast.Expression) []string {
+	seen := make(map[string]bool)
+	ast.Inspect(expr, func(node ast.Expression) bool {
+		if p, ok := node.(*expressions.PlaceholderExpr); ok {
+			seen[p.Name] = true
+		}
+		return true
+	})
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Bind returns a copy of expr with each placeholder replaced by a literal
+// for its value, converted as by Lit, so a parsed rule can be specialized
+// without building source text. Every placeholder must have a value and
+// every value must be used. The literals take the placeholders' positions,
+// so errors still point into the original source; expr is not modified.
+func Bind(expr ast.Expression, values map[string]interface{}) (ast.Expression, error) {
+	literals := make(map[string]ast.Expression, len(values))
+	for name, v := range values {
+		lit := Lit(v)
+		if lit.err != nil {
+			return nil, fmt.Errorf("build: value for placeholder ':%s': %v", name, lit.err)
+		}
+		literals[name] = lit.node
+	}
+
+	used := make(map[string]bool)
+	var missing error
+	bound := ast.Rewrite(expr, func(node ast.Expression) ast.Expression {
+		p, ok := node.(*expressions.PlaceholderExpr)
+		if !ok {
+			return node
+		}
+		lit, ok := literals[p.Name]
+		if !ok {
+			if missing == nil {
+				missing = fmt.Errorf("build: missing value for placeholder ':%s'", p.Name)
+			}
+			return node
+		}
+		used[p.Name] = true
+		return positioned(ast.Clone(lit), p.Line, p.Column)
+	})
+	if missing != nil {
+		return nil, missing
+	}
+	names := make([]string, 0, len(literals))
+	for name := range literals {
+		if !used[name] {
+			names = append(names, name)
+		}
+	}
+	if len(names) > 0 {
+		sort.Strings(names)
+		return nil, fmt.Errorf("build: unknown placeholder ':%s'", names[0])
+	}
+	return bound, nil
+}
+
+// positioned sets the position of a literal node built by Lit.
+func positioned(node ast.Expression, line, column int) ast.Expression {
+	switch n := node.(type) {
+	case *expressions.LiteralExpr:
+		n.Line, n.Column = line, column
+	case *expressions.ArrayLiteralExpr:
+		n.Line, n.Column = line, column
+	case *expressions.ObjectLiteralExpr:
+		n.Line, n.Column = line, column
+	}
+	return node
+}
@@ -0,0 +1,324 @@
+// Package build constructs expressions from Go code. Values are embedded as
+// literal nodes and names are validated, so no input can change the shape
+// of the resulting expression the way concatenated source text can:
+//
+//	expr, err := build.And(
+//		build.Ctx("user", "age").Gte(18),
+//		build.Call("string", "toLower", build.Ctx("user", "country")).Eq(country),
+//	).Build()
+package build
+
+import (
+	"fmt"
+	"github.com/SpecDrivenDesign/lql/pkg/ast"
+	"github.com/SpecDrivenDesign/lql/pkg/ast/expressions"
+	"github.com/SpecDrivenDesign/lql/pkg/lql"
+	"github.com/SpecDrivenDesign/lql/pkg/tokens"
+	"math"
+	"reflect"
+	"sort"
+)
+
+// Expr is an expression under construction. Operands given as Expr or
+// ast.Expression are used as they are; any other value becomes a literal
+// as by Lit. The first error encountered is kept and reported by Build.
+type Expr struct {
+	node ast.Expression
+	err  error
+}
+
+// Build returns the constructed expression, or the first error made while
+// building it.
+func (x Expr) Build() (ast.Expression, error) {
+	if x.err != nil {
+		return nil, x.err
+	}
+	return x.node, nil
+}
+
+// MustBuild is like Build but panics on error. It is intended for
+// expressions built from constants.
+func (x Expr) MustBuild() ast.Expression {
+	node, err := x.Build()
+	if err != nil {
+		panic(err)
+	}
+	return node
+}
+
+// Source returns the canonical source text of the expression, as printed
+// by lql.Format.
+func (x Expr) Source() (string, error) {
+	node, err := x.Build()
+	if err != nil {
+		return "", err
+	}
+	return lql.Format(node, lql.FormatOptions{}), nil
+}
+
+func failed(err error) Expr {
+	return Expr{err: err}
+}
+
+// value converts an operand to an Expr.
+func value(v interface{}) Expr {
+	switch e := v.(type) {
+	case Expr:
+		return e
+	case ast.Expression:
+		if e == nil {
+			return failed(fmt.Errorf("build: nil expression"))
+		}
+		return Expr{node: e}
+	}
+	return Lit(v)
+}
+
+// Ctx refers to a context field, optionally followed by nested keys:
+// Ctx("user", "age") is $user.age.
+func Ctx(field string, path ...string) Expr {
+	if !isIdentifier(field) {
+		return failed(fmt.Errorf("build: context field %q is not an identifier", field))
+	}
+	x := Expr{node: &expressions.ContextExpr{Ident: &expressions.IdentifierExpr{Name: field}}}
+	for _, key := range path {
+		x = x.Field(key)
+	}
+	return x
+}
+
+// Lit returns a literal for a Go value: nil, a bool, a string, an integer,
+// a finite float, or a slice or string-keyed map of such values, which
+// become array and object literals.
+func Lit(v interface{}) Expr {
+	switch val := v.(type) {
+	case nil, bool, string, int64, float64:
+		return literal(val)
+	case int:
+		return literal(int64(val))
+	case int8:
+		return literal(int64(val))
+	case int16:
+		return literal(int64(val))
+	case int32:
+		return literal(int64(val))
+	case uint8:
+		return literal(int64(val))
+	case uint16:
+		return literal(int64(val))
+	case uint32:
+		return literal(int64(val))
+	case uint:
+		return unsigned(uint64(val))
+	case uint64:
+		return unsigned(val)
+	case float32:
+		return literal(float64(val))
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		elements := make([]ast.Expression, rv.Len())
+		for i := range elements {
+			elem := value(rv.Index(i).Interface())
+			if elem.err != nil {
+				return elem
+			}
+			elements[i] = elem.node
+		}
+		return Expr{node: &expressions.ArrayLiteralExpr{Elements: elements}}
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return failed(fmt.Errorf("build: map keys must be strings, got %s", rv.Type().Key()))
+		}
+		keys := make([]string, 0, rv.Len())
+		for _, k := range rv.MapKeys() {
+			keys = append(keys, k.String())
+		}
+		sort.Strings(keys)
+		fields := make([]expressions.ObjectField, len(keys))
+		for i, key := range keys {
+			field := value(rv.MapIndex(reflect.ValueOf(key).Convert(rv.Type().Key())).Interface())
+			if field.err != nil {
+				return field
+			}
+			fields[i] = expressions.ObjectField{Key: key, Value: field.node}
+		}
+		return Expr{node: &expressions.ObjectLiteralExpr{Fields: fields}}
+	}
+	return failed(fmt.Errorf("build: unsupported literal type %T", v))
+}
+
+func literal(v interface{}) Expr {
+	if f, ok := v.(float64); ok && (math.IsNaN(f) || math.IsInf(f, 0)) {
+		return failed(fmt.Errorf("build: %v cannot be written as a literal", f))
+	}
+	return Expr{node: &expressions.LiteralExpr{Value: v}}
+}
+
+func unsigned(v uint64) Expr {
+	if v > math.MaxInt64 {
+		return failed(fmt.Errorf("build: %d overflows a 64-bit integer", v))
+	}
+	return literal(int64(v))
+}
+
+// Call calls library.function with the given arguments.
+func Call(library, function string, args ...interface{}) Expr {
+	if !isIdentifier(library) || !isIdentifier(function) {
+		return failed(fmt.Errorf("build: %q is not a valid function name", library+"."+function))
+	}
+	call := &expressions.FunctionCallExpr{Namespace: []string{library, function}}
+	for _, arg := range args {
+		a := value(arg)
+		if a.err != nil {
+			return a
+		}
+		call.Args = append(call.Args, a.node)
+	}
+	return Expr{node: call}
+}
+
+// And joins the operands with AND. It needs at least one operand.
+func And(operands ...interface{}) Expr {
+	return chain(tokens.TokenAnd, operands)
+}
+
+// Or joins the operands with OR. It needs at least one operand.
+func Or(operands ...interface{}) Expr {
+	return chain(tokens.TokenOr, operands)
+}
+
+func chain(op tokens.TokenType, operands []interface{}) Expr {
+	if len(operands) == 0 {
+		return failed(fmt.Errorf("build: %s needs at least one operand", tokens.FixedTokenLiterals[op]))
+	}
+	x := value(operands[0])
+	for _, operand := range operands[1:] {
+		x = x.binary(op, operand)
+	}
+	return x
+}
+
+// Not negates its operand.
+func Not(operand interface{}) Expr {
+	x := value(operand)
+	if x.err != nil {
+		return x
+	}
+	return Expr{node: &expressions.UnaryExpr{Operator: tokens.TokenNot, Expr: x.node}}
+}
+
+func (x Expr) binary(op tokens.TokenType, operand interface{}) Expr {
+	if x.err != nil {
+		return x
+	}
+	y := value(operand)
+	if y.err != nil {
+		return y
+	}
+	return Expr{node: &expressions.BinaryExpr{Left: x.node, Operator: op, Right: y.node}}
+}
+
+func (x Expr) Eq(v interface{}) Expr  { return x.binary(tokens.TokenEq, v) }
+func (x Expr) Neq(v interface{}) Expr { return x.binary(tokens.TokenNeq, v) }
+func (x Expr) Lt(v interface{}) Expr  { return x.binary(tokens.TokenLt, v) }
+func (x Expr) Lte(v interface{}) Expr { return x.binary(tokens.TokenLte, v) }
+func (x Expr) Gt(v interface{}) Expr  { return x.binary(tokens.TokenGt, v) }
+func (x Expr) Gte(v interface{}) Expr { return x.binary(tokens.TokenGte, v) }
+func (x Expr) Add(v interface{}) Expr { return x.binary(tokens.TokenPlus, v) }
+func (x Expr) Sub(v interface{}) Expr { return x.binary(tokens.TokenMinus, v) }
+func (x Expr) Mul(v interface{}) Expr { return x.binary(tokens.TokenMultiply, v) }
+func (x Expr) Div(v interface{}) Expr { return x.binary(tokens.TokenDivide, v) }
+
+// Matches is x =~ pattern.
+func (x Expr) Matches(pattern interface{}) Expr { return x.binary(tokens.TokenMatch, pattern) }
+
+// NotMatches is x !~ pattern.
+func (x Expr) NotMatches(pattern interface{}) Expr { return x.binary(tokens.TokenNotMatch, pattern) }
+
+// Like is x LIKE pattern.
+func (x Expr) Like(pattern interface{}) Expr {
+	if x.err != nil {
+		return x
+	}
+	p := value(pattern)
+	if p.err != nil {
+		return p
+	}
+	return Expr{node: &expressions.LikeExpr{Subject: x.node, Pattern: p.node}}
+}
+
+// Default is x ?: fallback.
+func (x Expr) Default(fallback interface{}) Expr {
+	if x.err != nil {
+		return x
+	}
+	f := value(fallback)
+	if f.err != nil {
+		return f
+	}
+	return Expr{node: &expressions.DefaultExpr{Expr: x.node, Fallback: f.node}}
+}
+
+// Field accesses a key of x: x.key, or x["key"] when key is not an
+// identifier.
+func (x Expr) Field(key string) Expr {
+	return x.access(key, false)
+}
+
+// OptField accesses a key of x with optional chaining: x?.key.
+func (x Expr) OptField(key string) Expr {
+	return x.access(key, true)
+}
+
+func (x Expr) access(key string, optional bool) Expr {
+	if isIdentifier(key) {
+		return x.part(expressions.MemberPart{Key: key, Optional: optional})
+	}
+	return x.part(expressions.MemberPart{IsIndex: true, Expr: &expressions.LiteralExpr{Value: key}, Optional: optional})
+}
+
+// Index indexes x: x[i].
+func (x Expr) Index(i interface{}) Expr {
+	idx := value(i)
+	if idx.err != nil {
+		return idx
+	}
+	return x.part(expressions.MemberPart{IsIndex: true, Expr: idx.node})
+}
+
+// part appends an access part, extending x when it is already a member
+// access so the result matches what the parser produces.
+func (x Expr) part(p expressions.MemberPart) Expr {
+	if x.err != nil {
+		return x
+	}
+	if m, ok := x.node.(*expressions.MemberAccessExpr); ok {
+		c := *m
+		c.AccessParts = append(append([]expressions.MemberPart(nil), m.AccessParts...), p)
+		return Expr{node: &c}
+	}
+	return Expr{node: &expressions.MemberAccessExpr{Target: x.node, AccessParts: []expressions.MemberPart{p}}}
+}
+
+// isIdentifier reports whether s can be written as a bare name.
+func isIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	switch s {
+	case "true", "false", "null", "AND", "OR", "NOT":
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		letter := ('a' <= ch && ch <= 'z') || ('A' <= ch && ch <= 'Z') || ch == '_'
+		digit := '0' <= ch && ch <= '9'
+		if !letter && !(digit && i > 0) {
+			return false
+		}
+	}
+	return true
+}
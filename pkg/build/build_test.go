@@ -0,0 +1,137 @@
+package build
+
+import (
+	"github.com/SpecDrivenDesign/lql/pkg/ast"
+	"github.com/SpecDrivenDesign/lql/pkg/env"
+	"github.com/SpecDrivenDesign/lql/pkg/lexer"
+	"github.com/SpecDrivenDesign/lql/pkg/parser"
+	"math"
+	"strings"
+	"testing"
+)
+
+func parse(t *testing.T, src string) ast.Expression {
+	t.Helper()
+	p, err := parser.NewParser(lexer.NewLexer(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expr, err := p.ParseExpression()
+	if err != nil {
+		t.Fatalf("%s: %v", src, err)
+	}
+	return expr
+}
+
+func TestBuild(t *testing.T) {
+	tests := []struct {
+		expr Expr
+		want string
+	}{
+		{Ctx("user", "age").Gte(18), `$user.age >= 18`},
+		{And(Ctx("a").Gt(1), Ctx("b").Lt(2.5), Ctx("c")), `$a > 1 AND $b < 2.5 AND $c`},
+		{Or(Ctx("a").Eq("x"), Not(Ctx("b"))), `$a == "x" OR NOT $b`},
+		{And(Or(Ctx("a"), Ctx("b")), Ctx("c")), `($a OR $b) AND $c`},
+		{Ctx("a").Add(1).Mul(Ctx("b")).Sub(2).Div(4), `(($a + 1) * $b - 2) / 4`},
+		{And(Ctx("a").Neq(nil), Ctx("a").Lte(uint8(3))), `$a != null AND $a <= 3`},
+		{Call("string", "toLower", Ctx("user", "country")).Eq("nl"), `string.toLower($user.country) == "nl"`},
+		{Ctx("name").Like("a%"), `$name LIKE "a%"`},
+		{Or(Ctx("name").Matches("^a"), Ctx("name").NotMatches("b$")), `$name =~ "^a" OR $name !~ "b$"`},
+		{Ctx("a").OptField("b").Default(0), `$a?.b ?: 0`},
+		{Ctx("headers", "content-type").Eq("json"), `$headers["content-type"] == "json"`},
+		{Ctx("items").Index(0).Field("sku"), `$items[0].sku`},
+		{Ctx("a").Eq([]int{1, 2}), `$a == [1, 2]`},
+		{Ctx("a").Eq(map[string]interface{}{"k": "v", "b": true}), `$a == {b: true, k: "v"}`},
+		{Ctx("s").Eq(`say "hi"`), `$s == "say \"hi\""`},
+	}
+	for _, tt := range tests {
+		got, err := tt.expr.Source()
+		if err != nil {
+			t.Errorf("%s: %v", tt.want, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("got %s, want %s", got, tt.want)
+		}
+		// The built tree is the one the parser produces for the source.
+		if built := tt.expr.MustBuild(); !ast.Equal(built, parse(t, tt.want)) {
+			t.Errorf("%s: the built tree differs from the parsed one", tt.want)
+		}
+	}
+}
+
+func TestBuildEvaluates(t *testing.T) {
+	expr := And(
+		Ctx("user", "age").Gte(18),
+		Call("string", "toLower", Ctx("user", "country")).Eq("nl"),
+	).MustBuild()
+	ctx := map[string]interface{}{"user": map[string]interface{}{"age": int64(20), "country": "NL"}}
+	if got, err := expr.Eval(ctx, env.NewEnvironment()); err != nil || got != true {
+		t.Errorf("got %v, %v", got, err)
+	}
+}
+
+func TestBuildErrors(t *testing.T) {
+	tests := []struct {
+		expr Expr
+		want string
+	}{
+		{Ctx("user-name"), `context field "user-name" is not an identifier`},
+		{Ctx("AND"), `context field "AND" is not an identifier`},
+		{Call("string", "to lower"), `"string.to lower" is not a valid function name`},
+		{Ctx("a").Eq(math.NaN()), "cannot be written as a literal"},
+		{Ctx("a").Eq(math.Inf(1)), "cannot be written as a literal"},
+		{Ctx("a").Eq(uint64(math.MaxUint64)), "overflows a 64-bit integer"},
+		{Ctx("a").Eq(struct{}{}), "unsupported literal type struct {}"},
+		{Ctx("a").Eq(map[int]string{1: "x"}), "map keys must be strings"},
+		{Ctx("a").Eq([]interface{}{1, make(chan int)}), "unsupported literal type chan int"},
+		{And(), "AND needs at least one operand"},
+		{Param("1st"), `placeholder name "1st" is not an identifier`},
+		// The first error is kept through later calls.
+		{And(Ctx("bad name").Eq(1), Ctx("x")).Field("y").Like("z%"), `context field "bad name"`},
+		{Not(Ctx("a").Gt(math.NaN())).Default(1), "cannot be written as a literal"},
+	}
+	for _, tt := range tests {
+		node, err := tt.expr.Build()
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("got %v, %v; want an error containing %q", node, err, tt.want)
+		}
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("MustBuild did not panic")
+		}
+	}()
+	Ctx("").MustBuild()
+}
+
+func TestBind(t *testing.T) {
+	expr := parse(t, `$user.age >= :min AND array.contains(:countries, $user.country) AND $tier == :min`)
+	if got := Placeholders(expr); len(got) != 2 || got[0] != "countries" || got[1] != "min" {
+		t.Errorf("placeholders %v", got)
+	}
+	bound, err := Bind(expr, map[string]interface{}{"min": 18, "countries": []string{"NL", "BE"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `$user.age >= 18 AND array.contains(["NL", "BE"], $user.country) AND $tier == 18`; bound.String() != want {
+		t.Errorf("got %s, want %s", bound, want)
+	}
+	// The literals take the placeholders' positions.
+	if line, column := ast.Children(ast.Children(ast.Children(bound)[0])[0])[1].Pos(); line != 1 || column != 14 {
+		t.Errorf("bound literal at %d:%d, want 1:14", line, column)
+	}
+	if len(Placeholders(expr)) != 2 {
+		t.Error("Bind modified its input")
+	}
+
+	for _, values := range []map[string]interface{}{
+		{"min": 18},
+		{"min": 18, "countries": nil, "extra": 1},
+		{"min": math.NaN(), "countries": nil},
+	} {
+		if _, err := Bind(expr, values); err == nil {
+			t.Errorf("%v was accepted", values)
+		}
+	}
+}
@@ -6,21 +6,128 @@ import (
 	"crypto/sha256"
 	"encoding/binary"
 	"fmt"
+	"github.com/SpecDrivenDesign/lql/pkg/lexer"
 	"github.com/SpecDrivenDesign/lql/pkg/tokens"
+	"time"
 )
 
+// Sections lists the magic tags of the optional sections the reader
+// understands, in the order they precede the tokens. A code section, when
+// present, replaces the tokens.
+var Sections = []string{tokens.MetadataMagic, tokens.SourceMagic, tokens.ConstantPoolMagic, tokens.CodeMagic}
+
 // ByteCodeReader reads tokens from a binary-encoded byte slice.
 type ByteCodeReader struct {
-	data []byte
-	pos  int
+	data      []byte
+	pos       int
+	source    string
+	srcLex    *lexer.Lexer
+	metadata  *Metadata
+	constants []string
+	code      []byte
 }
 
-// NewByteCodeReader creates a new ByteCodeReader.
+// NewByteCodeReader creates a new ByteCodeReader. If the data carries an
+// embedded source section, token positions are recovered from the source.
+// Expiry is not checked: only signed bytecode carries one, as anyone could
+// change it in unsigned bytecode.
 func NewByteCodeReader(data []byte) *ByteCodeReader {
-	return &ByteCodeReader{
+	reader := &ByteCodeReader{
 		data: data,
 		pos:  0,
 	}
+	if metaData, rest, ok := readSection(reader.data, tokens.MetadataMagic); ok {
+		if meta, err := decodeMetadata(metaData); err == nil {
+			reader.metadata = meta
+			reader.data = rest
+		}
+	}
+	if source, rest, ok := readSection(reader.data, tokens.SourceMagic); ok {
+		reader.data = rest
+		reader.source = string(source)
+		reader.srcLex = lexer.NewLexer(reader.source)
+	}
+	if constantData, rest, ok := readSection(reader.data, tokens.ConstantPoolMagic); ok {
+		if constants, err := decodeConstants(constantData); err == nil {
+			reader.constants = constants
+			reader.data = rest
+		}
+	}
+	if code, rest, ok := readSection(reader.data, tokens.CodeMagic); ok {
+		reader.code = code
+		reader.data = rest
+	}
+	return reader
+}
+
+// Code returns the compiled instructions of an artifact built with
+// WithCode, or nil if the data holds tokens.
+func (b *ByteCodeReader) Code() []byte {
+	return b.code
+}
+
+// Source returns the embedded source text, or "" if none was embedded.
+func (b *ByteCodeReader) Source() string {
+	return b.source
+}
+
+// Metadata returns the embedded metadata, or nil if none was embedded.
+func (b *ByteCodeReader) Metadata() *Metadata {
+	return b.metadata
+}
+
+// readSection splits a magic-tagged, length-prefixed section from the start
+// of data, returning the section payload and the remaining bytes.
+func readSection(data []byte, magic string) ([]byte, []byte, bool) {
+	headerLen := len(magic) + 4
+	if len(data) < headerLen || string(data[:len(magic)]) != magic {
+		return nil, data, false
+	}
+	sectionLen := int(binary.LittleEndian.Uint32(data[len(magic):headerLen]))
+	if len(data) < headerLen+sectionLen {
+		return nil, data, false
+	}
+	return data[headerLen : headerLen+sectionLen], data[headerLen+sectionLen:], true
+}
+
+// decodeConstants decodes the payload of a constant pool section: a uvarint
+// count followed by that many uvarint-length-prefixed literals.
+func decodeConstants(data []byte) ([]string, error) {
+	count, n := binary.Uvarint(data)
+	if n <= 0 || count > uint64(len(data)) {
+		return nil, fmt.Errorf("malformed constant pool")
+	}
+	data = data[n:]
+	constants := make([]string, 0, count)
+	for i := uint64(0); i < count; i++ {
+		length, n := binary.Uvarint(data)
+		if n <= 0 || length > uint64(len(data)-n) {
+			return nil, fmt.Errorf("malformed constant pool")
+		}
+		constants = append(constants, string(data[n:n+int(length)]))
+		data = data[n+int(length):]
+	}
+	if len(data) != 0 {
+		return nil, fmt.Errorf("malformed constant pool")
+	}
+	return constants, nil
+}
+
+// StripSource removes an embedded source section from unsigned bytecode,
+// keeping any metadata section. Data without a source section is returned
+// unchanged.
+func StripSource(data []byte) []byte {
+	metaSection := []byte{}
+	rest := data
+	if _, afterMeta, ok := readSection(data, tokens.MetadataMagic); ok {
+		metaSection = data[:len(data)-len(afterMeta)]
+		rest = afterMeta
+	}
+	_, tokenData, ok := readSection(rest, tokens.SourceMagic)
+	if !ok {
+		return data
+	}
+	return append(append([]byte{}, metaSection...), tokenData...)
 }
 
 // NextToken decodes the next token.
@@ -38,11 +145,20 @@ func (b *ByteCodeReader) NextToken() (tokens.Token, error) {
 	}
 
 	var literal string
-	// If the token has a fixed literal, use that.
 	if fixed, isFixed := tokens.FixedTokenLiterals[tokenType]; isFixed {
+		// If the token has a fixed literal, use that.
 		literal = fixed
+	} else if b.constants != nil {
+		// A literal stored in the constant pool.
+		index, n := binary.Uvarint(b.data[b.pos:])
+		if n <= 0 || index >= uint64(len(b.constants)) {
+			return tokens.Token{Type: tokens.TokenIllegal, Literal: ""}, fmt.Errorf("invalid constant pool index")
+		}
+		b.pos += n
+		literal = b.constants[index]
 	} else {
-		// Otherwise, read a length-prefixed literal.
+		// Otherwise, read a literal in the inline format of token data
+		// exported before the constant pool, prefixed by a one-byte length.
 		if b.pos+1 > len(b.data) {
 			return tokens.Token{Type: tokens.TokenIllegal, Literal: ""}, fmt.Errorf("unexpected end of data reading literal length")
 		}
@@ -55,18 +171,50 @@ func (b *ByteCodeReader) NextToken() (tokens.Token, error) {
 		b.pos += int(length)
 	}
 
-	// Construct the token. Note: line/column info isn't preserved here.
+	// Line/column info isn't stored in the bytecode; recover it from the
+	// embedded source when available.
+	line, column := -1, -1
+	if b.srcLex != nil {
+		srcTok, err := b.srcLex.NextToken()
+		if err == nil && srcTok.Type == tokenType {
+			line, column = srcTok.Line, srcTok.Column
+		} else {
+			b.srcLex = nil
+		}
+	}
+
 	return tokens.Token{
 		Type:    tokenType,
 		Literal: literal,
-		Line:    -1,
-		Column:  -1,
+		Line:    line,
+		Column:  column,
 	}, nil
 }
 
 // NewByteCodeReaderFromSignedData verifies the RSA signature over the token data
-// and returns a ByteCodeReader if the signature is valid.
+// and returns a ByteCodeReader if the signature is valid and the signed
+// metadata has not expired.
 func NewByteCodeReaderFromSignedData(data []byte, pub *rsa.PublicKey) (*ByteCodeReader, error) {
+	return newSignedReader(data, pub, time.Now())
+}
+
+// newSignedReader is NewByteCodeReaderFromSignedData checking expiry
+// against now.
+func newSignedReader(data []byte, pub *rsa.PublicKey, now time.Time) (*ByteCodeReader, error) {
+	tokenData, err := VerifySignedData(data, pub)
+	if err != nil {
+		return nil, err
+	}
+	reader := NewByteCodeReader(tokenData)
+	if meta := reader.Metadata(); meta != nil && meta.Expired(now) {
+		return nil, fmt.Errorf("compiled rule expired at %s", meta.ExpiresTime().Format(time.RFC3339))
+	}
+	return reader, nil
+}
+
+// VerifySignedData verifies the RSA signature over the token data and returns
+// the signed payload.
+func VerifySignedData(data []byte, pub *rsa.PublicKey) ([]byte, error) {
 	sigSize := pub.Size() // RSA signature size in bytes.
 	if len(data) < len(tokens.HeaderMagic)+4+sigSize {
 		return nil, fmt.Errorf("data too short to contain valid signed tokens")
@@ -97,7 +245,7 @@ func NewByteCodeReaderFromSignedData(data []byte, pub *rsa.PublicKey) (*ByteCode
 		return nil, fmt.Errorf("invalid signature: %v", err)
 	}
 
-	return NewByteCodeReader(tokenData), nil
+	return tokenData, nil
 }
 
 // And a reverse mapping to convert a byte code back to a TokenType.
@@ -0,0 +1,80 @@
+package bytecode
+
+import (
+	"github.com/SpecDrivenDesign/lql/pkg/lexer"
+	"github.com/SpecDrivenDesign/lql/pkg/tokens"
+	"strings"
+	"testing"
+)
+
+func readAll(t *testing.T, r *ByteCodeReader) []tokens.Token {
+	t.Helper()
+	var toks []tokens.Token
+	for {
+		tok, err := r.NextToken()
+		if err != nil {
+			t.Fatal(err)
+		}
+		toks = append(toks, tok)
+		if tok.Type == tokens.TokenEof {
+			return toks
+		}
+	}
+}
+
+func TestExportedTokensRoundTrip(t *testing.T) {
+	long := strings.Repeat("x", 300)
+	src := `$a == "` + long + `" OR $b == "` + long + `" OR $c == "short"`
+	want, err := lexer.NewLexer(src).Tokens()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := lexer.NewLexer(src).ExportTokens()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(string(data), long) != 1 {
+		t.Errorf("repeated literal stored %d times, want once", strings.Count(string(data), long))
+	}
+	got := readAll(t, NewByteCodeReader(data))
+	if len(got) != len(want) {
+		t.Fatalf("read %d tokens, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].Type != want[i].Type || got[i].Literal != want[i].Literal {
+			t.Errorf("token %d = %v %q, want %v %q", i, got[i].Type, got[i].Literal, want[i].Type, want[i].Literal)
+		}
+	}
+}
+
+func TestInlineTokensStillLoad(t *testing.T) {
+	// Token data exported before the constant pool: each literal inline
+	// behind a one-byte length.
+	var data []byte
+	data = append(data, tokens.TokenTypeToByte[tokens.TokenString], 2, 'h', 'i')
+	data = append(data, tokens.TokenTypeToByte[tokens.TokenEq])
+	data = append(data, tokens.TokenTypeToByte[tokens.TokenString], 2, 'h', 'i')
+	data = append(data, tokens.TokenTypeToByte[tokens.TokenEof], 0)
+	got := readAll(t, NewByteCodeReader(data))
+	if len(got) != 4 || got[0].Literal != "hi" || got[1].Type != tokens.TokenEq || got[2].Literal != "hi" {
+		t.Errorf("got %v", got)
+	}
+}
+
+func TestSections(t *testing.T) {
+	data, err := tokens.AppendSection(nil, tokens.SourceMagic, []byte("1 + 2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = append(data, "rest"...)
+	payload, rest, ok := readSection(data, tokens.SourceMagic)
+	if !ok || string(payload) != "1 + 2" || string(rest) != "rest" {
+		t.Errorf("readSection = %q, %q, %v", payload, rest, ok)
+	}
+	if _, _, ok := readSection(data, tokens.CodeMagic); ok {
+		t.Error("readSection matched another magic")
+	}
+	if _, _, ok := readSection(data[:10], tokens.SourceMagic); ok {
+		t.Error("readSection accepted a truncated section")
+	}
+}
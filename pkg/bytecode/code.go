@@ -0,0 +1,20 @@
+package bytecode
+
+import (
+	"github.com/SpecDrivenDesign/lql/pkg/tokens"
+)
+
+// WithCode returns the data of an artifact that holds compiled
+// instructions instead of tokens: a source section when source is not
+// empty, followed by a code section. Metadata and signing apply to it as
+// to token data.
+func WithCode(code []byte, source string) ([]byte, error) {
+	var data []byte
+	if source != "" {
+		var err error
+		if data, err = tokens.AppendSection(data, tokens.SourceMagic, []byte(source)); err != nil {
+			return nil, err
+		}
+	}
+	return tokens.AppendSection(data, tokens.CodeMagic, code)
+}
@@ -0,0 +1,75 @@
+package bytecode
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"github.com/SpecDrivenDesign/lql/pkg/lexer"
+	"github.com/SpecDrivenDesign/lql/pkg/signing"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignedExpiry(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := lexer.NewLexer(`$a > 1`).ExportTokens()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.UnixMilli(1_700_000_000_000)
+	sign := func(expiresAt int64) []byte {
+		data, err := WithMetadata(Metadata{ExpiresAt: expiresAt}, payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signed, err := signing.SignTokenData(data, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+	tests := []struct {
+		name      string
+		expiresAt int64
+		expired   bool
+	}{
+		{"no expiry", 0, false},
+		{"expires later", now.UnixMilli() + 1, false},
+		{"expires now", now.UnixMilli(), true},
+		{"expired", now.UnixMilli() - 1, true},
+	}
+	for _, tt := range tests {
+		reader, err := newSignedReader(sign(tt.expiresAt), &key.PublicKey, now)
+		switch {
+		case tt.expired && (err == nil || !strings.Contains(err.Error(), "expired")):
+			t.Errorf("%s: got %v, want an expiry error", tt.name, err)
+		case !tt.expired && err != nil:
+			t.Errorf("%s: %v", tt.name, err)
+		case !tt.expired:
+			readAll(t, reader)
+		}
+	}
+
+	// The current time is used outside tests.
+	if _, err := NewByteCodeReaderFromSignedData(sign(time.Now().Add(-time.Minute).UnixMilli()), &key.PublicKey); err == nil {
+		t.Error("expired bytecode was accepted")
+	}
+	if _, err := NewByteCodeReaderFromSignedData(sign(time.Now().Add(time.Hour).UnixMilli()), &key.PublicKey); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestUnsignedBytecodeHasNoExpiry(t *testing.T) {
+	payload, err := lexer.NewLexer(`$a > 1`).ExportTokens()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := WithMetadata(Metadata{ExpiresAt: 1}, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	readAll(t, NewByteCodeReader(data))
+}
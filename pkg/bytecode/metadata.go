@@ -0,0 +1,49 @@
+package bytecode
+
+import (
+	"encoding/json"
+	"github.com/SpecDrivenDesign/lql/pkg/tokens"
+	"time"
+)
+
+// Metadata describes a compiled rule. When embedded in signed bytecode it is
+// covered by the signature along with the tokens.
+type Metadata struct {
+	IssuedAt  int64             `json:"issuedAt,omitempty"`  // epoch millis
+	ExpiresAt int64             `json:"expiresAt,omitempty"` // epoch millis, 0 means no expiry; only signed bytecode is checked
+	Labels    map[string]string `json:"labels,omitempty"`
+	// LanguageVersion is the language version the rule was compiled for;
+	// executors must parse the tokens at that version.
+	LanguageVersion string `json:"languageVersion,omitempty"`
+}
+
+// Expired reports whether the metadata carries an expiry that is at or before now.
+func (m *Metadata) Expired(now time.Time) bool {
+	return m.ExpiresAt != 0 && now.UnixMilli() >= m.ExpiresAt
+}
+
+// ExpiresTime returns the expiry as a time.Time in UTC.
+func (m *Metadata) ExpiresTime() time.Time {
+	return time.UnixMilli(m.ExpiresAt).UTC()
+}
+
+// WithMetadata prefixes token data with an encoded metadata section.
+func WithMetadata(meta Metadata, tokenData []byte) ([]byte, error) {
+	encoded, err := json.Marshal(meta)
+	if err != nil {
+		return nil, err
+	}
+	section, err := tokens.AppendSection(nil, tokens.MetadataMagic, encoded)
+	if err != nil {
+		return nil, err
+	}
+	return append(section, tokenData...), nil
+}
+
+func decodeMetadata(data []byte) (*Metadata, error) {
+	var meta Metadata
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, err
+	}
+	return &meta, nil
+}
@@ -0,0 +1,138 @@
+package bytecode
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"github.com/SpecDrivenDesign/lql/pkg/lexer"
+	"github.com/SpecDrivenDesign/lql/pkg/signing"
+	"github.com/SpecDrivenDesign/lql/pkg/tokens"
+	"testing"
+)
+
+const embeddedSource = "$user.age >= 18\n  AND string.concat($a, 'b') != \"x\""
+
+func exportEmbedded(t *testing.T, src string, embed bool) []byte {
+	t.Helper()
+	lex := lexer.NewLexer(src)
+	lex.SetEmbedSource(embed)
+	data, err := lex.ExportTokens()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestEmbeddedSourcePositions(t *testing.T) {
+	want, err := lexer.NewLexer(embeddedSource).Tokens()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader := NewByteCodeReader(exportEmbedded(t, embeddedSource, true))
+	if reader.Source() != embeddedSource {
+		t.Errorf("source %q", reader.Source())
+	}
+	got := readAll(t, reader)
+	if len(got) != len(want) {
+		t.Fatalf("read %d tokens, want %d", len(got), len(want))
+	}
+	for i := range want[:len(want)-1] {
+		if got[i].Type != want[i].Type || got[i].Line != want[i].Line || got[i].Column != want[i].Column {
+			t.Errorf("token %d = %v at %d:%d, want %v at %d:%d", i, got[i].Type, got[i].Line, got[i].Column, want[i].Type, want[i].Line, want[i].Column)
+		}
+	}
+
+	// Without a source section positions are unknown.
+	reader = NewByteCodeReader(exportEmbedded(t, embeddedSource, false))
+	if reader.Source() != "" {
+		t.Errorf("source %q was not embedded", reader.Source())
+	}
+	if tok := readAll(t, reader)[0]; tok.Line != -1 || tok.Column != -1 {
+		t.Errorf("position %d:%d, want -1:-1", tok.Line, tok.Column)
+	}
+}
+
+func TestEmbeddedSourceMismatch(t *testing.T) {
+	// A source that does not lex to the stored tokens stops supplying
+	// positions instead of reporting wrong ones.
+	data, err := tokens.AppendSection(nil, tokens.SourceMagic, []byte("$a OR $b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = append(data, exportEmbedded(t, "$a AND $b", false)...)
+	got := readAll(t, NewByteCodeReader(data))
+	if got[0].Line != 1 || got[0].Column != 1 {
+		t.Errorf("first token at %d:%d, want 1:1", got[0].Line, got[0].Column)
+	}
+	mismatched := false
+	for _, tok := range got {
+		mismatched = mismatched || tok.Type == tokens.TokenAnd
+		if mismatched && tok.Line != -1 {
+			t.Errorf("%v at %d:%d after the mismatch", tok.Type, tok.Line, tok.Column)
+		}
+	}
+}
+
+func TestStripSource(t *testing.T) {
+	plain := exportEmbedded(t, embeddedSource, false)
+	embedded := exportEmbedded(t, embeddedSource, true)
+	if stripped := StripSource(embedded); !bytes.Equal(stripped, plain) {
+		t.Errorf("stripped data differs from data exported without source")
+	}
+	if stripped := StripSource(plain); !bytes.Equal(stripped, plain) {
+		t.Errorf("data without source was changed")
+	}
+
+	// A metadata section in front of the source is kept.
+	withMeta, err := WithMetadata(Metadata{Labels: map[string]string{"team": "core"}}, embedded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader := NewByteCodeReader(StripSource(withMeta))
+	if reader.Source() != "" {
+		t.Error("source was not stripped")
+	}
+	if meta := reader.Metadata(); meta == nil || meta.Labels["team"] != "core" {
+		t.Errorf("metadata %+v", meta)
+	}
+	readAll(t, reader)
+}
+
+func TestSignedEmbeddedSource(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lex := lexer.NewLexer(embeddedSource)
+	lex.SetEmbedSource(true)
+	signed, err := lex.ExportTokensSigned(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := NewByteCodeReaderFromSignedData(signed, &key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reader.Source() != embeddedSource {
+		t.Errorf("source %q", reader.Source())
+	}
+
+	// The signature covers the source.
+	tampered := bytes.Replace(signed, []byte("18"), []byte("21"), 1)
+	if _, err := NewByteCodeReaderFromSignedData(tampered, &key.PublicKey); err == nil {
+		t.Error("a modified source passed verification")
+	}
+
+	// Stripping and re-signing keeps the bytecode valid.
+	tokenData, err := VerifySignedData(signed, &key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resigned, err := signing.SignTokenData(StripSource(tokenData), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reader, err := NewByteCodeReaderFromSignedData(resigned, &key.PublicKey); err != nil || reader.Source() != "" {
+		t.Errorf("got %v after stripping", err)
+	}
+}
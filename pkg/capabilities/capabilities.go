@@ -0,0 +1,138 @@
+// Package capabilities reports what a build of lql supports: language
+// versions, tokens, libraries and their functions, bytecode sections and
+// signing algorithms. Orchestration tooling compares reports to check that
+// an executor understands the rules compiled for it before deploying them.
+package capabilities
+
+import (
+	"github.com/SpecDrivenDesign/lql/pkg/analyze"
+	"github.com/SpecDrivenDesign/lql/pkg/bytecode"
+	"github.com/SpecDrivenDesign/lql/pkg/env"
+	"github.com/SpecDrivenDesign/lql/pkg/param"
+	"github.com/SpecDrivenDesign/lql/pkg/parser"
+	"github.com/SpecDrivenDesign/lql/pkg/signing"
+	"github.com/SpecDrivenDesign/lql/pkg/tokens"
+	"github.com/SpecDrivenDesign/lql/pkg/vm"
+	"sort"
+)
+
+// Report describes what a build supports.
+type Report struct {
+	LanguageVersions      []string  `json:"languageVersions"`
+	LatestLanguageVersion string    `json:"latestLanguageVersion"`
+	Tokens                []Token   `json:"tokens"`
+	Libraries             []Library `json:"libraries"`
+	Bytecode              Bytecode  `json:"bytecode"`
+	Signing               Signing   `json:"signing"`
+}
+
+// Token is a token type and the byte that encodes it in bytecode.
+type Token struct {
+	Name string `json:"name"`
+	Code byte   `json:"code"`
+	// Literal is the fixed spelling of the token, if it has one.
+	Literal string `json:"literal,omitempty"`
+}
+
+// Library is a library callable from expressions.
+type Library struct {
+	Name string `json:"name"`
+	// Functions lists the functions with a known signature; it is empty
+	// for custom libraries that do not declare their functions.
+	Functions []Function `json:"functions"`
+}
+
+// Function is a library function's signature, its parameters and
+// documentation as the library declares them, and the capability a caller
+// must hold to call it, if any.
+type Function struct {
+	analyze.Signature
+	Params     []param.Param `json:"params,omitempty"`
+	Doc        string        `json:"doc,omitempty"`
+	Capability string        `json:"capability,omitempty"`
+}
+
+// Bytecode describes the compiled artifact format.
+type Bytecode struct {
+	// SignedHeader is the magic that starts a signed artifact.
+	SignedHeader string `json:"signedHeader"`
+	// Sections lists the optional sections an executor reads, in order.
+	Sections []string `json:"sections"`
+	// InstructionSet is the version of the compiled instructions an
+	// executor runs.
+	InstructionSet int `json:"instructionSet"`
+}
+
+// Signing describes how artifacts are signed.
+type Signing struct {
+	Algorithms []string `json:"algorithms"`
+}
+
+// New returns the report for this build with the libraries of e.
+func New(e *env.Environment) Report {
+	report := Report{
+		LanguageVersions:      append([]string{}, parser.LanguageVersions...),
+		LatestLanguageVersion: parser.LatestLanguageVersion,
+		Bytecode: Bytecode{
+			SignedHeader:   tokens.HeaderMagic,
+			Sections:       append([]string{}, bytecode.Sections...),
+			InstructionSet: vm.Version,
+		},
+		Signing: Signing{Algorithms: append([]string{}, signing.Algorithms...)},
+	}
+
+	for tokenType, code := range tokens.TokenTypeToByte {
+		report.Tokens = append(report.Tokens, Token{
+			Name:    tokens.TokenNames[tokenType],
+			Code:    code,
+			Literal: tokens.FixedTokenLiterals[tokenType],
+		})
+	}
+	sort.Slice(report.Tokens, func(i, j int) bool { return report.Tokens[i].Code < report.Tokens[j].Code })
+
+	// cache.memo is evaluated by the interpreter rather than a library, so
+	// it is always available.
+	names := []string{"cache"}
+	for name := range e.Libraries {
+		if name != "cache" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		library := Library{Name: name, Functions: []Function{}}
+		described, _ := e.DescribeLibrary(name)
+		declared := make(map[string]env.FunctionDescription, len(described.Functions))
+		for _, fn := range described.Functions {
+			declared[fn.QualifiedName()] = fn
+		}
+		for _, sig := range analyze.LibrarySignatures(name) {
+			function := Function{Signature: sig, Capability: e.FunctionCapabilities[sig.Name]}
+			if fn, ok := declared[sig.Name]; ok {
+				function.Params, function.Doc = fn.Params, fn.Doc
+				delete(declared, sig.Name)
+			}
+			library.Functions = append(library.Functions, function)
+		}
+		// Functions of custom libraries are only known from their
+		// declarations.
+		for qualified, fn := range declared {
+			args := make([]string, len(fn.Params))
+			for i, p := range fn.Params {
+				args[i] = p.Type
+				if p.Variadic {
+					args[i] += "..."
+				}
+			}
+			library.Functions = append(library.Functions, Function{
+				Signature:  analyze.Signature{Name: qualified, Args: args, Result: fn.Result},
+				Params:     fn.Params,
+				Doc:        fn.Doc,
+				Capability: fn.Capability,
+			})
+		}
+		sort.Slice(library.Functions, func(i, j int) bool { return library.Functions[i].Name < library.Functions[j].Name })
+		report.Libraries = append(report.Libraries, library)
+	}
+	return report
+}
@@ -0,0 +1,138 @@
+package capabilities
+
+import (
+	"encoding/json"
+	"github.com/SpecDrivenDesign/lql/pkg/bytecode"
+	"github.com/SpecDrivenDesign/lql/pkg/env"
+	"github.com/SpecDrivenDesign/lql/pkg/param"
+	"github.com/SpecDrivenDesign/lql/pkg/parser"
+	"github.com/SpecDrivenDesign/lql/pkg/signing"
+	"github.com/SpecDrivenDesign/lql/pkg/tokens"
+	"github.com/SpecDrivenDesign/lql/pkg/vm"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// geo is a custom library that declares its functions.
+type geo struct{}
+
+func (geo) Call(string, []param.Arg, int, int, int, int) (interface{}, error) { return nil, nil }
+
+func (geo) Functions() []param.Function {
+	return []param.Function{
+		{Name: "lookup", Params: []param.Param{{Name: "ip", Type: param.TypeString}}, Result: param.TypeString, Doc: "Returns the country of ip."},
+		{Name: "nearest", Params: []param.Param{{Name: "points", Type: param.TypeArray}, {Name: "more", Type: param.TypeArray, Variadic: true}}, Result: param.TypeObject},
+	}
+}
+
+// opaque is a custom library that does not declare its functions.
+type opaque struct{}
+
+func (opaque) Call(string, []param.Arg, int, int, int, int) (interface{}, error) { return nil, nil }
+
+// findFunction returns the named function of the report.
+func findFunction(report Report, name string) (Function, bool) {
+	for _, lib := range report.Libraries {
+		for _, fn := range lib.Functions {
+			if fn.Name == name {
+				return fn, true
+			}
+		}
+	}
+	return Function{}, false
+}
+
+func TestReportFormat(t *testing.T) {
+	report := New(env.NewEnvironment())
+	if !slices.Equal(report.LanguageVersions, parser.LanguageVersions) || !slices.Contains(report.LanguageVersions, report.LatestLanguageVersion) {
+		t.Errorf("versions %v, latest %s", report.LanguageVersions, report.LatestLanguageVersion)
+	}
+	if report.Bytecode.SignedHeader != tokens.HeaderMagic || report.Bytecode.InstructionSet != vm.Version || !slices.Equal(report.Bytecode.Sections, bytecode.Sections) {
+		t.Errorf("bytecode %+v", report.Bytecode)
+	}
+	if !slices.Contains(report.Signing.Algorithms, signing.AlgorithmRS256) {
+		t.Errorf("algorithms %v", report.Signing.Algorithms)
+	}
+
+	if len(report.Tokens) != len(tokens.TokenTypeToByte) {
+		t.Errorf("%d tokens, want %d", len(report.Tokens), len(tokens.TokenTypeToByte))
+	}
+	if !sort.SliceIsSorted(report.Tokens, func(i, j int) bool { return report.Tokens[i].Code < report.Tokens[j].Code }) {
+		t.Error("tokens are not sorted by code")
+	}
+	want := Token{Name: tokens.TokenNames[tokens.TokenPlus], Code: tokens.TokenTypeToByte[tokens.TokenPlus], Literal: "+"}
+	if !slices.Contains(report.Tokens, want) {
+		t.Errorf("%+v is not reported", want)
+	}
+
+	// The report is a copy; changing it does not change the build's tables.
+	report.LanguageVersions[0] = "changed"
+	report.Bytecode.Sections[0] = "changed"
+	if parser.LanguageVersions[0] == "changed" || bytecode.Sections[0] == "changed" {
+		t.Error("the report shares its slices with the build")
+	}
+}
+
+func TestReportLibraries(t *testing.T) {
+	e := env.NewEnvironment()
+	e.MustRegister("geo", geo{})
+	e.MustRegister("opaque", opaque{})
+	e.RequireCapability("math.pow", "compute")
+	report := New(e)
+
+	var names []string
+	for _, lib := range report.Libraries {
+		names = append(names, lib.Name)
+		if !sort.SliceIsSorted(lib.Functions, func(i, j int) bool { return lib.Functions[i].Name < lib.Functions[j].Name }) {
+			t.Errorf("%s: functions are not sorted", lib.Name)
+		}
+	}
+	if !sort.StringsAreSorted(names) {
+		t.Errorf("libraries are not sorted: %v", names)
+	}
+	for _, name := range []string{"cache", "geo", "math", "opaque", "string", "time"} {
+		if !slices.Contains(names, name) {
+			t.Errorf("%s is not reported", name)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		args       []string
+		result     string
+		capability string
+		doc        bool
+	}{
+		{"math.pow", []string{"numeric", "numeric"}, "numeric", "compute", true},
+		{"time.now", []string{}, "Time", env.CapabilityTime, true},
+		{"cache.memo", []string{"string", "any", "numeric"}, "any", "", true},
+		// Custom libraries are described by their declarations.
+		{"geo.lookup", []string{"string"}, "string", "", true},
+		{"geo.nearest", []string{"array", "array..."}, "object", "", false},
+	}
+	for _, tt := range tests {
+		fn, ok := findFunction(report, tt.name)
+		if !ok {
+			t.Errorf("%s is not reported", tt.name)
+			continue
+		}
+		if !slices.Equal(fn.Args, tt.args) || fn.Result != tt.result || fn.Capability != tt.capability || (fn.Doc != "") != tt.doc {
+			t.Errorf("%s: got args %v, result %s, capability %q, doc %q", tt.name, fn.Args, fn.Result, fn.Capability, fn.Doc)
+		}
+	}
+	if fn, _ := findFunction(report, "math.pow"); len(fn.Params) != 2 || fn.Params[0].Name == "" {
+		t.Errorf("math.pow params %+v", fn.Params)
+	}
+
+	data, err := json.Marshal(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`{"name":"opaque","functions":[]}`, `"latestLanguageVersion":`, `"instructionSet":`, `{"name":"time.now","args":[],"result":"Time"`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("the JSON report does not contain %s", want)
+		}
+	}
+}
@@ -0,0 +1,499 @@
+// Package compile turns a parsed expression into a tree of Go closures for
+// fast repeated evaluation. Operators, libraries and the capabilities
+// functions require are resolved once, when the program is compiled, rather
+// than on every evaluation:
+//
+//	program := compile.Compile(expr, env.NewEnvironment())
+//	for _, ctx := range contexts {
+//		result, err := program.Eval(ctx)
+//		...
+//	}
+//
+// A program gives the same results and errors as evaluating the expression
+// directly with the environment it was compiled for. Programs are safe for
+// concurrent use, so one program can serve every goroutine of a host.
+package compile
+
+import (
+	"fmt"
+	"github.com/SpecDrivenDesign/lql/pkg/analyze"
+	"github.com/SpecDrivenDesign/lql/pkg/ast"
+	"github.com/SpecDrivenDesign/lql/pkg/ast/expressions"
+	"github.com/SpecDrivenDesign/lql/pkg/env"
+	"github.com/SpecDrivenDesign/lql/pkg/errors"
+	"github.com/SpecDrivenDesign/lql/pkg/lexer"
+	"github.com/SpecDrivenDesign/lql/pkg/param"
+	"github.com/SpecDrivenDesign/lql/pkg/parser"
+	"github.com/SpecDrivenDesign/lql/pkg/result"
+	"github.com/SpecDrivenDesign/lql/pkg/tokens"
+)
+
+// evalFunc evaluates a compiled node against a context in a scope, with
+// the memo table of the evaluation.
+type evalFunc func(ctx map[string]interface{}, scope *env.Scope, memo []memoSlot) (interface{}, error)
+
+// memoSlot holds the result of a memoized subexpression within one
+// evaluation.
+type memoSlot struct {
+	value interface{}
+	done  bool
+}
+
+// Program is an expression compiled for an environment.
+//
+// Eval may be called from any number of goroutines at once. A program is
+// not modified after Compile returns, and evaluations share no state
+// except through the environment, whose cache, dry-run record and random
+// library are safe for concurrent use. Each evaluation counts its own use
+// of Limits and collects its own metrics. An Observer and a metrics sink
+// must be safe for concurrent use themselves. The environment, including
+// its capabilities, must not be changed while evaluations are running, and
+// a context must not be changed while it is being evaluated.
+type Program struct {
+	expr  ast.Expression
+	env   *env.Environment
+	eval  evalFunc
+	slots int // the size of the memo table each evaluation needs
+}
+
+// Options configures CompileWithOptions.
+type Options struct {
+	// Memoize evaluates repeated subexpressions once per evaluation.
+	// Subexpressions with the same fingerprint share the result of the
+	// first of them to succeed; errors are not shared, so each occurrence
+	// reports its own position. Only deterministic subexpressions are
+	// memoized.
+	Memoize bool
+	// Purity describes host-provided functions, so that calls to volatile
+	// ones are not memoized.
+	Purity analyze.PurityOptions
+}
+
+// Compile compiles expr for evaluation with e. Libraries added to or
+// replaced in e afterwards, and changes to e.FunctionCapabilities, are not
+// seen by the program; capabilities granted or revoked are.
+func Compile(expr ast.Expression, e *env.Environment) *Program {
+	return CompileWithOptions(expr, e, Options{})
+}
+
+// CompileWithOptions compiles expr for evaluation with e, as Compile does,
+// with opts.
+func CompileWithOptions(expr ast.Expression, e *env.Environment, opts Options) *Program {
+	c := &compiler{env: e}
+	if opts.Memoize {
+		c.assignSlots(expr, opts.Purity)
+	}
+	return &Program{expr: expr, env: e, eval: c.compile(expr), slots: c.slotCount}
+}
+
+// Parse parses source and compiles it for evaluation with e.
+func Parse(source string, e *env.Environment) (*Program, error) {
+	p, err := parser.NewParser(lexer.NewLexer(source))
+	if err != nil {
+		return nil, err
+	}
+	expr, err := p.ParseExpression()
+	if err != nil {
+		return nil, err
+	}
+	return Compile(expr, e), nil
+}
+
+// Expression returns the compiled expression.
+func (p *Program) Expression() ast.Expression {
+	return p.expr
+}
+
+// Eval evaluates the program against ctx. While the environment has an
+// observer, resource limits, a dry run or a metrics sink, which act on
+// every node, or evaluates subexpressions in parallel, the expression is
+// evaluated node by node as by its Eval method instead.
+func (p *Program) Eval(ctx map[string]interface{}) (interface{}, error) {
+	return p.EvalIn(ctx, nil)
+}
+
+// EvalIn evaluates the program against ctx in scope, which holds the roots
+// the evaluation reads (see env.NewScope), as Eval does.
+func (p *Program) EvalIn(ctx map[string]interface{}, scope *env.Scope) (interface{}, error) {
+	if p.env.Observer != nil || p.env.Limits != (env.Limits{}) || p.env.DryRun != nil || p.env.Metrics != nil || p.env.Parallel() {
+		return expressions.EvalIn(p.expr, ctx, scope, p.env)
+	}
+	var memo []memoSlot
+	if p.slots > 0 {
+		memo = make([]memoSlot, p.slots)
+	}
+	return p.eval(ctx, scope, memo)
+}
+
+// EvalResult evaluates the program against ctx, as Eval does, and wraps
+// the value so it can be read as a Go type.
+func (p *Program) EvalResult(ctx map[string]interface{}) (result.Result, error) {
+	value, err := p.Eval(ctx)
+	if err != nil {
+		return result.Result{}, err
+	}
+	return result.Of(value), nil
+}
+
+type compiler struct {
+	env *env.Environment
+	// slots maps the nodes to memoize to their memo table index.
+	slots     map[ast.Expression]int
+	slotCount int
+}
+
+// assignSlots finds the deterministic subexpressions that occur more than
+// once in expr and gives each distinct one a memo table slot. Literals and
+// context references are cheaper to evaluate than to memoize. Subexpressions
+// that read LET variables are not memoized, as the same variable can hold
+// different values in different scopes.
+func (c *compiler) assignSlots(expr ast.Expression, purity analyze.PurityOptions) {
+	readsVariables := make(map[ast.Expression]bool)
+	markVariableReads(expr, readsVariables)
+	fingerprints := make(map[ast.Expression]string)
+	counts := make(map[string]int)
+	ast.Inspect(expr, func(node ast.Expression) bool {
+		switch node.(type) {
+		case *expressions.LiteralExpr, *expressions.ContextExpr, *expressions.PlaceholderExpr, *expressions.IdentifierExpr:
+			return true
+		}
+		if readsVariables[node] || !analyze.AnalyzePurity(node, purity).Deterministic() {
+			return true
+		}
+		fp := ast.Fingerprint(node)
+		fingerprints[node] = fp
+		counts[fp]++
+		return true
+	})
+	c.slots = make(map[ast.Expression]int)
+	indexes := make(map[string]int)
+	for node, fp := range fingerprints {
+		if counts[fp] < 2 {
+			continue
+		}
+		index, ok := indexes[fp]
+		if !ok {
+			index = c.slotCount
+			indexes[fp] = index
+			c.slotCount++
+		}
+		c.slots[node] = index
+	}
+}
+
+// markVariableReads marks node in marked if it or any node below it reads a
+// LET variable, and reports whether it does.
+func markVariableReads(node ast.Expression, marked map[ast.Expression]bool) bool {
+	_, reads := node.(*expressions.IdentifierExpr)
+	for _, child := range ast.Children(node) {
+		if markVariableReads(child, marked) {
+			reads = true
+		}
+	}
+	if reads {
+		marked[node] = true
+	}
+	return reads
+}
+
+// compile returns the closure evaluating node, memoized if node has a memo
+// table slot. An error unwinding out of node is annotated with its
+// metadata, as the tree evaluator does.
+func (c *compiler) compile(node ast.Expression) evalFunc {
+	fn := c.compileNode(node)
+	if meta := ast.MetadataOf(node); len(meta) > 0 {
+		inner := fn
+		fn = func(ctx map[string]interface{}, scope *env.Scope, memo []memoSlot) (interface{}, error) {
+			val, err := inner(ctx, scope, memo)
+			if err != nil {
+				return nil, ast.WithMetadata(err, meta)
+			}
+			return val, nil
+		}
+	}
+	slot, ok := c.slots[node]
+	if !ok {
+		return fn
+	}
+	return func(ctx map[string]interface{}, scope *env.Scope, memo []memoSlot) (interface{}, error) {
+		if memo[slot].done {
+			return memo[slot].value, nil
+		}
+		val, err := fn(ctx, scope, memo)
+		if err == nil {
+			memo[slot] = memoSlot{value: val, done: true}
+		}
+		return val, err
+	}
+}
+
+// compileNode returns the closure evaluating node. Nodes without a
+// specialised closure are evaluated by their Eval method.
+func (c *compiler) compileNode(node ast.Expression) evalFunc {
+	switch n := node.(type) {
+	case *expressions.LiteralExpr:
+		value := n.Value
+		return func(ctx map[string]interface{}, scope *env.Scope, memo []memoSlot) (interface{}, error) {
+			return value, nil
+		}
+	case *expressions.ContextExpr:
+		return c.compileContext(n)
+	case *expressions.MemberAccessExpr:
+		return c.compileMemberAccess(n)
+	case *expressions.UnaryExpr:
+		return c.compileUnary(n)
+	case *expressions.BinaryExpr:
+		return c.compileBinary(n)
+	case *expressions.BetweenExpr:
+		return c.compileBetween(n)
+	case *expressions.FunctionCallExpr:
+		return c.compileFunctionCall(n)
+	case *expressions.ArrayLiteralExpr:
+		return c.compileArrayLiteral(n)
+	case *expressions.LetExpr:
+		return c.compileLet(n)
+	}
+	return c.interpret(node)
+}
+
+// interpret returns a closure evaluating node by its Eval method.
+func (c *compiler) interpret(node ast.Expression) evalFunc {
+	e := c.env
+	return func(ctx map[string]interface{}, scope *env.Scope, memo []memoSlot) (interface{}, error) {
+		return expressions.EvalIn(node, ctx, scope, e)
+	}
+}
+
+func (c *compiler) compileLet(n *expressions.LetExpr) evalFunc {
+	value, body := c.compile(n.Value), c.compile(n.Body)
+	name := n.Name
+	return func(ctx map[string]interface{}, scope *env.Scope, memo []memoSlot) (interface{}, error) {
+		val, err := value(ctx, scope, memo)
+		if err != nil {
+			return nil, err
+		}
+		return body(ctx, scope.WithVariable(name, val), memo)
+	}
+}
+
+func (c *compiler) compileContext(n *expressions.ContextExpr) evalFunc {
+	if n.Ident == nil {
+		return func(ctx map[string]interface{}, scope *env.Scope, memo []memoSlot) (interface{}, error) {
+			return ctx, nil
+		}
+	}
+	lookup := c.compileLookup(n)
+	line, column := n.Line, n.Column
+	return func(ctx map[string]interface{}, scope *env.Scope, memo []memoSlot) (interface{}, error) {
+		val, err := lookup(ctx, scope, memo)
+		if err != nil {
+			return nil, err
+		}
+		return expressions.ResolveValue(val, line, column)
+	}
+}
+
+// compileLookup returns the closure reading the context field named by n,
+// leaving a ContextProvider unresolved, as ContextExpr.Lookup does.
+func (c *compiler) compileLookup(n *expressions.ContextExpr) evalFunc {
+	name, line, column := n.Ident.Name, n.Ident.Line, n.Ident.Column
+	e := c.env
+	return func(ctx map[string]interface{}, scope *env.Scope, memo []memoSlot) (interface{}, error) {
+		if val, ok := scope.Lookup(ctx, name); ok || e.Lenient {
+			return val, nil
+		}
+		return nil, errors.NewReferenceError(fmt.Sprintf("field '%s' not found", name), line, column)
+	}
+}
+
+func (c *compiler) compileMemberAccess(n *expressions.MemberAccessExpr) evalFunc {
+	var target evalFunc
+	if ctxExpr, ok := n.Target.(*expressions.ContextExpr); ok && ctxExpr.Ident != nil {
+		target = c.compileLookup(ctxExpr)
+	} else {
+		target = c.compile(n.Target)
+	}
+	e := c.env
+	return func(ctx map[string]interface{}, scope *env.Scope, memo []memoSlot) (interface{}, error) {
+		val, err := target(ctx, scope, memo)
+		if err != nil {
+			return nil, err
+		}
+		return n.Access(val, ctx, scope, e)
+	}
+}
+
+func (c *compiler) compileUnary(n *expressions.UnaryExpr) evalFunc {
+	apply, ok := expressions.UnaryOperator(n.Operator)
+	if !ok {
+		return c.interpret(n)
+	}
+	operand := c.compile(n.Expr)
+	line, column := n.Line, n.Column
+	return func(ctx map[string]interface{}, scope *env.Scope, memo []memoSlot) (interface{}, error) {
+		val, err := operand(ctx, scope, memo)
+		if err != nil {
+			return nil, err
+		}
+		return apply(val, line, column)
+	}
+}
+
+func (c *compiler) compileBetween(n *expressions.BetweenExpr) evalFunc {
+	subject, low, high := c.compile(n.Subject), c.compile(n.Low), c.compile(n.High)
+	line, column, e := n.Line, n.Column, c.env
+	return func(ctx map[string]interface{}, scope *env.Scope, memo []memoSlot) (interface{}, error) {
+		subjectVal, err := subject(ctx, scope, memo)
+		if err != nil {
+			return nil, err
+		}
+		lowVal, err := low(ctx, scope, memo)
+		if err != nil {
+			return nil, err
+		}
+		above, err := expressions.CompareBetween(tokens.TokenGte, subjectVal, lowVal, line, column, scope, e)
+		if err != nil || !above {
+			return above, err
+		}
+		highVal, err := high(ctx, scope, memo)
+		if err != nil {
+			return nil, err
+		}
+		return expressions.CompareBetween(tokens.TokenLte, subjectVal, highVal, line, column, scope, e)
+	}
+}
+
+func (c *compiler) compileBinary(n *expressions.BinaryExpr) evalFunc {
+	left, right := c.compile(n.Left), c.compile(n.Right)
+	line, column := n.Line, n.Column
+	switch n.Operator {
+	case tokens.TokenAnd, tokens.TokenOr:
+		// AND stops at false and OR at true.
+		stop := n.Operator == tokens.TokenOr
+		message := fmt.Sprintf("%s operator requires boolean operand", tokens.FixedTokenLiterals[n.Operator])
+		return func(ctx map[string]interface{}, scope *env.Scope, memo []memoSlot) (interface{}, error) {
+			leftVal, err := left(ctx, scope, memo)
+			if err != nil {
+				return nil, err
+			}
+			lb, ok := leftVal.(bool)
+			if !ok {
+				return nil, errors.NewSemanticError(message, line, column)
+			}
+			if lb == stop {
+				return stop, nil
+			}
+			rightVal, err := right(ctx, scope, memo)
+			if err != nil {
+				return nil, err
+			}
+			rb, ok := rightVal.(bool)
+			if !ok {
+				return nil, errors.NewSemanticError(message, line, column)
+			}
+			return rb, nil
+		}
+	}
+	apply, ok := expressions.BinaryOperator(n.Operator)
+	if !ok {
+		return c.interpret(n)
+	}
+	op, e := n.Operator, c.env
+	return func(ctx map[string]interface{}, scope *env.Scope, memo []memoSlot) (interface{}, error) {
+		leftVal, err := left(ctx, scope, memo)
+		if err != nil {
+			return nil, err
+		}
+		rightVal, err := right(ctx, scope, memo)
+		if err != nil {
+			return nil, err
+		}
+		return expressions.ApplyBinary(op, apply, leftVal, rightVal, line, column, scope, e)
+	}
+}
+
+// compileFunctionCall binds the library once. Calls the evaluator handles
+// specially, and calls to libraries that do not exist, are interpreted.
+func (c *compiler) compileFunctionCall(n *expressions.FunctionCallExpr) evalFunc {
+	if len(n.Namespace) < 2 || (n.Namespace[0] == "cache" && n.Namespace[1] == "memo") {
+		return c.interpret(n)
+	}
+	libName, funcName := n.Namespace[0], n.Namespace[1]
+	lib, ok := c.env.GetLibrary(libName)
+	if !ok {
+		return c.interpret(n)
+	}
+	e := c.env
+	capability, gated := e.FunctionCapabilities[libName+"."+funcName]
+	line, column, parenLine, parenColumn := n.Line, n.Column, n.ParenLine, n.ParenColumn
+	checkAccess := func() error {
+		if err := e.CheckProfile(libName, funcName, line, column); err != nil {
+			return err
+		}
+		if gated && !e.Capabilities[capability] {
+			return errors.NewCapabilityError(fmt.Sprintf("%s.%s requires capability '%s'", libName, funcName, capability), line, column)
+		}
+		return nil
+	}
+
+	argFns := make([]evalFunc, len(n.Args))
+	positions := make([]param.Arg, len(n.Args))
+	for i, arg := range n.Args {
+		argFns[i] = c.compile(arg)
+		positions[i].Line, positions[i].Column = arg.Pos()
+	}
+
+	if lazy, ok := lib.(env.LazyLibrary); ok && lazy.Lazy(funcName) {
+		return func(ctx map[string]interface{}, scope *env.Scope, memo []memoSlot) (interface{}, error) {
+			if err := checkAccess(); err != nil {
+				return nil, err
+			}
+			args := make([]param.LazyArg, len(argFns))
+			for i, argFn := range argFns {
+				argFn := argFn
+				args[i] = param.LazyArg{Line: positions[i].Line, Column: positions[i].Column, Eval: func() (interface{}, error) {
+					return argFn(ctx, scope, memo)
+				}, EvalWith: func(value interface{}) (interface{}, error) {
+					return argFn(ctx, scope.WithVariable(env.ItemVariable, value), memo)
+				}}
+			}
+			return e.HookLazyCall(libName, funcName, line, column, func() (interface{}, error) {
+				return lazy.CallLazy(funcName, args, line, column, parenLine, parenColumn)
+			})
+		}
+	}
+	return func(ctx map[string]interface{}, scope *env.Scope, memo []memoSlot) (interface{}, error) {
+		if err := checkAccess(); err != nil {
+			return nil, err
+		}
+		args := make([]param.Arg, len(argFns))
+		for i, argFn := range argFns {
+			val, err := argFn(ctx, scope, memo)
+			if err != nil {
+				return nil, err
+			}
+			args[i] = param.Arg{Value: val, Line: positions[i].Line, Column: positions[i].Column}
+		}
+		return e.HookCall(libName, funcName, args, line, column, func() (interface{}, error) {
+			return lib.Call(funcName, args, line, column, parenLine, parenColumn)
+		})
+	}
+}
+
+func (c *compiler) compileArrayLiteral(n *expressions.ArrayLiteralExpr) evalFunc {
+	elements := make([]evalFunc, len(n.Elements))
+	for i, elem := range n.Elements {
+		elements[i] = c.compile(elem)
+	}
+	return func(ctx map[string]interface{}, scope *env.Scope, memo []memoSlot) (interface{}, error) {
+		var result []interface{}
+		for _, element := range elements {
+			val, err := element(ctx, scope, memo)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, val)
+		}
+		return result, nil
+	}
+}
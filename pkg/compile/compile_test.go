@@ -0,0 +1,137 @@
+package compile
+
+import (
+	"github.com/SpecDrivenDesign/lql/pkg/analyze"
+	"github.com/SpecDrivenDesign/lql/pkg/env"
+	"github.com/SpecDrivenDesign/lql/pkg/lexer"
+	"github.com/SpecDrivenDesign/lql/pkg/parser"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestProgramConcurrentEvaluations(t *testing.T) {
+	const goroutines, runs = 16, 50
+	e := env.NewEnvironment()
+	var mu sync.Mutex
+	var recorded []env.Metrics
+	e.Metrics = env.MetricsFunc(func(m env.Metrics) {
+		mu.Lock()
+		recorded = append(recorded, m)
+		mu.Unlock()
+	})
+	program, err := Parse(`math.max([$a, $b]) > 10 AND string.concat($s, "!") != "stop!"`, e)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The budget of a single evaluation is about what it uses, so
+	// evaluations drawing on a shared budget would exceed it.
+	ctx := map[string]interface{}{"a": int64(11), "b": int64(9), "s": "go"}
+	if _, err := program.Eval(ctx); err != nil {
+		t.Fatal(err)
+	}
+	want := recorded[0]
+	want.WallTime = 0
+	recorded = nil
+	e.Limits = env.Limits{MaxNodeEvaluations: want.NodeEvaluations, MaxAllocatedBytes: 64}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, goroutines)
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < runs; i++ {
+				a := int64(11 + g + i)
+				got, err := program.Eval(map[string]interface{}{"a": a, "b": int64(9), "s": "go"})
+				if err != nil {
+					errs <- err
+					return
+				}
+				if got != true {
+					t.Errorf("a = %d: got %v, want true", a, got)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	if len(recorded) != goroutines*runs {
+		t.Fatalf("recorded %d metrics, want %d", len(recorded), goroutines*runs)
+	}
+	for _, m := range recorded {
+		m.WallTime = 0
+		if !reflect.DeepEqual(m, want) {
+			t.Fatalf("recorded %+v, want %+v", m, want)
+		}
+	}
+}
+
+func TestProgramLimitsArePerEvaluation(t *testing.T) {
+	e := env.NewEnvironment()
+	e.Limits = env.Limits{MaxNodeEvaluations: 3}
+	program, err := Parse(`$a + 1`, e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		if _, err := program.Eval(map[string]interface{}{"a": int64(i)}); err != nil {
+			t.Fatalf("evaluation %d: %v", i, err)
+		}
+	}
+	longer, err := Parse(`$a + 1 + 2`, e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := longer.Eval(map[string]interface{}{"a": int64(1)}); err == nil {
+		t.Error("an evaluation over the limit succeeded")
+	}
+}
+
+func TestMemoizeSkipsVolatileSubexpressions(t *testing.T) {
+	src := `cache.memo("k", $a + 1, 0) + cache.memo("k", $a + 1, 0) + random.token(4) + random.token(4)`
+	p, err := parser.NewParser(lexer.NewLexer(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expr, err := p.ParseExpression()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &compiler{env: env.NewEnvironment()}
+	c.assignSlots(expr, analyze.PurityOptions{})
+	// Only the two occurrences of $a + 1 share a slot.
+	if c.slotCount != 1 {
+		t.Errorf("%d slots, want 1", c.slotCount)
+	}
+	for node := range c.slots {
+		if got := node.String(); got != "$a + 1" {
+			t.Errorf("%s is memoized", got)
+		}
+	}
+}
+
+func TestEvalResult(t *testing.T) {
+	program, err := Parse(`$a / $b`, env.NewEnvironment())
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := program.EvalResult(map[string]interface{}{"a": int64(7), "b": int64(2)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := res.AsInt64(); err != nil || got != 3 {
+		t.Errorf("got %v, %v; want 3", got, err)
+	}
+	if _, err := res.AsString(); err == nil {
+		t.Error("an int was read as a string")
+	}
+	if _, err := program.EvalResult(map[string]interface{}{"a": int64(7), "b": int64(0)}); err == nil {
+		t.Error("division by zero succeeded")
+	}
+}
@@ -0,0 +1,278 @@
+// Package debug evaluates expressions under a step debugger. Evaluation
+// pauses at breakpoints and while stepping, and a handler inspects the node
+// being evaluated, the values of its sub-expressions and the path from the
+// root before choosing how to continue:
+//
+//	d := debug.New(func(s *debug.Stop) debug.Action {
+//		fmt.Println(s)
+//		return debug.StepOver
+//	})
+//	d.SetBreakpoint(1, 11)
+//	result, err := d.Run(expr, ctx, env.NewEnvironment())
+//
+// ExplainEval evaluates an expression in one go and reports the value of
+// every node afterwards.
+package debug
+
+import (
+	stdErrors "errors"
+	"fmt"
+	"github.com/SpecDrivenDesign/lql/pkg/ast"
+	"github.com/SpecDrivenDesign/lql/pkg/env"
+	"sort"
+)
+
+// ErrAborted is returned by Run when the handler chose Abort.
+var ErrAborted = stdErrors.New("debug: evaluation aborted")
+
+// Event is the point of a node's evaluation at which the debugger stopped.
+type Event int
+
+const (
+	// Enter stops before the node is evaluated.
+	Enter Event = iota
+	// Leave stops after the node is evaluated, with its result.
+	Leave
+)
+
+func (e Event) String() string {
+	if e == Leave {
+		return "leave"
+	}
+	return "enter"
+}
+
+// Action tells the debugger how to continue after a stop.
+type Action int
+
+const (
+	// Continue runs to the next breakpoint.
+	Continue Action = iota
+	// StepInto stops at the next node entered or left.
+	StepInto
+	// StepOver stops at the next event that is not inside the current
+	// node: when stopped on entering a node, that is leaving it.
+	StepOver
+	// StepOut stops when the parent of the current node is left.
+	StepOut
+	// Abort ends the evaluation; Run returns ErrAborted.
+	Abort
+)
+
+// Breakpoint stops evaluation on entering a node that starts at Line and
+// Column. A zero Column matches the outermost node entered on the line.
+type Breakpoint struct {
+	Line   int
+	Column int
+}
+
+// Result is the evaluated value of a sub-expression.
+type Result struct {
+	Node  ast.Expression
+	Value interface{}
+	Err   error
+}
+
+// Frame is a node under evaluation, with the results of the
+// sub-expressions it has evaluated so far.
+type Frame struct {
+	Node     ast.Expression
+	Children []Result
+}
+
+// Stop describes a paused evaluation. It is only valid during the call to
+// the handler.
+type Stop struct {
+	Event  Event
+	Node   ast.Expression
+	Line   int
+	Column int
+	// Value and Err hold the node's result when Event is Leave.
+	Value interface{}
+	Err   error
+	// Stack holds the nodes under evaluation from the root down to Node.
+	Stack []Frame
+	// Context is the context the expression is evaluated against.
+	Context map[string]interface{}
+}
+
+// Depth returns the nesting depth of Node; the root has depth 1.
+func (s *Stop) Depth() int {
+	return len(s.Stack)
+}
+
+// Children returns the results of the sub-expressions of Node evaluated so
+// far.
+func (s *Stop) Children() []Result {
+	return s.Stack[len(s.Stack)-1].Children
+}
+
+func (s *Stop) String() string {
+	if s.Event == Leave {
+		if s.Err != nil {
+			return fmt.Sprintf("leave %s at line %d, column %d: error: %v", s.Node, s.Line, s.Column, s.Err)
+		}
+		return fmt.Sprintf("leave %s at line %d, column %d: %v", s.Node, s.Line, s.Column, s.Value)
+	}
+	return fmt.Sprintf("enter %s at line %d, column %d", s.Node, s.Line, s.Column)
+}
+
+// Debugger evaluates expressions, calling its handler at every stop. A
+// Debugger runs one evaluation at a time.
+type Debugger struct {
+	// Handler is called at every stop and returns how to continue.
+	Handler func(*Stop) Action
+	// StopOnEntry stops before the root node is evaluated, as if stepping
+	// into it; otherwise Run proceeds to the first breakpoint.
+	StopOnEntry bool
+
+	breakpoints map[Breakpoint]bool
+	ctx         map[string]interface{}
+	stack       []*Frame
+	action      Action
+	target      int
+	aborted     bool
+}
+
+// New returns a debugger that calls handler at every stop.
+func New(handler func(*Stop) Action) *Debugger {
+	return &Debugger{Handler: handler, breakpoints: make(map[Breakpoint]bool)}
+}
+
+// SetBreakpoint adds a breakpoint at line and column.
+func (d *Debugger) SetBreakpoint(line, column int) {
+	if d.breakpoints == nil {
+		d.breakpoints = make(map[Breakpoint]bool)
+	}
+	d.breakpoints[Breakpoint{Line: line, Column: column}] = true
+}
+
+// ClearBreakpoint removes the breakpoint at line and column.
+func (d *Debugger) ClearBreakpoint(line, column int) {
+	delete(d.breakpoints, Breakpoint{Line: line, Column: column})
+}
+
+// Breakpoints returns the breakpoints in source order.
+func (d *Debugger) Breakpoints() []Breakpoint {
+	bps := make([]Breakpoint, 0, len(d.breakpoints))
+	for bp := range d.breakpoints {
+		bps = append(bps, bp)
+	}
+	sort.Slice(bps, func(i, j int) bool {
+		if bps[i].Line != bps[j].Line {
+			return bps[i].Line < bps[j].Line
+		}
+		return bps[i].Column < bps[j].Column
+	})
+	return bps
+}
+
+// Run evaluates expr against ctx under the debugger. The environment's
+// observer is replaced for the duration of the evaluation.
+func (d *Debugger) Run(expr ast.Expression, ctx map[string]interface{}, e *env.Environment) (interface{}, error) {
+	d.ctx = ctx
+	d.stack = nil
+	d.aborted = false
+	d.action = Continue
+	if d.StopOnEntry {
+		d.action = StepInto
+	}
+
+	previous := e.Observer
+	e.Observer = d
+	defer func() { e.Observer = previous }()
+
+	value, err := expr.Eval(ctx, e)
+	if d.aborted {
+		return nil, ErrAborted
+	}
+	return value, err
+}
+
+// Enter implements env.Observer.
+func (d *Debugger) Enter(node env.Node) error {
+	if d.aborted {
+		return ErrAborted
+	}
+	expr, _ := node.(ast.Expression)
+	d.stack = append(d.stack, &Frame{Node: expr})
+	if d.stepping() || d.atBreakpoint(expr) {
+		line, column := node.Pos()
+		d.stop(&Stop{Event: Enter, Node: expr, Line: line, Column: column})
+		if d.aborted {
+			return ErrAborted
+		}
+	}
+	return nil
+}
+
+// Leave implements env.Observer.
+func (d *Debugger) Leave(node env.Node, value interface{}, err error) {
+	if len(d.stack) == 0 {
+		return
+	}
+	expr, _ := node.(ast.Expression)
+	if !d.aborted && d.stepping() {
+		line, column := node.Pos()
+		d.stop(&Stop{Event: Leave, Node: expr, Line: line, Column: column, Value: value, Err: err})
+	}
+	d.stack = d.stack[:len(d.stack)-1]
+	if len(d.stack) > 0 {
+		parent := d.stack[len(d.stack)-1]
+		parent.Children = append(parent.Children, Result{Node: expr, Value: value, Err: err})
+	}
+}
+
+// stepping reports whether the current action stops at an event at the
+// current depth.
+func (d *Debugger) stepping() bool {
+	switch d.action {
+	case StepInto:
+		return true
+	case StepOver, StepOut:
+		return len(d.stack) <= d.target
+	}
+	return false
+}
+
+// atBreakpoint reports whether entering expr, the top of the stack, hits a
+// breakpoint.
+func (d *Debugger) atBreakpoint(expr ast.Expression) bool {
+	if len(d.breakpoints) == 0 || expr == nil {
+		return false
+	}
+	line, column := expr.Pos()
+	if d.breakpoints[Breakpoint{Line: line, Column: column}] {
+		return true
+	}
+	if !d.breakpoints[Breakpoint{Line: line}] {
+		return false
+	}
+	if len(d.stack) < 2 {
+		return true
+	}
+	parentLine, _ := d.stack[len(d.stack)-2].Node.Pos()
+	return parentLine != line
+}
+
+// stop calls the handler and applies the action it returns.
+func (d *Debugger) stop(s *Stop) {
+	s.Context = d.ctx
+	s.Stack = make([]Frame, len(d.stack))
+	for i, f := range d.stack {
+		s.Stack[i] = Frame{Node: f.Node, Children: append([]Result(nil), f.Children...)}
+	}
+	action := Continue
+	if d.Handler != nil {
+		action = d.Handler(s)
+	}
+	d.action = action
+	switch action {
+	case StepOver:
+		d.target = len(d.stack)
+	case StepOut:
+		d.target = len(d.stack) - 1
+	case Abort:
+		d.aborted = true
+	}
+}
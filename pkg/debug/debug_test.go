@@ -0,0 +1,166 @@
+package debug
+
+import (
+	"github.com/SpecDrivenDesign/lql/pkg/ast"
+	"github.com/SpecDrivenDesign/lql/pkg/env"
+	"github.com/SpecDrivenDesign/lql/pkg/lexer"
+	"github.com/SpecDrivenDesign/lql/pkg/parser"
+	"slices"
+	"testing"
+)
+
+func parse(t *testing.T, src string) ast.Expression {
+	t.Helper()
+	p, err := parser.NewParser(lexer.NewLexer(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expr, err := p.ParseExpression()
+	if err != nil {
+		t.Fatalf("%s: %v", src, err)
+	}
+	return expr
+}
+
+// script returns a handler that records each stop and answers with the
+// given actions in turn, then Continue.
+func script(stops *[]string, actions ...Action) func(*Stop) Action {
+	return func(s *Stop) Action {
+		*stops = append(*stops, s.String())
+		if len(actions) == 0 {
+			return Continue
+		}
+		action := actions[0]
+		actions = actions[1:]
+		return action
+	}
+}
+
+func TestStepping(t *testing.T) {
+	const src = `$a + 1 > 2 AND $b`
+	ctx := map[string]interface{}{"a": int64(2), "b": true}
+	tests := []struct {
+		name    string
+		actions []Action
+		want    []string
+	}{
+		{"into", []Action{StepInto, StepInto, StepInto, StepInto}, []string{
+			"enter $a + 1 > 2 AND $b at line 1, column 12",
+			"enter $a + 1 > 2 at line 1, column 8",
+			"enter $a + 1 at line 1, column 4",
+			"enter $a at line 1, column 1",
+			"leave $a at line 1, column 1: 2",
+		}},
+		{"over", []Action{StepInto, StepOver, StepOver, StepOver}, []string{
+			"enter $a + 1 > 2 AND $b at line 1, column 12",
+			"enter $a + 1 > 2 at line 1, column 8",
+			"leave $a + 1 > 2 at line 1, column 8: true",
+			"enter $b at line 1, column 16",
+			"leave $b at line 1, column 16: true",
+		}},
+		{"out", []Action{StepInto, StepInto, StepOut, StepOut}, []string{
+			"enter $a + 1 > 2 AND $b at line 1, column 12",
+			"enter $a + 1 > 2 at line 1, column 8",
+			"enter $a + 1 at line 1, column 4",
+			"leave $a + 1 > 2 at line 1, column 8: true",
+			"leave $a + 1 > 2 AND $b at line 1, column 12: true",
+		}},
+	}
+	for _, tt := range tests {
+		var stops []string
+		d := New(script(&stops, tt.actions...))
+		d.StopOnEntry = true
+		got, err := d.Run(parse(t, src), ctx, env.NewEnvironment())
+		if err != nil || got != true {
+			t.Errorf("%s: got %v, %v", tt.name, got, err)
+		}
+		if !slices.Equal(stops, tt.want) {
+			t.Errorf("%s: stopped at\n%q\nwant\n%q", tt.name, stops, tt.want)
+		}
+	}
+}
+
+func TestBreakpoints(t *testing.T) {
+	expr := parse(t, "$a > 1\nAND string.toUpper($s) == \"X\"")
+	ctx := map[string]interface{}{"a": int64(2), "s": "x"}
+
+	var stops []string
+	d := New(script(&stops))
+	d.SetBreakpoint(2, 20)
+	// A breakpoint on a line stops at the outermost node entered on it.
+	d.SetBreakpoint(1, 0)
+	if got, err := d.Run(expr, ctx, env.NewEnvironment()); err != nil || got != true {
+		t.Fatalf("got %v, %v", got, err)
+	}
+	want := []string{
+		"enter $a > 1 at line 1, column 4",
+		"enter $s at line 2, column 20",
+	}
+	if !slices.Equal(stops, want) {
+		t.Errorf("stopped at %q, want %q", stops, want)
+	}
+	if bps := d.Breakpoints(); !slices.Equal(bps, []Breakpoint{{1, 0}, {2, 20}}) {
+		t.Errorf("breakpoints %v", bps)
+	}
+
+	stops = nil
+	d.ClearBreakpoint(1, 0)
+	d.ClearBreakpoint(2, 20)
+	if _, err := d.Run(expr, ctx, env.NewEnvironment()); err != nil || len(stops) != 0 {
+		t.Errorf("stopped at %q, %v with no breakpoints", stops, err)
+	}
+}
+
+func TestStopInspection(t *testing.T) {
+	var children []Result
+	var depth int
+	var stack []string
+	d := New(func(s *Stop) Action {
+		if s.Event == Leave && s.Node.String() == `$a + $b` {
+			children, depth = s.Children(), s.Depth()
+			for _, frame := range s.Stack {
+				stack = append(stack, frame.Node.String())
+			}
+		}
+		return StepInto
+	})
+	d.StopOnEntry = true
+	if _, err := d.Run(parse(t, `$a + $b == 3`), map[string]interface{}{"a": int64(1), "b": int64(2)}, env.NewEnvironment()); err != nil {
+		t.Fatal(err)
+	}
+	if len(children) != 2 || children[0].Value != int64(1) || children[1].Value != int64(2) {
+		t.Errorf("children %+v", children)
+	}
+	if depth != 2 || !slices.Equal(stack, []string{`$a + $b == 3`, `$a + $b`}) {
+		t.Errorf("depth %d, stack %q", depth, stack)
+	}
+}
+
+func TestAbort(t *testing.T) {
+	e := env.NewEnvironment()
+	d := New(func(*Stop) Action { return Abort })
+	d.SetBreakpoint(1, 1)
+	if _, err := d.Run(parse(t, `$a > 1`), map[string]interface{}{"a": int64(2)}, e); err != ErrAborted {
+		t.Errorf("got %v, want ErrAborted", err)
+	}
+	if e.Observer != nil {
+		t.Error("the debugger is still observing the environment")
+	}
+	// The debugger can run again after an abort.
+	d.ClearBreakpoint(1, 1)
+	if got, err := d.Run(parse(t, `$a > 1`), map[string]interface{}{"a": int64(2)}, e); err != nil || got != true {
+		t.Errorf("got %v, %v", got, err)
+	}
+}
+
+func TestLeaveReportsErrors(t *testing.T) {
+	var stops []string
+	d := New(script(&stops, StepOver))
+	d.StopOnEntry = true
+	if _, err := d.Run(parse(t, `1 / 0`), nil, env.NewEnvironment()); err == nil {
+		t.Fatal("division by zero succeeded")
+	}
+	if len(stops) != 2 || stops[1] != "leave 1 / 0 at line 1, column 3: error: DivideByZeroError: division by zero at line 1, column 3" {
+		t.Errorf("stopped at %q", stops)
+	}
+}
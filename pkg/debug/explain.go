@@ -0,0 +1,146 @@
+package debug
+
+import (
+	"fmt"
+	"github.com/SpecDrivenDesign/lql/pkg/ast"
+	"github.com/SpecDrivenDesign/lql/pkg/env"
+	"strings"
+)
+
+// Explanation mirrors one node of an evaluated expression tree, carrying
+// the value or error the node evaluated to.
+type Explanation struct {
+	Node   ast.Expression
+	Line   int
+	Column int
+	// Evaluated is false for nodes skipped by the evaluation, such as the
+	// right operand of a short-circuited AND.
+	Evaluated bool
+	// Evaluations counts how often the node was evaluated, for example
+	// once per element under a [*] projection. Value and Err hold the
+	// result of the last evaluation.
+	Evaluations int
+	Value       interface{}
+	Err         error
+	Children    []*Explanation
+
+	parent *Explanation
+}
+
+// ExplainEval evaluates expr against ctx like expr.Eval and returns, along
+// with the result, a tree mirroring the expression in which every node
+// carries what it evaluated to. The environment's observer is replaced for
+// the duration of the evaluation.
+func ExplainEval(expr ast.Expression, ctx map[string]interface{}, e *env.Environment) (*Explanation, interface{}, error) {
+	byNode := make(map[ast.Expression][]*Explanation)
+	root := explainTree(expr, nil, byNode)
+
+	previous := e.Observer
+	e.Observer = &explainer{byNode: byNode}
+	defer func() { e.Observer = previous }()
+
+	value, err := expr.Eval(ctx, e)
+	return root, value, err
+}
+
+// explainTree builds the unevaluated explanation tree for node, indexing
+// it by node. A node shared by several parents, as a node an optimizer
+// reuses may be, gets one explanation under each.
+func explainTree(node ast.Expression, parent *Explanation, byNode map[ast.Expression][]*Explanation) *Explanation {
+	line, column := node.Pos()
+	x := &Explanation{Node: node, Line: line, Column: column, parent: parent}
+	byNode[node] = append(byNode[node], x)
+	for _, child := range ast.Children(node) {
+		x.Children = append(x.Children, explainTree(child, x, byNode))
+	}
+	return x
+}
+
+// explainer records node results into an explanation tree. It tracks the
+// explanations under evaluation so that each evaluation of a shared node
+// is recorded under the parent that evaluated it.
+type explainer struct {
+	byNode map[ast.Expression][]*Explanation
+	stack  []*Explanation
+}
+
+func (x *explainer) Enter(node env.Node) error {
+	var parent, current *Explanation
+	if len(x.stack) > 0 {
+		parent = x.stack[len(x.stack)-1]
+	}
+	if expr, ok := node.(ast.Expression); ok {
+		for _, e := range x.byNode[expr] {
+			if e.parent == parent {
+				current = e
+				break
+			}
+		}
+	}
+	x.stack = append(x.stack, current)
+	return nil
+}
+
+func (x *explainer) Leave(node env.Node, value interface{}, err error) {
+	if len(x.stack) == 0 {
+		return
+	}
+	e := x.stack[len(x.stack)-1]
+	x.stack = x.stack[:len(x.stack)-1]
+	if e == nil {
+		return
+	}
+	e.Evaluated = true
+	e.Evaluations++
+	e.Value = value
+	e.Err = err
+}
+
+// String renders the tree with one node per line, indented by depth:
+//
+//	$user.age >= 18 AND $user.country == "US" => false
+//	  $user.age >= 18 => false
+//	    $user.age => 17
+//	      $user => map[age:17 country:US]
+//	    18 => 18
+//	  $user.country == "US" (not evaluated)
+//	    $user.country (not evaluated)
+//	      $user (not evaluated)
+//	    "US" (not evaluated)
+func (x *Explanation) String() string {
+	var sb strings.Builder
+	x.write(&sb, 0)
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+func (x *Explanation) write(sb *strings.Builder, depth int) {
+	sb.WriteString(strings.Repeat("  ", depth))
+	sb.WriteString(x.Node.String())
+	switch {
+	case !x.Evaluated:
+		sb.WriteString(" (not evaluated)")
+	case x.Err != nil:
+		fmt.Fprintf(sb, " => error: %v", x.Err)
+	default:
+		fmt.Fprintf(sb, " => %s", formatValue(x.Value))
+	}
+	if x.Evaluations > 1 {
+		fmt.Fprintf(sb, " (evaluated %d times)", x.Evaluations)
+	}
+	sb.WriteString("\n")
+	for _, child := range x.Children {
+		child.write(sb, depth+1)
+	}
+}
+
+// formatValue prints strings quoted so they are told apart from numbers
+// and keywords.
+func formatValue(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return fmt.Sprintf("%q", s)
+	}
+	if v == nil {
+		return "null"
+	}
+	return fmt.Sprintf("%v", v)
+}
@@ -0,0 +1,82 @@
+package debug
+
+import (
+	"github.com/SpecDrivenDesign/lql/pkg/ast/expressions"
+	"github.com/SpecDrivenDesign/lql/pkg/env"
+	"github.com/SpecDrivenDesign/lql/pkg/tokens"
+	"testing"
+)
+
+func TestExplainEval(t *testing.T) {
+	ctx := map[string]interface{}{"user": map[string]interface{}{"age": int64(17), "country": "US"}}
+	x, value, err := ExplainEval(parse(t, `$user.age >= 18 AND $user.country == "US"`), ctx, env.NewEnvironment())
+	if err != nil || value != false {
+		t.Fatalf("got %v, %v", value, err)
+	}
+	want := `$user.age >= 18 AND $user.country == "US" => false
+  $user.age >= 18 => false
+    $user.age => 17
+      $user => map[age:17 country:US]
+    18 => 18
+  $user.country == "US" (not evaluated)
+    $user.country (not evaluated)
+      $user (not evaluated)
+    "US" (not evaluated)`
+	if got := x.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+	if right := x.Children[1]; right.Evaluated || right.Evaluations != 0 || right.Line != 1 || right.Column != 35 {
+		t.Errorf("right operand %+v", right)
+	}
+}
+
+func TestExplainEvalRecordsErrors(t *testing.T) {
+	x, _, err := ExplainEval(parse(t, `$a / $b > 1`), map[string]interface{}{"a": int64(1), "b": int64(0)}, env.NewEnvironment())
+	if err == nil {
+		t.Fatal("division by zero succeeded")
+	}
+	div := x.Children[0]
+	if !div.Evaluated || div.Err == nil || div.Value != nil {
+		t.Errorf("division %+v", div)
+	}
+	if x.Err == nil {
+		t.Error("the root does not carry the error")
+	}
+	if right := x.Children[1]; right.Evaluated {
+		t.Error("the operand after the error was evaluated")
+	}
+}
+
+func TestExplainEvalCountsEvaluations(t *testing.T) {
+	x, value, err := ExplainEval(parse(t, `array.filterExpr($items, item > 1)`), map[string]interface{}{"items": []interface{}{int64(1), int64(2), int64(3)}}, env.NewEnvironment())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := value.([]interface{}); !ok || len(got) != 2 {
+		t.Fatalf("got %v", value)
+	}
+	cond := x.Children[1]
+	if cond.Evaluations != 3 || cond.Value != true {
+		t.Errorf("condition evaluated %d times, last to %v; want 3 times, last to true", cond.Evaluations, cond.Value)
+	}
+}
+
+func TestExplainEvalSharedNodes(t *testing.T) {
+	// An optimizer may reuse one node under several parents; each use is
+	// explained where it occurs.
+	shared := parse(t, `$a`)
+	expr := &expressions.BinaryExpr{
+		Left:     &expressions.BinaryExpr{Left: shared, Operator: tokens.TokenGt, Right: parse(t, `0`)},
+		Operator: tokens.TokenAnd,
+		Right:    &expressions.BinaryExpr{Left: shared, Operator: tokens.TokenLt, Right: parse(t, `9`)},
+	}
+	x, value, err := ExplainEval(expr, map[string]interface{}{"a": int64(5)}, env.NewEnvironment())
+	if err != nil || value != true {
+		t.Fatalf("got %v, %v", value, err)
+	}
+	for i, side := range x.Children {
+		if a := side.Children[0]; a.Evaluations != 1 || a.Value != int64(5) {
+			t.Errorf("operand %d: %d evaluations, value %v", i, a.Evaluations, a.Value)
+		}
+	}
+}
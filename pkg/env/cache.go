@@ -0,0 +1,64 @@
+package env
+
+import (
+	"sync"
+	"time"
+)
+
+// CacheStore holds the results memoized by cache.memo, keyed by the key
+// given in the expression. Implementations must be safe for concurrent use.
+type CacheStore interface {
+	// Get returns the value stored under key, unless it has expired.
+	Get(key string) (interface{}, bool)
+	// Set stores value under key. A ttl of zero never expires.
+	Set(key string, value interface{}, ttl time.Duration)
+}
+
+type cacheEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+// MemoryCache is an in-process CacheStore. Expired entries are removed when
+// they are next read; entries are not otherwise evicted, so keys should be
+// drawn from a bounded set.
+type MemoryCache struct {
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+// NewMemoryCache returns an empty MemoryCache.
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{entries: make(map[string]cacheEntry)}
+}
+
+func (c *MemoryCache) Get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if !entry.expires.IsZero() && !time.Now().Before(entry.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return entry.value, true
+}
+
+func (c *MemoryCache) Set(key string, value interface{}, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry := cacheEntry{value: value}
+	if ttl > 0 {
+		entry.expires = time.Now().Add(ttl)
+	}
+	c.entries[key] = entry
+}
+
+// Clear removes every entry.
+func (c *MemoryCache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]cacheEntry)
+}
@@ -0,0 +1,43 @@
+package env
+
+// ContextProvider supplies context values on demand, so that a value that
+// is expensive to fetch, such as a profile held by a remote service, is
+// only fetched when an expression reads it. A provider can stand wherever
+// an object can in a context, including as a top-level field.
+type ContextProvider interface {
+	// Resolve returns the value at path below the provider and whether it
+	// exists. Member access passes consecutive field names together, so
+	// $profile.address.city resolves ["address", "city"] in one call. An
+	// empty path asks for the provider's whole value, when an expression
+	// uses the provider itself. The value returned may be another provider.
+	Resolve(path []string) (interface{}, bool, error)
+}
+
+// ProviderContext returns a context whose fields named in roots are
+// resolved from p on demand: $user.tier resolves ["user", "tier"].
+// analyze.ContextRoots lists the fields an expression reads.
+func ProviderContext(p ContextProvider, roots []string) map[string]interface{} {
+	ctx := make(map[string]interface{}, len(roots))
+	for _, root := range roots {
+		ctx[root] = subProvider{parent: p, prefix: []string{root}}
+	}
+	return ctx
+}
+
+// subProvider is the part of a provider below a path.
+type subProvider struct {
+	parent ContextProvider
+	prefix []string
+}
+
+func (s subProvider) Resolve(path []string) (interface{}, bool, error) {
+	full := make([]string, 0, len(s.prefix)+len(path))
+	full = append(append(full, s.prefix...), path...)
+	return s.parent.Resolve(full)
+}
+
+// ItemVariable is the variable an expression argument reads the element it
+// is applied to from, as in array.filterExpr($items, item.price > 10). The
+// parser accepts it within function arguments; param.LazyArg.EvalWith binds
+// it.
+const ItemVariable = "item"
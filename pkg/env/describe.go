@@ -0,0 +1,163 @@
+package env
+
+import (
+	"github.com/SpecDrivenDesign/lql/pkg/param"
+	"sort"
+	"strings"
+)
+
+// LibraryDescription describes a library registered in an environment.
+type LibraryDescription struct {
+	Name string `json:"name"`
+	// Functions lists the library's functions, sorted by name. It is empty
+	// for libraries that do not implement DescribedLibrary.
+	Functions []FunctionDescription `json:"functions"`
+	// Described reports whether the library declares its functions.
+	Described bool `json:"described"`
+}
+
+// FunctionDescription describes a function of a registered library.
+type FunctionDescription struct {
+	param.Function
+	Library string `json:"library"`
+	// Capability is the capability a caller must hold to call the
+	// function, if any.
+	Capability string `json:"capability,omitempty"`
+}
+
+// QualifiedName returns the name expressions call the function by, such as
+// "math.sum".
+func (f FunctionDescription) QualifiedName() string {
+	return f.Library + "." + f.Name
+}
+
+// Usage returns how to call the function, such as "math.pow(x, y)".
+func (f FunctionDescription) Usage() string {
+	return f.Function.Usage(f.Library)
+}
+
+// memoFunction describes cache.memo, which the evaluator handles itself.
+var memoFunction = param.Function{
+	Name: "memo",
+	Params: []param.Param{
+		{Name: "key", Type: param.TypeString},
+		{Name: "expr", Type: param.TypeAny},
+		{Name: "ttlMillis", Type: param.TypeNumeric},
+	},
+	Result: param.TypeAny,
+	Doc:    "Evaluates expr once per key and reuses its value for ttlMillis milliseconds.",
+}
+
+// Describe returns the libraries registered in the environment and the
+// functions they declare, sorted by name, for documentation, completion and
+// validation of calls. The cache library is always included.
+func (e *Environment) Describe() []LibraryDescription {
+	names := []string{"cache"}
+	for name := range e.Libraries {
+		if name != "cache" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	libraries := make([]LibraryDescription, 0, len(names))
+	for _, name := range names {
+		library, _ := e.DescribeLibrary(name)
+		libraries = append(libraries, library)
+	}
+	return libraries
+}
+
+// DescribeLibrary describes the library registered as name.
+func (e *Environment) DescribeLibrary(name string) (LibraryDescription, bool) {
+	var functions []param.Function
+	if name == "cache" {
+		functions = []param.Function{memoFunction}
+	} else {
+		lib, ok := e.Libraries[name]
+		if !ok {
+			return LibraryDescription{}, false
+		}
+		described, ok := lib.(DescribedLibrary)
+		if !ok {
+			return LibraryDescription{Name: name, Functions: []FunctionDescription{}}, true
+		}
+		functions = described.Functions()
+	}
+	library := LibraryDescription{Name: name, Functions: make([]FunctionDescription, 0, len(functions)), Described: true}
+	for _, fn := range functions {
+		library.Functions = append(library.Functions, FunctionDescription{
+			Function:   fn,
+			Library:    name,
+			Capability: e.FunctionCapabilities[name+"."+fn.Name],
+		})
+	}
+	sort.Slice(library.Functions, func(i, j int) bool { return library.Functions[i].Name < library.Functions[j].Name })
+	return library, true
+}
+
+// DescribeFunction describes library.function. It reports false if the
+// library is not registered, does not declare its functions, or has no
+// such function.
+func (e *Environment) DescribeFunction(library, function string) (FunctionDescription, bool) {
+	lib, ok := e.DescribeLibrary(library)
+	if !ok {
+		return FunctionDescription{}, false
+	}
+	for _, fn := range lib.Functions {
+		if fn.Name == function {
+			return fn, true
+		}
+	}
+	return FunctionDescription{}, false
+}
+
+// CompleteFunction returns the qualified names of the described functions
+// that start with prefix, sorted, such as "math.pow" and
+// "math.percentChange" for "math.p".
+func (e *Environment) CompleteFunction(prefix string) []string {
+	var names []string
+	for _, lib := range e.Describe() {
+		if !strings.HasPrefix(lib.Name, prefix) && !strings.HasPrefix(prefix, lib.Name+".") {
+			continue
+		}
+		for _, fn := range lib.Functions {
+			if name := fn.QualifiedName(); strings.HasPrefix(name, prefix) {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// SuggestName returns the candidate closest to name, for "did you mean"
+// hints, if one is close enough to be a likely misspelling.
+func SuggestName(name string, candidates []string) (string, bool) {
+	best, bestDistance := "", len(name)/3+1
+	for _, candidate := range candidates {
+		if d := editDistance(strings.ToLower(name), strings.ToLower(candidate)); d < bestDistance {
+			best, bestDistance = candidate, d
+		}
+	}
+	return best, best != ""
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
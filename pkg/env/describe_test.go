@@ -0,0 +1,123 @@
+package env
+
+import (
+	"github.com/SpecDrivenDesign/lql/pkg/param"
+	"slices"
+	"sort"
+	"testing"
+)
+
+// opaque is a library that does not declare its functions.
+type opaque struct{}
+
+func (opaque) Call(string, []param.Arg, int, int, int, int) (interface{}, error) { return nil, nil }
+
+func TestDescribe(t *testing.T) {
+	e := NewEnvironment()
+	e.MustRegister("opaque", opaque{})
+	libraries := e.Describe()
+	names := make([]string, len(libraries))
+	for i, lib := range libraries {
+		names[i] = lib.Name
+		if !sort.SliceIsSorted(lib.Functions, func(i, j int) bool { return lib.Functions[i].Name < lib.Functions[j].Name }) {
+			t.Errorf("%s: functions are not sorted", lib.Name)
+		}
+		if lib.Name != "opaque" && (!lib.Described || len(lib.Functions) == 0) {
+			t.Errorf("built-in library %s declares no functions", lib.Name)
+		}
+	}
+	if !sort.StringsAreSorted(names) {
+		t.Errorf("libraries are not sorted: %v", names)
+	}
+	for _, name := range []string{"cache", "math", "opaque", "string", "time"} {
+		if !slices.Contains(names, name) {
+			t.Errorf("%s is not described", name)
+		}
+	}
+
+	lib, ok := e.DescribeLibrary("opaque")
+	if !ok || lib.Described || lib.Functions == nil || len(lib.Functions) != 0 {
+		t.Errorf("opaque: %+v, %t", lib, ok)
+	}
+	if _, ok := e.DescribeLibrary("nosuchlib"); ok {
+		t.Error("an unknown library was described")
+	}
+}
+
+func TestDescribeFunction(t *testing.T) {
+	e := NewEnvironment()
+	e.RequireCapability("math.pow", "compute")
+	tests := []struct {
+		library, function string
+		usage             string
+		min, max          int
+		capability        string
+	}{
+		{"math", "pow", "math.pow(x, y)", 2, 2, "compute"},
+		{"math", "sum", "math.sum(arr[, subfield][, defaultVal])", 1, 3, ""},
+		{"string", "concat", "string.concat(values, ...)", 1, -1, ""},
+		{"time", "now", "time.now()", 0, 0, CapabilityTime},
+		{"cache", "memo", "cache.memo(key, expr, ttlMillis)", 3, 3, ""},
+	}
+	for _, tt := range tests {
+		fn, ok := e.DescribeFunction(tt.library, tt.function)
+		if !ok {
+			t.Errorf("%s.%s is not described", tt.library, tt.function)
+			continue
+		}
+		if fn.QualifiedName() != tt.library+"."+tt.function || fn.Usage() != tt.usage {
+			t.Errorf("%s.%s: name %s, usage %s; want usage %s", tt.library, tt.function, fn.QualifiedName(), fn.Usage(), tt.usage)
+		}
+		if fn.MinArgs() != tt.min || fn.MaxArgs() != tt.max {
+			t.Errorf("%s: takes %d to %d arguments, want %d to %d", fn.QualifiedName(), fn.MinArgs(), fn.MaxArgs(), tt.min, tt.max)
+		}
+		if fn.Capability != tt.capability {
+			t.Errorf("%s: capability %q, want %q", fn.QualifiedName(), fn.Capability, tt.capability)
+		}
+		if fn.Doc == "" {
+			t.Errorf("%s has no documentation", fn.QualifiedName())
+		}
+	}
+	for _, name := range [][2]string{{"math", "nosuchfn"}, {"nosuchlib", "pow"}} {
+		if _, ok := e.DescribeFunction(name[0], name[1]); ok {
+			t.Errorf("%s.%s was described", name[0], name[1])
+		}
+	}
+}
+
+func TestCompleteFunction(t *testing.T) {
+	e := NewEnvironment()
+	got := e.CompleteFunction("math.p")
+	if !slices.Contains(got, "math.pow") || !sort.StringsAreSorted(got) {
+		t.Errorf("got %v", got)
+	}
+	for _, name := range got {
+		if len(name) < len("math.p") || name[:len("math.p")] != "math.p" {
+			t.Errorf("%s does not start with math.p", name)
+		}
+	}
+	if got := e.CompleteFunction("cac"); !slices.Equal(got, []string{"cache.memo"}) {
+		t.Errorf("got %v", got)
+	}
+	if got := e.CompleteFunction("nosuch"); len(got) != 0 {
+		t.Errorf("got %v", got)
+	}
+}
+
+func TestSuggestName(t *testing.T) {
+	candidates := []string{"toUpper", "toLower", "trim"}
+	tests := []struct {
+		name, want string
+	}{
+		{"toUppr", "toUpper"},
+		{"TOLOWER", "toLower"},
+		{"trm", "trim"},
+		{"replaceAll", ""},
+	}
+	for _, tt := range tests {
+		got, ok := SuggestName(tt.name, candidates)
+		if got != tt.want || ok != (tt.want != "") {
+			t.Errorf("%s: got %q, %t; want %q", tt.name, got, ok, tt.want)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package env
+
+import (
+	"github.com/SpecDrivenDesign/lql/pkg/param"
+	"sync"
+)
+
+// CallDescriptor describes a function call, such as one intercepted in
+// dry-run mode or passed to a CallHook.
+type CallDescriptor struct {
+	Library  string
+	Function string
+	Args     []interface{}
+	Line     int
+	Column   int
+}
+
+// DryRun records calls to side-effecting libraries instead of executing them,
+// returning stub results keyed by "library.function".
+type DryRun struct {
+	Stubs map[string]interface{}
+
+	mu    sync.Mutex
+	calls []CallDescriptor
+}
+
+// Record stores the call and returns its stub result (nil if none is supplied).
+func (d *DryRun) Record(call CallDescriptor) interface{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.calls = append(d.calls, call)
+	return d.Stubs[call.Library+"."+call.Function]
+}
+
+// Calls returns the calls recorded so far.
+func (d *DryRun) Calls() []CallDescriptor {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	out := make([]CallDescriptor, len(d.calls))
+	copy(out, d.calls)
+	return out
+}
+
+// MarkSideEffecting flags a library as side-effecting, so its calls are
+// recorded rather than executed while dry-run mode is enabled.
+func (e *Environment) MarkSideEffecting(libName string) {
+	if e.SideEffectLibraries == nil {
+		e.SideEffectLibraries = make(map[string]bool)
+	}
+	e.SideEffectLibraries[libName] = true
+}
+
+// EnableDryRun switches the environment into dry-run mode with the given stubs.
+func (e *Environment) EnableDryRun(stubs map[string]interface{}) *DryRun {
+	if stubs == nil {
+		stubs = make(map[string]interface{})
+	}
+	e.DryRun = &DryRun{Stubs: stubs}
+	return e.DryRun
+}
+
+// DisableDryRun restores normal execution of side-effecting libraries.
+func (e *Environment) DisableDryRun() {
+	e.DryRun = nil
+}
+
+// InterceptsCall reports whether a call to the library should be recorded
+// instead of executed.
+func (e *Environment) InterceptsCall(libName string) bool {
+	return e.DryRun != nil && e.SideEffectLibraries[libName]
+}
+
+// RecordCall records an intercepted call in the active dry run and returns
+// its stub result.
+func (e *Environment) RecordCall(libName, funcName string, args []param.Arg, line, column int) interface{} {
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	return e.DryRun.Record(CallDescriptor{
+		Library:  libName,
+		Function: funcName,
+		Args:     values,
+		Line:     line,
+		Column:   column,
+	})
+}
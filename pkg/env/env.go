@@ -2,16 +2,75 @@ package env
 
 import (
 	libraries2 "github.com/SpecDrivenDesign/lql/pkg/env/libraries"
+	"github.com/SpecDrivenDesign/lql/pkg/types"
+)
+
+// Capabilities checked before gated functions are invoked.
+const (
+	CapabilityTime    = "can-use-time"
+	CapabilityNetwork = "can-use-network"
+	CapabilityCrypto  = "can-use-crypto"
 )
 
 // Environment holds the available libraries.
 type Environment struct {
+	// Libraries maps library names to libraries. Hosts add theirs with
+	// RegisterLibrary, which checks for conflicts.
 	Libraries map[string]ILibrary
+	// FunctionCapabilities maps "library.function" to the capability a caller
+	// must hold to invoke it.
+	FunctionCapabilities map[string]string
+	// Capabilities holds the capabilities granted to the caller.
+	Capabilities map[string]bool
+	// SideEffectLibraries lists libraries whose calls are intercepted in dry-run mode.
+	SideEffectLibraries map[string]bool
+	// DryRun is non-nil while dry-run mode is enabled.
+	DryRun *DryRun
+	// Cache stores the results of cache.memo across evaluations. When nil,
+	// cache.memo evaluates its expression every time.
+	Cache CacheStore
+	// Limits bounds the resources each evaluation may use.
+	Limits Limits
+	// Observer, when set, is notified as evaluations enter and leave
+	// expression nodes.
+	Observer Observer
+	// Lenient, when set, makes missing fields and out-of-range indexes
+	// evaluate to null, as if every access were optional (?.), instead of
+	// failing with a ReferenceError or ArrayOutOfBoundsError.
+	Lenient bool
+	// CallHook, when set, is invoked for every call to a library
+	// function.
+	CallHook CallHook
+	// Profile restricts the functions expressions may call; the zero
+	// Profile allows every function.
+	Profile Profile
+	// Metrics, when set, receives the metrics of each evaluation. Each
+	// evaluation collects its own, so evaluations with the environment may
+	// overlap; the sink must then be safe for concurrent use.
+	Metrics MetricsSink
+
+	numericPromotion  bool
+	decimalArithmetic bool
+	collator          types.Collator
+	workers           chan struct{}
+	operators         map[operatorKey]OperatorFunc
 }
 
 // NewEnvironment creates a new Environment with default libraries.
 func NewEnvironment() *Environment {
-	env := &Environment{Libraries: make(map[string]ILibrary)}
+	env := &Environment{
+		Libraries: make(map[string]ILibrary),
+		FunctionCapabilities: map[string]string{
+			"time.now":       CapabilityTime,
+			"jwt.verifyHmac": CapabilityCrypto,
+		},
+		Capabilities: map[string]bool{
+			CapabilityTime:    true,
+			CapabilityNetwork: true,
+			CapabilityCrypto:  true,
+		},
+		Cache: NewMemoryCache(),
+	}
 	env.Libraries["time"] = libraries2.NewTimeLib()
 	env.Libraries["math"] = libraries2.NewMathLib()
 	env.Libraries["string"] = libraries2.NewStringLib()
@@ -19,6 +78,19 @@ func NewEnvironment() *Environment {
 	env.Libraries["array"] = libraries2.NewArrayLib()
 	env.Libraries["cond"] = libraries2.NewCondLib()
 	env.Libraries["type"] = libraries2.NewTypeLib()
+	env.Libraries["stat"] = libraries2.NewStatLib()
+	env.Libraries["object"] = libraries2.NewObjectLib()
+	env.Libraries["valid"] = libraries2.NewValidLib()
+	env.Libraries["phone"] = libraries2.NewPhoneLib()
+	env.Libraries["ua"] = libraries2.NewUALib()
+	env.Libraries["iso"] = libraries2.NewISOLib()
+	env.Libraries["convert"] = libraries2.NewConvertLib()
+	env.Libraries["jwt"] = libraries2.NewJWTLib()
+	env.Libraries["url"] = libraries2.NewURLLib()
+	env.Libraries["range"] = libraries2.NewRangeLib()
+	env.Libraries["tree"] = libraries2.NewTreeLib()
+	env.Libraries["random"] = libraries2.NewRandomLib()
+	env.Libraries["hash"] = libraries2.NewHashLib()
 	return env
 }
 
@@ -27,3 +99,97 @@ func (e *Environment) GetLibrary(name string) (ILibrary, bool) {
 	lib, ok := e.Libraries[name]
 	return lib, ok
 }
+
+// SetRandomSeed makes the random library deterministic: environments seeded
+// with the same value generate the same sequence of random values.
+func (e *Environment) SetRandomSeed(seed int64) {
+	if lib, ok := e.Libraries["random"].(*libraries2.RandomLib); ok {
+		lib.Seed(seed)
+	}
+}
+
+// SetNumericPromotion enables or disables automatic int→float promotion.
+// When enabled, an int operand of +, -, * or / is converted to a float if
+// the other operand is a float, and the math library's aggregates accept
+// arrays mixing ints and floats, instead of failing with "Mixed numeric
+// types require explicit conversion". Comparisons compare ints and floats
+// by value either way.
+func (e *Environment) SetNumericPromotion(enabled bool) {
+	e.numericPromotion = enabled
+	if lib, ok := e.Libraries["math"].(*libraries2.MathLib); ok {
+		lib.PromoteNumbers = enabled
+	}
+}
+
+// NumericPromotion reports whether automatic int→float promotion is
+// enabled.
+func (e *Environment) NumericPromotion() bool {
+	return e.numericPromotion
+}
+
+// SetDecimalArithmetic enables or disables decimal arithmetic. When
+// enabled, +, -, * and / on numbers that are not both ints compute exactly
+// in base 10 and produce types.Decimal values, so 0.1 + 0.2 == 0.3; a float
+// operand converts to the decimal it is written as. The math library's
+// aggregates sum, min, max and avg do the same. Ints combine with decimals
+// without explicit conversion.
+func (e *Environment) SetDecimalArithmetic(enabled bool) {
+	e.decimalArithmetic = enabled
+	if lib, ok := e.Libraries["math"].(*libraries2.MathLib); ok {
+		lib.Decimal = enabled
+	}
+}
+
+// DecimalArithmetic reports whether decimal arithmetic is enabled.
+func (e *Environment) DecimalArithmetic() bool {
+	return e.decimalArithmetic
+}
+
+// SetCollator sets the collator that ==, !=, <, <=, > and >= use to compare
+// two strings, and that array.sort uses to order strings, in place of byte
+// order; nil restores byte order. See types.Collator.
+func (e *Environment) SetCollator(c types.Collator) {
+	e.collator = c
+	if lib, ok := e.Libraries["array"].(*libraries2.ArrayLib); ok {
+		lib.Collator = c
+	}
+}
+
+// Collator returns the collator set with SetCollator, or nil.
+func (e *Environment) Collator() types.Collator {
+	return e.collator
+}
+
+// Grant adds capabilities to the caller.
+func (e *Environment) Grant(capabilities ...string) {
+	for _, c := range capabilities {
+		e.Capabilities[c] = true
+	}
+}
+
+// Revoke removes capabilities from the caller.
+func (e *Environment) Revoke(capabilities ...string) {
+	for _, c := range capabilities {
+		delete(e.Capabilities, c)
+	}
+}
+
+// RevokeAll removes every capability from the caller.
+func (e *Environment) RevokeAll() {
+	e.Capabilities = make(map[string]bool)
+}
+
+// RequireCapability gates a "library.function" behind a capability.
+func (e *Environment) RequireCapability(function, capability string) {
+	e.FunctionCapabilities[function] = capability
+}
+
+// MissingCapability returns the capability required to call the function if
+// the caller does not hold it.
+func (e *Environment) MissingCapability(libName, funcName string) (string, bool) {
+	required, gated := e.FunctionCapabilities[libName+"."+funcName]
+	if !gated || e.Capabilities[required] {
+		return "", false
+	}
+	return required, true
+}
@@ -0,0 +1,70 @@
+package env
+
+import (
+	"github.com/SpecDrivenDesign/lql/pkg/param"
+	"time"
+)
+
+// CallHook is invoked for every call to a library function, so that hosts
+// can audit, rate-limit or mock calls without wrapping each library. It
+// must be safe for concurrent use if the environment is used by several
+// goroutines at once or evaluates in parallel.
+type CallHook interface {
+	// BeforeCall is called before the function is invoked. A non-nil
+	// error fails the call with that error, and AfterCall is not called.
+	// With handled set, result is the result of the call and the function
+	// is not invoked.
+	BeforeCall(call CallDescriptor) (result interface{}, handled bool, err error)
+	// AfterCall is called with the result of the call and the time it
+	// took.
+	AfterCall(call CallDescriptor, result interface{}, err error, duration time.Duration)
+}
+
+// CallFunc adapts a function to a CallHook that is only told of calls
+// after they are made.
+type CallFunc func(call CallDescriptor, result interface{}, err error, duration time.Duration)
+
+func (f CallFunc) BeforeCall(CallDescriptor) (interface{}, bool, error) {
+	return nil, false, nil
+}
+
+func (f CallFunc) AfterCall(call CallDescriptor, result interface{}, err error, duration time.Duration) {
+	f(call, result, err, duration)
+}
+
+// HookCall makes a call to library.function at line and column with the
+// evaluated args through the environment's call hook; invoke calls the
+// function.
+func (e *Environment) HookCall(library, function string, args []param.Arg, line, column int, invoke func() (interface{}, error)) (interface{}, error) {
+	if e.CallHook == nil {
+		return invoke()
+	}
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	return e.hookCall(CallDescriptor{Library: library, Function: function, Args: values, Line: line, Column: column}, invoke)
+}
+
+// HookLazyCall makes a call to library.function at line and column,
+// which evaluates its arguments itself, through the environment's call
+// hook. The hook is passed no arguments.
+func (e *Environment) HookLazyCall(library, function string, line, column int, invoke func() (interface{}, error)) (interface{}, error) {
+	if e.CallHook == nil {
+		return invoke()
+	}
+	return e.hookCall(CallDescriptor{Library: library, Function: function, Line: line, Column: column}, invoke)
+}
+
+func (e *Environment) hookCall(call CallDescriptor, invoke func() (interface{}, error)) (interface{}, error) {
+	result, handled, err := e.CallHook.BeforeCall(call)
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	if !handled {
+		result, err = invoke()
+	}
+	e.CallHook.AfterCall(call, result, err, time.Since(start))
+	return result, err
+}
@@ -6,3 +6,24 @@ import "github.com/SpecDrivenDesign/lql/pkg/param"
 type ILibrary interface {
 	Call(functionName string, args []param.Arg, line, column, parenLine, parenColumn int) (interface{}, error)
 }
+
+// LazyLibrary is implemented by libraries with functions that, like
+// cond.ifExpr, evaluate only the arguments they need. Calls to such
+// functions pass their arguments unevaluated, so an argument that would
+// fail, such as a member access on null, is harmless when unused.
+type LazyLibrary interface {
+	ILibrary
+	// Lazy reports whether functionName takes lazy arguments.
+	Lazy(functionName string) bool
+	// CallLazy calls functionName, which Lazy reported as lazy.
+	CallLazy(functionName string, args []param.LazyArg, line, column, parenLine, parenColumn int) (interface{}, error)
+}
+
+// DescribedLibrary is implemented by libraries that declare their
+// functions, so that Describe can document them and static analysis can
+// check calls to them.
+type DescribedLibrary interface {
+	ILibrary
+	// Functions describes the library's functions.
+	Functions() []param.Function
+}
@@ -6,17 +6,114 @@ import (
 	"github.com/SpecDrivenDesign/lql/pkg/param"
 	"github.com/SpecDrivenDesign/lql/pkg/types"
 	"sort"
+	"strings"
 )
 
 // ArrayLib implements the array library functions.
-type ArrayLib struct{}
+type ArrayLib struct {
+	// Collator, when set, orders strings for sort in place of byte order;
+	// see Environment.SetCollator.
+	Collator types.Collator
+}
 
 func NewArrayLib() *ArrayLib {
 	return &ArrayLib{}
 }
 
+// Functions describes the array functions.
+func (a *ArrayLib) Functions() []param.Function {
+	return []param.Function{
+		{Name: "contains", Params: []param.Param{{Name: "arr", Type: param.TypeArray}, {Name: "value", Type: param.TypeAny}}, Result: param.TypeBoolean, Doc: "Reports whether arr contains value."},
+		{Name: "find", Params: []param.Param{{Name: "arr", Type: param.TypeArray}, {Name: "subfield", Type: param.TypeString}, {Name: "matchVal", Type: param.TypeAny}, {Name: "defaultObj", Type: param.TypeObject, Optional: true}}, Result: param.TypeAny, Doc: "Returns the first object whose subfield equals matchVal, or defaultObj."},
+		{Name: "first", Params: []param.Param{{Name: "arr", Type: param.TypeArray}, {Name: "defaultVal", Type: param.TypeAny, Optional: true}}, Result: param.TypeAny, Doc: "Returns the first element of arr, or defaultVal if it is empty."},
+		{Name: "last", Params: []param.Param{{Name: "arr", Type: param.TypeArray}, {Name: "defaultVal", Type: param.TypeAny, Optional: true}}, Result: param.TypeAny, Doc: "Returns the last element of arr, or defaultVal if it is empty."},
+		{Name: "extract", Params: []param.Param{{Name: "arr", Type: param.TypeArray}, {Name: "subfield", Type: param.TypeString}, {Name: "defaultVal", Type: param.TypeAny, Optional: true}}, Result: param.TypeArray, Doc: "Returns the subfield of each object in arr."},
+		{Name: "sort", Params: []param.Param{{Name: "arr", Type: param.TypeArray}, {Name: "ascending", Type: param.TypeBoolean, Optional: true}}, Result: param.TypeArray, Doc: "Sorts arr, ascending unless ascending is false."},
+		{Name: "flatten", Params: []param.Param{{Name: "arr", Type: param.TypeArray}}, Result: param.TypeArray, Doc: "Flattens one level of nested arrays."},
+		{Name: "filter", Params: []param.Param{{Name: "collection", Type: param.TypeArray}, {Name: "subfield", Type: param.TypeString, Optional: true}, {Name: "matchVal", Type: param.TypeAny, Optional: true}}, Result: param.TypeArray, Doc: "Keeps the non-null elements, or the objects whose subfield is present or equals matchVal."},
+		{Name: "getPath", Params: []param.Param{{Name: "value", Type: param.TypeAny}, {Name: "path", Type: param.TypeString}, {Name: "defaultVal", Type: param.TypeAny, Optional: true}}, Result: param.TypeAny, Doc: "Returns the value at a dotted or bracketed path, or defaultVal."},
+		{Name: "deepGet", Params: []param.Param{{Name: "value", Type: param.TypeAny}, {Name: "path", Type: param.TypeString}, {Name: "defaultVal", Type: param.TypeAny, Optional: true}}, Result: param.TypeAny, Doc: "Same as getPath."},
+		{Name: "frequencies", Params: []param.Param{{Name: "arr", Type: param.TypeArray}}, Result: param.TypeObject, Doc: "Counts how often each element occurs."},
+		{Name: "mostCommon", Params: []param.Param{{Name: "arr", Type: param.TypeArray}, {Name: "n", Type: param.TypeNumeric, Optional: true}}, Result: param.TypeArray, Doc: "Returns the n most frequent elements."},
+		{Name: "windows", Params: []param.Param{{Name: "arr", Type: param.TypeArray}, {Name: "size", Type: param.TypeNumeric}}, Result: param.TypeArray, Doc: "Returns every run of size consecutive elements."},
+		{Name: "pairwise", Params: []param.Param{{Name: "arr", Type: param.TypeArray}}, Result: param.TypeArray, Doc: "Returns every pair of consecutive elements."},
+		{Name: "filterExpr", Params: []param.Param{{Name: "arr", Type: param.TypeArray}, {Name: "expr", Type: param.TypeBoolean}}, Result: param.TypeArray, Doc: "Keeps the elements for which expr, with item bound to the element, is true."},
+		{Name: "mapExpr", Params: []param.Param{{Name: "arr", Type: param.TypeArray}, {Name: "expr", Type: param.TypeAny}}, Result: param.TypeArray, Doc: "Evaluates expr with item bound to each element."},
+		{Name: "anyExpr", Params: []param.Param{{Name: "arr", Type: param.TypeArray}, {Name: "expr", Type: param.TypeBoolean}}, Result: param.TypeBoolean, Doc: "Reports whether expr is true for some element bound to item."},
+		{Name: "allExpr", Params: []param.Param{{Name: "arr", Type: param.TypeArray}, {Name: "expr", Type: param.TypeBoolean}}, Result: param.TypeBoolean, Doc: "Reports whether expr is true for every element bound to item."},
+	}
+}
+
+// Lazy reports whether functionName takes an expression argument, which
+// is applied to each element with the element bound to item:
+// array.filterExpr, array.mapExpr, array.anyExpr and array.allExpr.
+func (a *ArrayLib) Lazy(functionName string) bool {
+	switch functionName {
+	case "filterExpr", "mapExpr", "anyExpr", "allExpr":
+		return true
+	}
+	return false
+}
+
+func (a *ArrayLib) CallLazy(functionName string, args []param.LazyArg, line, col, parenLine, parenCol int) (interface{}, error) {
+	fn := "array." + functionName
+	if len(args) != 2 {
+		return nil, errors.NewParameterError(fmt.Sprintf("%s requires 2 arguments", fn), line, col)
+	}
+	arg0, expr := args[0], args[1]
+	value, err := arg0.Eval()
+	if err != nil {
+		return nil, err
+	}
+	arr, ok := types.ConvertToInterfaceSlice(value)
+	if !ok {
+		return nil, errors.NewTypeError(fmt.Sprintf("%s: first argument must be an array", fn), arg0.Line, arg0.Column)
+	}
+	if expr.EvalWith == nil {
+		return nil, errors.NewFunctionCallError(fmt.Sprintf("%s: second argument must be an expression", fn), expr.Line, expr.Column)
+	}
+	if functionName == "mapExpr" {
+		mapped := make([]interface{}, len(arr))
+		for i, elem := range arr {
+			if mapped[i], err = expr.EvalWith(elem); err != nil {
+				return nil, err
+			}
+		}
+		return mapped, nil
+	}
+	filtered := []interface{}{}
+	for _, elem := range arr {
+		val, err := expr.EvalWith(elem)
+		if err != nil {
+			return nil, err
+		}
+		matched, ok := val.(bool)
+		if !ok && val != nil {
+			return nil, errors.NewTypeError(fmt.Sprintf("%s: expression must be boolean", fn), expr.Line, expr.Column)
+		}
+		switch {
+		case functionName == "anyExpr" && matched:
+			return true, nil
+		case functionName == "allExpr" && !matched:
+			return false, nil
+		case matched:
+			filtered = append(filtered, elem)
+		}
+	}
+	switch functionName {
+	case "anyExpr":
+		return false, nil
+	case "allExpr":
+		return true, nil
+	}
+	return filtered, nil
+}
+
 func (a *ArrayLib) Call(functionName string, args []param.Arg, line, col, parenLine, parenCol int) (interface{}, error) {
 	switch functionName {
+	case "filterExpr", "mapExpr", "anyExpr", "allExpr":
+		return a.CallLazy(functionName, param.Lazy(args), line, col, parenLine, parenCol)
+
 	case "contains":
 		if len(args) != 2 {
 			return nil, errors.NewParameterError("array.contains requires 2 arguments", line, col)
@@ -187,6 +284,13 @@ func (a *ArrayLib) Call(functionName string, args []param.Arg, line, col, parenL
 		} else {
 			return nil, errors.NewTypeError("array.sort: elements are not comparable", arg0.Line, arg0.Column)
 		}
+		if isString {
+			for _, e := range arr {
+				if _, ok := e.(string); !ok {
+					return nil, errors.NewTypeError("array.sort: elements are not comparable", arg0.Line, arg0.Column)
+				}
+			}
+		}
 		// Enforce uniform numeric type for numeric arrays.
 		if isNumeric {
 			firstIsInt := types.IsInt(first)
@@ -200,6 +304,7 @@ func (a *ArrayLib) Call(functionName string, args []param.Arg, line, col, parenL
 				}
 			}
 		}
+		collator := a.Collator
 		sorted := make([]interface{}, len(arr))
 		copy(sorted, arr)
 		sort.SliceStable(sorted, func(i, j int) bool {
@@ -214,12 +319,11 @@ func (a *ArrayLib) Call(functionName string, args []param.Arg, line, col, parenL
 				return af > bf
 			}
 			if isString {
-				as := a.(string)
-				bs := b.(string)
+				c := compareStrings(a.(string), b.(string), collator)
 				if ascending {
-					return as < bs
+					return c < 0
 				}
-				return as > bs
+				return c > 0
 			}
 			return false
 		})
@@ -295,7 +399,172 @@ func (a *ArrayLib) Call(functionName string, args []param.Arg, line, col, parenL
 		}
 		return filtered, nil
 
+	case "getPath", "deepGet":
+		fn := "array." + functionName
+		if len(args) < 2 || len(args) > 3 {
+			if len(args) == 0 {
+				return nil, errors.NewParameterError(fmt.Sprintf("%s requires 2 or 3 arguments", fn), parenLine, parenCol)
+			}
+			lastArg := args[len(args)-1]
+			return nil, errors.NewParameterError(fmt.Sprintf("%s requires 2 or 3 arguments", fn), lastArg.Line, lastArg.Column)
+		}
+		arg1 := args[1]
+		path, ok := arg1.Value.(string)
+		if !ok {
+			return nil, errors.NewTypeError(fmt.Sprintf("%s: second argument must be string", fn), arg1.Line, arg1.Column)
+		}
+		segments, err := parsePath(path)
+		if err != nil {
+			return nil, errors.NewFunctionCallError(fmt.Sprintf("%s: invalid path: %v", fn, err), arg1.Line, arg1.Column)
+		}
+		var defaultVal interface{}
+		if len(args) == 3 {
+			defaultVal = args[2].Value
+		}
+		if v, found := getPath(args[0].Value, segments); found && v != nil {
+			return v, nil
+		}
+		return defaultVal, nil
+
+	case "frequencies":
+		if len(args) != 1 {
+			return nil, errors.NewParameterError("array.frequencies requires 1 argument", line, col)
+		}
+		counts, err := countFrequencies(args[0], "array.frequencies")
+		if err != nil {
+			return nil, err
+		}
+		result := make(map[string]interface{}, len(counts))
+		for _, c := range counts {
+			result[c.key] = c.count
+		}
+		return result, nil
+
+	case "mostCommon":
+		if len(args) < 1 || len(args) > 2 {
+			if len(args) == 0 {
+				return nil, errors.NewParameterError("array.mostCommon requires 1 or 2 arguments", parenLine, parenCol)
+			}
+			lastArg := args[len(args)-1]
+			return nil, errors.NewParameterError("array.mostCommon requires 1 or 2 arguments", lastArg.Line, lastArg.Column)
+		}
+		counts, err := countFrequencies(args[0], "array.mostCommon")
+		if err != nil {
+			return nil, err
+		}
+		n := int64(1)
+		if len(args) == 2 {
+			arg1 := args[1]
+			if !types.IsInt(arg1.Value) {
+				return nil, errors.NewTypeError("array.mostCommon: count must be an integer", arg1.Line, arg1.Column)
+			}
+			n, _ = types.ToInt(arg1.Value)
+			if n < 0 {
+				return nil, errors.NewFunctionCallError("array.mostCommon: count must be non-negative", arg1.Line, arg1.Column)
+			}
+		}
+		sort.SliceStable(counts, func(i, j int) bool {
+			return counts[i].count > counts[j].count
+		})
+		if int64(len(counts)) > n {
+			counts = counts[:n]
+		}
+		result := make([]interface{}, len(counts))
+		for i, c := range counts {
+			result[i] = c.value
+		}
+		return result, nil
+
+	case "windows":
+		if len(args) != 2 {
+			return nil, errors.NewParameterError("array.windows requires 2 arguments", line, col)
+		}
+		arg0 := args[0]
+		arr, ok := types.ConvertToInterfaceSlice(arg0.Value)
+		if !ok {
+			return nil, errors.NewTypeError("array.windows: first argument must be an array", arg0.Line, arg0.Column)
+		}
+		arg1 := args[1]
+		if !types.IsInt(arg1.Value) {
+			return nil, errors.NewTypeError("array.windows: size must be an integer", arg1.Line, arg1.Column)
+		}
+		size, _ := types.ToInt(arg1.Value)
+		if size < 1 {
+			return nil, errors.NewFunctionCallError("array.windows: size must be positive", arg1.Line, arg1.Column)
+		}
+		return slidingWindows(arr, int(size)), nil
+
+	case "pairwise":
+		if len(args) != 1 {
+			return nil, errors.NewParameterError("array.pairwise requires 1 argument", line, col)
+		}
+		arg0 := args[0]
+		arr, ok := types.ConvertToInterfaceSlice(arg0.Value)
+		if !ok {
+			return nil, errors.NewTypeError("array.pairwise: argument must be an array", arg0.Line, arg0.Column)
+		}
+		return slidingWindows(arr, 2), nil
+
 	default:
 		return nil, errors.NewFunctionCallError(fmt.Sprintf("unknown array function '%s'", functionName), 0, 0)
 	}
 }
+
+// slidingWindows returns every run of size consecutive elements of arr, in
+// order. It is empty when arr has fewer than size elements.
+func slidingWindows(arr []interface{}, size int) []interface{} {
+	windows := []interface{}{}
+	for i := 0; i+size <= len(arr); i++ {
+		window := make([]interface{}, size)
+		copy(window, arr[i:i+size])
+		windows = append(windows, window)
+	}
+	return windows
+}
+
+// frequency is the number of occurrences of one distinct array element.
+type frequency struct {
+	key   string
+	value interface{}
+	count int64
+}
+
+// countFrequencies counts the distinct elements of an array in order of
+// first occurrence. Elements are compared as == does, so 1 and 1.0 are the
+// same value; null elements are skipped.
+func countFrequencies(arg param.Arg, fn string) ([]frequency, error) {
+	arr, ok := types.ConvertToInterfaceSlice(arg.Value)
+	if !ok {
+		return nil, errors.NewTypeError(fmt.Sprintf("%s: first argument must be an array", fn), arg.Line, arg.Column)
+	}
+	var counts []frequency
+	index := make(map[string]int)
+	for _, elem := range arr {
+		if elem == nil {
+			continue
+		}
+		_, isString := elem.(string)
+		_, isBool := elem.(bool)
+		_, isNumeric := types.ToFloat(elem)
+		if !isString && !isBool && !isNumeric {
+			return nil, errors.NewTypeError(fmt.Sprintf("%s: elements must be strings, numbers or booleans", fn), arg.Line, arg.Column)
+		}
+		key := fmt.Sprintf("%v", elem)
+		if i, seen := index[key]; seen {
+			counts[i].count++
+			continue
+		}
+		index[key] = len(counts)
+		counts = append(counts, frequency{key: key, value: elem, count: 1})
+	}
+	return counts, nil
+}
+
+// compareStrings compares a and b with collator, or in byte order if it is
+// nil.
+func compareStrings(a, b string, collator types.Collator) int {
+	if collator == nil {
+		return strings.Compare(a, b)
+	}
+	return collator.Compare(a, b)
+}
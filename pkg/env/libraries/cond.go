@@ -15,37 +15,71 @@ func NewCondLib() *CondLib {
 	return &CondLib{}
 }
 
-func (c *CondLib) Call(functionName string, args []param.Arg, line, col, parenLine, parenCol int) (interface{}, error) {
+// Functions describes the cond functions.
+func (c *CondLib) Functions() []param.Function {
+	return []param.Function{
+		{Name: "ifExpr", Params: []param.Param{{Name: "condition", Type: param.TypeBoolean}, {Name: "thenVal", Type: param.TypeAny}, {Name: "elseVal", Type: param.TypeAny}}, Result: param.TypeAny, Doc: "Returns thenVal if condition is true, else elseVal, evaluating only the one returned."},
+		{Name: "coalesce", Params: []param.Param{{Name: "values", Type: param.TypeAny, Variadic: true}}, Result: param.TypeAny, Doc: "Returns the first argument that is not null."},
+		{Name: "isFieldPresent", Params: []param.Param{{Name: "object", Type: param.TypeObject}, {Name: "fieldPath", Type: param.TypeString}}, Result: param.TypeBoolean, Doc: "Reports whether object has the key fieldPath, even if null."},
+	}
+}
+
+// Lazy reports whether functionName evaluates only the arguments it needs:
+// cond.ifExpr evaluates its condition and the selected branch, and
+// cond.coalesce stops at the first non-null argument.
+func (c *CondLib) Lazy(functionName string) bool {
+	return functionName == "ifExpr" || functionName == "coalesce"
+}
+
+func (c *CondLib) CallLazy(functionName string, args []param.LazyArg, line, col, parenLine, parenCol int) (interface{}, error) {
 	switch functionName {
 	case "ifExpr":
 		if len(args) != 3 {
 			return nil, errors.NewParameterError("cond.ifExpr requires 3 arguments", line, col)
 		}
 		arg0 := args[0]
-		condVal, ok := arg0.Value.(bool)
+		cond, err := arg0.Eval()
+		if err != nil {
+			return nil, err
+		}
+		condVal, ok := cond.(bool)
 		if !ok {
-			if arg0.Value == nil {
+			if cond == nil {
 				condVal = false
 			} else {
 				return nil, errors.NewTypeError("cond.ifExpr: first argument must be boolean", arg0.Line, arg0.Column)
 			}
 		}
 		if condVal {
-			return args[1].Value, nil
+			return args[1].Eval()
 		}
-		return args[2].Value, nil
+		return args[2].Eval()
 
 	case "coalesce":
 		if len(args) < 1 {
 			return nil, errors.NewParameterError("cond.coalesce requires at least 1 argument", parenLine, parenCol)
 		}
 		for _, arg := range args {
-			if arg.Value != nil {
-				return arg.Value, nil
+			value, err := arg.Eval()
+			if err != nil {
+				return nil, err
+			}
+			if value != nil {
+				return value, nil
 			}
 		}
 		return nil, errors.NewFunctionCallError("cond.coalesce: all arguments are null", args[0].Line, args[0].Column)
 
+	default:
+		return nil, errors.NewFunctionCallError(fmt.Sprintf("unknown cond function '%s'", functionName), 0, 0)
+	}
+}
+
+func (c *CondLib) Call(functionName string, args []param.Arg, line, col, parenLine, parenCol int) (interface{}, error) {
+	switch functionName {
+	case "ifExpr", "coalesce":
+		return c.CallLazy(functionName, param.Lazy(args), line, col, parenLine, parenCol)
+
 	case "isFieldPresent":
 		if len(args) != 2 {
 			return nil, errors.NewParameterError("cond.isFieldPresent requires 2 arguments", line, col)
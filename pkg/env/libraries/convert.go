@@ -0,0 +1,243 @@
+package libraries
+
+import (
+	"fmt"
+	"github.com/SpecDrivenDesign/lql/pkg/errors"
+	"github.com/SpecDrivenDesign/lql/pkg/param"
+	"github.com/SpecDrivenDesign/lql/pkg/types"
+	"strconv"
+	"strings"
+)
+
+// unitInfo places a unit in a dimension with its size in the dimension's
+// base unit.
+type unitInfo struct {
+	dimension string
+	factor    float64
+}
+
+var convertUnits = map[string]unitInfo{
+	// length, base metre
+	"mm":  {"length", 0.001},
+	"cm":  {"length", 0.01},
+	"m":   {"length", 1},
+	"km":  {"length", 1000},
+	"in":  {"length", 0.0254},
+	"ft":  {"length", 0.3048},
+	"yd":  {"length", 0.9144},
+	"mi":  {"length", 1609.344},
+	"nmi": {"length", 1852},
+	// mass, base kilogram
+	"mg": {"mass", 1e-6},
+	"g":  {"mass", 0.001},
+	"kg": {"mass", 1},
+	"t":  {"mass", 1000},
+	"oz": {"mass", 0.028349523125},
+	"lb": {"mass", 0.45359237},
+	// volume, base litre
+	"ml":   {"volume", 0.001},
+	"l":    {"volume", 1},
+	"m3":   {"volume", 1000},
+	"floz": {"volume", 0.0295735295625},
+	"cup":  {"volume", 0.2365882365},
+	"pt":   {"volume", 0.473176473},
+	"qt":   {"volume", 0.946352946},
+	"gal":  {"volume", 3.785411784},
+	// speed, base metre per second
+	"m/s":  {"speed", 1},
+	"km/h": {"speed", 1000.0 / 3600},
+	"mph":  {"speed", 1609.344 / 3600},
+	"kn":   {"speed", 1852.0 / 3600},
+	// duration, base second
+	"ms":  {"duration", 0.001},
+	"s":   {"duration", 1},
+	"min": {"duration", 60},
+	"h":   {"duration", 3600},
+	"d":   {"duration", 86400},
+}
+
+// byteUnits are the IEC binary prefixes used by convert.bytesHuman.
+var byteUnits = []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB", "EiB"}
+
+// ConvertLib implements unit, temperature, size and color conversions.
+type ConvertLib struct{}
+
+func NewConvertLib() *ConvertLib {
+	return &ConvertLib{}
+}
+
+// Functions describes the convert functions.
+func (c *ConvertLib) Functions() []param.Function {
+	return []param.Function{
+		{Name: "units", Params: []param.Param{{Name: "value", Type: param.TypeNumeric}, {Name: "from", Type: param.TypeString}, {Name: "to", Type: param.TypeString}}, Result: param.TypeNumeric, Doc: "Converts value between units of the same dimension."},
+		{Name: "temperature", Params: []param.Param{{Name: "value", Type: param.TypeNumeric}, {Name: "from", Type: param.TypeString}, {Name: "to", Type: param.TypeString}}, Result: param.TypeNumeric, Doc: "Converts value between C, F and K."},
+		{Name: "bytesHuman", Params: []param.Param{{Name: "bytes", Type: param.TypeNumeric}, {Name: "decimals", Type: param.TypeNumeric, Optional: true}}, Result: param.TypeString, Doc: "Formats a byte count with binary units."},
+		{Name: "hexToRgb", Params: []param.Param{{Name: "color", Type: param.TypeString}}, Result: param.TypeObject, Doc: "Parses a hex color into r, g and b."},
+		{Name: "rgbToHex", Params: []param.Param{{Name: "r", Type: param.TypeNumeric}, {Name: "g", Type: param.TypeNumeric}, {Name: "b", Type: param.TypeNumeric}}, Result: param.TypeString, Doc: "Formats r, g and b as a hex color."},
+	}
+}
+
+func (c *ConvertLib) Call(functionName string, args []param.Arg, line, col, parenLine, parenCol int) (interface{}, error) {
+	switch functionName {
+	case "units":
+		if len(args) != 3 {
+			return nil, errors.NewParameterError("convert.units requires 3 arguments", line, col)
+		}
+		value, err := numberArg("convert.units", args[0])
+		if err != nil {
+			return nil, err
+		}
+		from, err := unitArg("convert.units", args[1])
+		if err != nil {
+			return nil, err
+		}
+		to, err := unitArg("convert.units", args[2])
+		if err != nil {
+			return nil, err
+		}
+		fromUnit, ok := convertUnits[from]
+		if !ok {
+			return nil, errors.NewFunctionCallError(fmt.Sprintf("convert.units: unknown unit '%s'", from), args[1].Line, args[1].Column)
+		}
+		toUnit, ok := convertUnits[to]
+		if !ok {
+			return nil, errors.NewFunctionCallError(fmt.Sprintf("convert.units: unknown unit '%s'", to), args[2].Line, args[2].Column)
+		}
+		if fromUnit.dimension != toUnit.dimension {
+			return nil, errors.NewFunctionCallError(fmt.Sprintf("convert.units: cannot convert %s '%s' to %s '%s'", fromUnit.dimension, from, toUnit.dimension, to), args[2].Line, args[2].Column)
+		}
+		return value * fromUnit.factor / toUnit.factor, nil
+
+	case "temperature":
+		if len(args) != 3 {
+			return nil, errors.NewParameterError("convert.temperature requires 3 arguments", line, col)
+		}
+		value, err := numberArg("convert.temperature", args[0])
+		if err != nil {
+			return nil, err
+		}
+		from, err := unitArg("convert.temperature", args[1])
+		if err != nil {
+			return nil, err
+		}
+		to, err := unitArg("convert.temperature", args[2])
+		if err != nil {
+			return nil, err
+		}
+		var kelvin float64
+		switch strings.ToUpper(from) {
+		case "C":
+			kelvin = value + 273.15
+		case "F":
+			kelvin = (value-32)*5/9 + 273.15
+		case "K":
+			kelvin = value
+		default:
+			return nil, errors.NewFunctionCallError(fmt.Sprintf("convert.temperature: unknown scale '%s'", from), args[1].Line, args[1].Column)
+		}
+		switch strings.ToUpper(to) {
+		case "C":
+			return kelvin - 273.15, nil
+		case "F":
+			return (kelvin-273.15)*9/5 + 32, nil
+		case "K":
+			return kelvin, nil
+		default:
+			return nil, errors.NewFunctionCallError(fmt.Sprintf("convert.temperature: unknown scale '%s'", to), args[2].Line, args[2].Column)
+		}
+
+	case "bytesHuman":
+		if len(args) < 1 || len(args) > 2 {
+			if len(args) == 0 {
+				return nil, errors.NewParameterError("convert.bytesHuman requires 1 or 2 arguments", parenLine, parenCol)
+			}
+			lastArg := args[len(args)-1]
+			return nil, errors.NewParameterError("convert.bytesHuman requires 1 or 2 arguments", lastArg.Line, lastArg.Column)
+		}
+		size, err := numberArg("convert.bytesHuman", args[0])
+		if err != nil {
+			return nil, err
+		}
+		if size < 0 {
+			return nil, errors.NewFunctionCallError("convert.bytesHuman: size must not be negative", args[0].Line, args[0].Column)
+		}
+		decimals := 1
+		if len(args) == 2 {
+			decimals, err = decimalsArg("convert.bytesHuman", args[1])
+			if err != nil {
+				return nil, err
+			}
+		}
+		unit := 0
+		for size >= 1024 && unit < len(byteUnits)-1 {
+			size /= 1024
+			unit++
+		}
+		if unit == 0 {
+			return strconv.FormatFloat(size, 'f', -1, 64) + " B", nil
+		}
+		return strconv.FormatFloat(size, 'f', decimals, 64) + " " + byteUnits[unit], nil
+
+	case "hexToRgb":
+		if len(args) != 1 {
+			return nil, errors.NewParameterError("convert.hexToRgb requires 1 argument", line, col)
+		}
+		arg0 := args[0]
+		s, ok := arg0.Value.(string)
+		if !ok {
+			return nil, errors.NewTypeError("convert.hexToRgb: argument must be a string", arg0.Line, arg0.Column)
+		}
+		hex := strings.TrimPrefix(s, "#")
+		if len(hex) == 3 {
+			hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+		}
+		rgb, err := strconv.ParseUint(hex, 16, 32)
+		if len(hex) != 6 || err != nil {
+			return nil, errors.NewFunctionCallError(fmt.Sprintf("convert.hexToRgb: invalid color '%s'", s), arg0.Line, arg0.Column)
+		}
+		return map[string]interface{}{
+			"r": int64(rgb >> 16 & 0xff),
+			"g": int64(rgb >> 8 & 0xff),
+			"b": int64(rgb & 0xff),
+		}, nil
+
+	case "rgbToHex":
+		if len(args) != 3 {
+			return nil, errors.NewParameterError("convert.rgbToHex requires 3 arguments", line, col)
+		}
+		var sb strings.Builder
+		sb.WriteByte('#')
+		for _, arg := range args {
+			if !types.IsInt(arg.Value) {
+				return nil, errors.NewTypeError("convert.rgbToHex: components must be integers", arg.Line, arg.Column)
+			}
+			v, _ := types.ToInt(arg.Value)
+			if v < 0 || v > 255 {
+				return nil, errors.NewFunctionCallError("convert.rgbToHex: components must be between 0 and 255", arg.Line, arg.Column)
+			}
+			sb.WriteString(fmt.Sprintf("%02x", v))
+		}
+		return sb.String(), nil
+
+	default:
+		return nil, errors.NewFunctionCallError(fmt.Sprintf("unknown convert function '%s'", functionName), 0, 0)
+	}
+}
+
+// numberArg returns a numeric argument as float64.
+func numberArg(fn string, arg param.Arg) (float64, error) {
+	v, ok := types.ToFloat(arg.Value)
+	if !ok {
+		return 0, errors.NewTypeError(fmt.Sprintf("%s: value must be numeric", fn), arg.Line, arg.Column)
+	}
+	return v, nil
+}
+
+// unitArg returns a unit name argument.
+func unitArg(fn string, arg param.Arg) (string, error) {
+	s, ok := arg.Value.(string)
+	if !ok {
+		return "", errors.NewTypeError(fmt.Sprintf("%s: unit must be a string", fn), arg.Line, arg.Column)
+	}
+	return s, nil
+}
@@ -0,0 +1,197 @@
+package libraries
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// graphemeClass is the subset of Unicode grapheme break properties needed
+// to keep emoji sequences, combining marks, flags and Hangul syllables
+// together.
+type graphemeClass int
+
+const (
+	gcOther graphemeClass = iota
+	gcCR
+	gcLF
+	gcControl
+	gcExtend
+	gcZWJ
+	gcRegionalIndicator
+	gcSpacingMark
+	gcL
+	gcV
+	gcT
+	gcLV
+	gcLVT
+)
+
+// pictographicRanges approximates the Extended_Pictographic property.
+var pictographicRanges = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{0x00A9, 0x00A9, 1}, {0x00AE, 0x00AE, 1}, {0x203C, 0x203C, 1},
+		{0x2049, 0x2049, 1}, {0x2122, 0x2122, 1}, {0x2139, 0x2139, 1},
+		{0x2194, 0x2199, 1}, {0x21A9, 0x21AA, 1}, {0x231A, 0x231B, 1},
+		{0x2328, 0x2328, 1}, {0x23CF, 0x23CF, 1}, {0x23E9, 0x23F3, 1},
+		{0x23F8, 0x23FA, 1}, {0x24C2, 0x24C2, 1}, {0x25AA, 0x25AB, 1},
+		{0x25B6, 0x25B6, 1}, {0x25C0, 0x25C0, 1}, {0x25FB, 0x25FE, 1},
+		{0x2600, 0x27BF, 1}, {0x2934, 0x2935, 1}, {0x2B05, 0x2B07, 1},
+		{0x2B1B, 0x2B1C, 1}, {0x2B50, 0x2B50, 1}, {0x2B55, 0x2B55, 1},
+		{0x3030, 0x3030, 1}, {0x303D, 0x303D, 1}, {0x3297, 0x3297, 1},
+		{0x3299, 0x3299, 1},
+	},
+	R32: []unicode.Range32{
+		{0x1F000, 0x1F1E5, 1}, {0x1F200, 0x1F3FA, 1}, {0x1F400, 0x1FAFF, 1},
+		{0x1FC00, 0x1FFFD, 1},
+	},
+}
+
+// emojiPresentationBMP lists BMP pictographs that render as emoji without a
+// variation selector. Everything pictographic above U+1F000 does too.
+var emojiPresentationBMP = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{0x231A, 0x231B, 1}, {0x23E9, 0x23EC, 1}, {0x23F0, 0x23F0, 1},
+		{0x23F3, 0x23F3, 1}, {0x25FD, 0x25FE, 1}, {0x2614, 0x2615, 1},
+		{0x2648, 0x2653, 1}, {0x267F, 0x267F, 1}, {0x2693, 0x2693, 1},
+		{0x26A1, 0x26A1, 1}, {0x26AA, 0x26AB, 1}, {0x26BD, 0x26BE, 1},
+		{0x26C4, 0x26C5, 1}, {0x26CE, 0x26CE, 1}, {0x26D4, 0x26D4, 1},
+		{0x26EA, 0x26EA, 1}, {0x26F2, 0x26F3, 1}, {0x26F5, 0x26F5, 1},
+		{0x26FA, 0x26FA, 1}, {0x26FD, 0x26FD, 1}, {0x2705, 0x2705, 1},
+		{0x270A, 0x270B, 1}, {0x2728, 0x2728, 1}, {0x274C, 0x274C, 1},
+		{0x274E, 0x274E, 1}, {0x2753, 0x2755, 1}, {0x2757, 0x2757, 1},
+		{0x2795, 0x2797, 1}, {0x27B0, 0x27B0, 1}, {0x27BF, 0x27BF, 1},
+		{0x2B1B, 0x2B1C, 1}, {0x2B50, 0x2B50, 1}, {0x2B55, 0x2B55, 1},
+	},
+}
+
+const (
+	zeroWidthJoiner    = '\u200D'
+	emojiVariation     = '\uFE0F'
+	combiningKeycap    = '\u20E3'
+	hangulSyllableBase = 0xAC00
+)
+
+func graphemeClassOf(r rune) graphemeClass {
+	switch {
+	case r == '\r':
+		return gcCR
+	case r == '\n':
+		return gcLF
+	case r == zeroWidthJoiner:
+		return gcZWJ
+	case r >= 0x1F1E6 && r <= 0x1F1FF:
+		return gcRegionalIndicator
+	case isGraphemeExtender(r):
+		return gcExtend
+	case unicode.Is(unicode.Mc, r):
+		return gcSpacingMark
+	case unicode.IsControl(r), r == 0x2028, r == 0x2029:
+		return gcControl
+	case r >= 0x1100 && r <= 0x115F, r >= 0xA960 && r <= 0xA97C:
+		return gcL
+	case r >= 0x1160 && r <= 0x11A7, r >= 0xD7B0 && r <= 0xD7C6:
+		return gcV
+	case r >= 0x11A8 && r <= 0x11FF, r >= 0xD7CB && r <= 0xD7FB:
+		return gcT
+	case r >= hangulSyllableBase && r <= 0xD7A3:
+		if (r-hangulSyllableBase)%28 == 0 {
+			return gcLV
+		}
+		return gcLVT
+	}
+	return gcOther
+}
+
+// isGraphemeExtender reports whether r attaches to the preceding character:
+// combining marks, variation selectors, emoji skin tone modifiers and the
+// tag characters of subdivision flags.
+func isGraphemeExtender(r rune) bool {
+	switch {
+	case r >= 0x1F3FB && r <= 0x1F3FF,
+		r >= 0xE0020 && r <= 0xE007F,
+		r >= 0xFE00 && r <= 0xFE0F,
+		r >= 0xE0100 && r <= 0xE01EF,
+		r == 0x200C:
+		return true
+	}
+	return unicode.Is(unicode.Mn, r) || unicode.Is(unicode.Me, r)
+}
+
+// splitGraphemes splits s into extended grapheme clusters following the
+// rules of UAX #29 that matter for user-visible length: CR LF, Hangul
+// syllables, combining and spacing marks, emoji modifier and ZWJ
+// sequences, and regional indicator pairs.
+func splitGraphemes(s string) []string {
+	var clusters []string
+	start := 0
+	prev := gcControl
+	// pictographic is set while the current cluster is an emoji followed
+	// only by extenders, so a ZWJ may join the next pictograph (GB11).
+	pictographic := false
+	regionalCount := 0
+	for i, r := range s {
+		class := graphemeClassOf(r)
+		if i > 0 && graphemeBreak(prev, class, r, pictographic, regionalCount) {
+			clusters = append(clusters, s[start:i])
+			start = i
+			pictographic = false
+			regionalCount = 0
+		}
+		switch {
+		case unicode.Is(pictographicRanges, r):
+			pictographic = true
+		case class != gcExtend && class != gcZWJ:
+			pictographic = false
+		}
+		if class == gcRegionalIndicator {
+			regionalCount++
+		}
+		prev = class
+	}
+	if start < len(s) {
+		clusters = append(clusters, s[start:])
+	}
+	return clusters
+}
+
+// graphemeBreak reports whether a cluster boundary falls between two runes.
+func graphemeBreak(prev, next graphemeClass, nextRune rune, pictographic bool, regionalCount int) bool {
+	switch {
+	case prev == gcCR && next == gcLF:
+		return false
+	case prev == gcCR || prev == gcLF || prev == gcControl,
+		next == gcCR || next == gcLF || next == gcControl:
+		return true
+	case prev == gcL && (next == gcL || next == gcV || next == gcLV || next == gcLVT):
+		return false
+	case (prev == gcLV || prev == gcV) && (next == gcV || next == gcT):
+		return false
+	case (prev == gcLVT || prev == gcT) && next == gcT:
+		return false
+	case next == gcExtend || next == gcZWJ || next == gcSpacingMark:
+		return false
+	case prev == gcZWJ && pictographic && unicode.Is(pictographicRanges, nextRune):
+		return false
+	case prev == gcRegionalIndicator && next == gcRegionalIndicator:
+		return regionalCount%2 == 0
+	}
+	return true
+}
+
+// isEmojiCluster reports whether a grapheme cluster renders as an emoji: a
+// pictograph with emoji presentation by default or by U+FE0F, a keycap
+// sequence, or a flag.
+func isEmojiCluster(cluster string) bool {
+	first, _ := utf8.DecodeRuneInString(cluster)
+	if first >= 0x1F1E6 && first <= 0x1F1FF {
+		return utf8.RuneCountInString(cluster) > 1
+	}
+	if strings.ContainsRune(cluster, combiningKeycap) {
+		return true
+	}
+	if !unicode.Is(pictographicRanges, first) {
+		return false
+	}
+	return first >= 0x1F000 || unicode.Is(emojiPresentationBMP, first) || strings.ContainsRune(cluster, emojiVariation)
+}
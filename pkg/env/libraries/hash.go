@@ -0,0 +1,108 @@
+package libraries
+
+import (
+	"fmt"
+	"github.com/SpecDrivenDesign/lql/pkg/errors"
+	"github.com/SpecDrivenDesign/lql/pkg/param"
+	"github.com/SpecDrivenDesign/lql/pkg/types"
+	"hash/fnv"
+	"math"
+)
+
+// HashLib implements stable bucketing functions for sharding and routing
+// rules. Their results depend only on their arguments, so services in other
+// languages can reproduce them.
+type HashLib struct{}
+
+func NewHashLib() *HashLib {
+	return &HashLib{}
+}
+
+// Functions describes the hash functions.
+func (h *HashLib) Functions() []param.Function {
+	return []param.Function{
+		{Name: "jump", Params: []param.Param{{Name: "key", Type: param.TypeNumeric}, {Name: "buckets", Type: param.TypeNumeric}}, Result: param.TypeNumeric, Doc: "Maps an integer key to a bucket with jump consistent hashing."},
+		{Name: "consistentBucket", Params: []param.Param{{Name: "key", Type: param.TypeAny}, {Name: "buckets", Type: param.TypeNumeric}}, Result: param.TypeNumeric, Doc: "Maps a string or integer key to a bucket with consistent hashing."},
+	}
+}
+
+func (h *HashLib) Call(functionName string, args []param.Arg, line, col, parenLine, parenCol int) (interface{}, error) {
+	switch functionName {
+	case "jump":
+		fn := "hash.jump"
+		if err := requireTwoArgs(fn, args, parenLine, parenCol); err != nil {
+			return nil, err
+		}
+		if !types.IsInt(args[0].Value) {
+			return nil, errors.NewTypeError(fn+": key must be an integer", args[0].Line, args[0].Column)
+		}
+		key, _ := types.ToInt(args[0].Value)
+		buckets, err := bucketCount(fn, args[1])
+		if err != nil {
+			return nil, err
+		}
+		return jumpHash(uint64(key), buckets), nil
+
+	case "consistentBucket":
+		fn := "hash.consistentBucket"
+		if err := requireTwoArgs(fn, args, parenLine, parenCol); err != nil {
+			return nil, err
+		}
+		var key string
+		switch k := args[0].Value.(type) {
+		case string:
+			key = k
+		case int, int64:
+			key = fmt.Sprintf("%d", k)
+		default:
+			return nil, errors.NewTypeError(fn+": key must be a string or an integer", args[0].Line, args[0].Column)
+		}
+		buckets, err := bucketCount(fn, args[1])
+		if err != nil {
+			return nil, err
+		}
+		hasher := fnv.New64a()
+		hasher.Write([]byte(key))
+		return jumpHash(hasher.Sum64(), buckets), nil
+
+	default:
+		return nil, errors.NewFunctionCallError(fmt.Sprintf("unknown hash function '%s'", functionName), 0, 0)
+	}
+}
+
+func requireTwoArgs(fn string, args []param.Arg, parenLine, parenCol int) error {
+	if len(args) == 2 {
+		return nil
+	}
+	if len(args) == 0 {
+		return errors.NewParameterError(fmt.Sprintf("%s requires 2 arguments", fn), parenLine, parenCol)
+	}
+	lastArg := args[len(args)-1]
+	return errors.NewParameterError(fmt.Sprintf("%s requires 2 arguments", fn), lastArg.Line, lastArg.Column)
+}
+
+// bucketCount validates a bucket count, which must fit in 32 bits like the
+// reference implementation's.
+func bucketCount(fn string, arg param.Arg) (int64, error) {
+	if !types.IsInt(arg.Value) {
+		return 0, errors.NewTypeError(fn+": bucket count must be an integer", arg.Line, arg.Column)
+	}
+	n, _ := types.ToInt(arg.Value)
+	if n < 1 || n > math.MaxInt32 {
+		return 0, errors.NewFunctionCallError(fmt.Sprintf("%s: bucket count must be between 1 and %d", fn, math.MaxInt32), arg.Line, arg.Column)
+	}
+	return n, nil
+}
+
+// jumpHash is the jump consistent hash of Lamping and Veach
+// (arXiv:1406.2294). Growing the bucket count from n to n+1 moves only
+// 1/(n+1) of the keys, all of them to the new bucket.
+func jumpHash(key uint64, buckets int64) int64 {
+	var b, j int64 = -1, 0
+	for j < buckets {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return b
+}
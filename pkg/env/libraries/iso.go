@@ -0,0 +1,102 @@
+package libraries
+
+import (
+	_ "embed"
+	"encoding/csv"
+	"fmt"
+	"github.com/SpecDrivenDesign/lql/pkg/errors"
+	"github.com/SpecDrivenDesign/lql/pkg/param"
+	"strings"
+	"sync"
+)
+
+// countriesCSV lists ISO 3166-1 alpha-2 codes with their English short
+// names and ISO 4217 currency codes.
+//
+//go:embed data/countries.csv
+var countriesCSV string
+
+type countryInfo struct {
+	name     string
+	currency string
+}
+
+var (
+	countriesOnce sync.Once
+	countries     map[string]countryInfo
+)
+
+// euMembers lists the member states of the European Union.
+var euMembers = map[string]bool{
+	"AT": true, "BE": true, "BG": true, "CY": true, "CZ": true, "DE": true,
+	"DK": true, "EE": true, "ES": true, "FI": true, "FR": true, "GR": true,
+	"HR": true, "HU": true, "IE": true, "IT": true, "LT": true, "LU": true,
+	"LV": true, "MT": true, "NL": true, "PL": true, "PT": true, "RO": true,
+	"SE": true, "SI": true, "SK": true,
+}
+
+func loadCountries() map[string]countryInfo {
+	countriesOnce.Do(func() {
+		records, err := csv.NewReader(strings.NewReader(countriesCSV)).ReadAll()
+		if err != nil {
+			panic(fmt.Sprintf("iso: malformed country table: %v", err))
+		}
+		countries = make(map[string]countryInfo, len(records))
+		for _, rec := range records[1:] {
+			countries[rec[0]] = countryInfo{name: rec[1], currency: rec[2]}
+		}
+	})
+	return countries
+}
+
+// ISOLib implements lookups against embedded ISO reference data.
+type ISOLib struct{}
+
+func NewISOLib() *ISOLib {
+	return &ISOLib{}
+}
+
+// Functions describes the iso functions.
+func (i *ISOLib) Functions() []param.Function {
+	return []param.Function{
+		{Name: "countryName", Params: []param.Param{{Name: "code", Type: param.TypeString}}, Result: param.TypeString, Doc: "Returns the name of a country, or null."},
+		{Name: "currencyForCountry", Params: []param.Param{{Name: "code", Type: param.TypeString}}, Result: param.TypeString, Doc: "Returns the currency of a country, or null."},
+		{Name: "isEU", Params: []param.Param{{Name: "code", Type: param.TypeString}}, Result: param.TypeBoolean, Doc: "Reports whether a country is a member of the European Union."},
+		{Name: "isCountry", Params: []param.Param{{Name: "code", Type: param.TypeString}}, Result: param.TypeBoolean, Doc: "Reports whether code is an ISO 3166-1 alpha-2 code."},
+	}
+}
+
+func (i *ISOLib) Call(functionName string, args []param.Arg, line, col, _, _ int) (interface{}, error) {
+	switch functionName {
+	case "countryName", "currencyForCountry", "isEU", "isCountry":
+	default:
+		return nil, errors.NewFunctionCallError(fmt.Sprintf("unknown iso function '%s'", functionName), 0, 0)
+	}
+	if len(args) != 1 {
+		return nil, errors.NewParameterError(fmt.Sprintf("iso.%s requires 1 argument", functionName), line, col)
+	}
+	arg0 := args[0]
+	code, ok := arg0.Value.(string)
+	if !ok {
+		return nil, errors.NewTypeError(fmt.Sprintf("iso.%s: country code must be a string", functionName), arg0.Line, arg0.Column)
+	}
+	code = strings.ToUpper(strings.TrimSpace(code))
+	info, known := loadCountries()[code]
+
+	switch functionName {
+	case "countryName":
+		if !known {
+			return nil, nil
+		}
+		return info.name, nil
+	case "currencyForCountry":
+		if !known || info.currency == "" {
+			return nil, nil
+		}
+		return info.currency, nil
+	case "isEU":
+		return euMembers[code], nil
+	default:
+		return known, nil
+	}
+}
@@ -0,0 +1,145 @@
+package libraries
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/SpecDrivenDesign/lql/pkg/errors"
+	"github.com/SpecDrivenDesign/lql/pkg/param"
+	"hash"
+	"strings"
+)
+
+// jwtHmacAlgorithms maps the supported "alg" header values to their hashes.
+var jwtHmacAlgorithms = map[string]func() hash.Hash{
+	"HS256": sha256.New,
+	"HS384": sha512.New384,
+	"HS512": sha512.New,
+}
+
+// JWTLib implements JSON Web Token inspection.
+type JWTLib struct{}
+
+func NewJWTLib() *JWTLib {
+	return &JWTLib{}
+}
+
+// Functions describes the jwt functions.
+func (j *JWTLib) Functions() []param.Function {
+	return []param.Function{
+		{Name: "decode", Params: []param.Param{{Name: "token", Type: param.TypeString}}, Result: param.TypeObject, Doc: "Decodes the header and payload of a JWT without verifying it."},
+		{Name: "verifyHmac", Params: []param.Param{{Name: "token", Type: param.TypeString}, {Name: "secret", Type: param.TypeString}}, Result: param.TypeBoolean, Doc: "Reports whether an HMAC-signed JWT has a valid signature."},
+	}
+}
+
+func (j *JWTLib) Call(functionName string, args []param.Arg, line, col, _, _ int) (interface{}, error) {
+	switch functionName {
+	case "decode":
+		if len(args) != 1 {
+			return nil, errors.NewParameterError("jwt.decode requires 1 argument", line, col)
+		}
+		arg0 := args[0]
+		token, ok := arg0.Value.(string)
+		if !ok {
+			return nil, errors.NewTypeError("jwt.decode: token must be a string", arg0.Line, arg0.Column)
+		}
+		header, claims, _, ok := splitJWT(token)
+		if !ok {
+			return nil, errors.NewFunctionCallError("jwt.decode: malformed token", arg0.Line, arg0.Column)
+		}
+		return map[string]interface{}{
+			"header": header,
+			"claims": claims,
+		}, nil
+
+	case "verifyHmac":
+		if len(args) != 2 {
+			return nil, errors.NewParameterError("jwt.verifyHmac requires 2 arguments", line, col)
+		}
+		token, ok := args[0].Value.(string)
+		if !ok {
+			return nil, errors.NewTypeError("jwt.verifyHmac: token must be a string", args[0].Line, args[0].Column)
+		}
+		secret, ok := args[1].Value.(string)
+		if !ok {
+			return nil, errors.NewTypeError("jwt.verifyHmac: secret must be a string", args[1].Line, args[1].Column)
+		}
+		header, _, signature, ok := splitJWT(token)
+		if !ok {
+			return false, nil
+		}
+		alg, _ := header["alg"].(string)
+		newHash, ok := jwtHmacAlgorithms[alg]
+		if !ok {
+			return false, nil
+		}
+		mac := hmac.New(newHash, []byte(secret))
+		mac.Write([]byte(token[:strings.LastIndex(token, ".")]))
+		return hmac.Equal(mac.Sum(nil), signature), nil
+
+	default:
+		return nil, errors.NewFunctionCallError(fmt.Sprintf("unknown jwt function '%s'", functionName), 0, 0)
+	}
+}
+
+// splitJWT decodes the three segments of a compact JWS. The header and
+// claims must be JSON objects.
+func splitJWT(token string) (map[string]interface{}, map[string]interface{}, []byte, bool) {
+	parts := strings.Split(strings.TrimSpace(token), ".")
+	if len(parts) != 3 {
+		return nil, nil, nil, false
+	}
+	header, ok := decodeJWTSegment(parts[0])
+	if !ok {
+		return nil, nil, nil, false
+	}
+	claims, ok := decodeJWTSegment(parts[1])
+	if !ok {
+		return nil, nil, nil, false
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[2], "="))
+	if err != nil {
+		return nil, nil, nil, false
+	}
+	return header, claims, signature, true
+}
+
+func decodeJWTSegment(segment string) (map[string]interface{}, bool) {
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(segment, "="))
+	if err != nil {
+		return nil, false
+	}
+	dec := json.NewDecoder(strings.NewReader(string(data)))
+	dec.UseNumber()
+	var obj map[string]interface{}
+	if err := dec.Decode(&obj); err != nil || obj == nil {
+		return nil, false
+	}
+	return normalizeJSONNumbers(obj).(map[string]interface{}), true
+}
+
+// normalizeJSONNumbers replaces json.Number values with int64 when integral
+// and float64 otherwise, so claims such as "exp" take part in integer
+// arithmetic.
+func normalizeJSONNumbers(v interface{}) interface{} {
+	switch val := v.(type) {
+	case json.Number:
+		if i, err := val.Int64(); err == nil {
+			return i
+		}
+		f, _ := val.Float64()
+		return f
+	case map[string]interface{}:
+		for k, elem := range val {
+			val[k] = normalizeJSONNumbers(elem)
+		}
+	case []interface{}:
+		for i, elem := range val {
+			val[i] = normalizeJSONNumbers(elem)
+		}
+	}
+	return v
+}
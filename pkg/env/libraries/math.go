@@ -6,16 +6,50 @@ import (
 	"github.com/SpecDrivenDesign/lql/pkg/param"
 	"github.com/SpecDrivenDesign/lql/pkg/types"
 	"math"
+	"strconv"
+	"strings"
 )
 
 // MathLib implements math library functions.
-type MathLib struct{}
+type MathLib struct {
+	// PromoteNumbers lets sum, min, max and avg combine ints and floats,
+	// returning a float; see Environment.SetNumericPromotion.
+	PromoteNumbers bool
+	// Decimal makes sum, min, max and avg of numbers that are not all ints
+	// exact, returning a types.Decimal; see
+	// Environment.SetDecimalArithmetic.
+	Decimal bool
+}
 
 func NewMathLib() *MathLib {
 	return &MathLib{}
 }
 
+// Functions describes the math functions.
+func (m *MathLib) Functions() []param.Function {
+	return []param.Function{
+		{Name: "abs", Params: []param.Param{{Name: "x", Type: param.TypeNumeric}}, Result: param.TypeNumeric, Doc: "Returns the absolute value of x."},
+		{Name: "sqrt", Params: []param.Param{{Name: "x", Type: param.TypeNumeric}}, Result: param.TypeNumeric, Doc: "Returns the square root of x."},
+		{Name: "floor", Params: []param.Param{{Name: "x", Type: param.TypeNumeric}}, Result: param.TypeNumeric, Doc: "Rounds x down to an integer."},
+		{Name: "round", Params: []param.Param{{Name: "x", Type: param.TypeNumeric}}, Result: param.TypeNumeric, Doc: "Rounds x to the nearest integer."},
+		{Name: "ceil", Params: []param.Param{{Name: "x", Type: param.TypeNumeric}}, Result: param.TypeNumeric, Doc: "Rounds x up to an integer."},
+		{Name: "pow", Params: []param.Param{{Name: "x", Type: param.TypeNumeric}, {Name: "y", Type: param.TypeNumeric}}, Result: param.TypeNumeric, Doc: "Returns x raised to the power y."},
+		{Name: "sum", Params: []param.Param{{Name: "arr", Type: param.TypeArray}, {Name: "subfield", Type: param.TypeString, Optional: true}, {Name: "defaultVal", Type: param.TypeNumeric, Optional: true}}, Result: param.TypeNumeric, Doc: "Sums the numbers in arr, or the subfield of its objects."},
+		{Name: "min", Params: []param.Param{{Name: "arr", Type: param.TypeArray}, {Name: "subfield", Type: param.TypeString, Optional: true}, {Name: "defaultVal", Type: param.TypeNumeric, Optional: true}}, Result: param.TypeNumeric, Doc: "Returns the smallest number in arr, or of the subfield of its objects."},
+		{Name: "max", Params: []param.Param{{Name: "arr", Type: param.TypeArray}, {Name: "subfield", Type: param.TypeString, Optional: true}, {Name: "defaultVal", Type: param.TypeNumeric, Optional: true}}, Result: param.TypeNumeric, Doc: "Returns the largest number in arr, or of the subfield of its objects."},
+		{Name: "avg", Params: []param.Param{{Name: "arr", Type: param.TypeArray}, {Name: "subfield", Type: param.TypeString, Optional: true}, {Name: "defaultVal", Type: param.TypeNumeric, Optional: true}}, Result: param.TypeNumeric, Doc: "Averages the numbers in arr, or the subfield of its objects."},
+		{Name: "weightedSum", Params: []param.Param{{Name: "arr", Type: param.TypeArray}, {Name: "valueField", Type: param.TypeString}, {Name: "weightField", Type: param.TypeString}}, Result: param.TypeNumeric, Doc: "Sums value times weight over an array of objects."},
+		{Name: "weightedAvg", Params: []param.Param{{Name: "arr", Type: param.TypeArray}, {Name: "valueField", Type: param.TypeString}, {Name: "weightField", Type: param.TypeString}}, Result: param.TypeNumeric, Doc: "Averages valueField weighted by weightField over an array of objects."},
+		{Name: "ratio", Params: []param.Param{{Name: "numerator", Type: param.TypeNumeric}, {Name: "denominator", Type: param.TypeNumeric}, {Name: "default", Type: param.TypeAny}}, Result: param.TypeAny, Doc: "Divides numerator by denominator, or returns default when denominator is zero."},
+		{Name: "percentChange", Params: []param.Param{{Name: "old", Type: param.TypeNumeric}, {Name: "new", Type: param.TypeNumeric}, {Name: "default", Type: param.TypeAny}}, Result: param.TypeAny, Doc: "Returns the change from old to new in percent, or default when old is zero."},
+		{Name: "formatNumber", Params: []param.Param{{Name: "x", Type: param.TypeNumeric}, {Name: "decimals", Type: param.TypeNumeric, Optional: true}, {Name: "thousandsSep", Type: param.TypeString, Optional: true}, {Name: "decimalSep", Type: param.TypeString, Optional: true}}, Result: param.TypeString, Doc: "Formats x with grouped thousands."},
+		{Name: "toFixed", Params: []param.Param{{Name: "x", Type: param.TypeNumeric}, {Name: "decimals", Type: param.TypeNumeric}}, Result: param.TypeString, Doc: "Formats x with exactly decimals places."},
+		{Name: "toPercent", Params: []param.Param{{Name: "x", Type: param.TypeNumeric}, {Name: "decimals", Type: param.TypeNumeric, Optional: true}}, Result: param.TypeString, Doc: "Formats x times 100 followed by a percent sign."},
+	}
+}
+
 func (m *MathLib) Call(functionName string, args []param.Arg, line, col, parenLine, parenCol int) (interface{}, error) {
+	promote, decimal := m.PromoteNumbers || m.Decimal, m.Decimal
 	switch functionName {
 	case "abs":
 		if len(args) != 1 {
@@ -129,6 +163,7 @@ func (m *MathLib) Call(functionName string, args []param.Arg, line, col, parenLi
 		sum := 0.0
 		var firstNumericTypeSet bool = false
 		var firstIsInt bool = false
+		var nums []interface{}
 		for _, elem := range arr {
 			var num interface{}
 			if subfield != "" {
@@ -157,17 +192,24 @@ func (m *MathLib) Call(functionName string, args []param.Arg, line, col, parenLi
 			if !ok {
 				return nil, errors.NewTypeError("math.sum: element is not numeric", arg0.Line, arg0.Column)
 			}
+			nums = append(nums, num)
 			// Enforce uniform numeric type: no implicit conversion between int and float.
 			if !firstNumericTypeSet {
 				firstIsInt = types.IsInt(num)
 				firstNumericTypeSet = true
 			} else {
 				if types.IsInt(num) != firstIsInt {
-					return nil, errors.NewSemanticError("Mixed numeric types require explicit conversion", arg0.Line, arg0.Column)
+					if !promote {
+						return nil, errors.NewSemanticError("Mixed numeric types require explicit conversion", arg0.Line, arg0.Column)
+					}
+					firstIsInt = false
 				}
 			}
 			sum += nf
 		}
+		if d, ok := decimalAggregate(functionName, nums, decimal); ok {
+			return d, nil
+		}
 		if firstNumericTypeSet && firstIsInt {
 			return int64(sum), nil
 		}
@@ -209,6 +251,7 @@ func (m *MathLib) Call(functionName string, args []param.Arg, line, col, parenLi
 		var firstNumericTypeSet bool = false
 		var firstIsInt bool = false
 		first := true
+		var nums []interface{}
 		for _, elem := range arr {
 			var num interface{}
 			if subfield != "" {
@@ -237,13 +280,17 @@ func (m *MathLib) Call(functionName string, args []param.Arg, line, col, parenLi
 			if !ok {
 				return nil, errors.NewTypeError("math.min: element is not numeric", arg0.Line, arg0.Column)
 			}
+			nums = append(nums, num)
 			// Enforce uniform numeric type.
 			if !firstNumericTypeSet {
 				firstIsInt = types.IsInt(num)
 				firstNumericTypeSet = true
 			} else {
 				if types.IsInt(num) != firstIsInt {
-					return nil, errors.NewSemanticError("Mixed numeric types require explicit conversion", arg0.Line, arg0.Column)
+					if !promote {
+						return nil, errors.NewSemanticError("Mixed numeric types require explicit conversion", arg0.Line, arg0.Column)
+					}
+					firstIsInt = false
 				}
 			}
 			if first {
@@ -255,6 +302,9 @@ func (m *MathLib) Call(functionName string, args []param.Arg, line, col, parenLi
 				}
 			}
 		}
+		if d, ok := decimalAggregate(functionName, nums, decimal); ok {
+			return d, nil
+		}
 		if firstNumericTypeSet && firstIsInt {
 			return int64(m), nil
 		}
@@ -296,6 +346,7 @@ func (m *MathLib) Call(functionName string, args []param.Arg, line, col, parenLi
 		var firstNumericTypeSet bool = false
 		var firstIsInt bool = false
 		first := true
+		var nums []interface{}
 		for _, elem := range arr {
 			var num interface{}
 			if subfield != "" {
@@ -324,13 +375,17 @@ func (m *MathLib) Call(functionName string, args []param.Arg, line, col, parenLi
 			if !ok {
 				return nil, errors.NewTypeError("math.max: element is not numeric", arg0.Line, arg0.Column)
 			}
+			nums = append(nums, num)
 			// Enforce uniform numeric type.
 			if !firstNumericTypeSet {
 				firstIsInt = types.IsInt(num)
 				firstNumericTypeSet = true
 			} else {
 				if types.IsInt(num) != firstIsInt {
-					return nil, errors.NewSemanticError("Mixed numeric types require explicit conversion", arg0.Line, arg0.Column)
+					if !promote {
+						return nil, errors.NewSemanticError("Mixed numeric types require explicit conversion", arg0.Line, arg0.Column)
+					}
+					firstIsInt = false
 				}
 			}
 			if first {
@@ -342,6 +397,9 @@ func (m *MathLib) Call(functionName string, args []param.Arg, line, col, parenLi
 				}
 			}
 		}
+		if d, ok := decimalAggregate(functionName, nums, decimal); ok {
+			return d, nil
+		}
 		if firstNumericTypeSet && firstIsInt {
 			return int64(m), nil
 		}
@@ -383,6 +441,7 @@ func (m *MathLib) Call(functionName string, args []param.Arg, line, col, parenLi
 		count := 0
 		var firstNumericTypeSet bool = false
 		var firstIsInt bool = false
+		var nums []interface{}
 		for _, elem := range arr {
 			var num interface{}
 			if subfield != "" {
@@ -402,22 +461,274 @@ func (m *MathLib) Call(functionName string, args []param.Arg, line, col, parenLi
 			if !ok {
 				return nil, errors.NewTypeError("math.avg: element is not numeric", arg0.Line, arg0.Column)
 			}
+			nums = append(nums, num)
 			// Enforce uniform numeric type.
 			if !firstNumericTypeSet {
 				firstIsInt = types.IsInt(num)
 				firstNumericTypeSet = true
 			} else {
 				if types.IsInt(num) != firstIsInt {
-					return nil, errors.NewSemanticError("Mixed numeric types require explicit conversion", arg0.Line, arg0.Column)
+					if !promote {
+						return nil, errors.NewSemanticError("Mixed numeric types require explicit conversion", arg0.Line, arg0.Column)
+					}
+					firstIsInt = false
 				}
 			}
 			sum += nf
 			count++
 		}
+		if d, ok := decimalAggregate(functionName, nums, decimal); ok {
+			return d, nil
+		}
 		// For average, always return a float (to account for fractional averages).
 		return sum / float64(count), nil
 
+	case "weightedSum", "weightedAvg":
+		fn := "math." + functionName
+		if len(args) != 3 {
+			return nil, errors.NewParameterError(fmt.Sprintf("%s requires 3 arguments", fn), line, col)
+		}
+		arg0 := args[0]
+		arr, ok := types.ConvertToInterfaceSlice(arg0.Value)
+		if !ok {
+			return nil, errors.NewTypeError(fmt.Sprintf("%s: first argument must be an array", fn), arg0.Line, arg0.Column)
+		}
+		arg1 := args[1]
+		valueField, ok := arg1.Value.(string)
+		if !ok {
+			return nil, errors.NewTypeError(fmt.Sprintf("%s: second argument must be string", fn), arg1.Line, arg1.Column)
+		}
+		arg2 := args[2]
+		weightField, ok := arg2.Value.(string)
+		if !ok {
+			return nil, errors.NewTypeError(fmt.Sprintf("%s: third argument must be string", fn), arg2.Line, arg2.Column)
+		}
+		if functionName == "weightedAvg" && len(arr) == 0 {
+			return nil, errors.NewFunctionCallError(fmt.Sprintf("%s: array is empty", fn), arg0.Line, arg0.Column)
+		}
+		sum, totalWeight := 0.0, 0.0
+		for _, elem := range arr {
+			obj, ok := types.ConvertToStringMap(elem)
+			if !ok {
+				return nil, errors.NewFunctionCallError(fmt.Sprintf("%s: element is not an object", fn), arg0.Line, arg0.Column)
+			}
+			var pair [2]float64
+			for i, field := range []string{valueField, weightField} {
+				v, exists := obj[field]
+				if !exists {
+					return nil, errors.NewFunctionCallError(fmt.Sprintf("%s: field '%s' missing in element", fn, field), arg0.Line, arg0.Column)
+				}
+				n, ok := types.ToFloat(v)
+				if !ok {
+					return nil, errors.NewTypeError(fmt.Sprintf("%s: field '%s' is not numeric", fn, field), arg0.Line, arg0.Column)
+				}
+				pair[i] = n
+			}
+			sum += pair[0] * pair[1]
+			totalWeight += pair[1]
+		}
+		if functionName == "weightedSum" {
+			return sum, nil
+		}
+		if totalWeight == 0 {
+			return nil, errors.NewFunctionCallError(fmt.Sprintf("%s: total weight is zero", fn), arg0.Line, arg0.Column)
+		}
+		return sum / totalWeight, nil
+
+	case "ratio", "percentChange":
+		fn := "math." + functionName
+		if len(args) != 3 {
+			return nil, errors.NewParameterError(fmt.Sprintf("%s requires 3 arguments", fn), line, col)
+		}
+		arg0 := args[0]
+		a, ok := types.ToFloat(arg0.Value)
+		if !ok {
+			return nil, errors.NewTypeError(fmt.Sprintf("%s: first argument must be numeric", fn), arg0.Line, arg0.Column)
+		}
+		arg1 := args[1]
+		b, ok := types.ToFloat(arg1.Value)
+		if !ok {
+			return nil, errors.NewTypeError(fmt.Sprintf("%s: second argument must be numeric", fn), arg1.Line, arg1.Column)
+		}
+		if functionName == "ratio" {
+			if b == 0 {
+				return args[2].Value, nil
+			}
+			return a / b, nil
+		}
+		// percentChange(old, new): the change relative to the size of the
+		// old value, so a rise from a negative base is still positive.
+		if a == 0 {
+			return args[2].Value, nil
+		}
+		return (b - a) / math.Abs(a) * 100, nil
+
+	case "formatNumber":
+		if len(args) < 1 || len(args) > 4 {
+			if len(args) == 0 {
+				return nil, errors.NewParameterError("math.formatNumber requires 1 to 4 arguments", parenLine, parenCol)
+			}
+			lastArg := args[len(args)-1]
+			return nil, errors.NewParameterError("math.formatNumber requires 1 to 4 arguments", lastArg.Line, lastArg.Column)
+		}
+		arg0 := args[0]
+		num, ok := types.ToFloat(arg0.Value)
+		if !ok {
+			return nil, errors.NewTypeError("math.formatNumber: first argument must be numeric", arg0.Line, arg0.Column)
+		}
+		decimals := 0
+		if len(args) >= 2 {
+			d, err := decimalsArg("math.formatNumber", args[1])
+			if err != nil {
+				return nil, err
+			}
+			decimals = d
+		}
+		thousandsSep, decimalSep := ",", "."
+		if len(args) >= 3 {
+			arg2 := args[2]
+			sep, ok := arg2.Value.(string)
+			if !ok {
+				return nil, errors.NewTypeError("math.formatNumber: thousands separator must be a string", arg2.Line, arg2.Column)
+			}
+			thousandsSep = sep
+		}
+		if len(args) == 4 {
+			arg3 := args[3]
+			sep, ok := arg3.Value.(string)
+			if !ok {
+				return nil, errors.NewTypeError("math.formatNumber: decimal separator must be a string", arg3.Line, arg3.Column)
+			}
+			decimalSep = sep
+		}
+		return formatNumber(num, decimals, thousandsSep, decimalSep), nil
+
+	case "toFixed":
+		if len(args) != 2 {
+			if len(args) == 0 {
+				return nil, errors.NewParameterError("math.toFixed requires 2 arguments", parenLine, parenCol)
+			}
+			lastArg := args[len(args)-1]
+			return nil, errors.NewParameterError("math.toFixed requires 2 arguments", lastArg.Line, lastArg.Column)
+		}
+		arg0 := args[0]
+		num, ok := types.ToFloat(arg0.Value)
+		if !ok {
+			return nil, errors.NewTypeError("math.toFixed: first argument must be numeric", arg0.Line, arg0.Column)
+		}
+		decimals, err := decimalsArg("math.toFixed", args[1])
+		if err != nil {
+			return nil, err
+		}
+		return formatFixed(num, decimals), nil
+
+	case "toPercent":
+		if len(args) < 1 || len(args) > 2 {
+			if len(args) == 0 {
+				return nil, errors.NewParameterError("math.toPercent requires 1 or 2 arguments", parenLine, parenCol)
+			}
+			lastArg := args[len(args)-1]
+			return nil, errors.NewParameterError("math.toPercent requires 1 or 2 arguments", lastArg.Line, lastArg.Column)
+		}
+		arg0 := args[0]
+		num, ok := types.ToFloat(arg0.Value)
+		if !ok {
+			return nil, errors.NewTypeError("math.toPercent: first argument must be numeric", arg0.Line, arg0.Column)
+		}
+		decimals := 0
+		if len(args) == 2 {
+			d, err := decimalsArg("math.toPercent", args[1])
+			if err != nil {
+				return nil, err
+			}
+			decimals = d
+		}
+		return formatFixed(num*100, decimals) + "%", nil
+
 	default:
 		return nil, errors.NewFunctionCallError(fmt.Sprintf("unknown math function '%s'", functionName), 0, 0)
 	}
 }
+
+// maxFormatDecimals bounds the precision accepted by the formatting functions.
+const maxFormatDecimals = 20
+
+// decimalsArg validates a decimal-places argument.
+func decimalsArg(fn string, arg param.Arg) (int, error) {
+	if !types.IsInt(arg.Value) {
+		return 0, errors.NewTypeError(fmt.Sprintf("%s: decimals must be an integer", fn), arg.Line, arg.Column)
+	}
+	d, _ := types.ToFloat(arg.Value)
+	if d < 0 || d > maxFormatDecimals {
+		return 0, errors.NewFunctionCallError(fmt.Sprintf("%s: decimals must be between 0 and %d", fn, maxFormatDecimals), arg.Line, arg.Column)
+	}
+	return int(d), nil
+}
+
+// formatFixed formats num with decimals places and no grouping. A number
+// that rounds to zero is written without a sign, as formatNumber writes it.
+func formatFixed(num float64, decimals int) string {
+	s := strconv.FormatFloat(num, 'f', decimals, 64)
+	if strings.Trim(s, "-0.") == "" {
+		return strings.TrimPrefix(s, "-")
+	}
+	return s
+}
+
+// formatNumber renders num with a fixed number of decimals, grouping the
+// integer digits in threes.
+func formatNumber(num float64, decimals int, thousandsSep, decimalSep string) string {
+	s := strconv.FormatFloat(math.Abs(num), 'f', decimals, 64)
+	intPart, fracPart := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		intPart, fracPart = s[:i], s[i+1:]
+	}
+	var sb strings.Builder
+	if num < 0 && strings.Trim(s, "0.") != "" {
+		sb.WriteByte('-')
+	}
+	for i, d := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			sb.WriteString(thousandsSep)
+		}
+		sb.WriteRune(d)
+	}
+	if fracPart != "" {
+		sb.WriteString(decimalSep)
+		sb.WriteString(fracPart)
+	}
+	return sb.String()
+}
+
+// decimalAggregate computes sum, min, max or avg of nums exactly when any
+// of them is a Decimal, or, in decimal mode, when they are not all ints.
+// It reports false when the aggregate is computed as usual instead.
+func decimalAggregate(functionName string, nums []interface{}, decimal bool) (types.Decimal, bool) {
+	allInts, anyDecimal := true, false
+	for _, num := range nums {
+		allInts = allInts && types.IsInt(num)
+		anyDecimal = anyDecimal || types.IsDecimal(num)
+	}
+	if len(nums) == 0 || allInts || !(decimal || anyDecimal) {
+		return types.Decimal{}, false
+	}
+	var result types.Decimal
+	for i, num := range nums {
+		d, ok := types.DecimalOf(num)
+		if !ok {
+			return types.Decimal{}, false
+		}
+		switch {
+		case i == 0:
+			result = d
+		case functionName == "min" && d.Cmp(result) < 0, functionName == "max" && d.Cmp(result) > 0:
+			result = d
+		case functionName == "sum" || functionName == "avg":
+			result = result.Add(d)
+		}
+	}
+	if functionName == "avg" {
+		result = result.Quo(types.NewDecimal(int64(len(nums)), 0))
+	}
+	return result, true
+}
@@ -0,0 +1,67 @@
+package libraries
+
+import (
+	"github.com/SpecDrivenDesign/lql/pkg/errors"
+	"github.com/SpecDrivenDesign/lql/pkg/param"
+	"testing"
+)
+
+func TestFixedFormatsWithoutNegativeZero(t *testing.T) {
+	tests := []struct {
+		function string
+		x        float64
+		decimals int64
+		want     string
+	}{
+		{"toFixed", -0.001, 2, "0.00"},
+		{"toFixed", -0.4, 0, "0"},
+		{"toFixed", -0.0, 1, "0.0"},
+		{"toFixed", -0.005, 3, "-0.005"},
+		{"toFixed", -1.25, 1, "-1.2"},
+		{"toFixed", 0.001, 2, "0.00"},
+		{"toPercent", -0.00001, 0, "0%"},
+		{"toPercent", -0.00001, 3, "-0.001%"},
+	}
+	lib := NewMathLib()
+	for _, tt := range tests {
+		args := []param.Arg{{Value: tt.x}, {Value: tt.decimals}}
+		got, err := lib.Call(tt.function, args, 1, 1, 1, 1)
+		if err != nil {
+			t.Errorf("math.%s(%v, %d): %v", tt.function, tt.x, tt.decimals, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("math.%s(%v, %d) = %q, want %q", tt.function, tt.x, tt.decimals, got, tt.want)
+		}
+	}
+}
+
+func TestFormattingArityErrorPositions(t *testing.T) {
+	one := []param.Arg{{Value: 1.5, Line: 1, Column: 15}}
+	three := append(one, param.Arg{Value: int64(1), Line: 1, Column: 20}, param.Arg{Value: int64(2), Line: 1, Column: 23})
+	tests := []struct {
+		function string
+		args     []param.Arg
+		column   int
+	}{
+		// With no arguments the error points at the parenthesis,
+		// otherwise at the last argument.
+		{"toFixed", nil, 14},
+		{"toFixed", one, 15},
+		{"toFixed", three, 23},
+		{"toPercent", nil, 14},
+		{"toPercent", three, 23},
+		{"formatNumber", nil, 14},
+	}
+	lib := NewMathLib()
+	for _, tt := range tests {
+		_, err := lib.Call(tt.function, tt.args, 1, 1, 1, 14)
+		if err == nil {
+			t.Errorf("math.%s with %d arguments succeeded", tt.function, len(tt.args))
+			continue
+		}
+		if line, column := errors.GetErrorPosition(err); line != 1 || column != tt.column {
+			t.Errorf("math.%s with %d arguments: error at %d:%d, want 1:%d", tt.function, len(tt.args), line, column, tt.column)
+		}
+	}
+}
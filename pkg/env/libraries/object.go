@@ -0,0 +1,215 @@
+package libraries
+
+import (
+	"fmt"
+	"github.com/SpecDrivenDesign/lql/pkg/errors"
+	"github.com/SpecDrivenDesign/lql/pkg/param"
+	"github.com/SpecDrivenDesign/lql/pkg/types"
+	"sort"
+	"strings"
+)
+
+// ObjectLib implements object library functions.
+type ObjectLib struct{}
+
+func NewObjectLib() *ObjectLib {
+	return &ObjectLib{}
+}
+
+// Functions describes the object functions.
+func (o *ObjectLib) Functions() []param.Function {
+	return []param.Function{
+		{Name: "flatten", Params: []param.Param{{Name: "obj", Type: param.TypeObject}, {Name: "separator", Type: param.TypeString, Optional: true}}, Result: param.TypeObject, Doc: "Joins nested key paths into the keys of a single-level object."},
+		{Name: "unflatten", Params: []param.Param{{Name: "obj", Type: param.TypeObject}, {Name: "separator", Type: param.TypeString, Optional: true}}, Result: param.TypeObject, Doc: "Rebuilds nested objects from flattened keys."},
+		{Name: "changedFields", Params: []param.Param{{Name: "before", Type: param.TypeObject}, {Name: "after", Type: param.TypeObject}}, Result: param.TypeArray, Doc: "Returns the key paths whose values differ."},
+		{Name: "diff", Params: []param.Param{{Name: "before", Type: param.TypeObject}, {Name: "after", Type: param.TypeObject}}, Result: param.TypeObject, Doc: "Maps each changed key path to its before and after values."},
+	}
+}
+
+func (o *ObjectLib) Call(functionName string, args []param.Arg, line, col, parenLine, parenCol int) (interface{}, error) {
+	switch functionName {
+	case "flatten":
+		obj, sep, err := objectAndSeparator("object.flatten", args, parenLine, parenCol)
+		if err != nil {
+			return nil, err
+		}
+		result := make(map[string]interface{})
+		flattenInto(result, "", obj, sep)
+		return result, nil
+
+	case "unflatten":
+		obj, sep, err := objectAndSeparator("object.unflatten", args, parenLine, parenCol)
+		if err != nil {
+			return nil, err
+		}
+		keys := make([]string, 0, len(obj))
+		for k := range obj {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		result := make(map[string]interface{})
+		for _, key := range keys {
+			parts := strings.Split(key, sep)
+			node := result
+			for i, part := range parts[:len(parts)-1] {
+				next, exists := node[part]
+				if !exists {
+					child := make(map[string]interface{})
+					node[part] = child
+					node = child
+					continue
+				}
+				child, ok := next.(map[string]interface{})
+				if !ok {
+					return nil, errors.NewFunctionCallError(fmt.Sprintf("object.unflatten: key '%s' conflicts with '%s'", key, strings.Join(parts[:i+1], sep)), args[0].Line, args[0].Column)
+				}
+				node = child
+			}
+			last := parts[len(parts)-1]
+			if _, exists := node[last]; exists {
+				return nil, errors.NewFunctionCallError(fmt.Sprintf("object.unflatten: key '%s' conflicts with a nested key", key), args[0].Line, args[0].Column)
+			}
+			node[last] = obj[key]
+		}
+		return result, nil
+
+	case "changedFields":
+		before, after, err := beforeAndAfter("object.changedFields", args, parenLine, parenCol)
+		if err != nil {
+			return nil, err
+		}
+		paths := []interface{}{}
+		diffObjects("", before, after, func(path string, _, _ interface{}) {
+			paths = append(paths, path)
+		})
+		return paths, nil
+
+	case "diff":
+		before, after, err := beforeAndAfter("object.diff", args, parenLine, parenCol)
+		if err != nil {
+			return nil, err
+		}
+		result := make(map[string]interface{})
+		diffObjects("", before, after, func(path string, b, a interface{}) {
+			result[path] = map[string]interface{}{"before": b, "after": a}
+		})
+		return result, nil
+
+	default:
+		return nil, errors.NewFunctionCallError(fmt.Sprintf("unknown object function '%s'", functionName), 0, 0)
+	}
+}
+
+// objectAndSeparator validates the (object[, separator]) arguments shared by
+// flatten and unflatten. The separator defaults to ".".
+func objectAndSeparator(fn string, args []param.Arg, parenLine, parenCol int) (map[string]interface{}, string, error) {
+	if len(args) < 1 || len(args) > 2 {
+		if len(args) == 0 {
+			return nil, "", errors.NewParameterError(fmt.Sprintf("%s requires 1 or 2 arguments", fn), parenLine, parenCol)
+		}
+		lastArg := args[len(args)-1]
+		return nil, "", errors.NewParameterError(fmt.Sprintf("%s requires 1 or 2 arguments", fn), lastArg.Line, lastArg.Column)
+	}
+	arg0 := args[0]
+	obj, ok := types.ConvertToStringMap(arg0.Value)
+	if !ok {
+		return nil, "", errors.NewTypeError(fmt.Sprintf("%s: first argument must be an object", fn), arg0.Line, arg0.Column)
+	}
+	sep := "."
+	if len(args) == 2 {
+		arg1 := args[1]
+		s, ok := arg1.Value.(string)
+		if !ok {
+			return nil, "", errors.NewTypeError(fmt.Sprintf("%s: separator must be a string", fn), arg1.Line, arg1.Column)
+		}
+		if s == "" {
+			return nil, "", errors.NewFunctionCallError(fmt.Sprintf("%s: separator must not be empty", fn), arg1.Line, arg1.Column)
+		}
+		sep = s
+	}
+	return obj, sep, nil
+}
+
+// flattenInto writes the leaves of obj into result under prefix-joined keys.
+// Arrays and empty objects are kept as leaf values.
+func flattenInto(result map[string]interface{}, prefix string, obj map[string]interface{}, sep string) {
+	for key, val := range obj {
+		fullKey := key
+		if prefix != "" {
+			fullKey = prefix + sep + key
+		}
+		if nested, ok := types.ConvertToStringMap(val); ok && len(nested) > 0 {
+			flattenInto(result, fullKey, nested, sep)
+			continue
+		}
+		result[fullKey] = val
+	}
+}
+
+// beforeAndAfter validates the (before, after) arguments shared by
+// changedFields and diff. A null argument stands for an empty object, so
+// creations and deletions can be compared too.
+func beforeAndAfter(fn string, args []param.Arg, parenLine, parenCol int) (map[string]interface{}, map[string]interface{}, error) {
+	if len(args) != 2 {
+		if len(args) == 0 {
+			return nil, nil, errors.NewParameterError(fmt.Sprintf("%s requires 2 arguments", fn), parenLine, parenCol)
+		}
+		lastArg := args[len(args)-1]
+		return nil, nil, errors.NewParameterError(fmt.Sprintf("%s requires 2 arguments", fn), lastArg.Line, lastArg.Column)
+	}
+	objs := make([]map[string]interface{}, 2)
+	for i, arg := range args {
+		if arg.Value == nil {
+			objs[i] = map[string]interface{}{}
+			continue
+		}
+		obj, ok := types.ConvertToStringMap(arg.Value)
+		if !ok {
+			return nil, nil, errors.NewTypeError(fmt.Sprintf("%s: arguments must be objects or null", fn), arg.Line, arg.Column)
+		}
+		objs[i] = obj
+	}
+	return objs[0], objs[1], nil
+}
+
+// diffObjects calls changed, in sorted path order, for each dot-joined key
+// path whose value differs between before and after. Objects present on
+// both sides are compared key by key; any other values, including arrays,
+// are compared whole with sameValue. A key missing from one side has a null value there.
+func diffObjects(prefix string, before, after map[string]interface{}, changed func(path string, before, after interface{})) {
+	keys := make([]string, 0, len(before)+len(after))
+	for k := range before {
+		keys = append(keys, k)
+	}
+	for k := range after {
+		if _, ok := before[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+		b, inBefore := before[key]
+		a, inAfter := after[key]
+		bObj, bok := types.ConvertToStringMap(b)
+		aObj, aok := types.ConvertToStringMap(a)
+		if bok && aok {
+			diffObjects(path, bObj, aObj, changed)
+			continue
+		}
+		if inBefore != inAfter || !sameValue(b, a) {
+			changed(path, b, a)
+		}
+	}
+}
+
+// sameValue reports whether a and b are equal as by ==, and are also both
+// numbers or both not, so that 1 changing to "1" counts as a change.
+func sameValue(a, b interface{}) bool {
+	_, anum := types.ToFloat(a)
+	_, bnum := types.ToFloat(b)
+	return anum == bnum && types.Equals(a, b)
+}
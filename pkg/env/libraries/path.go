@@ -0,0 +1,90 @@
+package libraries
+
+import (
+	"fmt"
+	"github.com/SpecDrivenDesign/lql/pkg/types"
+	"strconv"
+	"strings"
+)
+
+// pathSegment is one step of a parsed path string: either an object key or
+// an array index.
+type pathSegment struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+// parsePath parses a dotted/bracketed path such as `order.items[0].sku` or
+// `meta["content-type"]`.
+func parsePath(path string) ([]pathSegment, error) {
+	var segments []pathSegment
+	i := 0
+	expectKey := true
+	for i < len(path) {
+		switch path[i] {
+		case '.':
+			if expectKey {
+				return nil, fmt.Errorf("empty segment at offset %d", i)
+			}
+			expectKey = true
+			i++
+		case '[':
+			end := strings.IndexByte(path[i:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed bracket at offset %d", i)
+			}
+			inner := strings.TrimSpace(path[i+1 : i+end])
+			if len(inner) >= 2 && (inner[0] == '"' || inner[0] == '\'') && inner[len(inner)-1] == inner[0] {
+				segments = append(segments, pathSegment{key: inner[1 : len(inner)-1]})
+			} else {
+				idx, err := strconv.Atoi(inner)
+				if err != nil || idx < 0 {
+					return nil, fmt.Errorf("invalid index '%s' at offset %d", inner, i)
+				}
+				segments = append(segments, pathSegment{index: idx, isIndex: true})
+			}
+			expectKey = false
+			i += end + 1
+		default:
+			j := i
+			for j < len(path) && path[j] != '.' && path[j] != '[' {
+				j++
+			}
+			if !expectKey {
+				return nil, fmt.Errorf("unexpected character at offset %d", i)
+			}
+			segments = append(segments, pathSegment{key: path[i:j]})
+			expectKey = false
+			i = j
+		}
+	}
+	if expectKey && len(segments) > 0 {
+		return nil, fmt.Errorf("path ends with '.'")
+	}
+	return segments, nil
+}
+
+// getPath follows segments from val, reporting whether every step resolved.
+func getPath(val interface{}, segments []pathSegment) (interface{}, bool) {
+	for _, seg := range segments {
+		if seg.isIndex {
+			arr, ok := types.ConvertToInterfaceSlice(val)
+			if !ok || seg.index >= len(arr) {
+				return nil, false
+			}
+			val = arr[seg.index]
+			continue
+		}
+		obj, ok := types.ConvertToStringMap(val)
+		if !ok {
+			return nil, false
+		}
+		v, exists := obj[seg.key]
+		if !exists {
+			return nil, false
+		}
+		val = v
+	}
+	return val, true
+}
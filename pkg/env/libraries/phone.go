@@ -0,0 +1,301 @@
+package libraries
+
+import (
+	"fmt"
+	"github.com/SpecDrivenDesign/lql/pkg/errors"
+	"github.com/SpecDrivenDesign/lql/pkg/param"
+	"strings"
+)
+
+// Number types reported by phone.parse.
+const (
+	phoneTypeMobile            = "mobile"
+	phoneTypeFixedLine         = "fixedLine"
+	phoneTypeFixedLineOrMobile = "fixedLineOrMobile"
+	phoneTypeTollFree          = "tollFree"
+	phoneTypePremiumRate       = "premiumRate"
+	phoneTypeUnknown           = "unknown"
+)
+
+// phonePrefixType maps a national number prefix to a number type.
+type phonePrefixType struct {
+	prefix   string
+	kind     string
+	minLen   int
+	maxLen   int
+	notAfter []string
+}
+
+// phoneRegion describes the numbering plan of one region.
+type phoneRegion struct {
+	countryCode int64
+	trunkPrefix string
+	// types are checked in order; the first matching prefix wins.
+	types []phonePrefixType
+	// fallback is the type of valid numbers matching no prefix in types.
+	fallback string
+	minLen   int
+	maxLen   int
+	validate func(national string) bool
+}
+
+var phoneRegions = map[string]phoneRegion{
+	"US": nanpRegion,
+	"CA": nanpRegion,
+	"GB": {
+		countryCode: 44, trunkPrefix: "0", minLen: 9, maxLen: 10,
+		types: []phonePrefixType{
+			{prefix: "7", kind: phoneTypeMobile, minLen: 10, maxLen: 10, notAfter: []string{"70", "76"}},
+			{prefix: "800", kind: phoneTypeTollFree},
+			{prefix: "808", kind: phoneTypeTollFree},
+			{prefix: "9", kind: phoneTypePremiumRate, minLen: 10, maxLen: 10},
+			{prefix: "1", kind: phoneTypeFixedLine},
+			{prefix: "2", kind: phoneTypeFixedLine, minLen: 10, maxLen: 10},
+			{prefix: "3", kind: phoneTypeFixedLine, minLen: 10, maxLen: 10},
+		},
+		fallback: phoneTypeUnknown,
+	},
+	"DE": {
+		countryCode: 49, trunkPrefix: "0", minLen: 6, maxLen: 13,
+		types: []phonePrefixType{
+			{prefix: "15", kind: phoneTypeMobile, minLen: 10, maxLen: 11},
+			{prefix: "16", kind: phoneTypeMobile, minLen: 10, maxLen: 11},
+			{prefix: "17", kind: phoneTypeMobile, minLen: 10, maxLen: 11},
+			{prefix: "800", kind: phoneTypeTollFree, minLen: 10, maxLen: 10},
+			{prefix: "900", kind: phoneTypePremiumRate, minLen: 10, maxLen: 10},
+		},
+		fallback: phoneTypeFixedLine,
+	},
+	"FR": {
+		countryCode: 33, trunkPrefix: "0", minLen: 9, maxLen: 9,
+		types: []phonePrefixType{
+			{prefix: "6", kind: phoneTypeMobile},
+			{prefix: "7", kind: phoneTypeMobile},
+			{prefix: "80", kind: phoneTypeTollFree},
+			{prefix: "89", kind: phoneTypePremiumRate},
+			{prefix: "1", kind: phoneTypeFixedLine},
+			{prefix: "2", kind: phoneTypeFixedLine},
+			{prefix: "3", kind: phoneTypeFixedLine},
+			{prefix: "4", kind: phoneTypeFixedLine},
+			{prefix: "5", kind: phoneTypeFixedLine},
+			{prefix: "9", kind: phoneTypeFixedLine},
+		},
+		fallback: phoneTypeUnknown,
+	},
+	"IN": {
+		countryCode: 91, trunkPrefix: "0", minLen: 10, maxLen: 11,
+		types: []phonePrefixType{
+			{prefix: "1800", kind: phoneTypeTollFree, minLen: 11, maxLen: 11},
+			{prefix: "6", kind: phoneTypeMobile, minLen: 10, maxLen: 10},
+			{prefix: "7", kind: phoneTypeMobile, minLen: 10, maxLen: 10},
+			{prefix: "8", kind: phoneTypeMobile, minLen: 10, maxLen: 10},
+			{prefix: "9", kind: phoneTypeMobile, minLen: 10, maxLen: 10},
+			{prefix: "1", kind: phoneTypeFixedLine, minLen: 10, maxLen: 10},
+			{prefix: "2", kind: phoneTypeFixedLine, minLen: 10, maxLen: 10},
+			{prefix: "3", kind: phoneTypeFixedLine, minLen: 10, maxLen: 10},
+			{prefix: "4", kind: phoneTypeFixedLine, minLen: 10, maxLen: 10},
+			{prefix: "5", kind: phoneTypeFixedLine, minLen: 10, maxLen: 10},
+		},
+		fallback: phoneTypeUnknown,
+	},
+	"AU": {
+		countryCode: 61, trunkPrefix: "0", minLen: 9, maxLen: 10,
+		types: []phonePrefixType{
+			{prefix: "4", kind: phoneTypeMobile, minLen: 9, maxLen: 9},
+			{prefix: "1800", kind: phoneTypeTollFree, minLen: 10, maxLen: 10},
+			{prefix: "190", kind: phoneTypePremiumRate, minLen: 10, maxLen: 10},
+			{prefix: "2", kind: phoneTypeFixedLine, minLen: 9, maxLen: 9},
+			{prefix: "3", kind: phoneTypeFixedLine, minLen: 9, maxLen: 9},
+			{prefix: "7", kind: phoneTypeFixedLine, minLen: 9, maxLen: 9},
+			{prefix: "8", kind: phoneTypeFixedLine, minLen: 9, maxLen: 9},
+		},
+		fallback: phoneTypeUnknown,
+	},
+}
+
+// nanpRegion is the North American Numbering Plan shared by US and CA, where
+// mobile and fixed-line numbers cannot be told apart by prefix.
+var nanpRegion = phoneRegion{
+	countryCode: 1, trunkPrefix: "1", minLen: 10, maxLen: 10,
+	types: []phonePrefixType{
+		{prefix: "800", kind: phoneTypeTollFree},
+		{prefix: "833", kind: phoneTypeTollFree},
+		{prefix: "844", kind: phoneTypeTollFree},
+		{prefix: "855", kind: phoneTypeTollFree},
+		{prefix: "866", kind: phoneTypeTollFree},
+		{prefix: "877", kind: phoneTypeTollFree},
+		{prefix: "888", kind: phoneTypeTollFree},
+		{prefix: "900", kind: phoneTypePremiumRate},
+	},
+	fallback: phoneTypeFixedLineOrMobile,
+	validate: func(national string) bool {
+		// Area code and exchange code must not start with 0 or 1.
+		return national[0] >= '2' && national[3] >= '2'
+	},
+}
+
+// regionForCountryCode returns the numbering plan for a calling code.
+func regionForCountryCode(code int64) (phoneRegion, bool) {
+	if code == nanpRegion.countryCode {
+		return nanpRegion, true
+	}
+	for _, region := range phoneRegions {
+		if region.countryCode == code {
+			return region, true
+		}
+	}
+	return phoneRegion{}, false
+}
+
+// PhoneLib implements phone number parsing functions.
+type PhoneLib struct{}
+
+func NewPhoneLib() *PhoneLib {
+	return &PhoneLib{}
+}
+
+// Functions describes the phone functions.
+func (p *PhoneLib) Functions() []param.Function {
+	return []param.Function{
+		{Name: "parse", Params: []param.Param{{Name: "number", Type: param.TypeString}, {Name: "region", Type: param.TypeString, Optional: true}}, Result: param.TypeObject, Doc: "Parses a phone number, read in region unless international."},
+	}
+}
+
+func (p *PhoneLib) Call(functionName string, args []param.Arg, line, col, parenLine, parenCol int) (interface{}, error) {
+	switch functionName {
+	case "parse":
+		if len(args) < 1 || len(args) > 2 {
+			if len(args) == 0 {
+				return nil, errors.NewParameterError("phone.parse requires 1 or 2 arguments", parenLine, parenCol)
+			}
+			lastArg := args[len(args)-1]
+			return nil, errors.NewParameterError("phone.parse requires 1 or 2 arguments", lastArg.Line, lastArg.Column)
+		}
+		arg0 := args[0]
+		number, ok := arg0.Value.(string)
+		if !ok {
+			return nil, errors.NewTypeError("phone.parse: number must be a string", arg0.Line, arg0.Column)
+		}
+		var defaultRegion *phoneRegion
+		if len(args) == 2 {
+			arg1 := args[1]
+			code, ok := arg1.Value.(string)
+			if !ok {
+				return nil, errors.NewTypeError("phone.parse: region must be a string", arg1.Line, arg1.Column)
+			}
+			region, ok := phoneRegions[strings.ToUpper(code)]
+			if !ok {
+				return nil, errors.NewFunctionCallError(fmt.Sprintf("phone.parse: unsupported region '%s'", code), arg1.Line, arg1.Column)
+			}
+			defaultRegion = &region
+		}
+		return parsePhone(number, defaultRegion), nil
+
+	default:
+		return nil, errors.NewFunctionCallError(fmt.Sprintf("unknown phone function '%s'", functionName), 0, 0)
+	}
+}
+
+// parsePhone splits number into its calling code and national number and
+// classifies it. Numbers starting with '+' or "00" are international;
+// others are read in defaultRegion. Unparseable numbers yield valid=false
+// rather than an error.
+func parsePhone(number string, defaultRegion *phoneRegion) map[string]interface{} {
+	result := map[string]interface{}{
+		"countryCode": nil,
+		"national":    "",
+		"valid":       false,
+		"type":        phoneTypeUnknown,
+	}
+
+	trimmed := strings.TrimSpace(number)
+	international := strings.HasPrefix(trimmed, "+")
+	if international {
+		trimmed = trimmed[1:]
+	}
+	var digits strings.Builder
+	for i := 0; i < len(trimmed); i++ {
+		ch := trimmed[i]
+		switch {
+		case isDecimalDigit(ch):
+			digits.WriteByte(ch)
+		case ch == ' ' || ch == '-' || ch == '.' || ch == '(' || ch == ')':
+		default:
+			return result
+		}
+	}
+	national := digits.String()
+	if !international && strings.HasPrefix(national, "00") {
+		international = true
+		national = national[2:]
+	}
+	if national == "" {
+		return result
+	}
+
+	var region phoneRegion
+	if international {
+		found := false
+		for n := 1; n <= 3 && n < len(national); n++ {
+			code := int64(0)
+			for _, ch := range national[:n] {
+				code = code*10 + int64(ch-'0')
+			}
+			if r, ok := regionForCountryCode(code); ok {
+				region, found = r, true
+				national = national[n:]
+				break
+			}
+		}
+		if !found {
+			result["national"] = national
+			return result
+		}
+	} else {
+		if defaultRegion == nil {
+			result["national"] = national
+			return result
+		}
+		region = *defaultRegion
+	}
+	// Drop the trunk prefix, also tolerating it after the calling code as in
+	// "+44 (0)20 7946 0000".
+	if strings.HasPrefix(national, region.trunkPrefix) && len(national)-len(region.trunkPrefix) >= region.minLen {
+		national = national[len(region.trunkPrefix):]
+	}
+
+	result["countryCode"] = region.countryCode
+	result["national"] = national
+	if len(national) < region.minLen || len(national) > region.maxLen {
+		return result
+	}
+	if region.validate != nil && !region.validate(national) {
+		return result
+	}
+	kind := region.fallback
+	for _, t := range region.types {
+		if !strings.HasPrefix(national, t.prefix) || hasAnyPrefix(national, t.notAfter) {
+			continue
+		}
+		if (t.minLen > 0 && len(national) < t.minLen) || (t.maxLen > 0 && len(national) > t.maxLen) {
+			return result
+		}
+		kind = t.kind
+		break
+	}
+	if kind == phoneTypeUnknown {
+		return result
+	}
+	result["valid"] = true
+	result["type"] = kind
+	return result
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,176 @@
+package libraries
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"github.com/SpecDrivenDesign/lql/pkg/errors"
+	"github.com/SpecDrivenDesign/lql/pkg/param"
+	"github.com/SpecDrivenDesign/lql/pkg/types"
+	mathrand "math/rand"
+	"sync"
+)
+
+// maxTokenBytes bounds the size of a random.token.
+const maxTokenBytes = 1024
+
+// RandomLib generates random values. It reads crypto/rand unless it has been
+// seeded, in which case it draws from a deterministic generator so that runs
+// with the same seed produce the same values, for reproducible tests and
+// replays.
+type RandomLib struct {
+	mu  sync.Mutex
+	rng *mathrand.Rand
+}
+
+func NewRandomLib() *RandomLib {
+	return &RandomLib{}
+}
+
+// Functions describes the random functions.
+func (r *RandomLib) Functions() []param.Function {
+	return []param.Function{
+		{Name: "token", Params: []param.Param{{Name: "bytes", Type: param.TypeNumeric}, {Name: "encoding", Type: param.TypeString, Optional: true}}, Result: param.TypeString, Doc: "Returns a random token of bytes bytes."},
+		{Name: "weightedChoice", Params: []param.Param{{Name: "options", Type: param.TypeArray}, {Name: "seedKey", Type: param.TypeAny}}, Result: param.TypeAny, Doc: "Picks the value of an option with probability proportional to its weight."},
+	}
+}
+
+// Seed switches the library to a deterministic generator seeded with seed.
+func (r *RandomLib) Seed(seed int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rng = mathrand.New(mathrand.NewSource(seed))
+}
+
+func (r *RandomLib) read(b []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.rng != nil {
+		_, err := r.rng.Read(b)
+		return err
+	}
+	_, err := rand.Read(b)
+	return err
+}
+
+func (r *RandomLib) Call(functionName string, args []param.Arg, line, col, parenLine, parenCol int) (interface{}, error) {
+	switch functionName {
+	case "token":
+		if len(args) < 1 || len(args) > 2 {
+			if len(args) == 0 {
+				return nil, errors.NewParameterError("random.token requires 1 or 2 arguments", parenLine, parenCol)
+			}
+			lastArg := args[len(args)-1]
+			return nil, errors.NewParameterError("random.token requires 1 or 2 arguments", lastArg.Line, lastArg.Column)
+		}
+		arg0 := args[0]
+		if !types.IsInt(arg0.Value) {
+			return nil, errors.NewTypeError("random.token: length must be an integer", arg0.Line, arg0.Column)
+		}
+		n, _ := types.ToInt(arg0.Value)
+		if n < 1 || n > maxTokenBytes {
+			return nil, errors.NewFunctionCallError(fmt.Sprintf("random.token: length must be between 1 and %d", maxTokenBytes), arg0.Line, arg0.Column)
+		}
+		encoding := "hex"
+		if len(args) == 2 {
+			s, ok := args[1].Value.(string)
+			if !ok {
+				return nil, errors.NewTypeError("random.token: encoding must be a string", args[1].Line, args[1].Column)
+			}
+			encoding = s
+		}
+		buf := make([]byte, n)
+		switch encoding {
+		case "hex":
+			if err := r.read(buf); err != nil {
+				return nil, errors.NewFunctionCallError(fmt.Sprintf("random.token: %v", err), line, col)
+			}
+			return hex.EncodeToString(buf), nil
+		case "base32":
+			if err := r.read(buf); err != nil {
+				return nil, errors.NewFunctionCallError(fmt.Sprintf("random.token: %v", err), line, col)
+			}
+			return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(buf), nil
+		default:
+			return nil, errors.NewFunctionCallError(fmt.Sprintf("random.token: unknown encoding '%s'; expected hex or base32", encoding), args[1].Line, args[1].Column)
+		}
+
+	case "weightedChoice":
+		if len(args) != 2 {
+			if len(args) == 0 {
+				return nil, errors.NewParameterError("random.weightedChoice requires 2 arguments", parenLine, parenCol)
+			}
+			lastArg := args[len(args)-1]
+			return nil, errors.NewParameterError("random.weightedChoice requires 2 arguments", lastArg.Line, lastArg.Column)
+		}
+		return weightedChoice(args[0], args[1])
+
+	default:
+		return nil, errors.NewFunctionCallError(fmt.Sprintf("unknown random function '%s'", functionName), 0, 0)
+	}
+}
+
+// weightedChoice picks the value of one of options, objects with a value
+// and a numeric weight, with probability proportional to its weight. The
+// pick is a function of the seed key alone, so the same key always lands on
+// the same option, while keys spread across options by weight. It does not
+// read the library's generator and is unaffected by Seed.
+func weightedChoice(optionsArg, keyArg param.Arg) (interface{}, error) {
+	options, ok := types.ConvertToInterfaceSlice(optionsArg.Value)
+	if !ok {
+		return nil, errors.NewTypeError("random.weightedChoice: options must be an array of objects", optionsArg.Line, optionsArg.Column)
+	}
+	var key string
+	switch k := keyArg.Value.(type) {
+	case string:
+		key = k
+	case int, int64:
+		key = fmt.Sprintf("%d", k)
+	default:
+		return nil, errors.NewTypeError("random.weightedChoice: seed key must be a string or an integer", keyArg.Line, keyArg.Column)
+	}
+
+	values := make([]interface{}, len(options))
+	weights := make([]float64, len(options))
+	total := 0.0
+	for i, option := range options {
+		obj, ok := types.ConvertToStringMap(option)
+		if !ok {
+			return nil, errors.NewTypeError("random.weightedChoice: options must be an array of objects", optionsArg.Line, optionsArg.Column)
+		}
+		value, ok := obj["value"]
+		if !ok {
+			return nil, errors.NewFunctionCallError(fmt.Sprintf("random.weightedChoice: option %d is missing a value", i), optionsArg.Line, optionsArg.Column)
+		}
+		weight, ok := types.ToFloat(obj["weight"])
+		if !ok || weight < 0 {
+			return nil, errors.NewTypeError(fmt.Sprintf("random.weightedChoice: weight of option %d must be a non-negative number", i), optionsArg.Line, optionsArg.Column)
+		}
+		values[i] = value
+		weights[i] = weight
+		total += weight
+	}
+	if total <= 0 {
+		return nil, errors.NewFunctionCallError("random.weightedChoice: total weight must be positive", optionsArg.Line, optionsArg.Column)
+	}
+
+	// The top 53 bits of the key's digest give a uniform point in [0, 1).
+	sum := sha256.Sum256([]byte(key))
+	point := float64(binary.BigEndian.Uint64(sum[:8])>>11) / (1 << 53) * total
+	for i, weight := range weights {
+		if point < weight {
+			return values[i], nil
+		}
+		point -= weight
+	}
+	// Rounding can leave point just past the end; use the last option
+	// with any weight.
+	for i := len(weights) - 1; ; i-- {
+		if weights[i] > 0 {
+			return values[i], nil
+		}
+	}
+}
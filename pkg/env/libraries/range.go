@@ -0,0 +1,144 @@
+package libraries
+
+import (
+	"fmt"
+	"github.com/SpecDrivenDesign/lql/pkg/errors"
+	"github.com/SpecDrivenDesign/lql/pkg/param"
+	"github.com/SpecDrivenDesign/lql/pkg/types"
+	"sort"
+)
+
+// RangeLib implements operations on closed intervals written as two-element
+// arrays [start, end] of numbers or Times.
+type RangeLib struct{}
+
+func NewRangeLib() *RangeLib {
+	return &RangeLib{}
+}
+
+// Functions describes the range functions.
+func (r *RangeLib) Functions() []param.Function {
+	return []param.Function{
+		{Name: "overlaps", Params: []param.Param{{Name: "a", Type: param.TypeArray}, {Name: "b", Type: param.TypeArray}}, Result: param.TypeBoolean, Doc: "Reports whether two ranges overlap."},
+		{Name: "contains", Params: []param.Param{{Name: "r", Type: param.TypeArray}, {Name: "x", Type: param.TypeAny}}, Result: param.TypeBoolean, Doc: "Reports whether range r contains x."},
+		{Name: "merge", Params: []param.Param{{Name: "ranges", Type: param.TypeArray}}, Result: param.TypeArray, Doc: "Merges overlapping ranges."},
+	}
+}
+
+// bound is one end of a range with the key it is ordered by.
+type bound struct {
+	value interface{}
+	key   float64
+	time  bool
+}
+
+// interval is a validated [start, end] range.
+type interval struct {
+	start, end bound
+}
+
+func (r *RangeLib) Call(functionName string, args []param.Arg, line, col, _, _ int) (interface{}, error) {
+	switch functionName {
+	case "overlaps":
+		if len(args) != 2 {
+			return nil, errors.NewParameterError("range.overlaps requires 2 arguments", line, col)
+		}
+		a, err := rangeArg("range.overlaps", args[0].Value, args[0])
+		if err != nil {
+			return nil, err
+		}
+		b, err := rangeArg("range.overlaps", args[1].Value, args[1])
+		if err != nil {
+			return nil, err
+		}
+		if a.start.time != b.start.time {
+			return nil, errors.NewTypeError("range.overlaps: ranges must both be numeric or both be Time", args[1].Line, args[1].Column)
+		}
+		return a.start.key <= b.end.key && b.start.key <= a.end.key, nil
+
+	case "contains":
+		if len(args) != 2 {
+			return nil, errors.NewParameterError("range.contains requires 2 arguments", line, col)
+		}
+		rg, err := rangeArg("range.contains", args[0].Value, args[0])
+		if err != nil {
+			return nil, err
+		}
+		arg1 := args[1]
+		x, ok := rangeBound(arg1.Value)
+		if !ok || x.time != rg.start.time {
+			return nil, errors.NewTypeError("range.contains: value must have the same type as the range bounds", arg1.Line, arg1.Column)
+		}
+		return rg.start.key <= x.key && x.key <= rg.end.key, nil
+
+	case "merge":
+		if len(args) != 1 {
+			return nil, errors.NewParameterError("range.merge requires 1 argument", line, col)
+		}
+		arg0 := args[0]
+		list, ok := types.ConvertToInterfaceSlice(arg0.Value)
+		if !ok {
+			return nil, errors.NewTypeError("range.merge: argument must be an array of ranges", arg0.Line, arg0.Column)
+		}
+		ranges := make([]interval, len(list))
+		for i, elem := range list {
+			rg, err := rangeArg("range.merge", elem, arg0)
+			if err != nil {
+				return nil, err
+			}
+			if i > 0 && rg.start.time != ranges[0].start.time {
+				return nil, errors.NewTypeError("range.merge: ranges must all be numeric or all be Time", arg0.Line, arg0.Column)
+			}
+			ranges[i] = rg
+		}
+		sort.SliceStable(ranges, func(i, j int) bool {
+			return ranges[i].start.key < ranges[j].start.key
+		})
+		var merged []interval
+		for _, rg := range ranges {
+			if n := len(merged); n > 0 && rg.start.key <= merged[n-1].end.key {
+				if rg.end.key > merged[n-1].end.key {
+					merged[n-1].end = rg.end
+				}
+				continue
+			}
+			merged = append(merged, rg)
+		}
+		result := make([]interface{}, len(merged))
+		for i, rg := range merged {
+			result[i] = []interface{}{rg.start.value, rg.end.value}
+		}
+		return result, nil
+
+	default:
+		return nil, errors.NewFunctionCallError(fmt.Sprintf("unknown range function '%s'", functionName), 0, 0)
+	}
+}
+
+// rangeArg validates a [start, end] range. Both bounds must be numbers or
+// both Times, and start must not be after end.
+func rangeArg(fn string, v interface{}, arg param.Arg) (interval, error) {
+	pair, ok := types.ConvertToInterfaceSlice(v)
+	if !ok || len(pair) != 2 {
+		return interval{}, errors.NewTypeError(fmt.Sprintf("%s: a range must be a two-element array [start, end]", fn), arg.Line, arg.Column)
+	}
+	start, okStart := rangeBound(pair[0])
+	end, okEnd := rangeBound(pair[1])
+	if !okStart || !okEnd || start.time != end.time {
+		return interval{}, errors.NewTypeError(fmt.Sprintf("%s: range bounds must both be numeric or both be Time", fn), arg.Line, arg.Column)
+	}
+	if start.key > end.key {
+		return interval{}, errors.NewFunctionCallError(fmt.Sprintf("%s: range start is after its end", fn), arg.Line, arg.Column)
+	}
+	return interval{start: start, end: end}, nil
+}
+
+func rangeBound(v interface{}) (bound, bool) {
+	if tv, ok := v.(TimeValue); ok {
+		return bound{value: v, key: float64(tv.EpochMillis), time: true}, true
+	}
+	if f, ok := types.ToFloat(v); ok {
+		return bound{value: v, key: f}, true
+	}
+	return bound{}, false
+}
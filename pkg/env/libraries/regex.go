@@ -5,17 +5,58 @@ import (
 	"github.com/SpecDrivenDesign/lql/pkg/param"
 	"github.com/SpecDrivenDesign/lql/pkg/types"
 	"regexp"
+	"sync"
 
 	"github.com/SpecDrivenDesign/lql/pkg/errors"
 )
 
+const regexCacheLimit = 1024
+
+var (
+	regexCacheMu sync.Mutex
+	regexCache   = make(map[string]*regexp.Regexp)
+)
+
+// CompileCachedRegex compiles a pattern, reusing previously compiled patterns,
+// and reports whether it was compiled rather than found in the cache.
+// The cache is cleared once it grows past a fixed limit.
+func CompileCachedRegex(pattern string) (*regexp.Regexp, bool, error) {
+	regexCacheMu.Lock()
+	defer regexCacheMu.Unlock()
+	if re, ok := regexCache[pattern]; ok {
+		return re, false, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, true, err
+	}
+	if len(regexCache) >= regexCacheLimit {
+		regexCache = make(map[string]*regexp.Regexp)
+	}
+	regexCache[pattern] = re
+	return re, true, nil
+}
+
 // RegexLib implements regex functions.
-type RegexLib struct{}
+type RegexLib struct {
+	// Compiled, when set, is called each time a function compiles a
+	// pattern that is not cached; see Environment.MeteredLibrary.
+	Compiled func()
+}
 
 func NewRegexLib() *RegexLib {
 	return &RegexLib{}
 }
 
+// Functions describes the regex functions.
+func (r *RegexLib) Functions() []param.Function {
+	return []param.Function{
+		{Name: "match", Params: []param.Param{{Name: "pattern", Type: param.TypeString}, {Name: "s", Type: param.TypeString}}, Result: param.TypeBoolean, Doc: "Reports whether pattern matches part of s."},
+		{Name: "replace", Params: []param.Param{{Name: "s", Type: param.TypeString}, {Name: "pattern", Type: param.TypeString}, {Name: "replacement", Type: param.TypeString}, {Name: "limit", Type: param.TypeNumeric, Optional: true}}, Result: param.TypeString, Doc: "Replaces matches of pattern, at most limit of them if given."},
+		{Name: "find", Params: []param.Param{{Name: "pattern", Type: param.TypeString}, {Name: "s", Type: param.TypeString}}, Result: param.TypeString, Doc: "Returns the first match of pattern in s, or an empty string."},
+	}
+}
+
 func (r *RegexLib) Call(functionName string, args []param.Arg, line, col, parenLine, parenCol int) (interface{}, error) {
 	switch functionName {
 	case "match":
@@ -32,7 +73,7 @@ func (r *RegexLib) Call(functionName string, args []param.Arg, line, col, parenL
 		if !ok {
 			return nil, errors.NewTypeError("regex.match: second argument must be a string", arg1.Line, arg1.Column)
 		}
-		re, err := regexp.Compile(pattern)
+		re, err := r.compile(pattern)
 		if err != nil {
 			return nil, errors.NewTypeError("regex.match: invalid pattern", arg0.Line, arg0.Column)
 		}
@@ -61,7 +102,7 @@ func (r *RegexLib) Call(functionName string, args []param.Arg, line, col, parenL
 		if !ok {
 			return nil, errors.NewTypeError("regex.replace: third argument must be a string", arg2.Line, arg2.Column)
 		}
-		re, err := regexp.Compile(pattern)
+		re, err := r.compile(pattern)
 		if err != nil {
 			return nil, errors.NewTypeError("regex.replace: invalid pattern", arg1.Line, arg1.Column)
 		}
@@ -99,7 +140,7 @@ func (r *RegexLib) Call(functionName string, args []param.Arg, line, col, parenL
 		if !ok {
 			return nil, errors.NewTypeError("regex.find: second argument must be a string", arg1.Line, arg1.Column)
 		}
-		re, err := regexp.Compile(pattern)
+		re, err := r.compile(pattern)
 		if err != nil {
 			return nil, errors.NewTypeError("regex.find: invalid pattern", arg0.Line, arg0.Column)
 		}
@@ -113,3 +154,12 @@ func (r *RegexLib) Call(functionName string, args []param.Arg, line, col, parenL
 		return nil, errors.NewFunctionCallError(fmt.Sprintf("unknown regex function '%s'", functionName), 0, 0)
 	}
 }
+
+// compile compiles pattern through the regex cache.
+func (r *RegexLib) compile(pattern string) (*regexp.Regexp, error) {
+	re, compiled, err := CompileCachedRegex(pattern)
+	if compiled && r.Compiled != nil {
+		r.Compiled()
+	}
+	return re, err
+}
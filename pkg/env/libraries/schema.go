@@ -0,0 +1,141 @@
+package libraries
+
+import (
+	"fmt"
+	"github.com/SpecDrivenDesign/lql/pkg/types"
+	"sort"
+	"strings"
+)
+
+// checkSchema validates value against a lightweight schema, appending a
+// message to problems for every mismatch. A schema is a type name string
+// ("string", "int", "float", "number", "bool", "null", "array", "object",
+// "any", optionally suffixed with "?" to also allow null or absence), an
+// object mapping field names to schemas, or a one-element array giving the
+// schema of every element. It returns an error only if the schema itself is
+// invalid.
+func checkSchema(value, schema interface{}, path string, problems *[]string) error {
+	if name, ok := schema.(string); ok {
+		optional := strings.HasSuffix(name, "?")
+		name = strings.TrimSuffix(name, "?")
+		if optional && value == nil {
+			return nil
+		}
+		matched, known := matchesTypeName(value, name)
+		if !known {
+			return fmt.Errorf("unknown type '%s' at %s", name, path)
+		}
+		if !matched {
+			*problems = append(*problems, fmt.Sprintf("%s: expected %s, got %s", path, name, TypeNameOf(value)))
+		}
+		return nil
+	}
+	if fields, ok := types.ConvertToStringMap(schema); ok {
+		obj, ok := types.ConvertToStringMap(value)
+		if !ok {
+			*problems = append(*problems, fmt.Sprintf("%s: expected object, got %s", path, TypeNameOf(value)))
+			return nil
+		}
+		keys := make([]string, 0, len(fields))
+		for k := range fields {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fieldSchema := fields[key]
+			fieldVal, exists := obj[key]
+			if !exists {
+				if s, ok := fieldSchema.(string); ok && strings.HasSuffix(s, "?") {
+					continue
+				}
+				*problems = append(*problems, fmt.Sprintf("%s.%s: missing required field", path, key))
+				continue
+			}
+			if err := checkSchema(fieldVal, fieldSchema, path+"."+key, problems); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if elemSchemas, ok := types.ConvertToInterfaceSlice(schema); ok {
+		if len(elemSchemas) > 1 {
+			return fmt.Errorf("array schema at %s must have at most one element", path)
+		}
+		arr, ok := types.ConvertToInterfaceSlice(value)
+		if !ok {
+			*problems = append(*problems, fmt.Sprintf("%s: expected array, got %s", path, TypeNameOf(value)))
+			return nil
+		}
+		if len(elemSchemas) == 0 {
+			return nil
+		}
+		for i, elem := range arr {
+			if err := checkSchema(elem, elemSchemas[0], fmt.Sprintf("%s[%d]", path, i), problems); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("invalid schema at %s", path)
+}
+
+// matchesTypeName reports whether value has the named type, and whether the
+// name is known at all.
+func matchesTypeName(value interface{}, name string) (bool, bool) {
+	switch name {
+	case "any":
+		return true, true
+	case "string":
+		_, ok := value.(string)
+		return ok, true
+	case "int":
+		return types.IsInt(value), true
+	case "float":
+		_, ok := value.(float64)
+		return ok || types.IsDecimal(value), true
+	case "number":
+		_, ok := types.ToFloat(value)
+		return ok, true
+	case "bool", "boolean":
+		_, ok := value.(bool)
+		return ok, true
+	case "null":
+		return value == nil, true
+	case "array":
+		_, ok := types.ConvertToInterfaceSlice(value)
+		return ok, true
+	case "object":
+		_, ok := types.ConvertToStringMap(value)
+		return ok, true
+	}
+	return false, false
+}
+
+// TypeNameOf names the type of value as the language does, for mismatch
+// messages.
+func TypeNameOf(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case TimeValue:
+		return "time"
+	case string:
+		return "string"
+	case bool:
+		return "bool"
+	case float64, float32:
+		return "float"
+	case types.Decimal:
+		return "decimal"
+	}
+	if types.IsInt(value) {
+		return "int"
+	}
+	if _, ok := types.ConvertToInterfaceSlice(value); ok {
+		return "array"
+	}
+	if _, ok := types.ConvertToStringMap(value); ok {
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
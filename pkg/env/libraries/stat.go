@@ -0,0 +1,144 @@
+package libraries
+
+import (
+	"fmt"
+	"github.com/SpecDrivenDesign/lql/pkg/errors"
+	"github.com/SpecDrivenDesign/lql/pkg/param"
+	"github.com/SpecDrivenDesign/lql/pkg/types"
+	"math"
+)
+
+// defaultOutlierThreshold is the z-score beyond which stat.isOutlier flags a
+// value when no threshold is given.
+const defaultOutlierThreshold = 3.0
+
+// StatLib implements statistical library functions.
+type StatLib struct{}
+
+func NewStatLib() *StatLib {
+	return &StatLib{}
+}
+
+// Functions describes the stat functions.
+func (s *StatLib) Functions() []param.Function {
+	return []param.Function{
+		{Name: "zscore", Params: []param.Param{{Name: "value", Type: param.TypeNumeric}, {Name: "arr", Type: param.TypeArray}}, Result: param.TypeNumeric, Doc: "Returns how many standard deviations value is from the mean of arr."},
+		{Name: "isOutlier", Params: []param.Param{{Name: "value", Type: param.TypeNumeric}, {Name: "arr", Type: param.TypeArray}, {Name: "k", Type: param.TypeNumeric, Optional: true}}, Result: param.TypeBoolean, Doc: "Reports whether the z-score of value exceeds k, 3 by default."},
+		{Name: "movingAvg", Params: []param.Param{{Name: "arr", Type: param.TypeArray}, {Name: "window", Type: param.TypeNumeric}}, Result: param.TypeArray, Doc: "Averages each run of window consecutive elements."},
+	}
+}
+
+func (s *StatLib) Call(functionName string, args []param.Arg, line, col, parenLine, parenCol int) (interface{}, error) {
+	switch functionName {
+	case "zscore":
+		if len(args) != 2 {
+			return nil, errors.NewParameterError("stat.zscore requires 2 arguments", line, col)
+		}
+		return zscoreArgs("stat.zscore", args[0], args[1])
+
+	case "isOutlier":
+		if len(args) < 2 || len(args) > 3 {
+			if len(args) == 0 {
+				return nil, errors.NewParameterError("stat.isOutlier requires 2 or 3 arguments", parenLine, parenCol)
+			}
+			lastArg := args[len(args)-1]
+			return nil, errors.NewParameterError("stat.isOutlier requires 2 or 3 arguments", lastArg.Line, lastArg.Column)
+		}
+		z, err := zscoreArgs("stat.isOutlier", args[0], args[1])
+		if err != nil {
+			return nil, err
+		}
+		k := defaultOutlierThreshold
+		if len(args) == 3 {
+			arg2 := args[2]
+			kv, ok := types.ToFloat(arg2.Value)
+			if !ok {
+				return nil, errors.NewTypeError("stat.isOutlier: threshold must be numeric", arg2.Line, arg2.Column)
+			}
+			if kv <= 0 {
+				return nil, errors.NewFunctionCallError("stat.isOutlier: threshold must be positive", arg2.Line, arg2.Column)
+			}
+			k = kv
+		}
+		return math.Abs(z) > k, nil
+
+	case "movingAvg":
+		if len(args) != 2 {
+			return nil, errors.NewParameterError("stat.movingAvg requires 2 arguments", line, col)
+		}
+		nums, err := numericArray("stat.movingAvg", args[0])
+		if err != nil {
+			return nil, err
+		}
+		arg1 := args[1]
+		if !types.IsInt(arg1.Value) {
+			return nil, errors.NewTypeError("stat.movingAvg: window must be an integer", arg1.Line, arg1.Column)
+		}
+		window, _ := types.ToInt(arg1.Value)
+		if window < 1 || window > int64(len(nums)) {
+			return nil, errors.NewFunctionCallError(fmt.Sprintf("stat.movingAvg: window must be between 1 and %d", len(nums)), arg1.Line, arg1.Column)
+		}
+		result := make([]interface{}, 0, len(nums)-int(window)+1)
+		sum := 0.0
+		for i, n := range nums {
+			sum += n
+			if i >= int(window) {
+				sum -= nums[i-int(window)]
+			}
+			if i >= int(window)-1 {
+				result = append(result, sum/float64(window))
+			}
+		}
+		return result, nil
+
+	default:
+		return nil, errors.NewFunctionCallError(fmt.Sprintf("unknown stat function '%s'", functionName), 0, 0)
+	}
+}
+
+// zscoreArgs computes the z-score of value against the population mean and
+// standard deviation of arr. A zero standard deviation yields 0.
+func zscoreArgs(fn string, valueArg, arrArg param.Arg) (float64, error) {
+	value, ok := types.ToFloat(valueArg.Value)
+	if !ok {
+		return 0, errors.NewTypeError(fmt.Sprintf("%s: first argument must be numeric", fn), valueArg.Line, valueArg.Column)
+	}
+	nums, err := numericArray(fn, arrArg)
+	if err != nil {
+		return 0, err
+	}
+	if len(nums) == 0 {
+		return 0, errors.NewFunctionCallError(fmt.Sprintf("%s: array is empty", fn), arrArg.Line, arrArg.Column)
+	}
+	mean := 0.0
+	for _, n := range nums {
+		mean += n
+	}
+	mean /= float64(len(nums))
+	variance := 0.0
+	for _, n := range nums {
+		variance += (n - mean) * (n - mean)
+	}
+	stddev := math.Sqrt(variance / float64(len(nums)))
+	if stddev == 0 {
+		return 0, nil
+	}
+	return (value - mean) / stddev, nil
+}
+
+// numericArray converts an array argument of numbers to float64s.
+func numericArray(fn string, arg param.Arg) ([]float64, error) {
+	arr, ok := types.ConvertToInterfaceSlice(arg.Value)
+	if !ok {
+		return nil, errors.NewTypeError(fmt.Sprintf("%s: array argument required", fn), arg.Line, arg.Column)
+	}
+	nums := make([]float64, len(arr))
+	for i, elem := range arr {
+		n, ok := types.ToFloat(elem)
+		if !ok {
+			return nil, errors.NewTypeError(fmt.Sprintf("%s: element is not numeric", fn), arg.Line, arg.Column)
+		}
+		nums[i] = n
+	}
+	return nums, nil
+}
@@ -1,14 +1,28 @@
 package libraries
 
 import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/csv"
 	"fmt"
 	"github.com/SpecDrivenDesign/lql/pkg/param"
 	"github.com/SpecDrivenDesign/lql/pkg/types"
+	"html"
+	"io"
+	"regexp"
 	"strings"
 
 	"github.com/SpecDrivenDesign/lql/pkg/errors"
 )
 
+// htmlRawTextPattern matches script and style elements, whose content is
+// not text, and comments.
+var htmlRawTextPattern = regexp.MustCompile(`(?is)<script\b.*?</script\s*>|<style\b.*?</style\s*>|<!--.*?-->`)
+
+// htmlTagPattern matches start and end tags, doctypes and XML processing
+// instructions. A '<' not followed by a name is left as text.
+var htmlTagPattern = regexp.MustCompile(`<[!?/]?[a-zA-Z][^>]*>`)
+
 // StringLib implements string manipulation functions.
 type StringLib struct{}
 
@@ -16,6 +30,35 @@ func NewStringLib() *StringLib {
 	return &StringLib{}
 }
 
+// Functions describes the string functions.
+func (s *StringLib) Functions() []param.Function {
+	return []param.Function{
+		{Name: "concat", Params: []param.Param{{Name: "values", Type: param.TypeString, Variadic: true}}, Result: param.TypeString, Doc: "Concatenates its arguments."},
+		{Name: "toLower", Params: []param.Param{{Name: "s", Type: param.TypeString}}, Result: param.TypeString, Doc: "Converts s to lower case."},
+		{Name: "toUpper", Params: []param.Param{{Name: "s", Type: param.TypeString}}, Result: param.TypeString, Doc: "Converts s to upper case."},
+		{Name: "trim", Params: []param.Param{{Name: "s", Type: param.TypeString}}, Result: param.TypeString, Doc: "Removes leading and trailing whitespace."},
+		{Name: "startsWith", Params: []param.Param{{Name: "s", Type: param.TypeString}, {Name: "prefix", Type: param.TypeString}}, Result: param.TypeBoolean, Doc: "Reports whether s starts with prefix."},
+		{Name: "endsWith", Params: []param.Param{{Name: "s", Type: param.TypeString}, {Name: "suffix", Type: param.TypeString}}, Result: param.TypeBoolean, Doc: "Reports whether s ends with suffix."},
+		{Name: "contains", Params: []param.Param{{Name: "s", Type: param.TypeString}, {Name: "substring", Type: param.TypeString}}, Result: param.TypeBoolean, Doc: "Reports whether s contains substring."},
+		{Name: "secureEquals", Params: []param.Param{{Name: "a", Type: param.TypeString}, {Name: "b", Type: param.TypeString}}, Result: param.TypeBoolean, Doc: "Compares a and b in constant time."},
+		{Name: "split", Params: []param.Param{{Name: "s", Type: param.TypeString}, {Name: "delim", Type: param.TypeString}}, Result: param.TypeArray, Doc: "Splits s around each delim."},
+		{Name: "join", Params: []param.Param{{Name: "arr", Type: param.TypeArray}, {Name: "sep", Type: param.TypeString}}, Result: param.TypeString, Doc: "Joins an array of strings with sep."},
+		{Name: "substring", Params: []param.Param{{Name: "s", Type: param.TypeString}, {Name: "start", Type: param.TypeNumeric}, {Name: "length", Type: param.TypeNumeric}}, Result: param.TypeString, Doc: "Returns length characters of s from start."},
+		{Name: "replace", Params: []param.Param{{Name: "s", Type: param.TypeString}, {Name: "old", Type: param.TypeString}, {Name: "new", Type: param.TypeString}, {Name: "limit", Type: param.TypeNumeric, Optional: true}}, Result: param.TypeString, Doc: "Replaces occurrences of old with new, at most limit of them if given."},
+		{Name: "indexOf", Params: []param.Param{{Name: "s", Type: param.TypeString}, {Name: "sub", Type: param.TypeString}, {Name: "fromIndex", Type: param.TypeNumeric, Optional: true}}, Result: param.TypeNumeric, Doc: "Returns the index of the first sub in s at or after fromIndex, or -1."},
+		{Name: "mask", Params: []param.Param{{Name: "s", Type: param.TypeString}, {Name: "visible", Type: param.TypeNumeric}, {Name: "maskChar", Type: param.TypeString, Optional: true}}, Result: param.TypeString, Doc: "Masks all but the last visible characters of s."},
+		{Name: "redactEmail", Params: []param.Param{{Name: "s", Type: param.TypeString}}, Result: param.TypeString, Doc: "Masks the local part of an email address."},
+		{Name: "last4", Params: []param.Param{{Name: "s", Type: param.TypeString}}, Result: param.TypeString, Doc: "Returns the last four characters of s."},
+		{Name: "escapeHtml", Params: []param.Param{{Name: "s", Type: param.TypeString}}, Result: param.TypeString, Doc: "Escapes HTML special characters."},
+		{Name: "unescapeHtml", Params: []param.Param{{Name: "s", Type: param.TypeString}}, Result: param.TypeString, Doc: "Decodes HTML entities."},
+		{Name: "stripTags", Params: []param.Param{{Name: "s", Type: param.TypeString}}, Result: param.TypeString, Doc: "Removes HTML tags, keeping the text."},
+		{Name: "parseCsvLine", Params: []param.Param{{Name: "line", Type: param.TypeString}, {Name: "delimiter", Type: param.TypeString, Optional: true}}, Result: param.TypeArray, Doc: "Splits one CSV record into its fields."},
+		{Name: "graphemeLength", Params: []param.Param{{Name: "s", Type: param.TypeString}}, Result: param.TypeNumeric, Doc: "Counts the user-perceived characters of s."},
+		{Name: "containsEmoji", Params: []param.Param{{Name: "s", Type: param.TypeString}}, Result: param.TypeBoolean, Doc: "Reports whether s contains an emoji."},
+		{Name: "stripEmoji", Params: []param.Param{{Name: "s", Type: param.TypeString}}, Result: param.TypeString, Doc: "Removes every emoji from s."},
+	}
+}
+
 func (s *StringLib) Call(functionName string, args []param.Arg, line, col, parenLine, parenCol int) (interface{}, error) {
 	switch functionName {
 	case "concat":
@@ -117,6 +160,26 @@ func (s *StringLib) Call(functionName string, args []param.Arg, line, col, paren
 		}
 		return strings.Contains(str, substr), nil
 
+	case "secureEquals":
+		if len(args) != 2 {
+			return nil, errors.NewParameterError("string.secureEquals requires 2 arguments", line, col)
+		}
+		arg0 := args[0]
+		arg1 := args[1]
+		a, ok := arg0.Value.(string)
+		if !ok {
+			return nil, errors.NewTypeError("string.secureEquals: first argument must be string", arg0.Line, arg0.Column)
+		}
+		b, ok := arg1.Value.(string)
+		if !ok {
+			return nil, errors.NewTypeError("string.secureEquals: second argument must be string", arg1.Line, arg1.Column)
+		}
+		// Comparing fixed-size digests keeps the time taken independent of
+		// both the contents and the lengths of the strings.
+		da := sha256.Sum256([]byte(a))
+		db := sha256.Sum256([]byte(b))
+		return subtle.ConstantTimeCompare(da[:], db[:]) == 1, nil
+
 	case "split":
 		if len(args) != 2 {
 			return nil, errors.NewParameterError("string.split requires 2 arguments", line, col)
@@ -259,7 +322,176 @@ func (s *StringLib) Call(functionName string, args []param.Arg, line, col, paren
 		}
 		return fromIndex + idx, nil
 
+	case "mask":
+		if len(args) < 2 || len(args) > 3 {
+			if len(args) == 0 {
+				return nil, errors.NewParameterError("string.mask requires 2 or 3 arguments", parenLine, parenCol)
+			}
+			lastArg := args[len(args)-1]
+			return nil, errors.NewParameterError("string.mask requires 2 or 3 arguments", lastArg.Line, lastArg.Column)
+		}
+		arg0 := args[0]
+		str, ok := arg0.Value.(string)
+		if !ok {
+			return nil, errors.NewTypeError("string.mask: first argument must be a string", arg0.Line, arg0.Column)
+		}
+		arg1 := args[1]
+		if !types.IsInt(arg1.Value) {
+			return nil, errors.NewTypeError("string.mask: second argument must be an integer", arg1.Line, arg1.Column)
+		}
+		visible, _ := types.ToInt(arg1.Value)
+		if visible < 0 {
+			return nil, errors.NewFunctionCallError("string.mask: visible count must be non‑negative", arg1.Line, arg1.Column)
+		}
+		maskChar := "*"
+		if len(args) == 3 {
+			arg2 := args[2]
+			mc, ok := arg2.Value.(string)
+			if !ok || len([]rune(mc)) != 1 {
+				return nil, errors.NewTypeError("string.mask: mask character must be a single-character string", arg2.Line, arg2.Column)
+			}
+			maskChar = mc
+		}
+		return maskRunes(str, int(visible), maskChar), nil
+
+	case "redactEmail":
+		if len(args) != 1 {
+			return nil, errors.NewParameterError("string.redactEmail requires 1 argument", line, col)
+		}
+		arg0 := args[0]
+		str, ok := arg0.Value.(string)
+		if !ok {
+			return nil, errors.NewTypeError("string.redactEmail: argument must be string", arg0.Line, arg0.Column)
+		}
+		at := strings.LastIndex(str, "@")
+		if at <= 0 || at == len(str)-1 {
+			return nil, errors.NewFunctionCallError("string.redactEmail: argument is not an email address", arg0.Line, arg0.Column)
+		}
+		local := []rune(str[:at])
+		return string(local[0]) + strings.Repeat("*", len(local)-1) + str[at:], nil
+
+	case "last4":
+		if len(args) != 1 {
+			return nil, errors.NewParameterError("string.last4 requires 1 argument", line, col)
+		}
+		arg0 := args[0]
+		str, ok := arg0.Value.(string)
+		if !ok {
+			return nil, errors.NewTypeError("string.last4: argument must be string", arg0.Line, arg0.Column)
+		}
+		runes := []rune(str)
+		if len(runes) <= 4 {
+			return str, nil
+		}
+		return string(runes[len(runes)-4:]), nil
+
+	case "escapeHtml", "unescapeHtml", "stripTags":
+		if len(args) != 1 {
+			return nil, errors.NewParameterError(fmt.Sprintf("string.%s requires 1 argument", functionName), line, col)
+		}
+		arg0 := args[0]
+		str, ok := arg0.Value.(string)
+		if !ok {
+			return nil, errors.NewTypeError(fmt.Sprintf("string.%s: argument must be string", functionName), arg0.Line, arg0.Column)
+		}
+		switch functionName {
+		case "escapeHtml":
+			return html.EscapeString(str), nil
+		case "unescapeHtml":
+			return html.UnescapeString(str), nil
+		default:
+			return htmlTagPattern.ReplaceAllString(htmlRawTextPattern.ReplaceAllString(str, ""), ""), nil
+		}
+
+	case "graphemeLength", "containsEmoji", "stripEmoji":
+		if len(args) != 1 {
+			return nil, errors.NewParameterError(fmt.Sprintf("string.%s requires 1 argument", functionName), line, col)
+		}
+		arg0 := args[0]
+		str, ok := arg0.Value.(string)
+		if !ok {
+			return nil, errors.NewTypeError(fmt.Sprintf("string.%s: argument must be string", functionName), arg0.Line, arg0.Column)
+		}
+		clusters := splitGraphemes(str)
+		switch functionName {
+		case "graphemeLength":
+			return int64(len(clusters)), nil
+		case "containsEmoji":
+			for _, cluster := range clusters {
+				if isEmojiCluster(cluster) {
+					return true, nil
+				}
+			}
+			return false, nil
+		default:
+			var sb strings.Builder
+			for _, cluster := range clusters {
+				if !isEmojiCluster(cluster) {
+					sb.WriteString(cluster)
+				}
+			}
+			return sb.String(), nil
+		}
+
+	case "parseCsvLine":
+		if len(args) < 1 || len(args) > 2 {
+			if len(args) == 0 {
+				return nil, errors.NewParameterError("string.parseCsvLine requires 1 or 2 arguments", parenLine, parenCol)
+			}
+			lastArg := args[len(args)-1]
+			return nil, errors.NewParameterError("string.parseCsvLine requires 1 or 2 arguments", lastArg.Line, lastArg.Column)
+		}
+		arg0 := args[0]
+		str, ok := arg0.Value.(string)
+		if !ok {
+			return nil, errors.NewTypeError("string.parseCsvLine: argument must be string", arg0.Line, arg0.Column)
+		}
+		reader := csv.NewReader(strings.NewReader(str))
+		reader.FieldsPerRecord = -1
+		if len(args) == 2 {
+			delim, ok := args[1].Value.(string)
+			runes := []rune(delim)
+			if !ok || len(runes) != 1 || runes[0] == '"' || runes[0] == '\r' || runes[0] == '\n' {
+				return nil, errors.NewParameterError("string.parseCsvLine: delimiter must be a single character", args[1].Line, args[1].Column)
+			}
+			reader.Comma = runes[0]
+		}
+		record, err := reader.Read()
+		if err == io.EOF {
+			return []interface{}{}, nil
+		}
+		if err != nil {
+			return nil, errors.NewFunctionCallError(fmt.Sprintf("string.parseCsvLine: %v", unwrapCsvError(err)), arg0.Line, arg0.Column)
+		}
+		if _, err := reader.Read(); err != io.EOF {
+			return nil, errors.NewFunctionCallError("string.parseCsvLine: input contains more than one record", arg0.Line, arg0.Column)
+		}
+		fields := make([]interface{}, len(record))
+		for i, field := range record {
+			fields[i] = field
+		}
+		return fields, nil
+
 	default:
 		return nil, errors.NewFunctionCallError(fmt.Sprintf("unknown string function '%s'", functionName), 0, 0)
 	}
 }
+
+// unwrapCsvError drops the record and line prefix encoding/csv adds, which
+// is meaningless for a single line.
+func unwrapCsvError(err error) error {
+	if parseErr, ok := err.(*csv.ParseError); ok {
+		return parseErr.Err
+	}
+	return err
+}
+
+// maskRunes replaces all but the last visible runes of s with maskChar.
+func maskRunes(s string, visible int, maskChar string) string {
+	runes := []rune(s)
+	if visible >= len(runes) {
+		return s
+	}
+	hidden := len(runes) - visible
+	return strings.Repeat(maskChar, hidden) + string(runes[hidden:])
+}
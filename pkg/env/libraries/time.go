@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/SpecDrivenDesign/lql/pkg/param"
 	"github.com/SpecDrivenDesign/lql/pkg/types"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -11,16 +12,11 @@ import (
 	"github.com/SpecDrivenDesign/lql/pkg/errors"
 )
 
-type TimeValue struct {
-	EpochMillis int64
-	Zone        string
-}
+// TimeValue is the value of the language's Time type.
+type TimeValue = types.TimeValue
 
 func newTimeValue(t time.Time) TimeValue {
-	return TimeValue{
-		EpochMillis: t.UnixNano() / int64(time.Millisecond),
-		Zone:        t.Location().String(),
-	}
+	return types.TimeValueOf(t)
 }
 
 type TimeLib struct{}
@@ -29,6 +25,29 @@ func NewTimeLib() *TimeLib {
 	return &TimeLib{}
 }
 
+// Functions describes the time functions.
+func (t *TimeLib) Functions() []param.Function {
+	return []param.Function{
+		{Name: "now", Params: []param.Param{}, Result: param.TypeTime, Doc: "Returns the current time."},
+		{Name: "parse", Params: []param.Param{{Name: "input", Type: param.TypeString}, {Name: "format", Type: param.TypeString}, {Name: "details", Type: param.TypeString, Optional: true}}, Result: param.TypeTime, Doc: "Parses input in the format iso8601, dateOnly, epochMillis, rfc2822 or custom; custom takes a Go layout in details."},
+		{Name: "add", Params: []param.Param{{Name: "time", Type: param.TypeTime}, {Name: "millis", Type: param.TypeNumeric}}, Result: param.TypeTime, Doc: "Returns time plus millis milliseconds."},
+		{Name: "subtract", Params: []param.Param{{Name: "time", Type: param.TypeTime}, {Name: "millis", Type: param.TypeNumeric}}, Result: param.TypeTime, Doc: "Returns time minus millis milliseconds."},
+		{Name: "diff", Params: []param.Param{{Name: "a", Type: param.TypeTime}, {Name: "b", Type: param.TypeTime}}, Result: param.TypeNumeric, Doc: "Returns a minus b in milliseconds."},
+		{Name: "isBefore", Params: []param.Param{{Name: "a", Type: param.TypeTime}, {Name: "b", Type: param.TypeTime}}, Result: param.TypeBoolean, Doc: "Reports whether a is before b."},
+		{Name: "isAfter", Params: []param.Param{{Name: "a", Type: param.TypeTime}, {Name: "b", Type: param.TypeTime}}, Result: param.TypeBoolean, Doc: "Reports whether a is after b."},
+		{Name: "isEqual", Params: []param.Param{{Name: "a", Type: param.TypeTime}, {Name: "b", Type: param.TypeTime}}, Result: param.TypeBoolean, Doc: "Reports whether a and b are the same instant."},
+		{Name: "toEpochMillis", Params: []param.Param{{Name: "time", Type: param.TypeTime}}, Result: param.TypeNumeric, Doc: "Returns time as milliseconds since the Unix epoch."},
+		{Name: "format", Params: []param.Param{{Name: "time", Type: param.TypeTime}, {Name: "format", Type: param.TypeString}}, Result: param.TypeString, Doc: "Formats time with a Go layout or a named format."},
+		{Name: "getYear", Params: []param.Param{{Name: "time", Type: param.TypeTime}}, Result: param.TypeNumeric, Doc: "Returns the year of time."},
+		{Name: "getMonth", Params: []param.Param{{Name: "time", Type: param.TypeTime}}, Result: param.TypeNumeric, Doc: "Returns the month of time, from 1 to 12."},
+		{Name: "getDay", Params: []param.Param{{Name: "time", Type: param.TypeTime}}, Result: param.TypeNumeric, Doc: "Returns the day of the month of time."},
+		{Name: "startOfDay", Params: []param.Param{{Name: "time", Type: param.TypeTime}}, Result: param.TypeTime, Doc: "Returns midnight at the start of the day of time."},
+		{Name: "endOfDay", Params: []param.Param{{Name: "time", Type: param.TypeTime}}, Result: param.TypeTime, Doc: "Returns the last millisecond of the day of time."},
+		{Name: "withZone", Params: []param.Param{{Name: "time", Type: param.TypeTime}, {Name: "zone", Type: param.TypeString}}, Result: param.TypeTime, Doc: "Returns the same instant in the IANA time zone zone."},
+		{Name: "bucket", Params: []param.Param{{Name: "events", Type: param.TypeArray}, {Name: "field", Type: param.TypeString}, {Name: "interval", Type: param.TypeString}}, Result: param.TypeArray, Doc: "Groups events into fixed intervals by the time under field."},
+	}
+}
+
 func (t *TimeLib) Call(functionName string, args []param.Arg, line, col, parenLine, parenCol int) (interface{}, error) {
 	switch functionName {
 	case "now":
@@ -321,7 +340,112 @@ func (t *TimeLib) Call(functionName string, args []param.Arg, line, col, parenLi
 		}
 		return TimeValue{EpochMillis: tv.EpochMillis, Zone: loc.String()}, nil
 
+	case "bucket":
+		if len(args) != 3 {
+			return nil, errors.NewParameterError("time.bucket requires 3 arguments", line, col)
+		}
+		arg0 := args[0]
+		events, ok := types.ConvertToInterfaceSlice(arg0.Value)
+		if !ok {
+			return nil, errors.NewTypeError("time.bucket: first argument must be an array", arg0.Line, arg0.Column)
+		}
+		arg1 := args[1]
+		field, ok := arg1.Value.(string)
+		if !ok {
+			return nil, errors.NewTypeError("time.bucket: second argument must be a string", arg1.Line, arg1.Column)
+		}
+		arg2 := args[2]
+		intervalStr, ok := arg2.Value.(string)
+		if !ok {
+			return nil, errors.NewTypeError("time.bucket: third argument must be a string", arg2.Line, arg2.Column)
+		}
+		interval, ok := parseBucketInterval(intervalStr)
+		if !ok {
+			return nil, errors.NewFunctionCallError(fmt.Sprintf("time.bucket: invalid interval '%s'", intervalStr), arg2.Line, arg2.Column)
+		}
+		counts := make(map[int64]int64)
+		for _, event := range events {
+			obj, ok := types.ConvertToStringMap(event)
+			if !ok {
+				return nil, errors.NewTypeError("time.bucket: events must be objects", arg0.Line, arg0.Column)
+			}
+			raw, exists := obj[field]
+			if !exists || raw == nil {
+				continue
+			}
+			millis, ok := timestampMillis(raw)
+			if !ok {
+				return nil, errors.NewTypeError(fmt.Sprintf("time.bucket: field '%s' must be a Time, an ISO 8601 string or epoch milliseconds", field), arg1.Line, arg1.Column)
+			}
+			start := millis - millis%interval
+			if millis%interval < 0 {
+				start -= interval
+			}
+			counts[start]++
+		}
+		starts := make([]int64, 0, len(counts))
+		for start := range counts {
+			starts = append(starts, start)
+		}
+		sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+		buckets := make([]interface{}, len(starts))
+		for i, start := range starts {
+			buckets[i] = map[string]interface{}{
+				"start": TimeValue{EpochMillis: start, Zone: "UTC"},
+				"end":   TimeValue{EpochMillis: start + interval, Zone: "UTC"},
+				"count": counts[start],
+			}
+		}
+		return buckets, nil
+
 	default:
 		return nil, errors.NewFunctionCallError(fmt.Sprintf("unknown time function '%s'", functionName), 0, 0)
 	}
 }
+
+// parseBucketInterval parses a bucket width such as "15m", "1h" or "1d" into
+// milliseconds. It accepts time.ParseDuration syntax plus "d" (days) and
+// "w" (weeks).
+func parseBucketInterval(s string) (int64, bool) {
+	unit := time.Duration(0)
+	switch {
+	case strings.HasSuffix(s, "d"):
+		unit = 24 * time.Hour
+	case strings.HasSuffix(s, "w"):
+		unit = 7 * 24 * time.Hour
+	}
+	var d time.Duration
+	if unit != 0 {
+		n, err := strconv.ParseInt(s[:len(s)-1], 10, 64)
+		if err != nil {
+			return 0, false
+		}
+		d = time.Duration(n) * unit
+	} else {
+		var err error
+		if d, err = time.ParseDuration(s); err != nil {
+			return 0, false
+		}
+	}
+	millis := d.Milliseconds()
+	return millis, millis > 0
+}
+
+// timestampMillis reads an event timestamp: a Time, an RFC 3339 string or
+// integer epoch milliseconds.
+func timestampMillis(v interface{}) (int64, bool) {
+	switch ts := v.(type) {
+	case TimeValue:
+		return ts.EpochMillis, true
+	case string:
+		t, err := time.Parse(time.RFC3339Nano, ts)
+		if err != nil {
+			return 0, false
+		}
+		return t.UnixMilli(), true
+	}
+	if types.IsInt(v) {
+		return types.ToInt(v)
+	}
+	return 0, false
+}
@@ -0,0 +1,101 @@
+package libraries
+
+import (
+	"fmt"
+	"github.com/SpecDrivenDesign/lql/pkg/errors"
+	"github.com/SpecDrivenDesign/lql/pkg/param"
+	"github.com/SpecDrivenDesign/lql/pkg/types"
+)
+
+// TreeLib answers membership questions about hierarchies stored in the
+// context as nested objects, each with an "id" and an optional "children"
+// array of nodes. A tree is a single root node or an array of roots.
+type TreeLib struct{}
+
+func NewTreeLib() *TreeLib {
+	return &TreeLib{}
+}
+
+// Functions describes the tree functions.
+func (t *TreeLib) Functions() []param.Function {
+	return []param.Function{
+		{Name: "isDescendant", Params: []param.Param{{Name: "tree", Type: param.TypeAny}, {Name: "nodeId", Type: param.TypeAny}, {Name: "ancestorId", Type: param.TypeAny}}, Result: param.TypeBoolean, Doc: "Reports whether nodeId is below ancestorId in tree."},
+		{Name: "pathTo", Params: []param.Param{{Name: "tree", Type: param.TypeAny}, {Name: "nodeId", Type: param.TypeAny}}, Result: param.TypeArray, Doc: "Returns the ids from the root to nodeId, or null."},
+	}
+}
+
+func (t *TreeLib) Call(functionName string, args []param.Arg, line, col, _, _ int) (interface{}, error) {
+	switch functionName {
+	case "isDescendant":
+		if len(args) != 3 {
+			return nil, errors.NewParameterError("tree.isDescendant requires 3 arguments", line, col)
+		}
+		path, err := treePath("tree.isDescendant", args[0], args[1].Value)
+		if err != nil {
+			return nil, err
+		}
+		// The node itself is the last element and is not its own descendant.
+		for i := 0; i < len(path)-1; i++ {
+			if types.Equals(path[i], args[2].Value) {
+				return true, nil
+			}
+		}
+		return false, nil
+
+	case "pathTo":
+		if len(args) != 2 {
+			return nil, errors.NewParameterError("tree.pathTo requires 2 arguments", line, col)
+		}
+		path, err := treePath("tree.pathTo", args[0], args[1].Value)
+		if err != nil || path == nil {
+			return nil, err
+		}
+		return path, nil
+
+	default:
+		return nil, errors.NewFunctionCallError(fmt.Sprintf("unknown tree function '%s'", functionName), 0, 0)
+	}
+}
+
+// treePath returns the ids from the root of the tree to the node with the
+// given id, inclusive, or nil when no node has that id.
+func treePath(fn string, tree param.Arg, id interface{}) ([]interface{}, error) {
+	roots, ok := types.ConvertToInterfaceSlice(tree.Value)
+	if !ok {
+		if _, isObject := types.ConvertToStringMap(tree.Value); !isObject {
+			return nil, errors.NewTypeError(fmt.Sprintf("%s: tree must be an object or an array of objects", fn), tree.Line, tree.Column)
+		}
+		roots = []interface{}{tree.Value}
+	}
+
+	var search func(nodes []interface{}, path []interface{}) ([]interface{}, error)
+	search = func(nodes []interface{}, path []interface{}) ([]interface{}, error) {
+		for _, n := range nodes {
+			node, ok := types.ConvertToStringMap(n)
+			if !ok {
+				return nil, errors.NewTypeError(fmt.Sprintf("%s: tree nodes must be objects", fn), tree.Line, tree.Column)
+			}
+			nodeID, ok := node["id"]
+			if !ok {
+				return nil, errors.NewTypeError(fmt.Sprintf("%s: tree node is missing an id", fn), tree.Line, tree.Column)
+			}
+			nodePath := append(path[:len(path):len(path)], nodeID)
+			if types.Equals(nodeID, id) {
+				return nodePath, nil
+			}
+			if node["children"] == nil {
+				continue
+			}
+			children, ok := types.ConvertToInterfaceSlice(node["children"])
+			if !ok {
+				return nil, errors.NewTypeError(fmt.Sprintf("%s: children of node %v must be an array", fn, nodeID), tree.Line, tree.Column)
+			}
+			found, err := search(children, nodePath)
+			if err != nil || found != nil {
+				return found, err
+			}
+		}
+		return nil, nil
+	}
+	return search(roots, nil)
+}
@@ -17,6 +17,26 @@ func NewTypeLib() *TypeLib {
 	return &TypeLib{}
 }
 
+// Functions describes the type functions.
+func (t *TypeLib) Functions() []param.Function {
+	return []param.Function{
+		{Name: "string", Params: []param.Param{{Name: "x", Type: param.TypeAny}}, Result: param.TypeString, Doc: "Converts x to a string."},
+		{Name: "int", Params: []param.Param{{Name: "x", Type: param.TypeAny}}, Result: param.TypeNumeric, Doc: "Converts x to an int."},
+		{Name: "float", Params: []param.Param{{Name: "x", Type: param.TypeAny}}, Result: param.TypeNumeric, Doc: "Converts x to a float."},
+		{Name: "decimal", Params: []param.Param{{Name: "x", Type: param.TypeAny}}, Result: param.TypeNumeric, Doc: "Converts x to a decimal."},
+		{Name: "intArray", Params: []param.Param{{Name: "arr", Type: param.TypeArray}}, Result: param.TypeArray, Doc: "Converts each element of arr to an int."},
+		{Name: "floatArray", Params: []param.Param{{Name: "arr", Type: param.TypeArray}}, Result: param.TypeArray, Doc: "Converts each element of arr to a float."},
+		{Name: "stringArray", Params: []param.Param{{Name: "arr", Type: param.TypeArray}}, Result: param.TypeArray, Doc: "Converts each element of arr to a string."},
+		{Name: "isNumber", Params: []param.Param{{Name: "x", Type: param.TypeAny}}, Result: param.TypeBoolean, Doc: "Reports whether x is a number."},
+		{Name: "isString", Params: []param.Param{{Name: "x", Type: param.TypeAny}}, Result: param.TypeBoolean, Doc: "Reports whether x is a string."},
+		{Name: "isBoolean", Params: []param.Param{{Name: "x", Type: param.TypeAny}}, Result: param.TypeBoolean, Doc: "Reports whether x is a boolean."},
+		{Name: "isArray", Params: []param.Param{{Name: "x", Type: param.TypeAny}}, Result: param.TypeBoolean, Doc: "Reports whether x is an array."},
+		{Name: "isObject", Params: []param.Param{{Name: "x", Type: param.TypeAny}}, Result: param.TypeBoolean, Doc: "Reports whether x is an object."},
+		{Name: "isNull", Params: []param.Param{{Name: "x", Type: param.TypeAny}}, Result: param.TypeBoolean, Doc: "Reports whether x is null."},
+		{Name: "matchesSchema", Params: []param.Param{{Name: "value", Type: param.TypeAny}, {Name: "schema", Type: param.TypeAny}, {Name: "mode", Type: param.TypeString, Optional: true}}, Result: param.TypeBoolean, Doc: "Reports whether value matches a schema."},
+	}
+}
+
 func (t *TypeLib) Call(functionName string, args []param.Arg, line, col, _, _ int) (interface{}, error) {
 	switch functionName {
 	case "string":
@@ -84,6 +104,27 @@ func (t *TypeLib) Call(functionName string, args []param.Arg, line, col, _, _ in
 			return num, nil
 		}
 
+	case "decimal":
+		if len(args) != 1 {
+			return nil, errors.NewParameterError("type.decimal requires 1 argument", line, col)
+		}
+		arg0 := args[0]
+		if arg0.Value == nil {
+			return types.Decimal{}, nil
+		}
+		if s, ok := arg0.Value.(string); ok {
+			d, err := types.ParseDecimal(strings.TrimSpace(s))
+			if err != nil {
+				return nil, errors.NewFunctionCallError(fmt.Sprintf("type.decimal: string '%s' cannot be converted to decimal", s), arg0.Line, arg0.Column)
+			}
+			return d, nil
+		}
+		d, ok := types.DecimalOf(arg0.Value)
+		if !ok {
+			return nil, errors.NewTypeError("type.decimal: argument cannot be converted to decimal", arg0.Line, arg0.Column)
+		}
+		return d, nil
+
 	case "intArray":
 		if len(args) != 1 {
 			return nil, errors.NewParameterError("type.intArray requires 1 argument", line, col)
@@ -225,6 +266,32 @@ func (t *TypeLib) Call(functionName string, args []param.Arg, line, col, _, _ in
 		}
 		return args[0].Value == nil, nil
 
+	case "matchesSchema":
+		if len(args) < 2 || len(args) > 3 {
+			return nil, errors.NewParameterError("type.matchesSchema requires 2 or 3 arguments", line, col)
+		}
+		mode := "bool"
+		if len(args) == 3 {
+			arg2 := args[2]
+			m, ok := arg2.Value.(string)
+			if !ok || (m != "bool" && m != "errors") {
+				return nil, errors.NewTypeError("type.matchesSchema: mode must be \"bool\" or \"errors\"", arg2.Line, arg2.Column)
+			}
+			mode = m
+		}
+		problems := []string{}
+		if err := checkSchema(args[0].Value, args[1].Value, "$", &problems); err != nil {
+			return nil, errors.NewFunctionCallError(fmt.Sprintf("type.matchesSchema: %v", err), args[1].Line, args[1].Column)
+		}
+		if mode == "bool" {
+			return len(problems) == 0, nil
+		}
+		result := make([]interface{}, len(problems))
+		for i, p := range problems {
+			result[i] = p
+		}
+		return result, nil
+
 	default:
 		return nil, errors.NewFunctionCallError(fmt.Sprintf("unknown type function '%s'", functionName), 0, 0)
 	}
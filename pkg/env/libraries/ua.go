@@ -0,0 +1,138 @@
+package libraries
+
+import (
+	"fmt"
+	"github.com/SpecDrivenDesign/lql/pkg/errors"
+	"github.com/SpecDrivenDesign/lql/pkg/param"
+	"regexp"
+	"strings"
+)
+
+// uaRule matches one product token; the first submatch is its version.
+type uaRule struct {
+	name    string
+	pattern *regexp.Regexp
+}
+
+// uaBrowsers is checked in order: browsers built on Chrome or Safari also
+// carry those tokens, so the more specific products come first.
+var uaBrowsers = []uaRule{
+	{"Googlebot", regexp.MustCompile(`\bGooglebot/([\d.]+)`)},
+	{"Bingbot", regexp.MustCompile(`\bbingbot/([\d.]+)`)},
+	{"Edge", regexp.MustCompile(`\b(?:Edg|Edge|EdgA|EdgiOS)/([\d.]+)`)},
+	{"Opera", regexp.MustCompile(`\b(?:OPR|Opera)[/ ]([\d.]+)`)},
+	{"Samsung Internet", regexp.MustCompile(`\bSamsungBrowser/([\d.]+)`)},
+	{"Firefox", regexp.MustCompile(`\b(?:Firefox|FxiOS)/([\d.]+)`)},
+	{"Chrome", regexp.MustCompile(`\b(?:Chrome|CriOS)/([\d.]+)`)},
+	{"Safari", regexp.MustCompile(`\bVersion/([\d.]+).*\bSafari/`)},
+	{"Internet Explorer", regexp.MustCompile(`\b(?:MSIE ([\d.]+)|Trident/.*\brv:([\d.]+))`)},
+}
+
+var uaOperatingSystems = []uaRule{
+	{"Windows", regexp.MustCompile(`\bWindows NT ([\d.]+)`)},
+	{"iOS", regexp.MustCompile(`\b(?:iPhone|CPU) OS ([\d_]+)`)},
+	{"Android", regexp.MustCompile(`\bAndroid ?([\d.]*)`)},
+	{"ChromeOS", regexp.MustCompile(`\bCrOS \S+ ([\d.]+)`)},
+	{"macOS", regexp.MustCompile(`\bMac OS X ?([\d_.]*)`)},
+	{"Linux", regexp.MustCompile(`\bLinux()`)},
+}
+
+var uaBotPattern = regexp.MustCompile(`(?i)bot\b|crawler|spider|slurp|headless`)
+
+// windowsVersions maps Windows NT kernel versions to marketing names.
+var windowsVersions = map[string]string{
+	"10.0": "10",
+	"6.3":  "8.1",
+	"6.2":  "8",
+	"6.1":  "7",
+	"6.0":  "Vista",
+	"5.1":  "XP",
+}
+
+// UALib implements user-agent parsing functions.
+type UALib struct{}
+
+func NewUALib() *UALib {
+	return &UALib{}
+}
+
+// Functions describes the ua functions.
+func (u *UALib) Functions() []param.Function {
+	return []param.Function{
+		{Name: "parse", Params: []param.Param{{Name: "userAgent", Type: param.TypeString}}, Result: param.TypeObject, Doc: "Classifies a User-Agent header."},
+	}
+}
+
+func (u *UALib) Call(functionName string, args []param.Arg, line, col, _, _ int) (interface{}, error) {
+	switch functionName {
+	case "parse":
+		if len(args) != 1 {
+			return nil, errors.NewParameterError("ua.parse requires 1 argument", line, col)
+		}
+		arg0 := args[0]
+		s, ok := arg0.Value.(string)
+		if !ok {
+			return nil, errors.NewTypeError("ua.parse: argument must be a string", arg0.Line, arg0.Column)
+		}
+		return parseUserAgent(s), nil
+
+	default:
+		return nil, errors.NewFunctionCallError(fmt.Sprintf("unknown ua function '%s'", functionName), 0, 0)
+	}
+}
+
+// parseUserAgent extracts browser, operating system and device class from a
+// User-Agent header. Unrecognized parts are reported as "unknown" with an
+// empty version.
+func parseUserAgent(s string) map[string]interface{} {
+	browser, browserVersion := matchUARules(uaBrowsers, s)
+	os, osVersion := matchUARules(uaOperatingSystems, s)
+	switch os {
+	case "Windows":
+		if name, ok := windowsVersions[osVersion]; ok {
+			osVersion = name
+		}
+	case "iOS", "macOS":
+		osVersion = strings.ReplaceAll(osVersion, "_", ".")
+	}
+	if os == "macOS" && strings.Contains(s, "iPad") {
+		os = "iOS"
+	}
+
+	device := "unknown"
+	switch {
+	case uaBotPattern.MatchString(s):
+		device = "bot"
+	case strings.Contains(s, "iPad") || strings.Contains(s, "Tablet") || (os == "Android" && !strings.Contains(s, "Mobile")):
+		device = "tablet"
+	case strings.Contains(s, "Mobi") || strings.Contains(s, "iPhone") || strings.Contains(s, "iPod"):
+		device = "mobile"
+	case os == "Windows" || os == "macOS" || os == "Linux" || os == "ChromeOS":
+		device = "desktop"
+	}
+
+	return map[string]interface{}{
+		"browser":        browser,
+		"browserVersion": browserVersion,
+		"os":             os,
+		"osVersion":      osVersion,
+		"device":         device,
+	}
+}
+
+// matchUARules returns the name and version of the first matching rule.
+func matchUARules(rules []uaRule, s string) (string, string) {
+	for _, rule := range rules {
+		m := rule.pattern.FindStringSubmatch(s)
+		if m == nil {
+			continue
+		}
+		for _, version := range m[1:] {
+			if version != "" {
+				return rule.name, version
+			}
+		}
+		return rule.name, ""
+	}
+	return "unknown", ""
+}
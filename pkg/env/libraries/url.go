@@ -0,0 +1,57 @@
+package libraries
+
+import (
+	"fmt"
+	"github.com/SpecDrivenDesign/lql/pkg/errors"
+	"github.com/SpecDrivenDesign/lql/pkg/param"
+	"net/url"
+	"strings"
+)
+
+// URLLib implements URL parsing functions.
+type URLLib struct{}
+
+func NewURLLib() *URLLib {
+	return &URLLib{}
+}
+
+// Functions describes the url functions.
+func (u *URLLib) Functions() []param.Function {
+	return []param.Function{
+		{Name: "parseQuery", Params: []param.Param{{Name: "qs", Type: param.TypeString}}, Result: param.TypeObject, Doc: "Parses a URL query string."},
+	}
+}
+
+func (u *URLLib) Call(functionName string, args []param.Arg, line, col, _, _ int) (interface{}, error) {
+	switch functionName {
+	case "parseQuery":
+		if len(args) != 1 {
+			return nil, errors.NewParameterError("url.parseQuery requires 1 argument", line, col)
+		}
+		arg0 := args[0]
+		s, ok := arg0.Value.(string)
+		if !ok {
+			return nil, errors.NewTypeError("url.parseQuery: argument must be a string", arg0.Line, arg0.Column)
+		}
+		values, err := url.ParseQuery(strings.TrimPrefix(s, "?"))
+		if err != nil {
+			return nil, errors.NewFunctionCallError(fmt.Sprintf("url.parseQuery: invalid query string: %v", err), arg0.Line, arg0.Column)
+		}
+		result := make(map[string]interface{}, len(values))
+		for key, vals := range values {
+			if len(vals) == 1 {
+				result[key] = vals[0]
+				continue
+			}
+			arr := make([]interface{}, len(vals))
+			for i, v := range vals {
+				arr[i] = v
+			}
+			result[key] = arr
+		}
+		return result, nil
+
+	default:
+		return nil, errors.NewFunctionCallError(fmt.Sprintf("unknown url function '%s'", functionName), 0, 0)
+	}
+}
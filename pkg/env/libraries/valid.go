@@ -0,0 +1,246 @@
+package libraries
+
+import (
+	"fmt"
+	"github.com/SpecDrivenDesign/lql/pkg/errors"
+	"github.com/SpecDrivenDesign/lql/pkg/param"
+	"net/mail"
+	"net/url"
+	"strings"
+)
+
+// ValidLib implements format validators. Every validator returns false for
+// non-string input rather than raising an error.
+type ValidLib struct{}
+
+func NewValidLib() *ValidLib {
+	return &ValidLib{}
+}
+
+// Functions describes the valid functions.
+func (v *ValidLib) Functions() []param.Function {
+	return []param.Function{
+		{Name: "isEmail", Params: []param.Param{{Name: "s", Type: param.TypeString}}, Result: param.TypeBoolean, Doc: "Reports whether s is an email address."},
+		{Name: "isURL", Params: []param.Param{{Name: "s", Type: param.TypeString}}, Result: param.TypeBoolean, Doc: "Reports whether s is an absolute http or https URL."},
+		{Name: "isUUID", Params: []param.Param{{Name: "s", Type: param.TypeString}}, Result: param.TypeBoolean, Doc: "Reports whether s is a UUID."},
+		{Name: "isPhone", Params: []param.Param{{Name: "s", Type: param.TypeString}}, Result: param.TypeBoolean, Doc: "Reports whether s looks like a phone number."},
+		{Name: "isCreditCard", Params: []param.Param{{Name: "s", Type: param.TypeString}}, Result: param.TypeBoolean, Doc: "Reports whether s is a card number passing the Luhn check."},
+		{Name: "isLuhn", Params: []param.Param{{Name: "s", Type: param.TypeString}}, Result: param.TypeBoolean, Doc: "Reports whether the digits of s pass the Luhn check."},
+		{Name: "isIBAN", Params: []param.Param{{Name: "s", Type: param.TypeString}}, Result: param.TypeBoolean, Doc: "Reports whether s is a valid IBAN."},
+		{Name: "isEAN", Params: []param.Param{{Name: "s", Type: param.TypeString}}, Result: param.TypeBoolean, Doc: "Reports whether s is an EAN, UPC or GTIN code."},
+	}
+}
+
+func (v *ValidLib) Call(functionName string, args []param.Arg, line, col, _, _ int) (interface{}, error) {
+	var check func(string) bool
+	switch functionName {
+	case "isEmail":
+		check = isEmail
+	case "isURL":
+		check = isURL
+	case "isUUID":
+		check = isUUID
+	case "isPhone":
+		check = isPhone
+	case "isCreditCard":
+		check = isCreditCard
+	case "isLuhn":
+		check = luhnValid
+	case "isIBAN":
+		check = isIBAN
+	case "isEAN":
+		check = isEAN
+	default:
+		return nil, errors.NewFunctionCallError(fmt.Sprintf("unknown valid function '%s'", functionName), 0, 0)
+	}
+	if len(args) != 1 {
+		return nil, errors.NewParameterError(fmt.Sprintf("valid.%s requires 1 argument", functionName), line, col)
+	}
+	s, ok := args[0].Value.(string)
+	if !ok {
+		return false, nil
+	}
+	return check(s), nil
+}
+
+// isEmail accepts a bare addr-spec (no display name) whose domain contains
+// at least one dot.
+func isEmail(s string) bool {
+	addr, err := mail.ParseAddress(s)
+	if err != nil || addr.Address != s {
+		return false
+	}
+	at := strings.LastIndexByte(s, '@')
+	domain := s[at+1:]
+	return strings.Contains(domain, ".") && !strings.HasPrefix(domain, ".") && !strings.HasSuffix(domain, ".")
+}
+
+// isURL accepts absolute http and https URLs with a host.
+func isURL(s string) bool {
+	u, err := url.Parse(s)
+	if err != nil || u.Host == "" || u.Hostname() == "" {
+		return false
+	}
+	scheme := strings.ToLower(u.Scheme)
+	return scheme == "http" || scheme == "https"
+}
+
+// isUUID accepts the canonical 8-4-4-4-12 hexadecimal form in either case.
+func isUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch i {
+		case 8, 13, 18, 23:
+			if ch != '-' {
+				return false
+			}
+		default:
+			if !isHexDigit(ch) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// isPhone accepts 7 to 15 digits with an optional leading '+' and the usual
+// separators (spaces, dashes, dots and parentheses).
+func isPhone(s string) bool {
+	digits := 0
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case ch >= '0' && ch <= '9':
+			digits++
+		case ch == '+':
+			if i != 0 {
+				return false
+			}
+		case ch == ' ' || ch == '-' || ch == '.' || ch == '(' || ch == ')':
+		default:
+			return false
+		}
+	}
+	return digits >= 7 && digits <= 15
+}
+
+// isCreditCard accepts 12 to 19 digits that pass the Luhn check,
+// optionally grouped by single spaces or dashes, but not both. Numbers
+// starting with 0, which no card issuer is assigned, and numbers of one
+// repeated digit, which pass the check only as placeholders, are rejected.
+func isCreditCard(s string) bool {
+	digits := make([]byte, 0, len(s))
+	var separator byte
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case isDecimalDigit(ch):
+			digits = append(digits, ch)
+		case ch == ' ' || ch == '-':
+			// A separator stands between two digits.
+			if i == 0 || i == len(s)-1 || !isDecimalDigit(s[i-1]) || (separator != 0 && ch != separator) {
+				return false
+			}
+			separator = ch
+		default:
+			return false
+		}
+	}
+	if len(digits) < 12 || len(digits) > 19 || digits[0] == '0' {
+		return false
+	}
+	if strings.Count(string(digits), string(digits[:1])) == len(digits) {
+		return false
+	}
+	return luhnValid(string(digits))
+}
+
+// luhnValid reports whether a string of decimal digits has a valid Luhn
+// check digit.
+func luhnValid(digits string) bool {
+	if digits == "" {
+		return false
+	}
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		ch := digits[i]
+		if !isDecimalDigit(ch) {
+			return false
+		}
+		d := int(ch - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// isIBAN accepts an IBAN, optionally grouped by spaces, whose mod-97 check
+// (ISO 13616) yields 1. Country-specific lengths are not checked.
+func isIBAN(s string) bool {
+	iban := strings.ToUpper(strings.ReplaceAll(s, " ", ""))
+	if len(iban) < 15 || len(iban) > 34 {
+		return false
+	}
+	if !isUpperLetter(iban[0]) || !isUpperLetter(iban[1]) || !isDecimalDigit(iban[2]) || !isDecimalDigit(iban[3]) {
+		return false
+	}
+	rearranged := iban[4:] + iban[:4]
+	remainder := 0
+	for i := 0; i < len(rearranged); i++ {
+		ch := rearranged[i]
+		switch {
+		case isDecimalDigit(ch):
+			remainder = (remainder*10 + int(ch-'0')) % 97
+		case isUpperLetter(ch):
+			remainder = (remainder*100 + int(ch-'A') + 10) % 97
+		default:
+			return false
+		}
+	}
+	return remainder == 1
+}
+
+// isEAN accepts EAN-8, UPC-A (12 digits), EAN-13 and GTIN-14 codes with a
+// valid check digit.
+func isEAN(s string) bool {
+	switch len(s) {
+	case 8, 12, 13, 14:
+	default:
+		return false
+	}
+	sum := 0
+	for i := len(s) - 1; i >= 0; i-- {
+		ch := s[i]
+		if !isDecimalDigit(ch) {
+			return false
+		}
+		d := int(ch - '0')
+		if (len(s)-1-i)%2 == 1 {
+			d *= 3
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
+
+func isDecimalDigit(ch byte) bool {
+	return '0' <= ch && ch <= '9'
+}
+
+func isUpperLetter(ch byte) bool {
+	return 'A' <= ch && ch <= 'Z'
+}
+
+func isHexDigit(ch byte) bool {
+	return ('0' <= ch && ch <= '9') || ('a' <= ch && ch <= 'f') || ('A' <= ch && ch <= 'F')
+}
@@ -0,0 +1,51 @@
+package libraries
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIsCreditCard(t *testing.T) {
+	valid := []string{
+		"4111111111111111",
+		"4111 1111 1111 1111",
+		"4111-1111-1111-1111",
+		"3782 822463 10005",
+		"5555555555554444",
+	}
+	for _, s := range valid {
+		if !isCreditCard(s) {
+			t.Errorf("isCreditCard(%q) = false", s)
+		}
+	}
+	// Every digit string below passes the Luhn check, so only the rules
+	// for card numbers reject them.
+	degenerate := []string{
+		"0000000000000000",
+		"0000 0000 0000 0000",
+		"000000000000",
+		"04111111111111111",
+		"8888 8888 8888 8888",
+		"666666666666 6",
+		"44444444440",          // 11 digits
+		"44444444444444444444", // 20 digits
+		"4111-1111 1111-1111",
+		" 4111111111111111",
+		"4111111111111111-",
+		"4111  1111 1111 1111",
+		"4111--1111-1111-1111",
+	}
+	for _, s := range degenerate {
+		if !luhnValid(strings.NewReplacer(" ", "", "-", "").Replace(s)) {
+			t.Fatalf("%q fails the Luhn check", s)
+		}
+		if isCreditCard(s) {
+			t.Errorf("isCreditCard(%q) = true", s)
+		}
+	}
+	for _, s := range []string{"", "4111 1111 1111 1112", "4111.1111.1111.1111", "4111111111111111x"} {
+		if isCreditCard(s) {
+			t.Errorf("isCreditCard(%q) = true", s)
+		}
+	}
+}
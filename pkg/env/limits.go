@@ -0,0 +1,73 @@
+package env
+
+import (
+	"fmt"
+	"github.com/SpecDrivenDesign/lql/pkg/errors"
+)
+
+// Limits bounds the resources that each evaluation with an environment may
+// use, so that a hostile expression fails with a ResourceLimitError instead
+// of exhausting CPU or memory. A zero field means no limit.
+type Limits struct {
+	// MaxNodeEvaluations bounds the number of expression nodes evaluated.
+	MaxNodeEvaluations int64
+	// MaxArrayLength bounds the length of arrays produced by function
+	// calls, array literals and projections.
+	MaxArrayLength int
+	// MaxStringLength bounds the length in bytes of strings produced by
+	// function calls.
+	MaxStringLength int
+	// MaxAllocatedBytes bounds an estimate of the memory held by the
+	// values produced by function calls, literals and projections.
+	MaxAllocatedBytes int64
+	// MaxDepth bounds how deeply the expression nodes being evaluated
+	// nest, the root having depth 1, so that a deeply nested expression
+	// fails instead of overflowing the stack.
+	MaxDepth int
+}
+
+// Step counts the evaluation of the node at line and column against the
+// Limits.MaxNodeEvaluations of the evaluation of s.
+func (e *Environment) Step(s *Scope, line, column int) error {
+	if e.Limits.MaxNodeEvaluations <= 0 || s == nil || s.eval == nil {
+		return nil
+	}
+	if s.eval.nodes.Add(1) > e.Limits.MaxNodeEvaluations {
+		return errors.NewResourceLimitError(fmt.Sprintf("evaluation exceeded the limit of %d node evaluations", e.Limits.MaxNodeEvaluations), line, column)
+	}
+	return nil
+}
+
+// Produced checks a value newly produced at line and column against the
+// length limits and counts its estimated size against the
+// Limits.MaxAllocatedBytes of the evaluation of s. Only the top level of the value is measured;
+// nested values are counted by the nodes that produce them.
+func (e *Environment) Produced(s *Scope, value interface{}, line, column int) error {
+	var length int
+	var size int64
+	switch v := value.(type) {
+	case string:
+		length = len(v)
+		size = int64(len(v))
+		if e.Limits.MaxStringLength > 0 && length > e.Limits.MaxStringLength {
+			return errors.NewResourceLimitError(fmt.Sprintf("string of length %d exceeds the limit of %d", length, e.Limits.MaxStringLength), line, column)
+		}
+	case []interface{}:
+		length = len(v)
+		size = int64(len(v)) * 16
+		if e.Limits.MaxArrayLength > 0 && length > e.Limits.MaxArrayLength {
+			return errors.NewResourceLimitError(fmt.Sprintf("array of length %d exceeds the limit of %d", length, e.Limits.MaxArrayLength), line, column)
+		}
+	case map[string]interface{}:
+		for k := range v {
+			size += int64(len(k)) + 48
+		}
+	}
+	if e.Limits.MaxAllocatedBytes <= 0 || size == 0 || s == nil || s.eval == nil {
+		return nil
+	}
+	if s.eval.allocated.Add(size) > e.Limits.MaxAllocatedBytes {
+		return errors.NewResourceLimitError(fmt.Sprintf("evaluation exceeded the allocation limit of %d bytes", e.Limits.MaxAllocatedBytes), line, column)
+	}
+	return nil
+}
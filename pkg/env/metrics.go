@@ -0,0 +1,117 @@
+package env
+
+import (
+	libraries2 "github.com/SpecDrivenDesign/lql/pkg/env/libraries"
+	"time"
+)
+
+// Metrics describes the work done by one evaluation, so that hosts can
+// monitor what expressions cost, for example per tenant.
+type Metrics struct {
+	// NodeEvaluations is the number of expression nodes evaluated.
+	NodeEvaluations int64
+	// FunctionCalls counts the calls made to each function, by
+	// "library.function".
+	FunctionCalls map[string]int64
+	// RegexCompiles is the number of regular expressions compiled by
+	// regex functions, =~, !~ and LIKE. Patterns already in the regex
+	// cache are not compiled again.
+	RegexCompiles int64
+	// MaxDepth is the nesting depth of the deepest node evaluated; the
+	// root has depth 1.
+	MaxDepth int
+	// WallTime is the time the evaluation took.
+	WallTime time.Duration
+}
+
+// MetricsSink receives the metrics of each evaluation with an environment.
+// Evaluations running concurrently record their metrics concurrently, so a
+// sink shared by them must be safe for concurrent use.
+type MetricsSink interface {
+	// Record is called when an evaluation ends, whether or not it
+	// succeeded.
+	Record(m Metrics)
+}
+
+// MetricsFunc adapts a function to a MetricsSink.
+type MetricsFunc func(m Metrics)
+
+func (f MetricsFunc) Record(m Metrics) {
+	f(m)
+}
+
+// metricsCollector holds the metrics of an evaluation in progress.
+type metricsCollector struct {
+	metrics Metrics
+	depth   int
+	start   time.Time
+}
+
+// collector returns the metrics collector of the evaluation of s, or nil if
+// it collects no metrics.
+func (s *Scope) collector() *metricsCollector {
+	if s == nil || s.eval == nil {
+		return nil
+	}
+	return s.eval.metrics
+}
+
+// CountNode counts the evaluation of a node at depth, the root being at
+// depth 1, in the metrics of the evaluation of s. Node types are counted by
+// Enter.
+func (e *Environment) CountNode(s *Scope, depth int) {
+	if m := s.collector(); m != nil {
+		m.metrics.NodeEvaluations++
+		m.metrics.MaxDepth = max(m.metrics.MaxDepth, depth)
+	}
+}
+
+// CountCall counts a call to library.function in the metrics of the
+// evaluation of s.
+func (e *Environment) CountCall(s *Scope, library, function string) {
+	m := s.collector()
+	if m == nil {
+		return
+	}
+	if m.metrics.FunctionCalls == nil {
+		m.metrics.FunctionCalls = make(map[string]int64)
+	}
+	m.metrics.FunctionCalls[library+"."+function]++
+}
+
+// CountRegexCompile counts the compilation of a regular expression in the
+// metrics of the evaluation of s.
+func (e *Environment) CountRegexCompile(s *Scope) {
+	if m := s.collector(); m != nil {
+		m.metrics.RegexCompiles++
+	}
+}
+
+// MeteredLibrary returns lib as it is called in s: when the evaluation of s
+// collects metrics and lib is the regex library, a copy of lib that counts
+// the patterns it compiles in them.
+func (e *Environment) MeteredLibrary(s *Scope, lib ILibrary) ILibrary {
+	regex, ok := lib.(*libraries2.RegexLib)
+	if !ok || s.collector() == nil {
+		return lib
+	}
+	metered := *regex
+	metered.Compiled = func() { e.CountRegexCompile(s) }
+	return &metered
+}
+
+// enterMetrics counts a node entered by Enter in the metrics of the
+// evaluation of s.
+func (e *Environment) enterMetrics(s *Scope) {
+	if m := s.collector(); m != nil {
+		m.depth++
+		e.CountNode(s, m.depth)
+	}
+}
+
+// leaveMetrics leaves a node entered by Enter.
+func (e *Environment) leaveMetrics(s *Scope) {
+	if m := s.collector(); m != nil {
+		m.depth--
+	}
+}
@@ -0,0 +1,51 @@
+package env
+
+// Node is the view of an expression node given to an Observer. The nodes
+// passed are ast.Expression values; the narrower type keeps this package
+// free of a dependency on the AST.
+type Node interface {
+	Pos() (int, int)
+	String() string
+}
+
+// Observer is notified as an evaluation enters and leaves expression
+// nodes, in evaluation order. Debuggers and tracers use it to follow an
+// evaluation without changing its result.
+type Observer interface {
+	// Enter is called before node is evaluated. A non-nil error aborts the
+	// evaluation with that error; Leave is not called for node.
+	Enter(node Node) error
+	// Leave is called with the result of evaluating node.
+	Leave(node Node, value interface{}, err error)
+}
+
+// Enter counts the evaluation of node against the resource limits and in
+// the metrics of the evaluation of s, and notifies the observer. Node types
+// call it at the start of Eval, after Descend.
+func (e *Environment) Enter(s *Scope, node Node) error {
+	if e.Metrics != nil {
+		e.enterMetrics(s)
+	}
+	line, column := node.Pos()
+	err := e.Step(s, line, column)
+	if err == nil && e.Observer != nil {
+		err = e.Observer.Enter(node)
+	}
+	if err != nil && e.Metrics != nil {
+		// Leave is not called for node.
+		e.leaveMetrics(s)
+	}
+	return err
+}
+
+// Leave notifies the observer of the result of evaluating node in s and
+// returns that result. Node types return through it at the end of Eval.
+func (e *Environment) Leave(s *Scope, node Node, value interface{}, err error) (interface{}, error) {
+	if e.Observer != nil {
+		e.Observer.Leave(node, value, err)
+	}
+	if e.Metrics != nil {
+		e.leaveMetrics(s)
+	}
+	return value, err
+}
@@ -0,0 +1,119 @@
+package env
+
+import (
+	"fmt"
+	"github.com/SpecDrivenDesign/lql/pkg/errors"
+	"github.com/SpecDrivenDesign/lql/pkg/types"
+	"reflect"
+	"slices"
+)
+
+// OperatorFunc implements a binary operator for values of a custom Go
+// type. Line and column locate the operator for errors.
+type OperatorFunc func(left, right interface{}, line, column int) (interface{}, error)
+
+// overloadableOperators lists the operators RegisterOperator accepts.
+var overloadableOperators = []string{"==", "!=", "<", "<=", ">", ">=", "+", "-", "*", "/"}
+
+type operatorKey struct {
+	typ reflect.Type
+	op  string
+}
+
+// RegisterOperator makes the binary operator op apply fn when an operand
+// is a value of the type of sample, or a pointer to one, such as a Money
+// or Version struct placed in the context. op is one of ==, !=, <, <=, >,
+// >=, +, -, * and /. If only == is registered for the type, != is its
+// negation, and if only < is, >, <= and >= are derived from it. Operators
+// are looked up by the type of the left operand, then of the right one.
+// Operators must be registered before evaluations start.
+func (e *Environment) RegisterOperator(sample interface{}, op string, fn OperatorFunc) error {
+	if !slices.Contains(overloadableOperators, op) {
+		return fmt.Errorf("operator '%s' cannot be overloaded", op)
+	}
+	if fn == nil {
+		return fmt.Errorf("operator '%s' needs a function", op)
+	}
+	t := operandType(sample)
+	if t == nil || isBuiltinType(t) {
+		return fmt.Errorf("operator '%s' cannot be overloaded for %T", op, sample)
+	}
+	if e.operators == nil {
+		e.operators = make(map[operatorKey]OperatorFunc)
+	}
+	e.operators[operatorKey{t, op}] = fn
+	return nil
+}
+
+// OverloadedOperator returns the function registered with RegisterOperator
+// that applies op to left and right, if there is one.
+func (e *Environment) OverloadedOperator(op string, left, right interface{}) (OperatorFunc, bool) {
+	if len(e.operators) == 0 {
+		return nil, false
+	}
+	for _, t := range []reflect.Type{operandType(left), operandType(right)} {
+		if t == nil {
+			continue
+		}
+		if fn, ok := e.operators[operatorKey{t, op}]; ok {
+			return fn, true
+		}
+		if fn, ok := e.derivedOperator(t, op); ok {
+			return fn, true
+		}
+	}
+	return nil, false
+}
+
+// derivedOperator derives op for t from == or <.
+func (e *Environment) derivedOperator(t reflect.Type, op string) (OperatorFunc, bool) {
+	base := "<"
+	if op == "!=" {
+		base = "=="
+	} else if op != ">" && op != "<=" && op != ">=" {
+		return nil, false
+	}
+	fn, ok := e.operators[operatorKey{t, base}]
+	if !ok {
+		return nil, false
+	}
+	return func(left, right interface{}, line, column int) (interface{}, error) {
+		if op == ">" || op == "<=" {
+			left, right = right, left
+		}
+		result, err := fn(left, right, line, column)
+		if err != nil {
+			return nil, err
+		}
+		b, ok := result.(bool)
+		if !ok {
+			return nil, errors.NewTypeError(fmt.Sprintf("'%s' operator for %s must return a boolean, got %T", base, t, result), line, column)
+		}
+		if op == ">" {
+			return b, nil
+		}
+		return !b, nil
+	}, true
+}
+
+// operandType returns the type of v, without pointers, or nil for nil.
+func operandType(v interface{}) reflect.Type {
+	if v == nil {
+		return nil
+	}
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t
+}
+
+// isBuiltinType reports whether values of t are of the language's own
+// types, whose operators are fixed.
+func isBuiltinType(t reflect.Type) bool {
+	switch reflect.Zero(t).Interface().(type) {
+	case string, bool, int64, float64, map[string]interface{}, []interface{}, types.TimeValue, types.Decimal:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,101 @@
+package env
+
+import "testing"
+
+type money struct{ cents int64 }
+
+func cents(v interface{}) int64 {
+	if p, ok := v.(*money); ok {
+		return p.cents
+	}
+	return v.(money).cents
+}
+
+func lessMoney(left, right interface{}, line, column int) (interface{}, error) {
+	return cents(left) < cents(right), nil
+}
+
+func TestRegisterOperatorRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		sample interface{}
+		op     string
+		fn     OperatorFunc
+	}{
+		{"an operator that cannot be overloaded", money{}, "%", lessMoney},
+		{"a logical operator", money{}, "AND", lessMoney},
+		{"no function", money{}, "<", nil},
+		{"a nil sample", nil, "<", lessMoney},
+		{"a built-in type", int64(0), "<", lessMoney},
+		{"a pointer to a built-in type", new(string), "<", lessMoney},
+		{"a map of the language's own type", map[string]interface{}{}, "==", lessMoney},
+	}
+	for _, tt := range tests {
+		e := NewEnvironment()
+		if err := e.RegisterOperator(tt.sample, tt.op, tt.fn); err == nil {
+			t.Errorf("%s: registered", tt.name)
+		}
+		if _, ok := e.OverloadedOperator(tt.op, tt.sample, tt.sample); ok {
+			t.Errorf("%s: found an operator after a failed registration", tt.name)
+		}
+	}
+}
+
+func TestOverloadedOperatorLookup(t *testing.T) {
+	e := NewEnvironment()
+	if err := e.RegisterOperator(&money{}, "<", lessMoney); err != nil {
+		t.Fatal(err)
+	}
+	a, b := money{1}, money{2}
+	tests := []struct {
+		op          string
+		left, right interface{}
+		want        bool
+	}{
+		{"<", a, b, true},
+		{"<", &a, b, true},
+		{">", a, b, false},
+		{"<=", b, b, true},
+		{">=", a, b, false},
+	}
+	for _, tt := range tests {
+		fn, ok := e.OverloadedOperator(tt.op, tt.left, tt.right)
+		if !ok {
+			t.Errorf("%s: no operator for %T and %T", tt.op, tt.left, tt.right)
+			continue
+		}
+		got, err := fn(tt.left, tt.right, 1, 1)
+		if err != nil || got != tt.want {
+			t.Errorf("%v %s %v = %v, %v; want %v", tt.left, tt.op, tt.right, got, err, tt.want)
+		}
+	}
+	// Lookup falls back to the type of the right operand.
+	if _, ok := e.OverloadedOperator("<", int64(1), a); !ok {
+		t.Error("no operator found through the right operand")
+	}
+	for _, op := range []string{"==", "!=", "+"} {
+		if _, ok := e.OverloadedOperator(op, a, b); ok {
+			t.Errorf("%s derived from <", op)
+		}
+	}
+	if _, ok := e.OverloadedOperator("<", int64(1), int64(2)); ok {
+		t.Error("found an operator for operands of built-in types")
+	}
+}
+
+func TestDerivedOperatorRequiresBoolean(t *testing.T) {
+	e := NewEnvironment()
+	err := e.RegisterOperator(money{}, "==", func(left, right interface{}, line, column int) (interface{}, error) {
+		return "yes", nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fn, ok := e.OverloadedOperator("!=", money{}, money{})
+	if !ok {
+		t.Fatal("!= not derived from ==")
+	}
+	if _, err := fn(money{}, money{}, 1, 1); err == nil {
+		t.Error("derived != accepted a non-boolean result of ==")
+	}
+}
@@ -0,0 +1,67 @@
+package env
+
+import "sync"
+
+// SetParallelism lets evaluations with the environment evaluate
+// independent subexpressions concurrently, on up to n goroutines in
+// total; n <= 1, the default, evaluates everything on the calling
+// goroutine. The libraries, cache and observers of the environment must be
+// safe for concurrent use while it is enabled.
+func (e *Environment) SetParallelism(n int) {
+	if n <= 1 {
+		e.workers = nil
+		return
+	}
+	// The calling goroutine is one of the n.
+	e.workers = make(chan struct{}, n-1)
+}
+
+// Parallelism returns the number of goroutines set with SetParallelism, or
+// 1.
+func (e *Environment) Parallelism() int {
+	return cap(e.workers) + 1
+}
+
+// Parallel reports whether evaluations may evaluate subexpressions
+// concurrently. Observers, metrics and dry runs follow an evaluation in
+// order, so evaluations are sequential while any of them is set.
+func (e *Environment) Parallel() bool {
+	return e.workers != nil && e.Observer == nil && e.Metrics == nil && e.DryRun == nil
+}
+
+// RunParallel runs tasks and returns when all of them have finished. Each
+// task runs on a goroutine of its own while one of the environment's
+// workers is free, and on the calling goroutine otherwise, so nested calls
+// never wait for a worker. A panic in a task is raised again on the
+// calling goroutine.
+func (e *Environment) RunParallel(tasks []func()) {
+	var wg sync.WaitGroup
+	var panicOnce sync.Once
+	var panicked interface{}
+	for i, task := range tasks {
+		if i == len(tasks)-1 {
+			task()
+			break
+		}
+		select {
+		case e.workers <- struct{}{}:
+			wg.Add(1)
+			go func() {
+				defer func() {
+					if r := recover(); r != nil {
+						panicOnce.Do(func() { panicked = r })
+					}
+					<-e.workers
+					wg.Done()
+				}()
+				task()
+			}()
+		default:
+			task()
+		}
+	}
+	wg.Wait()
+	if panicked != nil {
+		panic(panicked)
+	}
+}
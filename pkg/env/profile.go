@@ -0,0 +1,71 @@
+package env
+
+import (
+	"fmt"
+	"github.com/SpecDrivenDesign/lql/pkg/errors"
+	"slices"
+)
+
+// Profile restricts the functions that expressions evaluated with an
+// environment may call, so that hosts running untrusted expressions, for
+// example those of many tenants, can sandbox them. A call the profile does
+// not allow fails with a SecurityError when it is evaluated. The zero
+// Profile allows every function.
+type Profile struct {
+	// Name identifies the profile in error messages.
+	Name string
+	// Libraries lists the libraries whose functions may be called; nil
+	// allows every library, including those added by the host.
+	Libraries []string
+	// Denied lists functions, as "library.function", that may not be
+	// called even though their library is allowed.
+	Denied []string
+}
+
+// Built-in profiles.
+var (
+	// ProfileFull allows every function.
+	ProfileFull = Profile{Name: "full"}
+	// ProfileNoTime allows every function except time.now, so that results
+	// do not depend on the clock.
+	ProfileNoTime = Profile{Name: "no-time", Denied: []string{"time.now"}}
+	// ProfilePure allows only built-in functions whose results depend on
+	// their arguments alone. It excludes time.now, the random library,
+	// cache.memo, which keeps results across evaluations, and every
+	// library added by the host.
+	ProfilePure = Profile{
+		Name: "pure",
+		Libraries: []string{
+			"time", "math", "string", "regex", "array", "cond", "type", "stat", "object", "valid",
+			"phone", "ua", "iso", "convert", "jwt", "url", "range", "tree", "hash",
+		},
+		Denied: []string{"time.now"},
+	}
+)
+
+// LookupProfile returns the built-in profile named name.
+func LookupProfile(name string) (Profile, bool) {
+	for _, p := range []Profile{ProfileFull, ProfileNoTime, ProfilePure} {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return Profile{}, false
+}
+
+// Allows reports whether the profile allows calls to library.function.
+func (p Profile) Allows(library, function string) bool {
+	if p.Libraries != nil && !slices.Contains(p.Libraries, library) {
+		return false
+	}
+	return !slices.Contains(p.Denied, library+"."+function)
+}
+
+// CheckProfile returns a SecurityError for a call at line and column to
+// library.function if the environment's profile does not allow it.
+func (e *Environment) CheckProfile(library, function string, line, column int) error {
+	if e.Profile.Allows(library, function) {
+		return nil
+	}
+	return errors.NewSecurityError(fmt.Sprintf("%s.%s is not allowed by profile '%s'", library, function, e.Profile.Name), line, column)
+}
@@ -0,0 +1,163 @@
+package env
+
+import (
+	"fmt"
+	"strings"
+)
+
+// reservedLibraries are names expressions cannot call a library by: the
+// language's keywords, cache, whose functions the evaluator handles
+// itself, and ItemVariable, which names a variable within function
+// arguments.
+var reservedLibraries = map[string]bool{
+	"true": true, "false": true, "null": true, "AND": true, "OR": true, "NOT": true,
+	"cache": true, ItemVariable: true,
+}
+
+// RegisterLibrary makes lib callable from expressions as name.function(...).
+// It fails if name is not an identifier, is reserved, or names a library
+// that is already registered; Unregister a library first to replace it.
+// Libraries must be registered before evaluations start.
+func (e *Environment) RegisterLibrary(name string, lib ILibrary) error {
+	if !isIdentifier(name) {
+		return fmt.Errorf("library name '%s' is not an identifier", name)
+	}
+	if reservedLibraries[name] {
+		return fmt.Errorf("library name '%s' is reserved", name)
+	}
+	if lib == nil {
+		return fmt.Errorf("library '%s' is nil", name)
+	}
+	if _, exists := e.Libraries[name]; exists {
+		return fmt.Errorf("library '%s' already registered", name)
+	}
+	if e.Libraries == nil {
+		e.Libraries = make(map[string]ILibrary)
+	}
+	e.Libraries[name] = lib
+	return nil
+}
+
+// MustRegister is like RegisterLibrary but panics if the library cannot be
+// registered.
+func (e *Environment) MustRegister(name string, lib ILibrary) {
+	if err := e.RegisterLibrary(name, lib); err != nil {
+		panic(err)
+	}
+}
+
+// Unregister removes the library registered as name, together with the
+// capabilities its functions require and its side-effecting mark, and
+// reports whether there was one.
+func (e *Environment) Unregister(name string) bool {
+	if _, exists := e.Libraries[name]; !exists {
+		return false
+	}
+	delete(e.Libraries, name)
+	delete(e.SideEffectLibraries, name)
+	for function := range e.FunctionCapabilities {
+		if strings.HasPrefix(function, name+".") {
+			delete(e.FunctionCapabilities, function)
+		}
+	}
+	return true
+}
+
+// isIdentifier reports whether name lexes as a single identifier.
+func isIdentifier(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		ch := name[i]
+		letter := ch == '_' || ('a' <= ch && ch <= 'z') || ('A' <= ch && ch <= 'Z')
+		if !letter && (i == 0 || ch < '0' || ch > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// Option configures an environment created with NewEnvironmentWith.
+type Option func(*Environment) error
+
+// NewEnvironmentWith creates an environment with the default libraries, as
+// NewEnvironment does, and applies opts to it in order.
+func NewEnvironmentWith(opts ...Option) (*Environment, error) {
+	e := NewEnvironment()
+	for _, opt := range opts {
+		if err := opt(e); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+// WithLibrary registers lib as name; see RegisterLibrary.
+func WithLibrary(name string, lib ILibrary) Option {
+	return func(e *Environment) error {
+		return e.RegisterLibrary(name, lib)
+	}
+}
+
+// WithoutLibraries unregisters the named default libraries.
+func WithoutLibraries(names ...string) Option {
+	return func(e *Environment) error {
+		for _, name := range names {
+			if !e.Unregister(name) {
+				return fmt.Errorf("library '%s' is not registered", name)
+			}
+		}
+		return nil
+	}
+}
+
+// WithCapabilities grants the caller exactly the given capabilities,
+// revoking the default ones.
+func WithCapabilities(capabilities ...string) Option {
+	return func(e *Environment) error {
+		e.RevokeAll()
+		e.Grant(capabilities...)
+		return nil
+	}
+}
+
+// WithProfile sets the environment's profile.
+func WithProfile(p Profile) Option {
+	return func(e *Environment) error {
+		e.Profile = p
+		return nil
+	}
+}
+
+// WithLimits sets the environment's resource limits.
+func WithLimits(l Limits) Option {
+	return func(e *Environment) error {
+		e.Limits = l
+		return nil
+	}
+}
+
+// WithCallHook sets the environment's call hook.
+func WithCallHook(h CallHook) Option {
+	return func(e *Environment) error {
+		e.CallHook = h
+		return nil
+	}
+}
+
+// WithRandomSeed seeds the random library; see SetRandomSeed.
+func WithRandomSeed(seed int64) Option {
+	return func(e *Environment) error {
+		e.SetRandomSeed(seed)
+		return nil
+	}
+}
+
+// WithParallelism sets the environment's parallelism; see SetParallelism.
+func WithParallelism(n int) Option {
+	return func(e *Environment) error {
+		e.SetParallelism(n)
+		return nil
+	}
+}
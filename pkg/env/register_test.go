@@ -0,0 +1,101 @@
+package env
+
+import "testing"
+
+func TestRegisterLibraryItemIsReserved(t *testing.T) {
+	e := NewEnvironment()
+	if err := e.RegisterLibrary(ItemVariable, e.Libraries["math"]); err == nil {
+		t.Fatalf("registered a library as %q", ItemVariable)
+	}
+}
+
+func TestRegisterLibraryRejects(t *testing.T) {
+	lib := NewEnvironment().Libraries["math"]
+	tests := []struct {
+		name string
+		lib  ILibrary
+		why  string
+	}{
+		{"true", lib, "a keyword"},
+		{"null", lib, "a keyword"},
+		{"AND", lib, "a keyword"},
+		{"NOT", lib, "a keyword"},
+		{"cache", lib, "handled by the evaluator"},
+		{"", lib, "not an identifier"},
+		{"1st", lib, "not an identifier"},
+		{"my.lib", lib, "not an identifier"},
+		{"my-lib", lib, "not an identifier"},
+		{"mine", nil, "nil"},
+		{"math", lib, "already registered"},
+		{"regex", lib, "already registered"},
+	}
+	for _, tt := range tests {
+		e := NewEnvironment()
+		before := e.Libraries[tt.name]
+		if err := e.RegisterLibrary(tt.name, tt.lib); err == nil {
+			t.Errorf("registered %q, which is %s", tt.name, tt.why)
+		}
+		if e.Libraries[tt.name] != before {
+			t.Errorf("a failed registration of %q replaced the library", tt.name)
+		}
+	}
+}
+
+func TestMustRegisterPanicsOnDuplicate(t *testing.T) {
+	e := NewEnvironment()
+	defer func() {
+		if recover() == nil {
+			t.Error("MustRegister registered a duplicate library")
+		}
+	}()
+	e.MustRegister("math", e.Libraries["string"])
+}
+
+func TestUnregisterBuiltin(t *testing.T) {
+	e := NewEnvironment()
+	if !e.Unregister("time") {
+		t.Fatal("Unregister(time) found no library")
+	}
+	if _, ok := e.GetLibrary("time"); ok {
+		t.Error("time is still registered")
+	}
+	if _, ok := e.FunctionCapabilities["time.now"]; ok {
+		t.Error("the capability of time.now was kept")
+	}
+	if e.Unregister("time") {
+		t.Error("Unregister(time) succeeded twice")
+	}
+	// The name is free for a replacement.
+	replacement := NewEnvironment().Libraries["time"]
+	if err := e.RegisterLibrary("time", replacement); err != nil {
+		t.Fatalf("registering a replacement: %v", err)
+	}
+	if lib, _ := e.GetLibrary("time"); lib != replacement {
+		t.Error("the replacement is not registered")
+	}
+	if e.Unregister("nosuchlib") {
+		t.Error("Unregister reported an unknown library")
+	}
+}
+
+func TestNewEnvironmentWith(t *testing.T) {
+	math := NewEnvironment().Libraries["math"]
+	e, err := NewEnvironmentWith(WithoutLibraries("regex", "jwt"), WithLibrary("m", math))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"regex", "jwt"} {
+		if _, ok := e.GetLibrary(name); ok {
+			t.Errorf("%s is still registered", name)
+		}
+	}
+	if lib, _ := e.GetLibrary("m"); lib != math {
+		t.Error("m is not registered")
+	}
+	if _, err := NewEnvironmentWith(WithoutLibraries("nosuchlib")); err == nil {
+		t.Error("unregistered an unknown library")
+	}
+	if _, err := NewEnvironmentWith(WithLibrary("cache", math)); err == nil {
+		t.Error("registered a reserved name")
+	}
+}
@@ -0,0 +1,190 @@
+package env
+
+import (
+	"fmt"
+	"github.com/SpecDrivenDesign/lql/pkg/errors"
+	"sync/atomic"
+	"time"
+)
+
+// Scope is the state of an evaluation that is not part of its context: the
+// named roots it reads beside the context, the variables bound by LET and
+// by expression arguments, the depth of the node being evaluated, and the
+// resources and metrics counted for the evaluation. Evaluators pass it
+// alongside the context. Binding a variable makes a new
+// Scope that shares the rest, so a binding costs the same whatever the size
+// of the context. A nil *Scope is the scope of an evaluation without roots.
+type Scope struct {
+	roots     map[string]interface{}
+	variables *variable
+	depth     *depthCounter
+	eval      *evaluation
+}
+
+// NewScope returns the scope of an evaluation that reads the named roots
+// beside its context, so that data from different sources stays apart:
+// $env.region reads field region of roots["env"] while $user reads the
+// context. A root takes precedence over a context field with the same name,
+// so request data cannot stand in for a root. $ alone is the context,
+// without the roots.
+func NewScope(roots map[string]interface{}) *Scope {
+	return &Scope{roots: roots}
+}
+
+// Roots returns the named roots of the scope.
+func (s *Scope) Roots() map[string]interface{} {
+	if s == nil {
+		return nil
+	}
+	return s.roots
+}
+
+// Lookup returns the root of the scope or field of ctx named name.
+func (s *Scope) Lookup(ctx map[string]interface{}, name string) (interface{}, bool) {
+	if s != nil {
+		if val, ok := s.roots[name]; ok {
+			return val, true
+		}
+	}
+	val, ok := ctx[name]
+	return val, ok
+}
+
+// variable is a binding made by LET, linked to the bindings in scope when
+// it was made.
+type variable struct {
+	name  string
+	value interface{}
+	outer *variable
+}
+
+// WithVariable returns a scope in which name is bound to value, shadowing
+// any variable of the same name in s. s itself is unchanged, so the binding
+// ends with the expression evaluated in the returned scope.
+func (s *Scope) WithVariable(name string, value interface{}) *Scope {
+	c := &Scope{}
+	if s != nil {
+		*c = *s
+	}
+	c.variables = &variable{name: name, value: value, outer: c.variables}
+	return c
+}
+
+// Variable returns the value of the innermost variable named name bound in
+// s by WithVariable.
+func (s *Scope) Variable(name string) (interface{}, bool) {
+	if s == nil {
+		return nil, false
+	}
+	for v := s.variables; v != nil; v = v.outer {
+		if v.name == name {
+			return v.value, true
+		}
+	}
+	return nil, false
+}
+
+// evaluation is what one evaluation counts against Limits and collects for
+// its metrics. All the scopes of the evaluation share it, including those of
+// branches evaluated on other goroutines, so that concurrent evaluations
+// with one environment each have a budget and metrics of their own.
+type evaluation struct {
+	nodes     atomic.Int64
+	allocated atomic.Int64
+	metrics   *metricsCollector
+}
+
+// StartEvaluation starts an evaluation in s. It returns the scope to
+// evaluate in, which counts the use of Limits and collects the metrics of
+// that evaluation alone, and true if FinishEvaluation must be called with
+// the scope when the evaluation ends. A scope that is already part of an
+// evaluation, as when a node evaluates its operands, is returned unchanged,
+// as is s when e has neither usage limits nor a metrics sink.
+func (e *Environment) StartEvaluation(s *Scope) (*Scope, bool) {
+	if (s != nil && s.eval != nil) || (e.Limits.MaxNodeEvaluations <= 0 && e.Limits.MaxAllocatedBytes <= 0 && e.Metrics == nil) {
+		return s, false
+	}
+	c := &Scope{}
+	if s != nil {
+		*c = *s
+	}
+	c.eval = &evaluation{}
+	if e.Metrics != nil {
+		c.eval.metrics = &metricsCollector{start: time.Now()}
+	}
+	return c, true
+}
+
+// FinishEvaluation ends the evaluation started by StartEvaluation and sends
+// its metrics to the sink.
+func (e *Environment) FinishEvaluation(s *Scope) {
+	m := s.eval.metrics
+	if m == nil {
+		return
+	}
+	m.metrics.WallTime = time.Since(m.start)
+	e.Metrics.Record(m.metrics)
+}
+
+// depthCounter is the depth of the node an evaluation is in. It is shared
+// by the scopes of one evaluation on one goroutine.
+type depthCounter struct {
+	depth int
+}
+
+// withDepth returns a copy of s that counts depth with counter.
+func (s *Scope) withDepth(counter *depthCounter) *Scope {
+	c := &Scope{}
+	if s != nil {
+		*c = *s
+	}
+	c.depth = counter
+	return c
+}
+
+// Descend counts the evaluation of node, one level below the node being
+// evaluated in s, against Limits.MaxDepth. It returns the scope to
+// evaluate node in; Ascend must be called with it when node has been
+// evaluated. Node types call Descend before Enter and Ascend after Leave.
+func (e *Environment) Descend(s *Scope, node Node) (*Scope, error) {
+	if e.Limits.MaxDepth <= 0 {
+		return s, nil
+	}
+	if s == nil || s.depth == nil {
+		s = s.withDepth(&depthCounter{})
+	}
+	line, column := node.Pos()
+	if err := e.CheckDepth(s.depth.depth+1, line, column); err != nil {
+		return nil, err
+	}
+	s.depth.depth++
+	return s, nil
+}
+
+// Ascend leaves the node entered by the Descend that returned s.
+func (e *Environment) Ascend(s *Scope) {
+	if e.Limits.MaxDepth <= 0 || s == nil || s.depth == nil {
+		return
+	}
+	s.depth.depth--
+}
+
+// CheckDepth checks a node at depth, the root being at depth 1, against
+// Limits.MaxDepth. Evaluators that know the depth of each node, such as
+// instruction programs, call it instead of Descend.
+func (e *Environment) CheckDepth(depth, line, column int) error {
+	if e.Limits.MaxDepth > 0 && depth > e.Limits.MaxDepth {
+		return errors.NewResourceLimitError(fmt.Sprintf("evaluation exceeded the depth limit of %d nested expressions", e.Limits.MaxDepth), line, column)
+	}
+	return nil
+}
+
+// Branch returns the scope in which another goroutine evaluates part of
+// the evaluation in s, counting its depth separately from the same
+// starting depth.
+func (s *Scope) Branch() *Scope {
+	if s == nil || s.depth == nil {
+		return s
+	}
+	return s.withDepth(&depthCounter{depth: s.depth.depth})
+}
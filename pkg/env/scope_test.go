@@ -0,0 +1,85 @@
+package env
+
+import "testing"
+
+func TestScopeVariables(t *testing.T) {
+	var outer *Scope
+	if _, ok := outer.Variable("x"); ok {
+		t.Fatal("nil scope has a variable")
+	}
+	x1 := outer.WithVariable("x", 1)
+	x2 := x1.WithVariable("x", 2)
+	y := x2.WithVariable("y", 3)
+	for _, tt := range []struct {
+		scope *Scope
+		name  string
+		want  interface{}
+		ok    bool
+	}{
+		{x1, "x", 1, true},
+		{x2, "x", 2, true},
+		{y, "x", 2, true},
+		{y, "y", 3, true},
+		{x2, "y", nil, false},
+	} {
+		got, ok := tt.scope.Variable(tt.name)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("Variable(%q) = %v, %v, want %v, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestScopeLookup(t *testing.T) {
+	ctx := map[string]interface{}{"user": "ctx", "region": "ctx"}
+	scope := NewScope(map[string]interface{}{"region": "root"})
+	if v, _ := scope.Lookup(ctx, "region"); v != "root" {
+		t.Errorf("root lookup = %v, want the root", v)
+	}
+	if v, _ := scope.Lookup(ctx, "user"); v != "ctx" {
+		t.Errorf("field lookup = %v, want the field", v)
+	}
+	if _, ok := scope.Lookup(ctx, "missing"); ok {
+		t.Error("lookup of a missing name succeeded")
+	}
+	var none *Scope
+	if v, _ := none.Lookup(ctx, "region"); v != "ctx" {
+		t.Errorf("nil scope lookup = %v, want the field", v)
+	}
+	// Variables bound later keep the roots.
+	if v, _ := scope.WithVariable("x", 1).Lookup(ctx, "region"); v != "root" {
+		t.Errorf("lookup after a binding = %v, want the root", v)
+	}
+	if len(ctx) != 2 {
+		t.Errorf("the context was modified: %v", ctx)
+	}
+}
+
+func TestScopeDepth(t *testing.T) {
+	e := NewEnvironment()
+	e.Limits.MaxDepth = 2
+	node := testNode{}
+	s1, err := e.Descend(nil, node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s2, err := e.Descend(s1, node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.Descend(s2.Branch(), node); err == nil {
+		t.Error("a branch at the limit descended")
+	}
+	if _, err := e.Descend(s2, node); err == nil {
+		t.Error("descended past the limit")
+	}
+	e.Ascend(s2)
+	if _, err := e.Descend(s1, node); err != nil {
+		t.Errorf("descend after ascending: %v", err)
+	}
+}
+
+type testNode struct{}
+
+func (testNode) Pos() (int, int) { return 1, 1 }
+
+func (testNode) String() string { return "node" }
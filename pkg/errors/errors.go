@@ -227,6 +227,152 @@ func NewArrayOutOfBoundsError(msg string, line, column int) error {
 	return &ArrayOutOfBoundsError{Msg: msg, Line: line, Column: column}
 }
 
+// CapabilityError
+type CapabilityError struct {
+	Msg    string
+	Line   int
+	Column int
+}
+
+func (e *CapabilityError) Error() string {
+	return fmt.Sprintf("CapabilityError: %s at line %d, column %d", e.Msg, e.Line, e.Column)
+}
+
+func (e *CapabilityError) GetLine() int   { return e.Line }
+func (e *CapabilityError) GetColumn() int { return e.Column }
+func (e *CapabilityError) Kind() string   { return "CapabilityError" }
+
+func NewCapabilityError(msg string, line, column int) error {
+	return &CapabilityError{Msg: msg, Line: line, Column: column}
+}
+
+// SecurityError
+type SecurityError struct {
+	Msg    string
+	Line   int
+	Column int
+}
+
+func (e *SecurityError) Error() string {
+	return fmt.Sprintf("SecurityError: %s at line %d, column %d", e.Msg, e.Line, e.Column)
+}
+
+func (e *SecurityError) GetLine() int   { return e.Line }
+func (e *SecurityError) GetColumn() int { return e.Column }
+func (e *SecurityError) Kind() string   { return "SecurityError" }
+
+func NewSecurityError(msg string, line, column int) error {
+	return &SecurityError{Msg: msg, Line: line, Column: column}
+}
+
+// ComplexityError
+type ComplexityError struct {
+	Msg    string
+	Line   int
+	Column int
+}
+
+func (e *ComplexityError) Error() string {
+	return fmt.Sprintf("ComplexityError: %s at line %d, column %d", e.Msg, e.Line, e.Column)
+}
+
+func (e *ComplexityError) GetLine() int   { return e.Line }
+func (e *ComplexityError) GetColumn() int { return e.Column }
+func (e *ComplexityError) Kind() string   { return "ComplexityError" }
+
+func NewComplexityError(msg string, line, column int) error {
+	return &ComplexityError{Msg: msg, Line: line, Column: column}
+}
+
+// ResourceLimitError
+type ResourceLimitError struct {
+	Msg    string
+	Line   int
+	Column int
+}
+
+func (e *ResourceLimitError) Error() string {
+	return fmt.Sprintf("ResourceLimitError: %s at line %d, column %d", e.Msg, e.Line, e.Column)
+}
+
+func (e *ResourceLimitError) GetLine() int   { return e.Line }
+func (e *ResourceLimitError) GetColumn() int { return e.Column }
+func (e *ResourceLimitError) Kind() string   { return "ResourceLimitError" }
+
+func NewResourceLimitError(msg string, line, column int) error {
+	return &ResourceLimitError{Msg: msg, Line: line, Column: column}
+}
+
+// TranslationError
+type TranslationError struct {
+	Msg    string
+	Line   int
+	Column int
+}
+
+func (e *TranslationError) Error() string {
+	return fmt.Sprintf("TranslationError: %s at line %d, column %d", e.Msg, e.Line, e.Column)
+}
+
+func (e *TranslationError) GetLine() int   { return e.Line }
+func (e *TranslationError) GetColumn() int { return e.Column }
+func (e *TranslationError) Kind() string   { return "TranslationError" }
+
+func NewTranslationError(msg string, line, column int) error {
+	return &TranslationError{Msg: msg, Line: line, Column: column}
+}
+
+// ContextError
+type ContextError struct {
+	Msg    string
+	Err    error
+	Line   int
+	Column int
+}
+
+func (e *ContextError) Error() string {
+	return fmt.Sprintf("ContextError: %s at line %d, column %d", e.Msg, e.Line, e.Column)
+}
+
+func (e *ContextError) Unwrap() error  { return e.Err }
+func (e *ContextError) GetLine() int   { return e.Line }
+func (e *ContextError) GetColumn() int { return e.Column }
+func (e *ContextError) Kind() string   { return "ContextError" }
+
+// NewContextError reports that a context provider failed with err.
+func NewContextError(msg string, err error, line, column int) error {
+	return &ContextError{Msg: msg, Err: err, Line: line, Column: column}
+}
+
+// AnnotatedError wraps an evaluation error with the metadata of the rule
+// or node that raised it. Its message, position and kind are those of the
+// wrapped error.
+type AnnotatedError struct {
+	Err      error
+	Metadata map[string]interface{}
+}
+
+func (e *AnnotatedError) Error() string { return e.Err.Error() }
+func (e *AnnotatedError) Unwrap() error { return e.Err }
+
+func (e *AnnotatedError) GetLine() int {
+	line, _ := GetErrorPosition(e.Err)
+	return line
+}
+
+func (e *AnnotatedError) GetColumn() int {
+	_, column := GetErrorPosition(e.Err)
+	return column
+}
+
+func (e *AnnotatedError) Kind() string {
+	var pe PositionalError
+	if stdErrors.As(e.Err, &pe) {
+		return pe.Kind()
+	}
+	return "Error"
+}
+
 // GetErrorContext returns a formatted error context string showing the line and a pointer to the error column.
 func GetErrorContext(expr string, errLine, errColumn int, colored bool) string {
 	lines := strings.Split(expr, "\n")
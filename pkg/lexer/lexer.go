@@ -1,13 +1,10 @@
 package lexer
 
 import (
-	"bytes"
-	"crypto"
-	"crypto/rand"
 	"crypto/rsa"
-	"crypto/sha256"
 	"encoding/binary"
 	"fmt"
+	"github.com/SpecDrivenDesign/lql/pkg/signing"
 	"github.com/SpecDrivenDesign/lql/pkg/tokens"
 	"strconv"
 	"strings"
@@ -30,6 +27,20 @@ type Lexer struct {
 	ch           byte
 	line         int
 	column       int
+	embedSource  bool
+	comments     []Comment
+
+	lexed     bool
+	tokenList []tokens.Token
+	lexErr    error
+}
+
+// Comment is a "#" comment skipped by the lexer. Text starts with the "#"
+// and excludes the line break.
+type Comment struct {
+	Text   string
+	Line   int
+	Column int
 }
 
 // NewLexer creates a new Lexer for the given input.
@@ -88,9 +99,12 @@ func (l *Lexer) skipWhitespace() {
 	}
 	// If a comment is encountered (line starts with "#"), skip until newline.
 	for l.ch == '#' {
+		start, line, column := l.position, l.line, l.column
 		for l.ch != '\n' && l.ch != 0 {
 			l.readChar()
 		}
+		text := strings.TrimRight(l.input[start:l.position], " \t\r")
+		l.comments = append(l.comments, Comment{Text: text, Line: line, Column: column})
 		// Skip the newline.
 		l.readChar()
 		// Skip any whitespace after the comment.
@@ -100,6 +114,11 @@ func (l *Lexer) skipWhitespace() {
 	}
 }
 
+// Comments returns the comments skipped so far, in source order.
+func (l *Lexer) Comments() []Comment {
+	return l.comments
+}
+
 // NextToken lexes and returns the next token.
 func (l *Lexer) NextToken() (tokens.Token, error) {
 	var tok tokens.Token
@@ -135,13 +154,19 @@ func (l *Lexer) NextToken() (tokens.Token, error) {
 		if l.peekChar() == '=' {
 			l.readChar()
 			tok = tokens.Token{Type: tokens.TokenEq, Literal: "==", Line: startLine, Column: startColumn}
+		} else if l.peekChar() == '~' {
+			l.readChar()
+			tok = tokens.Token{Type: tokens.TokenMatch, Literal: "=~", Line: startLine, Column: startColumn}
 		} else {
-			tok = tokens.Token{Type: tokens.TokenIllegal, Literal: string(l.ch), Line: startLine, Column: startColumn}
+			tok = tokens.Token{Type: tokens.TokenAssign, Literal: string(l.ch), Line: startLine, Column: startColumn}
 		}
 	case '!':
 		if l.peekChar() == '=' {
 			l.readChar()
 			tok = tokens.Token{Type: tokens.TokenNeq, Literal: "!=", Line: startLine, Column: startColumn}
+		} else if l.peekChar() == '~' {
+			l.readChar()
+			tok = tokens.Token{Type: tokens.TokenNotMatch, Literal: "!~", Line: startLine, Column: startColumn}
 		} else {
 			tok = tokens.Token{Type: tokens.TokenNot, Literal: string(l.ch), Line: startLine, Column: startColumn}
 		}
@@ -184,7 +209,12 @@ func (l *Lexer) NextToken() (tokens.Token, error) {
 	case ':':
 		tok = tokens.Token{Type: tokens.TokenColon, Literal: string(l.ch), Line: startLine, Column: startColumn}
 	case '.':
-		tok = tokens.Token{Type: tokens.TokenDot, Literal: string(l.ch), Line: startLine, Column: startColumn}
+		if l.peekChar() == '.' {
+			l.readChar()
+			tok = tokens.Token{Type: tokens.TokenDotDot, Literal: "..", Line: startLine, Column: startColumn}
+		} else {
+			tok = tokens.Token{Type: tokens.TokenDot, Literal: string(l.ch), Line: startLine, Column: startColumn}
+		}
 	case '?':
 		if l.peekChar() == '.' {
 			l.readChar()
@@ -192,6 +222,9 @@ func (l *Lexer) NextToken() (tokens.Token, error) {
 		} else if l.peekChar() == '[' {
 			l.readChar()
 			tok = tokens.Token{Type: tokens.TokenQuestionBracket, Literal: "?[", Line: startLine, Column: startColumn}
+		} else if l.peekChar() == ':' {
+			l.readChar()
+			tok = tokens.Token{Type: tokens.TokenQuestionColon, Literal: "?:", Line: startLine, Column: startColumn}
 		} else {
 			err := errors.NewLexicalError("Unexpected character: "+string(l.ch), startLine, startColumn)
 			tok = tokens.Token{Type: tokens.TokenIllegal, Literal: string(l.ch), Line: startLine, Column: startColumn}
@@ -374,35 +407,85 @@ func (l *Lexer) readString(quote byte) (string, error) {
 	return "", errors.NewLexicalError("Unclosed string literal", startLine, startColumn)
 }
 
+// SetEmbedSource controls whether ExportTokens prefixes the token data with
+// the original source text, allowing exec-time errors to render snippets.
+func (l *Lexer) SetEmbedSource(embed bool) {
+	l.embedSource = embed
+}
+
+// Tokens returns every token of the input with its position, ending with
+// the EOF token. The input is lexed once, on the first call, independently
+// of NextToken; later calls return the same slice, which callers must not
+// modify. Replay it through a TokenSliceStream to feed a parser.
+func (l *Lexer) Tokens() ([]tokens.Token, error) {
+	if !l.lexed {
+		l.lexed = true
+		fresh := NewLexer(l.input)
+		for {
+			tok, err := fresh.NextToken()
+			if err != nil {
+				l.lexErr = err
+				break
+			}
+			l.tokenList = append(l.tokenList, tok)
+			if tok.Type == tokens.TokenEof {
+				break
+			}
+		}
+	}
+	if l.lexErr != nil {
+		return nil, l.lexErr
+	}
+	return l.tokenList, nil
+}
+
+// ExportTokens encodes the tokens of the input as bytecode. It reads them
+// through Tokens, so it leaves NextToken undisturbed and shares the lex
+// pass with other users of Tokens.
+//
+// Literals are stored once each in a constant pool section, with varint
+// lengths, and tokens refer to them by varint index, so literals of any
+// length can be exported. Tokens with a fixed literal carry none.
 func (l *Lexer) ExportTokens() ([]byte, error) {
-	var buf bytes.Buffer
-	for {
-		tok, err := l.NextToken()
-		if err != nil {
+	toks, err := l.Tokens()
+	if err != nil {
+		return nil, err
+	}
+	var out []byte
+	if l.embedSource {
+		if out, err = tokens.AppendSection(out, tokens.SourceMagic, []byte(l.input)); err != nil {
 			return nil, err
 		}
+	}
+	var constants []string
+	index := make(map[string]uint64)
+	var body []byte
+	for _, tok := range toks {
 		code, ok := tokens.TokenTypeToByte[tok.Type]
 		if !ok {
 			return nil, fmt.Errorf("unknown token type: %v", tok.Type)
 		}
-		buf.WriteByte(code)
-
-		if fixed, exists := tokens.FixedTokenLiterals[tok.Type]; exists && tok.Literal == fixed {
-			// No literal data needed.
-		} else {
-			literalBytes := []byte(tok.Literal)
-			if len(literalBytes) > 255 {
-				return nil, fmt.Errorf("literal too long")
-			}
-			buf.WriteByte(byte(len(literalBytes)))
-			buf.Write(literalBytes)
+		body = append(body, code)
+		if _, fixed := tokens.FixedTokenLiterals[tok.Type]; fixed {
+			continue
 		}
-
-		if tok.Type == tokens.TokenEof {
-			break
+		i, ok := index[tok.Literal]
+		if !ok {
+			i = uint64(len(constants))
+			index[tok.Literal] = i
+			constants = append(constants, tok.Literal)
 		}
+		body = binary.AppendUvarint(body, i)
+	}
+	pool := binary.AppendUvarint(nil, uint64(len(constants)))
+	for _, constant := range constants {
+		pool = binary.AppendUvarint(pool, uint64(len(constant)))
+		pool = append(pool, constant...)
+	}
+	if out, err = tokens.AppendSection(out, tokens.ConstantPoolMagic, pool); err != nil {
+		return nil, err
 	}
-	return buf.Bytes(), nil
+	return append(out, body...), nil
 }
 
 func (l *Lexer) ExportTokensSigned(priv *rsa.PrivateKey) ([]byte, error) {
@@ -410,29 +493,7 @@ func (l *Lexer) ExportTokensSigned(priv *rsa.PrivateKey) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-
-	hash := sha256.Sum256(tokenData)
-	signature, err := rsa.SignPKCS1v15(rand.Reader, priv, crypto.SHA256, hash[:])
-	if err != nil {
-		return nil, err
-	}
-
-	if len(tokenData) > int(^uint32(0)) {
-		return nil, fmt.Errorf("token data length %d exceeds maximum allowed size", len(tokenData))
-	}
-
-	tokenLen := uint32(len(tokenData))
-
-	var buf bytes.Buffer
-	buf.WriteString(tokens.HeaderMagic)
-
-	if err := binary.Write(&buf, binary.LittleEndian, tokenLen); err != nil {
-		return nil, err
-	}
-	buf.Write(tokenData)
-	buf.Write(signature)
-
-	return buf.Bytes(), nil
+	return signing.SignTokenData(tokenData, priv)
 }
 
 // ExtractContextIdentifiers iterates through the token stream and returns any context identifiers.
@@ -453,13 +514,18 @@ func (l *Lexer) ExtractContextIdentifiers() ([]string, error) {
 			if err != nil {
 				return nil, err
 			}
-			for nextTok.Type != tokens.TokenEof && (nextTok.Type == tokens.TokenDot || nextTok.Type == tokens.TokenQuestionDot || nextTok.Type == tokens.TokenQuestionBracket || nextTok.Type == tokens.TokenLeftBracket || nextTok.Type == tokens.TokenRightBracket || nextTok.Type == tokens.TokenIdent || nextTok.Type == tokens.TokenString || nextTok.Type == tokens.TokenNumber) {
+			prevType := tokens.TokenDollar
+			for nextTok.Type != tokens.TokenEof && (nextTok.Type == tokens.TokenDot || nextTok.Type == tokens.TokenDotDot || nextTok.Type == tokens.TokenQuestionDot || nextTok.Type == tokens.TokenQuestionBracket || nextTok.Type == tokens.TokenLeftBracket || nextTok.Type == tokens.TokenRightBracket || nextTok.Type == tokens.TokenIdent || nextTok.Type == tokens.TokenString || nextTok.Type == tokens.TokenNumber || (nextTok.Type == tokens.TokenMultiply && (prevType == tokens.TokenLeftBracket || prevType == tokens.TokenQuestionBracket))) {
 				if nextTok.Type == tokens.TokenIdent || nextTok.Type == tokens.TokenString {
 					composed += "." + nextTok.Literal
 				}
-				if nextTok.Type == tokens.TokenNumber {
+				if nextTok.Type == tokens.TokenNumber || nextTok.Type == tokens.TokenMultiply {
 					composed += ".*"
 				}
+				if nextTok.Type == tokens.TokenDotDot {
+					composed += ".**"
+				}
+				prevType = nextTok.Type
 				nextTok, err = l.NextToken()
 
 			}
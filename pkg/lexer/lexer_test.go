@@ -0,0 +1,117 @@
+package lexer
+
+import (
+	"bytes"
+	"github.com/SpecDrivenDesign/lql/pkg/tokens"
+	"testing"
+)
+
+const tokensSource = "$user.age >= 18\n  AND string.upper('x') # done"
+
+// drain reads tokens from next up to and including EOF.
+func drain(t *testing.T, next func() (tokens.Token, error)) []tokens.Token {
+	t.Helper()
+	var toks []tokens.Token
+	for {
+		tok, err := next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		toks = append(toks, tok)
+		if tok.Type == tokens.TokenEof {
+			return toks
+		}
+	}
+}
+
+func TestTokens(t *testing.T) {
+	want := drain(t, NewLexer(tokensSource).NextToken)
+	l := NewLexer(tokensSource)
+	got, err := l.Tokens()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d tokens, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("token %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+	if last := got[len(got)-1]; last.Type != tokens.TokenEof {
+		t.Errorf("last token %v, want EOF", last.Type)
+	}
+	// Later calls share the first lex pass.
+	if again, _ := l.Tokens(); &again[0] != &got[0] {
+		t.Error("Tokens lexed the input again")
+	}
+	// NextToken is not disturbed.
+	if tok, err := l.NextToken(); err != nil || tok != want[0] {
+		t.Errorf("NextToken = %+v, %v; want %+v", tok, err, want[0])
+	}
+}
+
+func TestTokensError(t *testing.T) {
+	l := NewLexer(`$a == "unclosed`)
+	for i := 0; i < 2; i++ {
+		if toks, err := l.Tokens(); err == nil || toks != nil {
+			t.Errorf("call %d: got %v, %v; want the lex error", i, toks, err)
+		}
+	}
+	if _, err := l.ExportTokens(); err == nil {
+		t.Error("ExportTokens ignored the lex error")
+	}
+}
+
+func TestTokenSliceStream(t *testing.T) {
+	toks, err := NewLexer(tokensSource).Tokens()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Two streams replay the same slice independently.
+	a, b := NewTokenSliceStream(toks), NewTokenSliceStream(toks)
+	first, _ := a.NextToken()
+	if got := drain(t, b.NextToken); len(got) != len(toks) {
+		t.Errorf("replayed %d tokens, want %d", len(got), len(toks))
+	}
+	if second, _ := a.NextToken(); first != toks[0] || second != toks[1] {
+		t.Errorf("got %+v, %+v", first, second)
+	}
+
+	// Past the end, EOF repeats at the last token's position.
+	drain(t, a.NextToken)
+	last := toks[len(toks)-1]
+	for i := 0; i < 2; i++ {
+		if tok, err := a.NextToken(); err != nil || tok.Type != tokens.TokenEof || tok.Line != last.Line || tok.Column != last.Column {
+			t.Errorf("got %+v, %v past the end", tok, err)
+		}
+	}
+	a.Reset()
+	if tok, _ := a.NextToken(); tok != toks[0] {
+		t.Errorf("after Reset got %+v, want %+v", tok, toks[0])
+	}
+
+	if tok, err := NewTokenSliceStream(nil).NextToken(); err != nil || tok.Type != tokens.TokenEof {
+		t.Errorf("empty stream returned %+v, %v", tok, err)
+	}
+}
+
+func TestExportTokensUsesTokens(t *testing.T) {
+	l := NewLexer(tokensSource)
+	data, err := l.ExportTokens()
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := l.ExportTokens()
+	if err != nil || !bytes.Equal(again, data) {
+		t.Errorf("a second export differs: %v", err)
+	}
+	if fresh, _ := NewLexer(tokensSource).ExportTokens(); !bytes.Equal(fresh, data) {
+		t.Error("the export depends on earlier calls")
+	}
+	// Exporting leaves NextToken at the start of the input.
+	if tok, err := l.NextToken(); err != nil || tok.Type != tokens.TokenDollar || tok.Line != 1 || tok.Column != 1 {
+		t.Errorf("NextToken = %+v, %v after exporting", tok, err)
+	}
+}
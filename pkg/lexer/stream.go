@@ -0,0 +1,39 @@
+package lexer
+
+import (
+	"github.com/SpecDrivenDesign/lql/pkg/tokens"
+)
+
+// TokenSliceStream replays a slice of tokens, such as the one returned by
+// Lexer.Tokens, as a token stream. Several streams can replay the same
+// slice, so one lex pass can feed more than one parser.
+type TokenSliceStream struct {
+	toks []tokens.Token
+	pos  int
+}
+
+// NewTokenSliceStream returns a stream over toks.
+func NewTokenSliceStream(toks []tokens.Token) *TokenSliceStream {
+	return &TokenSliceStream{toks: toks}
+}
+
+// NextToken returns the next token of the slice. Past the end of the slice
+// it returns EOF tokens, positioned at the last token.
+func (s *TokenSliceStream) NextToken() (tokens.Token, error) {
+	if s.pos < len(s.toks) {
+		tok := s.toks[s.pos]
+		s.pos++
+		return tok, nil
+	}
+	eof := tokens.Token{Type: tokens.TokenEof}
+	if len(s.toks) > 0 {
+		last := s.toks[len(s.toks)-1]
+		eof.Line, eof.Column = last.Line, last.Column
+	}
+	return eof, nil
+}
+
+// Reset rewinds the stream to the first token.
+func (s *TokenSliceStream) Reset() {
+	s.pos = 0
+}
@@ -0,0 +1,131 @@
+// Package lint reports suspicious but valid constructs in parsed expressions.
+package lint
+
+import (
+	"fmt"
+	"github.com/SpecDrivenDesign/lql/pkg/ast"
+	"sort"
+	"strings"
+)
+
+// Severity is the importance of a diagnostic.
+type Severity int
+
+const (
+	SeverityInfo Severity = iota
+	SeverityWarning
+	SeverityError
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	}
+	return "info"
+}
+
+// ParseSeverity converts "info", "warning" or "error" to a Severity.
+func ParseSeverity(s string) (Severity, error) {
+	switch strings.ToLower(s) {
+	case "info":
+		return SeverityInfo, nil
+	case "warning", "warn":
+		return SeverityWarning, nil
+	case "error":
+		return SeverityError, nil
+	}
+	return 0, fmt.Errorf("unknown severity %q", s)
+}
+
+// MarshalText encodes the severity by name, so diagnostics serialize
+// readably to JSON and YAML.
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Diagnostic is one finding of a rule.
+type Diagnostic struct {
+	Rule     string   `json:"rule"`
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+	Line     int      `json:"line"`
+	Column   int      `json:"column"`
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("line %d, column %d: %s: %s (%s)", d.Line, d.Column, d.Severity, d.Message, d.Rule)
+}
+
+// Report records a finding at a source position.
+type Report func(line, column int, message string)
+
+// Rule is a single lint check. Check walks the expression and calls report
+// for every finding; the severity is filled in from the configuration.
+type Rule struct {
+	Name        string
+	Description string
+	Severity    Severity
+	Check       func(expr ast.Expression, report Report)
+}
+
+// Config selects the rules Lint runs.
+type Config struct {
+	// Rules replaces the built-in rules when non-nil.
+	Rules []Rule
+	// Disabled lists rule names to skip.
+	Disabled []string
+	// Severities overrides the default severity of rules by name.
+	Severities map[string]Severity
+}
+
+// Lint runs the configured rules over expr and returns their diagnostics
+// ordered by position.
+func Lint(expr ast.Expression, cfg Config) []Diagnostic {
+	rules := cfg.Rules
+	if rules == nil {
+		rules = DefaultRules()
+	}
+	disabled := make(map[string]bool, len(cfg.Disabled))
+	for _, name := range cfg.Disabled {
+		disabled[name] = true
+	}
+	var diagnostics []Diagnostic
+	for _, rule := range rules {
+		if disabled[rule.Name] {
+			continue
+		}
+		severity := rule.Severity
+		if s, ok := cfg.Severities[rule.Name]; ok {
+			severity = s
+		}
+		rule.Check(expr, func(line, column int, message string) {
+			diagnostics = append(diagnostics, Diagnostic{
+				Rule:     rule.Name,
+				Severity: severity,
+				Message:  message,
+				Line:     line,
+				Column:   column,
+			})
+		})
+	}
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		if diagnostics[i].Line != diagnostics[j].Line {
+			return diagnostics[i].Line < diagnostics[j].Line
+		}
+		return diagnostics[i].Column < diagnostics[j].Column
+	})
+	return diagnostics
+}
+
+// HasErrors reports whether any diagnostic has error severity.
+func HasErrors(diagnostics []Diagnostic) bool {
+	for _, d := range diagnostics {
+		if d.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
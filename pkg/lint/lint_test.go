@@ -0,0 +1,92 @@
+package lint
+
+import (
+	"github.com/SpecDrivenDesign/lql/pkg/ast"
+	"github.com/SpecDrivenDesign/lql/pkg/lexer"
+	"github.com/SpecDrivenDesign/lql/pkg/parser"
+	"strings"
+	"testing"
+)
+
+func parse(t *testing.T, src string) ast.Expression {
+	t.Helper()
+	p, err := parser.NewParser(lexer.NewLexer(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expr, err := p.ParseExpression()
+	if err != nil {
+		t.Fatalf("%s: %v", src, err)
+	}
+	return expr
+}
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		src          string
+		rule         string
+		line, column int
+		message      string
+	}{
+		{`1 < 2`, RuleConstantComparison, 1, 3, "'<' between constants is always true"},
+		{`[1, 2] == [1, 2]`, RuleConstantComparison, 1, 8, "'==' between constants is always true"},
+		{`$a.b != $a.b`, RuleConstantComparison, 1, 6, "'!=' compares $a.b with itself and is always false"},
+		{`$a > 1 AND $b AND $a > 1`, RuleDuplicateCondition, 1, 22, "condition $a > 1 is repeated in the same AND chain"},
+		{`$x OR ($y OR $x)`, RuleDuplicateCondition, 1, 14, "condition $x is repeated in the same OR chain"},
+		{`$a?.b.c == 1`, RuleOptionalChainContinue, 1, 7, "'.c' follows the optional access '?.b' and fails when it is null; use '?.c'"},
+		{`$items[*][regex.match("^a", $name)]`, RuleRegexInAggregate, 1, 11, "regular expression \"^a\" is evaluated once per element"},
+		{`$a =~ "("`, RuleInvalidRegex, 1, 7, "invalid regular expression: missing closing )"},
+		{`regex.replace($a, "[", "")`, RuleInvalidRegex, 1, 19, "invalid regular expression"},
+	}
+	for _, tt := range tests {
+		diagnostics := Lint(parse(t, tt.src), Config{})
+		if len(diagnostics) != 1 {
+			t.Errorf("%s: got %v, want one %s diagnostic", tt.src, diagnostics, tt.rule)
+			continue
+		}
+		d := diagnostics[0]
+		if d.Rule != tt.rule || d.Line != tt.line || d.Column != tt.column || !strings.Contains(d.Message, tt.message) {
+			t.Errorf("%s: got %s, want %s at %d:%d containing %q", tt.src, d, tt.rule, tt.line, tt.column, tt.message)
+		}
+	}
+}
+
+func TestCleanExpressions(t *testing.T) {
+	for _, src := range []string{
+		`$user.age >= 18 AND $user.country == "NL"`,
+		`$a?.b?.c == 1`,
+		`$items[*]?.name`,
+		`$a =~ "^[a-z]+$"`,
+		// The clock is read each time, so comparing it with itself is not
+		// constant.
+		`time.now() == time.now()`,
+		`$items[*][$re]`,
+	} {
+		if diagnostics := Lint(parse(t, src), Config{}); len(diagnostics) != 0 {
+			t.Errorf("%s: got %v", src, diagnostics)
+		}
+	}
+}
+
+func TestConfig(t *testing.T) {
+	expr := parse(t, `$a == $a AND $a =~ "("`)
+	if got := Lint(expr, Config{}); len(got) != 2 || !HasErrors(got) {
+		t.Fatalf("got %v", got)
+	}
+	got := Lint(expr, Config{
+		Disabled:   []string{RuleConstantComparison},
+		Severities: map[string]Severity{RuleInvalidRegex: SeverityWarning},
+	})
+	if len(got) != 1 || got[0].Rule != RuleInvalidRegex || got[0].Severity != SeverityWarning || HasErrors(got) {
+		t.Errorf("got %v", got)
+	}
+	custom := Rule{Name: "no-or", Severity: SeverityInfo, Check: func(expr ast.Expression, report Report) {
+		if strings.Contains(expr.String(), " OR ") {
+			report(1, 1, "OR is not allowed")
+		}
+	}}
+	got = Lint(parse(t, `$a OR $a`), Config{Rules: []Rule{custom}})
+	if len(got) != 1 || got[0].Rule != "no-or" || got[0].Severity != SeverityInfo {
+		t.Errorf("got %v", got)
+	}
+}
@@ -0,0 +1,286 @@
+package lint
+
+import (
+	"fmt"
+	"github.com/SpecDrivenDesign/lql/pkg/analyze"
+	"github.com/SpecDrivenDesign/lql/pkg/ast"
+	"github.com/SpecDrivenDesign/lql/pkg/ast/expressions"
+	"github.com/SpecDrivenDesign/lql/pkg/env"
+	"github.com/SpecDrivenDesign/lql/pkg/tokens"
+	"regexp"
+	"strings"
+)
+
+// Names of the built-in rules.
+const (
+	RuleConstantComparison    = "constant-comparison"
+	RuleDuplicateCondition    = "duplicate-condition"
+	RuleOptionalChainContinue = "optional-chain-continuation"
+	RuleRegexInAggregate      = "regex-in-aggregate"
+	RuleInvalidRegex          = "invalid-regex"
+)
+
+// DefaultRules returns the built-in rules.
+func DefaultRules() []Rule {
+	return []Rule{
+		{
+			Name:        RuleConstantComparison,
+			Description: "comparison whose result is known without evaluating it",
+			Severity:    SeverityWarning,
+			Check:       checkConstantComparison,
+		},
+		{
+			Name:        RuleDuplicateCondition,
+			Description: "operand repeated in the same AND or OR chain",
+			Severity:    SeverityWarning,
+			Check:       checkDuplicateCondition,
+		},
+		{
+			Name:        RuleOptionalChainContinue,
+			Description: "non-optional access after ?., which fails when the optional value is null",
+			Severity:    SeverityWarning,
+			Check:       checkOptionalChainContinuation,
+		},
+		{
+			Name:        RuleRegexInAggregate,
+			Description: "regular expression evaluated once per element of a [*] projection",
+			Severity:    SeverityWarning,
+			Check:       checkRegexInAggregate,
+		},
+		{
+			Name:        RuleInvalidRegex,
+			Description: "literal regular expression that does not compile",
+			Severity:    SeverityError,
+			Check:       checkInvalidRegex,
+		},
+	}
+}
+
+// comparisonOperators lists the operators checked by constant-comparison,
+// with the result of comparing a value to itself.
+var comparisonOperators = map[tokens.TokenType]bool{
+	tokens.TokenEq:  true,
+	tokens.TokenNeq: false,
+	tokens.TokenLt:  false,
+	tokens.TokenLte: true,
+	tokens.TokenGt:  false,
+	tokens.TokenGte: true,
+}
+
+// defaultEnv decides which calls are deterministic and evaluates
+// comparisons between constants.
+var defaultEnv = env.NewEnvironment()
+
+func checkConstantComparison(expr ast.Expression, report Report) {
+	ast.Inspect(expr, func(node ast.Expression) bool {
+		b, ok := node.(*expressions.BinaryExpr)
+		if !ok {
+			return true
+		}
+		self, ok := comparisonOperators[b.Operator]
+		if !ok {
+			return true
+		}
+		op := tokens.FixedTokenLiterals[b.Operator]
+		switch {
+		case isConstant(b.Left) && isConstant(b.Right):
+			result, err := b.Eval(nil, defaultEnv)
+			if value, ok := result.(bool); ok && err == nil {
+				report(b.Line, b.Column, fmt.Sprintf("'%s' between constants is always %t", op, value))
+			}
+		case ast.Equal(b.Left, b.Right) && deterministic(b.Left):
+			report(b.Line, b.Column, fmt.Sprintf("'%s' compares %s with itself and is always %t", op, b.Left.String(), self))
+		}
+		return true
+	})
+}
+
+func checkDuplicateCondition(expr ast.Expression, report Report) {
+	var walk func(ast.Expression)
+	walk = func(node ast.Expression) {
+		b, ok := node.(*expressions.BinaryExpr)
+		if !ok || (b.Operator != tokens.TokenAnd && b.Operator != tokens.TokenOr) {
+			for _, child := range ast.Children(node) {
+				walk(child)
+			}
+			return
+		}
+		operands := chainOperands(b)
+		for i, operand := range operands {
+			for _, earlier := range operands[:i] {
+				if ast.Equal(operand, earlier) {
+					line, column := operand.Pos()
+					report(line, column, fmt.Sprintf("condition %s is repeated in the same %s chain", operand.String(), tokens.FixedTokenLiterals[b.Operator]))
+					break
+				}
+			}
+			walk(operand)
+		}
+	}
+	walk(expr)
+}
+
+// chainOperands flattens nested uses of a logical operator.
+func chainOperands(b *expressions.BinaryExpr) []ast.Expression {
+	var operands []ast.Expression
+	var collect func(ast.Expression)
+	collect = func(x ast.Expression) {
+		if inner, ok := x.(*expressions.BinaryExpr); ok && inner.Operator == b.Operator {
+			collect(inner.Left)
+			collect(inner.Right)
+			return
+		}
+		operands = append(operands, x)
+	}
+	collect(b)
+	return operands
+}
+
+func checkOptionalChainContinuation(expr ast.Expression, report Report) {
+	ast.Inspect(expr, func(node ast.Expression) bool {
+		access, ok := node.(*expressions.MemberAccessExpr)
+		if !ok {
+			return true
+		}
+		var optional *expressions.MemberPart
+		for i := range access.AccessParts {
+			part := &access.AccessParts[i]
+			if part.Wildcard && part.Optional {
+				// Parts after an optional projection are all null-safe.
+				break
+			}
+			if part.Optional {
+				optional = part
+				continue
+			}
+			if optional == nil || part.Wildcard || part.Recursive {
+				continue
+			}
+			report(part.Line, part.Column, fmt.Sprintf("%s follows the optional access %s and fails when it is null; use %s",
+				partString(*part, false), partString(*optional, true), partString(*part, true)))
+		}
+		return true
+	})
+}
+
+// partString renders a member access part as written in source.
+func partString(part expressions.MemberPart, optional bool) string {
+	if part.IsIndex {
+		s := "[" + part.Expr.String() + "]"
+		if optional {
+			return "'?" + s + "'"
+		}
+		return "'" + s + "'"
+	}
+	if optional {
+		return "'?." + part.Key + "'"
+	}
+	return "'." + part.Key + "'"
+}
+
+func checkRegexInAggregate(expr ast.Expression, report Report) {
+	ast.Inspect(expr, func(node ast.Expression) bool {
+		access, ok := node.(*expressions.MemberAccessExpr)
+		if !ok {
+			return true
+		}
+		projected := false
+		for _, part := range access.AccessParts {
+			if part.Wildcard {
+				projected = true
+				continue
+			}
+			if !projected || !part.IsIndex {
+				continue
+			}
+			ast.Inspect(part.Expr, func(inner ast.Expression) bool {
+				if pattern, ok := regexPattern(inner); ok {
+					line, column := inner.Pos()
+					report(line, column, fmt.Sprintf("regular expression %s is evaluated once per element of the [*] projection; compute it outside the projection", pattern.String()))
+				}
+				return true
+			})
+		}
+		return true
+	})
+}
+
+func checkInvalidRegex(expr ast.Expression, report Report) {
+	ast.Inspect(expr, func(node ast.Expression) bool {
+		pattern, ok := regexPattern(node)
+		if !ok {
+			return true
+		}
+		lit, ok := pattern.(*expressions.LiteralExpr)
+		if !ok {
+			return true
+		}
+		s, ok := lit.Value.(string)
+		if !ok {
+			return true
+		}
+		if _, err := regexp.Compile(s); err != nil {
+			report(lit.Line, lit.Column, fmt.Sprintf("invalid regular expression: %s", strings.TrimPrefix(err.Error(), "error parsing regexp: ")))
+		}
+		return true
+	})
+}
+
+// regexPattern returns the pattern operand of a regular expression match:
+// =~, !~ or a regex library call. LIKE patterns always compile and are not
+// included.
+func regexPattern(node ast.Expression) (ast.Expression, bool) {
+	switch e := node.(type) {
+	case *expressions.BinaryExpr:
+		if e.Operator == tokens.TokenMatch || e.Operator == tokens.TokenNotMatch {
+			return e.Right, true
+		}
+	case *expressions.FunctionCallExpr:
+		name := strings.Join(e.Namespace, ".")
+		switch {
+		case (name == "regex.match" || name == "regex.find") && len(e.Args) >= 1:
+			return e.Args[0], true
+		case name == "regex.replace" && len(e.Args) >= 2:
+			return e.Args[1], true
+		}
+	}
+	return nil, false
+}
+
+// isConstant reports whether expr is a literal, or an array or object
+// literal built only from constants.
+func isConstant(expr ast.Expression) bool {
+	switch e := expr.(type) {
+	case *expressions.LiteralExpr:
+		return true
+	case *expressions.UnaryExpr:
+		return isConstant(e.Expr)
+	case *expressions.ArrayLiteralExpr:
+		for _, elem := range e.Elements {
+			if !isConstant(elem) {
+				return false
+			}
+		}
+		return true
+	case *expressions.ObjectLiteralExpr:
+		for _, field := range e.Fields {
+			if field.KeyExpr != nil || !isConstant(field.Value) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// deterministic reports whether expr yields the same value each time it
+// is evaluated against the same context: it calls no function that reads
+// the clock or a random source, such as time.now, and no side-effect
+// library.
+func deterministic(expr ast.Expression) bool {
+	opts := analyze.PurityOptions{Libraries: make(map[string]analyze.Volatility)}
+	for lib := range defaultEnv.SideEffectLibraries {
+		opts.Libraries[lib] = analyze.NonDeterministic
+	}
+	return analyze.AnalyzePurity(expr, opts).Deterministic()
+}
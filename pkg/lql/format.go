@@ -0,0 +1,320 @@
+package lql
+
+import (
+	"github.com/SpecDrivenDesign/lql/pkg/ast"
+	"github.com/SpecDrivenDesign/lql/pkg/ast/expressions"
+	"github.com/SpecDrivenDesign/lql/pkg/lexer"
+	"github.com/SpecDrivenDesign/lql/pkg/parser"
+	"github.com/SpecDrivenDesign/lql/pkg/tokens"
+	"sort"
+	"strings"
+)
+
+// defaultFormatWidth is the line width used for multi-line formatting when
+// FormatOptions.MaxWidth is not set.
+const defaultFormatWidth = 80
+
+// FormatOptions controls the output of Format.
+type FormatOptions struct {
+	// Indent enables multi-line output when non-empty: AND/OR chains and
+	// array/object literals that do not fit in MaxWidth are broken across
+	// lines, indented by Indent per nesting level.
+	Indent string
+	// MaxWidth is the line width for multi-line output (default 80).
+	MaxWidth int
+}
+
+// precedence levels used when deciding where parentheses are required.
+const (
+	precUnary   = parser.PRODUCT + 1
+	precPrimary = precUnary + 1
+)
+
+// Format renders expr in canonical form: normalized spacing, upper-case
+// keywords, double-quoted strings, object keys in sorted order and only the
+// parentheses required by precedence. Equivalent expressions that differ only
+// in layout format identically.
+func Format(expr ast.Expression, opts FormatOptions) string {
+	if opts.Indent != "" && opts.MaxWidth <= 0 {
+		opts.MaxWidth = defaultFormatWidth
+	}
+	f := &formatter{opts: opts}
+	return f.format(expr, 0)
+}
+
+// FormatSource parses src and returns its canonical rendering.
+func FormatSource(src string, opts FormatOptions) (string, error) {
+	p, err := parser.NewParser(lexer.NewLexer(src))
+	if err != nil {
+		return "", err
+	}
+	expr, err := p.ParseExpression()
+	if err != nil {
+		return "", err
+	}
+	return Format(expr, opts), nil
+}
+
+type formatter struct {
+	opts FormatOptions
+}
+
+func (f *formatter) multiline() bool {
+	return f.opts.Indent != ""
+}
+
+func (f *formatter) pad(depth int) string {
+	return strings.Repeat(f.opts.Indent, depth)
+}
+
+// flat renders expr on a single line.
+func (f *formatter) flat(expr ast.Expression) string {
+	single := &formatter{}
+	return single.format(expr, 0)
+}
+
+// fits reports whether the single-line rendering fits at the given depth.
+func (f *formatter) fits(s string, depth int) bool {
+	return len(f.pad(depth))+len(s) <= f.opts.MaxWidth
+}
+
+func (f *formatter) format(expr ast.Expression, depth int) string {
+	switch e := expr.(type) {
+	case *expressions.LiteralExpr:
+		if lit, err := FormatLiteral(e.Value); err == nil {
+			return lit
+		}
+		return e.String()
+
+	case *expressions.ContextExpr:
+		if e.Ident != nil {
+			return "$" + e.Ident.Name
+		}
+		if e.Subscript != nil {
+			return "$[" + f.format(e.Subscript, depth) + "]"
+		}
+		return "$"
+
+	case *expressions.BinaryExpr:
+		if e.Operator == tokens.TokenAnd || e.Operator == tokens.TokenOr {
+			return f.formatChain(e, depth)
+		}
+		prec := binaryPrecedence(e.Operator)
+		return f.operand(e.Left, prec, depth) + " " + tokens.FixedTokenLiterals[e.Operator] + " " + f.operand(e.Right, prec+1, depth)
+
+	case *expressions.LikeExpr:
+		return f.operand(e.Subject, parser.GTR, depth) + " LIKE " + f.operand(e.Pattern, parser.GTR+1, depth)
+
+	case *expressions.BetweenExpr:
+		return f.operand(e.Subject, parser.GTR, depth) + " BETWEEN " + f.operand(e.Low, parser.GTR+1, depth) + " AND " + f.operand(e.High, parser.GTR+1, depth)
+
+	case *expressions.CustomInfixExpr:
+		return f.operand(e.Left, e.Precedence, depth) + " " + e.Keyword + " " + f.operand(e.Right, e.Precedence+1, depth)
+
+	case *expressions.UnaryExpr:
+		op := tokens.FixedTokenLiterals[e.Operator]
+		operand := f.operand(e.Expr, precUnary, depth)
+		if e.Operator == tokens.TokenNot || strings.HasPrefix(operand, "-") {
+			op += " "
+		}
+		return op + operand
+
+	case *expressions.CustomPrefixExpr:
+		return e.Keyword + " " + f.operand(e.Expr, precUnary, depth)
+
+	case *expressions.DefaultExpr:
+		return f.operand(e.Expr, precPrimary, depth) + " ?: " + f.operand(e.Fallback, precUnary, depth)
+
+	case *expressions.LetExpr:
+		return "LET " + e.Name + " = " + f.format(e.Value, depth) + " IN " + f.format(e.Body, depth)
+
+	case *expressions.MemberAccessExpr:
+		var sb strings.Builder
+		sb.WriteString(f.operand(e.Target, precPrimary, depth))
+		for _, part := range e.AccessParts {
+			switch {
+			case part.Recursive:
+				sb.WriteString(".." + formatKey(part.Key))
+			case part.Wildcard:
+				sb.WriteString(optionalPrefix(part.Optional) + "[*]")
+			case part.IsIndex:
+				sb.WriteString(optionalPrefix(part.Optional) + "[" + f.format(part.Expr, depth) + "]")
+			default:
+				if part.Optional {
+					sb.WriteString("?." + formatKey(part.Key))
+				} else {
+					sb.WriteString("." + formatKey(part.Key))
+				}
+			}
+		}
+		return sb.String()
+
+	case *expressions.FunctionCallExpr:
+		args := make([]string, len(e.Args))
+		for i, arg := range e.Args {
+			args[i] = f.format(arg, depth)
+		}
+		return strings.Join(e.Namespace, ".") + "(" + strings.Join(args, ", ") + ")"
+
+	case *expressions.ArrayLiteralExpr:
+		return f.formatList("[", "]", len(e.Elements), func(i, d int) string {
+			return f.format(e.Elements[i], d)
+		}, expr, depth)
+
+	case *expressions.ObjectLiteralExpr:
+		// Static keys are sorted; computed keys follow in author order since
+		// their evaluation order is observable.
+		fields := make([]expressions.ObjectField, len(e.Fields))
+		copy(fields, e.Fields)
+		sort.SliceStable(fields, func(i, j int) bool {
+			if fields[i].KeyExpr != nil || fields[j].KeyExpr != nil {
+				return fields[i].KeyExpr == nil && fields[j].KeyExpr != nil
+			}
+			return fields[i].Key < fields[j].Key
+		})
+		return f.formatList("{", "}", len(fields), func(i, d int) string {
+			field := fields[i]
+			if field.KeyExpr != nil {
+				return "[" + f.format(field.KeyExpr, d) + "]: " + f.format(field.Value, d)
+			}
+			return formatKey(field.Key) + ": " + f.format(field.Value, d)
+		}, expr, depth)
+	}
+	return expr.String()
+}
+
+// formatChain renders a chain of the same logical operator, flattening
+// nested groups of that operator since AND and OR are associative.
+func (f *formatter) formatChain(e *expressions.BinaryExpr, depth int) string {
+	var operands []ast.Expression
+	var collect func(ast.Expression)
+	collect = func(x ast.Expression) {
+		if b, ok := x.(*expressions.BinaryExpr); ok && b.Operator == e.Operator {
+			collect(b.Left)
+			collect(b.Right)
+			return
+		}
+		operands = append(operands, x)
+	}
+	collect(e)
+
+	op := tokens.FixedTokenLiterals[e.Operator]
+	prec := binaryPrecedence(e.Operator)
+	sep := " " + op + " "
+	if f.multiline() {
+		if flat := f.flat(e); !f.fits(flat, depth) {
+			sep = "\n" + f.pad(depth) + op + " "
+		}
+	}
+	parts := make([]string, len(operands))
+	for i, operand := range operands {
+		parts[i] = f.operand(operand, prec+1, depth)
+	}
+	return strings.Join(parts, sep)
+}
+
+// formatList renders n bracketed items, one per line if they do not fit.
+func (f *formatter) formatList(open, close string, n int, item func(i, depth int) string, expr ast.Expression, depth int) string {
+	if n == 0 {
+		return open + close
+	}
+	if f.multiline() {
+		if flat := f.flat(expr); !f.fits(flat, depth) {
+			lines := make([]string, n)
+			for i := 0; i < n; i++ {
+				lines[i] = f.pad(depth+1) + item(i, depth+1)
+			}
+			return open + "\n" + strings.Join(lines, ",\n") + "\n" + f.pad(depth) + close
+		}
+	}
+	parts := make([]string, n)
+	for i := 0; i < n; i++ {
+		parts[i] = item(i, depth)
+	}
+	return open + strings.Join(parts, ", ") + close
+}
+
+// operand renders a child expression, parenthesizing it when it binds less
+// tightly than minPrec.
+func (f *formatter) operand(expr ast.Expression, minPrec, depth int) string {
+	if precedenceOf(expr) >= minPrec {
+		return f.format(expr, depth)
+	}
+	if f.multiline() {
+		inner := f.format(expr, depth+1)
+		if strings.Contains(inner, "\n") {
+			return "(\n" + f.pad(depth+1) + inner + "\n" + f.pad(depth) + ")"
+		}
+		return "(" + inner + ")"
+	}
+	return "(" + f.format(expr, depth) + ")"
+}
+
+func precedenceOf(expr ast.Expression) int {
+	switch e := expr.(type) {
+	case *expressions.BinaryExpr:
+		return binaryPrecedence(e.Operator)
+	case *expressions.LikeExpr, *expressions.BetweenExpr:
+		return parser.GTR
+	case *expressions.CustomInfixExpr:
+		return e.Precedence
+	case *expressions.UnaryExpr, *expressions.CustomPrefixExpr, *expressions.DefaultExpr:
+		return precUnary
+	case *expressions.LetExpr:
+		return parser.LOWEST
+	}
+	return precPrimary
+}
+
+func binaryPrecedence(op tokens.TokenType) int {
+	switch op {
+	case tokens.TokenOr:
+		return parser.OR
+	case tokens.TokenAnd:
+		return parser.AND
+	case tokens.TokenEq, tokens.TokenNeq, tokens.TokenMatch, tokens.TokenNotMatch:
+		return parser.EQUALS
+	case tokens.TokenLt, tokens.TokenGt, tokens.TokenLte, tokens.TokenGte:
+		return parser.GTR
+	case tokens.TokenPlus, tokens.TokenMinus:
+		return parser.SUM
+	case tokens.TokenMultiply, tokens.TokenDivide:
+		return parser.PRODUCT
+	}
+	return precPrimary
+}
+
+func optionalPrefix(optional bool) string {
+	if optional {
+		return "?"
+	}
+	return ""
+}
+
+// formatKey renders an object or member key bare when it is a plain
+// identifier, and quoted otherwise.
+func formatKey(key string) string {
+	if isBareKey(key) {
+		return key
+	}
+	return QuoteString(key)
+}
+
+func isBareKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	switch key {
+	case "true", "false", "null", "AND", "OR", "NOT":
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		ch := key[i]
+		letter := ('a' <= ch && ch <= 'z') || ('A' <= ch && ch <= 'Z') || ch == '_'
+		digit := '0' <= ch && ch <= '9'
+		if !letter && !(digit && i > 0) {
+			return false
+		}
+	}
+	return true
+}
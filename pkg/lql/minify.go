@@ -0,0 +1,110 @@
+package lql
+
+import (
+	"github.com/SpecDrivenDesign/lql/pkg/ast"
+	"github.com/SpecDrivenDesign/lql/pkg/lexer"
+	"github.com/SpecDrivenDesign/lql/pkg/parser"
+	"github.com/SpecDrivenDesign/lql/pkg/tokens"
+	"strings"
+)
+
+// Minify renders expr as the shortest source that parses to the same
+// expression, for embedding in headers, URLs and signed tokens. It starts
+// from the canonical form, which has only the parentheses precedence
+// requires, writes AND, OR and NOT as &&, || and !, picks whichever quote
+// needs fewer escapes for each string, and drops every space that does not
+// separate two tokens.
+func Minify(expr ast.Expression) string {
+	src := Format(expr, FormatOptions{})
+	l := lexer.NewLexer(src)
+	var sb strings.Builder
+	prev := ""
+	for {
+		tok, err := l.NextToken()
+		if err != nil {
+			// The canonical form always lexes; fall back to it regardless.
+			return src
+		}
+		if tok.Type == tokens.TokenEof {
+			break
+		}
+		text := minifyToken(tok)
+		if prev != "" && !separate(prev, text) {
+			sb.WriteByte(' ')
+		}
+		sb.WriteString(text)
+		prev = text
+	}
+	return sb.String()
+}
+
+// MinifySource parses src and returns its minified rendering.
+func MinifySource(src string) (string, error) {
+	p, err := parser.NewParser(lexer.NewLexer(src))
+	if err != nil {
+		return "", err
+	}
+	expr, err := p.ParseExpression()
+	if err != nil {
+		return "", err
+	}
+	return Minify(expr), nil
+}
+
+// minifyToken returns the shortest spelling of tok.
+func minifyToken(tok tokens.Token) string {
+	switch tok.Type {
+	case tokens.TokenAnd:
+		return "&&"
+	case tokens.TokenOr:
+		return "||"
+	case tokens.TokenNot:
+		return "!"
+	case tokens.TokenString:
+		double := QuoteString(tok.Literal)
+		if !strings.Contains(tok.Literal, `"`) {
+			return double
+		}
+		// Single quotes avoid escaping double quotes, at the cost of
+		// escaping single ones.
+		single := "'" + strings.NewReplacer(`\"`, `"`, `'`, `\'`).Replace(double[1:len(double)-1]) + "'"
+		if len(single) < len(double) {
+			return single
+		}
+		return double
+	case tokens.TokenDollar:
+		return "$"
+	}
+	return tok.Literal
+}
+
+// separate reports whether a and b still lex as the same two tokens when
+// written without a space between them.
+func separate(a, b string) bool {
+	want := lexTypes(a + " " + b)
+	got := lexTypes(a + b)
+	if want == nil || len(got) != len(want) {
+		return false
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func lexTypes(src string) []tokens.TokenType {
+	l := lexer.NewLexer(src)
+	var types []tokens.TokenType
+	for {
+		tok, err := l.NextToken()
+		if err != nil {
+			return nil
+		}
+		if tok.Type == tokens.TokenEof {
+			return types
+		}
+		types = append(types, tok.Type)
+	}
+}
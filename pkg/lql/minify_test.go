@@ -0,0 +1,55 @@
+package lql
+
+import (
+	"github.com/SpecDrivenDesign/lql/pkg/ast"
+	"testing"
+)
+
+func TestMinifyRoundTrip(t *testing.T) {
+	for _, src := range roundTripSources {
+		expr := parseExpr(t, src)
+		out := Minify(expr)
+		if got, want := ast.Fingerprint(parseExpr(t, out)), ast.Fingerprint(expr); got != want {
+			t.Errorf("%s minified to %s, which parses differently", src, out)
+		}
+		if len(out) > len(Format(expr, FormatOptions{})) {
+			t.Errorf("%s minified to %s, longer than its canonical form", src, out)
+		}
+		if again := Minify(parseExpr(t, out)); again != out {
+			t.Errorf("%s: minifying is not idempotent: %s, then %s", src, out, again)
+		}
+	}
+}
+
+func TestMinify(t *testing.T) {
+	tests := []struct {
+		src, want string
+	}{
+		{`$a + $b * $c`, `$a+$b*$c`},
+		{`($a + $b) * $c`, `($a+$b)*$c`},
+		{`(($a)) AND NOT ($b OR $c)`, `$a&&!($b||$c)`},
+		{`$a - -1`, `$a--1`},
+		{`NOT NOT $a`, `!!$a`},
+		{`$a   LIKE   "x%"`, `$a LIKE"x%"`},
+		{`$s == "say \"hi\""`, `$s=='say "hi"'`},
+		{`$s == 'it\'s'`, `$s=="it's"`},
+		{`$a.b[0]?.c ?: {"k": [1, 2]}`, `$a.b[0]?.c?:{k:[1,2]}`},
+		{"# comment\n$a > 1 # more\n", `$a>1`},
+	}
+	for _, tt := range tests {
+		got, err := MinifySource(tt.src)
+		if err != nil {
+			t.Errorf("%s: %v", tt.src, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.src, got, tt.want)
+		}
+		if !ast.Equal(parseExpr(t, got), parseExpr(t, tt.src)) {
+			t.Errorf("%s minified to %s, which parses differently", tt.src, got)
+		}
+	}
+	if _, err := MinifySource(`$a >`); err == nil {
+		t.Error("a syntax error was accepted")
+	}
+}
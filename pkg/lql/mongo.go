@@ -0,0 +1,391 @@
+package lql
+
+import (
+	"fmt"
+	"github.com/SpecDrivenDesign/lql/pkg/ast"
+	"github.com/SpecDrivenDesign/lql/pkg/ast/expressions"
+	"github.com/SpecDrivenDesign/lql/pkg/errors"
+	"github.com/SpecDrivenDesign/lql/pkg/tokens"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// mongoOperators maps comparison operators to MongoDB query operators.
+var mongoOperators = map[tokens.TokenType]string{
+	tokens.TokenEq:  "$eq",
+	tokens.TokenNeq: "$ne",
+	tokens.TokenLt:  "$lt",
+	tokens.TokenLte: "$lte",
+	tokens.TokenGt:  "$gt",
+	tokens.TokenGte: "$gte",
+}
+
+// mirroredOperators gives the operator to use when the operands of a
+// comparison are swapped.
+var mirroredOperators = map[tokens.TokenType]tokens.TokenType{
+	tokens.TokenEq:  tokens.TokenEq,
+	tokens.TokenNeq: tokens.TokenNeq,
+	tokens.TokenLt:  tokens.TokenGt,
+	tokens.TokenLte: tokens.TokenGte,
+	tokens.TokenGt:  tokens.TokenLt,
+	tokens.TokenGte: tokens.TokenLte,
+}
+
+// ToMongoFilter translates a boolean expression into a MongoDB filter
+// document, so a list endpoint can push the filter down to the database.
+// Context fields become dotted field paths ($user.address.city is
+// "user.address.city"), and the result is built from plain maps and
+// slices that any BSON encoder accepts.
+//
+// Comparisons between a field and a literal, AND, OR, NOT, =~, !~, LIKE
+// with a literal pattern, bare boolean fields and a few library functions
+// (array.contains, string.startsWith, string.endsWith, string.contains and
+// cond.isFieldPresent) are supported; comparisons between two fields use
+// $expr. Anything else is reported with a TranslationError.
+func ToMongoFilter(expr ast.Expression) (map[string]interface{}, error) {
+	return mongoFilter(expr)
+}
+
+func mongoUnsupported(what string, line, column int) error {
+	return errors.NewTranslationError(fmt.Sprintf("%s has no MongoDB equivalent", what), line, column)
+}
+
+func mongoFilter(expr ast.Expression) (map[string]interface{}, error) {
+	switch e := expr.(type) {
+	case *expressions.LiteralExpr:
+		switch e.Value {
+		case true:
+			return map[string]interface{}{}, nil
+		case false:
+			return map[string]interface{}{"$expr": false}, nil
+		}
+
+	case *expressions.ContextExpr, *expressions.MemberAccessExpr:
+		path, err := mongoPath(expr)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{path: true}, nil
+
+	case *expressions.UnaryExpr:
+		if e.Operator != tokens.TokenNot {
+			break
+		}
+		inner, err := mongoFilter(e.Expr)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"$nor": []interface{}{inner}}, nil
+
+	case *expressions.BinaryExpr:
+		switch e.Operator {
+		case tokens.TokenAnd, tokens.TokenOr:
+			return mongoChain(e)
+		case tokens.TokenMatch, tokens.TokenNotMatch:
+			pattern, ok := stringLiteral(e.Right)
+			if !ok {
+				line, column := e.Right.Pos()
+				return nil, mongoUnsupported("a computed regular expression", line, column)
+			}
+			path, err := mongoPath(e.Left)
+			if err != nil {
+				return nil, err
+			}
+			condition := map[string]interface{}{"$regex": pattern}
+			if e.Operator == tokens.TokenNotMatch {
+				condition = map[string]interface{}{"$not": condition}
+			}
+			return map[string]interface{}{path: condition}, nil
+		}
+		if _, ok := mongoOperators[e.Operator]; ok {
+			return mongoComparison(e)
+		}
+
+	case *expressions.BetweenExpr:
+		return mongoFilter(e.Lowered())
+
+	case *expressions.LikeExpr:
+		pattern, ok := stringLiteral(e.Pattern)
+		if !ok {
+			line, column := e.Pattern.Pos()
+			return nil, mongoUnsupported("LIKE with a computed pattern", line, column)
+		}
+		path, err := mongoPath(e.Subject)
+		if err != nil {
+			return nil, err
+		}
+		regex, err := expressions.LikePatternToRegex(pattern)
+		if err != nil {
+			line, column := e.Pattern.Pos()
+			return nil, errors.NewTypeError("LIKE operator: "+err.Error(), line, column)
+		}
+		regex = strings.TrimPrefix(regex, "(?s)")
+		return map[string]interface{}{path: map[string]interface{}{"$regex": regex, "$options": "s"}}, nil
+
+	case *expressions.FunctionCallExpr:
+		return mongoCall(e)
+	}
+	line, column := expr.Pos()
+	return nil, mongoUnsupported(fmt.Sprintf("expression %s", expr.String()), line, column)
+}
+
+// mongoChain flattens a chain of the same logical operator into one $and
+// or $or.
+func mongoChain(e *expressions.BinaryExpr) (map[string]interface{}, error) {
+	var clauses []interface{}
+	var collect func(ast.Expression) error
+	collect = func(x ast.Expression) error {
+		if b, ok := x.(*expressions.BinaryExpr); ok && b.Operator == e.Operator {
+			if err := collect(b.Left); err != nil {
+				return err
+			}
+			return collect(b.Right)
+		}
+		clause, err := mongoFilter(x)
+		if err != nil {
+			return err
+		}
+		clauses = append(clauses, clause)
+		return nil
+	}
+	if err := collect(e); err != nil {
+		return nil, err
+	}
+	op := "$and"
+	if e.Operator == tokens.TokenOr {
+		op = "$or"
+	}
+	return map[string]interface{}{op: clauses}, nil
+}
+
+func mongoComparison(e *expressions.BinaryExpr) (map[string]interface{}, error) {
+	op := e.Operator
+	left, right := e.Left, e.Right
+	if isFieldRef(right) && !isFieldRef(left) {
+		left, right = right, left
+		op = mirroredOperators[op]
+	}
+	path, err := mongoPath(left)
+	if err != nil {
+		return nil, err
+	}
+	if isFieldRef(right) {
+		other, err := mongoPath(right)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{
+			"$expr": map[string]interface{}{mongoOperators[op]: []interface{}{"$" + path, "$" + other}},
+		}, nil
+	}
+	value, err := mongoValue(right)
+	if err != nil {
+		return nil, err
+	}
+	if _, isObject := value.(map[string]interface{}); op == tokens.TokenEq && !isObject {
+		return map[string]interface{}{path: value}, nil
+	}
+	return map[string]interface{}{path: map[string]interface{}{mongoOperators[op]: value}}, nil
+}
+
+func mongoCall(e *expressions.FunctionCallExpr) (map[string]interface{}, error) {
+	name := strings.Join(e.Namespace, ".")
+	switch {
+	case name == "array.contains" && len(e.Args) == 2:
+		if isFieldRef(e.Args[0]) {
+			// A query on an array field matches when any element does.
+			path, err := mongoPath(e.Args[0])
+			if err != nil {
+				return nil, err
+			}
+			value, err := mongoValue(e.Args[1])
+			if err != nil {
+				return nil, err
+			}
+			return map[string]interface{}{path: value}, nil
+		}
+		values, err := mongoValue(e.Args[0])
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := values.([]interface{}); !ok {
+			line, column := e.Args[0].Pos()
+			return nil, mongoUnsupported("array.contains on a non-array literal", line, column)
+		}
+		path, err := mongoPath(e.Args[1])
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{path: map[string]interface{}{"$in": values}}, nil
+
+	case (name == "string.startsWith" || name == "string.endsWith" || name == "string.contains") && len(e.Args) == 2:
+		path, err := mongoPath(e.Args[0])
+		if err != nil {
+			return nil, err
+		}
+		s, ok := stringLiteral(e.Args[1])
+		if !ok {
+			line, column := e.Args[1].Pos()
+			return nil, mongoUnsupported(name+" with a computed argument", line, column)
+		}
+		regex := regexp.QuoteMeta(s)
+		switch name {
+		case "string.startsWith":
+			regex = "^" + regex
+		case "string.endsWith":
+			regex += "$"
+		}
+		return map[string]interface{}{path: map[string]interface{}{"$regex": regex}}, nil
+
+	case name == "cond.isFieldPresent" && len(e.Args) == 2:
+		key, ok := stringLiteral(e.Args[1])
+		if !ok {
+			line, column := e.Args[1].Pos()
+			return nil, mongoUnsupported(name+" with a computed field name", line, column)
+		}
+		path := key
+		if ctxExpr, ok := e.Args[0].(*expressions.ContextExpr); !ok || ctxExpr.Ident != nil || ctxExpr.Subscript != nil {
+			base, err := mongoPath(e.Args[0])
+			if err != nil {
+				return nil, err
+			}
+			path = base + "." + key
+		}
+		if err := checkMongoKey(key, e.Args[1]); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{path: map[string]interface{}{"$exists": true}}, nil
+	}
+	return nil, mongoUnsupported(fmt.Sprintf("%s with %d argument(s)", name, len(e.Args)), e.Line, e.Column)
+}
+
+// isFieldRef reports whether expr reads a context field.
+func isFieldRef(expr ast.Expression) bool {
+	switch e := expr.(type) {
+	case *expressions.ContextExpr:
+		return e.Ident != nil
+	case *expressions.MemberAccessExpr:
+		return isFieldRef(e.Target)
+	}
+	return false
+}
+
+// mongoPath renders a context field reference as a dotted field path.
+// Array indexes must be integer literals; optional chaining is allowed since
+// MongoDB treats missing fields as null.
+func mongoPath(expr ast.Expression) (string, error) {
+	switch e := expr.(type) {
+	case *expressions.ContextExpr:
+		if e.Ident == nil {
+			return "", mongoUnsupported("the context root", e.Line, e.Column)
+		}
+		if err := checkMongoKey(e.Ident.Name, e); err != nil {
+			return "", err
+		}
+		return e.Ident.Name, nil
+
+	case *expressions.MemberAccessExpr:
+		path, err := mongoPath(e.Target)
+		if err != nil {
+			return "", err
+		}
+		for _, part := range e.AccessParts {
+			switch {
+			case part.Wildcard:
+				return "", mongoUnsupported("wildcard projection", part.Line, part.Column)
+			case part.Recursive:
+				return "", mongoUnsupported("recursive descent", part.Line, part.Column)
+			case part.IsIndex:
+				lit, ok := part.Expr.(*expressions.LiteralExpr)
+				if !ok {
+					return "", mongoUnsupported("a computed index", part.Line, part.Column)
+				}
+				switch v := lit.Value.(type) {
+				case int64:
+					if v < 0 {
+						return "", mongoUnsupported("a negative index", part.Line, part.Column)
+					}
+					path += "." + strconv.FormatInt(v, 10)
+				case string:
+					if err := checkMongoKey(v, lit); err != nil {
+						return "", err
+					}
+					path += "." + v
+				default:
+					return "", mongoUnsupported(fmt.Sprintf("index %s", lit.String()), part.Line, part.Column)
+				}
+			default:
+				if err := checkMongoKey(part.Key, expr); err != nil {
+					return "", err
+				}
+				path += "." + part.Key
+			}
+		}
+		return path, nil
+	}
+	line, column := expr.Pos()
+	return "", mongoUnsupported(fmt.Sprintf("field reference %s", expr.String()), line, column)
+}
+
+// checkMongoKey rejects keys that cannot appear in a dotted field path.
+func checkMongoKey(key string, at ast.Expression) error {
+	if key == "" || strings.Contains(key, ".") || strings.HasPrefix(key, "$") {
+		line, column := at.Pos()
+		return errors.NewTranslationError(fmt.Sprintf("field name %q cannot be used in a MongoDB field path", key), line, column)
+	}
+	return nil
+}
+
+// mongoValue converts a literal, or an array or object literal of
+// literals, to a filter value.
+func mongoValue(expr ast.Expression) (interface{}, error) {
+	switch e := expr.(type) {
+	case *expressions.LiteralExpr:
+		return e.Value, nil
+	case *expressions.UnaryExpr:
+		if lit, ok := e.Expr.(*expressions.LiteralExpr); ok && e.Operator == tokens.TokenMinus {
+			switch v := lit.Value.(type) {
+			case int64:
+				return -v, nil
+			case float64:
+				return -v, nil
+			}
+		}
+	case *expressions.ArrayLiteralExpr:
+		values := make([]interface{}, len(e.Elements))
+		for i, elem := range e.Elements {
+			v, err := mongoValue(elem)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = v
+		}
+		return values, nil
+	case *expressions.ObjectLiteralExpr:
+		values := make(map[string]interface{}, len(e.Fields))
+		for _, field := range e.Fields {
+			if field.KeyExpr != nil {
+				return nil, mongoUnsupported("a computed object key", field.Line, field.Column)
+			}
+			v, err := mongoValue(field.Value)
+			if err != nil {
+				return nil, err
+			}
+			values[field.Key] = v
+		}
+		return values, nil
+	}
+	line, column := expr.Pos()
+	return nil, mongoUnsupported(fmt.Sprintf("value %s", expr.String()), line, column)
+}
+
+// stringLiteral returns the value of a string literal.
+func stringLiteral(expr ast.Expression) (string, bool) {
+	lit, ok := expr.(*expressions.LiteralExpr)
+	if !ok {
+		return "", false
+	}
+	s, ok := lit.Value.(string)
+	return s, ok
+}
@@ -0,0 +1,95 @@
+package lql
+
+import (
+	"encoding/json"
+	"github.com/SpecDrivenDesign/lql/pkg/ast"
+	"github.com/SpecDrivenDesign/lql/pkg/errors"
+	"github.com/SpecDrivenDesign/lql/pkg/lexer"
+	"github.com/SpecDrivenDesign/lql/pkg/parser"
+	"testing"
+)
+
+func parseExpr(t *testing.T, src string) ast.Expression {
+	t.Helper()
+	p, err := parser.NewParser(lexer.NewLexer(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expr, err := p.ParseExpression()
+	if err != nil {
+		t.Fatalf("%s: %v", src, err)
+	}
+	return expr
+}
+
+func TestToMongoFilter(t *testing.T) {
+	tests := []struct {
+		src, want string
+	}{
+		{`$age >= 18`, `{"age":{"$gte":18}}`},
+		{`18 < $age`, `{"age":{"$gt":18}}`},
+		{`$user.address.city == "Oslo"`, `{"user.address.city":"Oslo"}`},
+		{`$a != null`, `{"a":{"$ne":null}}`},
+		{`$a == 1.5`, `{"a":1.5}`},
+		{`$a == -2`, `{"a":-2}`},
+		{`$a == [1, "x"]`, `{"a":[1,"x"]}`},
+		{`$items[0].price > 5`, `{"items.0.price":{"$gt":5}}`},
+		{`$a?.b == 1`, `{"a.b":1}`},
+		{`$a > 1 AND $b < 2 AND $c == 3`, `{"$and":[{"a":{"$gt":1}},{"b":{"$lt":2}},{"c":3}]}`},
+		{`$a == 1 OR $b == 2`, `{"$or":[{"a":1},{"b":2}]}`},
+		{`NOT ($a == 1)`, `{"$nor":[{"a":1}]}`},
+		{`$active`, `{"active":true}`},
+		{`NOT $active`, `{"$nor":[{"active":true}]}`},
+		{`true`, `{}`},
+		{`false`, `{"$expr":false}`},
+		{`$a BETWEEN 1 AND 5`, `{"$and":[{"a":{"$gte":1}},{"a":{"$lte":5}}]}`},
+		{`$name =~ "^a"`, `{"name":{"$regex":"^a"}}`},
+		{`$name !~ "b"`, `{"name":{"$not":{"$regex":"b"}}}`},
+		{`$name LIKE "a_c%"`, `{"name":{"$options":"s","$regex":"^a.c.*$"}}`},
+		{`array.contains($tags, "vip")`, `{"tags":"vip"}`},
+		{`string.startsWith($n, "a.b")`, `{"n":{"$regex":"^a\\.b"}}`},
+		{`string.endsWith($n, "z")`, `{"n":{"$regex":"z$"}}`},
+		{`string.contains($n, "m")`, `{"n":{"$regex":"m"}}`},
+		{`cond.isFieldPresent($a, "b")`, `{"a.b":{"$exists":true}}`},
+		{`$a > $b`, `{"$expr":{"$gt":["$a","$b"]}}`},
+	}
+	for _, tt := range tests {
+		filter, err := ToMongoFilter(parseExpr(t, tt.src))
+		if err != nil {
+			t.Errorf("%s: %v", tt.src, err)
+			continue
+		}
+		got, err := json.Marshal(filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestToMongoFilterUnsupported(t *testing.T) {
+	tests := []struct {
+		src          string
+		line, column int
+	}{
+		{`$a + 1 > 2`, 1, 4},
+		{`$a[*].b == 1`, 1, 4},
+		{`math.abs($a) > 1`, 1, 1},
+		{`$a LIKE $b`, 1, 9},
+		{`$a[$i] == 1`, 1, 8},
+		{`$a == $`, 1, 7},
+	}
+	for _, tt := range tests {
+		filter, err := ToMongoFilter(parseExpr(t, tt.src))
+		transErr, ok := err.(*errors.TranslationError)
+		if !ok {
+			t.Errorf("%s: got %v, %v; want a TranslationError", tt.src, filter, err)
+			continue
+		}
+		if transErr.Line != tt.line || transErr.Column != tt.column {
+			t.Errorf("%s: error at %d:%d, want %d:%d", tt.src, transErr.Line, transErr.Column, tt.line, tt.column)
+		}
+	}
+}
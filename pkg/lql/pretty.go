@@ -0,0 +1,400 @@
+package lql
+
+import (
+	"github.com/SpecDrivenDesign/lql/pkg/lexer"
+	"github.com/SpecDrivenDesign/lql/pkg/parser"
+	"github.com/SpecDrivenDesign/lql/pkg/tokens"
+	"strings"
+	"unicode/utf8"
+)
+
+// defaultPrettyIndent is the indentation used by PrettySource when
+// PrettyOptions.Indent is not set.
+const defaultPrettyIndent = "  "
+
+// PrettyOptions controls the output of PrettySource.
+type PrettyOptions struct {
+	// Indent is the indentation per nesting level (default two spaces).
+	Indent string
+	// MaxWidth is the line width (default 80).
+	MaxWidth int
+}
+
+// PrettySource reformats src while keeping its comments and the written
+// spelling of every token: keyword case, quote style, number literals and
+// parentheses are left as they are, and only the whitespace between tokens
+// changes. Groups in parentheses, brackets or braces that do not fit in
+// MaxWidth, or that contain a comment, are broken one item per line, and
+// AND/OR operators at the same level start a new line.
+//
+// Unlike FormatSource the output is not canonical; use it to reflow stored
+// rules without losing their authors' comments.
+func PrettySource(src string, opts PrettyOptions) (string, error) {
+	p, err := parser.NewParser(lexer.NewLexer(src))
+	if err != nil {
+		return "", err
+	}
+	if _, err := p.ParseExpression(); err != nil {
+		return "", err
+	}
+	if opts.Indent == "" {
+		opts.Indent = defaultPrettyIndent
+	}
+	if opts.MaxWidth <= 0 {
+		opts.MaxWidth = defaultFormatWidth
+	}
+
+	nodes, err := prettyTree(src)
+	if err != nil {
+		return "", err
+	}
+	pp := &prettyPrinter{opts: opts, lineStart: true}
+	pp.segment(nodes, 0)
+	return pp.sb.String(), nil
+}
+
+// prettyNode is a token, a comment, or a bracketed group holding the nodes
+// between its opening and closing tokens.
+type prettyNode struct {
+	tok      tokens.Token
+	text     string
+	comment  bool
+	trailing bool // comment on the same line as the preceding token
+	spaced   bool // token preceded by whitespace or a comment in the source
+	group    bool
+	children []prettyNode
+	close    *prettyNode
+}
+
+// prettyTree lexes src into a tree of nodes with comments interleaved by
+// position.
+func prettyTree(src string) ([]prettyNode, error) {
+	l := lexer.NewLexer(src)
+	var toks []tokens.Token
+	for {
+		tok, err := l.NextToken()
+		if err != nil {
+			return nil, err
+		}
+		if tok.Type == tokens.TokenEof {
+			break
+		}
+		toks = append(toks, tok)
+	}
+	comments := l.Comments()
+
+	lineStarts := []int{0, 0}
+	for i := 0; i < len(src); i++ {
+		if src[i] == '\n' {
+			lineStarts = append(lineStarts, i+1)
+		}
+	}
+
+	var flat []prettyNode
+	lastLine, lastEnd := 0, 0
+	ci := 0
+	addComments := func(line, column int) {
+		for ci < len(comments) && (line == 0 || comments[ci].Line < line || (comments[ci].Line == line && comments[ci].Column < column)) {
+			c := comments[ci]
+			flat = append(flat, prettyNode{text: c.Text, comment: true, trailing: c.Line == lastLine})
+			ci++
+		}
+	}
+	for _, tok := range toks {
+		addComments(tok.Line, tok.Column)
+		start := lineStarts[tok.Line] + tok.Column - 1
+		text := tok.Literal
+		if tok.Type == tokens.TokenString {
+			text = rawString(src, start)
+		}
+		flat = append(flat, prettyNode{tok: tok, text: text, spaced: start > lastEnd})
+		lastLine = tok.Line + strings.Count(text, "\n")
+		lastEnd = start + len(text)
+	}
+	addComments(0, 0)
+
+	var build func(i int) ([]prettyNode, int)
+	build = func(i int) ([]prettyNode, int) {
+		var nodes []prettyNode
+		for i < len(flat) {
+			n := flat[i]
+			if !n.comment {
+				switch n.tok.Type {
+				case tokens.TokenRparen, tokens.TokenRightBracket, tokens.TokenRightCurly:
+					return nodes, i
+				case tokens.TokenLparen, tokens.TokenLeftBracket, tokens.TokenQuestionBracket, tokens.TokenLeftCurly:
+					children, end := build(i + 1)
+					n.group = true
+					n.children = children
+					if end < len(flat) {
+						closeNode := flat[end]
+						n.close = &closeNode
+					}
+					nodes = append(nodes, n)
+					i = end + 1
+					continue
+				}
+			}
+			nodes = append(nodes, n)
+			i++
+		}
+		return nodes, i
+	}
+	nodes, _ := build(0)
+	return nodes, nil
+}
+
+// rawString returns the string literal starting at offset as written,
+// including its quotes and escapes.
+func rawString(src string, offset int) string {
+	quote := src[offset]
+	for i := offset + 1; i < len(src); i++ {
+		switch src[i] {
+		case '\\':
+			i++
+		case quote:
+			return src[offset : i+1]
+		}
+	}
+	return src[offset:]
+}
+
+type prettyPrinter struct {
+	opts         PrettyOptions
+	sb           strings.Builder
+	col          int
+	prev         *tokens.Token
+	prevUnary    bool
+	lineStart    bool
+	pendingBreak bool
+	flat         bool
+}
+
+func (p *prettyPrinter) pad(depth int) string {
+	return strings.Repeat(p.opts.Indent, depth)
+}
+
+func (p *prettyPrinter) write(s string) {
+	p.sb.WriteString(s)
+	p.col += utf8.RuneCountInString(s)
+}
+
+func (p *prettyPrinter) newline(depth int) {
+	p.sb.WriteString("\n")
+	p.col = 0
+	p.write(p.pad(depth))
+	p.lineStart = true
+	p.pendingBreak = false
+}
+
+// segment prints a run of nodes between commas, breaking before each AND
+// and OR when it does not fit on the current line.
+func (p *prettyPrinter) segment(nodes []prettyNode, depth int) {
+	if !p.flat && p.tryFlat(nodes, depth) {
+		return
+	}
+	for i, n := range nodes {
+		if i > 0 && !p.lineStart && isLogical(n) {
+			p.newline(depth)
+		}
+		p.node(n, depth)
+	}
+}
+
+// isLogical reports whether n is an AND or OR operator, in any spelling.
+func isLogical(n prettyNode) bool {
+	if n.comment || n.group {
+		return false
+	}
+	switch n.tok.Type {
+	case tokens.TokenAnd, tokens.TokenOr:
+		return true
+	case tokens.TokenIdent:
+		upper := strings.ToUpper(n.tok.Literal)
+		return upper == "AND" || upper == "OR"
+	}
+	return false
+}
+
+func (p *prettyPrinter) node(n prettyNode, depth int) {
+	switch {
+	case n.comment:
+		p.comment(n, depth)
+	case n.group:
+		p.group(n, depth)
+	default:
+		p.token(n, depth)
+	}
+}
+
+// group prints a bracketed group on one line if it fits, and otherwise
+// with one comma-separated item per line.
+func (p *prettyPrinter) group(n prettyNode, depth int) {
+	if p.flat {
+		p.token(n, depth)
+		for _, child := range n.children {
+			p.node(child, depth)
+		}
+		if n.close != nil {
+			p.token(*n.close, depth)
+		}
+		return
+	}
+	if p.tryFlat([]prettyNode{n}, depth) {
+		return
+	}
+
+	p.token(n, depth)
+	var item []prettyNode
+	flush := func(comma *prettyNode) {
+		// Comments trailing the opening token or the previous comma stay
+		// on its line.
+		for len(item) > 0 && item[0].comment && item[0].trailing {
+			p.comment(item[0], depth+1)
+			item = item[1:]
+		}
+		if len(item) > 0 {
+			p.newline(depth + 1)
+			p.segment(item, depth+1)
+		}
+		if comma != nil {
+			p.token(*comma, depth+1)
+		}
+		item = nil
+	}
+	for i := range n.children {
+		child := n.children[i]
+		if !child.comment && child.tok.Type == tokens.TokenComma {
+			flush(&child)
+			continue
+		}
+		item = append(item, child)
+	}
+	flush(nil)
+	p.newline(depth)
+	if n.close != nil {
+		p.token(*n.close, depth)
+	}
+}
+
+// tryFlat prints nodes on the current line when they contain no comments
+// and fit within MaxWidth.
+func (p *prettyPrinter) tryFlat(nodes []prettyNode, depth int) bool {
+	if hasComment(nodes) {
+		return false
+	}
+	if p.pendingBreak {
+		p.newline(depth)
+	}
+	trial := &prettyPrinter{
+		opts:      p.opts,
+		col:       p.col,
+		prev:      p.prev,
+		prevUnary: p.prevUnary,
+		lineStart: p.lineStart,
+		flat:      true,
+	}
+	for _, n := range nodes {
+		trial.node(n, depth)
+	}
+	if trial.col > p.opts.MaxWidth {
+		return false
+	}
+	p.sb.WriteString(trial.sb.String())
+	p.col = trial.col
+	p.prev = trial.prev
+	p.prevUnary = trial.prevUnary
+	p.lineStart = trial.lineStart
+	return true
+}
+
+func hasComment(nodes []prettyNode) bool {
+	for _, n := range nodes {
+		if n.comment || hasComment(n.children) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *prettyPrinter) comment(n prettyNode, depth int) {
+	switch {
+	case p.lineStart:
+	case n.trailing:
+		p.write(" ")
+	default:
+		p.newline(depth)
+	}
+	p.write(n.text)
+	p.lineStart = false
+	p.pendingBreak = true
+	p.prev = nil
+}
+
+func (p *prettyPrinter) token(n prettyNode, depth int) {
+	tok, text := n.tok, n.text
+	if p.pendingBreak {
+		p.newline(depth)
+	}
+	if !p.lineStart && p.spaceBefore(n) {
+		p.write(" ")
+	}
+	unary := false
+	switch tok.Type {
+	case tokens.TokenMinus, tokens.TokenPlus:
+		unary = p.prev == nil || !endsOperand(p.prev.Type)
+	case tokens.TokenNot:
+		unary = text == "!"
+	case tokens.TokenColon:
+		unary = p.prev == nil || !endsOperand(p.prev.Type)
+	}
+	p.write(text)
+	t := tok
+	p.prev = &t
+	p.prevUnary = unary
+	p.lineStart = false
+}
+
+// spaceBefore reports whether a space separates the previous token from
+// the token n.
+func (p *prettyPrinter) spaceBefore(n prettyNode) bool {
+	if p.prev == nil {
+		return true
+	}
+	if p.prevUnary {
+		return false
+	}
+	switch p.prev.Type {
+	case tokens.TokenLparen, tokens.TokenLeftBracket, tokens.TokenQuestionBracket, tokens.TokenLeftCurly,
+		tokens.TokenDot, tokens.TokenQuestionDot, tokens.TokenDotDot, tokens.TokenDollar:
+		return false
+	}
+	switch n.tok.Type {
+	case tokens.TokenRparen, tokens.TokenRightBracket, tokens.TokenRightCurly, tokens.TokenComma,
+		tokens.TokenDot, tokens.TokenQuestionDot, tokens.TokenDotDot, tokens.TokenQuestionBracket:
+		return false
+	case tokens.TokenColon:
+		// A colon after an object key is attached to it; any other colon
+		// starts a placeholder.
+		return !endsOperand(p.prev.Type)
+	case tokens.TokenLeftBracket:
+		// An index follows an operand; an array literal does not.
+		return !endsOperand(p.prev.Type)
+	case tokens.TokenLparen:
+		// A call follows its function name, but an operator keyword such
+		// as LIKE may precede a parenthesized operand; keep what was written.
+		return p.prev.Type != tokens.TokenIdent || n.spaced
+	}
+	return true
+}
+
+// endsOperand reports whether a token of type t can end an operand, so a
+// following "-" is binary and a following "[" is an index.
+func endsOperand(t tokens.TokenType) bool {
+	switch t {
+	case tokens.TokenIdent, tokens.TokenNumber, tokens.TokenString, tokens.TokenBool, tokens.TokenNull,
+		tokens.TokenRparen, tokens.TokenRightBracket, tokens.TokenRightCurly, tokens.TokenDollar:
+		return true
+	}
+	return false
+}
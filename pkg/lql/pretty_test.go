@@ -0,0 +1,77 @@
+package lql
+
+import (
+	"github.com/SpecDrivenDesign/lql/pkg/ast"
+	"strings"
+	"testing"
+)
+
+// roundTripSources exercise precedence, associativity and parentheses that
+// printers must keep or may drop.
+var roundTripSources = []string{
+	`$a + $b * $c`,
+	`($a + $b) * $c`,
+	`$a - ($b - $c)`,
+	`($a - $b) - $c`,
+	`$a / ($b * $c)`,
+	`-($a + 1)`,
+	`- -$a`,
+	`NOT ($a AND $b)`,
+	`NOT $a AND $b`,
+	`$a OR $b AND $c`,
+	`($a OR $b) AND $c`,
+	`$a AND ($b OR $c) AND NOT ($d OR $e)`,
+	`($a ?: $b) + 1`,
+	`$a ?: $b ?: $c`,
+	`($a > 1) == ($b < 2)`,
+	`$a BETWEEN 1 + 2 AND 3 * 4`,
+	`($a BETWEEN 1 AND 2) AND $b`,
+	`NOT $name LIKE "a%" OR $name =~ "^b"`,
+	`$items[*].price[0]?.amount`,
+	`$a..b == [1, [2, 3], {"k": -1.5, "key with space": 'single "quoted"'}]`,
+	`math.max([$a, $b + 1]) * (2 - $c) > 10 AND string.concat("a\tb", 'c\'d') != ""`,
+	`LET x = $a + 1 IN x * (x - 1)`,
+	`array.filterExpr($items, item.qty > 1 AND item.sku != "x")`,
+	"$a > 1 # trailing comment\n  and $b.c?.d < 2.50",
+}
+
+func TestPrettySourceRoundTrip(t *testing.T) {
+	for _, src := range roundTripSources {
+		for _, opts := range []PrettyOptions{{}, {MaxWidth: 10, Indent: "\t"}} {
+			out, err := PrettySource(src, opts)
+			if err != nil {
+				t.Errorf("%s: %v", src, err)
+				continue
+			}
+			if got, want := ast.Fingerprint(parseExpr(t, out)), ast.Fingerprint(parseExpr(t, src)); got != want {
+				t.Errorf("%s printed as %s, which parses differently", src, out)
+			}
+			again, err := PrettySource(out, opts)
+			if err != nil || again != out {
+				t.Errorf("%s: printing is not idempotent: %q, then %q", src, out, again)
+			}
+		}
+	}
+}
+
+func TestPrettySource(t *testing.T) {
+	src := "# premium customers\n$user.tier=='gold' # top tier\nand   $user.age>=18 AND array.contains(['US','CA'],$user.country)"
+	want := "# premium customers\n$user.tier == 'gold' # top tier\nand $user.age >= 18\nAND array.contains(\n  ['US', 'CA'],\n  $user.country\n)"
+	got, err := PrettySource(src, PrettyOptions{MaxWidth: 30})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+	// Short expressions stay on one line, with their spelling kept.
+	if got, err := PrettySource("((1+2))*$a   or   false", PrettyOptions{}); err != nil || got != "((1 + 2)) * $a or false" {
+		t.Errorf("got %q, %v", got, err)
+	}
+	if _, err := PrettySource("$a >", PrettyOptions{}); err == nil {
+		t.Error("a syntax error was accepted")
+	}
+	if out, _ := PrettySource("$a AND # why\n$b", PrettyOptions{}); !strings.Contains(out, "# why") {
+		t.Errorf("comment lost: %q", out)
+	}
+}
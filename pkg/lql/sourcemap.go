@@ -0,0 +1,147 @@
+package lql
+
+import (
+	stdErrors "errors"
+	"fmt"
+	"github.com/SpecDrivenDesign/lql/pkg/errors"
+	"strings"
+)
+
+// Composer assembles an expression from named fragments (e.g. included
+// files) and glue text, recording where each fragment lands so positions in
+// the composed source can be mapped back.
+type Composer struct {
+	sb       strings.Builder
+	line     int
+	column   int
+	segments []segment
+}
+
+// segment records the placement of one fragment in the composed source.
+type segment struct {
+	name                string
+	startLine, startCol int
+	endLine, endCol     int
+}
+
+// Location is a position inside an original fragment.
+type Location struct {
+	Fragment string
+	Line     int
+	Column   int
+}
+
+// NewComposer creates an empty Composer.
+func NewComposer() *Composer {
+	return &Composer{line: 1, column: 1}
+}
+
+// Write appends glue text that does not belong to any fragment, such as
+// " AND " between two included conditions.
+func (c *Composer) Write(text string) {
+	c.advance(text)
+}
+
+// Include appends the source of a named fragment.
+func (c *Composer) Include(name, source string) {
+	seg := segment{name: name, startLine: c.line, startCol: c.column}
+	c.advance(source)
+	seg.endLine, seg.endCol = c.line, c.column
+	c.segments = append(c.segments, seg)
+}
+
+func (c *Composer) advance(text string) {
+	c.sb.WriteString(text)
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			c.line++
+			c.column = 1
+		} else {
+			c.column++
+		}
+	}
+}
+
+// String returns the composed source.
+func (c *Composer) String() string {
+	return c.sb.String()
+}
+
+// SourceMap returns the source map for the fragments included so far.
+func (c *Composer) SourceMap() *SourceMap {
+	return &SourceMap{segments: append([]segment(nil), c.segments...)}
+}
+
+// SourceMap maps positions in a composed expression back to the fragments
+// it was assembled from.
+type SourceMap struct {
+	segments []segment
+}
+
+// Resolve maps a composed line and column to a fragment location. It
+// returns false for positions in glue text.
+func (m *SourceMap) Resolve(line, column int) (Location, bool) {
+	for _, seg := range m.segments {
+		if before(line, column, seg.startLine, seg.startCol) || !before(line, column, seg.endLine, seg.endCol) {
+			continue
+		}
+		loc := Location{Fragment: seg.name, Line: line - seg.startLine + 1, Column: column}
+		if line == seg.startLine {
+			loc.Column = column - seg.startCol + 1
+		}
+		return loc, true
+	}
+	return Location{}, false
+}
+
+// before reports whether (l1, c1) precedes (l2, c2).
+func before(l1, c1, l2, c2 int) bool {
+	return l1 < l2 || (l1 == l2 && c1 < c2)
+}
+
+// MapError rewrites the position of a positional error to the fragment it
+// originated from. Errors without a position, or positioned in glue text,
+// are returned unchanged. The mapped error wraps err, so errors.As still
+// finds the error types and rule metadata err carries.
+func (m *SourceMap) MapError(err error) error {
+	var pe errors.PositionalError
+	if err == nil || !stdErrors.As(err, &pe) {
+		return err
+	}
+	loc, ok := m.Resolve(pe.GetLine(), pe.GetColumn())
+	if !ok {
+		return err
+	}
+	return &MappedError{Err: err, Location: loc}
+}
+
+// MappedError is a positional error whose position refers to an original
+// fragment rather than the composed source.
+type MappedError struct {
+	// Err is the original error, positioned in the composed source.
+	Err      error
+	Location Location
+}
+
+func (e *MappedError) Error() string {
+	line, column := errors.GetErrorPosition(e.Err)
+	composed := fmt.Sprintf("at line %d, column %d", line, column)
+	mapped := fmt.Sprintf("in %s at line %d, column %d", e.Location.Fragment, e.Location.Line, e.Location.Column)
+	msg := e.Err.Error()
+	if strings.Contains(msg, composed) {
+		return strings.Replace(msg, composed, mapped, 1)
+	}
+	return msg + " " + mapped
+}
+
+func (e *MappedError) GetLine() int   { return e.Location.Line }
+func (e *MappedError) GetColumn() int { return e.Location.Column }
+func (e *MappedError) Unwrap() error  { return e.Err }
+
+func (e *MappedError) Kind() string {
+	var pe errors.PositionalError
+	if stdErrors.As(e.Err, &pe) {
+		return pe.Kind()
+	}
+	return "Error"
+}
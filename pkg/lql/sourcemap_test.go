@@ -0,0 +1,149 @@
+package lql
+
+import (
+	stdErrors "errors"
+	"fmt"
+	"github.com/SpecDrivenDesign/lql/pkg/ast"
+	"github.com/SpecDrivenDesign/lql/pkg/env"
+	"github.com/SpecDrivenDesign/lql/pkg/errors"
+	"github.com/SpecDrivenDesign/lql/pkg/lexer"
+	"github.com/SpecDrivenDesign/lql/pkg/parser"
+	"testing"
+)
+
+func TestSourceMapResolve(t *testing.T) {
+	c := NewComposer()
+	c.Write("(\n  ")
+	c.Include("a.lql", "$a > 1\nAND $b")
+	c.Write(") OR ")
+	c.Include("c.lql", "$c")
+	m := c.SourceMap()
+	tests := []struct {
+		line, column int
+		want         Location
+		ok           bool
+	}{
+		{1, 1, Location{}, false},
+		{2, 3, Location{"a.lql", 1, 1}, true},
+		{2, 6, Location{"a.lql", 1, 4}, true},
+		{3, 5, Location{"a.lql", 2, 5}, true},
+		{3, 7, Location{}, false},
+		{3, 12, Location{"c.lql", 1, 1}, true},
+		{3, 14, Location{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := m.Resolve(tt.line, tt.column)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("%d:%d: got %+v, %t; want %+v, %t", tt.line, tt.column, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestMapErrorFromTemplate(t *testing.T) {
+	rule, err := Template("$user.age >= {{min}}\n  AND $user.score / {{divisor}} > 1").Instantiate(map[string]string{"min": "18", "divisor": "0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewComposer()
+	c.Include("base.lql", "$active")
+	c.Write("\nAND (")
+	c.Include("adult.lql", rule)
+	c.Write(")")
+
+	p, err := parser.NewParser(lexer.NewLexer(c.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expr, err := p.ParseExpression()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := map[string]interface{}{"active": true, "user": map[string]interface{}{"age": int64(20), "score": int64(5)}}
+	_, err = expr.Eval(ctx, env.NewEnvironment())
+	mapped := c.SourceMap().MapError(err)
+
+	var posErr errors.PositionalError
+	if !stdErrors.As(mapped, &posErr) || posErr.GetLine() != 2 || posErr.GetColumn() != 19 {
+		t.Fatalf("got %v, want a position of 2:19", mapped)
+	}
+	if posErr.Kind() != "DivideByZeroError" {
+		t.Errorf("kind %s", posErr.Kind())
+	}
+	if want := "DivideByZeroError: division by zero in adult.lql at line 2, column 19"; mapped.Error() != want {
+		t.Errorf("got %q, want %q", mapped.Error(), want)
+	}
+	var divErr *errors.DivideByZeroError
+	if !stdErrors.As(mapped, &divErr) || divErr.Line != 3 {
+		t.Errorf("the original error is not wrapped: %v", mapped)
+	}
+}
+
+func TestMapErrorKeepsMetadata(t *testing.T) {
+	c := NewComposer()
+	c.Write("$ok AND ")
+	c.Include("limit.lql", "$amount / $parts > 1")
+
+	p, err := parser.NewParser(lexer.NewLexer(c.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expr, err := p.ParseExpression()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ast.Annotate(ast.Children(expr)[1], "rule", "limit")
+	_, err = expr.Eval(map[string]interface{}{"ok": true, "amount": int64(1), "parts": int64(0)}, env.NewEnvironment())
+	// Hosts may wrap the error before mapping it.
+	wrapped := fmt.Errorf("checkout: %w", err)
+	mapped := c.SourceMap().MapError(wrapped)
+
+	if !stdErrors.Is(mapped, wrapped) {
+		t.Errorf("%v does not wrap %v", mapped, wrapped)
+	}
+	if want := "checkout: DivideByZeroError: division by zero in limit.lql at line 1, column 9"; mapped.Error() != want {
+		t.Errorf("got %q, want %q", mapped.Error(), want)
+	}
+	var annotated *errors.AnnotatedError
+	if !stdErrors.As(mapped, &annotated) || annotated.Metadata["rule"] != "limit" {
+		t.Fatalf("metadata lost: %v", mapped)
+	}
+	var posErr errors.PositionalError = mapped.(*MappedError)
+	if posErr.GetLine() != 1 || posErr.GetColumn() != 9 || posErr.Kind() != "DivideByZeroError" {
+		t.Errorf("got %v at %d:%d", mapped, posErr.GetLine(), posErr.GetColumn())
+	}
+}
+
+func TestMapErrorUnmapped(t *testing.T) {
+	c := NewComposer()
+	c.Include("a.lql", "$a")
+	c.Write(" AND $b")
+	m := c.SourceMap()
+	glue := errors.NewReferenceError("field 'b' not found", 1, 9)
+	plain := stdErrors.New("no position")
+	for _, err := range []error{glue, plain, nil} {
+		if got := m.MapError(err); got != err {
+			t.Errorf("%v was mapped to %v", err, got)
+		}
+	}
+}
+
+func TestMapParseError(t *testing.T) {
+	c := NewComposer()
+	c.Include("a.lql", "$a")
+	c.Write(" AND\n")
+	c.Include("b.lql", "($b >\n  == 1)")
+	p, err := parser.NewParser(lexer.NewLexer(c.String()))
+	if err == nil {
+		_, err = p.ParseExpression()
+	}
+	if err == nil {
+		t.Fatal("an invalid expression parsed")
+	}
+	var posErr errors.PositionalError
+	if !stdErrors.As(c.SourceMap().MapError(err), &posErr) {
+		t.Fatalf("got %v", err)
+	}
+	if got := (Location{"b.lql", posErr.GetLine(), posErr.GetColumn()}); got != (Location{"b.lql", 2, 3}) {
+		t.Errorf("%v mapped to %+v", err, got)
+	}
+}
@@ -0,0 +1,285 @@
+package lql
+
+import (
+	"fmt"
+	"github.com/SpecDrivenDesign/lql/pkg/lexer"
+	"github.com/SpecDrivenDesign/lql/pkg/parser"
+	"github.com/SpecDrivenDesign/lql/pkg/tokens"
+	"github.com/SpecDrivenDesign/lql/pkg/types"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ExpressionTemplate is an expression containing {{name}} placeholders that
+// are replaced by safely escaped literals.
+type ExpressionTemplate struct {
+	source string
+}
+
+// Template creates an ExpressionTemplate from source.
+func Template(source string) *ExpressionTemplate {
+	return &ExpressionTemplate{source: source}
+}
+
+// Placeholders returns the distinct placeholder names in the template, sorted.
+func (t *ExpressionTemplate) Placeholders() ([]string, error) {
+	seen := make(map[string]bool)
+	_, err := t.substitute(func(name string) (string, error) {
+		seen[name] = true
+		return "null", nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Instantiate replaces each placeholder with the given value. Every value must
+// be exactly one literal (a number, quoted string, true, false or null); this
+// stops values from injecting operators or context references.
+func (t *ExpressionTemplate) Instantiate(values map[string]string) (string, error) {
+	literals := make(map[string]string, len(values))
+	for name, value := range values {
+		if err := validateLiteral(value); err != nil {
+			return "", fmt.Errorf("template value for '%s': %v", name, err)
+		}
+		literals[name] = strings.TrimSpace(value)
+	}
+	return t.instantiate(literals)
+}
+
+// InstantiateValues replaces each placeholder with the literal form of a Go
+// value. Strings are quoted and escaped; numbers, booleans, nil, slices and
+// maps are rendered as the corresponding LQL literals.
+func (t *ExpressionTemplate) InstantiateValues(values map[string]interface{}) (string, error) {
+	literals := make(map[string]string, len(values))
+	for name, value := range values {
+		lit, err := FormatLiteral(value)
+		if err != nil {
+			return "", fmt.Errorf("template value for '%s': %v", name, err)
+		}
+		literals[name] = lit
+	}
+	return t.instantiate(literals)
+}
+
+func (t *ExpressionTemplate) instantiate(literals map[string]string) (string, error) {
+	used := make(map[string]bool)
+	expr, err := t.substitute(func(name string) (string, error) {
+		lit, ok := literals[name]
+		if !ok {
+			return "", fmt.Errorf("missing value for placeholder '%s'", name)
+		}
+		used[name] = true
+		return lit, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	for name := range literals {
+		if !used[name] {
+			return "", fmt.Errorf("unknown placeholder '%s'", name)
+		}
+	}
+	p, err := parser.NewParser(lexer.NewLexer(expr))
+	if err != nil {
+		return "", err
+	}
+	if _, err := p.ParseExpression(); err != nil {
+		return "", err
+	}
+	return expr, nil
+}
+
+// substitute walks the template, replacing placeholders outside of string
+// literals and comments with the result of replace.
+func (t *ExpressionTemplate) substitute(replace func(name string) (string, error)) (string, error) {
+	src := t.source
+	var sb strings.Builder
+	for i := 0; i < len(src); {
+		ch := src[i]
+		switch {
+		case ch == '"' || ch == '\'':
+			j := i + 1
+			for j < len(src) && src[j] != ch {
+				if src[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(src) {
+				return "", fmt.Errorf("unclosed string literal in template")
+			}
+			sb.WriteString(src[i : j+1])
+			i = j + 1
+		case ch == '#':
+			j := strings.IndexByte(src[i:], '\n')
+			if j < 0 {
+				j = len(src) - i
+			}
+			sb.WriteString(src[i : i+j])
+			i += j
+		case strings.HasPrefix(src[i:], "{{"):
+			end := strings.Index(src[i+2:], "}}")
+			if end < 0 {
+				return "", fmt.Errorf("unclosed placeholder in template")
+			}
+			name := strings.TrimSpace(src[i+2 : i+2+end])
+			if !isPlaceholderName(name) {
+				return "", fmt.Errorf("invalid placeholder name '%s'", name)
+			}
+			lit, err := replace(name)
+			if err != nil {
+				return "", err
+			}
+			sb.WriteString(lit)
+			i += end + 4
+		default:
+			sb.WriteByte(ch)
+			i++
+		}
+	}
+	return sb.String(), nil
+}
+
+func isPlaceholderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		letter := r == '_' || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z')
+		digit := '0' <= r && r <= '9'
+		if !letter && !(digit && i > 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// validateLiteral checks that value lexes as exactly one literal token,
+// optionally preceded by a minus sign for numbers.
+func validateLiteral(value string) error {
+	lex := lexer.NewLexer(value)
+	tok, err := lex.NextToken()
+	if err != nil {
+		return err
+	}
+	if tok.Type == tokens.TokenMinus {
+		tok, err = lex.NextToken()
+		if err != nil {
+			return err
+		}
+		if tok.Type != tokens.TokenNumber {
+			return fmt.Errorf("'-' must be followed by a number")
+		}
+	}
+	switch tok.Type {
+	case tokens.TokenNumber, tokens.TokenString, tokens.TokenBool, tokens.TokenNull:
+	default:
+		return fmt.Errorf("value %q is not a single literal", value)
+	}
+	next, err := lex.NextToken()
+	if err != nil {
+		return err
+	}
+	if next.Type != tokens.TokenEof {
+		return fmt.Errorf("value %q is not a single literal", value)
+	}
+	return nil
+}
+
+// FormatLiteral renders a Go value as LQL literal source.
+func FormatLiteral(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "null", nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case string:
+		return QuoteString(v), nil
+	case int:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int32:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float32:
+		return formatFloat(float64(v))
+	case float64:
+		return formatFloat(v)
+	}
+	if arr, ok := types.ConvertToInterfaceSlice(value); ok {
+		parts := make([]string, len(arr))
+		for i, elem := range arr {
+			lit, err := FormatLiteral(elem)
+			if err != nil {
+				return "", err
+			}
+			parts[i] = lit
+		}
+		return "[" + strings.Join(parts, ", ") + "]", nil
+	}
+	if obj, ok := types.ConvertToStringMap(value); ok {
+		keys := make([]string, 0, len(obj))
+		for k := range obj {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		parts := make([]string, len(keys))
+		for i, k := range keys {
+			lit, err := FormatLiteral(obj[k])
+			if err != nil {
+				return "", err
+			}
+			parts[i] = QuoteString(k) + ": " + lit
+		}
+		return "{" + strings.Join(parts, ", ") + "}", nil
+	}
+	return "", fmt.Errorf("unsupported value type %T", value)
+}
+
+func formatFloat(f float64) (string, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return "", fmt.Errorf("non-finite float %v has no literal form", f)
+	}
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eE") {
+		s += ".0"
+	}
+	return s, nil
+}
+
+// QuoteString renders s as a double-quoted LQL string literal.
+func QuoteString(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			sb.WriteString(`\"`)
+		case '\\':
+			sb.WriteString(`\\`)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\r':
+			sb.WriteString(`\r`)
+		case '\t':
+			sb.WriteString(`\t`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				sb.WriteString(fmt.Sprintf(`\u%04x`, r))
+			} else {
+				sb.WriteRune(r)
+			}
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
@@ -0,0 +1,136 @@
+package lql
+
+import (
+	"github.com/SpecDrivenDesign/lql/pkg/env"
+	"github.com/SpecDrivenDesign/lql/pkg/lexer"
+	"github.com/SpecDrivenDesign/lql/pkg/parser"
+	"strings"
+	"testing"
+)
+
+func TestInstantiate(t *testing.T) {
+	tmpl := Template(`$user.age >= {{min}} AND $user.country == {{ country }}`)
+	got, err := tmpl.Instantiate(map[string]string{"min": "18", "country": ` "NL" `})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `$user.age >= 18 AND $user.country == "NL"`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	if got, err := Template(`$a > {{n}}`).Instantiate(map[string]string{"n": "-1.5"}); err != nil || got != `$a > -1.5` {
+		t.Errorf("negative number: %q, %v", got, err)
+	}
+}
+
+func TestInstantiateRejectsNonLiterals(t *testing.T) {
+	tmpl := Template(`$role == {{role}}`)
+	for _, value := range []string{
+		`$secret`,
+		`"a" OR true`,
+		`1 + 1`,
+		`string.concat("a")`,
+		`[1, 2]`,
+		`- "a"`,
+		``,
+		`"unclosed`,
+	} {
+		if got, err := tmpl.Instantiate(map[string]string{"role": value}); err == nil {
+			t.Errorf("%q was accepted: %s", value, got)
+		}
+	}
+}
+
+func TestInstantiateValuesQuotesStrings(t *testing.T) {
+	tmpl := Template(`$name == {{name}}`)
+	for _, value := range []string{
+		`say "hi"`,
+		`back\slash`,
+		"two\nlines\tand\r",
+		`" OR true OR "`,
+		"\x00\x7f",
+	} {
+		src, err := tmpl.InstantiateValues(map[string]interface{}{"name": value})
+		if err != nil {
+			t.Errorf("%q: %v", value, err)
+			continue
+		}
+		p, err := parser.NewParser(lexer.NewLexer(src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expr, err := p.ParseExpression()
+		if err != nil {
+			t.Errorf("%q: %s does not parse: %v", value, src, err)
+			continue
+		}
+		// The value must come back unchanged, as a single string.
+		got, err := expr.Eval(map[string]interface{}{"name": value}, env.NewEnvironment())
+		if err != nil || got != true {
+			t.Errorf("%q: %s evaluates to %v, %v", value, src, got, err)
+		}
+	}
+}
+
+func TestInstantiateValues(t *testing.T) {
+	got, err := Template(`{{n}} + {{f}} > 0 AND {{b}} AND {{z}} == null AND array.contains({{list}}, 1) AND {{obj}}.k == "v"`).InstantiateValues(map[string]interface{}{
+		"n":    int64(-3),
+		"f":    2.0,
+		"b":    true,
+		"z":    nil,
+		"list": []interface{}{int64(1), "x"},
+		"obj":  map[string]interface{}{"k": "v"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `-3 + 2.0 > 0 AND true AND null == null AND array.contains([1, "x"], 1) AND {"k": "v"}.k == "v"`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	if _, err := Template(`{{v}}`).InstantiateValues(map[string]interface{}{"v": make(chan int)}); err == nil {
+		t.Error("a channel was accepted")
+	}
+}
+
+func TestPlaceholdersInStringsAndComments(t *testing.T) {
+	tmpl := Template("$a == \"{{a}}\" # {{b}} is not a placeholder\nOR $c == '{{c}}' OR $d == {{d}}")
+	names, err := tmpl.Placeholders()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 || names[0] != "d" {
+		t.Errorf("placeholders %v, want [d]", names)
+	}
+	got, err := tmpl.Instantiate(map[string]string{"d": "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "$a == \"{{a}}\" # {{b}} is not a placeholder\nOR $c == '{{c}}' OR $d == 1"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestInstantiateParameters(t *testing.T) {
+	tmpl := Template(`$a == {{a}} OR $b == {{a}} OR $c == {{c}}`)
+	tests := []struct {
+		values map[string]string
+		err    string
+	}{
+		{map[string]string{"a": "1", "c": "2"}, ""},
+		{map[string]string{"a": "1"}, "missing value for placeholder 'c'"},
+		{map[string]string{"a": "1", "c": "2", "d": "3"}, "unknown placeholder 'd'"},
+	}
+	for _, tt := range tests {
+		_, err := tmpl.Instantiate(tt.values)
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("%v: %v", tt.values, err)
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("%v: error %v, want %q", tt.values, err, tt.err)
+		}
+	}
+	for _, src := range []string{`$a == {{a`, `$a == {{1a}}`, `$a == "{{a}}`} {
+		if _, err := Template(src).Instantiate(nil); err == nil {
+			t.Errorf("%s: malformed template accepted", src)
+		}
+	}
+}
@@ -0,0 +1,709 @@
+package lql
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/SpecDrivenDesign/lql/pkg/ast"
+	"github.com/SpecDrivenDesign/lql/pkg/ast/expressions"
+	"github.com/SpecDrivenDesign/lql/pkg/errors"
+	"github.com/SpecDrivenDesign/lql/pkg/lexer"
+	"github.com/SpecDrivenDesign/lql/pkg/parser"
+	"github.com/SpecDrivenDesign/lql/pkg/tokens"
+	"github.com/SpecDrivenDesign/lql/pkg/types"
+	"strconv"
+	"strings"
+)
+
+// Target is a language an expression can be translated to.
+type Target int
+
+const (
+	TargetCEL Target = iota
+	TargetJavaScript
+)
+
+func (t Target) String() string {
+	if t == TargetJavaScript {
+		return "JavaScript"
+	}
+	return "CEL"
+}
+
+// TranslateOptions controls the output of ToCEL and ToJavaScript.
+type TranslateOptions struct {
+	// Context is the name of the variable holding the evaluation context.
+	// When empty, CEL output reads top-level fields as variables ($user.age
+	// becomes user.age) and JavaScript output reads them from "ctx".
+	Context string
+}
+
+// precConditional is the precedence of the ternary operator and of "??",
+// which bind less tightly than any LQL operator.
+const precConditional = parser.LOWEST - 1
+
+// ToCEL renders expr as a Google CEL expression. String helpers map to the
+// CEL strings extension and math helpers to the math extension; constructs
+// with no CEL equivalent are reported with a TranslationError.
+func ToCEL(expr ast.Expression, opts TranslateOptions) (string, error) {
+	t := &translator{target: TargetCEL, context: opts.Context}
+	s, _, err := t.render(expr)
+	return s, err
+}
+
+// ToJavaScript renders expr as a JavaScript expression over a context
+// object. Constructs with no JavaScript equivalent are reported with a
+// TranslationError.
+func ToJavaScript(expr ast.Expression, opts TranslateOptions) (string, error) {
+	if opts.Context == "" {
+		opts.Context = "ctx"
+	}
+	t := &translator{target: TargetJavaScript, context: opts.Context}
+	s, _, err := t.render(expr)
+	return s, err
+}
+
+// TranslateSource parses src and translates it to the given target.
+func TranslateSource(src string, target Target, opts TranslateOptions) (string, error) {
+	p, err := parser.NewParser(lexer.NewLexer(src))
+	if err != nil {
+		return "", err
+	}
+	expr, err := p.ParseExpression()
+	if err != nil {
+		return "", err
+	}
+	if target == TargetJavaScript {
+		return ToJavaScript(expr, opts)
+	}
+	return ToCEL(expr, opts)
+}
+
+type translator struct {
+	target  Target
+	context string
+	// lenient makes every member access null-safe, for the left side of
+	// "?:" and the remainder of an optional projection.
+	lenient bool
+	// depth numbers the variables of nested projections.
+	depth int
+}
+
+func (t *translator) js() bool {
+	return t.target == TargetJavaScript
+}
+
+func (t *translator) unsupported(what string, line, column int) error {
+	return errors.NewTranslationError(fmt.Sprintf("%s has no %s equivalent", what, t.target), line, column)
+}
+
+// render translates expr and reports the precedence of the result.
+func (t *translator) render(expr ast.Expression) (string, int, error) {
+	switch e := expr.(type) {
+	case *expressions.LiteralExpr:
+		s, err := t.literal(e.Value, e.Line, e.Column)
+		return s, precPrimary, err
+
+	case *expressions.ContextExpr:
+		s, err := t.contextRef(e)
+		return s, precPrimary, err
+
+	case *expressions.BinaryExpr:
+		return t.binary(e)
+
+	case *expressions.BetweenExpr:
+		return t.render(e.Lowered())
+
+	case *expressions.LikeExpr:
+		pattern, ok := stringLiteral(e.Pattern)
+		if !ok {
+			line, column := e.Pattern.Pos()
+			return "", 0, t.unsupported("LIKE with a computed pattern", line, column)
+		}
+		regex, err := expressions.LikePatternToRegex(pattern)
+		if err != nil {
+			line, column := e.Pattern.Pos()
+			return "", 0, errors.NewTypeError("LIKE operator: "+err.Error(), line, column)
+		}
+		if t.js() {
+			// JavaScript has no inline flags; "s" lets "." match newlines
+			// and "u" makes it match whole code points, as in Go.
+			regex = strings.TrimPrefix(regex, "(?s)")
+			subject, err := t.operand(e.Subject, precConditional)
+			return "new RegExp(" + quote(regex) + ", \"su\").test(" + subject + ")", precPrimary, err
+		}
+		subject, err := t.operand(e.Subject, precPrimary)
+		return subject + ".matches(" + quote(regex) + ")", precPrimary, err
+
+	case *expressions.UnaryExpr:
+		operand, err := t.operand(e.Expr, precUnary)
+		if err != nil {
+			return "", 0, err
+		}
+		if e.Operator == tokens.TokenNot {
+			return "!" + operand, precUnary, nil
+		}
+		if strings.HasPrefix(operand, "-") {
+			return "- " + operand, precUnary, nil
+		}
+		return "-" + operand, precUnary, nil
+
+	case *expressions.DefaultExpr:
+		return t.fallback(e)
+
+	case *expressions.LetExpr:
+		return t.let(e)
+
+	case *expressions.IdentifierExpr:
+		return variableName(e.Name), precPrimary, nil
+
+	case *expressions.MemberAccessExpr:
+		target, err := t.operand(e.Target, precPrimary)
+		if err != nil {
+			return "", 0, err
+		}
+		s, err := t.parts(target, e.AccessParts, t.lenient)
+		return s, precPrimary, err
+
+	case *expressions.FunctionCallExpr:
+		return t.call(e)
+
+	case *expressions.ArrayLiteralExpr:
+		elements, err := t.args(e.Elements)
+		return "[" + strings.Join(elements, ", ") + "]", precPrimary, err
+
+	case *expressions.ObjectLiteralExpr:
+		fields := make([]string, len(e.Fields))
+		for i, field := range e.Fields {
+			value, err := t.operand(field.Value, precConditional)
+			if err != nil {
+				return "", 0, err
+			}
+			switch {
+			case field.KeyExpr == nil:
+				fields[i] = quote(field.Key) + ": " + value
+			case t.js():
+				key, err := t.operand(field.KeyExpr, precConditional)
+				if err != nil {
+					return "", 0, err
+				}
+				fields[i] = "[" + key + "]: " + value
+			default:
+				key, err := t.operand(field.KeyExpr, precConditional)
+				if err != nil {
+					return "", 0, err
+				}
+				fields[i] = key + ": " + value
+			}
+		}
+		return "{" + strings.Join(fields, ", ") + "}", precPrimary, nil
+
+	case *expressions.CustomInfixExpr:
+		return "", 0, t.unsupported("custom operator '"+e.Keyword+"'", e.Line, e.Column)
+
+	case *expressions.CustomPrefixExpr:
+		return "", 0, t.unsupported("custom operator '"+e.Keyword+"'", e.Line, e.Column)
+	}
+	line, column := expr.Pos()
+	return "", 0, t.unsupported(fmt.Sprintf("expression %s", expr.String()), line, column)
+}
+
+// operand translates expr, parenthesizing it when it binds less tightly
+// than minPrec.
+func (t *translator) operand(expr ast.Expression, minPrec int) (string, error) {
+	s, prec, err := t.render(expr)
+	if err != nil {
+		return "", err
+	}
+	if prec < minPrec {
+		return "(" + s + ")", nil
+	}
+	return s, nil
+}
+
+func (t *translator) args(exprs []ast.Expression) ([]string, error) {
+	out := make([]string, len(exprs))
+	for i, expr := range exprs {
+		s, err := t.operand(expr, precConditional)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = s
+	}
+	return out, nil
+}
+
+func (t *translator) literal(value interface{}, line, column int) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "null", nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case string:
+		return quote(v), nil
+	case float64:
+		s, err := formatFloat(v)
+		if err != nil {
+			return "", t.unsupported(fmt.Sprintf("number %v", v), line, column)
+		}
+		return s, nil
+	}
+	if types.IsInt(value) {
+		i, _ := types.ToInt(value)
+		return strconv.FormatInt(i, 10), nil
+	}
+	return "", t.unsupported(fmt.Sprintf("literal of type %T", value), line, column)
+}
+
+func (t *translator) contextRef(e *expressions.ContextExpr) (string, error) {
+	switch {
+	case e.Ident != nil && t.context != "":
+		return t.context + t.member(e.Ident.Name), nil
+	case e.Ident != nil:
+		if !isCELIdent(e.Ident.Name) {
+			return "", errors.NewTranslationError(fmt.Sprintf("context field '%s' is not a valid CEL identifier; set a context variable", e.Ident.Name), e.Line, e.Column)
+		}
+		return e.Ident.Name, nil
+	case t.context == "":
+		return "", errors.NewTranslationError("the context root is only available with a context variable", e.Line, e.Column)
+	case e.Subscript != nil:
+		key, err := t.operand(e.Subscript, precConditional)
+		return t.context + "[" + key + "]", err
+	}
+	return t.context, nil
+}
+
+// member renders field access by key, using dot notation where the target
+// language allows it.
+func (t *translator) member(key string) string {
+	if t.js() && isJSIdent(key) || !t.js() && isCELIdent(key) {
+		return "." + key
+	}
+	return "[" + quote(key) + "]"
+}
+
+// parts applies member access parts to the translated target s. A
+// wildcard maps the remaining parts over the array.
+func (t *translator) parts(s string, parts []expressions.MemberPart, lenient bool) (string, error) {
+	for i, part := range parts {
+		optional := part.Optional || lenient
+		if optional && !t.js() {
+			return "", t.unsupported("optional chaining", part.Line, part.Column)
+		}
+		if part.Recursive {
+			return "", t.unsupported("recursive descent", part.Line, part.Column)
+		}
+		prefix := ""
+		if optional {
+			prefix = "?."
+		}
+		switch {
+		case part.Wildcard:
+			rest := parts[i+1:]
+			if len(rest) == 0 {
+				return s, nil
+			}
+			variable := fmt.Sprintf("_e%d", t.depth)
+			t.depth++
+			body, err := t.parts(variable, rest, optional)
+			t.depth--
+			if err != nil {
+				return "", err
+			}
+			if t.js() {
+				if prefix == "" {
+					prefix = "."
+				}
+				return s + prefix + "map(" + variable + " => " + body + ")", nil
+			}
+			return s + ".map(" + variable + ", " + body + ")", nil
+		case part.IsIndex:
+			index, err := t.operand(part.Expr, precConditional)
+			if err != nil {
+				return "", err
+			}
+			s += prefix + "[" + index + "]"
+		default:
+			m := t.member(part.Key)
+			if optional && strings.HasPrefix(m, ".") {
+				s += "?" + m
+			} else {
+				s += prefix + m
+			}
+		}
+	}
+	return s, nil
+}
+
+// let binds a LET variable with an immediately invoked arrow function in
+// JavaScript and the cel.bind macro of the CEL bindings extension.
+func (t *translator) let(e *expressions.LetExpr) (string, int, error) {
+	value, err := t.operand(e.Value, precConditional)
+	if err != nil {
+		return "", 0, err
+	}
+	body, err := t.operand(e.Body, precConditional)
+	if err != nil {
+		return "", 0, err
+	}
+	name := variableName(e.Name)
+	if t.js() {
+		return "((" + name + ") => " + body + ")(" + value + ")", precPrimary, nil
+	}
+	return "cel.bind(" + name + ", " + value + ", " + body + ")", precPrimary, nil
+}
+
+// variableName names a LET variable in the output, apart from context
+// fields and the variables of projections.
+func variableName(name string) string {
+	return "_v_" + name
+}
+
+func (t *translator) binary(e *expressions.BinaryExpr) (string, int, error) {
+	if e.Operator == tokens.TokenMatch || e.Operator == tokens.TokenNotMatch {
+		var s string
+		if t.js() {
+			subject, err := t.operand(e.Left, precConditional)
+			if err != nil {
+				return "", 0, err
+			}
+			pattern, err := t.operand(e.Right, precConditional)
+			if err != nil {
+				return "", 0, err
+			}
+			s = "new RegExp(" + pattern + ").test(" + subject + ")"
+		} else {
+			subject, err := t.operand(e.Left, precPrimary)
+			if err != nil {
+				return "", 0, err
+			}
+			pattern, err := t.operand(e.Right, precConditional)
+			if err != nil {
+				return "", 0, err
+			}
+			s = subject + ".matches(" + pattern + ")"
+		}
+		if e.Operator == tokens.TokenNotMatch {
+			return "!" + s, precUnary, nil
+		}
+		return s, precPrimary, nil
+	}
+
+	prec := binaryPrecedence(e.Operator)
+	left, err := t.operand(e.Left, prec)
+	if err != nil {
+		return "", 0, err
+	}
+	right, err := t.operand(e.Right, prec+1)
+	if err != nil {
+		return "", 0, err
+	}
+	op := tokens.FixedTokenLiterals[e.Operator]
+	if e.Operator == tokens.TokenDivide && t.js() {
+		// LQL divides ints to an int and rejects mixed operands, where
+		// JavaScript always divides to a fraction.
+		switch kind := numericKind(e.Left); {
+		case kind == "" || kind != numericKind(e.Right):
+			return "", 0, t.unsupported("division of operands not known to be both ints or both floats", e.Line, e.Column)
+		case kind == "int":
+			return "Math.trunc(" + left + " / " + right + ")", precPrimary, nil
+		}
+	}
+	switch e.Operator {
+	case tokens.TokenAnd:
+		op = "&&"
+	case tokens.TokenOr:
+		op = "||"
+	case tokens.TokenEq, tokens.TokenNeq:
+		// A missing field is undefined in JavaScript; loose equality
+		// treats it as null, as LQL does.
+		if t.js() && !isNullLiteral(e.Left) && !isNullLiteral(e.Right) {
+			op += "="
+		}
+	}
+	return left + " " + op + " " + right, prec, nil
+}
+
+// fallback translates "?:". JavaScript uses "??" over a null-safe left
+// side. CEL guards each field of the left side with has() or "in".
+func (t *translator) fallback(e *expressions.DefaultExpr) (string, int, error) {
+	lenient := t.lenient
+	t.lenient = t.js()
+	left, err := t.operand(e.Expr, precUnary)
+	t.lenient = lenient
+	if err != nil {
+		return "", 0, err
+	}
+	right, err := t.operand(e.Fallback, precUnary)
+	if err != nil {
+		return "", 0, err
+	}
+	if t.js() {
+		return left + " ?? " + right, precConditional, nil
+	}
+	guards, err := t.presenceGuards(e.Expr)
+	if err != nil {
+		return "", 0, err
+	}
+	guards = append(guards, left+" != null")
+	return strings.Join(guards, " && ") + " ? " + left + " : " + right, precConditional, nil
+}
+
+// presenceGuards returns the CEL conditions under which every field read
+// by expr exists. Indexes are not guarded.
+func (t *translator) presenceGuards(expr ast.Expression) ([]string, error) {
+	var guards []string
+	var base string
+	var parts []expressions.MemberPart
+	switch e := expr.(type) {
+	case *expressions.ContextExpr:
+		if e.Ident == nil || t.context == "" {
+			return nil, nil
+		}
+		base = t.context
+		parts = []expressions.MemberPart{{Key: e.Ident.Name}}
+	case *expressions.MemberAccessExpr:
+		if ctxExpr, ok := e.Target.(*expressions.ContextExpr); ok && ctxExpr.Ident != nil && t.context != "" {
+			base = t.context
+			parts = append([]expressions.MemberPart{{Key: ctxExpr.Ident.Name}}, e.AccessParts...)
+		} else {
+			target, err := t.operand(e.Target, precPrimary)
+			if err != nil {
+				return nil, err
+			}
+			base = target
+			parts = e.AccessParts
+		}
+	default:
+		return nil, nil
+	}
+	for _, part := range parts {
+		key := part.Key
+		if part.IsIndex {
+			lit, ok := part.Expr.(*expressions.LiteralExpr)
+			if !ok {
+				break
+			}
+			if key, ok = lit.Value.(string); !ok {
+				break
+			}
+		} else if part.Wildcard || part.Recursive {
+			break
+		}
+		if isCELIdent(key) {
+			guards = append(guards, "has("+base+"."+key+")")
+		} else {
+			guards = append(guards, quote(key)+" in "+base)
+		}
+		base += t.member(key)
+	}
+	return guards, nil
+}
+
+// celMethods maps library functions to a method on their first argument.
+var celMethods = map[string]string{
+	"string.toLower":    "lowerAscii",
+	"string.toUpper":    "upperAscii",
+	"string.trim":       "trim",
+	"string.startsWith": "startsWith",
+	"string.endsWith":   "endsWith",
+	"string.contains":   "contains",
+	"string.split":      "split",
+	"string.join":       "join",
+	"string.replace":    "replace",
+	"string.indexOf":    "indexOf",
+}
+
+var jsMethods = map[string]string{
+	"string.toLower":    "toLowerCase",
+	"string.toUpper":    "toUpperCase",
+	"string.trim":       "trim",
+	"string.startsWith": "startsWith",
+	"string.endsWith":   "endsWith",
+	"string.contains":   "includes",
+	"string.split":      "split",
+	"string.join":       "join",
+	"string.indexOf":    "indexOf",
+	"array.contains":    "includes",
+}
+
+// celFunctions and jsFunctions map single-argument math functions.
+var celFunctions = map[string]string{
+	"math.abs":   "math.abs",
+	"math.floor": "math.floor",
+	"math.ceil":  "math.ceil",
+	"math.sqrt":  "math.sqrt",
+	"math.min":   "math.least",
+	"math.max":   "math.greatest",
+}
+
+var jsFunctions = map[string]string{
+	"math.abs":   "Math.abs",
+	"math.floor": "Math.floor",
+	"math.ceil":  "Math.ceil",
+	"math.sqrt":  "Math.sqrt",
+}
+
+func (t *translator) call(e *expressions.FunctionCallExpr) (string, int, error) {
+	name := strings.Join(e.Namespace, ".")
+	methods, functions := celMethods, celFunctions
+	if t.js() {
+		methods, functions = jsMethods, jsFunctions
+	}
+	switch {
+	case name == "string.replace" && t.js() && len(e.Args) == 3:
+		// string.replace without a limit replaces every occurrence.
+		return t.method(e.Args, "replaceAll")
+	case name == "string.replace" && !t.js() && (len(e.Args) == 3 || len(e.Args) == 4):
+		return t.method(e.Args, "replace")
+	case methods[name] != "" && name != "string.replace" && len(e.Args) >= 1:
+		return t.method(e.Args, methods[name])
+	case functions[name] != "" && len(e.Args) == 1:
+		args, err := t.args(e.Args)
+		return functions[name] + "(" + args[0] + ")", precPrimary, err
+	case t.js() && (name == "math.min" || name == "math.max") && len(e.Args) == 1:
+		arg, err := t.operand(e.Args[0], precConditional)
+		return "Math." + e.Namespace[1] + "(..." + arg + ")", precPrimary, err
+	case name == "string.concat" && len(e.Args) >= 1:
+		parts := make([]string, len(e.Args))
+		for i, arg := range e.Args {
+			minPrec := parser.SUM + 1
+			if i == 0 {
+				minPrec = parser.SUM
+			}
+			s, err := t.operand(arg, minPrec)
+			if err != nil {
+				return "", 0, err
+			}
+			parts[i] = s
+		}
+		if len(parts) == 1 {
+			return parts[0], precPrimary, nil
+		}
+		return strings.Join(parts, " + "), parser.SUM, nil
+	case name == "regex.match" && len(e.Args) == 2:
+		return t.binary(&expressions.BinaryExpr{Left: e.Args[1], Operator: tokens.TokenMatch, Right: e.Args[0], Line: e.Line, Column: e.Column})
+	case name == "array.contains" && !t.js() && len(e.Args) == 2:
+		element, err := t.operand(e.Args[1], parser.GTR+1)
+		if err != nil {
+			return "", 0, err
+		}
+		array, err := t.operand(e.Args[0], parser.GTR+1)
+		return element + " in " + array, parser.GTR, err
+	case name == "cond.ifExpr" && len(e.Args) == 3:
+		parts := make([]string, 3)
+		for i, arg := range e.Args {
+			s, err := t.operand(arg, parser.LOWEST)
+			if err != nil {
+				return "", 0, err
+			}
+			parts[i] = s
+		}
+		return parts[0] + " ? " + parts[1] + " : " + parts[2], precConditional, nil
+	case name == "cond.coalesce" && len(e.Args) >= 1:
+		args := make([]string, len(e.Args))
+		for i, arg := range e.Args {
+			s, err := t.operand(arg, precUnary)
+			if err != nil {
+				return "", 0, err
+			}
+			args[i] = s
+		}
+		if len(args) == 1 {
+			return args[0], precUnary, nil
+		}
+		if t.js() {
+			return strings.Join(args, " ?? "), precConditional, nil
+		}
+		s := args[len(args)-1]
+		for i := len(args) - 2; i >= 0; i-- {
+			s = args[i] + " != null ? " + args[i] + " : " + s
+		}
+		return s, precConditional, nil
+	}
+	return "", 0, t.unsupported(fmt.Sprintf("%s with %d argument(s)", name, len(e.Args)), e.Line, e.Column)
+}
+
+// method renders a call as a method on its first argument.
+func (t *translator) method(args []ast.Expression, method string) (string, int, error) {
+	receiver, err := t.operand(args[0], precPrimary)
+	if err != nil {
+		return "", 0, err
+	}
+	rest, err := t.args(args[1:])
+	if err != nil {
+		return "", 0, err
+	}
+	return receiver + "." + method + "(" + strings.Join(rest, ", ") + ")", precPrimary, nil
+}
+
+// numericKind returns "int" or "float" when expr always evaluates to a
+// number of that kind, and "" when its type is not known statically.
+func numericKind(expr ast.Expression) string {
+	switch e := expr.(type) {
+	case *expressions.LiteralExpr:
+		if types.IsInt(e.Value) {
+			return "int"
+		}
+		if _, ok := e.Value.(float64); ok {
+			return "float"
+		}
+	case *expressions.UnaryExpr:
+		if e.Operator == tokens.TokenMinus {
+			return numericKind(e.Expr)
+		}
+	case *expressions.BinaryExpr:
+		switch e.Operator {
+		case tokens.TokenPlus, tokens.TokenMinus, tokens.TokenMultiply, tokens.TokenDivide:
+			if kind := numericKind(e.Left); kind == numericKind(e.Right) {
+				return kind
+			}
+		}
+	}
+	return ""
+}
+
+func isNullLiteral(expr ast.Expression) bool {
+	lit, ok := expr.(*expressions.LiteralExpr)
+	return ok && lit.Value == nil
+}
+
+// quote renders s as a double-quoted string literal valid in both CEL and
+// JavaScript.
+func quote(s string) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(s)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// celReserved lists the words CEL reserves as identifiers.
+var celReserved = map[string]bool{
+	"true": true, "false": true, "null": true, "in": true, "as": true,
+	"break": true, "const": true, "continue": true, "else": true,
+	"for": true, "function": true, "if": true, "import": true, "let": true,
+	"loop": true, "package": true, "namespace": true, "return": true,
+	"var": true, "void": true, "while": true,
+}
+
+func isCELIdent(key string) bool {
+	return isJSIdent(key) && !strings.Contains(key, "$") && !celReserved[key]
+}
+
+// isJSIdent reports whether key may follow a dot in JavaScript. Reserved
+// words are allowed as property names.
+func isJSIdent(key string) bool {
+	if key == "" {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		ch := key[i]
+		letter := ('a' <= ch && ch <= 'z') || ('A' <= ch && ch <= 'Z') || ch == '_' || ch == '$'
+		digit := '0' <= ch && ch <= '9'
+		if !letter && !(digit && i > 0) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,82 @@
+package lql
+
+import (
+	"github.com/SpecDrivenDesign/lql/pkg/errors"
+	"testing"
+)
+
+func TestTranslate(t *testing.T) {
+	tests := []struct {
+		src, cel, js string
+	}{
+		{`$a AND $b OR NOT $c`, `a && b || !c`, `ctx.a && ctx.b || !ctx.c`},
+		{`($a OR $b) AND $c`, `(a || b) && c`, `(ctx.a || ctx.b) && ctx.c`},
+		{`$user.age >= 18 AND $user.name != "bob"`, `user.age >= 18 && user.name != "bob"`, `ctx.user.age >= 18 && ctx.user.name !== "bob"`},
+		{`$x == null`, `x == null`, `ctx.x == null`},
+		{`$a - (1 - 2)`, `a - (1 - 2)`, `ctx.a - (1 - 2)`},
+		{`7 / 2`, `7 / 2`, `Math.trunc(7 / 2)`},
+		{`(1 + 2) / -3`, `(1 + 2) / -3`, `Math.trunc((1 + 2) / -3)`},
+		{`7.0 / 2.0`, `7.0 / 2.0`, `7.0 / 2.0`},
+		{`$s =~ "^a+$"`, `s.matches("^a+$")`, `new RegExp("^a+$").test(ctx.s)`},
+		{`$s !~ "b"`, `!s.matches("b")`, `!new RegExp("b").test(ctx.s)`},
+		{`$s LIKE "a%"`, `s.matches("(?s)^a.*$")`, `new RegExp("^a.*$", "su").test(ctx.s)`},
+		{`$a.b ?: "x"`, `has(a.b) && a.b != null ? a.b : "x"`, `ctx.a?.b ?? "x"`},
+		{`$items[*].price`, `items.map(_e0, _e0.price)`, `ctx.items.map(_e0 => _e0.price)`},
+		{`LET x = 1 + 2 IN x * 2`, `cel.bind(_v_x, 1 + 2, _v_x * 2)`, `((_v_x) => _v_x * 2)(1 + 2)`},
+		{`string.toLower($name) == "ann"`, `name.lowerAscii() == "ann"`, `ctx.name.toLowerCase() === "ann"`},
+		{`string.concat($a, "-", $b)`, `a + "-" + b`, `ctx.a + "-" + ctx.b`},
+		{`regex.match("^x", $s)`, `s.matches("^x")`, `new RegExp("^x").test(ctx.s)`},
+		{`array.contains($tags, "vip")`, `"vip" in tags`, `ctx.tags.includes("vip")`},
+		{`math.abs($n) > 1`, `math.abs(n) > 1`, `Math.abs(ctx.n) > 1`},
+		{`cond.ifExpr($a, 1, 2)`, `a ? 1 : 2`, `ctx.a ? 1 : 2`},
+		{`cond.coalesce($a, $b, 0)`, `a != null ? a : b != null ? b : 0`, `ctx.a ?? ctx.b ?? 0`},
+	}
+	for _, tt := range tests {
+		if got, err := TranslateSource(tt.src, TargetCEL, TranslateOptions{}); err != nil || got != tt.cel {
+			t.Errorf("%s: CEL %q, %v; want %q", tt.src, got, err, tt.cel)
+		}
+		if got, err := TranslateSource(tt.src, TargetJavaScript, TranslateOptions{}); err != nil || got != tt.js {
+			t.Errorf("%s: JavaScript %q, %v; want %q", tt.src, got, err, tt.js)
+		}
+	}
+}
+
+func TestTranslateUnsupported(t *testing.T) {
+	tests := []struct {
+		src          string
+		target       Target
+		line, column int
+	}{
+		{`$a..b`, TargetCEL, 1, 5},
+		{`$a..b`, TargetJavaScript, 1, 5},
+		{`math.pow(2, 3)`, TargetCEL, 1, 1},
+		{`math.pow(2, 3)`, TargetJavaScript, 1, 1},
+		{`$s LIKE $p`, TargetJavaScript, 1, 9},
+		{`$a?.b`, TargetCEL, 1, 5},
+		{`$`, TargetCEL, 1, 1},
+		// The types of the operands decide how JavaScript must divide.
+		{`$a / 2`, TargetJavaScript, 1, 4},
+		{`1 / 2.0`, TargetJavaScript, 1, 3},
+	}
+	for _, tt := range tests {
+		got, err := TranslateSource(tt.src, tt.target, TranslateOptions{})
+		transErr, ok := err.(*errors.TranslationError)
+		if !ok {
+			t.Errorf("%s: %v got %q, %v; want a TranslationError", tt.src, tt.target, got, err)
+			continue
+		}
+		if transErr.Line != tt.line || transErr.Column != tt.column {
+			t.Errorf("%s: %v error at %d:%d, want %d:%d", tt.src, tt.target, transErr.Line, transErr.Column, tt.line, tt.column)
+		}
+	}
+}
+
+func TestTranslateContextVariable(t *testing.T) {
+	opts := TranslateOptions{Context: "input"}
+	if got, err := TranslateSource(`$user.age > 1`, TargetCEL, opts); err != nil || got != `input.user.age > 1` {
+		t.Errorf("CEL %q, %v", got, err)
+	}
+	if got, err := TranslateSource(`$user.age > 1`, TargetJavaScript, opts); err != nil || got != `input.user.age > 1` {
+		t.Errorf("JavaScript %q, %v", got, err)
+	}
+}
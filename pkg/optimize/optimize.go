@@ -0,0 +1,95 @@
+// Package optimize rewrites parsed expressions into cheaper equivalent forms.
+package optimize
+
+import (
+	"github.com/SpecDrivenDesign/lql/pkg/ast"
+	"github.com/SpecDrivenDesign/lql/pkg/ast/expressions"
+	"github.com/SpecDrivenDesign/lql/pkg/tokens"
+)
+
+// SimplifyBooleans folds boolean literals out of AND, OR and NOT:
+//
+//	false AND x  →  false        true OR x   →  true
+//	true AND x   →  x            false OR x  →  x
+//	NOT true     →  false        NOT NOT x   →  x
+//
+// Rules that drop an operand only apply where the evaluator would not have
+// evaluated it anyway, or where the remaining operand is itself known to
+// yield a boolean, so runtime type errors are preserved. The input tree is
+// not modified.
+func SimplifyBooleans(expr ast.Expression) ast.Expression {
+	return ast.Rewrite(expr, simplifyNode)
+}
+
+func simplifyNode(node ast.Expression) ast.Expression {
+	switch n := node.(type) {
+	case *expressions.BinaryExpr:
+		switch n.Operator {
+		case tokens.TokenAnd:
+			return simplifyLogical(n, false)
+		case tokens.TokenOr:
+			return simplifyLogical(n, true)
+		}
+	case *expressions.UnaryExpr:
+		if n.Operator != tokens.TokenNot {
+			return n
+		}
+		if b, ok := boolLiteral(n.Expr); ok {
+			return &expressions.LiteralExpr{Value: !b, Line: n.Line, Column: n.Column}
+		}
+		if inner, ok := n.Expr.(*expressions.UnaryExpr); ok && inner.Operator == tokens.TokenNot && isBoolean(inner.Expr) {
+			return inner.Expr
+		}
+	}
+	return node
+}
+
+// simplifyLogical folds a literal operand of AND (dominant=false) or OR
+// (dominant=true). The dominant value short-circuits the operator; the
+// other value is the identity.
+func simplifyLogical(n *expressions.BinaryExpr, dominant bool) ast.Expression {
+	if b, ok := boolLiteral(n.Left); ok {
+		if b == dominant {
+			return &expressions.LiteralExpr{Value: dominant, Line: n.Line, Column: n.Column}
+		}
+		if isBoolean(n.Right) {
+			return n.Right
+		}
+		return n
+	}
+	if b, ok := boolLiteral(n.Right); ok && b != dominant && isBoolean(n.Left) {
+		return n.Left
+	}
+	return n
+}
+
+func boolLiteral(expr ast.Expression) (bool, bool) {
+	lit, ok := expr.(*expressions.LiteralExpr)
+	if !ok {
+		return false, false
+	}
+	b, ok := lit.Value.(bool)
+	return b, ok
+}
+
+// isBoolean reports whether expr always yields a boolean when it evaluates
+// without error.
+func isBoolean(expr ast.Expression) bool {
+	switch e := expr.(type) {
+	case *expressions.LiteralExpr:
+		_, ok := e.Value.(bool)
+		return ok
+	case *expressions.UnaryExpr:
+		return e.Operator == tokens.TokenNot
+	case *expressions.LikeExpr, *expressions.BetweenExpr:
+		return true
+	case *expressions.BinaryExpr:
+		switch e.Operator {
+		case tokens.TokenAnd, tokens.TokenOr, tokens.TokenEq, tokens.TokenNeq,
+			tokens.TokenLt, tokens.TokenGt, tokens.TokenLte, tokens.TokenGte,
+			tokens.TokenMatch, tokens.TokenNotMatch:
+			return true
+		}
+	}
+	return false
+}
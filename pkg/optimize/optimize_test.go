@@ -0,0 +1,70 @@
+package optimize
+
+import (
+	"github.com/SpecDrivenDesign/lql/pkg/env"
+	"testing"
+)
+
+func TestSimplifyBooleans(t *testing.T) {
+	tests := []struct {
+		src, want string
+	}{
+		{`false AND $a`, `false`},
+		{`true AND $a > 1`, `$a > 1`},
+		{`$a > 1 AND true`, `$a > 1`},
+		{`true OR $a`, `true`},
+		{`false OR $a == 1`, `$a == 1`},
+		{`$a == 1 OR false`, `$a == 1`},
+		{`NOT true`, `false`},
+		{`NOT false`, `true`},
+		{`NOT NOT ($a > 1)`, `$a > 1`},
+		{`NOT NOT ($a LIKE "x%")`, `$a like "x%"`},
+		// Rewrites apply bottom-up.
+		{`true AND (false OR $a < 2)`, `$a < 2`},
+		{`NOT (true AND false) OR $a`, `true`},
+		{`$a < 1 AND (true OR $b)`, `$a < 1`},
+	}
+	for _, tt := range tests {
+		if got := SimplifyBooleans(parse(t, tt.src)).String(); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestSimplifyBooleansKeepsRuntimeErrors(t *testing.T) {
+	tests := []string{
+		// The remaining operand may not be a boolean, which AND and OR
+		// reject.
+		`true AND 5`,
+		`true AND $a`,
+		`false OR "x"`,
+		`$a AND true`,
+		// NOT NOT rejects a non-boolean.
+		`NOT NOT 5`,
+		`NOT NOT $a`,
+		// The left operand is evaluated first and may fail.
+		`$a AND false`,
+		`$a OR true`,
+	}
+	for _, src := range tests {
+		if got := SimplifyBooleans(parse(t, src)).String(); got != src {
+			t.Errorf("%s was rewritten to %s", src, got)
+		}
+	}
+	for _, src := range []string{`true AND 5`, `NOT NOT 5`} {
+		if _, err := SimplifyBooleans(parse(t, src)).Eval(map[string]interface{}{}, env.NewEnvironment()); err == nil {
+			t.Errorf("%s no longer fails", src)
+		}
+	}
+}
+
+func TestSimplifyBooleansDoesNotModifyInput(t *testing.T) {
+	expr := parse(t, `true AND NOT NOT ($a > 1)`)
+	before := expr.String()
+	if got := SimplifyBooleans(expr).String(); got != `$a > 1` {
+		t.Fatalf("got %s", got)
+	}
+	if expr.String() != before {
+		t.Errorf("input changed to %s", expr.String())
+	}
+}
@@ -0,0 +1,275 @@
+package optimize
+
+import (
+	stdErrors "errors"
+	"github.com/SpecDrivenDesign/lql/pkg/analyze"
+	"github.com/SpecDrivenDesign/lql/pkg/ast"
+	"github.com/SpecDrivenDesign/lql/pkg/ast/expressions"
+	"github.com/SpecDrivenDesign/lql/pkg/env"
+	"github.com/SpecDrivenDesign/lql/pkg/errors"
+	"github.com/SpecDrivenDesign/lql/pkg/tokens"
+	"github.com/SpecDrivenDesign/lql/pkg/types"
+	"sort"
+	"strings"
+)
+
+// PartialEval evaluates every subtree of expr that can be computed from the
+// partial context ctx and replaces it with its value, returning the residual
+// expression. Use it to pre-bind values known ahead of time, such as
+// tenant-level settings, and evaluate the residual per request:
+//
+//	residual := optimize.PartialEval(expr, map[string]interface{}{"tenant": tenant}, env)
+//	result, err := residual.Eval(request, env)
+//
+// A context field is bound only if its top-level name is present in ctx. AND
+// and OR fold as they would short-circuit, and "?:" folds once its left side
+// is known. Calls are folded only when every argument is known and the
+// function is neither capability-gated nor in a side-effect library, so
+// time.now() and effectful host calls still run at evaluation time. A
+// subtree whose evaluation fails, or whose value cannot be written as a
+// literal, is kept so the error or value appears in the final evaluation.
+// The input tree is not modified.
+func PartialEval(expr ast.Expression, ctx map[string]interface{}, environment *env.Environment) ast.Expression {
+	return PartialEvalIn(expr, ctx, nil, environment)
+}
+
+// PartialEvalIn is PartialEval with the roots of scope (see env.NewScope)
+// known as well as ctx, so that a root known ahead of time, such as $env,
+// is bound.
+func PartialEvalIn(expr ast.Expression, ctx map[string]interface{}, scope *env.Scope, environment *env.Environment) ast.Expression {
+	p := &partialEvaluator{ctx: ctx, scope: scope, env: environment}
+	return ast.Rewrite(expr, p.fold)
+}
+
+type partialEvaluator struct {
+	ctx   map[string]interface{}
+	scope *env.Scope
+	env   *env.Environment
+}
+
+func (p *partialEvaluator) fold(node ast.Expression) ast.Expression {
+	switch n := node.(type) {
+	case *expressions.ContextExpr:
+		if !p.bound(n) {
+			return n
+		}
+		return p.evaluate(n)
+
+	case *expressions.MemberAccessExpr:
+		if !p.closed(n) {
+			return n
+		}
+		return p.evaluate(n)
+
+	case *expressions.BinaryExpr:
+		switch n.Operator {
+		case tokens.TokenAnd, tokens.TokenOr:
+			if isConstant(n.Left) && isConstant(n.Right) {
+				return p.evaluate(n)
+			}
+			return simplifyNode(n)
+		}
+		if isConstant(n.Left) && isConstant(n.Right) {
+			return p.evaluate(n)
+		}
+
+	case *expressions.UnaryExpr:
+		if isConstant(n.Expr) {
+			return p.evaluate(n)
+		}
+
+	case *expressions.LikeExpr:
+		if isConstant(n.Subject) && isConstant(n.Pattern) {
+			return p.evaluate(n)
+		}
+
+	case *expressions.BetweenExpr:
+		if isConstant(n.Subject) && isConstant(n.Low) && isConstant(n.High) {
+			return p.evaluate(n)
+		}
+
+	case *expressions.DefaultExpr:
+		if access, ok := n.Expr.(*expressions.MemberAccessExpr); ok && p.closed(access) {
+			// The access was left in place because it failed; "?:" turns a
+			// missing field or index into the fallback.
+			_, err := expressions.EvalIn(access, p.ctx, p.scope, p.env)
+			var refErr *errors.ReferenceError
+			var boundsErr *errors.ArrayOutOfBoundsError
+			if stdErrors.As(err, &refErr) || stdErrors.As(err, &boundsErr) {
+				return n.Fallback
+			}
+			return n
+		}
+		if !isConstant(n.Expr) {
+			return n
+		}
+		if lit, ok := n.Expr.(*expressions.LiteralExpr); ok && lit.Value == nil {
+			return n.Fallback
+		}
+		return n.Expr
+
+	case *expressions.LetExpr:
+		// A body folded to a constant no longer reads the variable.
+		if isConstant(n.Value) && isConstant(n.Body) {
+			return n.Body
+		}
+		return n
+
+	case *expressions.FunctionCallExpr:
+		if !p.pure(n) {
+			return n
+		}
+		for _, arg := range n.Args {
+			if !isConstant(arg) {
+				return n
+			}
+		}
+		return p.evaluate(n)
+
+	case *expressions.ObjectLiteralExpr:
+		// Static fields are already constant; fold computed keys.
+		computed := false
+		for _, field := range n.Fields {
+			if field.KeyExpr != nil {
+				if !isConstant(field.KeyExpr) {
+					return n
+				}
+				computed = true
+			}
+			if !isConstant(field.Value) {
+				return n
+			}
+		}
+		if computed {
+			return p.evaluate(n)
+		}
+	}
+	return node
+}
+
+// pure reports whether a call may be evaluated ahead of time.
+func (p *partialEvaluator) pure(call *expressions.FunctionCallExpr) bool {
+	if len(call.Namespace) != 2 {
+		return false
+	}
+	lib := call.Namespace[0]
+	if _, ok := p.env.GetLibrary(lib); !ok {
+		return false
+	}
+	if p.env.SideEffectLibraries[lib] {
+		return false
+	}
+	if !analyze.AnalyzePurity(call, analyze.PurityOptions{}).Deterministic() {
+		return false
+	}
+	_, gated := p.env.FunctionCapabilities[strings.Join(call.Namespace, ".")]
+	return !gated
+}
+
+// evaluate replaces node with its value, or keeps it if it fails.
+func (p *partialEvaluator) evaluate(node ast.Expression) ast.Expression {
+	value, err := expressions.EvalIn(node, p.ctx, p.scope, p.env)
+	if err != nil {
+		return node
+	}
+	line, column := node.Pos()
+	if lit, ok := valueExpr(value, line, column); ok {
+		return lit
+	}
+	return node
+}
+
+// valueExpr builds a literal expression producing value. Arrays and objects
+// become array and object literals; values with no literal form, such as
+// times, are reported with ok=false.
+func valueExpr(value interface{}, line, column int) (ast.Expression, bool) {
+	switch v := value.(type) {
+	case nil, bool, string, int64, float64:
+		return &expressions.LiteralExpr{Value: v, Line: line, Column: column}, true
+	}
+	if types.IsInt(value) {
+		i, _ := types.ToInt(value)
+		return &expressions.LiteralExpr{Value: i, Line: line, Column: column}, true
+	}
+	if f, ok := types.ToFloat(value); ok {
+		return &expressions.LiteralExpr{Value: f, Line: line, Column: column}, true
+	}
+	if arr, ok := types.ConvertToInterfaceSlice(value); ok {
+		elements := make([]ast.Expression, len(arr))
+		for i, elem := range arr {
+			e, ok := valueExpr(elem, line, column)
+			if !ok {
+				return nil, false
+			}
+			elements[i] = e
+		}
+		return &expressions.ArrayLiteralExpr{Elements: elements, Line: line, Column: column}, true
+	}
+	if obj, ok := types.ConvertToStringMap(value); ok {
+		keys := make([]string, 0, len(obj))
+		for k := range obj {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		fields := make([]expressions.ObjectField, len(keys))
+		for i, k := range keys {
+			e, ok := valueExpr(obj[k], line, column)
+			if !ok {
+				return nil, false
+			}
+			fields[i] = expressions.ObjectField{Key: k, Value: e, Line: line, Column: column}
+		}
+		return &expressions.ObjectLiteralExpr{Fields: fields, Line: line, Column: column}, true
+	}
+	return nil, false
+}
+
+// closed reports whether a member access depends only on constants and on
+// context fields bound in ctx. A bound field whose value has no literal
+// form, such as an object holding a time, is left in place, but the
+// fields read from it may still fold.
+func (p *partialEvaluator) closed(access *expressions.MemberAccessExpr) bool {
+	if !isConstant(access.Target) && !p.bound(access.Target) {
+		return false
+	}
+	for _, part := range access.AccessParts {
+		if part.Expr != nil && !isConstant(part.Expr) {
+			return false
+		}
+	}
+	return true
+}
+
+// bound reports whether expr is a context field present in ctx.
+func (p *partialEvaluator) bound(expr ast.Expression) bool {
+	ref, ok := expr.(*expressions.ContextExpr)
+	if !ok || ref.Ident == nil {
+		return false
+	}
+	_, ok = p.scope.Lookup(p.ctx, ref.Ident.Name)
+	return ok
+}
+
+// isConstant reports whether expr is a literal, or an array or object
+// literal built only from constants.
+func isConstant(expr ast.Expression) bool {
+	switch e := expr.(type) {
+	case *expressions.LiteralExpr:
+		return true
+	case *expressions.ArrayLiteralExpr:
+		for _, elem := range e.Elements {
+			if !isConstant(elem) {
+				return false
+			}
+		}
+		return true
+	case *expressions.ObjectLiteralExpr:
+		for _, field := range e.Fields {
+			if field.KeyExpr != nil || !isConstant(field.Value) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
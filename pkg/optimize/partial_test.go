@@ -0,0 +1,107 @@
+package optimize
+
+import (
+	stdErrors "errors"
+	"github.com/SpecDrivenDesign/lql/pkg/ast"
+	"github.com/SpecDrivenDesign/lql/pkg/env"
+	"github.com/SpecDrivenDesign/lql/pkg/errors"
+	"github.com/SpecDrivenDesign/lql/pkg/lexer"
+	"github.com/SpecDrivenDesign/lql/pkg/parser"
+	"testing"
+	"time"
+)
+
+func parse(t *testing.T, src string) ast.Expression {
+	t.Helper()
+	p, err := parser.NewParser(lexer.NewLexer(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expr, err := p.ParseExpression()
+	if err != nil {
+		t.Fatalf("%s: %v", src, err)
+	}
+	return expr
+}
+
+func TestPartialEval(t *testing.T) {
+	ctx := map[string]interface{}{
+		"tenant": map[string]interface{}{
+			"limit":  int64(20),
+			"vip":    true,
+			"name":   "acme",
+			"secret": "s",
+			"zero":   int64(0),
+			"start":  time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+	}
+	tests := []struct {
+		src, want string
+	}{
+		// AND and OR fold as they would short-circuit.
+		{`$tenant.limit > 10 AND $req.amount < 5`, `$req.amount < 5`},
+		{`$tenant.limit > 100 AND $req.amount < 5`, `false`},
+		{`$req.amount < 5 AND $tenant.limit > 100`, `$req.amount < 5 AND false`},
+		{`$tenant.vip OR $req.x`, `true`},
+		{`NOT $tenant.vip OR $req.x > 1`, `$req.x > 1`},
+		// An operand that may not be a boolean keeps its operator.
+		{`$tenant.vip AND $tenant.limit`, `true AND 20`},
+		// "?:" folds once its left side is known.
+		{`$tenant.missing ?: "x"`, `"x"`},
+		{`$tenant.name ?: "x"`, `"acme"`},
+		{`$req.a ?: $tenant.limit`, `$req.a ?: 20`},
+		{`cond.ifExpr($tenant.vip, $req.a, $req.b)`, `cond.ifExpr(true, $req.a, $req.b)`},
+		{`string.toUpper($tenant.name) == $req.name`, `"ACME" == $req.name`},
+		{`[$tenant.limit, $req.a]`, `[20, $req.a]`},
+		// The clock, random functions and gated calls run at evaluation.
+		{`time.now() > $req.t`, `time.now() > $req.t`},
+		{`random.token(4) == $req.t`, `random.token(4) == $req.t`},
+		{`jwt.verifyHmac($req.token, $tenant.secret)`, `jwt.verifyHmac($req.token, "s")`},
+		// A time has no literal form, but the fields beside it fold.
+		{`time.parse("2024-01-01", "dateOnly") < $req.t`, `time.parse("2024-01-01", "dateOnly") < $req.t`},
+		{`$tenant.start < $req.t AND $tenant.limit > 1`, `$tenant.start < $req.t`},
+		{`$tenant.vip`, `true`},
+		{`$tenant`, `$tenant`},
+	}
+	for _, tt := range tests {
+		if got := PartialEval(parse(t, tt.src), ctx, env.NewEnvironment()).String(); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestPartialEvalKeepsFailingSubtrees(t *testing.T) {
+	e := env.NewEnvironment()
+	tenant := map[string]interface{}{"tenant": map[string]interface{}{"limit": int64(20), "zero": int64(0)}}
+	residual := PartialEval(parse(t, `$tenant.limit / $tenant.zero > $req.x`), tenant, e)
+	if got, want := residual.String(), `20 / 0 > $req.x`; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+	// The error appears when the residual is evaluated.
+	_, err := residual.Eval(map[string]interface{}{"req": map[string]interface{}{"x": int64(1)}}, e)
+	var divErr *errors.DivideByZeroError
+	if !stdErrors.As(err, &divErr) {
+		t.Errorf("got %v, want a DivideByZeroError", err)
+	}
+}
+
+func TestPartialEvalIn(t *testing.T) {
+	scope := env.NewScope(map[string]interface{}{"env": map[string]interface{}{"region": "eu"}})
+	expr := parse(t, `$env.region == "eu" AND $user.age > 17`)
+	got := PartialEvalIn(expr, map[string]interface{}{}, scope, env.NewEnvironment()).String()
+	if want := `$user.age > 17`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestPartialEvalDoesNotModifyInput(t *testing.T) {
+	expr := parse(t, `$tenant.limit > 10 AND ($req.a ?: $tenant.limit) > 1`)
+	before, fingerprint := expr.String(), ast.Fingerprint(expr)
+	residual := PartialEval(expr, map[string]interface{}{"tenant": map[string]interface{}{"limit": int64(20)}}, env.NewEnvironment())
+	if residual.String() == before {
+		t.Fatalf("nothing was folded in %s", before)
+	}
+	if expr.String() != before || ast.Fingerprint(expr) != fingerprint {
+		t.Errorf("input changed to %s", expr.String())
+	}
+}
@@ -1,8 +1,111 @@
 package param
 
+import "strings"
+
 // Arg represents an argument passed to a library function.
 type Arg struct {
 	Value  interface{}
 	Line   int
 	Column int
 }
+
+// LazyArg is an argument that a library function evaluates only if it needs
+// its value.
+type LazyArg struct {
+	Line   int
+	Column int
+	// Eval evaluates the argument expression.
+	Eval func() (interface{}, error)
+	// EvalWith evaluates the argument expression with the variable item
+	// bound to value, so that functions such as array.filterExpr can apply
+	// an expression to each element of an array. It is nil for arguments
+	// that were evaluated in advance.
+	EvalWith func(value interface{}) (interface{}, error)
+}
+
+// Lazy wraps already evaluated arguments as lazy ones.
+func Lazy(args []Arg) []LazyArg {
+	lazy := make([]LazyArg, len(args))
+	for i, arg := range args {
+		value := arg.Value
+		lazy[i] = LazyArg{Line: arg.Line, Column: arg.Column, Eval: func() (interface{}, error) { return value, nil }}
+	}
+	return lazy
+}
+
+// Types of parameters and results, as static analysis names them.
+const (
+	TypeAny     = "any"
+	TypeNumeric = "numeric"
+	TypeString  = "string"
+	TypeBoolean = "boolean"
+	TypeArray   = "array"
+	TypeObject  = "object"
+	TypeTime    = "Time"
+)
+
+// Param describes a parameter of a library function.
+type Param struct {
+	Name string `json:"name"`
+	// Type is the type the argument must have, one of the Type constants.
+	Type string `json:"type"`
+	// Optional marks a parameter that may be left out. Only trailing
+	// parameters are optional.
+	Optional bool `json:"optional,omitempty"`
+	// Variadic marks a last parameter that may be repeated.
+	Variadic bool `json:"variadic,omitempty"`
+}
+
+// Function describes a library function for documentation, completion and
+// validation of calls.
+type Function struct {
+	Name   string  `json:"name"`
+	Params []Param `json:"params"`
+	// Result is the type of the result, or TypeAny when it depends on the
+	// arguments.
+	Result string `json:"result"`
+	Doc    string `json:"doc"`
+}
+
+// MinArgs returns the number of arguments a call must pass.
+func (f Function) MinArgs() int {
+	n := 0
+	for _, p := range f.Params {
+		if !p.Optional {
+			n++
+		}
+	}
+	return n
+}
+
+// MaxArgs returns the number of arguments a call may pass, or -1 if the
+// function is variadic.
+func (f Function) MaxArgs() int {
+	if len(f.Params) > 0 && f.Params[len(f.Params)-1].Variadic {
+		return -1
+	}
+	return len(f.Params)
+}
+
+// Usage returns how to call the function from library, such as
+// "math.sum(arr[, subfield][, defaultVal])".
+func (f Function) Usage(library string) string {
+	var b strings.Builder
+	b.WriteString(library + "." + f.Name + "(")
+	for i, p := range f.Params {
+		sep := ""
+		if i > 0 {
+			sep = ", "
+		}
+		switch {
+		case p.Optional:
+			b.WriteString("[" + sep + p.Name + "]")
+		case p.Variadic:
+			b.WriteString(sep + p.Name + ", ...")
+		default:
+			b.WriteString(sep + p.Name)
+		}
+	}
+	b.WriteString(")")
+	return b.String()
+}
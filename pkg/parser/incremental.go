@@ -0,0 +1,333 @@
+package parser
+
+import (
+	"fmt"
+	"github.com/SpecDrivenDesign/lql/pkg/ast"
+	"github.com/SpecDrivenDesign/lql/pkg/ast/expressions"
+	"github.com/SpecDrivenDesign/lql/pkg/env"
+	"github.com/SpecDrivenDesign/lql/pkg/lexer"
+	"github.com/SpecDrivenDesign/lql/pkg/tokens"
+)
+
+// Grammar levels at which spans are recorded, outermost first. A node is
+// recorded at the outermost level that returned it, which is the level its
+// parent asked for, so reparsing its tokens at that level fits the parent.
+const (
+	levelOr = iota
+	levelAnd
+	levelEquality
+	levelRelational
+	levelAdditive
+	levelMultiplicative
+	levelUnary
+	levelMember
+	levelPrimary
+)
+
+// span is the range of tokens [start, end) a node was parsed from and the
+// grammar level that produced it.
+type span struct {
+	start, end int
+	level      int
+}
+
+// index returns the position of the current token in the stream.
+func (p *Parser) index() int {
+	return p.consumed - 2
+}
+
+// record notes that expr was parsed at level from the token at start up to
+// the current token, when spans are being recorded. Only the parsers of a
+// Document record spans; the parse functions defer recordSpan only then,
+// so other parses pay for neither the defers nor the map.
+func (p *Parser) record(level, start int, expr ast.Expression) {
+	if p.spans != nil && expr != nil {
+		p.spans[expr] = span{start: start, end: p.index(), level: level}
+	}
+}
+
+// recordSpan is record for use in a defer, when the node is not yet known.
+func (p *Parser) recordSpan(level, start int, expr *ast.Expression) {
+	p.record(level, start, *expr)
+}
+
+// parseLevel parses one expression at the given grammar level.
+func (p *Parser) parseLevel(level int) (ast.Expression, error) {
+	switch level {
+	case levelAnd:
+		return p.parseAndExpression()
+	case levelEquality:
+		return p.parseEqualityExpression()
+	case levelRelational:
+		return p.parseRelationalExpression()
+	case levelAdditive:
+		return p.parseAdditiveExpression()
+	case levelMultiplicative:
+		return p.parseMultiplicativeExpression()
+	case levelUnary:
+		return p.parseUnaryExpression()
+	case levelMember:
+		return p.parseMemberAccessExpression()
+	case levelPrimary:
+		return p.parsePrimaryExpressionInner()
+	}
+	return p.parseOrExpression()
+}
+
+// Edit is a change to source text: Removed bytes starting at byte Offset
+// are replaced by Inserted.
+type Edit struct {
+	Offset   int
+	Removed  int
+	Inserted string
+}
+
+// Document is a parsed expression that is reparsed incrementally as its
+// source is edited, as in an editor reporting diagnostics while the user
+// types. A Document is never modified; Apply returns a new one that shares
+// the subtrees the edit did not touch.
+type Document struct {
+	source    string
+	configure func(*Parser) error
+	toks      []tokens.Token
+	expr      ast.Expression
+	err       error
+	spans     map[ast.Expression]span
+	reparsed  int
+}
+
+// ParseDocument parses source as a Document. configure, when not nil, is
+// applied to every parser the document uses, for example to register custom
+// operators or set the language version.
+func ParseDocument(source string, configure func(*Parser) error) *Document {
+	d := &Document{source: source, configure: configure}
+	d.parseAll()
+	return d
+}
+
+// Source returns the source text.
+func (d *Document) Source() string {
+	return d.source
+}
+
+// Expression returns the parsed expression, or nil if the source has an
+// error.
+func (d *Document) Expression() ast.Expression {
+	return d.expr
+}
+
+// Err returns the lexical or syntax error in the source, if any.
+func (d *Document) Err() error {
+	return d.err
+}
+
+// ReparsedTokens returns the number of tokens parsed to produce the
+// document: all of them for a full parse, fewer when Apply reused subtrees.
+func (d *Document) ReparsedTokens() int {
+	return d.reparsed
+}
+
+// Apply returns the document with edit applied. The source is lexed again
+// in full, but only the smallest node enclosing the changed tokens is
+// parsed again; the rest of the tree is shared with d. Nodes are reused
+// only where their tokens and positions are unchanged, so an edit that
+// adds or removes a line break reparses everything after it. An error is
+// returned only for an edit outside the source.
+func (d *Document) Apply(edit Edit) (*Document, error) {
+	if edit.Offset < 0 || edit.Removed < 0 || edit.Offset+edit.Removed > len(d.source) {
+		return nil, fmt.Errorf("edit at offset %d removing %d bytes is outside the source of length %d", edit.Offset, edit.Removed, len(d.source))
+	}
+	next := &Document{
+		source:    d.source[:edit.Offset] + edit.Inserted + d.source[edit.Offset+edit.Removed:],
+		configure: d.configure,
+	}
+	if d.expr == nil {
+		next.parseAll()
+		return next, nil
+	}
+	toks, err := lexer.NewLexer(next.source).Tokens()
+	if err != nil {
+		next.err = err
+		return next, nil
+	}
+	next.toks = toks
+
+	// Find the changed tokens, ignoring the final EOF token: old tokens
+	// [first, oldEnd) were replaced by new tokens [first, oldEnd+delta).
+	oldCount, newCount := len(d.toks)-1, len(toks)-1
+	first := 0
+	for first < oldCount && first < newCount && d.toks[first] == toks[first] {
+		first++
+	}
+	same := 0
+	for same < oldCount-first && same < newCount-first && d.toks[oldCount-1-same] == toks[newCount-1-same] {
+		same++
+	}
+	oldEnd := oldCount - same
+	delta := newCount - oldCount
+	if first == oldEnd && delta == 0 {
+		next.expr, next.spans = d.expr, d.spans
+		return next, nil
+	}
+
+	// Reparse the innermost node enclosing the change, falling back to
+	// enclosing nodes when the new tokens do not form a node of the same
+	// level that ends where the old one did.
+	path := d.enclosing(first, oldEnd)
+	for i := len(path) - 1; i >= 0; i-- {
+		old := path[i]
+		s := d.spans[old]
+		node, spans, ok := next.reparse(s, delta, path[:i+1])
+		if !ok {
+			continue
+		}
+		next.splice(d, path[:i], old, node, s, spans, delta)
+		return next, nil
+	}
+	next.parseAll()
+	return next, nil
+}
+
+// enclosing returns the recorded nodes from the root down whose spans
+// contain the tokens [first, end).
+func (d *Document) enclosing(first, end int) []ast.Expression {
+	covers := func(node ast.Expression) bool {
+		s, ok := d.spans[node]
+		return ok && s.start <= first && end <= s.end
+	}
+	if !covers(d.expr) {
+		return nil
+	}
+	path := []ast.Expression{d.expr}
+	for {
+		var inner ast.Expression
+		for _, child := range ast.Children(path[len(path)-1]) {
+			if covers(child) {
+				inner = child
+				break
+			}
+		}
+		if inner == nil {
+			return path
+		}
+		path = append(path, inner)
+	}
+}
+
+// bindAround puts in scope the variables bound around the last node of path
+// by the LET expressions and function calls above it.
+func (p *Parser) bindAround(path []ast.Expression) {
+	for i := 0; i+1 < len(path); i++ {
+		switch n := path[i].(type) {
+		case *expressions.LetExpr:
+			if n.Body == path[i+1] {
+				p.variables = append(p.variables, n.Name)
+			}
+		case *expressions.FunctionCallExpr:
+			if p.itemInScope() {
+				p.variables = append(p.variables, env.ItemVariable)
+			}
+		}
+	}
+}
+
+// reparse parses the tokens of the last node of path, with span s, after
+// they grew by delta. The parser also sees the two tokens that follow, so
+// lookahead decisions match a full parse; it must stop exactly at the end
+// of the node.
+func (d *Document) reparse(s span, delta int, path []ast.Expression) (ast.Expression, map[ast.Expression]span, bool) {
+	end := s.end + delta
+	window := d.toks[s.start:min(end+2, len(d.toks))]
+	p, err := d.newParser(window)
+	if err != nil {
+		return nil, nil, false
+	}
+	p.bindAround(path)
+	node, err := p.parseLevel(s.level)
+	if err != nil || p.index() != end-s.start {
+		return nil, nil, false
+	}
+	d.reparsed = end - s.start
+	return node, p.spans, true
+}
+
+// splice builds the tree of d from that of prev by replacing old, reached
+// through ancestors, with node. Ancestors are copied; every other subtree is
+// shared. The spans of nodes after the change are shifted by delta.
+func (d *Document) splice(prev *Document, ancestors []ast.Expression, old, node ast.Expression, s span, spans map[ast.Expression]span, delta int) {
+	copies := make(map[ast.Expression]ast.Expression, len(ancestors))
+	replacement := node
+	for i := len(ancestors) - 1; i >= 0; i-- {
+		child, with := ancestors[i+1:], replacement
+		target := old
+		if len(child) > 0 {
+			target = child[0]
+		}
+		replacement = ancestors[i].(ast.Rewriter).RewriteChildren(func(c ast.Expression) ast.Expression {
+			if c == target {
+				return with
+			}
+			return c
+		})
+		copies[ancestors[i]] = replacement
+	}
+	d.expr = replacement
+
+	d.spans = make(map[ast.Expression]span, len(prev.spans))
+	for n, ns := range prev.spans {
+		switch copied, isAncestor := copies[n]; {
+		case isAncestor:
+			ns.end += delta
+			d.spans[copied] = ns
+		case ns.end <= s.start:
+			d.spans[n] = ns
+		case ns.start >= s.end:
+			ns.start += delta
+			ns.end += delta
+			d.spans[n] = ns
+		}
+	}
+	for n, ns := range spans {
+		ns.start += s.start
+		ns.end += s.start
+		d.spans[n] = ns
+	}
+}
+
+// parseAll lexes and parses the whole source.
+func (d *Document) parseAll() {
+	toks, err := lexer.NewLexer(d.source).Tokens()
+	if err != nil {
+		d.err = err
+		return
+	}
+	d.toks = toks
+	d.reparsed = len(toks) - 1
+	p, err := d.newParser(toks)
+	if err != nil {
+		d.err = err
+		return
+	}
+	expr, err := p.ParseExpression()
+	if err != nil {
+		d.err = err
+		return
+	}
+	d.expr = expr
+	d.spans = p.spans
+}
+
+// newParser returns a configured parser over toks that records spans.
+func (d *Document) newParser(toks []tokens.Token) (*Parser, error) {
+	p, err := NewParser(lexer.NewTokenSliceStream(toks))
+	if err != nil {
+		return nil, err
+	}
+	if d.configure != nil {
+		if err := d.configure(p); err != nil {
+			return nil, err
+		}
+	}
+	p.spans = make(map[ast.Expression]span)
+	return p, nil
+}
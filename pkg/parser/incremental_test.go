@@ -0,0 +1,157 @@
+package parser
+
+import (
+	"fmt"
+	"github.com/SpecDrivenDesign/lql/pkg/ast"
+	"github.com/SpecDrivenDesign/lql/pkg/lexer"
+	"strings"
+	"testing"
+)
+
+var documentSources = []string{
+	`$a + 1 > 2 AND $b.c[0] == "x"`,
+	`math.max([$x, 2, 3]) * -$y OR NOT $z`,
+	`LET n = $items[*].price IN array.filterExpr(n, item > 10)`,
+	`{a: 1, "b": [1, 2], [$k]: $v?.w ?: null}`,
+	`$s LIKE "a%" AND $n BETWEEN 1 AND 5`,
+	`(($a))`,
+}
+
+// dump describes every node of expr with its type and position, so that two
+// trees compare equal only if they have the same shape and positions.
+func dump(expr ast.Expression) string {
+	if expr == nil {
+		return "<nil>"
+	}
+	var sb strings.Builder
+	ast.Inspect(expr, func(node ast.Expression) bool {
+		line, column := node.Pos()
+		fmt.Fprintf(&sb, "%T@%d:%d %s\n", node, line, column, node.String())
+		return true
+	})
+	return sb.String()
+}
+
+// checkEdit applies edit to d incrementally and checks the result against a
+// full parse of the edited source.
+func checkEdit(t *testing.T, d *Document, edit Edit) *Document {
+	t.Helper()
+	next, err := d.Apply(edit)
+	if err != nil {
+		t.Fatalf("Apply(%+v) to %q: %v", edit, d.Source(), err)
+	}
+	full := ParseDocument(next.Source(), nil)
+	if (next.Err() == nil) != (full.Err() == nil) {
+		t.Fatalf("%q after %+v: incremental error %v, full error %v", d.Source(), edit, next.Err(), full.Err())
+	}
+	if next.Err() != nil {
+		return next
+	}
+	if got, want := dump(next.Expression()), dump(full.Expression()); got != want {
+		t.Fatalf("%q after %+v gives %q:\nincremental:\n%s\nfull:\n%s", d.Source(), edit, next.Source(), got, want)
+	}
+	return next
+}
+
+// tokenBoundaries returns the offsets at which the tokens of the
+// single-line source start, the last being the end of the source.
+func tokenBoundaries(t *testing.T, source string) []int {
+	toks, err := lexer.NewLexer(source).Tokens()
+	if err != nil {
+		t.Fatal(err)
+	}
+	offsets := make([]int, 0, len(toks))
+	for _, tok := range toks[:len(toks)-1] {
+		offsets = append(offsets, tok.Column-1)
+	}
+	return append(offsets, len(source))
+}
+
+func TestDocumentInsert(t *testing.T) {
+	for _, src := range documentSources {
+		d := ParseDocument(src, nil)
+		for offset := 0; offset <= len(src); offset++ {
+			for _, text := range []string{" ", "1", "+ 2", "x", "$q", ")", "(", `"`, ",", "\n"} {
+				checkEdit(t, d, Edit{Offset: offset, Inserted: text})
+			}
+		}
+	}
+}
+
+func TestDocumentDelete(t *testing.T) {
+	for _, src := range documentSources {
+		d := ParseDocument(src, nil)
+		for offset := 0; offset < len(src); offset++ {
+			for n := 1; n <= 4 && offset+n <= len(src); n++ {
+				checkEdit(t, d, Edit{Offset: offset, Removed: n})
+			}
+		}
+	}
+}
+
+func TestDocumentReplaceAtTokenBoundaries(t *testing.T) {
+	for _, src := range documentSources {
+		d := ParseDocument(src, nil)
+		boundaries := tokenBoundaries(t, src)
+		for _, start := range boundaries {
+			for _, end := range boundaries {
+				if end < start {
+					continue
+				}
+				for _, text := range []string{"", "42", "$r.s", "(1 + 2)", "OR", " "} {
+					checkEdit(t, d, Edit{Offset: start, Removed: end - start, Inserted: text})
+				}
+			}
+		}
+	}
+}
+
+func TestDocumentEditSequence(t *testing.T) {
+	// Each edit applies to the result of the one before, so the spans the
+	// incremental parses record must stay right.
+	d := ParseDocument(`$a + 1 > 2 AND $b == "x"`, nil)
+	edits := []Edit{
+		{Offset: 5, Removed: 1, Inserted: "10"},
+		{Offset: 0, Inserted: "NOT "},
+		{Offset: 26, Removed: 3, Inserted: `"yz"`},
+		{Offset: 6, Inserted: " * $c"},
+		{Offset: 0, Removed: 4},
+		{Offset: 2, Removed: 1, Inserted: "("},
+		{Offset: 2, Removed: 1, Inserted: "a"},
+	}
+	for _, edit := range edits {
+		d = checkEdit(t, d, edit)
+	}
+}
+
+func TestDocumentReusesUnchangedNodes(t *testing.T) {
+	src := `$a + 1 > 2 AND $b.c[0] == "x" AND math.max([$x, 2, 3]) < 10`
+	d := ParseDocument(src, nil)
+	total := d.ReparsedTokens()
+	next := checkEdit(t, d, Edit{Offset: strings.Index(src, "2,"), Removed: 1, Inserted: "7"})
+	if next.ReparsedTokens() >= total {
+		t.Errorf("reparsed %d of %d tokens for a one-token edit", next.ReparsedTokens(), total)
+	}
+}
+
+func TestDocumentApplyOutsideSource(t *testing.T) {
+	d := ParseDocument("1 + 2", nil)
+	for _, edit := range []Edit{{Offset: -1}, {Offset: 6}, {Offset: 3, Removed: 3}, {Offset: 0, Removed: -1}} {
+		if _, err := d.Apply(edit); err == nil {
+			t.Errorf("Apply(%+v) succeeded", edit)
+		}
+	}
+}
+
+func TestSpansOnlyRecordedForDocuments(t *testing.T) {
+	p, err := NewParser(lexer.NewLexer("$a + 1 > 2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.ParseExpression(); err != nil {
+		t.Fatal(err)
+	}
+	if p.spans != nil {
+		t.Errorf("a plain parse recorded %d spans", len(p.spans))
+	}
+}
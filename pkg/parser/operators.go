@@ -0,0 +1,146 @@
+package parser
+
+import (
+	"fmt"
+	"github.com/SpecDrivenDesign/lql/pkg/ast"
+	"github.com/SpecDrivenDesign/lql/pkg/ast/expressions"
+	"github.com/SpecDrivenDesign/lql/pkg/tokens"
+	"strings"
+	"unicode"
+)
+
+// InfixOperator describes a custom keyword operator placed between two
+// operands, e.g. "$tags contains 'x'". Precedence must be one of OR, AND,
+// EQUALS, GTR, SUM or PRODUCT; the operator is left-associative and binds
+// alongside the built-in operators of that level.
+type InfixOperator struct {
+	Keyword    string
+	Precedence int
+	Eval       expressions.InfixOperatorFunc
+}
+
+// PrefixOperator describes a custom keyword operator placed before its
+// operand, e.g. "abs $delta". It binds like unary NOT and '-'.
+type PrefixOperator struct {
+	Keyword string
+	Eval    expressions.PrefixOperatorFunc
+}
+
+// reservedKeywords may not be used as custom operator keywords.
+var reservedKeywords = map[string]bool{
+	"AND": true, "OR": true, "NOT": true, "BETWEEN": true, "LIKE": true, "LET": true, "IN": true,
+	"TRUE": true, "FALSE": true, "NULL": true,
+}
+
+// RegisterInfixOperator adds a custom infix operator to the parser. Since
+// custom operators are lexed as identifiers, expressions using them survive
+// token export; a parser reading them back needs the same registrations.
+func (p *Parser) RegisterInfixOperator(op InfixOperator) error {
+	keyword, err := p.checkOperatorKeyword(op.Keyword)
+	if err != nil {
+		return err
+	}
+	if op.Precedence < OR || op.Precedence > PRODUCT {
+		return fmt.Errorf("operator '%s': precedence %d out of range", op.Keyword, op.Precedence)
+	}
+	if op.Eval == nil {
+		return fmt.Errorf("operator '%s': missing eval function", op.Keyword)
+	}
+	if p.infixOperators == nil {
+		p.infixOperators = make(map[string]InfixOperator)
+	}
+	p.infixOperators[keyword] = op
+	return nil
+}
+
+// RegisterPrefixOperator adds a custom prefix operator to the parser.
+func (p *Parser) RegisterPrefixOperator(op PrefixOperator) error {
+	keyword, err := p.checkOperatorKeyword(op.Keyword)
+	if err != nil {
+		return err
+	}
+	if op.Eval == nil {
+		return fmt.Errorf("operator '%s': missing eval function", op.Keyword)
+	}
+	if p.prefixOperators == nil {
+		p.prefixOperators = make(map[string]PrefixOperator)
+	}
+	p.prefixOperators[keyword] = op
+	return nil
+}
+
+// checkOperatorKeyword validates a custom operator keyword and returns its
+// normalized (upper-case) form.
+func (p *Parser) checkOperatorKeyword(keyword string) (string, error) {
+	if keyword == "" {
+		return "", fmt.Errorf("operator keyword must not be empty")
+	}
+	for i, r := range keyword {
+		if !(unicode.IsLetter(r) || r == '_' || (i > 0 && unicode.IsDigit(r))) {
+			return "", fmt.Errorf("operator keyword '%s' must be an identifier", keyword)
+		}
+	}
+	normalized := strings.ToUpper(keyword)
+	if reservedKeywords[normalized] {
+		return "", fmt.Errorf("operator keyword '%s' is reserved", keyword)
+	}
+	if _, exists := p.infixOperators[normalized]; exists {
+		return "", fmt.Errorf("operator '%s' already registered", keyword)
+	}
+	if _, exists := p.prefixOperators[normalized]; exists {
+		return "", fmt.Errorf("operator '%s' already registered", keyword)
+	}
+	return normalized, nil
+}
+
+// isCustomInfix reports whether the current token is a custom infix
+// operator registered with the given precedence.
+func (p *Parser) isCustomInfix(precedence int) bool {
+	if !p.curTokenIs(tokens.TokenIdent) {
+		return false
+	}
+	op, ok := p.infixOperators[strings.ToUpper(p.curToken.Literal)]
+	return ok && op.Precedence == precedence
+}
+
+// curPrefixOperator returns the custom prefix operator at the current token,
+// unless the identifier is followed by a dot (a library call).
+func (p *Parser) curPrefixOperator() (PrefixOperator, bool) {
+	if !p.curTokenIs(tokens.TokenIdent) || p.peekTokenIs(tokens.TokenDot) {
+		return PrefixOperator{}, false
+	}
+	op, ok := p.prefixOperators[strings.ToUpper(p.curToken.Literal)]
+	return op, ok
+}
+
+// newInfixExpr builds the node for the operator at the given precedence,
+// which is either a built-in binary operator or a registered custom one.
+func (p *Parser) newInfixExpr(operator tokens.Token, precedence int, left, right ast.Expression) ast.Expression {
+	if operator.Type == tokens.TokenIdent {
+		if op, ok := p.infixOperators[strings.ToUpper(operator.Literal)]; ok && op.Precedence == precedence {
+			return &expressions.CustomInfixExpr{
+				Keyword:    strings.ToUpper(operator.Literal),
+				Precedence: precedence,
+				Left:       left,
+				Right:      right,
+				Fn:         op.Eval,
+				Line:       operator.Line,
+				Column:     operator.Column,
+			}
+		}
+		// Lower-case logical keywords arrive as identifiers.
+		switch strings.ToUpper(operator.Literal) {
+		case "AND":
+			operator.Type = tokens.TokenAnd
+		case "OR":
+			operator.Type = tokens.TokenOr
+		}
+	}
+	return &expressions.BinaryExpr{
+		Left:     left,
+		Operator: operator.Type,
+		Right:    right,
+		Line:     operator.Line,
+		Column:   operator.Column,
+	}
+}
@@ -0,0 +1,177 @@
+package parser
+
+import (
+	"github.com/SpecDrivenDesign/lql/pkg/ast"
+	"github.com/SpecDrivenDesign/lql/pkg/ast/expressions"
+	"github.com/SpecDrivenDesign/lql/pkg/env"
+	"github.com/SpecDrivenDesign/lql/pkg/errors"
+	"github.com/SpecDrivenDesign/lql/pkg/lexer"
+	"strings"
+	"testing"
+)
+
+// registerOperators adds the operators used by the tests below: "contains"
+// at EQUALS, "times" at PRODUCT and the prefix "abs".
+func registerOperators(p *Parser) error {
+	contains := InfixOperator{
+		Keyword:    "contains",
+		Precedence: EQUALS,
+		Eval: func(left, right interface{}, line, column int) (interface{}, error) {
+			items, ok := left.([]interface{})
+			if !ok {
+				return nil, errors.NewTypeError("contains needs an array", line, column)
+			}
+			for _, item := range items {
+				if item == right {
+					return true, nil
+				}
+			}
+			return false, nil
+		},
+	}
+	times := InfixOperator{
+		Keyword:    "times",
+		Precedence: PRODUCT,
+		Eval: func(left, right interface{}, line, column int) (interface{}, error) {
+			return left.(int64) * right.(int64), nil
+		},
+	}
+	abs := PrefixOperator{
+		Keyword: "abs",
+		Eval: func(operand interface{}, line, column int) (interface{}, error) {
+			if n := operand.(int64); n < 0 {
+				return -n, nil
+			}
+			return operand, nil
+		},
+	}
+	for _, err := range []error{p.RegisterInfixOperator(contains), p.RegisterInfixOperator(times), p.RegisterPrefixOperator(abs)} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseWithOperators(t *testing.T, src string) ast.Expression {
+	t.Helper()
+	p, err := NewParser(lexer.NewLexer(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := registerOperators(p); err != nil {
+		t.Fatal(err)
+	}
+	expr, err := p.ParseExpression()
+	if err != nil {
+		t.Fatalf("%s: %v", src, err)
+	}
+	return expr
+}
+
+func TestCustomOperators(t *testing.T) {
+	ctx := map[string]interface{}{
+		"tags": []interface{}{"vip", "new"},
+		"d":    int64(-3),
+		"a":    int64(2),
+	}
+	tests := []struct {
+		src  string
+		want interface{}
+	}{
+		{`$tags contains "vip"`, true},
+		{`$tags CONTAINS "old"`, false},
+		// EQUALS binds tighter than AND and looser than arithmetic.
+		{`$tags contains "vip" AND $tags contains "new"`, true},
+		{`$tags contains "old" or true`, true},
+		// PRODUCT binds tighter than '+' and is left-associative with '*'.
+		{`1 + $a times 3`, int64(7)},
+		{`$a * 3 times 2 - 1`, int64(11)},
+		// A prefix operator binds like unary '-'.
+		{`abs $d + 1`, int64(4)},
+		{`abs -5 times 2`, int64(10)},
+		{`-abs $d`, int64(-3)},
+		// An identifier followed by a dot is still a library call.
+		{`math.abs($d) == abs $d`, true},
+	}
+	for _, tt := range tests {
+		got, err := parseWithOperators(t, tt.src).Eval(ctx, env.NewEnvironment())
+		if err != nil {
+			t.Errorf("%s: %v", tt.src, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestCustomOperatorNodes(t *testing.T) {
+	expr := parseWithOperators(t, "$a >= 1 AND\n  $tags Contains abs $d")
+	infix, ok := ast.Children(expr)[1].(*expressions.CustomInfixExpr)
+	if !ok {
+		t.Fatalf("got %T, want a custom infix operator", ast.Children(expr)[1])
+	}
+	if infix.Keyword != "CONTAINS" || infix.Precedence != EQUALS {
+		t.Errorf("got %s at precedence %d", infix.Keyword, infix.Precedence)
+	}
+	if line, column := infix.Pos(); line != 2 || column != 9 {
+		t.Errorf("operator at %d:%d, want 2:9", line, column)
+	}
+	if prefix, ok := infix.Right.(*expressions.CustomPrefixExpr); !ok || prefix.Keyword != "ABS" {
+		t.Errorf("got %T, want the prefix operator", infix.Right)
+	}
+	if got := expr.String(); got != "$a >= 1 AND $tags CONTAINS ABS $d" {
+		t.Errorf("got %s", got)
+	}
+
+	// Errors from the operator carry its position.
+	_, err := parseWithOperators(t, `1 contains 1`).Eval(nil, env.NewEnvironment())
+	if posErr, ok := err.(errors.PositionalError); !ok || posErr.GetColumn() != 3 {
+		t.Errorf("got %v, want an error at column 3", err)
+	}
+}
+
+func TestRegisterOperatorErrors(t *testing.T) {
+	eval := func(left, right interface{}, line, column int) (interface{}, error) { return nil, nil }
+	tests := []struct {
+		op   InfixOperator
+		want string
+	}{
+		{InfixOperator{Keyword: "", Precedence: SUM, Eval: eval}, "must not be empty"},
+		{InfixOperator{Keyword: "2x", Precedence: SUM, Eval: eval}, "must be an identifier"},
+		{InfixOperator{Keyword: "has-key", Precedence: SUM, Eval: eval}, "must be an identifier"},
+		{InfixOperator{Keyword: "and", Precedence: SUM, Eval: eval}, "reserved"},
+		{InfixOperator{Keyword: "Like", Precedence: SUM, Eval: eval}, "reserved"},
+		{InfixOperator{Keyword: "null", Precedence: SUM, Eval: eval}, "reserved"},
+		{InfixOperator{Keyword: "TIMES", Precedence: SUM, Eval: eval}, "already registered"},
+		{InfixOperator{Keyword: "Abs", Precedence: SUM, Eval: eval}, "already registered"},
+		{InfixOperator{Keyword: "mod", Precedence: CALL, Eval: eval}, "out of range"},
+		{InfixOperator{Keyword: "mod", Precedence: LOWEST, Eval: eval}, "out of range"},
+		{InfixOperator{Keyword: "mod", Precedence: SUM}, "missing eval function"},
+	}
+	for _, tt := range tests {
+		err := parse("1", func(p *Parser) {
+			if err := registerOperators(p); err != nil {
+				t.Fatal(err)
+			}
+			if err := p.RegisterInfixOperator(tt.op); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("%q: got %v, want an error containing %q", tt.op.Keyword, err, tt.want)
+			}
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p, err := NewParser(lexer.NewLexer("1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.RegisterPrefixOperator(PrefixOperator{Keyword: "neg"}); err == nil {
+		t.Error("a prefix operator without an eval function was accepted")
+	}
+	if err := p.RegisterPrefixOperator(PrefixOperator{Keyword: "not", Eval: func(interface{}, int, int) (interface{}, error) { return nil, nil }}); err == nil {
+		t.Error("a reserved prefix keyword was accepted")
+	}
+}
@@ -3,6 +3,7 @@ package parser
 import (
 	"fmt"
 	"github.com/SpecDrivenDesign/lql/pkg/ast/expressions"
+	"github.com/SpecDrivenDesign/lql/pkg/env"
 	"github.com/SpecDrivenDesign/lql/pkg/tokens"
 	"github.com/SpecDrivenDesign/lql/pkg/types"
 	"strings"
@@ -22,13 +23,27 @@ type Parser struct {
 	curToken  tokens.Token
 	peekToken tokens.Token
 	errors    []string
+
+	allowTrailingCommas bool
+	languageVersion     string
+	infixOperators      map[string]InfixOperator
+	prefixOperators     map[string]PrefixOperator
+
+	variables []string // names bound by the enclosing LET expressions
+
+	maxNesting int // see SetMaxNesting
+	nesting    int // levels open at the current token
+
+	consumed int                     // tokens read from the stream
+	spans    map[ast.Expression]span // recorded for incremental reparsing
 }
 
 // NewParser creates a new parser.
 func NewParser(l TokenStream) (*Parser, error) {
 	p := &Parser{
-		lexer:  l,
-		errors: []string{},
+		lexer:      l,
+		errors:     []string{},
+		maxNesting: DefaultMaxNesting,
 	}
 	if err := p.nextToken(); err != nil {
 		return nil, err
@@ -39,7 +54,44 @@ func NewParser(l TokenStream) (*Parser, error) {
 	return p, nil
 }
 
+// SetAllowTrailingCommas controls whether a trailing comma is accepted in
+// array literals, object literals and function argument lists. A comma
+// without an element before it is rejected either way. The setting is an
+// option of the host, not of the language: it is not recorded in compiled
+// bytecode, which is parsed again with default settings when it is loaded,
+// so source relying on it must be formatted before it is compiled.
+func (p *Parser) SetAllowTrailingCommas(allow bool) {
+	p.allowTrailingCommas = allow
+}
+
+// DefaultMaxNesting is the nesting limit of a new parser.
+const DefaultMaxNesting = 1000
+
+// SetMaxNesting bounds how deeply subexpressions nest. The expression, and
+// every parenthesized expression, argument, element, field value, index
+// and operand of a prefix operator within it, opens a level. A deeper
+// expression is a SyntaxError instead of overflowing the parser's stack.
+// A limit of zero or less removes the bound.
+func (p *Parser) SetMaxNesting(n int) {
+	p.maxNesting = n
+}
+
+// enter opens a nesting level, failing past the limit. Each successful
+// enter is matched by a leave.
+func (p *Parser) enter() error {
+	if p.maxNesting > 0 && p.nesting >= p.maxNesting {
+		return errors.NewSyntaxError(fmt.Sprintf("expression nested more than %d levels deep", p.maxNesting), p.curToken.Line, p.curToken.Column)
+	}
+	p.nesting++
+	return nil
+}
+
+func (p *Parser) leave() {
+	p.nesting--
+}
+
 func (p *Parser) nextToken() error {
+	p.consumed++
 	p.curToken = p.peekToken
 	tok, err := p.lexer.NextToken()
 	if err != nil {
@@ -71,6 +123,8 @@ var precedences = map[tokens.TokenType]int{
 	tokens.TokenAnd:             AND,
 	tokens.TokenEq:              EQUALS,
 	tokens.TokenNeq:             EQUALS,
+	tokens.TokenMatch:           EQUALS,
+	tokens.TokenNotMatch:        EQUALS,
 	tokens.TokenLt:              GTR,
 	tokens.TokenGt:              GTR,
 	tokens.TokenLte:             GTR,
@@ -100,12 +154,20 @@ func (p *Parser) peekPrecedence() int {
 	return LOWEST
 }
 
-func (p *Parser) parseOrExpression() (ast.Expression, error) {
+func (p *Parser) parseOrExpression() (result ast.Expression, err error) {
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer p.leave()
+	start := p.index()
+	if p.spans != nil {
+		defer p.recordSpan(levelOr, start, &result)
+	}
 	left, err := p.parseAndExpression()
 	if err != nil {
 		return nil, err
 	}
-	for p.curTokenIs(tokens.TokenOr) || (p.curTokenIs(tokens.TokenIdent) && strings.ToUpper(p.curToken.Literal) == "OR") {
+	for p.curTokenIs(tokens.TokenOr) || (p.curTokenIs(tokens.TokenIdent) && strings.ToUpper(p.curToken.Literal) == "OR") || p.isCustomInfix(OR) {
 		operator := p.curToken
 		if err := p.nextToken(); err != nil {
 			return nil, err
@@ -114,23 +176,22 @@ func (p *Parser) parseOrExpression() (ast.Expression, error) {
 		if err != nil {
 			return nil, err
 		}
-		left = &expressions.BinaryExpr{
-			Left:     left,
-			Operator: operator.Type,
-			Right:    right,
-			Line:     operator.Line,
-			Column:   operator.Column,
-		}
+		left = p.newInfixExpr(operator, OR, left, right)
+		p.record(levelOr, start, left)
 	}
 	return left, nil
 }
 
-func (p *Parser) parseAndExpression() (ast.Expression, error) {
+func (p *Parser) parseAndExpression() (result ast.Expression, err error) {
+	start := p.index()
+	if p.spans != nil {
+		defer p.recordSpan(levelAnd, start, &result)
+	}
 	left, err := p.parseEqualityExpression()
 	if err != nil {
 		return nil, err
 	}
-	for p.curTokenIs(tokens.TokenAnd) || (p.curTokenIs(tokens.TokenIdent) && strings.ToUpper(p.curToken.Literal) == "AND") {
+	for p.curTokenIs(tokens.TokenAnd) || (p.curTokenIs(tokens.TokenIdent) && strings.ToUpper(p.curToken.Literal) == "AND") || p.isCustomInfix(AND) {
 		operator := p.curToken
 		if err := p.nextToken(); err != nil {
 			return nil, err
@@ -139,24 +200,28 @@ func (p *Parser) parseAndExpression() (ast.Expression, error) {
 		if err != nil {
 			return nil, err
 		}
-		left = &expressions.BinaryExpr{
-			Left:     left,
-			Operator: operator.Type,
-			Right:    right,
-			Line:     operator.Line,
-			Column:   operator.Column,
-		}
+		left = p.newInfixExpr(operator, AND, left, right)
+		p.record(levelAnd, start, left)
 	}
 	return left, nil
 }
 
-func (p *Parser) parseEqualityExpression() (ast.Expression, error) {
+func (p *Parser) parseEqualityExpression() (result ast.Expression, err error) {
+	start := p.index()
+	if p.spans != nil {
+		defer p.recordSpan(levelEquality, start, &result)
+	}
 	left, err := p.parseRelationalExpression()
 	if err != nil {
 		return nil, err
 	}
-	for p.curTokenIs(tokens.TokenEq) || p.curTokenIs(tokens.TokenNeq) {
+	for p.curTokenIs(tokens.TokenEq) || p.curTokenIs(tokens.TokenNeq) || p.curTokenIs(tokens.TokenMatch) || p.curTokenIs(tokens.TokenNotMatch) || p.isCustomInfix(EQUALS) {
 		operator := p.curToken
+		if operator.Type == tokens.TokenMatch || operator.Type == tokens.TokenNotMatch {
+			if err := p.requireVersion(LanguageVersion1_1, fmt.Sprintf("The %s operator", operator.Literal), operator); err != nil {
+				return nil, err
+			}
+		}
 		if err := p.nextToken(); err != nil {
 			return nil, err
 		}
@@ -164,23 +229,28 @@ func (p *Parser) parseEqualityExpression() (ast.Expression, error) {
 		if err != nil {
 			return nil, err
 		}
-		left = &expressions.BinaryExpr{
-			Left:     left,
-			Operator: operator.Type,
-			Right:    right,
-			Line:     operator.Line,
-			Column:   operator.Column,
-		}
+		left = p.newInfixExpr(operator, EQUALS, left, right)
+		p.record(levelEquality, start, left)
 	}
 	return left, nil
 }
 
-func (p *Parser) parseRelationalExpression() (ast.Expression, error) {
+func (p *Parser) parseRelationalExpression() (result ast.Expression, err error) {
+	start := p.index()
+	if p.spans != nil {
+		defer p.recordSpan(levelRelational, start, &result)
+	}
 	left, err := p.parseAdditiveExpression()
 	if err != nil {
 		return nil, err
 	}
-	for p.curTokenIs(tokens.TokenLt) || p.curTokenIs(tokens.TokenGt) || p.curTokenIs(tokens.TokenLte) || p.curTokenIs(tokens.TokenGte) {
+	if p.curTokenIsKeyword("BETWEEN") {
+		return p.parseBetween(left)
+	}
+	if p.curTokenIsKeyword("LIKE") {
+		return p.parseLike(left)
+	}
+	for p.curTokenIs(tokens.TokenLt) || p.curTokenIs(tokens.TokenGt) || p.curTokenIs(tokens.TokenLte) || p.curTokenIs(tokens.TokenGte) || p.isCustomInfix(GTR) {
 		operator := p.curToken
 		if err := p.nextToken(); err != nil {
 			return nil, err
@@ -189,23 +259,75 @@ func (p *Parser) parseRelationalExpression() (ast.Expression, error) {
 		if err != nil {
 			return nil, err
 		}
-		left = &expressions.BinaryExpr{
-			Left:     left,
-			Operator: operator.Type,
-			Right:    right,
-			Line:     operator.Line,
-			Column:   operator.Column,
-		}
+		left = p.newInfixExpr(operator, GTR, left, right)
+		p.record(levelRelational, start, left)
 	}
 	return left, nil
 }
 
-func (p *Parser) parseAdditiveExpression() (ast.Expression, error) {
+// parseBetween parses "x BETWEEN low AND high" after its subject.
+func (p *Parser) parseBetween(subject ast.Expression) (ast.Expression, error) {
+	betweenTok := p.curToken
+	if err := p.requireVersion(LanguageVersion1_1, "BETWEEN", betweenTok); err != nil {
+		return nil, err
+	}
+	if err := p.nextToken(); err != nil {
+		return nil, err
+	}
+	low, err := p.parseAdditiveExpression()
+	if err != nil {
+		return nil, err
+	}
+	if !p.curTokenIs(tokens.TokenAnd) && !p.curTokenIsKeyword("AND") {
+		return nil, errors.NewSyntaxError("Expected AND in BETWEEN expression", p.curToken.Line, p.curToken.Column)
+	}
+	if err := p.nextToken(); err != nil {
+		return nil, err
+	}
+	high, err := p.parseAdditiveExpression()
+	if err != nil {
+		return nil, err
+	}
+	return &expressions.BetweenExpr{
+		Subject: subject,
+		Low:     low,
+		High:    high,
+		Line:    betweenTok.Line,
+		Column:  betweenTok.Column,
+	}, nil
+}
+
+// parseLike parses "x LIKE pattern".
+func (p *Parser) parseLike(subject ast.Expression) (ast.Expression, error) {
+	likeTok := p.curToken
+	if err := p.requireVersion(LanguageVersion1_1, "LIKE", likeTok); err != nil {
+		return nil, err
+	}
+	if err := p.nextToken(); err != nil {
+		return nil, err
+	}
+	pattern, err := p.parseAdditiveExpression()
+	if err != nil {
+		return nil, err
+	}
+	return &expressions.LikeExpr{
+		Subject: subject,
+		Pattern: pattern,
+		Line:    likeTok.Line,
+		Column:  likeTok.Column,
+	}, nil
+}
+
+func (p *Parser) parseAdditiveExpression() (result ast.Expression, err error) {
+	start := p.index()
+	if p.spans != nil {
+		defer p.recordSpan(levelAdditive, start, &result)
+	}
 	left, err := p.parseMultiplicativeExpression()
 	if err != nil {
 		return nil, err
 	}
-	for p.curTokenIs(tokens.TokenPlus) || p.curTokenIs(tokens.TokenMinus) {
+	for p.curTokenIs(tokens.TokenPlus) || p.curTokenIs(tokens.TokenMinus) || p.isCustomInfix(SUM) {
 		operator := p.curToken
 		if err := p.nextToken(); err != nil {
 			return nil, err
@@ -214,23 +336,22 @@ func (p *Parser) parseAdditiveExpression() (ast.Expression, error) {
 		if err != nil {
 			return nil, err
 		}
-		left = &expressions.BinaryExpr{
-			Left:     left,
-			Operator: operator.Type,
-			Right:    right,
-			Line:     operator.Line,
-			Column:   operator.Column,
-		}
+		left = p.newInfixExpr(operator, SUM, left, right)
+		p.record(levelAdditive, start, left)
 	}
 	return left, nil
 }
 
-func (p *Parser) parseMultiplicativeExpression() (ast.Expression, error) {
+func (p *Parser) parseMultiplicativeExpression() (result ast.Expression, err error) {
+	start := p.index()
+	if p.spans != nil {
+		defer p.recordSpan(levelMultiplicative, start, &result)
+	}
 	left, err := p.parseUnaryExpression()
 	if err != nil {
 		return nil, err
 	}
-	for p.curTokenIs(tokens.TokenMultiply) || p.curTokenIs(tokens.TokenDivide) {
+	for p.curTokenIs(tokens.TokenMultiply) || p.curTokenIs(tokens.TokenDivide) || p.isCustomInfix(PRODUCT) {
 		operator := p.curToken
 		if err := p.nextToken(); err != nil {
 			return nil, err
@@ -239,24 +360,40 @@ func (p *Parser) parseMultiplicativeExpression() (ast.Expression, error) {
 		if err != nil {
 			return nil, err
 		}
-		left = &expressions.BinaryExpr{
-			Left:     left,
-			Operator: operator.Type,
-			Right:    right,
-			Line:     operator.Line,
-			Column:   operator.Column,
-		}
+		left = p.newInfixExpr(operator, PRODUCT, left, right)
+		p.record(levelMultiplicative, start, left)
 	}
 	return left, nil
 }
 
-func (p *Parser) parseUnaryExpression() (ast.Expression, error) {
+func (p *Parser) parseUnaryExpression() (result ast.Expression, err error) {
+	start := p.index()
+	if p.spans != nil {
+		defer p.recordSpan(levelUnary, start, &result)
+	}
+	if op, ok := p.curPrefixOperator(); ok {
+		operator := p.curToken
+		if err := p.nextToken(); err != nil {
+			return nil, err
+		}
+		expr, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return &expressions.CustomPrefixExpr{
+			Keyword: strings.ToUpper(operator.Literal),
+			Expr:    expr,
+			Fn:      op.Eval,
+			Line:    operator.Line,
+			Column:  operator.Column,
+		}, nil
+	}
 	if p.curTokenIs(tokens.TokenNot) || p.curTokenIs(tokens.TokenMinus) {
 		operator := p.curToken
 		if err := p.nextToken(); err != nil {
 			return nil, err
 		}
-		expr, err := p.parseUnaryExpression()
+		expr, err := p.parseOperand()
 		if err != nil {
 			return nil, err
 		}
@@ -270,14 +407,42 @@ func (p *Parser) parseUnaryExpression() (ast.Expression, error) {
 	return p.parseMemberAccessExpression()
 }
 
-func (p *Parser) parseMemberAccessExpression() (ast.Expression, error) {
+// parseOperand parses the operand of a prefix operator, one nesting level
+// down.
+func (p *Parser) parseOperand() (ast.Expression, error) {
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer p.leave()
+	return p.parseUnaryExpression()
+}
+
+func (p *Parser) parseMemberAccessExpression() (result ast.Expression, err error) {
+	start := p.index()
+	if p.spans != nil {
+		defer p.recordSpan(levelMember, start, &result)
+	}
 	expr, err := p.parsePrimaryExpressionInner()
 	if err != nil {
 		return nil, err
 	}
-	for p.curTokenIs(tokens.TokenDot) || p.curTokenIs(tokens.TokenLeftBracket) || p.curTokenIs(tokens.TokenQuestionDot) || p.curTokenIs(tokens.TokenQuestionBracket) {
+	for p.curTokenIs(tokens.TokenDot) || p.curTokenIs(tokens.TokenDotDot) || p.curTokenIs(tokens.TokenLeftBracket) || p.curTokenIs(tokens.TokenQuestionDot) || p.curTokenIs(tokens.TokenQuestionBracket) {
 		var part expressions.MemberPart
-		if p.curTokenIs(tokens.TokenDot) || p.curTokenIs(tokens.TokenQuestionDot) {
+		if p.curTokenIs(tokens.TokenDotDot) {
+			if err := p.requireVersion(LanguageVersion1_1, "Recursive descent '..'", p.curToken); err != nil {
+				return nil, err
+			}
+			if err := p.nextToken(); err != nil {
+				return nil, err
+			}
+			if !p.curTokenIs(tokens.TokenIdent) && p.curToken.Type != tokens.TokenString {
+				return nil, errors.NewSyntaxError(fmt.Sprintf("Expected identifier after '..' at line %d, column %d", p.curToken.Line, p.curToken.Column), p.curToken.Line, p.curToken.Column)
+			}
+			part = expressions.MemberPart{Recursive: true, Key: strings.TrimSpace(p.curToken.Literal), Line: p.curToken.Line, Column: p.curToken.Column}
+			if err := p.nextToken(); err != nil {
+				return nil, err
+			}
+		} else if p.curTokenIs(tokens.TokenDot) || p.curTokenIs(tokens.TokenQuestionDot) {
 			optional := p.curTokenIs(tokens.TokenQuestionDot)
 			if err := p.nextToken(); err != nil {
 				return nil, err
@@ -294,6 +459,20 @@ func (p *Parser) parseMemberAccessExpression() (ast.Expression, error) {
 			if err := p.nextToken(); err != nil {
 				return nil, err
 			}
+			if p.curTokenIs(tokens.TokenMultiply) && p.peekTokenIs(tokens.TokenRightBracket) {
+				if err := p.requireVersion(LanguageVersion1_1, "Wildcard projection '[*]'", p.curToken); err != nil {
+					return nil, err
+				}
+				part = expressions.MemberPart{Optional: optional, IsIndex: true, Wildcard: true, Line: p.curToken.Line, Column: p.curToken.Column}
+				if err := p.nextToken(); err != nil {
+					return nil, err
+				}
+				if err := p.nextToken(); err != nil {
+					return nil, err
+				}
+				expr = appendMemberPart(expr, part)
+				continue
+			}
 			exprTmp, err := p.ParseExpression()
 			if err != nil {
 				return nil, err
@@ -307,16 +486,53 @@ func (p *Parser) parseMemberAccessExpression() (ast.Expression, error) {
 			}
 			part = expressions.MemberPart{Optional: optional, IsIndex: true, Expr: indexExpr, Line: p.curToken.Line, Column: p.curToken.Column}
 		}
-		if mae, ok := expr.(*expressions.MemberAccessExpr); ok {
-			mae.AccessParts = append(mae.AccessParts, part)
-		} else {
-			expr = &expressions.MemberAccessExpr{Target: expr, AccessParts: []expressions.MemberPart{part}}
-		}
+		expr = appendMemberPart(expr, part)
+	}
+	if p.curTokenIs(tokens.TokenQuestionColon) {
+		p.record(levelMember, start, expr)
+		return p.parseDefault(expr)
 	}
 	return expr, nil
 }
 
-func (p *Parser) parsePrimaryExpressionInner() (ast.Expression, error) {
+// parseDefault parses "x ?: fallback", which yields fallback when x is
+// missing or null. The fallback binds like a unary operand, so chains such
+// as "$a ?: $b ?: 0" associate to the right.
+func (p *Parser) parseDefault(expr ast.Expression) (ast.Expression, error) {
+	operator := p.curToken
+	if err := p.requireVersion(LanguageVersion1_1, "The ?: operator", operator); err != nil {
+		return nil, err
+	}
+	if err := p.nextToken(); err != nil {
+		return nil, err
+	}
+	fallback, err := p.parseUnaryExpression()
+	if err != nil {
+		return nil, err
+	}
+	return &expressions.DefaultExpr{
+		Expr:     expr,
+		Fallback: fallback,
+		Line:     operator.Line,
+		Column:   operator.Column,
+	}, nil
+}
+
+// appendMemberPart extends expr with an access part, wrapping it in a
+// MemberAccessExpr if needed.
+func appendMemberPart(expr ast.Expression, part expressions.MemberPart) ast.Expression {
+	if mae, ok := expr.(*expressions.MemberAccessExpr); ok {
+		mae.AccessParts = append(mae.AccessParts, part)
+		return mae
+	}
+	return &expressions.MemberAccessExpr{Target: expr, AccessParts: []expressions.MemberPart{part}}
+}
+
+func (p *Parser) parsePrimaryExpressionInner() (result ast.Expression, err error) {
+	start := p.index()
+	if p.spans != nil {
+		defer p.recordSpan(levelPrimary, start, &result)
+	}
 	switch p.curToken.Type {
 	case tokens.TokenLparen:
 		if err := p.nextToken(); err != nil {
@@ -386,20 +602,132 @@ func (p *Parser) parsePrimaryExpressionInner() (ast.Expression, error) {
 
 	case tokens.TokenDollar:
 		return p.parseContextExpression()
+	case tokens.TokenColon:
+		if !p.peekTokenIs(tokens.TokenIdent) {
+			return nil, errors.NewSyntaxError("Expected placeholder name after ':'", p.curToken.Line, p.curToken.Column)
+		}
+		if err := p.requireVersion(LanguageVersion1_1, "Placeholder", p.curToken); err != nil {
+			return nil, err
+		}
+		placeholder := &expressions.PlaceholderExpr{
+			Line:   p.curToken.Line,
+			Column: p.curToken.Column,
+		}
+		if err := p.nextToken(); err != nil {
+			return nil, err
+		}
+		placeholder.Name = p.curToken.Literal
+		if err := p.nextToken(); err != nil {
+			return nil, err
+		}
+		return placeholder, nil
 	case tokens.TokenLeftCurly:
 		return p.parseObjectLiteral()
 	case tokens.TokenLeftBracket:
 		return p.parseArrayLiteral()
 	case tokens.TokenIdent:
+		if p.isVariable(p.curToken.Literal) {
+			ident := &expressions.IdentifierExpr{
+				Name:   p.curToken.Literal,
+				Line:   p.curToken.Line,
+				Column: p.curToken.Column,
+			}
+			if err := p.nextToken(); err != nil {
+				return nil, err
+			}
+			return ident, nil
+		}
 		if p.peekTokenIs(tokens.TokenLparen) || p.peekTokenIs(tokens.TokenDot) {
 			return p.parseFunctionCall()
 		}
+		if p.curTokenIsKeyword("LET") {
+			return p.parseLet()
+		}
 		return nil, errors.NewSyntaxError(fmt.Sprintf("Bare identifier '%s' is not allowed outside of context references or object keys", p.curToken.Literal), p.curToken.Line, p.curToken.Column)
 	default:
 		return nil, errors.NewSyntaxError(fmt.Sprintf("Unexpected token %s", p.curToken.Literal), p.curToken.Line, p.curToken.Column)
 	}
 }
 
+// parseLet parses "LET name = value[, name = value...] IN body". Each
+// binding is in scope in the bindings after it and in the body, so several
+// bindings lower into nested LET expressions.
+func (p *Parser) parseLet() (ast.Expression, error) {
+	letTok := p.curToken
+	if err := p.requireVersion(LanguageVersion1_2, "LET", letTok); err != nil {
+		return nil, err
+	}
+	return p.parseLetBinding(letTok)
+}
+
+// parseLetBinding parses "name = value" and what follows it up to the end
+// of the body, the current token being the one before name.
+func (p *Parser) parseLetBinding(letTok tokens.Token) (ast.Expression, error) {
+	if err := p.nextToken(); err != nil {
+		return nil, err
+	}
+	nameTok := p.curToken
+	if !p.curTokenIs(tokens.TokenIdent) || p.curTokenIsKeyword("LET") || p.curTokenIsKeyword("IN") {
+		return nil, errors.NewSyntaxError(fmt.Sprintf("Expected variable name in LET expression, got %s", nameTok.Literal), nameTok.Line, nameTok.Column)
+	}
+	if err := p.nextToken(); err != nil {
+		return nil, err
+	}
+	if !p.curTokenIs(tokens.TokenAssign) {
+		return nil, errors.NewSyntaxError(fmt.Sprintf("Expected '=' after variable '%s' in LET expression", nameTok.Literal), p.curToken.Line, p.curToken.Column)
+	}
+	if err := p.nextToken(); err != nil {
+		return nil, err
+	}
+	value, err := p.ParseExpression()
+	if err != nil {
+		return nil, err
+	}
+	p.variables = append(p.variables, nameTok.Literal)
+	defer func() { p.variables = p.variables[:len(p.variables)-1] }()
+	var body ast.Expression
+	switch {
+	case p.curTokenIs(tokens.TokenComma):
+		body, err = p.parseLetBinding(letTok)
+	case p.curTokenIsKeyword("IN"):
+		if err := p.nextToken(); err != nil {
+			return nil, err
+		}
+		body, err = p.ParseExpression()
+	default:
+		return nil, errors.NewSyntaxError("Expected IN in LET expression", p.curToken.Line, p.curToken.Column)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &expressions.LetExpr{
+		Name:   nameTok.Literal,
+		Value:  value,
+		Body:   body,
+		Line:   letTok.Line,
+		Column: letTok.Column,
+	}, nil
+}
+
+// itemInScope reports whether function arguments may read the variable
+// item, which functions taking an expression argument bind to each element.
+// It was introduced with LET.
+func (p *Parser) itemInScope() bool {
+	return languageLevel(p.LanguageVersion()) >= languageLevel(LanguageVersion1_2)
+}
+
+// isVariable reports whether name is bound by an enclosing LET expression.
+// A variable shadows a library of the same name, so x.y inside the scope
+// of x accesses field y of x.
+func (p *Parser) isVariable(name string) bool {
+	for _, v := range p.variables {
+		if v == name {
+			return true
+		}
+	}
+	return false
+}
+
 func (p *Parser) parseContextExpression() (ast.Expression, error) {
 	startToken := p.curToken
 	if err := p.nextToken(); err != nil {
@@ -480,6 +808,10 @@ func (p *Parser) parseFunctionCall() (ast.Expression, error) {
 	if err := p.nextToken(); err != nil {
 		return nil, err
 	}
+	if p.itemInScope() {
+		p.variables = append(p.variables, env.ItemVariable)
+		defer func() { p.variables = p.variables[:len(p.variables)-1] }()
+	}
 
 	var args []ast.Expression
 	if !p.curTokenIs(tokens.TokenRparen) {
@@ -492,6 +824,9 @@ func (p *Parser) parseFunctionCall() (ast.Expression, error) {
 			if err := p.nextToken(); err != nil {
 				return nil, err
 			}
+			if p.allowTrailingCommas && p.curTokenIs(tokens.TokenRparen) {
+				break
+			}
 			arg, err := p.ParseExpression()
 			if err != nil {
 				return nil, err
@@ -540,6 +875,9 @@ func (p *Parser) parseArrayLiteral() (ast.Expression, error) {
 		if err := p.nextToken(); err != nil {
 			return nil, err
 		}
+		if p.allowTrailingCommas && p.curTokenIs(tokens.TokenRightBracket) {
+			break
+		}
 		expr, err := p.ParseExpression()
 		if err != nil {
 			return nil, err
@@ -561,7 +899,8 @@ func (p *Parser) parseArrayLiteral() (ast.Expression, error) {
 
 func (p *Parser) parseObjectLiteral() (ast.Expression, error) {
 	startToken := p.curToken
-	fields := make(map[string]ast.Expression)
+	var fields []expressions.ObjectField
+	seen := make(map[string]bool)
 
 	if err := p.nextToken(); err != nil {
 		return nil, err
@@ -579,39 +918,28 @@ func (p *Parser) parseObjectLiteral() (ast.Expression, error) {
 	}
 
 	for {
-		var key string
-		if p.curTokenIs(tokens.TokenIdent) || p.curTokenIs(tokens.TokenString) {
-			key = strings.TrimSpace(p.curToken.Literal)
+		var field expressions.ObjectField
+		var err error
+		if p.curTokenIs(tokens.TokenLeftBracket) {
+			field, err = p.parseComputedField()
 		} else {
-			return nil, errors.NewSyntaxError("Expected identifier or string as object key", p.curToken.Line, p.curToken.Column)
-		}
-
-		// Check for duplicate key.
-		if _, exists := fields[key]; exists {
-			return nil, errors.NewSemanticError(fmt.Sprintf("Duplicate key '%s' detected", key), p.curToken.Line, p.curToken.Column)
-		}
-
-		if !p.peekTokenIs(tokens.TokenColon) {
-			return nil, errors.NewSyntaxError("Expected ':' after object key", p.peekToken.Line, p.peekToken.Column)
+			field, err = p.parseStaticField(seen)
 		}
-
-		if err := p.nextToken(); err != nil {
-			return nil, err
-		}
-		if err := p.nextToken(); err != nil {
-			return nil, err
-		}
-
-		valueExpr, err := p.ParseExpression()
 		if err != nil {
 			return nil, err
 		}
-		fields[key] = valueExpr
+		fields = append(fields, field)
 
 		if p.curTokenIs(tokens.TokenComma) {
 			// Detect trailing comma.
 			if p.peekTokenIs(tokens.TokenRightCurly) {
-				return nil, errors.NewSyntaxError("Trailing comma not allowed in object literal", p.peekToken.Line, p.peekToken.Column)
+				if !p.allowTrailingCommas {
+					return nil, errors.NewSyntaxError("Trailing comma not allowed in object literal", p.peekToken.Line, p.peekToken.Column)
+				}
+				if err := p.nextToken(); err != nil {
+					return nil, err
+				}
+				break
 			}
 			if err := p.nextToken(); err != nil {
 				return nil, err
@@ -638,10 +966,82 @@ func (p *Parser) parseObjectLiteral() (ast.Expression, error) {
 	}, nil
 }
 
+// parseStaticField parses an "ident: expr" or "\"string\": expr" field.
+func (p *Parser) parseStaticField(seen map[string]bool) (expressions.ObjectField, error) {
+	var key string
+	if p.curTokenIs(tokens.TokenIdent) || p.curTokenIs(tokens.TokenString) {
+		key = strings.TrimSpace(p.curToken.Literal)
+	} else {
+		return expressions.ObjectField{}, errors.NewSyntaxError("Expected identifier or string as object key", p.curToken.Line, p.curToken.Column)
+	}
+	keyToken := p.curToken
+
+	// Check for duplicate key.
+	if seen[key] {
+		return expressions.ObjectField{}, errors.NewSemanticError(fmt.Sprintf("Duplicate key '%s' detected", key), p.curToken.Line, p.curToken.Column)
+	}
+	seen[key] = true
+
+	if !p.peekTokenIs(tokens.TokenColon) {
+		return expressions.ObjectField{}, errors.NewSyntaxError("Expected ':' after object key", p.peekToken.Line, p.peekToken.Column)
+	}
+
+	if err := p.nextToken(); err != nil {
+		return expressions.ObjectField{}, err
+	}
+	if err := p.nextToken(); err != nil {
+		return expressions.ObjectField{}, err
+	}
+
+	valueExpr, err := p.ParseExpression()
+	if err != nil {
+		return expressions.ObjectField{}, err
+	}
+	return expressions.ObjectField{Key: key, Value: valueExpr, Line: keyToken.Line, Column: keyToken.Column}, nil
+}
+
+// parseComputedField parses a "[keyExpr]: expr" field.
+func (p *Parser) parseComputedField() (expressions.ObjectField, error) {
+	if err := p.requireVersion(LanguageVersion1_1, "Computed object key", p.curToken); err != nil {
+		return expressions.ObjectField{}, err
+	}
+	if err := p.nextToken(); err != nil {
+		return expressions.ObjectField{}, err
+	}
+	keyExpr, err := p.ParseExpression()
+	if err != nil {
+		return expressions.ObjectField{}, err
+	}
+	if !p.curTokenIs(tokens.TokenRightBracket) {
+		return expressions.ObjectField{}, errors.NewSyntaxError("Expected ']' after computed object key", p.curToken.Line, p.curToken.Column)
+	}
+	if !p.peekTokenIs(tokens.TokenColon) {
+		return expressions.ObjectField{}, errors.NewSyntaxError("Expected ':' after object key", p.peekToken.Line, p.peekToken.Column)
+	}
+	if err := p.nextToken(); err != nil {
+		return expressions.ObjectField{}, err
+	}
+	if err := p.nextToken(); err != nil {
+		return expressions.ObjectField{}, err
+	}
+	valueExpr, err := p.ParseExpression()
+	if err != nil {
+		return expressions.ObjectField{}, err
+	}
+	line, column := keyExpr.Pos()
+	return expressions.ObjectField{KeyExpr: keyExpr, Value: valueExpr, Line: line, Column: column}, nil
+}
+
 func (p *Parser) curTokenIs(t tokens.TokenType) bool {
 	return p.curToken.Type == t
 }
 
+// curTokenIsKeyword reports whether the current token is an identifier
+// matching the given contextual keyword, case-insensitively.
+func (p *Parser) curTokenIsKeyword(keyword string) bool {
+	return p.curTokenIs(tokens.TokenIdent) && strings.ToUpper(p.curToken.Literal) == keyword
+}
+
 func (p *Parser) peekTokenIs(t tokens.TokenType) bool {
 	return p.peekToken.Type == t
 }
@@ -0,0 +1,115 @@
+package parser
+
+import (
+	"github.com/SpecDrivenDesign/lql/pkg/errors"
+	"github.com/SpecDrivenDesign/lql/pkg/lexer"
+	"strings"
+	"testing"
+)
+
+func parse(src string, configure func(*Parser)) error {
+	p, err := NewParser(lexer.NewLexer(src))
+	if err != nil {
+		return err
+	}
+	if configure != nil {
+		configure(p)
+	}
+	_, err = p.ParseExpression()
+	return err
+}
+
+func TestNestingLimit(t *testing.T) {
+	nested := func(open, inner, close string, n int) string {
+		return strings.Repeat(open, n) + inner + strings.Repeat(close, n)
+	}
+	tests := []struct {
+		name string
+		src  string
+		ok   bool
+	}{
+		{"parentheses at the limit", nested("(", "1", ")", DefaultMaxNesting-1), true},
+		{"parentheses past the limit", nested("(", "1", ")", DefaultMaxNesting), false},
+		{"prefix operators at the limit", nested("NOT ", "true", "", DefaultMaxNesting-1), true},
+		{"prefix operators past the limit", nested("-", "1", "", DefaultMaxNesting), false},
+		{"arrays past the limit", nested("[", "1", "]", DefaultMaxNesting), false},
+		{"calls past the limit", nested("math.abs(", "1", ")", DefaultMaxNesting), false},
+		{"deep enough to overflow the stack", nested("(", "1", ")", 1_000_000), false},
+		{"long chains do not nest", strings.Repeat("1 + ", 5000) + "1", true},
+	}
+	for _, tt := range tests {
+		err := parse(tt.src, nil)
+		if tt.ok && err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		if !tt.ok {
+			if _, ok := err.(*errors.SyntaxError); !ok || !strings.Contains(err.Error(), "levels deep") {
+				t.Errorf("%s: got %v, want a nesting SyntaxError", tt.name, err)
+			}
+		}
+	}
+}
+
+func TestSetMaxNesting(t *testing.T) {
+	src := "((1))"
+	if err := parse(src, func(p *Parser) { p.SetMaxNesting(2) }); err == nil {
+		t.Errorf("%s parsed with a limit of 2", src)
+	}
+	if err := parse(src, func(p *Parser) { p.SetMaxNesting(3) }); err != nil {
+		t.Errorf("%s with a limit of 3: %v", src, err)
+	}
+	deep := strings.Repeat("(", 2*DefaultMaxNesting) + "1" + strings.Repeat(")", 2*DefaultMaxNesting)
+	if err := parse(deep, func(p *Parser) { p.SetMaxNesting(0) }); err != nil {
+		t.Errorf("unlimited nesting: %v", err)
+	}
+}
+
+func TestTrailingCommas(t *testing.T) {
+	tests := []struct {
+		src   string
+		allow bool // whether SetAllowTrailingCommas(true) accepts src
+	}{
+		{"[1, 2,]", true},
+		{"[[1,], 2,]", true},
+		{"{a: 1, b: 2,}", true},
+		{`{"a": [1,],}`, true},
+		{"math.max(1, 2,)", true},
+		{"math.abs($x,)", true},
+		{"[,]", false},
+		{"[1,,]", false},
+		{"{,}", false},
+		{"{a: 1,,}", false},
+		{"math.max(,)", false},
+		{"math.max(1,,)", false},
+	}
+	allow := func(p *Parser) { p.SetAllowTrailingCommas(true) }
+	for _, tt := range tests {
+		if err := parse(tt.src, nil); err == nil {
+			t.Errorf("%s parsed without trailing commas allowed", tt.src)
+		} else if _, ok := err.(*errors.SyntaxError); !ok {
+			t.Errorf("%s: got %T, want a SyntaxError", tt.src, err)
+		}
+		err := parse(tt.src, allow)
+		if tt.allow && err != nil {
+			t.Errorf("%s with trailing commas allowed: %v", tt.src, err)
+		}
+		if !tt.allow && err == nil {
+			t.Errorf("%s parsed with trailing commas allowed", tt.src)
+		}
+	}
+}
+
+func TestTrailingCommasKeepTree(t *testing.T) {
+	p, err := NewParser(lexer.NewLexer("{a: [1, 2,], b: math.max(1, 2,),}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.SetAllowTrailingCommas(true)
+	expr, err := p.ParseExpression()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := expr.String(), `{"a": [1, 2], "b": math.max(1, 2)}`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
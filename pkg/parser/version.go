@@ -0,0 +1,76 @@
+package parser
+
+import (
+	"fmt"
+	"github.com/SpecDrivenDesign/lql/pkg/errors"
+	"github.com/SpecDrivenDesign/lql/pkg/tokens"
+	"strings"
+)
+
+// Language versions. Each version accepts all the syntax of the versions
+// before it, so an expression written for an older version parses the same
+// way under a newer one.
+const (
+	// LanguageVersion1_0 is the original syntax.
+	LanguageVersion1_0 = "1.0"
+	// LanguageVersion1_1 adds BETWEEN, LIKE, the =~ and !~ operators,
+	// computed object keys, [*] projection, .. recursive descent, the ?:
+	// default operator and :name placeholders.
+	LanguageVersion1_1 = "1.1"
+	// LanguageVersion1_2 adds LET expressions.
+	LanguageVersion1_2 = "1.2"
+
+	// LatestLanguageVersion is the newest version this parser understands.
+	LatestLanguageVersion = LanguageVersion1_2
+)
+
+// LanguageVersions lists the supported language versions, oldest first.
+var LanguageVersions = []string{LanguageVersion1_0, LanguageVersion1_1, LanguageVersion1_2}
+
+// languageLevel returns the position of version in LanguageVersions, or -1
+// if it is not supported.
+func languageLevel(version string) int {
+	for i, v := range LanguageVersions {
+		if v == version {
+			return i
+		}
+	}
+	return -1
+}
+
+// CheckLanguageVersion returns an error if version is not one this parser
+// supports, such as a version recorded by a newer compiler.
+func CheckLanguageVersion(version string) error {
+	if languageLevel(version) < 0 {
+		return fmt.Errorf("unsupported language version %q (supported: %s)", version, strings.Join(LanguageVersions, ", "))
+	}
+	return nil
+}
+
+// SetLanguageVersion restricts the parser to the syntax of the given
+// language version; syntax introduced later is rejected with a SyntaxError.
+// A parser accepts the latest version unless told otherwise.
+func (p *Parser) SetLanguageVersion(version string) error {
+	if err := CheckLanguageVersion(version); err != nil {
+		return err
+	}
+	p.languageVersion = version
+	return nil
+}
+
+// LanguageVersion returns the language version the parser accepts.
+func (p *Parser) LanguageVersion() string {
+	if p.languageVersion == "" {
+		return LatestLanguageVersion
+	}
+	return p.languageVersion
+}
+
+// requireVersion rejects the construct at tok when it was introduced after
+// the language version the parser accepts.
+func (p *Parser) requireVersion(version, construct string, tok tokens.Token) error {
+	if languageLevel(p.LanguageVersion()) >= languageLevel(version) {
+		return nil
+	}
+	return errors.NewSyntaxError(fmt.Sprintf("%s requires language version %s, but the expression is parsed as version %s", construct, version, p.LanguageVersion()), tok.Line, tok.Column)
+}
@@ -0,0 +1,132 @@
+// Package result reads the values expressions evaluate to as Go types, so
+// hosts need no type switches over interface{}:
+//
+//	value, err := expr.Eval(ctx, environment)
+//	if err != nil {
+//		...
+//	}
+//	approved, err := result.Of(value).AsBool()
+//
+// Each As method fails with a *MismatchError when the value is of another
+// type.
+package result
+
+import (
+	"fmt"
+	"github.com/SpecDrivenDesign/lql/pkg/env/libraries"
+	"github.com/SpecDrivenDesign/lql/pkg/types"
+	"math"
+	"time"
+)
+
+// Result is a value produced by an evaluation.
+type Result struct {
+	value interface{}
+}
+
+// Of wraps value.
+func Of(value interface{}) Result {
+	return Result{value: value}
+}
+
+// MismatchError reports a result read as a type it does not have.
+type MismatchError struct {
+	// Want is the type requested and Got the type of the result, both
+	// named as the language names them, such as "int" or "object".
+	Want, Got string
+}
+
+func (e *MismatchError) Error() string {
+	return fmt.Sprintf("result is %s, not %s", e.Got, e.Want)
+}
+
+func (r Result) mismatch(want string) error {
+	return &MismatchError{Want: want, Got: libraries.TypeNameOf(r.value)}
+}
+
+// Value returns the wrapped value.
+func (r Result) Value() interface{} {
+	return r.value
+}
+
+// IsNull reports whether the result is null.
+func (r Result) IsNull() bool {
+	return r.value == nil
+}
+
+// AsBool returns a boolean result.
+func (r Result) AsBool() (bool, error) {
+	b, ok := r.value.(bool)
+	if !ok {
+		return false, r.mismatch("bool")
+	}
+	return b, nil
+}
+
+// AsInt64 returns an integer result. A float with no fractional part that
+// fits in an int64 is converted.
+func (r Result) AsInt64() (int64, error) {
+	if types.IsInt(r.value) {
+		i, _ := types.ToInt(r.value)
+		return i, nil
+	}
+	if f, ok := r.value.(float64); ok && f == math.Trunc(f) && f >= math.MinInt64 && f < math.MaxInt64 {
+		return int64(f), nil
+	}
+	return 0, r.mismatch("int")
+}
+
+// AsFloat64 returns a numeric result as a float.
+func (r Result) AsFloat64() (float64, error) {
+	f, ok := types.ToFloat(r.value)
+	if !ok {
+		return 0, r.mismatch("number")
+	}
+	return f, nil
+}
+
+// AsDecimal returns a numeric result as a decimal. A float converts to
+// the decimal it is written as.
+func (r Result) AsDecimal() (types.Decimal, error) {
+	d, ok := types.DecimalOf(r.value)
+	if !ok {
+		return types.Decimal{}, r.mismatch("number")
+	}
+	return d, nil
+}
+
+// AsString returns a string result.
+func (r Result) AsString() (string, error) {
+	s, ok := r.value.(string)
+	if !ok {
+		return "", r.mismatch("string")
+	}
+	return s, nil
+}
+
+// AsSlice returns an array result. The slice is not copied.
+func (r Result) AsSlice() ([]interface{}, error) {
+	s, ok := types.ConvertToInterfaceSlice(r.value)
+	if !ok {
+		return nil, r.mismatch("array")
+	}
+	return s, nil
+}
+
+// AsMap returns an object result. The map is not copied.
+func (r Result) AsMap() (map[string]interface{}, error) {
+	m, ok := types.ConvertToStringMap(r.value)
+	if !ok {
+		return nil, r.mismatch("object")
+	}
+	return m, nil
+}
+
+// AsTime returns a time result in its zone.
+func (r Result) AsTime() (time.Time, error) {
+	tv, ok := r.value.(libraries.TimeValue)
+	if !ok {
+		return time.Time{}, r.mismatch("time")
+	}
+	return tv.Time(), nil
+}
@@ -0,0 +1,89 @@
+package result
+
+import (
+	"github.com/SpecDrivenDesign/lql/pkg/types"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestAccessors(t *testing.T) {
+	oslo, err := time.LoadLocation("Europe/Oslo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	when := time.Date(2024, 5, 1, 12, 0, 0, 0, oslo)
+	slice := []interface{}{int64(1), "a"}
+	obj := map[string]interface{}{"k": "v"}
+
+	if b, err := Of(true).AsBool(); err != nil || !b {
+		t.Errorf("AsBool: %v, %v", b, err)
+	}
+	if i, err := Of(int64(-7)).AsInt64(); err != nil || i != -7 {
+		t.Errorf("AsInt64: %v, %v", i, err)
+	}
+	if i, err := Of(3.0).AsInt64(); err != nil || i != 3 {
+		t.Errorf("AsInt64 of a whole float: %v, %v", i, err)
+	}
+	if f, err := Of(int64(2)).AsFloat64(); err != nil || f != 2 {
+		t.Errorf("AsFloat64 of an int: %v, %v", f, err)
+	}
+	if f, err := Of(2.5).AsFloat64(); err != nil || f != 2.5 {
+		t.Errorf("AsFloat64: %v, %v", f, err)
+	}
+	if d, err := Of(1.25).AsDecimal(); err != nil || d.String() != "1.25" {
+		t.Errorf("AsDecimal of a float: %v, %v", d, err)
+	}
+	if d, err := Of(types.NewDecimal(1050, 2)).AsDecimal(); err != nil || d.String() != "10.50" {
+		t.Errorf("AsDecimal: %v, %v", d, err)
+	}
+	if s, err := Of("x").AsString(); err != nil || s != "x" {
+		t.Errorf("AsString: %v, %v", s, err)
+	}
+	if s, err := Of(slice).AsSlice(); err != nil || len(s) != 2 || &s[0] != &slice[0] {
+		t.Errorf("AsSlice: %v, %v; want the slice itself", s, err)
+	}
+	if m, err := Of(obj).AsMap(); err != nil || m["k"] != "v" {
+		t.Errorf("AsMap: %v, %v", m, err)
+	} else if m["added"] = true; obj["added"] != true {
+		t.Error("AsMap copied the map")
+	}
+	if got, err := Of(types.TimeValueOf(when)).AsTime(); err != nil || !got.Equal(when) || got.Location().String() != "Europe/Oslo" {
+		t.Errorf("AsTime: %v, %v", got, err)
+	}
+	if !Of(nil).IsNull() || Of(false).IsNull() {
+		t.Error("IsNull")
+	}
+	if Of("x").Value() != "x" {
+		t.Error("Value")
+	}
+}
+
+func TestAccessorMismatches(t *testing.T) {
+	tests := []struct {
+		name string
+		read func() error
+		want string
+	}{
+		{"AsBool", func() error { _, err := Of(int64(1)).AsBool(); return err }, "result is int, not bool"},
+		{"AsBool", func() error { _, err := Of(nil).AsBool(); return err }, "result is null, not bool"},
+		{"AsInt64", func() error { _, err := Of(1.5).AsInt64(); return err }, "result is float, not int"},
+		{"AsInt64", func() error { _, err := Of(1e300).AsInt64(); return err }, "result is float, not int"},
+		{"AsFloat64", func() error { _, err := Of("1").AsFloat64(); return err }, "result is string, not number"},
+		{"AsDecimal", func() error { _, err := Of(true).AsDecimal(); return err }, "result is bool, not number"},
+		{"AsString", func() error { _, err := Of([]interface{}{}).AsString(); return err }, "result is array, not string"},
+		{"AsSlice", func() error { _, err := Of(map[string]interface{}{}).AsSlice(); return err }, "result is object, not array"},
+		{"AsMap", func() error { _, err := Of("s").AsMap(); return err }, "result is string, not object"},
+		{"AsTime", func() error { _, err := Of(int64(0)).AsTime(); return err }, "result is int, not time"},
+	}
+	for _, tt := range tests {
+		err := tt.read()
+		if _, ok := err.(*MismatchError); !ok {
+			t.Errorf("%s: got %v, want a MismatchError", tt.name, err)
+			continue
+		}
+		if err.Error() != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, err, tt.want)
+		}
+	}
+}
@@ -1,15 +1,28 @@
 package signing
 
 import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/x509"
+	"encoding/binary"
 	"encoding/pem"
 	"fmt"
+	"github.com/SpecDrivenDesign/lql/pkg/tokens"
 	"os"
 	"path/filepath"
 	"strings"
 )
 
+// AlgorithmRS256 is the signature algorithm of signed bytecode:
+// RSASSA-PKCS1-v1_5 over a SHA-256 digest of the token data.
+const AlgorithmRS256 = "RS256"
+
+// Algorithms lists the signature algorithms this build can sign and verify.
+var Algorithms = []string{AlgorithmRS256}
+
 // LoadPrivateKey reads a PEM file and parses it as an RSA private key.
 func LoadPrivateKey(filename string) (*rsa.PrivateKey, error) {
 	// Clean and validate the filename.
@@ -81,3 +94,30 @@ func LoadPublicKey(filename string) (*rsa.PublicKey, error) {
 		return nil, fmt.Errorf("unsupported key type %q", block.Type)
 	}
 }
+
+// SignTokenData wraps token data in the signed container format: the header
+// magic, the little-endian payload length, the payload and its RSA signature.
+func SignTokenData(tokenData []byte, priv *rsa.PrivateKey) ([]byte, error) {
+	hash := sha256.Sum256(tokenData)
+	signature, err := rsa.SignPKCS1v15(rand.Reader, priv, crypto.SHA256, hash[:])
+	if err != nil {
+		return nil, err
+	}
+
+	if len(tokenData) > int(^uint32(0)) {
+		return nil, fmt.Errorf("token data length %d exceeds maximum allowed size", len(tokenData))
+	}
+
+	tokenLen := uint32(len(tokenData))
+
+	var buf bytes.Buffer
+	buf.WriteString(tokens.HeaderMagic)
+
+	if err := binary.Write(&buf, binary.LittleEndian, tokenLen); err != nil {
+		return nil, err
+	}
+	buf.Write(tokenData)
+	buf.Write(signature)
+
+	return buf.Bytes(), nil
+}
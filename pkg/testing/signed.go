@@ -0,0 +1,59 @@
+package testing
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"github.com/SpecDrivenDesign/lql/pkg/bytecode"
+	"github.com/SpecDrivenDesign/lql/pkg/lexer"
+	"github.com/SpecDrivenDesign/lql/pkg/parser"
+	"github.com/SpecDrivenDesign/lql/pkg/signing"
+	"sync"
+)
+
+var (
+	signingKeyOnce sync.Once
+	signingKey     *rsa.PrivateKey
+	signingKeyErr  error
+)
+
+// testSigningKey returns a key generated once per run for signed cases.
+func testSigningKey() (*rsa.PrivateKey, error) {
+	signingKeyOnce.Do(func() {
+		signingKey, signingKeyErr = rsa.GenerateKey(rand.Reader, 2048)
+	})
+	return signingKey, signingKeyErr
+}
+
+// signedTokenStream compiles src into a signed token artifact with embedded
+// source, as lql compile -signed -embed-source -format tokens does,
+// checks that flipping any single bit of the artifact makes verification
+// fail, and returns a reader over the verified tokens.
+func signedTokenStream(src string) (parser.TokenStream, error) {
+	l := lexer.NewLexer(src)
+	l.SetEmbedSource(true)
+	tokenData, err := l.ExportTokens()
+	if err != nil {
+		return nil, err
+	}
+	key, err := testSigningKey()
+	if err != nil {
+		return nil, err
+	}
+	signed, err := signing.SignTokenData(tokenData, key)
+	if err != nil {
+		return nil, err
+	}
+
+	tampered := make([]byte, len(signed))
+	for i := range signed {
+		for bit := 0; bit < 8; bit++ {
+			copy(tampered, signed)
+			tampered[i] ^= 1 << bit
+			if _, err := bytecode.VerifySignedData(tampered, &key.PublicKey); err == nil {
+				return nil, fmt.Errorf("flipping bit %d of byte %d of the signed artifact was not detected", bit, i)
+			}
+		}
+	}
+	return bytecode.NewByteCodeReaderFromSignedData(signed, &key.PublicKey)
+}
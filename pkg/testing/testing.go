@@ -3,14 +3,20 @@ package testing
 import (
 	stdErrors "errors"
 	"fmt"
+	"github.com/SpecDrivenDesign/lql/pkg/ast"
+	"github.com/SpecDrivenDesign/lql/pkg/ast/expressions"
 	astClass "github.com/SpecDrivenDesign/lql/pkg/ast/expressions"
+	"github.com/SpecDrivenDesign/lql/pkg/compile"
 	"github.com/SpecDrivenDesign/lql/pkg/env"
 	"github.com/SpecDrivenDesign/lql/pkg/errors"
 	"github.com/SpecDrivenDesign/lql/pkg/lexer"
 	"github.com/SpecDrivenDesign/lql/pkg/parser"
+	"github.com/SpecDrivenDesign/lql/pkg/tokens"
 	"github.com/SpecDrivenDesign/lql/pkg/types"
+	"github.com/SpecDrivenDesign/lql/pkg/vm"
 	"math"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -24,6 +30,70 @@ type TestCase struct {
 	ExpectedResult       interface{}            `yaml:"expectedResult"`
 	Skip                 bool                   `yaml:"skip"`
 	Focus                bool                   `yaml:"focus"`
+	Seed                 *int64                 `yaml:"seed"`
+	Limits               *TestLimits            `yaml:"limits"`
+	Signed               bool                   `yaml:"signed"`
+	LanguageVersion      string                 `yaml:"languageVersion"`
+	Roots                map[string]interface{} `yaml:"roots"`
+	Lenient              bool                   `yaml:"lenient"`
+	NumericPromotion     bool                   `yaml:"numericPromotion"`
+	Decimal              bool                   `yaml:"decimal"`
+	CaseInsensitive      bool                   `yaml:"caseInsensitive"`
+	Parallelism          int                    `yaml:"parallelism"`
+	Profile              string                 `yaml:"profile"`
+	Mocks                map[string]interface{} `yaml:"mocks"`
+	Capabilities         *[]string              `yaml:"capabilities"`
+	ExpectedMetrics      *TestMetrics           `yaml:"expectedMetrics"`
+}
+
+// testScope returns the scope tc is evaluated in, with its roots.
+func testScope(tc TestCase) *env.Scope {
+	if tc.Roots == nil {
+		return nil
+	}
+	return env.NewScope(tc.Roots)
+}
+
+// testProfile returns the built-in profile named name, or the zero
+// profile if name is empty.
+func testProfile(name string) (env.Profile, error) {
+	if name == "" {
+		return env.Profile{}, nil
+	}
+	profile, ok := env.LookupProfile(name)
+	if !ok {
+		return env.Profile{}, fmt.Errorf("unknown profile %q", name)
+	}
+	return profile, nil
+}
+
+// mockHook is a call hook that answers calls to the functions it maps,
+// by "library.function", with their results instead of invoking them.
+type mockHook map[string]interface{}
+
+func (m mockHook) BeforeCall(call env.CallDescriptor) (interface{}, bool, error) {
+	result, ok := m[call.Library+"."+call.Function]
+	return result, ok, nil
+}
+
+func (m mockHook) AfterCall(env.CallDescriptor, interface{}, error, time.Duration) {}
+
+// TestLimits sets the environment's resource limits for one test case.
+type TestLimits struct {
+	MaxNodeEvaluations int64 `yaml:"maxNodeEvaluations"`
+	MaxArrayLength     int   `yaml:"maxArrayLength"`
+	MaxStringLength    int   `yaml:"maxStringLength"`
+	MaxAllocatedBytes  int64 `yaml:"maxAllocatedBytes"`
+	MaxDepth           int   `yaml:"maxDepth"`
+}
+
+// TestMetrics is the part of an evaluation's metrics a test case checks.
+// Regex compiles and wall time depend on what ran before, so they are not
+// checked.
+type TestMetrics struct {
+	NodeEvaluations int64            `yaml:"nodeEvaluations"`
+	FunctionCalls   map[string]int64 `yaml:"functionCalls"`
+	MaxDepth        int              `yaml:"maxDepth"`
 }
 
 // TestResult represents the result of executing a test case.
@@ -54,12 +124,35 @@ type TestSuiteResult struct {
 	TestResults []TestResult `yaml:"test_results"`
 }
 
-// RunTests processes test cases and returns a suite result.
+// Evaluator selects how RunTests evaluates expressions.
+type Evaluator int
+
+const (
+	// TreeEvaluator evaluates the expression tree node by node.
+	TreeEvaluator Evaluator = iota
+	// CompiledEvaluator evaluates programs compiled to closures.
+	CompiledEvaluator
+	// MemoizedEvaluator evaluates programs compiled to closures that
+	// memoize repeated subexpressions.
+	MemoizedEvaluator
+	// VMEvaluator runs programs compiled to instructions, after a round
+	// trip through their encoding. Expressions the instruction set cannot
+	// represent are evaluated as a tree.
+	VMEvaluator
+)
 
-func RunTests(testCases []TestCase, env *env.Environment, failFast bool, benchmark bool) TestSuiteResult {
+// RunTests processes test cases and returns a suite result. When
+// concurrency is above one, each evaluation is repeated from that many
+// goroutines at once, which must all give the result of the first.
+func RunTests(testCases []TestCase, env *env.Environment, failFast bool, benchmark bool, evaluator Evaluator, concurrency int) TestSuiteResult {
 	suiteResult := TestSuiteResult{
 		TestResults: []TestResult{},
 	}
+	// Cases that list capabilities hold only those; the others hold the
+	// environment's.
+	granted := env.Capabilities
+	defer func() { env.Capabilities = granted }()
+
 	// Determine if any test is marked as focused.
 	focusMode := false
 	for _, tc := range testCases {
@@ -101,9 +194,28 @@ func RunTests(testCases []TestCase, env *env.Environment, failFast bool, benchma
 		// Only count tests that actually run.
 		suiteResult.Total++
 
-		// Parse the expression.
-		lexer := lexer.NewLexer(tc.Expression)
-		parser, err := parser.NewParser(lexer)
+		// Parse the expression from a single lex pass, or read it back
+		// from a signed artifact when the case asks for one.
+		var tokenStream parser.TokenStream
+		var err error
+		if tc.Signed {
+			tokenStream, err = signedTokenStream(tc.Expression)
+		} else {
+			var toks []tokens.Token
+			toks, err = lexer.NewLexer(tc.Expression).Tokens()
+			tokenStream = lexer.NewTokenSliceStream(toks)
+		}
+		var p *parser.Parser
+		if err == nil {
+			p, err = parser.NewParser(tokenStream)
+		}
+		if err == nil && tc.LanguageVersion != "" {
+			err = p.SetLanguageVersion(tc.LanguageVersion)
+		}
+		profile, profileErr := testProfile(tc.Profile)
+		if err == nil {
+			err = profileErr
+		}
 		if err != nil {
 			var errorWithDetail errors.PositionalError
 			hasErrorWithDetail := stdErrors.As(err, &errorWithDetail)
@@ -129,7 +241,7 @@ func RunTests(testCases []TestCase, env *env.Environment, failFast bool, benchma
 			continue
 		}
 
-		ast, parseErr := parser.ParseExpression()
+		ast, parseErr := p.ParseExpression()
 		if parseErr != nil {
 			var errorWithDetail errors.PositionalError
 			hasErrorWithDetail := stdErrors.As(parseErr, &errorWithDetail)
@@ -156,7 +268,68 @@ func RunTests(testCases []TestCase, env *env.Environment, failFast bool, benchma
 		result.Expression = ast.String()
 
 		// Evaluate the AST.
-		evalResult, evalErr := ast.Eval(tc.Context, env)
+		if tc.Seed != nil {
+			env.SetRandomSeed(*tc.Seed)
+		}
+		var limits TestLimits
+		if tc.Limits != nil {
+			limits = *tc.Limits
+		}
+		env.Limits.MaxNodeEvaluations = limits.MaxNodeEvaluations
+		env.Limits.MaxArrayLength = limits.MaxArrayLength
+		env.Limits.MaxStringLength = limits.MaxStringLength
+		env.Limits.MaxAllocatedBytes = limits.MaxAllocatedBytes
+		env.Limits.MaxDepth = limits.MaxDepth
+		env.Lenient = tc.Lenient
+		env.SetNumericPromotion(tc.NumericPromotion)
+		env.SetDecimalArithmetic(tc.Decimal)
+		if tc.CaseInsensitive {
+			env.SetCollator(types.CaseInsensitive)
+		} else {
+			env.SetCollator(nil)
+		}
+		env.SetParallelism(tc.Parallelism)
+		env.Profile = profile
+		env.Capabilities = granted
+		if tc.Capabilities != nil {
+			env.Capabilities = make(map[string]bool)
+			env.Grant(*tc.Capabilities...)
+		}
+		env.CallHook = nil
+		if tc.Mocks != nil {
+			env.CallHook = mockHook(tc.Mocks)
+		}
+		scope := testScope(tc)
+		eval := func(ctx map[string]interface{}) (interface{}, error) {
+			return expressions.EvalIn(ast, ctx, scope, env)
+		}
+		switch evaluator {
+		case CompiledEvaluator, MemoizedEvaluator:
+			program := compile.CompileWithOptions(ast, env, compile.Options{Memoize: evaluator == MemoizedEvaluator})
+			eval = func(ctx map[string]interface{}) (interface{}, error) {
+				return program.EvalIn(ctx, scope)
+			}
+		case VMEvaluator:
+			if program, err := vmProgram(ast); err != nil {
+				eval = func(map[string]interface{}) (interface{}, error) { return nil, err }
+			} else if program != nil {
+				eval = func(ctx map[string]interface{}) (interface{}, error) {
+					return program.RunIn(ctx, scope, env)
+				}
+			}
+		}
+		ctx := tc.Context
+		metrics := collectMetrics(env, tc.ExpectedMetrics != nil)
+		evalResult, evalErr := eval(ctx)
+		env.Metrics = nil
+		// Seeded random values and the node at which a parallel
+		// evaluation crosses a limit depend on the order evaluations run
+		// in, so those cases run alone.
+		if concurrency > 1 && tc.Seed == nil && (tc.Limits == nil || tc.Parallelism <= 1) {
+			if err := evalConcurrently(eval, ctx, concurrency, evalResult, evalErr); err != nil {
+				evalResult, evalErr = nil, err
+			}
+		}
 		if evalErr != nil {
 			var errorWithDetail errors.PositionalError
 			hasErrorWithDetail := stdErrors.As(evalErr, &errorWithDetail)
@@ -196,27 +369,7 @@ func RunTests(testCases []TestCase, env *env.Environment, failFast bool, benchma
 
 		// Compare the actual result with the expected result.
 		result.ActualResult = evalResult
-		var passTest bool
-		if rVal, ok := types.ToFloat(evalResult); ok {
-			if eVal, ok2 := types.ToFloat(tc.ExpectedResult); ok2 {
-				passTest = math.Abs(rVal-eVal) < 1e-9
-			} else {
-				passTest = fmt.Sprintf("%v", evalResult) == fmt.Sprintf("%v", tc.ExpectedResult)
-			}
-		} else {
-			var resultStr, expectedStr string
-			if resStr, ok := evalResult.(string); ok {
-				resultStr = strings.ReplaceAll(resStr, "\n", "\\n")
-			} else {
-				resultStr = fmt.Sprintf("%v", evalResult)
-			}
-			if expStr, ok := tc.ExpectedResult.(string); ok {
-				expectedStr = strings.ReplaceAll(expStr, "\n", "\\n")
-			} else {
-				expectedStr = fmt.Sprintf("%v", tc.ExpectedResult)
-			}
-			passTest = resultStr == expectedStr
-		}
+		passTest := resultMatches(evalResult, tc.ExpectedResult) && metricsMatch(*metrics, tc.ExpectedMetrics)
 
 		if passTest {
 			result.Status = "PASSED"
@@ -240,7 +393,7 @@ func RunTests(testCases []TestCase, env *env.Environment, failFast bool, benchma
 				start := time.Now()
 				for j := 0; j < iterations; j++ {
 					// We ignore errors here since the single-run was already successful.
-					_, _ = ast.Eval(tc.Context, env)
+					_, _ = eval(ctx)
 				}
 				elapsed := time.Since(start)
 				result.BenchmarkTime = elapsed.String()
@@ -253,3 +406,98 @@ func RunTests(testCases []TestCase, env *env.Environment, failFast bool, benchma
 	}
 	return suiteResult
 }
+
+// collectMetrics sets the metrics sink of e, if collect is set, to record
+// into the returned metrics.
+func collectMetrics(e *env.Environment, collect bool) *env.Metrics {
+	metrics := &env.Metrics{}
+	if collect {
+		e.Metrics = env.MetricsFunc(func(m env.Metrics) { *metrics = m })
+	}
+	return metrics
+}
+
+// metricsMatch reports whether the metrics of an evaluation match those a
+// test case expects, if any.
+func metricsMatch(actual env.Metrics, expected *TestMetrics) bool {
+	if expected == nil {
+		return true
+	}
+	if actual.NodeEvaluations != expected.NodeEvaluations || actual.MaxDepth != expected.MaxDepth || len(actual.FunctionCalls) != len(expected.FunctionCalls) {
+		return false
+	}
+	for name, calls := range expected.FunctionCalls {
+		if actual.FunctionCalls[name] != calls {
+			return false
+		}
+	}
+	return true
+}
+
+// resultMatches reports whether an evaluation result matches the expected
+// result. Numbers match within 1e-9; other values match when they print
+// the same.
+func resultMatches(actual, expected interface{}) bool {
+	if rVal, ok := types.ToFloat(actual); ok {
+		if eVal, ok2 := types.ToFloat(expected); ok2 {
+			return math.Abs(rVal-eVal) < 1e-9
+		}
+		return fmt.Sprintf("%v", actual) == fmt.Sprintf("%v", expected)
+	}
+	var resultStr, expectedStr string
+	if resStr, ok := actual.(string); ok {
+		resultStr = strings.ReplaceAll(resStr, "\n", "\\n")
+	} else {
+		resultStr = fmt.Sprintf("%v", actual)
+	}
+	if expStr, ok := expected.(string); ok {
+		expectedStr = strings.ReplaceAll(expStr, "\n", "\\n")
+	} else {
+		expectedStr = fmt.Sprintf("%v", expected)
+	}
+	return resultStr == expectedStr
+}
+
+// evalConcurrently evaluates ctx from n goroutines at once and returns an
+// error describing the first evaluation that did not give want and
+// wantErr.
+func evalConcurrently(eval func(map[string]interface{}) (interface{}, error), ctx map[string]interface{}, n int, want interface{}, wantErr error) error {
+	mismatches := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			got, err := eval(ctx)
+			switch {
+			case (err == nil) != (wantErr == nil):
+				mismatches[i] = fmt.Errorf("concurrent evaluation returned %v, error %v; want %v, error %v", got, err, want, wantErr)
+			case err != nil && err.Error() != wantErr.Error():
+				mismatches[i] = fmt.Errorf("concurrent evaluation failed with %q; want %q", err, wantErr)
+			case err == nil && !resultMatches(got, want):
+				mismatches[i] = fmt.Errorf("concurrent evaluation returned %v; want %v", got, want)
+			}
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range mismatches {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// vmProgram compiles expr to instructions and decodes the encoded program.
+// It returns nil if expr cannot be compiled to instructions.
+func vmProgram(expr ast.Expression) (*vm.Program, error) {
+	program, err := vm.Compile(expr)
+	if err != nil {
+		return nil, nil
+	}
+	code, err := program.Encode()
+	if err != nil {
+		return nil, err
+	}
+	return vm.Decode(code)
+}
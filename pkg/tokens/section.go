@@ -0,0 +1,18 @@
+package tokens
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// AppendSection appends payload to dst behind a 4-byte magic tag and its
+// little-endian uint32 length, the framing of every section of exported
+// token data and compiled artifacts.
+func AppendSection(dst []byte, magic string, payload []byte) ([]byte, error) {
+	if uint64(len(payload)) > uint64(^uint32(0)) {
+		return nil, fmt.Errorf("section length %d exceeds maximum allowed size", len(payload))
+	}
+	dst = append(dst, magic...)
+	dst = binary.LittleEndian.AppendUint32(dst, uint32(len(payload)))
+	return append(dst, payload...), nil
+}
@@ -2,6 +2,14 @@ package tokens
 
 const HeaderMagic = "STOK" // 4-byte header magic
 
+const SourceMagic = "SSRC" // 4-byte magic for an embedded source section
+
+const MetadataMagic = "SMET" // 4-byte magic for an embedded metadata section
+
+const ConstantPoolMagic = "SCON" // 4-byte magic for the constant pool of exported tokens
+
+const CodeMagic = "SCOD" // 4-byte magic for a compiled instruction section
+
 // TokenType defines the type for tokens.
 type TokenType uint8
 
@@ -39,6 +47,11 @@ const (
 	TokenQuestionDot
 	TokenQuestionBracket
 	TokenDollar
+	TokenMatch
+	TokenNotMatch
+	TokenDotDot
+	TokenQuestionColon
+	TokenAssign
 )
 
 // Token represents a lexical token.
@@ -49,6 +62,48 @@ type Token struct {
 	Column  int
 }
 
+// TokenNames gives each TokenType a stable name for tooling.
+var TokenNames = map[TokenType]string{
+	TokenEof:             "EOF",
+	TokenIllegal:         "ILLEGAL",
+	TokenIdent:           "IDENT",
+	TokenNumber:          "NUMBER",
+	TokenString:          "STRING",
+	TokenBool:            "BOOL",
+	TokenNull:            "NULL",
+	TokenPlus:            "PLUS",
+	TokenMinus:           "MINUS",
+	TokenMultiply:        "MULTIPLY",
+	TokenDivide:          "DIVIDE",
+	TokenLt:              "LT",
+	TokenGt:              "GT",
+	TokenLte:             "LTE",
+	TokenGte:             "GTE",
+	TokenEq:              "EQ",
+	TokenNeq:             "NEQ",
+	TokenAnd:             "AND",
+	TokenOr:              "OR",
+	TokenNot:             "NOT",
+	TokenLparen:          "LPAREN",
+	TokenRparen:          "RPAREN",
+	TokenLeftBracket:     "LBRACKET",
+	TokenRightBracket:    "RBRACKET",
+	TokenLeftCurly:       "LCURLY",
+	TokenRightCurly:      "RCURLY",
+	TokenComma:           "COMMA",
+	TokenColon:           "COLON",
+	TokenDot:             "DOT",
+	TokenQuestion:        "QUESTION",
+	TokenQuestionDot:     "QUESTION_DOT",
+	TokenQuestionBracket: "QUESTION_BRACKET",
+	TokenDollar:          "DOLLAR",
+	TokenMatch:           "MATCH",
+	TokenNotMatch:        "NOT_MATCH",
+	TokenDotDot:          "DOT_DOT",
+	TokenQuestionColon:   "QUESTION_COLON",
+	TokenAssign:          "ASSIGN",
+}
+
 // TokenTypeToByte maps each TokenType to a unique byte code.
 var TokenTypeToByte = map[TokenType]byte{
 	TokenEof:             0,
@@ -83,6 +138,11 @@ var TokenTypeToByte = map[TokenType]byte{
 	TokenQuestionDot:     30,
 	TokenQuestionBracket: 31,
 	TokenDollar:          32,
+	TokenMatch:           33,
+	TokenNotMatch:        34,
+	TokenDotDot:          35,
+	TokenQuestionColon:   36,
+	TokenAssign:          37,
 }
 
 // FixedTokenLiterals defines fixed literal strings for tokens.
@@ -112,4 +172,9 @@ var FixedTokenLiterals = map[TokenType]string{
 	TokenQuestionDot:     "?.",
 	TokenQuestionBracket: "?[",
 	TokenDollar:          "$",
+	TokenMatch:           "=~",
+	TokenNotMatch:        "!~",
+	TokenDotDot:          "..",
+	TokenQuestionColon:   "?:",
+	TokenAssign:          "=",
 }
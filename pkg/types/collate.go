@@ -0,0 +1,61 @@
+package types
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Collator orders strings for comparisons and sorting in place of byte
+// order, for rules that match or sort user-facing text. Compare returns a
+// negative number, zero or a positive number as a sorts before, equal to
+// or after b. A Collator must be safe for concurrent use.
+//
+// Locale-aware collation and Unicode normalization are provided by
+// golang.org/x/text, whose collators adapt with CollatorFunc:
+//
+//	c := collate.New(language.German, collate.IgnoreCase)
+//	environment.SetCollator(types.CollatorFunc(c.CompareString))
+//
+// collate.Collator is not safe for concurrent use, so hosts that evaluate
+// concurrently guard it or create one per goroutine.
+type Collator interface {
+	Compare(a, b string) int
+}
+
+// CollatorFunc adapts a comparison function to a Collator.
+type CollatorFunc func(a, b string) int
+
+func (f CollatorFunc) Compare(a, b string) int {
+	return f(a, b)
+}
+
+// CaseInsensitive compares strings by Unicode simple case folding, so
+// "Ärger" equals "ärger". Strings that fold to the same runes are equal;
+// others are ordered by their folded runes.
+var CaseInsensitive Collator = CollatorFunc(compareFolded)
+
+func compareFolded(a, b string) int {
+	for a != "" && b != "" {
+		ra, na := utf8.DecodeRuneInString(a)
+		rb, nb := utf8.DecodeRuneInString(b)
+		if fa, fb := foldRune(ra), foldRune(rb); fa != fb {
+			if fa < fb {
+				return -1
+			}
+			return 1
+		}
+		a, b = a[na:], b[nb:]
+	}
+	return strings.Compare(a, b)
+}
+
+// foldRune maps r to the smallest rune of its case-folding orbit, so that
+// every case variant of a letter folds to the same rune.
+func foldRune(r rune) rune {
+	smallest := r
+	for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+		smallest = min(smallest, f)
+	}
+	return smallest
+}
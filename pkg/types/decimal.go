@@ -0,0 +1,217 @@
+package types
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// DivisionScale is the number of digits after the decimal point to which
+// Decimal quotients that do not terminate sooner are rounded.
+const DivisionScale = 16
+
+// Decimal is an exact base-10 number, the value of an arbitrary-precision
+// integer times 10^-scale. Sums, differences and products are exact and
+// keep the scale of their operands, so 1.10 + 2.20 is 3.30; quotients are
+// rounded half to even to DivisionScale digits. The zero value is 0.
+// Decimals are immutable.
+type Decimal struct {
+	unscaled *big.Int
+	scale    int32
+}
+
+var bigTen = big.NewInt(10)
+
+// NewDecimal returns unscaled × 10^-scale.
+func NewDecimal(unscaled int64, scale int32) Decimal {
+	return normalize(big.NewInt(unscaled), scale)
+}
+
+// ParseDecimal parses a decimal number such as "-12.50" or "1.5e3".
+func ParseDecimal(s string) (Decimal, error) {
+	mantissa, exponent := s, int64(0)
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		exp, err := strconv.ParseInt(s[i+1:], 10, 32)
+		if err != nil {
+			return Decimal{}, fmt.Errorf("invalid decimal %q", s)
+		}
+		mantissa, exponent = s[:i], exp
+	}
+	intPart, fracPart, _ := strings.Cut(mantissa, ".")
+	digits := strings.TrimLeft(intPart, "+-") + fracPart
+	if digits == "" || strings.Trim(digits, "0123456789") != "" {
+		return Decimal{}, fmt.Errorf("invalid decimal %q", s)
+	}
+	unscaled, ok := new(big.Int).SetString(intPart+fracPart, 10)
+	if !ok {
+		return Decimal{}, fmt.Errorf("invalid decimal %q", s)
+	}
+	return normalize(unscaled, int32(int64(len(fracPart))-exponent)), nil
+}
+
+// normalize returns unscaled × 10^-scale with a scale of at least zero.
+func normalize(unscaled *big.Int, scale int32) Decimal {
+	if scale < 0 {
+		unscaled = new(big.Int).Mul(unscaled, pow10(-scale))
+		scale = 0
+	}
+	return Decimal{unscaled: unscaled, scale: scale}
+}
+
+func pow10(n int32) *big.Int {
+	return new(big.Int).Exp(bigTen, big.NewInt(int64(n)), nil)
+}
+
+// DecimalOf converts a number to a Decimal. A float converts to the
+// decimal it is written as, its shortest representation, so 0.1 is exactly
+// 0.1. It reports false for other values, and for NaN and infinities.
+func DecimalOf(val interface{}) (Decimal, bool) {
+	switch v := val.(type) {
+	case Decimal:
+		return v, true
+	case int:
+		return NewDecimal(int64(v), 0), true
+	case int64:
+		return NewDecimal(v, 0), true
+	case float64:
+		d, err := ParseDecimal(strconv.FormatFloat(v, 'g', -1, 64))
+		return d, err == nil
+	}
+	return Decimal{}, false
+}
+
+// IsDecimal reports whether val is a Decimal.
+func IsDecimal(val interface{}) bool {
+	_, ok := val.(Decimal)
+	return ok
+}
+
+func (d Decimal) int() *big.Int {
+	if d.unscaled == nil {
+		return new(big.Int)
+	}
+	return d.unscaled
+}
+
+// rescale returns the unscaled value of d at a scale of at least its own.
+func (d Decimal) rescale(scale int32) *big.Int {
+	if scale == d.scale {
+		return d.int()
+	}
+	return new(big.Int).Mul(d.int(), pow10(scale-d.scale))
+}
+
+// align returns the unscaled values of d and o at their common scale.
+func (d Decimal) align(o Decimal) (*big.Int, *big.Int, int32) {
+	scale := max(d.scale, o.scale)
+	return d.rescale(scale), o.rescale(scale), scale
+}
+
+// Add returns d + o.
+func (d Decimal) Add(o Decimal) Decimal {
+	a, b, scale := d.align(o)
+	return Decimal{unscaled: new(big.Int).Add(a, b), scale: scale}
+}
+
+// Sub returns d - o.
+func (d Decimal) Sub(o Decimal) Decimal {
+	a, b, scale := d.align(o)
+	return Decimal{unscaled: new(big.Int).Sub(a, b), scale: scale}
+}
+
+// Mul returns d × o.
+func (d Decimal) Mul(o Decimal) Decimal {
+	return Decimal{unscaled: new(big.Int).Mul(d.int(), o.int()), scale: d.scale + o.scale}
+}
+
+// Quo returns d / o, rounded half to even to DivisionScale digits after the
+// decimal point, without trailing zeros beyond the scale of d. o must not
+// be zero.
+func (d Decimal) Quo(o Decimal) Decimal {
+	// d / o = (a × 10^-sa) / (b × 10^-sb); scaling the numerator by
+	// 10^(DivisionScale + sb - sa) gives the quotient at DivisionScale.
+	num, den := new(big.Int).Set(d.int()), new(big.Int).Set(o.int())
+	if shift := DivisionScale + o.scale - d.scale; shift >= 0 {
+		num.Mul(num, pow10(shift))
+	} else {
+		den.Mul(den, pow10(-shift))
+	}
+	q, r := new(big.Int).QuoRem(num, den, new(big.Int))
+	// Round half to even on twice the remainder against the divisor.
+	twice := new(big.Int).Abs(r)
+	twice.Lsh(twice, 1)
+	if c := twice.Cmp(new(big.Int).Abs(den)); c > 0 || (c == 0 && q.Bit(0) == 1) {
+		if (num.Sign() < 0) != (den.Sign() < 0) {
+			q.Sub(q, big.NewInt(1))
+		} else {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+	return Decimal{unscaled: q, scale: DivisionScale}.trim(d.scale)
+}
+
+// trim removes trailing zeros after the decimal point down to scale.
+func (d Decimal) trim(scale int32) Decimal {
+	unscaled := d.int()
+	rem := new(big.Int)
+	for d.scale > scale {
+		q, r := new(big.Int).QuoRem(unscaled, bigTen, rem)
+		if r.Sign() != 0 {
+			break
+		}
+		unscaled, d.scale = q, d.scale-1
+	}
+	return Decimal{unscaled: unscaled, scale: d.scale}
+}
+
+// Neg returns -d.
+func (d Decimal) Neg() Decimal {
+	return Decimal{unscaled: new(big.Int).Neg(d.int()), scale: d.scale}
+}
+
+// Sign returns -1, 0 or 1 as d is negative, zero or positive.
+func (d Decimal) Sign() int {
+	return d.int().Sign()
+}
+
+// Cmp returns -1, 0 or 1 as d is less than, equal to or greater than o.
+// Scale does not matter: 1.5 equals 1.50.
+func (d Decimal) Cmp(o Decimal) int {
+	a, b, _ := d.align(o)
+	return a.Cmp(b)
+}
+
+// Float64 returns the float nearest to d.
+func (d Decimal) Float64() float64 {
+	f, _ := strconv.ParseFloat(d.String(), 64)
+	return f
+}
+
+// String formats d with its scale, such as "-0.50".
+func (d Decimal) String() string {
+	digits := new(big.Int).Abs(d.int()).String()
+	sign := ""
+	if d.Sign() < 0 {
+		sign = "-"
+	}
+	if d.scale == 0 {
+		return sign + digits
+	}
+	if pad := int(d.scale) + 1 - len(digits); pad > 0 {
+		digits = strings.Repeat("0", pad) + digits
+	}
+	point := len(digits) - int(d.scale)
+	return sign + digits[:point] + "." + digits[point:]
+}
+
+// MarshalJSON writes d as a JSON number with its exact digits.
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// MarshalText writes d with its exact digits, for encodings such as YAML
+// that have no use for MarshalJSON.
+func (d Decimal) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
@@ -0,0 +1,210 @@
+package types
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Go values that are not of the language's own types, such as structs,
+// typed slices and maps, and numbers of other widths, are read through
+// reflection. Struct fields are named by their lql tag, or by their Go name
+// when untagged; a tag of "-" hides a field. Fields of embedded structs are
+// promoted as in Go.
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	timeValueType = reflect.TypeOf(TimeValue{})
+	decimalType   = reflect.TypeOf(Decimal{})
+)
+
+// structInfo lists the fields of a struct type that expressions can read.
+type structInfo struct {
+	names  []string
+	fields map[string][]int // field name → index sequence
+}
+
+// structInfos caches the structInfo of each struct type.
+var structInfos sync.Map // reflect.Type → *structInfo
+
+func structInfoOf(t reflect.Type) *structInfo {
+	if cached, ok := structInfos.Load(t); ok {
+		return cached.(*structInfo)
+	}
+	info := &structInfo{fields: make(map[string][]int)}
+	for _, field := range reflect.VisibleFields(t) {
+		if !field.IsExported() {
+			continue
+		}
+		tag, tagged := field.Tag.Lookup("lql")
+		name, _, _ := strings.Cut(tag, ",")
+		if name == "-" {
+			continue
+		}
+		if field.Anonymous && !tagged && isObjectStruct(indirectType(field.Type)) {
+			// Its fields are promoted instead.
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if index, ok := info.fields[name]; ok && len(index) <= len(field.Index) {
+			continue
+		} else if !ok {
+			info.names = append(info.names, name)
+		}
+		info.fields[name] = field.Index
+	}
+	cached, _ := structInfos.LoadOrStore(t, info)
+	return cached.(*structInfo)
+}
+
+func indirectType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t
+}
+
+// isObjectStruct reports whether values of t are read as objects. Times
+// and decimals are structs but not objects.
+func isObjectStruct(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && t != timeType && t != timeValueType && t != decimalType
+}
+
+// indirect follows pointers and interfaces to the value they hold. It
+// returns an invalid value for nil.
+func indirect(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+// LookupField reads the field named key of val if val is a struct or a
+// pointer to one, without converting its other fields as
+// ConvertToStringMap does. isStruct is false if val is not a struct.
+func LookupField(val interface{}, key string) (value interface{}, found, isStruct bool) {
+	switch val.(type) {
+	case nil, map[string]interface{}, []interface{}, string, bool, int64, float64, TimeValue, Decimal:
+		return nil, false, false
+	}
+	v := indirect(reflect.ValueOf(val))
+	if !v.IsValid() || !isObjectStruct(v.Type()) {
+		return nil, false, false
+	}
+	index, ok := structInfoOf(v.Type()).fields[key]
+	if !ok {
+		return nil, false, true
+	}
+	field, err := v.FieldByIndexErr(index)
+	if err != nil {
+		// A nil embedded pointer holds the field.
+		return nil, true, true
+	}
+	return fromReflect(field), true, true
+}
+
+// reflectStringMap converts a struct, or a map of another type, to a map
+// with string keys.
+func reflectStringMap(val interface{}) (map[string]interface{}, bool) {
+	v := indirect(reflect.ValueOf(val))
+	if !v.IsValid() {
+		return nil, false
+	}
+	switch {
+	case isObjectStruct(v.Type()):
+		info := structInfoOf(v.Type())
+		m := make(map[string]interface{}, len(info.names))
+		for _, name := range info.names {
+			if field, err := v.FieldByIndexErr(info.fields[name]); err == nil {
+				m[name] = fromReflect(field)
+			} else {
+				m[name] = nil
+			}
+		}
+		return m, true
+	case v.Kind() == reflect.Map:
+		m := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			key := iter.Key()
+			if key.Kind() == reflect.String {
+				m[key.String()] = fromReflect(iter.Value())
+			} else {
+				m[fmt.Sprintf("%v", key.Interface())] = fromReflect(iter.Value())
+			}
+		}
+		return m, true
+	}
+	return nil, false
+}
+
+// reflectSlice converts a slice or array of another type to
+// []interface{}.
+func reflectSlice(val interface{}) ([]interface{}, bool) {
+	v := indirect(reflect.ValueOf(val))
+	if !v.IsValid() || (v.Kind() != reflect.Slice && v.Kind() != reflect.Array) {
+		return nil, false
+	}
+	s := make([]interface{}, v.Len())
+	for i := range s {
+		s[i] = fromReflect(v.Index(i))
+	}
+	return s, true
+}
+
+// fromReflect converts v to a value of the language's types. Numbers
+// become int64 or float64 and times become TimeValue. Structs, slices and
+// maps are kept as they are and converted when read; structs reached
+// through a pointer or inside a slice are kept by pointer, so they are not
+// copied.
+func fromReflect(v reflect.Value) interface{} {
+	v = indirect(v)
+	if !v.IsValid() {
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		return v.Bool()
+	case reflect.String:
+		return v.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return int64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	case reflect.Slice, reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+	}
+	if !v.CanInterface() {
+		return nil
+	}
+	if v.Type() == timeType {
+		return TimeValueOf(v.Interface().(time.Time))
+	}
+	if isObjectStruct(v.Type()) && v.CanAddr() {
+		return v.Addr().Interface()
+	}
+	return v.Interface()
+}
+
+// ContextOf returns an evaluation context for v: a struct, or a pointer
+// to one, whose fields become the top-level fields of the context, or a
+// map with string keys. Nested structs, slices and maps are read through
+// reflection as expressions access them, so they need not be converted
+// first.
+func ContextOf(v interface{}) (map[string]interface{}, error) {
+	if m, ok := ConvertToStringMap(v); ok {
+		return m, nil
+	}
+	return nil, fmt.Errorf("context must be a struct or a map, not %T", v)
+}
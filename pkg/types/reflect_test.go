@@ -0,0 +1,159 @@
+package types_test
+
+import (
+	"github.com/SpecDrivenDesign/lql/pkg/env"
+	"github.com/SpecDrivenDesign/lql/pkg/lexer"
+	"github.com/SpecDrivenDesign/lql/pkg/parser"
+	"github.com/SpecDrivenDesign/lql/pkg/types"
+	"testing"
+	"time"
+)
+
+type Audit struct {
+	CreatedBy string `lql:"createdBy"`
+}
+
+type address struct {
+	Country string `lql:"country"`
+	Zip     string
+}
+
+type item struct {
+	SKU string  `lql:"sku"`
+	Qty uint16  `lql:"qty"`
+	Net float32 `lql:"net"`
+}
+
+type order struct {
+	Audit
+	ID       int              `lql:"id"`
+	Address  *address         `lql:"address"`
+	Billing  *address         `lql:"billing"`
+	Items    []item           `lql:"items"`
+	Tags     []string         `lql:"tags"`
+	Attrs    map[string]int32 `lql:"attrs"`
+	Counts   map[int]string   `lql:"counts"`
+	Placed   time.Time        `lql:"placed"`
+	Secret   string           `lql:"-"`
+	internal string
+	Untagged bool
+	Options  map[string]string `lql:"options,omitempty"`
+}
+
+func TestStructContext(t *testing.T) {
+	o := &order{
+		Audit:    Audit{CreatedBy: "ann"},
+		ID:       7,
+		Address:  &address{Country: "US", Zip: "10001"},
+		Items:    []item{{SKU: "a", Qty: 2, Net: 1.5}, {SKU: "b", Qty: 1}},
+		Tags:     []string{"vip"},
+		Attrs:    map[string]int32{"rank": 3},
+		Counts:   map[int]string{1: "one"},
+		Placed:   time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+		Secret:   "s",
+		internal: "i",
+		Untagged: true,
+	}
+	ctx, err := types.ContextOf(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		src  string
+		want interface{}
+	}{
+		// Fields are named by their tags, or their Go names when untagged.
+		{`$id`, int64(7)},
+		{`$Untagged`, true},
+		{`$address.country == "US" AND $address.Zip == "10001"`, true},
+		// Fields of embedded structs are promoted.
+		{`$createdBy`, "ann"},
+		// Nested structs, slices and maps are read as objects and arrays.
+		{`$items[0].qty`, int64(2)},
+		{`$items[0].net`, 1.5},
+		{`$items[*].sku`, []interface{}{"a", "b"}},
+		{`array.last($items).sku`, "b"},
+		{`array.contains($tags, "vip")`, true},
+		{`$attrs.rank`, int64(3)},
+		{`$counts["1"]`, "one"},
+		{`$placed == time.parse("2024-05-01", "dateOnly")`, true},
+		// Nil pointers and maps are null.
+		{`$billing == null`, true},
+		{`$billing?.country`, nil},
+		{`$options == null`, true},
+	}
+	for _, tt := range tests {
+		p, err := parser.NewParser(lexer.NewLexer(tt.src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expr, err := p.ParseExpression()
+		if err != nil {
+			t.Fatalf("%s: %v", tt.src, err)
+		}
+		got, err := expr.Eval(ctx, env.NewEnvironment())
+		if err != nil {
+			t.Errorf("%s: %v", tt.src, err)
+			continue
+		}
+		if !equal(got, tt.want) {
+			t.Errorf("%s: got %#v, want %#v", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestStructContextHidesFields(t *testing.T) {
+	ctx, err := types.ContextOf(order{Secret: "s", internal: "i"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"Secret", "internal", "Audit", "ID"} {
+		if _, ok := ctx[name]; ok {
+			t.Errorf("field %s is visible", name)
+		}
+	}
+	for _, name := range []string{"id", "createdBy", "Untagged"} {
+		if _, ok := ctx[name]; !ok {
+			t.Errorf("field %s is missing", name)
+		}
+	}
+	if _, found, isStruct := types.LookupField(&address{}, "Country"); !isStruct || found {
+		t.Errorf("tagged field found by its Go name: found %t, struct %t", found, isStruct)
+	}
+	if v, found, _ := types.LookupField(&address{Country: "NO"}, "country"); !found || v != "NO" {
+		t.Errorf("got %v, %t", v, found)
+	}
+	if _, _, isStruct := types.LookupField(map[string]interface{}{}, "country"); isStruct {
+		t.Error("a map was read as a struct")
+	}
+}
+
+func TestContextOfRejectsScalars(t *testing.T) {
+	for _, v := range []interface{}{nil, "s", int64(1), []string{"a"}} {
+		if _, err := types.ContextOf(v); err == nil {
+			t.Errorf("%#v was accepted", v)
+		}
+	}
+	ctx, err := types.ContextOf(map[int]string{1: "one"})
+	if err != nil || ctx["1"] != "one" {
+		t.Errorf("got %v, %v", ctx, err)
+	}
+}
+
+// equal compares evaluation results, which may hold slices.
+func equal(a, b interface{}) bool {
+	as, ok := a.([]interface{})
+	if !ok {
+		return a == b
+	}
+	bs, ok := b.([]interface{})
+	if !ok || len(as) != len(bs) {
+		return false
+	}
+	for i := range as {
+		if !equal(as[i], bs[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,29 @@
+package types
+
+import (
+	"time"
+)
+
+// TimeValue is the value of the language's Time type: an instant in
+// milliseconds since the Unix epoch, and the zone it is shown in.
+type TimeValue struct {
+	EpochMillis int64
+	Zone        string
+}
+
+// TimeValueOf converts t to a TimeValue.
+func TimeValueOf(t time.Time) TimeValue {
+	return TimeValue{
+		EpochMillis: t.UnixNano() / int64(time.Millisecond),
+		Zone:        t.Location().String(),
+	}
+}
+
+// Time returns the time in its zone, or in UTC if the zone is unknown.
+func (tv TimeValue) Time() time.Time {
+	loc, err := time.LoadLocation(tv.Zone)
+	if err != nil {
+		loc = time.UTC
+	}
+	return time.Unix(0, tv.EpochMillis*int64(time.Millisecond)).In(loc)
+}
@@ -1,6 +1,7 @@
 package types
 
 import (
+	"cmp"
 	"fmt"
 	"github.com/SpecDrivenDesign/lql/pkg/errors"
 	"math"
@@ -17,6 +18,8 @@ func ToFloat(val interface{}) (float64, bool) {
 		return float64(v), true
 	case float64:
 		return v, true
+	case Decimal:
+		return v.Float64(), true
 	}
 	return 0, false
 }
@@ -30,6 +33,8 @@ func ToInt(val interface{}) (int64, bool) {
 		return v, true
 	case float64:
 		return int64(v), true
+	case Decimal:
+		return int64(v.Float64()), true
 	}
 	return 0, false
 }
@@ -43,18 +48,125 @@ func IsInt(val interface{}) bool {
 	return false
 }
 
-// Equals compares two values for equality.
+// PromoteNumbers converts an int to a float when the other value is a
+// float, so that the two can be combined arithmetically.
+func PromoteNumbers(left, right interface{}) (interface{}, interface{}) {
+	lf, lok := ToFloat(left)
+	rf, rok := ToFloat(right)
+	if !lok || !rok || IsInt(left) == IsInt(right) {
+		return left, right
+	}
+	return lf, rf
+}
+
+// Equals compares two values for equality. Numbers are equal if they
+// differ by less than 1e-9. Arrays are equal if they have the same length
+// and equal elements in order, and objects if they have the same keys with
+// equal values, whatever the order; an array or object never equals a
+// value of another type. Times are equal if they are the same instant, in
+// any zone, and a time equals an int of its epoch milliseconds. Other
+// values are equal if they print the same.
 func Equals(left, right interface{}) bool {
+	if c, ok := compareDecimals(left, right); ok {
+		return c == 0
+	}
+	if c, ok := compareTimes(left, right); ok {
+		return c == 0
+	}
 	lf, lok := ToFloat(left)
 	rf, rok := ToFloat(right)
 	if lok && rok {
 		return math.Abs(lf-rf) < 1e-9
 	}
+	la, lArray := ConvertToInterfaceSlice(left)
+	ra, rArray := ConvertToInterfaceSlice(right)
+	if lArray || rArray {
+		if !lArray || !rArray || len(la) != len(ra) {
+			return false
+		}
+		for i := range la {
+			if !Equals(la[i], ra[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	lm, lObject := ConvertToStringMap(left)
+	rm, rObject := ConvertToStringMap(right)
+	if lObject || rObject {
+		if !lObject || !rObject || len(lm) != len(rm) {
+			return false
+		}
+		for key, lv := range lm {
+			rv, exists := rm[key]
+			if !exists || !Equals(lv, rv) {
+				return false
+			}
+		}
+		return true
+	}
 	return fmt.Sprintf("%v", left) == fmt.Sprintf("%v", right)
 }
 
-// Compare compares two values using the given operator.
+// compareDecimals compares two numbers exactly if either is a Decimal.
+func compareDecimals(left, right interface{}) (int, bool) {
+	if !IsDecimal(left) && !IsDecimal(right) {
+		return 0, false
+	}
+	ld, lok := DecimalOf(left)
+	rd, rok := DecimalOf(right)
+	if !lok || !rok {
+		return 0, false
+	}
+	return ld.Cmp(rd), true
+}
+
+// compareTimes compares two instants if either is a TimeValue and the other
+// is a TimeValue or an int of epoch milliseconds. Zones do not matter.
+func compareTimes(left, right interface{}) (int, bool) {
+	lt, lTime := left.(TimeValue)
+	rt, rTime := right.(TimeValue)
+	if !lTime && !rTime {
+		return 0, false
+	}
+	lm, lok := epochMillis(left, lt, lTime)
+	rm, rok := epochMillis(right, rt, rTime)
+	if !lok || !rok {
+		return 0, false
+	}
+	return cmp.Compare(lm, rm), true
+}
+
+// epochMillis returns the instant of val, which is tv if isTime is true.
+func epochMillis(val interface{}, tv TimeValue, isTime bool) (int64, bool) {
+	if isTime {
+		return tv.EpochMillis, true
+	}
+	if !IsInt(val) {
+		return 0, false
+	}
+	return ToInt(val)
+}
+
+// Compare compares two values using the given operator. Times compare as
+// instants, with each other or with ints of epoch milliseconds.
 func Compare(left, right interface{}, op string, line, column int) (bool, error) {
+	c, ok := compareDecimals(left, right)
+	if !ok {
+		c, ok = compareTimes(left, right)
+	}
+	if ok {
+		switch op {
+		case "<":
+			return c < 0, nil
+		case ">":
+			return c > 0, nil
+		case "<=":
+			return c <= 0, nil
+		case ">=":
+			return c >= 0, nil
+		}
+	}
 	lf, lok := ToFloat(left)
 	rf, rok := ToFloat(right)
 	if lok && rok {
@@ -103,7 +215,8 @@ func ParseNumber(lit string) interface{} {
 	}
 }
 
-// ConvertToInterfaceSlice converts various slice types to []interface{}.
+// ConvertToInterfaceSlice converts various slice and array types to
+// []interface{}.
 func ConvertToInterfaceSlice(val interface{}) ([]interface{}, bool) {
 	switch v := val.(type) {
 	case []interface{}:
@@ -132,11 +245,14 @@ func ConvertToInterfaceSlice(val interface{}) ([]interface{}, bool) {
 			s[i] = e
 		}
 		return s, true
+	case nil, string, bool, int64, float64, map[string]interface{}, TimeValue, Decimal:
+		return nil, false
 	}
-	return nil, false
+	return reflectSlice(val)
 }
 
-// ConvertToStringMap converts various map types to map[string]interface{}.
+// ConvertToStringMap converts various map types, and structs, to
+// map[string]interface{}.
 func ConvertToStringMap(val interface{}) (map[string]interface{}, bool) {
 	switch v := val.(type) {
 	case map[string]interface{}:
@@ -147,6 +263,8 @@ func ConvertToStringMap(val interface{}) (map[string]interface{}, bool) {
 			m[fmt.Sprintf("%v", key)] = value
 		}
 		return m, true
+	case nil, string, bool, int64, float64, []interface{}, TimeValue, Decimal:
+		return nil, false
 	}
-	return nil, false
+	return reflectStringMap(val)
 }
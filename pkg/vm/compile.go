@@ -0,0 +1,333 @@
+package vm
+
+import (
+	"fmt"
+	"github.com/SpecDrivenDesign/lql/pkg/ast"
+	"github.com/SpecDrivenDesign/lql/pkg/ast/expressions"
+	"github.com/SpecDrivenDesign/lql/pkg/tokens"
+)
+
+// Compile compiles expr to a program. Expressions that only the tree
+// evaluator can run are rejected: unbound placeholders and
+// embedder-registered operators, whose implementations are Go functions.
+func Compile(expr ast.Expression) (*Program, error) {
+	c := &compiler{program: &Program{segments: [][]instruction{nil}}, constants: map[interface{}]int{}}
+	if err := c.compile(expr); err != nil {
+		return nil, err
+	}
+	c.program.link()
+	return c.program, nil
+}
+
+type compiler struct {
+	program   *Program
+	segment   int
+	constants map[interface{}]int
+	depth     int // the depth of the node being compiled; the root has depth 1
+}
+
+// emit appends an instruction to the current segment and returns its index.
+func (c *compiler) emit(op op, a int, line, column int) int {
+	code := &c.program.segments[c.segment]
+	*code = append(*code, instruction{op: op, a: a, line: line, column: column})
+	return len(*code) - 1
+}
+
+// patch makes the jumps at the given indexes of the current segment jump
+// to its end.
+func (c *compiler) patch(jumps ...int) {
+	code := c.program.segments[c.segment]
+	for _, at := range jumps {
+		code[at].b = len(code)
+	}
+}
+
+// inSegment compiles into a new segment with body and returns the
+// segment's index.
+func (c *compiler) inSegment(body func() error) (int, error) {
+	parent := c.segment
+	c.segment = len(c.program.segments)
+	c.program.segments = append(c.program.segments, nil)
+	err := body()
+	segment := c.segment
+	c.segment = parent
+	return segment, err
+}
+
+// constant returns the index of value in the constant table, adding it if
+// it is not there yet.
+func (c *compiler) constant(value interface{}) int {
+	switch value.(type) {
+	case nil, bool, int64, float64, string:
+		if i, ok := c.constants[value]; ok {
+			return i
+		}
+		c.constants[value] = len(c.program.constants)
+	}
+	c.program.constants = append(c.program.constants, value)
+	return len(c.program.constants) - 1
+}
+
+func (c *compiler) compile(node ast.Expression) error {
+	c.depth++
+	start := len(c.program.segments[c.segment])
+	defer func() {
+		c.depth--
+		if meta := ast.MetadataOf(node); len(meta) > 0 {
+			end := len(c.program.segments[c.segment])
+			c.program.annotations = append(c.program.annotations, annotation{c.segment, start, end, meta})
+		}
+	}()
+	line, column := node.Pos()
+	switch n := node.(type) {
+	case *expressions.LiteralExpr:
+		c.emit(opNode, c.depth, line, column)
+		c.emit(opConst, c.constant(n.Value), line, column)
+	case *expressions.ContextExpr:
+		c.emit(opNode, c.depth, line, column)
+		if n.Ident == nil {
+			c.emit(opContext, 0, line, column)
+		} else {
+			c.emit(opContextField, c.constant(n.Ident.Name), n.Ident.Line, n.Ident.Column)
+			c.emit(opResolve, 0, line, column)
+		}
+	case *expressions.MemberAccessExpr:
+		c.emit(opNode, c.depth, line, column)
+		if target, ok := n.Target.(*expressions.ContextExpr); ok && target.Ident != nil {
+			// A context provider is resolved by the access, not before.
+			c.emit(opNode, c.depth+1, target.Line, target.Column)
+			c.emit(opContextField, c.constant(target.Ident.Name), target.Ident.Line, target.Ident.Column)
+		} else if err := c.compile(n.Target); err != nil {
+			return err
+		}
+		exits, err := c.compileParts(n.AccessParts, false)
+		if err != nil {
+			return err
+		}
+		c.patch(exits...)
+		c.resolveAfter(n.AccessParts)
+	case *expressions.UnaryExpr:
+		if _, ok := expressions.UnaryOperator(n.Operator); !ok {
+			return fmt.Errorf("line %d, column %d: unknown unary operator", line, column)
+		}
+		c.emit(opNode, c.depth, line, column)
+		if err := c.compile(n.Expr); err != nil {
+			return err
+		}
+		c.emit(opUnary, int(n.Operator), n.Line, n.Column)
+	case *expressions.BinaryExpr:
+		return c.compileBinary(n)
+	case *expressions.LikeExpr:
+		c.emit(opNode, c.depth, line, column)
+		if err := c.compile(n.Subject); err != nil {
+			return err
+		}
+		if err := c.compile(n.Pattern); err != nil {
+			return err
+		}
+		c.emit(opLike, 0, n.Line, n.Column)
+	case *expressions.BetweenExpr:
+		c.emit(opNode, c.depth, line, column)
+		if err := c.compile(n.Subject); err != nil {
+			return err
+		}
+		if err := c.compile(n.Low); err != nil {
+			return err
+		}
+		jump := c.emit(opBetweenLow, 0, n.Line, n.Column)
+		if err := c.compile(n.High); err != nil {
+			return err
+		}
+		c.emit(opBetweenHigh, 0, n.Line, n.Column)
+		c.patch(jump)
+	case *expressions.DefaultExpr:
+		c.emit(opNode, c.depth, line, column)
+		segment, err := c.inSegment(func() error { return c.compile(n.Expr) })
+		if err != nil {
+			return err
+		}
+		c.emit(opDefault, segment, n.Line, n.Column)
+		jump := c.emit(opJumpIfNotNil, 0, n.Line, n.Column)
+		if err := c.compile(n.Fallback); err != nil {
+			return err
+		}
+		c.patch(jump)
+	case *expressions.FunctionCallExpr:
+		return c.compileFunctionCall(n)
+	case *expressions.ArrayLiteralExpr:
+		c.emit(opNode, c.depth, line, column)
+		for _, elem := range n.Elements {
+			if err := c.compile(elem); err != nil {
+				return err
+			}
+		}
+		c.emit(opArray, len(n.Elements), n.Line, n.Column)
+		c.emit(opProduced, 0, n.Line, n.Column)
+	case *expressions.ObjectLiteralExpr:
+		c.emit(opNode, c.depth, line, column)
+		c.emit(opObject, 0, n.Line, n.Column)
+		for _, field := range n.Fields {
+			if field.KeyExpr != nil {
+				if err := c.compile(field.KeyExpr); err != nil {
+					return err
+				}
+			} else {
+				c.emit(opConst, c.constant(field.Key), field.Line, field.Column)
+			}
+			c.emit(opKey, 0, field.Line, field.Column)
+			if err := c.compile(field.Value); err != nil {
+				return err
+			}
+			c.emit(opSetField, 0, field.Line, field.Column)
+		}
+		c.emit(opProduced, 0, n.Line, n.Column)
+	case *expressions.PlaceholderExpr:
+		return fmt.Errorf("line %d, column %d: placeholder ':%s' must be bound before compiling", line, column, n.Name)
+	case *expressions.LetExpr:
+		c.emit(opNode, c.depth, line, column)
+		if err := c.compile(n.Value); err != nil {
+			return err
+		}
+		segment, err := c.inSegment(func() error { return c.compile(n.Body) })
+		if err != nil {
+			return err
+		}
+		at := c.emit(opLet, c.constant(n.Name), n.Line, n.Column)
+		c.program.segments[c.segment][at].b = segment
+	case *expressions.IdentifierExpr:
+		c.emit(opNode, c.depth, line, column)
+		c.emit(opVariable, c.constant(n.Name), n.Line, n.Column)
+	case *expressions.CustomInfixExpr:
+		return fmt.Errorf("line %d, column %d: custom operator '%s' cannot be compiled to instructions", line, column, n.Keyword)
+	case *expressions.CustomPrefixExpr:
+		return fmt.Errorf("line %d, column %d: custom operator '%s' cannot be compiled to instructions", line, column, n.Keyword)
+	default:
+		return fmt.Errorf("line %d, column %d: cannot compile %T", line, column, node)
+	}
+	return nil
+}
+
+// compileParts compiles member access parts applied to the top of the
+// stack. It returns the jumps taken when an optional part finds nothing,
+// or when any part meets null in a lenient environment, which the caller
+// patches to the end of the access. When lenient is set
+// (inside an optional wildcard projection) every part behaves as if
+// optional.
+func (c *compiler) compileParts(parts []expressions.MemberPart, lenient bool) ([]int, error) {
+	var exits []int
+	for i, part := range parts {
+		optional := part.Optional || lenient
+		if optional {
+			exits = append(exits, c.emit(opJumpIfNil, 0, part.Line, part.Column))
+		} else {
+			exits = append(exits, c.emit(opLenientJump, 0, part.Line, part.Column))
+		}
+		switch {
+		case part.Wildcard:
+			segment, err := c.inSegment(func() error {
+				inner, err := c.compileParts(parts[i+1:], optional)
+				c.patch(inner...)
+				c.resolveAfter(parts[i:])
+				return err
+			})
+			if err != nil {
+				return nil, err
+			}
+			c.emit(opProject, segment, part.Line, part.Column)
+			return exits, nil
+		case part.Recursive:
+			c.emit(opRecurse, c.constant(part.Key), part.Line, part.Column)
+		case part.IsIndex:
+			if err := c.compile(part.Expr); err != nil {
+				return nil, err
+			}
+			if optional {
+				exits = append(exits, c.emit(opOptIndex, 0, part.Line, part.Column))
+			} else {
+				c.emit(opIndex, 0, part.Line, part.Column)
+			}
+		default:
+			if optional {
+				exits = append(exits, c.emit(opOptField, c.constant(part.Key), part.Line, part.Column))
+			} else {
+				c.emit(opField, c.constant(part.Key), part.Line, part.Column)
+			}
+		}
+	}
+	return exits, nil
+}
+
+// resolveAfter emits the resolution of a context provider left by the
+// access parts, at the position of the last part.
+func (c *compiler) resolveAfter(parts []expressions.MemberPart) {
+	if len(parts) > 0 {
+		last := parts[len(parts)-1]
+		c.emit(opResolve, 0, last.Line, last.Column)
+	}
+}
+
+// compileBinary compiles AND and OR to conditional jumps, so the right
+// operand is only evaluated when it decides the result.
+func (c *compiler) compileBinary(n *expressions.BinaryExpr) error {
+	line, column := n.Pos()
+	var jump int
+	switch n.Operator {
+	case tokens.TokenAnd, tokens.TokenOr:
+		c.emit(opNode, c.depth, line, column)
+		if err := c.compile(n.Left); err != nil {
+			return err
+		}
+		branch := opAnd
+		if n.Operator == tokens.TokenOr {
+			branch = opOr
+		}
+		jump = c.emit(branch, 0, n.Line, n.Column)
+		if err := c.compile(n.Right); err != nil {
+			return err
+		}
+		c.emit(opCheckBool, int(n.Operator), n.Line, n.Column)
+		c.patch(jump)
+		return nil
+	}
+	if _, ok := expressions.BinaryOperator(n.Operator); !ok {
+		return fmt.Errorf("line %d, column %d: unknown binary operator", line, column)
+	}
+	c.emit(opNode, c.depth, line, column)
+	if err := c.compile(n.Left); err != nil {
+		return err
+	}
+	if err := c.compile(n.Right); err != nil {
+		return err
+	}
+	c.emit(opBinary, int(n.Operator), n.Line, n.Column)
+	return nil
+}
+
+// compileFunctionCall compiles each argument to a segment of its own and
+// the call to a call site.
+func (c *compiler) compileFunctionCall(n *expressions.FunctionCallExpr) error {
+	if len(n.Namespace) < 2 {
+		return fmt.Errorf("line %d, column %d: function call missing namespace", n.Line, n.Column)
+	}
+	c.emit(opNode, c.depth, n.Line, n.Column)
+	site := callSite{
+		library:     n.Namespace[0],
+		function:    n.Namespace[1],
+		line:        n.Line,
+		column:      n.Column,
+		parenLine:   n.ParenLine,
+		parenColumn: n.ParenColumn,
+		args:        make([]callArg, len(n.Args)),
+	}
+	for i, arg := range n.Args {
+		segment, err := c.inSegment(func() error { return c.compile(arg) })
+		if err != nil {
+			return err
+		}
+		site.args[i].segment = segment
+		site.args[i].line, site.args[i].column = arg.Pos()
+	}
+	c.program.calls = append(c.program.calls, site)
+	c.emit(opCall, len(c.program.calls)-1, n.Line, n.Column)
+	return nil
+}
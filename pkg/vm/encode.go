@@ -0,0 +1,284 @@
+package vm
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// Constant tags in the encoded constant table.
+const (
+	constNull byte = iota
+	constFalse
+	constTrue
+	constInt
+	constFloat
+	constString
+)
+
+// Encode serializes the program: the instruction set version, the constant
+// table, the call sites and the segments, with integers as varints.
+// Instructions are written as their opcode, the operands it uses, and
+// their line and column.
+func (p *Program) Encode() ([]byte, error) {
+	out := []byte{Version}
+	out = binary.AppendUvarint(out, uint64(len(p.constants)))
+	for _, value := range p.constants {
+		switch v := value.(type) {
+		case nil:
+			out = append(out, constNull)
+		case bool:
+			if v {
+				out = append(out, constTrue)
+			} else {
+				out = append(out, constFalse)
+			}
+		case int64:
+			out = binary.AppendVarint(append(out, constInt), v)
+		case float64:
+			out = binary.LittleEndian.AppendUint64(append(out, constFloat), math.Float64bits(v))
+		case string:
+			out = appendString(append(out, constString), v)
+		default:
+			return nil, fmt.Errorf("cannot encode constant of type %T", value)
+		}
+	}
+	out = binary.AppendUvarint(out, uint64(len(p.calls)))
+	for _, site := range p.calls {
+		out = appendString(out, site.library)
+		out = appendString(out, site.function)
+		out = appendUints(out, site.line, site.column, site.parenLine, site.parenColumn, len(site.args))
+		for _, arg := range site.args {
+			out = appendUints(out, arg.segment, arg.line, arg.column)
+		}
+	}
+	out = binary.AppendUvarint(out, uint64(len(p.segments)))
+	for _, code := range p.segments {
+		out = binary.AppendUvarint(out, uint64(len(code)))
+		for _, in := range code {
+			out = append(out, byte(in.op))
+			usesA, usesB := in.op.operands()
+			if usesA {
+				out = binary.AppendUvarint(out, uint64(in.a))
+			}
+			if usesB {
+				out = binary.AppendUvarint(out, uint64(in.b))
+			}
+			out = appendUints(out, in.line, in.column)
+		}
+	}
+	return out, nil
+}
+
+// operands reports whether instructions with the opcode use operands a
+// and b. Unused operands are not encoded.
+func (o op) operands() (a, b bool) {
+	switch o {
+	case opNode, opConst, opContextField, opField, opProject, opRecurse, opUnary, opBinary, opCheckBool, opCall, opArray, opDefault, opVariable:
+		return true, false
+	case opOptField, opLet:
+		return true, true
+	case opJumpIfNil, opOptIndex, opAnd, opOr, opJumpIfNotNil, opLenientJump, opBetweenLow:
+		return false, true
+	}
+	return false, false
+}
+
+func appendString(out []byte, s string) []byte {
+	return append(binary.AppendUvarint(out, uint64(len(s))), s...)
+}
+
+func appendUints(out []byte, values ...int) []byte {
+	for _, v := range values {
+		out = binary.AppendUvarint(out, uint64(v))
+	}
+	return out
+}
+
+// decoder reads an encoded program, remembering the first error.
+type decoder struct {
+	data []byte
+	err  error
+}
+
+func (d *decoder) fail() {
+	if d.err == nil {
+		d.err = fmt.Errorf("malformed program")
+	}
+}
+
+func (d *decoder) byte() byte {
+	if d.err != nil || len(d.data) == 0 {
+		d.fail()
+		return 0
+	}
+	b := d.data[0]
+	d.data = d.data[1:]
+	return b
+}
+
+func (d *decoder) uint() int {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.data)
+	if n <= 0 || v > math.MaxInt32 {
+		d.fail()
+		return 0
+	}
+	d.data = d.data[n:]
+	return int(v)
+}
+
+// count reads the length of a table whose entries take at least one byte
+// each, so a corrupt length cannot cause a huge allocation.
+func (d *decoder) count() int {
+	n := d.uint()
+	if n > len(d.data) {
+		d.fail()
+		return 0
+	}
+	return n
+}
+
+func (d *decoder) string() string {
+	n := d.count()
+	if d.err != nil {
+		return ""
+	}
+	s := string(d.data[:n])
+	d.data = d.data[n:]
+	return s
+}
+
+// Decode deserializes a program produced by Encode and checks that every
+// operand is in range, so that running it cannot fail other than as the
+// expression does. Jumps only go forward and segments only run segments
+// after their own, so every program terminates.
+func Decode(data []byte) (*Program, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("malformed program")
+	}
+	if data[0] != Version {
+		return nil, fmt.Errorf("unsupported instruction set version %d (supported: %d)", data[0], Version)
+	}
+	d := &decoder{data: data[1:]}
+	p := &Program{}
+	p.constants = make([]interface{}, d.count())
+	for i := range p.constants {
+		switch d.byte() {
+		case constNull:
+		case constFalse:
+			p.constants[i] = false
+		case constTrue:
+			p.constants[i] = true
+		case constInt:
+			v, n := binary.Varint(d.data)
+			if n <= 0 {
+				d.fail()
+				break
+			}
+			d.data = d.data[n:]
+			p.constants[i] = v
+		case constFloat:
+			if len(d.data) < 8 {
+				d.fail()
+				break
+			}
+			p.constants[i] = math.Float64frombits(binary.LittleEndian.Uint64(d.data))
+			d.data = d.data[8:]
+		case constString:
+			p.constants[i] = d.string()
+		default:
+			d.fail()
+		}
+	}
+	p.calls = make([]callSite, d.count())
+	for i := range p.calls {
+		site := &p.calls[i]
+		site.library, site.function = d.string(), d.string()
+		site.line, site.column, site.parenLine, site.parenColumn = d.uint(), d.uint(), d.uint(), d.uint()
+		site.args = make([]callArg, d.count())
+		for j := range site.args {
+			site.args[j] = callArg{segment: d.uint(), line: d.uint(), column: d.uint()}
+		}
+	}
+	p.segments = make([][]instruction, d.count())
+	for i := range p.segments {
+		code := make([]instruction, d.count())
+		for j := range code {
+			in := &code[j]
+			in.op = op(d.byte())
+			if in.op == 0 || in.op >= opCount {
+				d.fail()
+			}
+			usesA, usesB := in.op.operands()
+			if usesA {
+				in.a = d.uint()
+			}
+			if usesB {
+				in.b = d.uint()
+			}
+			in.line, in.column = d.uint(), d.uint()
+		}
+		p.segments[i] = code
+	}
+	if d.err == nil && len(d.data) != 0 {
+		d.fail()
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	p.link()
+	return p, nil
+}
+
+// validate checks the operands of every instruction.
+func (p *Program) validate() error {
+	if len(p.segments) == 0 {
+		return fmt.Errorf("malformed program: no code")
+	}
+	isString := func(i int) bool {
+		if i >= len(p.constants) {
+			return false
+		}
+		_, ok := p.constants[i].(string)
+		return ok
+	}
+	laterSegment := func(current, i int) bool {
+		return i > current && i < len(p.segments)
+	}
+	for s, code := range p.segments {
+		for pc, in := range code {
+			ok := in.op > 0 && in.op < opCount
+			switch in.op {
+			case opConst:
+				ok = in.a < len(p.constants)
+			case opContextField, opField, opRecurse, opVariable:
+				ok = isString(in.a)
+			case opOptField:
+				ok = isString(in.a) && in.b > pc && in.b <= len(code)
+			case opJumpIfNil, opOptIndex, opAnd, opOr, opJumpIfNotNil, opLenientJump, opBetweenLow:
+				ok = in.b > pc && in.b <= len(code)
+			case opProject, opDefault:
+				ok = laterSegment(s, in.a)
+			case opLet:
+				ok = isString(in.a) && laterSegment(s, in.b)
+			case opCall:
+				ok = in.a < len(p.calls)
+				if ok {
+					for _, arg := range p.calls[in.a].args {
+						ok = ok && laterSegment(s, arg.segment)
+					}
+				}
+			}
+			if !ok {
+				return fmt.Errorf("malformed program: invalid instruction %d of segment %d", pc, s)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,505 @@
+// Package vm compiles expressions to a stack-based instruction set and runs
+// them. A program needs no lexing or parsing to run, so it can be stored in
+// a compiled artifact and executed directly:
+//
+//	program, err := vm.Compile(expr)
+//	code, err := program.Encode()
+//	...
+//	program, err = vm.Decode(code)
+//	result, err := program.Run(ctx, env.NewEnvironment())
+//
+// Running a program gives the same results and errors as evaluating the
+// expression it was compiled from, including resource limits, capability
+// checks, dry runs and metrics. Observers are not notified, as a program
+// has no expression nodes to report.
+package vm
+
+import (
+	"fmt"
+	"github.com/SpecDrivenDesign/lql/pkg/ast"
+	"github.com/SpecDrivenDesign/lql/pkg/ast/expressions"
+	"github.com/SpecDrivenDesign/lql/pkg/env"
+	"github.com/SpecDrivenDesign/lql/pkg/errors"
+	"github.com/SpecDrivenDesign/lql/pkg/param"
+	"github.com/SpecDrivenDesign/lql/pkg/tokens"
+	"github.com/SpecDrivenDesign/lql/pkg/types"
+)
+
+// Version is the version of the instruction set. Decode rejects programs
+// encoded for any other version.
+const Version = 6
+
+// op is an instruction opcode. Operands a and b are described for each
+// opcode; "the top" is the value on top of the stack.
+type op uint8
+
+const (
+	opNode         op = iota + 1 // count the evaluation of a node at depth a
+	opConst                      // push constant a
+	opContext                    // push the context
+	opContextField               // push the context field named by constant a
+	opJumpIfNil                  // jump to b if the top is null
+	opField                      // replace the top with its field named by constant a
+	opOptField                   // as opField, but jump to b with null if the field is missing
+	opIndex                      // pop an index and replace the top with what it selects
+	opOptIndex                   // as opIndex, but jump to b with null if it selects nothing
+	opProject                    // replace the top, an array, with segment a run on each element
+	opRecurse                    // replace the top with every value under constant a at any depth
+	opUnary                      // apply the unary operator with token type a to the top
+	opBinary                     // pop the right operand and apply the binary operator with token type a
+	opAnd                        // check the top is a boolean; jump to b if false, otherwise pop it
+	opOr                         // check the top is a boolean; jump to b if true, otherwise pop it
+	opCheckBool                  // check the top is a boolean operand of operator a
+	opCall                       // push the result of call site a
+	opArray                      // pop a values into an array
+	opObject                     // push an empty object
+	opKey                        // check the top is a string key not yet in the object below it
+	opSetField                   // pop a value and a key and set that field of the object below
+	opProduced                   // check the top against the environment's limits
+	opLike                       // pop a pattern and match the top against it
+	opDefault                    // push the result of segment a, or null if it fails with a missing value
+	opJumpIfNotNil               // jump to b if the top is not null, otherwise pop it
+	opResolve                    // replace the top, if a context provider, with its whole value
+	opLenientJump                // as opJumpIfNil, but only in a lenient environment
+	opLet                        // replace the top with the result of segment b run with the top bound to the variable named by constant a
+	opVariable                   // push the variable named by constant a
+	opBetweenLow                 // pop a lower bound and check the top is at least it; jump to b with false if not
+	opBetweenHigh                // pop an upper bound and replace the top with whether it is at most the bound
+	opCount
+)
+
+// operands is the number of stack values each opcode reads; opArray reads
+// a further a values.
+var operands = [opCount]int{
+	opJumpIfNil: 1, opField: 1, opOptField: 1, opIndex: 2, opOptIndex: 2,
+	opProject: 1, opRecurse: 1, opUnary: 1, opBinary: 2, opAnd: 1, opOr: 1,
+	opCheckBool: 1, opKey: 2, opSetField: 3, opProduced: 1, opLike: 2,
+	opJumpIfNotNil: 1, opResolve: 1, opLenientJump: 1, opLet: 1,
+	opBetweenLow: 2, opBetweenHigh: 2,
+}
+
+// instruction is a single instruction. Line and column locate the source
+// construct it was compiled from, for errors.
+type instruction struct {
+	op     op
+	a, b   int
+	line   int
+	column int
+
+	// The operator of opUnary or opBinary, resolved by link.
+	unary  expressions.UnaryOperatorFunc
+	binary expressions.BinaryOperatorFunc
+}
+
+// callSite describes a function call. Each argument is compiled to its own
+// segment so that lazy functions can evaluate it on demand.
+type callSite struct {
+	library, function      string
+	line, column           int
+	parenLine, parenColumn int
+	args                   []callArg
+}
+
+type callArg struct {
+	segment      int
+	line, column int
+}
+
+// Program is an expression compiled to instructions. Segment 0 evaluates
+// the expression; the others evaluate projections, call arguments and the
+// left operand of "?:" and the bodies of LET. A segment leaves exactly one value on its stack.
+// Programs are not modified by Run and may be run concurrently.
+type Program struct {
+	constants []interface{}
+	calls     []callSite
+	segments  [][]instruction
+	depths    []int // the stack size each segment needs, set by link
+	// annotations holds the metadata of the annotated nodes compiled,
+	// innermost first. Decoded programs have none.
+	annotations []annotation
+}
+
+// annotation records that the instructions from start up to end of a
+// segment evaluate a node with metadata meta.
+type annotation struct {
+	segment, start, end int
+	meta                ast.Metadata
+}
+
+// errMalformed is returned when a decoded program misuses its stack.
+var errMalformed = fmt.Errorf("malformed program")
+
+// Run evaluates the program against ctx with e.
+func (p *Program) Run(ctx map[string]interface{}, e *env.Environment) (interface{}, error) {
+	return p.RunIn(ctx, nil, e)
+}
+
+// RunIn evaluates the program against ctx in scope, which holds the roots
+// the evaluation reads (see env.NewScope), with e.
+func (p *Program) RunIn(ctx map[string]interface{}, scope *env.Scope, e *env.Environment) (interface{}, error) {
+	scope, started := e.StartEvaluation(scope)
+	if started {
+		defer e.FinishEvaluation(scope)
+	}
+	return p.run(0, nil, ctx, scope, e)
+}
+
+// link resolves the operators of the program's instructions and sizes the
+// stacks of its segments. Programs are linked once, when compiled or
+// decoded.
+func (p *Program) link() {
+	p.depths = make([]int, len(p.segments))
+	for s, code := range p.segments {
+		// Jumps only skip code that leaves the stack as it found it, so
+		// following the instructions in order finds the deepest stack.
+		depth, deepest := 1, 1
+		for i := range code {
+			in := &code[i]
+			switch in.op {
+			case opUnary:
+				in.unary, _ = expressions.UnaryOperator(tokens.TokenType(in.a))
+			case opBinary:
+				in.binary, _ = expressions.BinaryOperator(tokens.TokenType(in.a))
+			}
+			switch in.op {
+			case opConst, opContext, opContextField, opCall, opObject, opDefault, opVariable:
+				depth++
+			case opIndex, opOptIndex, opBinary, opLike, opAnd, opOr, opJumpIfNotNil, opBetweenLow, opBetweenHigh:
+				depth--
+			case opSetField:
+				depth -= 2
+			case opArray:
+				depth += 1 - in.a
+			}
+			deepest = max(deepest, depth)
+		}
+		p.depths[s] = deepest
+	}
+}
+
+// run executes a segment. The stack starts with the element being
+// projected for a projection segment and is empty otherwise.
+func (p *Program) run(segment int, elem []interface{}, ctx map[string]interface{}, scope *env.Scope, e *env.Environment) (_ interface{}, err error) {
+	var pc int
+	if len(p.annotations) > 0 {
+		defer func() {
+			if err != nil {
+				err = p.annotate(segment, pc, err)
+			}
+		}()
+	}
+	code := p.segments[segment]
+	var buf [8]interface{}
+	stack := buf[:0]
+	if p.depths[segment] > len(buf) {
+		stack = make([]interface{}, 0, p.depths[segment])
+	}
+	stack = append(stack, elem...)
+	counting := e.Limits.MaxNodeEvaluations > 0 || e.Limits.MaxDepth > 0 || e.Metrics != nil
+	for pc = 0; pc < len(code); pc++ {
+		in := &code[pc]
+		if len(stack) < operands[in.op] {
+			return nil, errMalformed
+		}
+		top := len(stack) - 1
+		switch in.op {
+		case opNode:
+			if !counting {
+				continue
+			}
+			if err := e.CheckDepth(in.a, in.line, in.column); err != nil {
+				return nil, err
+			}
+			e.CountNode(scope, in.a)
+			if err := e.Step(scope, in.line, in.column); err != nil {
+				return nil, err
+			}
+		case opConst:
+			stack = append(stack, p.constants[in.a])
+		case opContext:
+			stack = append(stack, ctx)
+		case opContextField:
+			name := p.constants[in.a].(string)
+			val, ok := scope.Lookup(ctx, name)
+			if !ok && !e.Lenient {
+				return nil, errors.NewReferenceError(fmt.Sprintf("field '%s' not found", name), in.line, in.column)
+			}
+			stack = append(stack, val)
+		case opJumpIfNil, opLenientJump:
+			if stack[top] == nil && (in.op == opJumpIfNil || e.Lenient) {
+				pc = in.b - 1
+			}
+		case opField, opOptField:
+			// In a lenient environment a missing field leaves null, which
+			// the next opLenientJump skips past.
+			if provider, ok := stack[top].(env.ContextProvider); ok && in.op == opField {
+				// Consecutive field names are resolved together.
+				path := []string{p.constants[in.a].(string)}
+				for pc+2 < len(code) && code[pc+1].op == opLenientJump && code[pc+2].op == opField {
+					pc += 2
+					path = append(path, p.constants[code[pc].a].(string))
+				}
+				val, _, err := expressions.ResolvePath(provider, path, e.Lenient, in.line, in.column)
+				if err != nil {
+					return nil, err
+				}
+				stack[top] = val
+				continue
+			}
+			val, found, err := expressions.AccessField(stack[top], p.constants[in.a].(string), in.op == opOptField || e.Lenient, in.line, in.column)
+			if err != nil {
+				return nil, err
+			}
+			stack[top] = val
+			if !found && in.op == opOptField {
+				pc = in.b - 1
+			}
+		case opIndex, opOptIndex:
+			index := stack[top]
+			stack, top = stack[:top], top-1
+			val, found, err := expressions.AccessIndex(stack[top], index, in.op == opOptIndex || e.Lenient, in.line, in.column)
+			if err != nil {
+				return nil, err
+			}
+			stack[top] = val
+			if !found && in.op == opOptIndex {
+				pc = in.b - 1
+			}
+		case opProject:
+			val, err := expressions.ResolveValue(stack[top], in.line, in.column)
+			if err != nil {
+				return nil, err
+			}
+			arr, ok := types.ConvertToInterfaceSlice(val)
+			if !ok {
+				return nil, errors.NewTypeError("wildcard projection on non‑array", in.line, in.column)
+			}
+			results := make([]interface{}, 0, len(arr))
+			for _, elem := range arr {
+				v, err := p.run(in.a, []interface{}{elem}, ctx, scope, e)
+				if err != nil {
+					return nil, err
+				}
+				results = append(results, v)
+			}
+			if err := e.Produced(scope, results, in.line, in.column); err != nil {
+				return nil, err
+			}
+			stack[top] = results
+		case opRecurse:
+			val, err := expressions.ResolveValue(stack[top], in.line, in.column)
+			if err != nil {
+				return nil, err
+			}
+			results := expressions.RecursiveDescent(val, p.constants[in.a].(string))
+			if err := e.Produced(scope, results, in.line, in.column); err != nil {
+				return nil, err
+			}
+			stack[top] = results
+		case opUnary:
+			if in.unary == nil {
+				return nil, errors.NewUnknownOperatorError("unknown unary operator", in.line, in.column)
+			}
+			val, err := in.unary(stack[top], in.line, in.column)
+			if err != nil {
+				return nil, err
+			}
+			stack[top] = val
+		case opBinary:
+			if in.binary == nil {
+				return nil, errors.NewUnknownOperatorError("unknown binary operator", in.line, in.column)
+			}
+			val, err := expressions.ApplyBinary(tokens.TokenType(in.a), in.binary, stack[top-1], stack[top], in.line, in.column, scope, e)
+			if err != nil {
+				return nil, err
+			}
+			stack = stack[:top]
+			stack[top-1] = val
+		case opAnd, opOr:
+			b, ok := stack[top].(bool)
+			if !ok {
+				return nil, booleanOperandError(in)
+			}
+			if b == (in.op == opOr) {
+				pc = in.b - 1
+			} else {
+				stack = stack[:top]
+			}
+		case opCheckBool:
+			if _, ok := stack[top].(bool); !ok {
+				return nil, booleanOperandError(in)
+			}
+		case opCall:
+			val, err := p.call(&p.calls[in.a], ctx, scope, e)
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, val)
+		case opArray:
+			if len(stack) < in.a {
+				return nil, errMalformed
+			}
+			// An empty literal yields a nil slice, as the tree evaluator's does.
+			var result []interface{}
+			if in.a > 0 {
+				result = append(result, stack[len(stack)-in.a:]...)
+			}
+			stack = append(stack[:len(stack)-in.a], result)
+		case opObject:
+			stack = append(stack, make(map[string]interface{}))
+		case opKey:
+			obj, ok := stack[top-1].(map[string]interface{})
+			if !ok {
+				return nil, errMalformed
+			}
+			key, ok := stack[top].(string)
+			if !ok {
+				return nil, errors.NewTypeError("computed object key must be a string", in.line, in.column)
+			}
+			if _, exists := obj[key]; exists {
+				return nil, errors.NewSemanticError(fmt.Sprintf("Duplicate key '%s' detected", key), in.line, in.column)
+			}
+		case opSetField:
+			obj, ok := stack[top-2].(map[string]interface{})
+			key, isString := stack[top-1].(string)
+			if !ok || !isString {
+				return nil, errMalformed
+			}
+			obj[key] = stack[top]
+			stack = stack[:top-1]
+		case opProduced:
+			if err := e.Produced(scope, stack[top], in.line, in.column); err != nil {
+				return nil, err
+			}
+		case opLike:
+			val, err := expressions.MatchLike(stack[top-1], stack[top], in.line, in.column, scope, e)
+			if err != nil {
+				return nil, err
+			}
+			stack = stack[:top]
+			stack[top-1] = val
+		case opBetweenLow:
+			above, err := expressions.CompareBetween(tokens.TokenGte, stack[top-1], stack[top], in.line, in.column, scope, e)
+			if err != nil {
+				return nil, err
+			}
+			stack = stack[:top]
+			if !above {
+				stack[top-1] = false
+				pc = in.b - 1
+			}
+		case opBetweenHigh:
+			below, err := expressions.CompareBetween(tokens.TokenLte, stack[top-1], stack[top], in.line, in.column, scope, e)
+			if err != nil {
+				return nil, err
+			}
+			stack = stack[:top]
+			stack[top-1] = below
+		case opDefault:
+			val, err := p.run(in.a, nil, ctx, scope, e)
+			if err != nil {
+				if !expressions.DefaultRecovers(err) {
+					return nil, err
+				}
+				val = nil
+			}
+			stack = append(stack, val)
+		case opLet:
+			val, err := p.run(in.b, nil, ctx, scope.WithVariable(p.constants[in.a].(string), stack[top]), e)
+			if err != nil {
+				return nil, err
+			}
+			stack[top] = val
+		case opVariable:
+			name := p.constants[in.a].(string)
+			val, ok := scope.Variable(name)
+			if !ok {
+				return nil, errors.NewUnknownIdentifierError(fmt.Sprintf("Bare identifier '%s' is not allowed", name), in.line, in.column)
+			}
+			stack = append(stack, val)
+		case opJumpIfNotNil:
+			if stack[top] != nil {
+				pc = in.b - 1
+			} else {
+				stack = stack[:top]
+			}
+		case opResolve:
+			val, err := expressions.ResolveValue(stack[top], in.line, in.column)
+			if err != nil {
+				return nil, err
+			}
+			stack[top] = val
+		default:
+			return nil, errMalformed
+		}
+	}
+	if len(stack) != 1 {
+		return nil, errMalformed
+	}
+	return stack[0], nil
+}
+
+// annotate attaches to err, raised by the instruction at pc of a segment,
+// the metadata of the annotated nodes whose instructions include it, as
+// the tree evaluator does while err unwinds out of them.
+func (p *Program) annotate(segment, pc int, err error) error {
+	for _, a := range p.annotations {
+		if a.segment == segment && a.start <= pc && pc < a.end {
+			err = ast.WithMetadata(err, a.meta)
+		}
+	}
+	return err
+}
+
+// call calls a call site. Arguments are evaluated before the call, except
+// for cache.memo and lazy functions, which evaluate them as needed.
+func (p *Program) call(site *callSite, ctx map[string]interface{}, scope *env.Scope, e *env.Environment) (interface{}, error) {
+	e.CountCall(scope, site.library, site.function)
+	if err := e.CheckProfile(site.library, site.function, site.line, site.column); err != nil {
+		return nil, err
+	}
+	if site.library == "cache" && site.function == "memo" {
+		return expressions.Memo(e, p.lazyArgs(site, ctx, scope, e), site.line, site.column)
+	}
+	lib, err := expressions.LookupFunction(e, site.library, site.function, site.line, site.column)
+	if err != nil {
+		return nil, err
+	}
+	if lazy, ok := expressions.LazyFunction(e, lib, site.library, site.function); ok {
+		return expressions.CallLazy(e, scope, lazy, site.library, site.function, p.lazyArgs(site, ctx, scope, e), site.line, site.column, site.parenLine, site.parenColumn)
+	}
+	var args []param.Arg
+	for _, arg := range site.args {
+		val, err := p.run(arg.segment, nil, ctx, scope, e)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, param.Arg{Value: val, Line: arg.line, Column: arg.column})
+	}
+	return expressions.Call(e, scope, lib, site.library, site.function, args, site.line, site.column, site.parenLine, site.parenColumn)
+}
+
+// lazyArgs returns the arguments of a call site, each evaluated only when
+// the function asks for it.
+func (p *Program) lazyArgs(site *callSite, ctx map[string]interface{}, scope *env.Scope, e *env.Environment) []param.LazyArg {
+	args := make([]param.LazyArg, len(site.args))
+	for i, arg := range site.args {
+		segment := arg.segment
+		args[i] = param.LazyArg{Line: arg.line, Column: arg.column, Eval: func() (interface{}, error) {
+			return p.run(segment, nil, ctx, scope, e)
+		}, EvalWith: func(value interface{}) (interface{}, error) {
+			return p.run(segment, nil, ctx, scope.WithVariable(env.ItemVariable, value), e)
+		}}
+	}
+	return args
+}
+
+// booleanOperandError reports a non-boolean operand of the AND or OR
+// operator compiled to in.
+func booleanOperandError(in *instruction) error {
+	operator := tokens.TokenAnd
+	if in.op == opOr || (in.op == opCheckBool && tokens.TokenType(in.a) == tokens.TokenOr) {
+		operator = tokens.TokenOr
+	}
+	return errors.NewSemanticError(fmt.Sprintf("%s operator requires boolean operand", tokens.FixedTokenLiterals[operator]), in.line, in.column)
+}